@@ -0,0 +1,760 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// run, debug和test共用的执行选项
+type runFlags struct {
+	*commonFlags
+
+	printStats           bool
+	printOpcodeHistogram bool
+	histoAtExit          bool
+	fixedClock           string
+	locale               string
+	timeZone             string
+	serialAllowlist      string
+	denyPermissions      string
+	allowClasses         string
+	denyClasses          string
+	nativeAudit          int
+	threadInstructions   int64
+	threadAllocations    int64
+	noIntrinsics         bool
+	eagerLink            bool
+	lazyLink             bool
+	strictInit           bool
+	onUnsupported        string
+	traceEvery           int64
+	traceInterval        time.Duration
+	traceStart           string
+	traceStop            string
+	traceStack           bool
+	objectGraph          string
+	objectGraphRoots     string
+	watch                string
+	watchBreak           string
+	exception            string
+	exceptionBreak       string
+	exceptionStack       bool
+	history              int
+	rewrite              string
+	crashDir             string
+	coverage             string
+	coverageClasses      string
+	preload              string
+	preloadRecord        string
+	stringDedup          time.Duration
+}
+
+func addRunFlags(fs *flag.FlagSet) *runFlags {
+	r := &runFlags{commonFlags: addCommonFlags(fs)}
+	fs.BoolVar(&r.printStats, "stats", false, "退出时打印执行统计")
+	fs.BoolVar(&r.printOpcodeHistogram, "opcodeHistogram", false, "退出时打印字节码执行次数直方图")
+	fs.BoolVar(&r.histoAtExit, "histoAtExit", false, "统计guest创建的对象, 退出时按类打印仍然存活的对象数(类似jmap -histo)")
+	fs.StringVar(&r.fixedClock, "clock", "", "使用固定的起始时间(RFC3339格式, 如2020-01-01T00:00:00Z), 每次读取时钟前进1毫秒, 使程序输出可复现")
+	fs.StringVar(&r.locale, "locale", "", "默认Locale, 如en_US, 默认取宿主机环境")
+	fs.StringVar(&r.timeZone, "timezone", "", "默认时区ID, 如Asia/Shanghai, 默认取宿主机环境")
+	fs.StringVar(&r.serialAllowlist, "serialAllowlist", "", "允许反序列化的类, 多个用逗号分隔, 可以用com.fh.*表示整个包, 默认不限制")
+	fs.StringVar(&r.denyPermissions, "deny", "", "禁止guest使用的权限, 多个用逗号分隔, 可选file, network, process, env, reflection, exit")
+	fs.StringVar(&r.allowClasses, "allowClasses", "", "只允许加载和执行的类, 多个用逗号分隔, 可以用java.lang.*表示整个包, 默认不限制")
+	fs.StringVar(&r.denyClasses, "denyClasses", "", "禁止加载和执行的类, 多个用逗号分隔, 如java.io.*,com.sun.*, 优先于-allowClasses")
+	fs.Int64Var(&r.threadInstructions, "threadMaxInstructions", 0, "每个guest线程最多执行的字节码条数, 超过时只终止该线程, 0表示不限制")
+	fs.Int64Var(&r.threadAllocations, "threadMaxAllocations", 0, "每个guest线程最多创建的对象和数组个数, 超过时只终止该线程, 0表示不限制")
+	fs.IntVar(&r.nativeAudit, "nativeAudit", 0, "记录最近N次本地方法调用, 退出时打印, 0表示不记录")
+	fs.BoolVar(&r.noIntrinsics, "noIntrinsics", false, "不用go实现替代String.hashCode, Math.max等热点方法, 全部解释执行字节码")
+	fs.BoolVar(&r.eagerLink, "eagerLink", false, "执行main之前链接所有可达的类和方法, 一次性报告缺失的类, 字段, 方法和本地方法")
+	fs.BoolVar(&r.lazyLink, "lazyLink", false, "加载类时不解码和链接字节码, 方法第一次执行时才处理, 适合classpath很大但只执行少量方法的场景")
+	fs.BoolVar(&r.strictInit, "strictInit", false, "严格按JLS 12.4初始化类, 只有主动使用才执行<clinit>, <clinit>抛出异常时报告ExceptionInInitializerError而不是忽略")
+	fs.StringVar(&r.onUnsupported, "onUnsupported", "", "遇到尚未实现的字节码, 本地方法和class属性时的处理方式: fail报错, skip警告后返回默认值继续执行; 可以按类别配置, 如opcode=skip,native=fail, 退出时打印遇到过的缺口")
+	fs.Int64Var(&r.traceEvery, "traceEvery", 0, "追踪执行的指令, 每N条输出一条到stderr; 指定任意-trace选项都会打开追踪, 没有指定时每条都输出")
+	fs.DurationVar(&r.traceInterval, "traceInterval", 0, "追踪指令时两次输出的最小间隔, 如10ms, 单独指定时从每条指令中按时间采样")
+	fs.StringVar(&r.traceStart, "traceStart", "", "进入匹配的方法时开始追踪, 如com.fh.Foo.bar或com.fh.Foo.*, 默认从头开始")
+	fs.StringVar(&r.traceStop, "traceStop", "", "匹配的方法返回时停止追踪, 默认为-traceStart匹配的方法返回时")
+	fs.BoolVar(&r.traceStack, "traceStack", false, "追踪指令时同时输出操作数栈, 对象按字段显示")
+	fs.StringVar(&r.watch, "watch", "", "观察字段的读写, 每次访问输出访问的方法, pc和值, 多个用逗号分隔, 格式为[r:|w:]类全名.字段名, 如w:com.fh.Counter.count")
+	fs.StringVar(&r.watchBreak, "watchBreak", "", "与-watch格式相同, 第一次命中时停止执行并报告访问的位置, 如w:com.fh.Counter.count在第一次写入之前停止")
+	fs.StringVar(&r.exception, "exception", "", "匹配的异常(包括子类)被抛出或捕获时输出位置, 即使异常随后被捕获, 多个用逗号分隔, 格式为[throw:|catch:|all:]异常类名, 可以用com.fh.*表示整个包, 如java.lang.IllegalStateException,catch:com.fh.*")
+	fs.StringVar(&r.exceptionBreak, "exceptionBreak", "", "与-exception格式相同, 第一次命中时停止执行并报告位置")
+	fs.BoolVar(&r.exceptionStack, "exceptionStack", false, "-exception和-exceptionBreak命中时同时输出调用链")
+	fs.StringVar(&r.rewrite, "rewrite", "", "加载类时改写匹配方法的字节码, 多个用逗号分隔, 格式为动作:类全名.方法名, 动作为log(输出入口和参数), count(退出时打印调用次数)或delay=时长, 如count:com.fh.*.*,delay=20ms:com.fh.Dao.query")
+	fs.IntVar(&r.history, "history", 0, "记录每个线程最近N条指令执行前的pc, 本地变量和操作数栈, 执行出错或者-watchBreak中断时从新到旧打印出错线程的记录, 0表示不记录")
+	fs.StringVar(&r.objectGraph, "objectGraph", "", "退出时把static字段可达的对象图写入文件, 扩展名为.dot或.gv时输出Graphviz格式, 否则输出JSON")
+	fs.StringVar(&r.objectGraphRoots, "objectGraphRoots", "", "只从这些类的static字段出发导出对象图, 多个用逗号分隔, 如com.fh.*, 默认为所有已加载的类")
+	fs.StringVar(&r.coverage, "coverage", "", "统计每条指令是否执行过, 退出时把覆盖率报告写入文件, 扩展名为.xml时输出JaCoCo XML格式, .info或.lcov时输出lcov格式, 否则输出按类汇总的文本")
+	fs.StringVar(&r.coverageClasses, "coverageClasses", "", "只统计这些类的覆盖率, 多个用逗号分隔, 如com.fh.*, 默认为所有类")
+	fs.StringVar(&r.preload, "preload", "", "启动时按清单文件提前解析和链接类和方法(不执行<clinit>), 减少第一次使用时的加载延迟, 清单由-preloadRecord生成")
+	fs.StringVar(&r.preloadRecord, "preloadRecord", "", "记录本次运行加载的类和执行的方法, 退出时写入文件, 作为下次启动的-preload清单")
+	fs.DurationVar(&r.stringDedup, "stringDedup", 0, "每隔一段时间(如30s)在后台让内容相同的String共享value数组, 退出时打印累计节省的字节数, 0表示不去重")
+	fs.StringVar(&r.crashDir, "crashDir", "", "遇到致命错误(解释器panic, 字节码校验失败, 内存耗尽)时在此目录下生成崩溃报告: 出错的类, 出错位置的反汇编, 调用链, 对象直方图和虚拟机选项")
+
+	return r
+}
+
+// 把选项应用到虚拟机上
+func (r *runFlags) configure(miniJvm *vm.MiniJvm) error {
+	if len(r.properties) > 0 {
+		miniJvm.Properties = r.properties
+	}
+	miniJvm.MaxStackDepth = r.maxStackDepth
+	miniJvm.DisableIntrinsics = r.noIntrinsics
+	miniJvm.EagerLink = r.eagerLink
+	miniJvm.LazyLink = r.lazyLink
+	miniJvm.StrictInit = r.strictInit
+	miniJvm.TrackHeap = r.histoAtExit
+
+	if "" != r.locale {
+		miniJvm.Locale = r.locale
+	}
+	if "" != r.timeZone {
+		miniJvm.TimeZone = r.timeZone
+	}
+
+	if "" != r.serialAllowlist {
+		miniJvm.SerializationAllowlist = strings.Split(r.serialAllowlist, ",")
+	}
+
+	if "" != r.denyPermissions {
+		miniJvm.Policy = vm.NewPolicy(vm.PolicyAllow)
+		miniJvm.Policy.Deny(vm.ParsePermissions(r.denyPermissions)...)
+	}
+
+	if "" != r.allowClasses || "" != r.denyClasses {
+		miniJvm.MethodArea.ClassPolicy = vm.NewClassPolicy()
+		if "" != r.allowClasses {
+			miniJvm.MethodArea.ClassPolicy.Allow(strings.Split(r.allowClasses, ",")...)
+		}
+		if "" != r.denyClasses {
+			miniJvm.MethodArea.ClassPolicy.Deny(strings.Split(r.denyClasses, ",")...)
+		}
+	}
+
+	if "" != r.onUnsupported {
+		policy, err := vm.ParseUnsupportedPolicy(r.onUnsupported)
+		if nil != err {
+			return err
+		}
+		miniJvm.Unsupported = policy
+	}
+
+	if r.threadInstructions > 0 || r.threadAllocations > 0 {
+		miniJvm.ThreadLimits = &vm.ThreadLimits{
+			MaxInstructions: r.threadInstructions,
+			MaxAllocations:  r.threadAllocations,
+		}
+	}
+
+	if r.nativeAudit > 0 {
+		miniJvm.NativeAudit = vm.NewNativeCallAudit(r.nativeAudit)
+	}
+
+	if r.traceEvery > 0 || r.traceInterval > 0 || "" != r.traceStart || "" != r.traceStop || r.traceStack {
+		miniJvm.Tracer = vm.NewTracer(os.Stderr)
+		miniJvm.Tracer.Every = r.traceEvery
+		miniJvm.Tracer.Interval = r.traceInterval
+		miniJvm.Tracer.Start = r.traceStart
+		miniJvm.Tracer.Stop = r.traceStop
+		miniJvm.Tracer.ShowStack = r.traceStack
+	}
+
+	if "" != r.rewrite {
+		miniJvm.Rewriter = vm.NewRewriter(os.Stderr)
+		for _, item := range strings.Split(r.rewrite, ",") {
+			rule, err := vm.ParseRewriteRule(item)
+			if nil != err {
+				return err
+			}
+			miniJvm.Rewriter.Add(rule)
+		}
+	}
+
+	if "" != r.coverage {
+		var patterns []string
+		if "" != r.coverageClasses {
+			patterns = strings.Split(r.coverageClasses, ",")
+		}
+		miniJvm.Coverage = vm.NewCoverage(patterns...)
+	}
+
+	if r.history > 0 {
+		miniJvm.History = vm.NewExecutionHistory(r.history)
+	}
+
+	if "" != r.watch || "" != r.watchBreak {
+		miniJvm.Watchpoints = vm.NewWatchpoints(os.Stderr)
+		for _, spec := range []struct {
+			list       string
+			breakpoint bool
+		}{{r.watch, false}, {r.watchBreak, true}} {
+			if "" == spec.list {
+				continue
+			}
+			for _, item := range strings.Split(spec.list, ",") {
+				point, err := vm.ParseWatchpoint(item)
+				if nil != err {
+					return err
+				}
+				point.Break = spec.breakpoint
+				miniJvm.Watchpoints.Add(point)
+			}
+		}
+	}
+
+	if "" != r.exception || "" != r.exceptionBreak {
+		miniJvm.ExceptionBreakpoints = vm.NewExceptionBreakpoints(os.Stderr)
+		miniJvm.ExceptionBreakpoints.DumpFrames = r.exceptionStack
+		for _, spec := range []struct {
+			list       string
+			breakpoint bool
+		}{{r.exception, false}, {r.exceptionBreak, true}} {
+			if "" == spec.list {
+				continue
+			}
+			for _, item := range strings.Split(spec.list, ",") {
+				point, err := vm.ParseExceptionBreakpoint(item)
+				if nil != err {
+					return err
+				}
+				point.Break = spec.breakpoint
+				miniJvm.ExceptionBreakpoints.Add(point)
+			}
+		}
+	}
+
+	if "" != r.preload {
+		f, err := os.Open(r.preload)
+		if nil != err {
+			return err
+		}
+		manifest, err := vm.ReadPreloadManifest(f)
+		f.Close()
+		if nil != err {
+			return fmt.Errorf("invalid preload manifest '%s': %w", r.preload, err)
+		}
+		miniJvm.Preload = manifest
+	}
+	if "" != r.preloadRecord {
+		miniJvm.PreloadRecorder = vm.NewPreloadRecorder()
+	}
+
+	miniJvm.StringDedupInterval = r.stringDedup
+
+	if "" != r.fixedClock {
+		start, err := time.Parse(time.RFC3339, r.fixedClock)
+		if nil != err {
+			return fmt.Errorf("invalid clock '%s': %w", r.fixedClock, err)
+		}
+		miniJvm.Clock = vm.NewFixedClock(start, time.Millisecond)
+	}
+
+	return nil
+}
+
+// 退出前打印统计信息
+func (r *runFlags) dump(miniJvm *vm.MiniJvm) {
+	if r.printStats {
+		fmt.Fprint(os.Stderr, miniJvm.Stats())
+	}
+	if r.printOpcodeHistogram {
+		miniJvm.OpcodeCounter().Dump(os.Stderr)
+	}
+	if r.histoAtExit {
+		miniJvm.HeapHistogram().Dump(os.Stderr)
+	}
+	if miniJvm.StringDedupInterval > 0 {
+		total := miniJvm.StringDedupTotal()
+		fmt.Fprintln(os.Stderr, total.String())
+	}
+	if nil != miniJvm.NativeAudit {
+		miniJvm.NativeAudit.Dump(os.Stderr)
+	}
+	if nil != miniJvm.Unsupported {
+		miniJvm.Unsupported.Dump(os.Stderr)
+	}
+	if nil != miniJvm.Watchpoints {
+		for _, point := range miniJvm.Watchpoints.Points() {
+			fmt.Fprintf(os.Stderr, "watchpoint %s: %d hits\n", point, point.Hits())
+		}
+	}
+	if nil != miniJvm.ExceptionBreakpoints {
+		for _, point := range miniJvm.ExceptionBreakpoints.Points() {
+			fmt.Fprintf(os.Stderr, "exception breakpoint %s: %d hits\n", point, point.Hits())
+		}
+	}
+	if nil != miniJvm.Rewriter {
+		for _, count := range miniJvm.Rewriter.Counts() {
+			fmt.Fprintf(os.Stderr, "%s: %d calls\n", count.Method, count.Count)
+		}
+	}
+	if "" != r.coverage {
+		if err := exportCoverage(miniJvm, r.coverage); nil != err {
+			fmt.Fprintf(os.Stderr, "failed to export coverage: %v\n", err)
+		}
+	}
+	if "" != r.preloadRecord {
+		if err := exportPreloadManifest(miniJvm, r.preloadRecord); nil != err {
+			fmt.Fprintf(os.Stderr, "failed to write preload manifest: %v\n", err)
+		}
+	}
+	if "" != r.objectGraph {
+		if err := exportObjectGraph(miniJvm, r.objectGraph, r.objectGraphRoots); nil != err {
+			fmt.Fprintf(os.Stderr, "failed to export object graph: %v\n", err)
+		}
+	}
+}
+
+func exportCoverage(miniJvm *vm.MiniJvm, path string) error {
+	report := miniJvm.CoverageReport()
+
+	f, err := os.Create(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return report.WriteJaCoCoXML(f)
+	case ".info", ".lcov":
+		return report.WriteLcov(f)
+	default:
+		return report.WriteText(f)
+	}
+}
+
+func exportPreloadManifest(miniJvm *vm.MiniJvm, path string) error {
+	f, err := os.Create(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	return miniJvm.PreloadRecorder.Manifest().Write(f)
+}
+
+func exportObjectGraph(miniJvm *vm.MiniJvm, path string, roots string) error {
+	var patterns []string
+	if "" != roots {
+		patterns = strings.Split(roots, ",")
+	}
+	graph := miniJvm.StaticObjectGraph(vm.DefaultObjectGraphMaxNodes, patterns...)
+
+	f, err := os.Create(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		err = graph.WriteDot(f)
+	default:
+		err = graph.WriteJSON(f)
+	}
+	if nil != err {
+		return err
+	}
+	if graph.Truncated {
+		fmt.Fprintf(os.Stderr, "object graph truncated at %d objects\n", vm.DefaultObjectGraphMaxNodes)
+	}
+
+	return nil
+}
+
+// mini-jvm run -main 主类 -classpath xxx [命令行参数...]
+func runRun(args []string) int {
+	fs := newFlagSet("run")
+	mainClass := fs.String("main", "", "主类全名")
+	flags := addRunFlags(fs)
+	fs.Parse(args)
+
+	return execMain(*mainClass, flags, fs.Args())
+}
+
+// mini-jvm debug -main 主类 -classpath xxx [命令行参数...]
+// 与run相同, 默认打开日志和统计
+func runDebug(args []string) int {
+	fs := newFlagSet("debug")
+	mainClass := fs.String("main", "", "主类全名")
+	flags := addRunFlags(fs)
+	fs.Parse(args)
+
+	flags.consoleLog = true
+	flags.printStats = true
+	flags.printOpcodeHistogram = true
+
+	return execMain(*mainClass, flags, fs.Args())
+}
+
+func execMain(mainClass string, flags *runFlags, cmdArgs []string) int {
+	if "" == mainClass {
+		fmt.Println("error: lack main class")
+		return 1
+	}
+
+	// 初始化日志
+	utils.InitLog(flags.consoleLog)
+
+	// 启动jvm
+	miniJvm, err := vm.NewMiniJvmWithOptions(mainClass, flags.classPaths(), flags.classPathOptions(), cmdArgs...)
+	if nil != err {
+		return flags.fail(err)
+	}
+	utils.LogInfoPrintf("JVM instance created")
+
+	if err := flags.configure(miniJvm); nil != err {
+		fmt.Printf("error: %v\n", err)
+		return 1
+	}
+
+	err = miniJvm.Start()
+	flags.dump(miniJvm)
+	if nil != err {
+		if nil != miniJvm.History {
+			miniJvm.History.Dump(os.Stderr, vm.ErrorThreadID(err), nil)
+		}
+		if "" != flags.crashDir {
+			dir, crashErr := miniJvm.WriteCrashBundle(flags.crashDir, err)
+			if nil != crashErr {
+				fmt.Fprintf(os.Stderr, "failed to write crash bundle: %v\n", crashErr)
+			} else if "" != dir {
+				fmt.Fprintf(os.Stderr, "crash bundle written to %s\n", dir)
+			}
+		}
+		return flags.fail(err)
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm disasm -classpath xxx 类全名...
+func runDisasm(args []string) int {
+	fs := newFlagSet("disasm")
+	flags := addCommonFlags(fs)
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	if 0 == fs.NArg() {
+		fmt.Println("error: lack class name")
+		return 1
+	}
+
+	disassembler, err := vm.NewDisassembler(flags.classPaths(), flags.classPathOptions())
+	if nil != err {
+		return flags.fail(err)
+	}
+
+	for _, className := range fs.Args() {
+		if err := disassembler.Disassemble(os.Stdout, className); nil != err {
+			return flags.fail(err)
+		}
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm describe -classpath xxx 类全名...
+func runDescribe(args []string) int {
+	fs := newFlagSet("describe")
+	flags := addCommonFlags(fs)
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	if 0 == fs.NArg() {
+		fmt.Println("error: lack class name")
+		return 1
+	}
+
+	describer, err := vm.NewDescriber(flags.classPaths(), flags.classPathOptions())
+	if nil != err {
+		return flags.fail(err)
+	}
+
+	for ix, className := range fs.Args() {
+		desc, err := describer.Describe(className)
+		if nil != err {
+			return flags.fail(err)
+		}
+
+		if ix > 0 {
+			fmt.Println()
+		}
+		desc.Print(os.Stdout)
+		fmt.Printf("%d methods, %d cannot be executed\n", len(desc.Methods), desc.UnsupportedCount())
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm verify -classpath xxx [类全名...]
+// 不指定类名时校验classpath中的所有class
+func runVerify(args []string) int {
+	fs := newFlagSet("verify")
+	flags := addCommonFlags(fs)
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	verifier, err := vm.NewVerifier(flags.classPaths(), flags.classPathOptions())
+	if nil != err {
+		return flags.fail(err)
+	}
+
+	var report *vm.VerifyReport
+	if classNames := fs.Args(); len(classNames) > 0 {
+		report = verifier.VerifyClasses(classNames)
+
+	} else {
+		report, err = verifier.VerifyClasspath()
+		if nil != err {
+			return flags.fail(err)
+		}
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("verified %d classes, %d problems\n", report.ClassCount, len(report.Problems))
+
+	if errReport := report.ErrorReport(); nil != errReport {
+		if flags.errorJson {
+			fmt.Fprintln(os.Stderr, string(errReport.JSON()))
+		}
+		return errReport.ExitCode
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm roundtrip -classpath xxx [类全名...]
+// 不指定类名时检查classpath中的所有class
+func runRoundtrip(args []string) int {
+	fs := newFlagSet("roundtrip")
+	flags := addCommonFlags(fs)
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	report, err := vm.RoundTripClasses(flags.classPaths(), flags.classPathOptions(), fs.Args())
+	if nil != err {
+		return flags.fail(err)
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("round-tripped %d classes, %d problems\n", report.ClassCount, len(report.Problems))
+
+	if errReport := report.ErrorReport(); nil != errReport {
+		if flags.errorJson {
+			fmt.Fprintln(os.Stderr, string(errReport.JSON()))
+		}
+		return errReport.ExitCode
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm test -classpath xxx [类全名...]
+// 每个测试类的main方法正常返回即为通过
+func runTest(args []string) int {
+	fs := newFlagSet("test")
+	flags := addRunFlags(fs)
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	classNames := fs.Args()
+	if 0 == len(classNames) {
+		var err error
+		classNames, err = vm.ListTestClasses(flags.classPaths(), flags.classPathOptions())
+		if nil != err {
+			return flags.fail(err)
+		}
+	}
+
+	var configErr error
+	results := vm.RunTests(flags.classPaths(), flags.classPathOptions(), classNames, func(miniJvm *vm.MiniJvm) {
+		if err := flags.configure(miniJvm); nil != err {
+			configErr = err
+		}
+	})
+	if nil != configErr {
+		fmt.Printf("error: %v\n", configErr)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		if nil != result.Err {
+			failed++
+			fmt.Printf("FAIL %s (%v)\n    %v\n", result.ClassName, result.Duration, result.Err)
+			if flags.errorJson {
+				fmt.Fprintln(os.Stderr, string(vm.NewErrorReport(result.Err).JSON()))
+			}
+			continue
+		}
+		fmt.Printf("PASS %s (%v)\n", result.ClassName, result.Duration)
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results) - failed, failed)
+
+	if failed > 0 {
+		return vm.ExitUncaughtException
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm bench [-benchtime 1s] [基准测试名...]
+func runBench(args []string) int {
+	fs := newFlagSet("bench")
+	benchTime := fs.Duration("benchtime", time.Second, "每个基准测试至少运行的时间")
+	list := fs.Bool("list", false, "只列出内置的基准测试")
+	fs.Parse(args)
+
+	if *list {
+		for _, b := range vm.Benchmarks() {
+			fmt.Printf("%-14s %s\n", b.Name, b.Description)
+		}
+		return vm.ExitSuccess
+	}
+
+	benchmarks := vm.Benchmarks()
+	if fs.NArg() > 0 {
+		benchmarks = benchmarks[:0]
+		for _, name := range fs.Args() {
+			b := vm.FindBenchmark(name)
+			if nil == b {
+				fmt.Printf("error: unknown benchmark '%s'\n", name)
+				return 1
+			}
+			benchmarks = append(benchmarks, b)
+		}
+	}
+
+	for _, b := range benchmarks {
+		result, err := b.Run(*benchTime)
+		if nil != err {
+			fmt.Printf("error: %v\n", err)
+			return vm.ExitCodeOf(err)
+		}
+		fmt.Println(result)
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm repl -classpath xxx [-javac javac]
+func runRepl(args []string) int {
+	fs := newFlagSet("repl")
+	flags := addRunFlags(fs)
+	javac := fs.String("javac", "", "编译片段使用的javac路径, 不指定时使用内置的表达式编译器, 只支持数字和字符串字面量的算术/拼接表达式")
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	// REPL不执行main方法, 主类只是占位
+	miniJvm, err := vm.NewMiniJvmWithOptions(vm.ReplClassPrefix, flags.classPaths(), flags.classPathOptions())
+	if nil != err {
+		return flags.fail(err)
+	}
+	if err := flags.configure(miniJvm); nil != err {
+		fmt.Printf("error: %v\n", err)
+		return 1
+	}
+
+	repl := vm.NewRepl(miniJvm, *javac)
+	defer repl.Close()
+
+	err = repl.Run(os.Stdin, os.Stdout)
+	flags.dump(miniJvm)
+	if nil != err {
+		return flags.fail(err)
+	}
+
+	return vm.ExitSuccess
+}
+
+// mini-jvm stubgen -classpath rt.jar java.util.ArrayList
+// mini-jvm stubgen -class ArrayList.class
+// javap -s java.util.ArrayList > ArrayList.javap && mini-jvm stubgen -javap ArrayList.javap
+func runStubgen(args []string) int {
+	fs := newFlagSet("stubgen")
+	flags := addCommonFlags(fs)
+	classFile := fs.String("class", "", "直接读取class文件")
+	javapFile := fs.String("javap", "", "读取javap -s的输出")
+	outDir := fs.String("out", "", "输出目录, go文件直接放在目录中, java文件按包名放在子目录中; 不指定时输出到stdout")
+	fs.Parse(args)
+
+	utils.InitLog(flags.consoleLog)
+
+	var stub *vm.StubClass
+	switch {
+	case "" != *javapFile:
+		f, err := os.Open(*javapFile)
+		if nil != err {
+			return flags.fail(err)
+		}
+		defer f.Close()
+
+		stub, err = vm.ParseJavapOutput(f)
+		if nil != err {
+			return flags.fail(err)
+		}
+
+	case "" != *classFile:
+		def, err := class.LoadClassFile(*classFile)
+		if nil != err {
+			return flags.fail(err)
+		}
+		stub = vm.StubClassFromDef(def)
+
+	case 1 == fs.NArg():
+		ma, err := vm.NewMethodArea(&vm.MiniJvm{ClassPathOptions: flags.classPathOptions()}, flags.classPaths(), nil)
+		if nil != err {
+			return flags.fail(err)
+		}
+		def, err := ma.ParseClass(strings.ReplaceAll(fs.Arg(0), ".", "/"))
+		if nil != err {
+			return flags.fail(err)
+		}
+		stub = vm.StubClassFromDef(def)
+
+	default:
+		fmt.Println("error: need one of -javap, -class or a class name")
+		return 1
+	}
+
+	stubs := vm.GenerateStubs(stub)
+	if "" == *outDir {
+		fmt.Println(stubs.GoSource)
+		fmt.Println(stubs.JavaSource)
+		return vm.ExitSuccess
+	}
+
+	goPath := filepath.Join(*outDir, stub.GoFileName())
+	javaPath := filepath.Join(*outDir, filepath.FromSlash(stub.JavaFilePath()))
+	if err := os.MkdirAll(filepath.Dir(javaPath), 0755); nil != err {
+		return flags.fail(err)
+	}
+	for path, content := range map[string]string{goPath: stubs.GoSource, javaPath: stubs.JavaSource} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); nil != err {
+			return flags.fail(err)
+		}
+		fmt.Println(path)
+	}
+
+	return vm.ExitSuccess
+}
@@ -1,3 +1,3 @@
 #!/bin/bash
 
-javac -d mini-lib/classes mini-lib/src/cn/minijvm/io/*.java mini-lib/src/cn/minijvm/concurrency/*.java
\ No newline at end of file
+javac -d mini-lib/classes mini-lib/src/cn/minijvm/io/*.java mini-lib/src/cn/minijvm/concurrency/*.java mini-lib/src/cn/minijvm/lang/*.java mini-lib/src/cn/minijvm/net/*.java mini-lib/src/cn/minijvm/sql/*.java
\ No newline at end of file
@@ -9,41 +9,151 @@ import (
 	"strings"
 )
 
+// 子命令
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []*command
+
+// 在init中赋值, 避免与newFlagSet形成初始化循环
+func init() {
+	commands = []*command{
+		{"run", "run [选项] -main 主类 [命令行参数...]", "执行主类的main方法", runRun},
+		{"disasm", "disasm [选项] 类全名...", "反汇编class中的方法", runDisasm},
+		{"describe", "describe [选项] 类全名...", "列出类的字段和方法签名, 以及每个方法能否在本虚拟机中执行", runDescribe},
+		{"verify", "verify [选项] [类全名...]", "只加载和链接, 不执行, 不指定类名时校验classpath中的所有类", runVerify},
+		{"roundtrip", "roundtrip [选项] [类全名...]", "解析class后重新生成并与原文件比较, 检查常量池和属性的解析, 不指定类名时检查classpath中的所有类", runRoundtrip},
+		{"debug", "debug [选项] -main 主类 [命令行参数...]", "与run相同, 同时打印JVM日志, 执行统计和字节码直方图", runDebug},
+		{"test", "test [选项] [类全名...]", "逐个执行测试类的main方法并汇总结果, 不指定类名时执行classpath中所有以Test结尾的类", runTest},
+		{"stubgen", "stubgen [选项] [类全名]", "根据JDK中的类生成go本地方法骨架和native方法的java stub", runStubgen},
+		{"bench", "bench [选项] [基准测试名...]", "运行内置的基准测试, 输出每秒操作数和内存分配, 不指定名字时运行全部", runBench},
+		{"repl", "repl [选项]", "交互式执行java表达式和语句(类似jshell), 显示每个表达式的结果", runRepl},
+	}
+}
+
 func main() {
-	// 命令行参数
-	mainClass := flag.String("main", "", "主类全名")
-	classpath := flag.String("classpath", "", "类路径,可以是目录也可以是jar包路径, 多个用逗号分隔")
-	consoleLog := flag.Bool("consoleLog", false, "是否在控制台打印JVM日志")
-	flag.Parse()
+	args := os.Args[1:]
 
-	if "" == *mainClass {
-		fmt.Println("error: lack main class")
-		os.Exit(1)
+	// 兼容旧的用法: 直接以选项开头时等同于run
+	if 0 == len(args) || strings.HasPrefix(args[0], "-") {
+		os.Exit(runRun(args))
 	}
 
-	// 初始化日志
-	utils.InitLog(*consoleLog)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			os.Exit(cmd.run(args[1:]))
+		}
+	}
 
-	var path []string
-	if "" != *classpath {
-		path = strings.Split(*classpath, ",")
-	} else {
-		path = []string {*classpath}
+	if "help" != args[0] {
+		fmt.Fprintf(os.Stderr, "error: unknown command '%s'\n", args[0])
+	}
+	printUsage()
+	if "help" != args[0] {
+		os.Exit(2)
 	}
+}
 
-	cmdArgs := flag.Args()
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: mini-jvm <command> [选项] [参数...]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "使用 mini-jvm <command> -h 查看子命令的选项")
+}
 
-	// 启动jvm
-	miniJvm, err := vm.NewMiniJvm(*mainClass, path, cmdArgs...)
-	if nil != err {
-		utils.LogErrorPrintf("%+v", err)
-		os.Exit(1)
+// 创建子命令的FlagSet, -h时打印子命令用法
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(fs.Output(), "usage: mini-jvm %s\n\n", cmd.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// -D可以指定多次
+type propertyFlag map[string]string
+
+func (p propertyFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for key, val := range p {
+		pairs = append(pairs, key + "=" + val)
 	}
-	utils.LogInfoPrintf("JVM instance created")
 
-	err = miniJvm.Start()
-	if nil != err {
+	return strings.Join(pairs, ",")
+}
+
+func (p propertyFlag) Set(val string) error {
+	ix := strings.Index(val, "=")
+	if ix <= 0 {
+		return fmt.Errorf("invalid property '%s', expect key=value", val)
+	}
+	p[val[:ix]] = val[ix + 1:]
+
+	return nil
+}
+
+// 所有子命令共用的选项
+type commonFlags struct {
+	classpath                string
+	consoleLog               bool
+	properties               propertyFlag
+	maxStackDepth            int
+	errorJson                bool
+	dex2jar                  string
+	allowUnverifiedClassPath bool
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	c := &commonFlags{properties: propertyFlag{}}
+	fs.StringVar(&c.classpath, "classpath", "", "类路径,可以是目录也可以是jar包路径, 多个用逗号分隔")
+	fs.BoolVar(&c.consoleLog, "consoleLog", false, "是否在控制台打印JVM日志")
+	fs.Var(c.properties, "D", "系统属性, 格式为key=value, 可以指定多次, guest通过Environment.getProperty()读取")
+	fs.IntVar(&c.maxStackDepth, "maxStackDepth", 0, "最大栈深度, 超过时抛出StackOverflowError, 0表示不限制")
+	fs.BoolVar(&c.errorJson, "error-json", false, "失败时向stderr输出一行JSON格式的错误报告")
+	fs.StringVar(&c.dex2jar, "dex2jar", "", "dex2jar工具(d2j-dex2jar.sh或.bat)的路径, classpath中的Android dex和apk先用它转换成jar再加载, 默认遇到dex时报错")
+	fs.BoolVar(&c.allowUnverifiedClassPath, "allowUnverifiedClassPath", false, "允许下载既没有#sha256=校验和也没有.sha256文件的https classpath, 默认拒绝; http classpath始终需要#sha256=校验和")
+
+	return c
+}
+
+func (c *commonFlags) classPaths() []string {
+	return strings.Split(c.classpath, ",")
+}
+
+// 解析classpath的选项: dex的转换工具和是否允许没有校验和的远程classpath
+func (c *commonFlags) classPathOptions() *vm.ClassPathOptions {
+	options := &vm.ClassPathOptions{AllowUnverified: c.allowUnverifiedClassPath}
+	if "" != c.dex2jar {
+		options.DexConverter = vm.Dex2jarConverter(c.dex2jar, options.CacheDir)
+	}
+	return options
+}
+
+// 输出错误并返回对应的退出码
+func (c *commonFlags) fail(err error) int {
+	report := vm.NewErrorReport(err)
+	if c.errorJson {
+		fmt.Fprintln(os.Stderr, string(report.JSON()))
+	} else {
 		utils.LogErrorPrintf("%+v", err)
-		os.Exit(1)
+		// 没有打开控制台日志时也要让用户看到错误
+		if !c.consoleLog {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
 	}
+
+	return report.ExitCode
 }
@@ -0,0 +1,30 @@
+package cn.minijvm.concurrency;
+
+/**
+ * 宿主程序通过MiniJvm.BindChannel()注册的go channel, 用于在宿主goroutine和guest线程之间传递数据;
+ * 元素在guest对象和go值之间自动转换(String, 包装类型, 数组, ArrayList, HashMap)
+ */
+public class HostChannel {
+    private String name;
+
+    private HostChannel(String name) {
+        this.name = name;
+    }
+
+    // 打开宿主注册的channel, 没有注册时抛出IllegalArgumentException
+    public static native HostChannel open(String name);
+
+    // 放入元素, channel满时等待; channel已被宿主关闭时抛出IllegalStateException
+    public native void put(Object item);
+    // 在timeoutMillis毫秒内放入元素, 超时返回false
+    public native boolean offer(Object item, long timeoutMillis);
+
+    // 取出元素, channel空时等待; channel已被宿主关闭并且没有剩余元素时返回null
+    public native Object take();
+    // 在timeoutMillis毫秒内取出元素, 超时或者channel已关闭时返回null
+    public native Object poll(long timeoutMillis);
+
+    public String getName() {
+        return name;
+    }
+}
@@ -2,5 +2,14 @@ package cn.minijvm.concurrency;
 
 public class MiniThread {
     public native void start(Runnable task);
+    /**
+     * 等待start()启动的线程结束, millis为0时一直等待, 超时后直接返回
+     */
+    public native void join(long millis);
     public static native void sleepCurrentThread(int second);
-}
\ No newline at end of file
+    public static native void yieldCurrentThread();
+    /**
+     * 设置当前线程的优先级(1~10), 只作为提示保存, 可以通过Thread.currentThread().getPriority()读回
+     */
+    public static native void setCurrentThreadPriority(int priority);
+}
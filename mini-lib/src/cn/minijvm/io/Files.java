@@ -0,0 +1,21 @@
+package cn.minijvm.io;
+
+// 文件读写, 需要file权限; 路径在所有系统中都可以用/分隔, 相对路径基于虚拟机的工作目录,
+// 读到的文本换行总是\n, 写入时转换成宿主系统的换行(windows为\r\n)
+public class Files {
+    public static native String readString(String path);
+    public static native void writeString(String path, String content);
+    public static native void appendString(String path, String content);
+
+    public static native boolean exists(String path);
+    // 删除文件或空目录, 文件不存在时返回false
+    public static native boolean delete(String path);
+    // 目录中的文件名, 按字典序排序
+    public static native String[] list(String dir);
+    // 宿主系统中文件名是否区分大小写, windows和macOS不区分
+    public static native boolean isCaseSensitive();
+
+    // 尝试锁住文件(不存在时创建), 已经被锁住时返回false, 不等待
+    public static native boolean tryLock(String path);
+    public static native void unlock(String path);
+}
@@ -0,0 +1,8 @@
+package cn.minijvm.io;
+
+public class ObjectSerializer {
+    // 序列化成与ObjectOutputStream兼容的字节流
+    public static native byte[] serialize(Object obj);
+    // 从ObjectOutputStream格式的字节流中读取对象, 受-serialAllowlist限制
+    public static native Object deserialize(byte[] data);
+}
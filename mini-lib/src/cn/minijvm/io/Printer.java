@@ -6,4 +6,6 @@ public class Printer {
     public static native void printChar(char ch);
     public static native void printString(String str);
     public static native void printBool(boolean b);
+    // 输出String.valueOf(obj), 调用对象的toString()
+    public static native void printObject(Object obj);
 }
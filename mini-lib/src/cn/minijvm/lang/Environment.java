@@ -0,0 +1,10 @@
+package cn.minijvm.lang;
+
+public class Environment {
+    // 虚拟机的默认Locale, 如en_US, 可以用-locale参数指定
+    public static native String getDefaultLocale();
+    // 虚拟机的默认时区ID, 如Asia/Shanghai, 可以用-timezone参数指定
+    public static native String getDefaultTimeZone();
+    // 系统属性, 用命令行参数-Dkey=value指定, 没有设置时返回null
+    public static native String getProperty(String key);
+}
@@ -0,0 +1,10 @@
+package cn.minijvm.lang;
+
+public class StackWalker {
+    // 调用者所在的栈深度, main方法为1
+    public static native int getStackDepth();
+    // 调用者的调用者的类名
+    public static native String getCallerClassName();
+    // 调用栈, 第一个元素为调用者
+    public static native String[] getStackTrace();
+}
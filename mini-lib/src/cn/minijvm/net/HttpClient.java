@@ -0,0 +1,21 @@
+package cn.minijvm.net;
+
+/**
+ * 由go的net/http实现的HTTP客户端, 需要network权限, 被安全策略拒绝(如-deny network)时终止执行
+ */
+public class HttpClient {
+    public static HttpResponse get(String url) {
+        return send("GET", url, null, null);
+    }
+
+    public static HttpResponse post(String url, String contentType, byte[] body) {
+        return send("POST", url, new String[] {"Content-Type", contentType}, body);
+    }
+
+    /**
+     * 发送请求并读取完整的响应
+     * @param headers 请求头, 按名称, 值交替排列, 可以为null
+     * @param body 请求体, 可以为null
+     */
+    public static native HttpResponse send(String method, String url, String[] headers, byte[] body);
+}
@@ -0,0 +1,39 @@
+package cn.minijvm.net;
+
+public class HttpResponse {
+    private int statusCode;
+    // 响应头, 按名称, 值交替排列, 同名的多个值分别出现
+    private String[] headers;
+    private byte[] body;
+    // 按UTF-8解码的响应体
+    private String bodyString;
+
+    private HttpResponse() {
+    }
+
+    public int statusCode() {
+        return statusCode;
+    }
+
+    public String[] headers() {
+        return headers;
+    }
+
+    // 名称不区分大小写, 没有时返回null
+    public String header(String name) {
+        for (int i = 0; i + 1 < headers.length; i += 2) {
+            if (headers[i].equalsIgnoreCase(name)) {
+                return headers[i + 1];
+            }
+        }
+        return null;
+    }
+
+    public byte[] bodyBytes() {
+        return body;
+    }
+
+    public String body() {
+        return bodyString;
+    }
+}
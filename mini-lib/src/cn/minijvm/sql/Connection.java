@@ -0,0 +1,22 @@
+package cn.minijvm.sql;
+
+/**
+ * 宿主程序通过MiniJvm.BindDatabase()注册的数据库连接, 由go的database/sql实现;
+ * 参数和结果在guest对象和go值之间自动转换, 数据库错误以SQLException抛出
+ */
+public class Connection {
+    private String name;
+
+    private Connection(String name) {
+        this.name = name;
+    }
+
+    // 打开宿主注册的数据库, 没有注册时抛出IllegalArgumentException
+    public static native Connection open(String name);
+
+    public native Statement createStatement();
+
+    public String getName() {
+        return name;
+    }
+}
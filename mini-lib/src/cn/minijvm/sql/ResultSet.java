@@ -0,0 +1,20 @@
+package cn.minijvm.sql;
+
+/**
+ * 查询结果, 所有行在查询时已经读入内存; 与JDBC一样先调用next()移动到第一行
+ */
+public class ResultSet {
+    private ResultSet() {
+    }
+
+    public native boolean next();
+
+    // 按列名取值, 列不存在时抛出SQLException, NULL返回null
+    public native Object getObject(String column);
+    public native String getString(String column);
+    // NULL返回0
+    public native int getInt(String column);
+    public native long getLong(String column);
+
+    public native void close();
+}
@@ -0,0 +1,21 @@
+package cn.minijvm.sql;
+
+/**
+ * 由Connection.createStatement()创建
+ */
+public class Statement {
+    private Connection connection;
+
+    private Statement() {
+    }
+
+    // 执行查询, 结果一次性读入内存;
+    // params按顺序绑定到sql中的占位符, 占位符的写法取决于宿主使用的驱动(如?或$1)
+    public native ResultSet executeQuery(String sql, Object... params);
+
+    // 执行更新, 返回影响的行数
+    public native int executeUpdate(String sql, Object... params);
+
+    public void close() {
+    }
+}
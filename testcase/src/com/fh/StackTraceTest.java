@@ -0,0 +1,20 @@
+package com.fh;
+
+import cn.minijvm.io.Printer;
+import cn.minijvm.lang.StackWalker;
+
+public class StackTraceTest {
+    public static void main(String[] args) {
+        Printer.print(StackWalker.getStackDepth());
+        foo();
+    }
+
+    public static void foo() {
+        Printer.print(StackWalker.getStackDepth());
+
+        String[] trace = StackWalker.getStackTrace();
+        Printer.print(trace.length);
+        Printer.printString(trace[0]);
+        Printer.printString(trace[1]);
+    }
+}
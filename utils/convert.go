@@ -3,7 +3,13 @@ package utils
 func InterfaceArrayToRuneArray(from []interface{}) []rune {
 	runeArr := make([]rune, len(from))
 	for ix, c := range from {
-		runeArr[ix] = c.(rune)
+		// castore写入的是int, 未初始化的元素为nil
+		switch v := c.(type) {
+		case rune:
+			runeArr[ix] = v
+		case int:
+			runeArr[ix] = rune(v)
+		}
 	}
 
 	return runeArr
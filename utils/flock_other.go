@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package utils
+
+import (
+	"os"
+)
+
+// 不支持flock的平台(如windows)不加系统锁, 只有同一个虚拟机内的锁生效
+func TryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func UnlockFile(f *os.File) error {
+	return nil
+}
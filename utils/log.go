@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 )
 
 var consoleLog *log.Logger
@@ -70,3 +74,65 @@ func createVmErrorLog() {
 
 	fileLog = log.New(logFile, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
 }
+
+// 日志级别
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+
+	return "UNKNOWN"
+}
+
+// 结构化日志接口, 嵌入方实现此接口把guest程序的日志接入自己的日志系统
+type Logger interface {
+	// fields为附加字段, 如日志记录器名称
+	Log(level LogLevel, msg string, fields map[string]interface{})
+}
+
+// 输出到io.Writer的Logger, 低于MinLevel的日志被丢弃
+type WriterLogger struct {
+	MinLevel LogLevel
+	logger *log.Logger
+}
+
+func NewWriterLogger(w io.Writer, minLevel LogLevel) *WriterLogger {
+	return &WriterLogger{
+		MinLevel: minLevel,
+		logger: log.New(w, "", log.Ldate|log.Ltime),
+	}
+}
+
+func (l *WriterLogger) Log(level LogLevel, msg string, fields map[string]interface{}) {
+	if level < l.MinLevel {
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&sb, " %s=%v", key, fields[key])
+	}
+	l.logger.Printf("%s %s%s", level, msg, sb.String())
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+)
+
+// 映射到内存的只读文件;
+// Data直接引用映射的内存, 调用Close之后不能再访问Data以及从Data切出的任何切片
+type MappedFile struct {
+	Data []byte
+
+	// 是否为真正的mmap, 不支持mmap的平台上退化为读取整个文件
+	mapped bool
+}
+
+// 把文件映射到内存, 不支持mmap时读取整个文件
+func MapFile(path string) (*MappedFile, error) {
+	data, mapped, err := mapFile(path)
+	if nil != err {
+		return nil, fmt.Errorf("failed to map file '%s': %w", path, err)
+	}
+
+	return &MappedFile{Data: data, mapped: mapped}, nil
+}
+
+func (f *MappedFile) Close() error {
+	data := f.Data
+	f.Data = nil
+	if !f.mapped || 0 == len(data) {
+		return nil
+	}
+
+	return unmapFile(data)
+}
+
+// 映射到内存的zip文件, 只解析一次中央目录并按文件名建立索引
+type MappedZip struct {
+	file    *MappedFile
+	Reader  *zip.Reader
+	entries map[string]*zip.File
+}
+
+func OpenMappedZip(path string) (*MappedZip, error) {
+	file, err := MapFile(path)
+	if nil != err {
+		return nil, err
+	}
+
+	z, err := newMappedZip(file)
+	if nil != err {
+		file.Close()
+		return nil, fmt.Errorf("failed to open zip '%s': %w", path, err)
+	}
+
+	return z, nil
+}
+
+// 从内存中的数据打开zip, 如浏览器中上传的jar; 不复制data, 调用方之后不能再修改
+func NewMemoryZip(data []byte) (*MappedZip, error) {
+	z, err := newMappedZip(&MappedFile{Data: data})
+	if nil != err {
+		return nil, fmt.Errorf("failed to open zip: %w", err)
+	}
+
+	return z, nil
+}
+
+func newMappedZip(file *MappedFile) (*MappedZip, error) {
+	reader, err := zip.NewReader(bytes.NewReader(file.Data), int64(len(file.Data)))
+	if nil != err {
+		return nil, err
+	}
+
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		// 同名文件以第一个为准
+		if _, ok := entries[f.Name]; !ok {
+			entries[f.Name] = f
+		}
+	}
+
+	return &MappedZip{file: file, Reader: reader, entries: entries}, nil
+}
+
+// 读取zip中的文件, 不存在时返回nil;
+// 没有压缩的文件直接返回映射内存的切片, 不复制
+func (z *MappedZip) ReadFile(name string) ([]byte, error) {
+	f, ok := z.entries[name]
+	if !ok {
+		return nil, nil
+	}
+
+	if zip.Store == f.Method {
+		offset, err := f.DataOffset()
+		if nil != err {
+			return nil, fmt.Errorf("failed to locate '%s': %w", name, err)
+		}
+		end := offset + int64(f.CompressedSize64)
+		if end > int64(len(z.file.Data)) {
+			return nil, fmt.Errorf("entry '%s' exceeds file size", name)
+		}
+
+		return z.file.Data[offset:end:end], nil
+	}
+
+	reader, err := f.Open()
+	if nil != err {
+		return nil, fmt.Errorf("failed to open inner file '%s': %w", name, err)
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func (z *MappedZip) Close() error {
+	return z.file.Close()
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package utils
+
+import (
+	"io/ioutil"
+)
+
+// 不支持mmap的平台读取整个文件
+func mapFile(path string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(path)
+	return data, false, err
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
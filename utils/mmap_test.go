@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappedZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapped-zip")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jarPath := filepath.Join(dir, "test.jar")
+	out, err := os.Create(jarPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for name, method := range map[string]uint16{"a/Stored.class": zip.Store, "a/Deflated.class": zip.Deflate} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if nil != err {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	zw.Close()
+	out.Close()
+
+	jar, err := OpenMappedZip(jarPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer jar.Close()
+
+	for _, name := range []string{"a/Stored.class", "a/Deflated.class"} {
+		data, err := jar.ReadFile(name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if name != string(data) {
+			t.Fatalf("unexpected content of %s: %q", name, data)
+		}
+	}
+
+	if data, err := jar.ReadFile("a/Missing.class"); nil != err || nil != data {
+		t.Fatalf("expected missing entry, got %q, %v", data, err)
+	}
+
+	// 内存中的zip
+	buf, err := ioutil.ReadFile(jarPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	memJar, err := NewMemoryZip(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if data, err := memJar.ReadFile("a/Deflated.class"); nil != err || "a/Deflated.class" != string(data) {
+		t.Fatalf("unexpected content %q, %v", data, err)
+	}
+	memJar.Close()
+	if _, err := NewMemoryZip([]byte("not a zip")); nil == err {
+		t.Fatal("expect error for invalid zip")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+func mapFile(path string) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if nil != err {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if nil != err {
+		return nil, false, err
+	}
+	// 长度为0的文件不能映射
+	if 0 == info.Size() {
+		return []byte{}, false, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if nil != err {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
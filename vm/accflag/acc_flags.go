@@ -14,6 +14,11 @@ const (
 	Abstarct = 0x0400
 	Strict = 0x0800
 	Synthetic = 0x1000
+	Enum = 0x4000
+
+	// 字段专用的标记, 与方法的Bridge, Varargs取值相同
+	Volatile = 0x0040
+	Transient = 0x0080
 )
 
 // 解析访问标记;
@@ -0,0 +1,470 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"math"
+	"strings"
+	"testing"
+)
+
+// 执行只有一个静态方法calc的类, args依次压栈作为参数, 返回calc的返回值
+func runCalc(t *testing.T, desc string, maxLocals uint16, code *codeAssembler, args ...interface{}) (interface{}, error) {
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(accflag.Static, "calc", desc, 4, maxLocals, code)
+
+	return runCalcClass(t, b, desc, args...)
+}
+
+// 执行b中已经定义好的calc方法, 字节码需要引用常量池时使用
+func runCalcClass(t *testing.T, b *classBuilder, desc string, args ...interface{}) (interface{}, error) {
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	frame := newMethodStackFrame(len(args) + 1, 0)
+	for _, arg := range args {
+		frame.opStack.Push(arg)
+	}
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", desc, frame, false); nil != err {
+		return nil, err
+	}
+
+	ret, _ := frame.opStack.Pop()
+	return ret, nil
+}
+
+func TestIntArithmetic(t *testing.T) {
+	binary := func(op byte, a int, b int) interface{} {
+		ret, err := runCalc(t, "(II)I", 2, newCodeAssembler().emit(bcode.Iload0, bcode.Iload1, op, bcode.Ireturn), a, b)
+		if nil != err {
+			t.Fatalf("%s: %v", bcode.ToName(op), err)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		op     byte
+		a, b   int
+		expect int
+	}{
+		{bcode.Imul, 6, -7, -42},
+		{bcode.Imul, 1 << 16, 1 << 16, 0},
+		{bcode.Imul, math.MaxInt32, 2, -2},
+		{bcode.Idiv, -7, 2, -3},
+		{bcode.Idiv, math.MinInt32, -1, math.MinInt32},
+		{bcode.Irem, -7, 2, -1},
+		{bcode.Irem, 7, -2, 1},
+		{bcode.Irem, math.MinInt32, -1, 0},
+	}
+	for _, c := range cases {
+		if ret := binary(c.op, c.a, c.b); c.expect != ret {
+			t.Errorf("%s %d %d: expect %d, got %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret)
+		}
+	}
+
+	for _, c := range [][2]int{{5, -5}, {math.MinInt32, math.MinInt32}} {
+		ret, err := runCalc(t, "(I)I", 1, newCodeAssembler().emit(bcode.Iload0, bcode.Ineg, bcode.Ireturn), c[0])
+		if nil != err || c[1] != ret {
+			t.Errorf("ineg %d: expect %d, got %v, %v", c[0], c[1], ret, err)
+		}
+	}
+}
+
+func TestIntBitwise(t *testing.T) {
+	binary := func(op byte, a int, b int) interface{} {
+		ret, err := runCalc(t, "(II)I", 2, newCodeAssembler().emit(bcode.Iload0, bcode.Iload1, op, bcode.Ireturn), a, b)
+		if nil != err {
+			t.Fatalf("%s: %v", bcode.ToName(op), err)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		op     byte
+		a, b   int
+		expect int
+	}{
+		{bcode.Iand, 0xff00ff, 0x0ff0f0, 0x0f00f0},
+		{bcode.Ior, 1 << 30, 1, 1 << 30 | 1},
+		{bcode.Ixor, -1, 0x0f, ^0x0f},
+		// 移位数只取低5位
+		{bcode.Ishl, 1, 33, 2},
+		{bcode.Ishl, 1, 31, math.MinInt32},
+		{bcode.Ishl, 3, -1, math.MinInt32},
+		{bcode.Ishr, -16, 2, -4},
+		{bcode.Ishr, math.MinInt32, 31, -1},
+		{bcode.Iushr, -16, 28, 0xf},
+		{bcode.Iushr, -1, 32, -1},
+		{bcode.Iushr, math.MinInt32, 31, 1},
+	}
+	for _, c := range cases {
+		if ret := binary(c.op, c.a, c.b); c.expect != ret {
+			t.Errorf("%s %d %d: expect %d, got %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	// ArithmeticException(String s) { detailMessage = s; }
+	exception := newClassBuilder("java/lang/ArithmeticException", "java/lang/Object")
+	exception.field("detailMessage", "Ljava/lang/String;")
+	exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef("java/lang/ArithmeticException", "detailMessage", "Ljava/lang/String;")).
+		emit(bcode.Return))
+	defs := []*class.DefFile{exception.def, newTestClass("java/lang/String", "java/lang/Object", nil)}
+
+	// static int calc(int a, int b) { try { return a <op> b; } catch (<catchType> e) { return -1; } }
+	// long版本: static long calc(long a, long b) { try { return a <op> b; } catch (<catchType> e) { return -1L; } }
+	calc := func(op byte, a int, b int, catchType string) (interface{}, error) {
+		desc := "(II)I"
+		var code *codeAssembler
+		var args []interface{}
+		var maxLocals uint16
+		if bcode.Ldiv == op || bcode.Lrem == op {
+			desc, maxLocals, args = "(JJ)J", 4, []interface{}{int64(a), int64(b)}
+			code = newCodeAssembler().
+				emit(bcode.Lload0, bcode.Lload2, op, bcode.Lreturn).
+				emit(bcode.Pop, bcode.Lconst1, bcode.Lneg, bcode.Lreturn)
+		} else {
+			maxLocals, args = 2, []interface{}{a, b}
+			code = newCodeAssembler().
+				emit(bcode.Iload0, bcode.Iload1, op, bcode.Ireturn).
+				emit(bcode.Pop, bcode.Iconst1, bcode.Ineg, bcode.Ireturn)
+		}
+
+		builder := newClassBuilder("com/fh/Calc", "java/lang/Object")
+		builder.method(accflag.Static, "calc", desc, 4, maxLocals, code)
+		builder.def.Methods[0].Attrs[0].(*class.CodeAttr).ExceptionTable = []*class.ExceptionTable{
+			{StartPc: 0, EndPc: 4, HandlerPc: 4, CatchType: builder.classRef(catchType)},
+		}
+		jvm, err := newClassInitTestJvm(append(defs, builder.def)...)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		frame := newMethodStackFrame(2, 0)
+		for _, arg := range args {
+			frame.opStack.Push(arg)
+		}
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(builder.def, "calc", desc, frame, false); nil != err {
+			return nil, err
+		}
+		ret, _ := frame.opStack.Pop()
+		return ret, nil
+	}
+
+	for _, op := range []byte{bcode.Idiv, bcode.Irem} {
+		if ret, err := calc(op, 7, 0, "java/lang/ArithmeticException"); nil != err || -1 != ret {
+			t.Fatalf("%s: expect caught exception, got %v, %v", bcode.ToName(op), ret, err)
+		}
+	}
+	for _, op := range []byte{bcode.Ldiv, bcode.Lrem} {
+		if ret, err := calc(op, 7, 0, "java/lang/ArithmeticException"); nil != err || int64(-1) != ret {
+			t.Fatalf("%s: expect caught exception, got %v, %v", bcode.ToName(op), ret, err)
+		}
+	}
+
+	// 没有被捕获时作为java异常向上抛出, 带有消息
+	_, err := calc(bcode.Idiv, 7, 0, "java/lang/IllegalStateException")
+	var thrown *ExceptionThrownError
+	if !errors.As(err, &thrown) || "java/lang/ArithmeticException" != thrown.ExceptionRef.Object.DefFile.FullClassName {
+		t.Fatalf("expect ArithmeticException, got %v", err)
+	}
+	message, _ := thrown.ExceptionRef.Object.GetFieldValue("detailMessage")
+	if runes, err := class.StringRunes(message.(*class.Reference)); nil != err || "/ by zero" != string(runes) {
+		t.Fatalf("unexpected message %v, %v", message, err)
+	}
+}
+
+func TestLongArithmetic(t *testing.T) {
+	binary := func(op byte, a int64, b int64) interface{} {
+		code := newCodeAssembler().emit(bcode.Lload0, bcode.Lload2, op, bcode.Lreturn)
+		ret, err := runCalc(t, "(JJ)J", 4, code, a, b)
+		if nil != err {
+			t.Fatalf("%s: %v", bcode.ToName(op), err)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		op     byte
+		a, b   int64
+		expect int64
+	}{
+		{bcode.Ladd, math.MaxInt64, 1, math.MinInt64},
+		{bcode.Lsub, 3, 1 << 40, 3 - 1 << 40},
+		{bcode.Lmul, 1 << 31, 1 << 31, 1 << 62},
+		{bcode.Ldiv, -7, 2, -3},
+		{bcode.Ldiv, math.MinInt64, -1, math.MinInt64},
+		{bcode.Lrem, -7, 2, -1},
+		{bcode.Land, 0xff00ff00ff, 0x0ffff0000f, 0x0f00f0000f},
+		{bcode.Lor, 1 << 40, 1, 1 << 40 | 1},
+		{bcode.Lxor, -1, 1 << 33, ^(1 << 33)},
+	}
+	for _, c := range cases {
+		if ret := binary(c.op, c.a, c.b); c.expect != ret {
+			t.Errorf("%s %d %d: expect %d, got %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret)
+		}
+	}
+
+	// 移位数只取低6位
+	shift := func(op byte, a int64, s int) interface{} {
+		ret, err := runCalc(t, "(JI)J", 3, newCodeAssembler().emit(bcode.Lload0, bcode.Iload2, op, bcode.Lreturn), a, s)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	if ret := shift(bcode.Lshl, 1, 65); int64(2) != ret {
+		t.Errorf("lshl: got %v", ret)
+	}
+	if ret := shift(bcode.Lshr, -16, 2); int64(-4) != ret {
+		t.Errorf("lshr: got %v", ret)
+	}
+	if ret := shift(bcode.Lushr, -1, 60); int64(15) != ret {
+		t.Errorf("lushr: got %v", ret)
+	}
+
+	for _, c := range []struct {
+		a, b   int64
+		expect int
+	}{{1, 2, -1}, {2, 2, 0}, {math.MaxInt64, math.MinInt64, 1}} {
+		ret, err := runCalc(t, "(JJ)I", 4, newCodeAssembler().emit(bcode.Lload0, bcode.Lload2, bcode.Lcmp, bcode.Ireturn), c.a, c.b)
+		if nil != err || c.expect != ret {
+			t.Errorf("lcmp %d %d: expect %d, got %v, %v", c.a, c.b, c.expect, ret, err)
+		}
+	}
+}
+
+// long在本地变量表中占两个槽
+func TestLongLocals(t *testing.T) {
+	// static long calc(long a, int b) { long c = -(a + 1); long d = c; return d; }
+	code := newCodeAssembler().
+		emit(bcode.Lload0, bcode.Lconst1, bcode.Ladd, bcode.Lneg).
+		emit(bcode.Lstore, 3).
+		emit(bcode.Lload, 3, bcode.Lstore, 5).
+		emit(bcode.Wide, bcode.Lload, 0, 5, bcode.Lreturn)
+	ret, err := runCalc(t, "(JI)J", 7, code, int64(41), 7)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if int64(-42) != ret {
+		t.Fatalf("expect -42, got %v", ret)
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	binary := func(op byte, a float32, b float32) float32 {
+		code := newCodeAssembler().emit(bcode.Fload0, bcode.Fload1, op, bcode.Freturn)
+		ret, err := runCalc(t, "(FF)F", 2, code, a, b)
+		if nil != err {
+			t.Fatalf("%s: %v", bcode.ToName(op), err)
+		}
+		return ret.(float32)
+	}
+
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+	cases := []struct {
+		op     byte
+		a, b   float32
+		expect float32
+	}{
+		{bcode.Fadd, 0.1, 0.2, 0.1 + float32(0.2)},
+		{bcode.Fsub, 1, 2.5, -1.5},
+		{bcode.Fmul, 1.5, -4, -6},
+		{bcode.Fdiv, 1, 0, inf},
+		{bcode.Frem, -7.5, 2, -1.5},
+		{bcode.Frem, 7.5, -2, 1.5},
+	}
+	for _, c := range cases {
+		if ret := binary(c.op, c.a, c.b); c.expect != ret {
+			t.Errorf("%s %v %v: expect %v, got %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret)
+		}
+	}
+	if ret := binary(bcode.Fdiv, 0, 0); ret == ret {
+		t.Errorf("0/0 should be NaN, got %v", ret)
+	}
+
+	// 有NaN时fcmpl为-1, fcmpg为1
+	for _, c := range []struct {
+		op     byte
+		a, b   float32
+		expect int
+	}{
+		{bcode.Fcmpl, 1, 2, -1}, {bcode.Fcmpg, 2, 2, 0}, {bcode.Fcmpl, 3, 2, 1},
+		{bcode.Fcmpl, nan, 1, -1}, {bcode.Fcmpg, 1, nan, 1},
+	} {
+		ret, err := runCalc(t, "(FF)I", 2, newCodeAssembler().emit(bcode.Fload0, bcode.Fload1, c.op, bcode.Ireturn), c.a, c.b)
+		if nil != err || c.expect != ret {
+			t.Errorf("%s %v %v: expect %d, got %v, %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret, err)
+		}
+	}
+
+	// static float calc(float a) { float b = -(a * 2.0f) + 1.25f; return b; }
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	floatIndex := b.constant(&class.FloatConst{Bytes: math.Float32bits(1.25)})
+	b.method(accflag.Static, "calc", "(F)F", 2, 2, newCodeAssembler().
+		emit(bcode.Fload0, bcode.Fconst2, bcode.Fmul, bcode.Fneg).
+		emit(bcode.Ldc, byte(floatIndex), bcode.Fadd).
+		emit(bcode.Fstore, 1, bcode.Fload, 1, bcode.Freturn))
+	ret, err := runCalcClass(t, b, "(F)F", float32(3))
+	if nil != err || float32(-4.75) != ret {
+		t.Fatalf("expect -4.75, got %v, %v", ret, err)
+	}
+}
+
+func TestDoubleArithmetic(t *testing.T) {
+	binary := func(op byte, a float64, b float64) float64 {
+		code := newCodeAssembler().emit(bcode.Dload0, bcode.Dload2, op, bcode.Dreturn)
+		ret, err := runCalc(t, "(DD)D", 4, code, a, b)
+		if nil != err {
+			t.Fatalf("%s: %v", bcode.ToName(op), err)
+		}
+		return ret.(float64)
+	}
+
+	cases := []struct {
+		op     byte
+		a, b   float64
+		expect float64
+	}{
+		{bcode.Dadd, 0.1, 0.2, 0.30000000000000004},
+		{bcode.Dsub, 1, 2.5, -1.5},
+		{bcode.Dmul, 1e200, 1e200, math.Inf(1)},
+		{bcode.Ddiv, -1, 0, math.Inf(-1)},
+		{bcode.Drem, -7.5, 2, -1.5},
+	}
+	for _, c := range cases {
+		if ret := binary(c.op, c.a, c.b); c.expect != ret {
+			t.Errorf("%s %v %v: expect %v, got %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret)
+		}
+	}
+
+	nan := math.NaN()
+	for _, c := range []struct {
+		op     byte
+		a, b   float64
+		expect int
+	}{
+		{bcode.Dcmpl, 1, 2, -1}, {bcode.Dcmpg, 2, 2, 0}, {bcode.Dcmpg, 3, 2, 1},
+		{bcode.Dcmpl, nan, 1, -1}, {bcode.Dcmpg, 1, nan, 1},
+	} {
+		ret, err := runCalc(t, "(DD)I", 4, newCodeAssembler().emit(bcode.Dload0, bcode.Dload2, c.op, bcode.Ireturn), c.a, c.b)
+		if nil != err || c.expect != ret {
+			t.Errorf("%s %v %v: expect %d, got %v, %v", bcode.ToName(c.op), c.a, c.b, c.expect, ret, err)
+		}
+	}
+
+	// static double calc(double a, int b) { double c = -(a * 1.0) + 2.5; double d = c; return d; }
+	// double在本地变量表中占两个槽, 常量池中也占两个位置
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	bits := math.Float64bits(2.5)
+	doubleIndex := b.constant(&class.DoubleConst{HighByte: uint32(bits >> 32), LowByte: uint32(bits)})
+	b.constant(nil)
+	b.method(accflag.Static, "calc", "(DI)D", 4, 7, newCodeAssembler().
+		emit(bcode.Dload0, bcode.Dconst1, bcode.Dmul, bcode.Dneg).
+		emitIndex(bcode.Ldc2W, doubleIndex).
+		emit(bcode.Dadd, bcode.Dstore, 3).
+		emit(bcode.Dload, 3, bcode.Dstore, 5).
+		emit(bcode.Wide, bcode.Dload, 0, 5, bcode.Dreturn))
+	ret, err := runCalcClass(t, b, "(DI)D", 0.25, 7)
+	if nil != err || 2.25 != ret {
+		t.Fatalf("expect 2.25, got %v, %v", ret, err)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	loads := map[byte]byte{'I': bcode.Iload0, 'J': bcode.Lload0, 'F': bcode.Fload0, 'D': bcode.Dload0}
+	returns := map[byte]byte{'I': bcode.Ireturn, 'J': bcode.Lreturn, 'F': bcode.Freturn, 'D': bcode.Dreturn}
+
+	nan := math.NaN()
+	cases := []struct {
+		op     byte
+		desc   string
+		arg    interface{}
+		expect interface{}
+	}{
+		{bcode.I2l, "(I)J", -1, int64(-1)},
+		{bcode.I2f, "(I)F", math.MaxInt32, float32(math.MaxInt32)},
+		{bcode.I2d, "(I)D", math.MinInt32, float64(math.MinInt32)},
+		{bcode.L2i, "(J)I", int64(1 << 32 | 5), 5},
+		{bcode.L2i, "(J)I", int64(math.MaxUint32), -1},
+		{bcode.L2f, "(J)F", int64(1 << 40), float32(1 << 40)},
+		{bcode.L2d, "(J)D", int64(-3), float64(-3)},
+		{bcode.F2i, "(F)I", float32(-2.9), -2},
+		{bcode.F2i, "(F)I", float32(nan), 0},
+		{bcode.F2i, "(F)I", float32(1e20), math.MaxInt32},
+		{bcode.F2i, "(F)I", float32(math.Inf(-1)), math.MinInt32},
+		{bcode.F2l, "(F)J", float32(1e30), int64(math.MaxInt64)},
+		{bcode.F2l, "(F)J", float32(nan), int64(0)},
+		{bcode.F2d, "(F)D", float32(0.5), 0.5},
+		{bcode.D2i, "(D)I", 2.9, 2},
+		{bcode.D2i, "(D)I", -1e10, math.MinInt32},
+		{bcode.D2i, "(D)I", nan, 0},
+		{bcode.D2l, "(D)J", 9.3e18, int64(math.MaxInt64)},
+		{bcode.D2l, "(D)J", -1e300, int64(math.MinInt64)},
+		{bcode.D2l, "(D)J", -123.75, int64(-123)},
+		{bcode.D2f, "(D)F", 0.1, float32(0.1)},
+		{bcode.D2f, "(D)F", 1e300, float32(math.Inf(1))},
+		{bcode.I2b, "(I)I", 0xff, -1},
+		{bcode.I2b, "(I)I", 0x17f, 127},
+		{bcode.I2c, "(I)I", -1, 0xffff},
+		{bcode.I2s, "(I)I", 0x18000, -32768},
+	}
+	for _, c := range cases {
+		code := newCodeAssembler().emit(loads[c.desc[1]], c.op, returns[c.desc[len(c.desc) - 1]])
+		ret, err := runCalc(t, c.desc, 2, code, c.arg)
+		if nil != err || c.expect != ret {
+			t.Errorf("%s %v: expect %v, got %v, %v", bcode.ToName(c.op), c.arg, c.expect, ret, err)
+		}
+	}
+}
+
+func TestWideConstantIndex(t *testing.T) {
+	// 常量池超过255项时, 后面的常量只能用ldc_w和ldc2_w加载
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	for ix := 0; ix < 300; ix++ {
+		b.utf8(fmt.Sprintf("pad%d", ix))
+	}
+	intIndex := b.constant(&class.IntegerInfoConst{Bytes: uint32(100000)})
+	floatIndex := b.constant(&class.FloatConst{Bytes: math.Float32bits(0.5)})
+	longIndex := b.constant(&class.LongConst{HighByte: 1, LowByte: 2})
+	b.constant(nil)
+	if intIndex <= math.MaxUint8 {
+		t.Fatalf("expect wide index, got %d", intIndex)
+	}
+
+	// static int calc() { return 100000 + 100000; }, float和long的calc类似
+	b.method(accflag.Static, "calc", "()I", 2, 0, newCodeAssembler().
+		emitIndex(bcode.LdcW, intIndex).emitIndex(bcode.LdcW, intIndex).emit(bcode.Iadd, bcode.Ireturn))
+	b.method(accflag.Static, "calc", "()F", 2, 0, newCodeAssembler().
+		emitIndex(bcode.LdcW, floatIndex).emit(bcode.Fconst1, bcode.Fadd, bcode.Freturn))
+	b.method(accflag.Static, "calc", "()J", 2, 0, newCodeAssembler().
+		emitIndex(bcode.Ldc2W, longIndex).emit(bcode.Lconst1, bcode.Ladd, bcode.Lreturn))
+	for _, c := range []struct {
+		desc   string
+		expect interface{}
+	}{
+		{"()I", 200000}, {"()F", float32(1.5)}, {"()J", int64(0x100000003)},
+	} {
+		ret, err := runCalcClass(t, b, c.desc)
+		if nil != err || c.expect != ret {
+			t.Errorf("%s: expect %v, got %v, %v", c.desc, c.expect, ret, err)
+		}
+	}
+
+	// long常量不能用ldc_w加载
+	b = newClassBuilder("com/fh/Calc", "java/lang/Object")
+	longIndex = b.constant(&class.LongConst{LowByte: 1})
+	b.constant(nil)
+	b.method(accflag.Static, "calc", "()J", 2, 0, newCodeAssembler().emitIndex(bcode.LdcW, longIndex).emit(bcode.Lreturn))
+	if _, err := runCalcClass(t, b, "()J"); nil == err || !strings.Contains(err.Error(), "ldc2_w") {
+		t.Fatalf("expect ldc2_w error, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestByteBooleanShortArrays(t *testing.T) {
+	// static int calc(int v) { T[] a = new T[2]; a[1] = v; return a[1]; }
+	roundTrip := func(arrayType byte, store byte, load byte, v int) interface{} {
+		ret, err := runCalc(t, "(I)I", 2, newCodeAssembler().
+			emit(bcode.Iconst2, bcode.Newarray, arrayType, bcode.Astore1).
+			emit(bcode.Aload1, bcode.Iconst1, bcode.Iload0, store).
+			emit(bcode.Aload1, bcode.Iconst1, load, bcode.Ireturn), v)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		arrayType byte
+		store     byte
+		load      byte
+		v         int
+		expect    int
+	}{
+		// 写入时截断, 读取时符号扩展
+		{atype.Byte, bcode.Bastore, bcode.Baload, 127, 127},
+		{atype.Byte, bcode.Bastore, bcode.Baload, 200, -56},
+		{atype.Byte, bcode.Bastore, bcode.Baload, -1, -1},
+		{atype.Byte, bcode.Bastore, bcode.Baload, 0x1234, 0x34},
+		{atype.Boolean, bcode.Bastore, bcode.Baload, 1, 1},
+		{atype.Boolean, bcode.Bastore, bcode.Baload, 2, 0},
+		{atype.Boolean, bcode.Bastore, bcode.Baload, 3, 1},
+		{atype.Short, bcode.Sastore, bcode.Saload, -32768, -32768},
+		{atype.Short, bcode.Sastore, bcode.Saload, 40000, -25536},
+		{atype.Short, bcode.Sastore, bcode.Saload, 0x12345, 0x2345},
+	}
+	for _, c := range cases {
+		if ret := roundTrip(c.arrayType, c.store, c.load, c.v); c.expect != ret {
+			t.Errorf("%s %d: expect %d, got %v", bcode.ToName(c.store), c.v, c.expect, ret)
+		}
+	}
+
+	// byte[]的数据可以直接作为go的[]byte读取
+	ret, err := runCalc(t, "(I)[B", 1, newCodeAssembler().
+		emit(bcode.Iconst2, bcode.Newarray, atype.Byte).
+		emit(bcode.Dup, bcode.Iconst0, bcode.Iload0, bcode.Bastore, bcode.Areturn), -2)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if data := ret.(*class.Reference).Array.Bytes; 0xfe != data[0] || 0 != data[1] {
+		t.Fatalf("unexpected bytes %v", data)
+	}
+}
+
+func TestLongFloatDoubleArrays(t *testing.T) {
+	// static T calc(T v) { T[] a = new T[2]; a[1] = v; return a[0] + a[1]; }
+	cases := []struct {
+		desc      string
+		arrayType byte
+		// 参数占用的本地变量槽数, 数组保存在参数之后
+		slots     byte
+		load      byte
+		store     byte
+		add       byte
+		ret       byte
+		loadArg   byte
+		v         interface{}
+	}{
+		{"(J)J", atype.Long, 2, bcode.Laload, bcode.Lastore, bcode.Ladd, bcode.Lreturn, bcode.Lload0, int64(1) << 40},
+		{"(F)F", atype.Float, 1, bcode.Faload, bcode.Fastore, bcode.Fadd, bcode.Freturn, bcode.Fload0, float32(1.5)},
+		{"(D)D", atype.Double, 2, bcode.Daload, bcode.Dastore, bcode.Dadd, bcode.Dreturn, bcode.Dload0, -2.25},
+	}
+
+	for _, c := range cases {
+		code := newCodeAssembler().
+			emit(bcode.Iconst2, bcode.Newarray, c.arrayType, bcode.Astore, c.slots).
+			emit(bcode.Aload, c.slots, bcode.Iconst1, c.loadArg, c.store).
+			emit(bcode.Aload, c.slots, bcode.Iconst0, c.load).
+			emit(bcode.Aload, c.slots, bcode.Iconst1, c.load, c.add, c.ret)
+		ret, err := runCalc(t, c.desc, uint16(c.slots) + 1, code, c.v)
+		if nil != err {
+			t.Fatalf("%s: %v", c.desc, err)
+		}
+		// 元素初始值为对应类型的0
+		if c.v != ret {
+			t.Errorf("%s: expect %v, got %v(%T)", c.desc, c.v, ret, ret)
+		}
+	}
+
+	doubles, _ := class.NewArray(1, atype.Double)
+	if 0.0 != doubles.Array.Load(0) {
+		t.Fatalf("unexpected default %v", doubles.Array.Load(0))
+	}
+}
+
+// static int calc() { try { body } catch (ArrayIndexOutOfBoundsException e) { return -1; } catch (NullPointerException e) { return -2; } }
+func runArrayCheck(t *testing.T, body *codeAssembler) interface{} {
+	const outOfBounds, npe = "java/lang/ArrayIndexOutOfBoundsException", "java/lang/NullPointerException"
+	defs := []*class.DefFile{newTestClass("java/lang/String", "java/lang/Object", nil)}
+	for _, name := range []string{outOfBounds, npe} {
+		exception := newClassBuilder(name, "java/lang/Object")
+		exception.field("detailMessage", "Ljava/lang/String;")
+		exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+			emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef(name, "detailMessage", "Ljava/lang/String;")).
+			emit(bcode.Return))
+		defs = append(defs, exception.def)
+	}
+
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	code := body.label("outOfBounds").emit(bcode.Pop, bcode.Bipush, 0xff, bcode.Ireturn).
+		label("npe").emit(bcode.Pop, bcode.Bipush, 0xfe, bcode.Ireturn)
+	b.method(accflag.Static, "calc", "()I", 6, 1, code)
+	end := uint16(code.labels["outOfBounds"])
+	codeAttr := b.def.Methods[0].Attrs[0].(*class.CodeAttr)
+	codeAttr.ExceptionTable = []*class.ExceptionTable{
+		{StartPc: 0, EndPc: end, HandlerPc: end, CatchType: b.classRef(outOfBounds)},
+		{StartPc: 0, EndPc: end, HandlerPc: uint16(code.labels["npe"]), CatchType: b.classRef(npe)},
+	}
+	codeAttr.ExceptionTableLength = uint16(len(codeAttr.ExceptionTable))
+
+	jvm, err := newClassInitTestJvm(append(defs, b.def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	frame := newMethodStackFrame(1, 0)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", "()I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+
+	ret, _ := frame.opStack.Pop()
+	return ret
+}
+
+// 下标越界和null数组抛出可以捕获的异常
+func TestArrayAccessChecks(t *testing.T) {
+	cases := []struct {
+		name   string
+		code   *codeAssembler
+		expect int
+	}{
+		{"baload out of bounds", newCodeAssembler().emit(bcode.Iconst2, bcode.Newarray, atype.Byte, bcode.Iconst2, bcode.Baload, bcode.Ireturn), -1},
+		{"saload negative index", newCodeAssembler().emit(bcode.Iconst2, bcode.Newarray, atype.Short, bcode.Bipush, 0xff, bcode.Saload, bcode.Ireturn), -1},
+		{"bastore null", newCodeAssembler().emit(bcode.Aconstnull, bcode.Iconst0, bcode.Iconst1, bcode.Bastore, bcode.Iconst0, bcode.Ireturn), -2},
+		{"sastore out of bounds", newCodeAssembler().emit(bcode.Iconst1, bcode.Newarray, atype.Short, bcode.Iconst1, bcode.Iconst1, bcode.Sastore, bcode.Iconst0, bcode.Ireturn), -1},
+		{"laload out of bounds", newCodeAssembler().emit(bcode.Iconst1, bcode.Newarray, atype.Long, bcode.Iconst1, bcode.Laload, bcode.L2i, bcode.Ireturn), -1},
+		{"faload null", newCodeAssembler().emit(bcode.Aconstnull, bcode.Iconst0, bcode.Faload, bcode.F2i, bcode.Ireturn), -2},
+		{"dastore out of bounds", newCodeAssembler().emit(bcode.Iconst0, bcode.Newarray, atype.Double, bcode.Iconst0, bcode.Dconst1, bcode.Dastore, bcode.Iconst0, bcode.Ireturn), -1},
+		{"lastore null", newCodeAssembler().emit(bcode.Aconstnull, bcode.Iconst0, bcode.Lconst1, bcode.Lastore, bcode.Iconst0, bcode.Ireturn), -2},
+		{"iaload out of bounds", newCodeAssembler().emit(bcode.Iconst2, bcode.Newarray, atype.Int, bcode.Iconst3, bcode.Iaload, bcode.Ireturn), -1},
+		{"castore null", newCodeAssembler().emit(bcode.Aconstnull, bcode.Iconst0, bcode.Iconst1, bcode.Castore, bcode.Iconst0, bcode.Ireturn), -2},
+		{"laload in bounds", newCodeAssembler().emit(bcode.Iconst1, bcode.Newarray, atype.Long, bcode.Iconst0, bcode.Laload, bcode.L2i, bcode.Ireturn), 0},
+		{"baload in bounds", newCodeAssembler().emit(bcode.Iconst2, bcode.Newarray, atype.Boolean, bcode.Iconst1, bcode.Baload, bcode.Ireturn), 0},
+	}
+	for _, c := range cases {
+		if ret := runArrayCheck(t, c.code); c.expect != ret {
+			t.Errorf("%s: expect %d, got %v", c.name, c.expect, ret)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+// 构造嵌套try块:
+// try {            // [0, 8)  catch-all -> 12
+//     try {        // [2, 5)  catch com/fh/InnerException -> 10
+//         throw
+//     }
+// }
+func newNestedTryFixture() (*InterpretedExecutionEngine, *class.DefFile, *class.CodeAttr) {
+	def := &class.DefFile{
+		FullClassName: "com/fh/Foo",
+		ConstPool: class.NewConstPool(
+			&class.ClassInfoConstInfo{FullClassNameIndex: 2},
+			&class.Utf8InfoConst{Bytes: []byte("com/fh/InnerException")},
+		),
+	}
+	codeAttr := &class.CodeAttr{
+		Code: make([]byte, 16),
+		ExceptionTable: []*class.ExceptionTable{
+			{StartPc: 2, EndPc: 5, HandlerPc: 10, CatchType: 1},
+			{StartPc: 0, EndPc: 8, HandlerPc: 12, CatchType: 0},
+		},
+	}
+	codeAttr.ExceptionTableLength = uint16(len(codeAttr.ExceptionTable))
+
+	engine := NewInterpretedExecutionEngine(&MiniJvm{stats: new(vmStats)})
+	return engine, def, codeAttr
+}
+
+func newTestException(className string) *class.Reference {
+	return &class.Reference{Object: &class.Object{DefFile: &class.DefFile{FullClassName: className}}}
+}
+
+func TestAthrowNestedTry(t *testing.T) {
+	cases := []struct {
+		pc        int
+		exception string
+		handlerPc int
+	}{
+		// 内层try块匹配
+		{3, "com/fh/InnerException", 10},
+		// 内层不匹配, 交给外层catch-all
+		{3, "com/fh/OtherException", 12},
+		// EndPc不在范围内, 由外层处理
+		{5, "com/fh/InnerException", 12},
+	}
+
+	for _, c := range cases {
+		engine, def, codeAttr := newNestedTryFixture()
+		frame := newMethodStackFrame(4, 0)
+		frame.pc = c.pc
+
+		// athrow前栈中还有其他值
+		expRef := newTestException(c.exception)
+		frame.opStack.Push(1)
+		frame.opStack.Push(expRef)
+
+		err := engine.bcodeAthrow(def, frame, codeAttr)
+		if nil != err {
+			t.Fatalf("%s at %d: %v", c.exception, c.pc, err)
+		}
+		// 执行循环中pc会再加1
+		if c.handlerPc - 1 != frame.pc {
+			t.Fatalf("%s at %d: unexpected handler pc %d", c.exception, c.pc, frame.pc + 1)
+		}
+
+		// 栈中只剩异常引用
+		top, _ := frame.opStack.PopReference()
+		if expRef != top {
+			t.Fatalf("%s at %d: exception ref not on stack top", c.exception, c.pc)
+		}
+		if _, ok := frame.opStack.Pop(); ok {
+			t.Fatalf("%s at %d: stack not cleared", c.exception, c.pc)
+		}
+	}
+}
+
+func TestAthrowNotCaught(t *testing.T) {
+	engine, def, codeAttr := newNestedTryFixture()
+	frame := newMethodStackFrame(4, 0)
+	frame.pc = 9
+
+	expRef := newTestException("com/fh/InnerException")
+	frame.opStack.Push(1)
+	frame.opStack.Push(expRef)
+
+	err := engine.bcodeAthrow(def, frame, codeAttr)
+	expErr, ok := err.(*ExceptionThrownError)
+	if !ok || expRef != expErr.ExceptionRef {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, ok := frame.opStack.Pop(); ok {
+		t.Fatal("stack not cleared")
+	}
+
+	// 调用的方法抛出异常, 在调用者栈帧中查找handler
+	frame.pc = 3
+	frame.opStack.Push(2)
+	err = engine.athrowJumpToTargetPc(def, frame, codeAttr, "com/fh/InnerException", expRef)
+	if nil != err || 9 != frame.pc {
+		t.Fatalf("unexpected result pc %d, err %v", frame.pc, err)
+	}
+	if top, _ := frame.opStack.PopReference(); expRef != top {
+		t.Fatal("exception ref not on stack top")
+	}
+}
+
+// static int dive(int d, int t) { if (d == 0) { if (t != 0) throw new Oops(); return 0; } return dive(d - 1, t); }
+// static int run(int d, int t) { try { return dive(d, t); } catch (Oops e) { return 7; } }
+func newUnwindJvm(t *testing.T) (*MiniJvm, *class.DefFile) {
+	const oopsClass = "cn/minijvm/bench/Oops"
+
+	bench := &Benchmark{
+		Name: "unwind",
+		classes: func() []*class.DefFile {
+			oops := newClassBuilder(oopsClass, "java/lang/Object")
+
+			main := newClassBuilder(benchMainClass, "java/lang/Object")
+			diveRef := main.methodRef(benchMainClass, "dive", "(II)I")
+			main.method(accflag.Public | accflag.Static, "dive", "(II)I", 2, 2, newCodeAssembler().
+				emit(bcode.Iload0).jump(bcode.Ifne, "recurse").
+				emit(bcode.Iload1).jump(bcode.Ifeq, "return").
+				emitIndex(bcode.New, main.classRef(oopsClass)).emit(bcode.Athrow).
+				label("return").emit(bcode.Iconst0, bcode.Ireturn).
+				label("recurse").emit(bcode.Iload0, bcode.Iconst1, bcode.Isub, bcode.Iload1).
+				emitIndex(bcode.Invokestatic, diveRef).emit(bcode.Ireturn))
+
+			main.method(accflag.Public | accflag.Static, "run", "(II)I", 2, 2, newCodeAssembler().
+				emit(bcode.Iload0, bcode.Iload1).emitIndex(bcode.Invokestatic, diveRef).emit(bcode.Ireturn).
+				emit(bcode.Pop, bcode.Bipush, 7, bcode.Ireturn))
+			codeAttr := main.def.Methods[1].Attrs[0].(*class.CodeAttr)
+			codeAttr.ExceptionTable = []*class.ExceptionTable{{StartPc: 0, EndPc: 5, HandlerPc: 6, CatchType: main.classRef(oopsClass)}}
+			codeAttr.ExceptionTableLength = 1
+
+			return []*class.DefFile{oops.def, main.def}
+		},
+	}
+
+	jvm, err := bench.newJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+	def, err := jvm.MethodArea.LoadClass(benchMainClass)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return jvm, def
+}
+
+func runUnwind(t *testing.T, jvm *MiniJvm, def *class.DefFile, depth int, throw int) interface{} {
+	frame := newMethodStackFrame(3, 0)
+	frame.opStack.PushInt(depth)
+	frame.opStack.PushInt(throw)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "run", "(II)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+
+	ret, _ := frame.opStack.Pop()
+	return ret
+}
+
+// 异常穿过多层栈帧后被捕获, 传递过程不随栈帧层数增加内存分配
+func TestUnwindThroughFrames(t *testing.T) {
+	jvm, def := newUnwindJvm(t)
+
+	if 0 != runUnwind(t, jvm, def, 5, 0) || 7 != runUnwind(t, jvm, def, 5, 1) {
+		t.Fatal("exception not caught by caller several frames up")
+	}
+
+	// 每多一层栈帧, 异常退出增加的分配次数不超过正常返回
+	perFrame := func(throw int) float64 {
+		shallow := testing.AllocsPerRun(50, func() { runUnwind(t, jvm, def, 1, throw) })
+		deep := testing.AllocsPerRun(50, func() { runUnwind(t, jvm, def, 17, throw) })
+		return (deep - shallow) / 16
+	}
+	if normal, thrown := perFrame(0), perFrame(1); thrown > normal {
+		t.Fatalf("unwinding allocates per frame: %v allocs per frame, normal return %v", thrown, normal)
+	}
+}
+
+// static int calc(int t) { try { throw t == 0 ? new SubException() : new OtherException(); } catch (BaseException e) { return 7; } }
+func TestCatchSuperClass(t *testing.T) {
+	base := newClassBuilder("com/fh/BaseException", "java/lang/Object")
+	sub := newClassBuilder("com/fh/SubException", "com/fh/BaseException")
+	other := newClassBuilder("com/fh/OtherException", "java/lang/Object")
+
+	main := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	main.method(accflag.Static, "calc", "(I)I", 2, 1, newCodeAssembler().
+		emit(bcode.Iload0).jump(bcode.Ifne, "other").
+		emitIndex(bcode.New, main.classRef("com/fh/SubException")).emit(bcode.Athrow).
+		label("other").emitIndex(bcode.New, main.classRef("com/fh/OtherException")).emit(bcode.Athrow).
+		label("handler").emit(bcode.Pop, bcode.Bipush, 7, bcode.Ireturn))
+	codeAttr := main.def.Methods[0].Attrs[0].(*class.CodeAttr)
+	codeAttr.ExceptionTable = []*class.ExceptionTable{{StartPc: 0, EndPc: 12, HandlerPc: 12, CatchType: main.classRef("com/fh/BaseException")}}
+	codeAttr.ExceptionTableLength = 1
+
+	jvm, err := newClassInitTestJvm(base.def, sub.def, other.def, main.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// catch父类捕获子类异常
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.PushInt(0)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(main.def, "calc", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if ret, _ := frame.opStack.Pop(); 7 != ret {
+		t.Fatalf("expect 7, got %v", ret)
+	}
+
+	// 无关的异常不被捕获
+	frame = newMethodStackFrame(2, 0)
+	frame.opStack.PushInt(1)
+	err = jvm.ExecutionEngine.ExecuteWithFrame(main.def, "calc", "(I)I", frame, false)
+	if thrown, ok := err.(*ExceptionThrownError); !ok || "com/fh/OtherException" != thrown.ExceptionRef.Object.DefFile.FullClassName {
+		t.Fatalf("expect OtherException to propagate, got %v", err)
+	}
+}
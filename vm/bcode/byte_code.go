@@ -12,13 +12,27 @@ const (
 	Iconst3 = 0x06
 	Iconst4 = 0x07
 	Iconst5 = 0x08
+	Lconst0 = 0x09
+	Lconst1 = 0x0a
+	Fconst0 = 0x0b
+	Fconst1 = 0x0c
+	Fconst2 = 0x0d
+	Dconst0 = 0x0e
+	Dconst1 = 0x0f
 
 	Ldc = 0x12
+	LdcW = 0x13
+	Ldc2W = 0x14
 
 	Iaload = 0x2e
+	Laload = 0x2f
+	Faload = 0x30
+	Daload = 0x31
 
 	Aaload = 0x32
+	Baload = 0x33
 	Caload = 0x34
+	Saload = 0x35
 
 	Istore0 = 0x3b
 	Istore1 = 0x3c
@@ -34,6 +48,24 @@ const (
 	Iload2 = 0x1c
 	Iload3 = 0x1d
 
+	Lload = 0x16
+	Lload0 = 0x1e
+	Lload1 = 0x1f
+	Lload2 = 0x20
+	Lload3 = 0x21
+
+	Fload = 0x17
+	Fload0 = 0x22
+	Fload1 = 0x23
+	Fload2 = 0x24
+	Fload3 = 0x25
+
+	Dload = 0x18
+	Dload0 = 0x26
+	Dload1 = 0x27
+	Dload2 = 0x28
+	Dload3 = 0x29
+
 	Aload = 0x19
 	Aload0 = 0x2a
 	Aload1 = 0x2b
@@ -49,7 +81,21 @@ const (
 	Monitorexit = 0xc3
 
 	Istore = 0x36
+	Lstore = 0x37
+	Lstore0 = 0x3f
 	Lstore1 = 0x40
+	Lstore2 = 0x41
+	Lstore3 = 0x42
+	Fstore = 0x38
+	Fstore0 = 0x43
+	Fstore1 = 0x44
+	Fstore2 = 0x45
+	Fstore3 = 0x46
+	Dstore = 0x39
+	Dstore0 = 0x47
+	Dstore1 = 0x48
+	Dstore2 = 0x49
+	Dstore3 = 0x4a
 
 	Astore = 0x3a
 	Astore0 = 0x4b
@@ -57,20 +103,89 @@ const (
 	Astore2 = 0x4d
 	Astore3 = 0x4e
 	Iastore = 0x4f
+	Lastore = 0x50
+	Fastore = 0x51
+	Dastore = 0x52
 
 	Aastore = 0x53
+	Bastore = 0x54
 	Castore = 0x55
+	Sastore = 0x56
 	Pop = 0x57
+	Pop2 = 0x58
 
 	Dup = 0x59
+	DupX1 = 0x5a
+	DupX2 = 0x5b
+	Dup2 = 0x5c
+	Dup2X1 = 0x5d
+	Dup2X2 = 0x5e
+	Swap = 0x5f
 
 	Iadd = 0x60
+	Ladd = 0x61
 	Isub = 0x64
+	Lsub = 0x65
+	Imul = 0x68
+	Idiv = 0x6c
+	Irem = 0x70
+	Ineg = 0x74
+	Lmul = 0x69
+	Ldiv = 0x6d
+	Lrem = 0x71
+	Lneg = 0x75
+
+	Fadd = 0x62
+	Fsub = 0x66
+	Fmul = 0x6a
+	Fdiv = 0x6e
+	Frem = 0x72
+	Fneg = 0x76
+
+	Dadd = 0x63
+	Dsub = 0x67
+	Dmul = 0x6b
+	Ddiv = 0x6f
+	Drem = 0x73
+	Dneg = 0x77
 
 	Ishl = 0x78
+	Lshl = 0x79
+	Ishr = 0x7a
+	Lshr = 0x7b
+	Iushr = 0x7c
+	Lushr = 0x7d
+	Iand = 0x7e
+	Land = 0x7f
+	Ior = 0x80
+	Lor = 0x81
+	Ixor = 0x82
+	Lxor = 0x83
 
 	Iinc = 0x84
 
+	I2l = 0x85
+	I2f = 0x86
+	I2d = 0x87
+	L2i = 0x88
+	L2f = 0x89
+	L2d = 0x8a
+	F2i = 0x8b
+	F2l = 0x8c
+	F2d = 0x8d
+	D2i = 0x8e
+	D2l = 0x8f
+	D2f = 0x90
+	I2b = 0x91
+	I2c = 0x92
+	I2s = 0x93
+
+	Lcmp = 0x94
+	Fcmpl = 0x95
+	Fcmpg = 0x96
+	Dcmpl = 0x97
+	Dcmpg = 0x98
+
 	Ifeq = 0x99
 	Ifne = 0x9a
 	Iflt = 0x9b
@@ -87,6 +202,8 @@ const (
 	Ifacmpeq = 0xa5
 	Ifacmpne = 0xa6
 	Goto = 0xa7
+	Tableswitch = 0xaa
+	Lookupswitch = 0xab
 
 	Areturn = 0xb0
 	Return = 0xb1
@@ -96,20 +213,30 @@ const (
 
 	Newarray = 0xbc
 	Anewarray = 0xbd
+	Multianewarray = 0xc5
 
 	Invokevirtual = 0xb6
 	Invokespecial = 0xb7
 	Invokestatic = 0xb8
 	Invokeinterface = 0xb9
+	Invokedynamic = 0xba
 
 	New = 0xbb
 
 	Arraylength = 0xbe
 
 	Ireturn = 0xac
+	Lreturn = 0xad
+	Freturn = 0xae
+	Dreturn = 0xaf
+
+	Checkcast = 0xc0
+	Instanceof = 0xc1
 
 	Wide = 0xc4
+	Ifnull = 0xc6
 	Ifnonnull = 0xc7
+	GotoW = 0xc8
 )
 
 func ToName(code byte) string {
@@ -135,10 +262,20 @@ func ToName(code byte) string {
 
 	case Iaload:
 		return "iaload"
+	case Laload:
+		return "laload"
+	case Faload:
+		return "faload"
+	case Daload:
+		return "daload"
 	case Aaload:
 		return "aaload"
+	case Baload:
+		return "baload"
 	case Caload:
 		return "caload"
+	case Saload:
+		return "saload"
 
 	case Istore0:
 		return "istore_0"
@@ -208,22 +345,64 @@ func ToName(code byte) string {
 
 	case Iastore:
 		return "iastore"
+	case Lastore:
+		return "lastore"
+	case Fastore:
+		return "fastore"
+	case Dastore:
+		return "dastore"
 	case Aastore:
 		return "aastore"
+	case Bastore:
+		return "bastore"
 	case Castore:
 		return "castore"
+	case Sastore:
+		return "sastore"
 
 	case Pop:
 		return "pop"
+	case Pop2:
+		return "pop2"
 	case Dup:
 		return "dup"
+	case DupX1:
+		return "dup_x1"
+	case DupX2:
+		return "dup_x2"
+	case Dup2:
+		return "dup2"
+	case Dup2X1:
+		return "dup2_x1"
+	case Dup2X2:
+		return "dup2_x2"
+	case Swap:
+		return "swap"
 
 	case Iadd:
 		return "iadd"
 	case Isub:
 		return "isub"
+	case Imul:
+		return "imul"
+	case Idiv:
+		return "idiv"
+	case Irem:
+		return "irem"
+	case Ineg:
+		return "ineg"
 	case Ishl:
 		return "ishl"
+	case Ishr:
+		return "ishr"
+	case Iushr:
+		return "iushr"
+	case Iand:
+		return "iand"
+	case Ior:
+		return "ior"
+	case Ixor:
+		return "ixor"
 	case Iinc:
 		return "iinc"
 
@@ -273,6 +452,8 @@ func ToName(code byte) string {
 		return "newarray"
 	case Anewarray:
 		return "anewarray"
+	case Multianewarray:
+		return "multianewarray"
 
 	case Invokevirtual:
 		return "invokevirtual"
@@ -282,6 +463,8 @@ func ToName(code byte) string {
 		return "invokestatic"
 	case Invokeinterface:
 		return "invokeinterface"
+	case Invokedynamic:
+		return "invokedynamic"
 
 	case New:
 		return "new"
@@ -294,10 +477,19 @@ func ToName(code byte) string {
 	case Wide:
 		return "wide"
 
+	case Checkcast:
+		return "checkcast"
+
+	case Ifnull:
+		return "ifnull"
 	case Ifnonnull:
 		return "ifnonnull"
 
 	default:
+		if name, ok := opcodeNames[code]; ok {
+			return name
+		}
+
 		return "unknown: " + hex.EncodeToString([]byte{code})
 	}
 }
@@ -0,0 +1,167 @@
+package bcode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 变长指令的操作数长度标记
+const variableLength = -1
+
+// 各字节码操作数的字节数(不含操作码本身);
+// key为操作码, -1表示变长指令, 不在表中的操作码为非法字节码
+var operandLengths = map[byte]int{}
+
+// 全部字节码的助记符, key为操作码
+var opcodeNames = map[byte]string{}
+
+// 用DefineOpcode定义的伪指令
+var customOpcodes = map[byte]bool{}
+
+func init() {
+	defineOpcodes(0x00, 0, "nop", "aconst_null", "iconst_m1", "iconst_0", "iconst_1", "iconst_2", "iconst_3", "iconst_4", "iconst_5",
+		"lconst_0", "lconst_1", "fconst_0", "fconst_1", "fconst_2", "dconst_0", "dconst_1")
+	defineOpcodes(0x10, 1, "bipush")
+	defineOpcodes(0x11, 2, "sipush")
+	defineOpcodes(0x12, 1, "ldc")
+	defineOpcodes(0x13, 2, "ldc_w", "ldc2_w")
+	defineOpcodes(0x15, 1, "iload", "lload", "fload", "dload", "aload")
+	defineOpcodes(0x1a, 0, "iload_0", "iload_1", "iload_2", "iload_3",
+		"lload_0", "lload_1", "lload_2", "lload_3",
+		"fload_0", "fload_1", "fload_2", "fload_3",
+		"dload_0", "dload_1", "dload_2", "dload_3",
+		"aload_0", "aload_1", "aload_2", "aload_3",
+		"iaload", "laload", "faload", "daload", "aaload", "baload", "caload", "saload")
+	defineOpcodes(0x36, 1, "istore", "lstore", "fstore", "dstore", "astore")
+	defineOpcodes(0x3b, 0, "istore_0", "istore_1", "istore_2", "istore_3",
+		"lstore_0", "lstore_1", "lstore_2", "lstore_3",
+		"fstore_0", "fstore_1", "fstore_2", "fstore_3",
+		"dstore_0", "dstore_1", "dstore_2", "dstore_3",
+		"astore_0", "astore_1", "astore_2", "astore_3",
+		"iastore", "lastore", "fastore", "dastore", "aastore", "bastore", "castore", "sastore",
+		"pop", "pop2", "dup", "dup_x1", "dup_x2", "dup2", "dup2_x1", "dup2_x2", "swap",
+		"iadd", "ladd", "fadd", "dadd", "isub", "lsub", "fsub", "dsub",
+		"imul", "lmul", "fmul", "dmul", "idiv", "ldiv", "fdiv", "ddiv",
+		"irem", "lrem", "frem", "drem", "ineg", "lneg", "fneg", "dneg",
+		"ishl", "lshl", "ishr", "lshr", "iushr", "lushr",
+		"iand", "land", "ior", "lor", "ixor", "lxor")
+	defineOpcodes(0x84, 2, "iinc")
+	defineOpcodes(0x85, 0, "i2l", "i2f", "i2d", "l2i", "l2f", "l2d", "f2i", "f2l", "f2d", "d2i", "d2l", "d2f",
+		"i2b", "i2c", "i2s", "lcmp", "fcmpl", "fcmpg", "dcmpl", "dcmpg")
+	defineOpcodes(0x99, 2, "ifeq", "ifne", "iflt", "ifge", "ifgt", "ifle",
+		"if_icmpeq", "if_icmpne", "if_icmplt", "if_icmpge", "if_icmpgt", "if_icmple", "if_acmpeq", "if_acmpne",
+		"goto", "jsr")
+	defineOpcodes(0xa9, 1, "ret")
+	defineOpcodes(0xaa, variableLength, "tableswitch", "lookupswitch")
+	defineOpcodes(0xac, 0, "ireturn", "lreturn", "freturn", "dreturn", "areturn", "return")
+	defineOpcodes(0xb2, 2, "getstatic", "putstatic", "getfield", "putfield",
+		"invokevirtual", "invokespecial", "invokestatic")
+	defineOpcodes(0xb9, 4, "invokeinterface", "invokedynamic")
+	defineOpcodes(0xbb, 2, "new")
+	defineOpcodes(0xbc, 1, "newarray")
+	defineOpcodes(0xbd, 2, "anewarray")
+	defineOpcodes(0xbe, 0, "arraylength", "athrow")
+	defineOpcodes(0xc0, 2, "checkcast", "instanceof")
+	defineOpcodes(0xc2, 0, "monitorenter", "monitorexit")
+	defineOpcodes(0xc4, variableLength, "wide")
+	defineOpcodes(0xc5, 3, "multianewarray")
+	defineOpcodes(0xc6, 2, "ifnull", "ifnonnull")
+	defineOpcodes(0xc8, 4, "goto_w", "jsr_w")
+}
+
+// 从start开始连续定义操作数长度相同的一组字节码
+func defineOpcodes(start byte, operandLen int, names ...string) {
+	for ix, name := range names {
+		code := start + byte(ix)
+		operandLengths[code] = operandLen
+		opcodeNames[code] = name
+	}
+}
+
+// 定义JVM规范之外的伪指令(如插桩工具生成的指令), 之后链接, 反汇编和verify都按此长度解码;
+// 只能使用规范中没有定义的操作码, 同一操作码重复定义时必须完全一致; 需要在加载使用它的类之前调用
+func DefineOpcode(code byte, name string, operandLen int) error {
+	if operandLen < 0 {
+		return fmt.Errorf("invalid operand length %d for opcode 0x%02x", operandLen, code)
+	}
+
+	if existing, ok := opcodeNames[code]; ok {
+		if existing == name && operandLengths[code] == operandLen && customOpcodes[code] {
+			return nil
+		}
+		return fmt.Errorf("opcode 0x%02x is already defined as '%s'", code, existing)
+	}
+
+	defineOpcodes(code, operandLen, name)
+	customOpcodes[code] = true
+	return nil
+}
+
+// 是否为JVM规范中定义的字节码, 或者用DefineOpcode定义的伪指令
+func IsValid(code byte) bool {
+	_, ok := operandLengths[code]
+	return ok
+}
+
+// 计算pc处指令的总长度(包括操作码本身);
+// 对tableswitch/lookupswitch会处理4字节对齐的padding, 对wide会根据被加宽的指令计算长度
+func InstructionLength(code []byte, pc int) (int, error) {
+	if pc < 0 || pc >= len(code) {
+		return 0, fmt.Errorf("pc %d out of code range [0, %d)", pc, len(code))
+	}
+
+	op := code[pc]
+	operandLen, ok := operandLengths[op]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte code 0x%02x at pc %d", op, pc)
+	}
+
+	length := 1 + operandLen
+	switch op {
+	case 0xaa, 0xab:
+		// 操作码之后补齐到4字节对齐
+		padding := (4 - (pc + 1) % 4) % 4
+		base := pc + 1 + padding
+		if op == 0xaa {
+			// default, low, high, 以及high - low + 1个跳转偏移量
+			if base + 12 > len(code) {
+				return 0, fmt.Errorf("truncated tableswitch at pc %d", pc)
+			}
+			low := int32(binary.BigEndian.Uint32(code[base + 4:]))
+			high := int32(binary.BigEndian.Uint32(code[base + 8:]))
+			if low > high {
+				return 0, fmt.Errorf("tableswitch at pc %d has low %d > high %d", pc, low, high)
+			}
+			length = 1 + padding + 12 + 4 * int(int64(high) - int64(low) + 1)
+
+		} else {
+			// default, npairs, 以及npairs个match-offset对
+			if base + 8 > len(code) {
+				return 0, fmt.Errorf("truncated lookupswitch at pc %d", pc)
+			}
+			npairs := int32(binary.BigEndian.Uint32(code[base + 4:]))
+			if npairs < 0 {
+				return 0, fmt.Errorf("lookupswitch at pc %d has negative npairs %d", pc, npairs)
+			}
+			length = 1 + padding + 8 + 8 * int(npairs)
+		}
+
+	case 0xc4:
+		// wide <opcode> indexbyte1 indexbyte2
+		// wide iinc indexbyte1 indexbyte2 constbyte1 constbyte2
+		if pc + 1 >= len(code) {
+			return 0, fmt.Errorf("truncated wide at pc %d", pc)
+		}
+		if Iinc == code[pc + 1] {
+			length = 6
+		} else {
+			length = 4
+		}
+	}
+
+	if pc + length > len(code) {
+		return 0, fmt.Errorf("truncated instruction %s at pc %d", ToName(op), pc)
+	}
+
+	return length, nil
+}
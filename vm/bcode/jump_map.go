@@ -0,0 +1,96 @@
+package bcode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 方法字节码的预解码结果;
+// 记录每条指令的起始位置和所有跳转指令的目标, 跳转目标在构建时已经检查过
+type JumpMap struct {
+	// 下标为pc, 值表示该位置是否为一条指令的起始
+	starts []bool
+
+	// 跳转指令的所有目标, key为跳转指令的pc
+	Targets map[int][]int
+}
+
+// 逐条指令解码, 检查每个跳转目标(包括goto_w, jsr_w和switch)都在字节码范围内并且落在指令起始位置上
+func BuildJumpMap(code []byte) (*JumpMap, error) {
+	m := &JumpMap{
+		starts:  make([]bool, len(code)),
+		Targets: make(map[int][]int),
+	}
+
+	for pc := 0; pc < len(code); {
+		length, err := InstructionLength(code, pc)
+		if nil != err {
+			return nil, err
+		}
+		m.starts[pc] = true
+
+		targets := branchTargets(code, pc)
+		if len(targets) > 0 {
+			m.Targets[pc] = targets
+		}
+
+		pc += length
+	}
+
+	for pc, targets := range m.Targets {
+		for _, target := range targets {
+			if target < 0 || target >= len(code) {
+				return nil, fmt.Errorf("%s at pc %d jumps to %d, out of code range [0, %d)", ToName(code[pc]), pc, target, len(code))
+			}
+			if !m.starts[target] {
+				return nil, fmt.Errorf("%s at pc %d jumps to %d, which is not an instruction boundary", ToName(code[pc]), pc, target)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// pc是否为一条指令的起始位置
+func (m *JumpMap) IsInstructionStart(pc int) bool {
+	return pc >= 0 && pc < len(m.starts) && m.starts[pc]
+}
+
+// 计算跳转指令的目标, 非跳转指令返回nil; 调用前指令长度已经检查过
+func branchTargets(code []byte, pc int) []int {
+	op := code[pc]
+	switch {
+	case op >= 0x99 && op <= 0xa8, op == 0xc6, op == 0xc7:
+		// if<cond>, if_icmp<cond>, if_acmp<cond>, goto, jsr, ifnull, ifnonnull
+		offset := int16(binary.BigEndian.Uint16(code[pc + 1:]))
+		return []int{pc + int(offset)}
+
+	case op == 0xc8, op == 0xc9:
+		// goto_w, jsr_w
+		offset := int32(binary.BigEndian.Uint32(code[pc + 1:]))
+		return []int{pc + int(offset)}
+
+	case op == 0xaa:
+		// tableswitch
+		base := pc + 1 + (4 - (pc + 1) % 4) % 4
+		targets := []int{pc + int(int32(binary.BigEndian.Uint32(code[base:])))}
+		low := int32(binary.BigEndian.Uint32(code[base + 4:]))
+		high := int32(binary.BigEndian.Uint32(code[base + 8:]))
+		for ix := 0; ix < int(int64(high) - int64(low) + 1); ix++ {
+			targets = append(targets, pc + int(int32(binary.BigEndian.Uint32(code[base + 12 + 4 * ix:]))))
+		}
+		return targets
+
+	case op == 0xab:
+		// lookupswitch
+		base := pc + 1 + (4 - (pc + 1) % 4) % 4
+		targets := []int{pc + int(int32(binary.BigEndian.Uint32(code[base:])))}
+		npairs := int(int32(binary.BigEndian.Uint32(code[base + 4:])))
+		for ix := 0; ix < npairs; ix++ {
+			targets = append(targets, pc + int(int32(binary.BigEndian.Uint32(code[base + 8 + 8 * ix + 4:]))))
+		}
+		return targets
+	}
+
+	return nil
+}
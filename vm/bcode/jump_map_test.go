@@ -0,0 +1,54 @@
+package bcode
+
+import (
+	"testing"
+)
+
+func TestBuildJumpMap(t *testing.T) {
+	// 0: iconst_0, 1: ifeq +5, 4: nop, 5: nop, 6: goto_w -6, 11: return
+	code := []byte{0x03, 0x99, 0x00, 0x05, 0x00, 0x00, 0xc8, 0xff, 0xff, 0xff, 0xfa, 0xb1}
+	m, err := BuildJumpMap(code)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 6 != m.Targets[1][0] || 0 != m.Targets[6][0] {
+		t.Fatalf("unexpected targets %v", m.Targets)
+	}
+	if !m.IsInstructionStart(11) || m.IsInstructionStart(2) {
+		t.Fatal("unexpected instruction boundaries")
+	}
+
+	// 跳到ifeq的操作数中间
+	_, err = BuildJumpMap([]byte{0x03, 0x99, 0x00, 0x01, 0xb1})
+	if nil == err {
+		t.Fatal("expected error for jump into the middle of an instruction")
+	}
+
+	// 跳出字节码范围
+	_, err = BuildJumpMap([]byte{0xa7, 0x80, 0x00, 0xb1})
+	if nil == err {
+		t.Fatal("expected error for jump out of code range")
+	}
+}
+
+func TestBuildJumpMapSwitch(t *testing.T) {
+	// 0: iconst_0, 1: tableswitch(padding 2), default 20, low 0, high 0, offset 19, 20: return
+	code := []byte{0x03, 0xaa, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x13,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x12,
+		0xb1}
+	if _, err := BuildJumpMap(code); nil == err {
+		t.Fatal("expected error for switch target not on instruction boundary")
+	}
+
+	code[19] = 0x13
+	m, err := BuildJumpMap(code)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(m.Targets[1]) || 20 != m.Targets[1][1] {
+		t.Fatalf("unexpected targets %v", m.Targets)
+	}
+}
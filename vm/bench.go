@@ -0,0 +1,349 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+	"time"
+)
+
+// 内置的基准测试, 字节码在内存中生成, 每次操作对应workload中run(int n)循环的一次迭代
+type Benchmark struct {
+	Name        string
+	Description string
+
+	classes func() []*class.DefFile
+	// 执行n次操作后run()的正确返回值, 用来确认解释器结果没有出错
+	expect func(n int) int
+}
+
+// 一次基准测试的结果, 只统计最后一轮
+type BenchResult struct {
+	Name    string
+	Ops     int
+	Elapsed time.Duration
+
+	// 执行的字节码条数
+	ByteCodes int64
+	// 宿主(go)的内存分配次数和字节数
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+func (r *BenchResult) NsPerOp() float64 {
+	return float64(r.Elapsed.Nanoseconds()) / float64(r.Ops)
+}
+
+func (r *BenchResult) OpsPerSec() float64 {
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+func (r *BenchResult) ByteCodesPerOp() float64 {
+	return float64(r.ByteCodes) / float64(r.Ops)
+}
+
+func (r *BenchResult) AllocsPerOp() float64 {
+	return float64(r.Allocs) / float64(r.Ops)
+}
+
+func (r *BenchResult) BytesPerOp() float64 {
+	return float64(r.AllocBytes) / float64(r.Ops)
+}
+
+func (r *BenchResult) String() string {
+	return fmt.Sprintf("%-14s %10d ops %12.0f ns/op %12.0f ops/s %10.1f bytecodes/op %10.1f allocs/op %12.0f B/op",
+		r.Name, r.Ops, r.NsPerOp(), r.OpsPerSec(), r.ByteCodesPerOp(), r.AllocsPerOp(), r.BytesPerOp())
+}
+
+const benchMainClass = "cn/minijvm/bench/Main"
+
+// 与go test -bench相同, 逐轮增加操作次数, 直到一轮的耗时达到minTime
+func (b *Benchmark) Run(minTime time.Duration) (*BenchResult, error) {
+	jvm, err := b.newJvm()
+	if nil != err {
+		return nil, fmt.Errorf("failed to prepare benchmark '%s': %w", b.Name, err)
+	}
+
+	n := 1
+	for {
+		result, err := b.runOnce(jvm, n)
+		if nil != err {
+			return nil, fmt.Errorf("benchmark '%s' failed: %w", b.Name, err)
+		}
+		if result.Elapsed >= minTime || n >= 1e9 {
+			return result, nil
+		}
+
+		// 按当前速度预估下一轮的次数, 多跑20%, 每轮最多增加100倍
+		next := n * 100
+		if perOp := result.Elapsed.Nanoseconds() / int64(n); perOp > 0 {
+			if predicted := int(minTime.Nanoseconds() / perOp * 6 / 5); predicted < next {
+				next = predicted
+			}
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+}
+
+func (b *Benchmark) runOnce(jvm *MiniJvm, n int) (*BenchResult, error) {
+	timed, err := jvm.ExecuteTimed(benchMainClass, "run", "(I)I", []interface{}{n}, 0, 1)
+	if nil != err {
+		return nil, err
+	}
+
+	if ret, ok := timed.Return.(int); !ok || b.expect(n) != ret {
+		return nil, fmt.Errorf("unexpected result for n = %d: expect %d, got %v", n, b.expect(n), timed.Return)
+	}
+
+	return &BenchResult{
+		Name:       b.Name,
+		Ops:        n,
+		Elapsed:    timed.Steady.WallTime,
+		ByteCodes:  timed.Steady.ByteCodes,
+		Allocs:     timed.Steady.Allocs,
+		AllocBytes: timed.Steady.AllocBytes,
+	}, nil
+}
+
+// 只包含workload所需类的虚拟机, 不读取classpath
+func (b *Benchmark) newJvm() (*MiniJvm, error) {
+	jvm := &MiniJvm{
+		NativeMethodTable: newBuiltinNativeMethodTable(),
+		IntrinsicTable:    newBuiltinIntrinsicTable(),
+		stats:             new(vmStats),
+	}
+	ma := &MethodArea{
+		Jvm:            jvm,
+		ClassMap:       make(map[string]*class.DefFile),
+		IgnoredClasses: make(map[string]interface{}),
+		loadingLocks:   make(map[string]*sync.Mutex),
+		classObjects:   make(map[*class.DefFile]*class.Reference),
+	}
+	jvm.MethodArea = ma
+	jvm.ExecutionEngine = NewInterpretedExecutionEngine(jvm)
+
+	defs := append(benchRuntimeClasses(), b.classes()...)
+	for _, def := range defs {
+		ma.ClassMap[def.FullClassName] = def
+	}
+	for _, def := range defs {
+		if err := ma.initVTable(def); nil != err {
+			return nil, err
+		}
+	}
+
+	return jvm, nil
+}
+
+// 所有内置基准测试
+func Benchmarks() []*Benchmark {
+	return []*Benchmark{
+		{
+			Name:        "fib",
+			Description: "递归计算fib(15), 测试invokestatic和栈帧创建",
+			classes:     benchFibClasses,
+			expect:      func(n int) int { return 610 * n },
+		},
+		{
+			Name:        "sieve",
+			Description: "用int[]筛出1000以内的素数, 测试数组访问和分支",
+			classes:     benchSieveClasses,
+			expect:      func(n int) int { return 168 * n },
+		},
+		{
+			Name:        "string-concat",
+			Description: "用String.concat()把16个字符拼接成字符串",
+			classes:     benchConcatClasses,
+			expect:      func(n int) int { return 16 * n },
+		},
+		{
+			Name:        "virtual-call",
+			Description: "通过抽象类引用交替调用两个子类的方法, 测试invokevirtual的虚方法表查找",
+			classes:     benchVirtualCallClasses,
+			expect:      func(n int) int { return 10 * n },
+		},
+		{
+			Name:        "alloc",
+			Description: "每次创建一个对象和一个int[8], 测试new, putfield和newarray",
+			classes:     benchAllocClasses,
+			expect:      func(n int) int { return n * (n - 1) / 2 + 8 * n },
+		},
+	}
+}
+
+// 根据名字查找内置基准测试
+func FindBenchmark(name string) *Benchmark {
+	for _, b := range Benchmarks() {
+		if name == b.Name {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// workload共用的Object和String
+func benchRuntimeClasses() []*class.DefFile {
+	object := newClassBuilder("java/lang/Object", "")
+
+	str := newClassBuilder("java/lang/String", "java/lang/Object")
+	str.field("value", "[C")
+	str.field("hash", "I")
+	// 由intrinsic实现
+	str.method(accflag.Public, "length", "()I", 0, 0, nil)
+	str.method(accflag.Public, "concat", "(Ljava/lang/String;)Ljava/lang/String;", 0, 0, nil)
+
+	return []*class.DefFile{object.def, str.def}
+}
+
+// static int run(int n) { int sum = 0; for (int i = 0; i < n; i++) { body } return sum; }
+// 局部变量0为n, 1为sum, 2为i, 3以后可以由setup和body使用
+func benchRunMethod(main *classBuilder, maxLocals uint16, setup func(a *codeAssembler), body func(a *codeAssembler)) {
+	a := newCodeAssembler()
+	if nil != setup {
+		setup(a)
+	}
+	a.emit(bcode.Iconst0, bcode.Istore1, bcode.Iconst0, bcode.Istore2)
+	a.label("loop").emit(bcode.Iload2, bcode.Iload0).jump(bcode.Ificmpge, "end")
+	body(a)
+	a.emit(bcode.Iinc, 2, 1).jump(bcode.Goto, "loop")
+	a.label("end").emit(bcode.Iload1, bcode.Ireturn)
+
+	main.method(accflag.Public | accflag.Static, "run", "(I)I", 4, maxLocals, a)
+}
+
+func benchFibClasses() []*class.DefFile {
+	main := newClassBuilder(benchMainClass, "java/lang/Object")
+	fibRef := main.methodRef(benchMainClass, "fib", "(I)I")
+
+	// static int fib(int n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+	fib := newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iconst2).jump(bcode.Ificmpge, "recurse").
+		emit(bcode.Iload0, bcode.Ireturn).
+		label("recurse").
+		emit(bcode.Iload0, bcode.Iconst1, bcode.Isub).emitIndex(bcode.Invokestatic, fibRef).
+		emit(bcode.Iload0, bcode.Iconst2, bcode.Isub).emitIndex(bcode.Invokestatic, fibRef).
+		emit(bcode.Iadd, bcode.Ireturn)
+	main.method(accflag.Public | accflag.Static, "fib", "(I)I", 3, 1, fib)
+
+	benchRunMethod(main, 3, nil, func(a *codeAssembler) {
+		a.emit(bcode.Iload1, bcode.Bipush, 15).emitIndex(bcode.Invokestatic, fibRef).emit(bcode.Iadd, bcode.Istore1)
+	})
+
+	return []*class.DefFile{main.def}
+}
+
+func benchSieveClasses() []*class.DefFile {
+	main := newClassBuilder(benchMainClass, "java/lang/Object")
+	sieveRef := main.methodRef(benchMainClass, "sieve", "(I)I")
+
+	// static int sieve(int limit) {
+	//     int[] composite = new int[limit]; int count = 0;
+	//     for (int i = 2; i < limit; i++) {
+	//         if (composite[i] != 0) continue;
+	//         count++;
+	//         for (int j = i + i; j < limit; j += i) composite[j] = 1;
+	//     }
+	//     return count;
+	// }
+	sieve := newCodeAssembler().
+		emit(bcode.Iload0, bcode.Newarray, atype.Int, bcode.Astore1).
+		emit(bcode.Iconst0, bcode.Istore2, bcode.Iconst2, bcode.Istore3).
+		label("outer").emit(bcode.Iload3, bcode.Iload0).jump(bcode.Ificmpge, "done").
+		emit(bcode.Aload1, bcode.Iload3, bcode.Iaload).jump(bcode.Ifne, "next").
+		emit(bcode.Iinc, 2, 1).
+		emit(bcode.Iload3, bcode.Iload3, bcode.Iadd, bcode.Istore, 4).
+		label("inner").emit(bcode.Iload, 4, bcode.Iload0).jump(bcode.Ificmpge, "next").
+		emit(bcode.Aload1, bcode.Iload, 4, bcode.Iconst1, bcode.Iastore).
+		emit(bcode.Iload, 4, bcode.Iload3, bcode.Iadd, bcode.Istore, 4).
+		jump(bcode.Goto, "inner").
+		label("next").emit(bcode.Iinc, 3, 1).jump(bcode.Goto, "outer").
+		label("done").emit(bcode.Iload2, bcode.Ireturn)
+	main.method(accflag.Public | accflag.Static, "sieve", "(I)I", 3, 5, sieve)
+
+	benchRunMethod(main, 3, nil, func(a *codeAssembler) {
+		a.emit(bcode.Iload1).emitIndex(bcode.Sipush, 1000).emitIndex(bcode.Invokestatic, sieveRef).emit(bcode.Iadd, bcode.Istore1)
+	})
+
+	return []*class.DefFile{main.def}
+}
+
+func benchConcatClasses() []*class.DefFile {
+	main := newClassBuilder(benchMainClass, "java/lang/Object")
+	buildRef := main.methodRef(benchMainClass, "build", "()I")
+	concatRef := main.methodRef("java/lang/String", "concat", "(Ljava/lang/String;)Ljava/lang/String;")
+	lengthRef := main.methodRef("java/lang/String", "length", "()I")
+	empty := main.stringConst("")
+	x := main.stringConst("x")
+
+	// static int build() { String s = ""; for (int i = 0; i < 16; i++) s = s.concat("x"); return s.length(); }
+	build := newCodeAssembler().
+		emit(bcode.Ldc, byte(empty), bcode.Astore0, bcode.Iconst0, bcode.Istore1).
+		label("loop").emit(bcode.Iload1, bcode.Bipush, 16).jump(bcode.Ificmpge, "end").
+		emit(bcode.Aload0, bcode.Ldc, byte(x)).emitIndex(bcode.Invokevirtual, concatRef).emit(bcode.Astore0).
+		emit(bcode.Iinc, 1, 1).jump(bcode.Goto, "loop").
+		label("end").emit(bcode.Aload0).emitIndex(bcode.Invokevirtual, lengthRef).emit(bcode.Ireturn)
+	main.method(accflag.Public | accflag.Static, "build", "()I", 2, 2, build)
+
+	benchRunMethod(main, 3, nil, func(a *codeAssembler) {
+		a.emit(bcode.Iload1).emitIndex(bcode.Invokestatic, buildRef).emit(bcode.Iadd, bcode.Istore1)
+	})
+
+	return []*class.DefFile{main.def}
+}
+
+func benchVirtualCallClasses() []*class.DefFile {
+	const shapeClass, squareClass, rectClass = "cn/minijvm/bench/Shape", "cn/minijvm/bench/Square", "cn/minijvm/bench/Rect"
+
+	// abstract class Shape { abstract int area(); }
+	shape := newClassBuilder(shapeClass, "java/lang/Object")
+	shape.def.AccessFlag = accflag.Public | accflag.Abstarct
+	shape.method(accflag.Public | accflag.Abstarct, "area", "()I", 0, 0, nil)
+
+	square := newClassBuilder(squareClass, shapeClass)
+	square.method(accflag.Public, "area", "()I", 1, 1, newCodeAssembler().emit(bcode.Iconst4, bcode.Ireturn))
+	rect := newClassBuilder(rectClass, shapeClass)
+	rect.method(accflag.Public, "area", "()I", 1, 1, newCodeAssembler().emit(bcode.Bipush, 6, bcode.Ireturn))
+
+	main := newClassBuilder(benchMainClass, "java/lang/Object")
+	areaRef := main.methodRef(shapeClass, "area", "()I")
+	squareRef := main.classRef(squareClass)
+	rectRef := main.classRef(rectClass)
+
+	// Shape a = new Square(), b = new Rect(); 循环中sum += a.area() + b.area()
+	benchRunMethod(main, 5, func(a *codeAssembler) {
+		a.emitIndex(bcode.New, squareRef).emit(bcode.Astore3)
+		a.emitIndex(bcode.New, rectRef).emit(bcode.Astore, 4)
+	}, func(a *codeAssembler) {
+		a.emit(bcode.Iload1, bcode.Aload3).emitIndex(bcode.Invokevirtual, areaRef).emit(bcode.Iadd)
+		a.emit(bcode.Aload, 4).emitIndex(bcode.Invokevirtual, areaRef).emit(bcode.Iadd, bcode.Istore1)
+	})
+
+	return []*class.DefFile{shape.def, square.def, rect.def, main.def}
+}
+
+func benchAllocClasses() []*class.DefFile {
+	const nodeClass = "cn/minijvm/bench/Node"
+
+	node := newClassBuilder(nodeClass, "java/lang/Object")
+	node.field("value", "I")
+
+	main := newClassBuilder(benchMainClass, "java/lang/Object")
+	nodeRef := main.classRef(nodeClass)
+	valueRef := main.fieldRef(nodeClass, "value", "I")
+
+	// Node node = new Node(); node.value = i; sum += node.value + new int[8].length;
+	benchRunMethod(main, 4, nil, func(a *codeAssembler) {
+		a.emitIndex(bcode.New, nodeRef).emit(bcode.Dup, bcode.Iload2).emitIndex(bcode.Putfield, valueRef).emit(bcode.Astore3)
+		a.emit(bcode.Iload1, bcode.Aload3).emitIndex(bcode.GetField, valueRef).emit(bcode.Iadd)
+		a.emit(bcode.Bipush, 8, bcode.Newarray, atype.Int, bcode.Arraylength, bcode.Iadd, bcode.Istore1)
+	})
+
+	return []*class.DefFile{node.def, main.def}
+}
@@ -0,0 +1,191 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 在内存中构造class, 内置基准测试用它生成workload, 不依赖javac和rt.jar;
+// 也用于生成虚拟机内置的类(见builtinClasses)
+type classBuilder struct {
+	def *class.DefFile
+}
+
+func newClassBuilder(name string, superName string) *classBuilder {
+	b := &classBuilder{def: &class.DefFile{FullClassName: name, ConstPool: class.NewConstPool()}}
+	b.def.ThisClass = b.classRef(name)
+	if "" != superName {
+		b.def.SuperClass = b.classRef(superName)
+	}
+
+	return b
+}
+
+func (b *classBuilder) implements(interfaceName string) *classBuilder {
+	b.def.Interfaces = append(b.def.Interfaces, b.classRef(interfaceName))
+	return b
+}
+
+func (b *classBuilder) constant(item interface{}) uint16 {
+	return b.def.ConstPool.Add(item)
+}
+
+func (b *classBuilder) utf8(s string) uint16 {
+	return b.constant(&class.Utf8InfoConst{Bytes: []byte(s)})
+}
+
+func (b *classBuilder) classRef(name string) uint16 {
+	return b.constant(&class.ClassInfoConstInfo{FullClassNameIndex: b.utf8(name)})
+}
+
+func (b *classBuilder) stringConst(s string) uint16 {
+	return b.constant(&class.StringInfoConst{StringIndex: b.utf8(s)})
+}
+
+func (b *classBuilder) nameAndType(name string, descriptor string) uint16 {
+	return b.constant(&class.NameAndTypeConst{NameIndex: b.utf8(name), DescIndex: b.utf8(descriptor)})
+}
+
+func (b *classBuilder) methodRef(className string, name string, descriptor string) uint16 {
+	return b.constant(&class.MethodRefConstInfo{ClassIndex: b.classRef(className), NameAndTypeIndex: b.nameAndType(name, descriptor)})
+}
+
+func (b *classBuilder) fieldRef(className string, name string, descriptor string) uint16 {
+	return b.constant(&class.FieldRefConstInfo{ClassIndex: b.classRef(className), NameAndTypeIndex: b.nameAndType(name, descriptor)})
+}
+
+// 实例字段
+func (b *classBuilder) field(name string, descriptor string) {
+	b.def.Fields = append(b.def.Fields, &class.FieldInfo{
+		AccessFlags:     accflag.Public,
+		NameIndex:       b.utf8(name),
+		DescriptorIndex: b.utf8(descriptor),
+		DefFile:         b.def,
+	})
+}
+
+// code为nil时只有方法声明, 用于抽象方法和intrinsic方法
+func (b *classBuilder) method(flags uint16, name string, descriptor string, maxStack uint16, maxLocals uint16, code *codeAssembler) {
+	method := &class.MethodInfo{
+		AccessFlags:     flags,
+		NameIndex:       b.utf8(name),
+		DescriptorIndex: b.utf8(descriptor),
+		DefFile:         b.def,
+	}
+	if nil != code {
+		method.Attrs = []interface{}{&class.CodeAttr{MaxStack: maxStack, MaxLocals: maxLocals, Code: code.bytes()}}
+	}
+	b.def.Methods = append(b.def.Methods, method)
+}
+
+// 生成字节码, 跳转目标用标签表示, bytes()时再计算偏移量
+type codeAssembler struct {
+	code   []byte
+	labels map[string]int
+	// 需要回填偏移量的跳转指令位置 -> 目标标签
+	jumps map[int]string
+	// switch指令中需要回填的4字节偏移量
+	switchJumps []switchJump
+}
+
+// 偏移量写在at处, 相对于switch指令的位置pc
+type switchJump struct {
+	at    int
+	pc    int
+	label string
+}
+
+func newCodeAssembler() *codeAssembler {
+	return &codeAssembler{labels: make(map[string]int), jumps: make(map[int]string)}
+}
+
+func (a *codeAssembler) emit(code ...byte) *codeAssembler {
+	a.code = append(a.code, code...)
+	return a
+}
+
+// 带两字节常量池下标的指令
+func (a *codeAssembler) emitIndex(op byte, index uint16) *codeAssembler {
+	return a.emit(op, byte(index >> 8), byte(index))
+}
+
+func (a *codeAssembler) label(name string) *codeAssembler {
+	a.labels[name] = len(a.code)
+	return a
+}
+
+// 两字节偏移量的跳转指令
+func (a *codeAssembler) jump(op byte, label string) *codeAssembler {
+	a.jumps[len(a.code)] = label
+	return a.emit(op, 0, 0)
+}
+
+// tableswitch, labels依次为low, low + 1, ...的跳转目标
+func (a *codeAssembler) tableswitch(low int32, defaultLabel string, labels ...string) *codeAssembler {
+	pc := len(a.code)
+	a.emit(bcode.Tableswitch)
+	for 0 != len(a.code) % 4 {
+		a.emit(0)
+	}
+
+	a.switchJump(pc, defaultLabel)
+	a.emitInt32(low)
+	a.emitInt32(low + int32(len(labels)) - 1)
+	for _, label := range labels {
+		a.switchJump(pc, label)
+	}
+
+	return a
+}
+
+// lookupswitch, matches[i]跳转到labels[i]; matches需要按升序排列
+func (a *codeAssembler) lookupswitch(defaultLabel string, matches []int32, labels []string) *codeAssembler {
+	pc := len(a.code)
+	a.emit(bcode.Lookupswitch)
+	for 0 != len(a.code) % 4 {
+		a.emit(0)
+	}
+
+	a.switchJump(pc, defaultLabel)
+	a.emitInt32(int32(len(matches)))
+	for ix, match := range matches {
+		a.emitInt32(match)
+		a.switchJump(pc, labels[ix])
+	}
+
+	return a
+}
+
+func (a *codeAssembler) switchJump(pc int, label string) {
+	a.switchJumps = append(a.switchJumps, switchJump{at: len(a.code), pc: pc, label: label})
+	a.emitInt32(0)
+}
+
+func (a *codeAssembler) emitInt32(val int32) *codeAssembler {
+	return a.emit(byte(uint32(val) >> 24), byte(uint32(val) >> 16), byte(uint32(val) >> 8), byte(val))
+}
+
+func (a *codeAssembler) bytes() []byte {
+	for pc, label := range a.jumps {
+		target, ok := a.labels[label]
+		if !ok {
+			panic(fmt.Sprintf("undefined label '%s'", label))
+		}
+
+		offset := int16(target - pc)
+		a.code[pc + 1], a.code[pc + 2] = byte(uint16(offset) >> 8), byte(offset)
+	}
+	for _, jump := range a.switchJumps {
+		target, ok := a.labels[jump.label]
+		if !ok {
+			panic(fmt.Sprintf("undefined label '%s'", jump.label))
+		}
+
+		offset := uint32(int32(target - jump.pc))
+		a.code[jump.at], a.code[jump.at + 1], a.code[jump.at + 2], a.code[jump.at + 3] = byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset)
+	}
+
+	return a.code
+}
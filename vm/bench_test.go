@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"testing"
+)
+
+// 每个workload跑一轮, 结果由expect校验
+func TestBenchmarks(t *testing.T) {
+	for _, b := range Benchmarks() {
+		result, err := b.Run(0)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 1 != result.Ops || result.ByteCodes <= 0 {
+			t.Fatalf("%s: unexpected result %+v", b.Name, result)
+		}
+	}
+
+	if nil != FindBenchmark("nope") || nil == FindBenchmark("fib") {
+		t.Fatal("unexpected FindBenchmark result")
+	}
+}
+
+func TestCodeAssemblerJump(t *testing.T) {
+	code := newCodeAssembler().
+		label("start").emit(0x00).jump(0xa7, "end").
+		emit(0x00).jump(0xa7, "start").
+		label("end").bytes()
+
+	// goto end: 1 -> 8, goto start: 5 -> 0
+	expected := []byte{0x00, 0xa7, 0, 7, 0x00, 0xa7, 0xff, 0xfb}
+	if string(expected) != string(code) {
+		t.Fatalf("unexpected code %v", code)
+	}
+}
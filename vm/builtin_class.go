@@ -0,0 +1,11 @@
+package vm
+
+import "github.com/wanghongfei/mini-jvm/vm/class"
+
+// 虚拟机内置的类, classpath和jar中都找不到时使用;
+// 字节码由classBuilder在内存中生成, 方法一般是native的, 由go实现
+var builtinClasses = map[string]func() *class.DefFile{
+	executorServiceClassName: newExecutorServiceClass,
+	futureClassName:          newFutureClass,
+	probeClassName:           newProbeClass,
+}
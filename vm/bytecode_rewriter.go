@@ -0,0 +1,518 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 改写后的方法在入口调用此内置类的enter(I)V, 参数是探针编号
+const probeClassName = "cn/minijvm/agent/Probe"
+
+// 插入到方法入口的字节数; 是4的倍数, tableswitch和lookupswitch的padding不需要调整
+const probeCodeLength = 8
+
+// 改写规则的动作
+const (
+	// 每次进入方法输出一行, 包括线程和参数
+	RewriteLog = iota + 1
+	// 统计进入方法的次数, 见Rewriter.Counts()
+	RewriteCount
+	// 每次进入方法暂停Delay, 用于复现超时和竞争
+	RewriteDelay
+)
+
+// 一条改写规则, 加载类时匹配的方法在入口插入探针
+type RewriteRule struct {
+	Action int
+	// 类全名, 或者以.*结尾的包名前缀(包括子包), 同ClassPolicy
+	ClassPattern string
+	// 方法名, 可以使用path.Match的通配符, 如get*; *匹配所有方法, 包括<init>和<clinit>
+	MethodPattern string
+	// RewriteDelay每次暂停的时间
+	Delay time.Duration
+}
+
+// 解析 动作:类全名.方法名, 动作为log, count或delay=时长, 如log:com.fh.*.run, delay=20ms:com.fh.Dao.query
+func ParseRewriteRule(spec string) (*RewriteRule, error) {
+	spec = strings.TrimSpace(spec)
+	ix := strings.Index(spec, ":")
+	if ix < 0 {
+		return nil, fmt.Errorf("invalid rewrite rule '%s', expect action:class.method", spec)
+	}
+	action, target := spec[:ix], spec[ix + 1:]
+
+	rule := new(RewriteRule)
+	switch {
+	case "log" == action:
+		rule.Action = RewriteLog
+	case "count" == action:
+		rule.Action = RewriteCount
+	case strings.HasPrefix(action, "delay="):
+		delay, err := time.ParseDuration(strings.TrimPrefix(action, "delay="))
+		if nil != err || delay < 0 {
+			return nil, fmt.Errorf("invalid delay in rewrite rule '%s'", spec)
+		}
+		rule.Action = RewriteDelay
+		rule.Delay = delay
+	default:
+		return nil, fmt.Errorf("invalid rewrite action '%s', expect log, count or delay=duration", action)
+	}
+
+	dot := strings.LastIndex(target, ".")
+	if dot <= 0 || dot == len(target) - 1 {
+		return nil, fmt.Errorf("invalid rewrite rule '%s', expect action:class.method", spec)
+	}
+	rule.ClassPattern = strings.ReplaceAll(target[:dot], "/", ".")
+	rule.MethodPattern = target[dot + 1:]
+	if _, err := path.Match(rule.MethodPattern, ""); nil != err {
+		return nil, fmt.Errorf("invalid method pattern in rewrite rule '%s': %w", spec, err)
+	}
+
+	return rule, nil
+}
+
+func (r *RewriteRule) String() string {
+	action := map[int]string{RewriteLog: "log", RewriteCount: "count"}[r.Action]
+	if RewriteDelay == r.Action {
+		action = "delay=" + r.Delay.String()
+	}
+
+	return action + ":" + r.ClassPattern + "." + r.MethodPattern
+}
+
+func (r *RewriteRule) matches(className string, methodName string) bool {
+	if !matchClassPattern(r.ClassPattern, strings.ReplaceAll(className, "/", ".")) {
+		return false
+	}
+	ok, _ := path.Match(r.MethodPattern, methodName)
+	return ok
+}
+
+// 加载类时按规则改写字节码, 设置到MiniJvm.Rewriter上生效;
+// 只改写之后加载的类, 已经加载的类不受影响
+type Rewriter struct {
+	// log的输出, 为nil时输出到宿主的标准错误输出
+	Out io.Writer
+	// 为nil时使用DefaultObjectRenderer
+	Renderer *ObjectRenderer
+
+	rules []*RewriteRule
+	// 下标是探针编号
+	probes     []*rewriteProbe
+	probesLock sync.RWMutex
+	outLock    sync.Mutex
+}
+
+// 插入到一个方法中的探针
+type rewriteProbe struct {
+	// 如com.fh.Foo.bar(I)V
+	method string
+	static bool
+	desc   string
+	rules  []*RewriteRule
+	count  int64
+}
+
+// 方法被调用的次数
+type MethodCount struct {
+	Method string
+	Count  int64
+}
+
+func NewRewriter(out io.Writer) *Rewriter {
+	return &Rewriter{Out: out}
+}
+
+// 需要在加载类之前添加
+func (r *Rewriter) Add(rules ...*RewriteRule) {
+	r.rules = append(r.rules, rules...)
+}
+
+func (r *Rewriter) Rules() []*RewriteRule {
+	return r.rules
+}
+
+// 有count规则的方法的调用次数, 从多到少排列
+func (r *Rewriter) Counts() []MethodCount {
+	r.probesLock.RLock()
+	var counts []MethodCount
+	for _, probe := range r.probes {
+		for _, rule := range probe.rules {
+			if RewriteCount == rule.Action {
+				counts = append(counts, MethodCount{Method: probe.method, Count: atomic.LoadInt64(&probe.count)})
+				break
+			}
+		}
+	}
+	r.probesLock.RUnlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Method < counts[j].Method
+	})
+
+	return counts
+}
+
+// 在匹配的方法入口插入探针, 需要在链接之前调用; native和abstract方法没有字节码, 不改写
+func (r *Rewriter) rewriteClass(def *class.DefFile) error {
+	if probeClassName == def.FullClassName || 0 == len(r.rules) {
+		return nil
+	}
+
+	var probeRef uint16
+	for _, method := range def.Methods {
+		methodName := method.String()
+		var rules []*RewriteRule
+		for _, rule := range r.rules {
+			if rule.matches(def.FullClassName, methodName) {
+				rules = append(rules, rule)
+			}
+		}
+		if 0 == len(rules) {
+			continue
+		}
+
+		codeAttr, err := findCodeAttr(method)
+		if nil != err {
+			return fmt.Errorf("java.lang.ClassFormatError: %s.%s: %w", def.FullClassName, methodName, err)
+		}
+		if nil == codeAttr {
+			continue
+		}
+
+		desc := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+		id, err := r.addProbe(&rewriteProbe{
+			method: strings.ReplaceAll(def.FullClassName, "/", ".") + "." + methodName + desc,
+			static: 0 != method.AccessFlags & accflag.Static,
+			desc:   desc,
+			rules:  rules,
+		})
+		if nil != err {
+			return err
+		}
+		// 同一个类的方法共用一个常量
+		if 0 == probeRef {
+			probeRef = (&classBuilder{def: def}).methodRef(probeClassName, "enter", "(I)V")
+		}
+
+		err = insertProbe(codeAttr, id, probeRef)
+		if nil != err {
+			return fmt.Errorf("failed to rewrite %s.%s%s: %w", def.FullClassName, methodName, desc, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Rewriter) addProbe(probe *rewriteProbe) (uint16, error) {
+	r.probesLock.Lock()
+	defer r.probesLock.Unlock()
+
+	// 编号由sipush传入
+	if len(r.probes) > math.MaxInt16 {
+		return 0, fmt.Errorf("too many rewritten methods, at most %d", math.MaxInt16 + 1)
+	}
+	r.probes = append(r.probes, probe)
+
+	return uint16(len(r.probes) - 1), nil
+}
+
+// 在字节码前面插入 sipush id; invokestatic Probe.enter(I)V; iconst_0; pop,
+// 并把异常表, 行号表, 本地变量表和StackMapTable中的pc后移
+func insertProbe(codeAttr *class.CodeAttr, id uint16, probeRef uint16) error {
+	if len(codeAttr.Code) + probeCodeLength > math.MaxUint16 {
+		return fmt.Errorf("code too large to insert probe")
+	}
+
+	prologue := []byte{
+		bcode.Sipush, byte(id >> 8), byte(id),
+		bcode.Invokestatic, byte(probeRef >> 8), byte(probeRef),
+		// 补齐到4字节
+		bcode.Iconst0, bcode.Pop,
+	}
+	codeAttr.Code = append(prologue, codeAttr.Code...)
+	codeAttr.CodeLength = uint32(len(codeAttr.Code))
+	if codeAttr.MaxStack < 1 {
+		codeAttr.MaxStack = 1
+	}
+
+	for _, entry := range codeAttr.ExceptionTable {
+		entry.StartPc += probeCodeLength
+		entry.EndPc += probeCodeLength
+		entry.HandlerPc += probeCodeLength
+	}
+
+	for ix, attr := range codeAttr.Attrs {
+		switch a := attr.(type) {
+		case *class.LineNumberAttr:
+			// 从0开始的行号同时覆盖探针, 异常栈中显示方法的第一行
+			for _, line := range a.LineNumberTable {
+				if 0 != line.StartPc {
+					line.StartPc += probeCodeLength
+				}
+			}
+
+		case *class.StackMapTableAttr:
+			info, err := shiftStackMapTable(a.Info, probeCodeLength)
+			if nil != err {
+				return err
+			}
+			codeAttr.Attrs[ix] = &class.StackMapTableAttr{Info: info}
+
+		case *class.RawAttr:
+			if "LocalVariableTable" == a.Name || "LocalVariableTypeTable" == a.Name {
+				codeAttr.Attrs[ix] = &class.RawAttr{NameIndex: a.NameIndex, Name: a.Name, Info: shiftLocalVariableTable(a.Info, probeCodeLength)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// local_variable_table: u2个数, 每项start_pc, length, name_index, descriptor_index, index各u2;
+// 从0开始的变量(参数)延长到覆盖探针
+func shiftLocalVariableTable(info []byte, shift int) []byte {
+	res := append([]byte(nil), info...)
+	for offset := 2; offset + 10 <= len(res); offset += 10 {
+		startPc := binary.BigEndian.Uint16(res[offset:])
+		if 0 == startPc {
+			binary.BigEndian.PutUint16(res[offset + 2:], binary.BigEndian.Uint16(res[offset + 2:]) + uint16(shift))
+		} else {
+			binary.BigEndian.PutUint16(res[offset:], startPc + uint16(shift))
+		}
+	}
+
+	return res
+}
+
+// 第一帧的offset_delta就是它的pc, 需要后移; 之后的帧是相对于前一帧的, 不变.
+// Uninitialized类型记录了new指令的pc, 所有帧中的都需要后移
+func shiftStackMapTable(info []byte, shift int) ([]byte, error) {
+	if len(info) < 2 {
+		return nil, fmt.Errorf("invalid StackMapTable")
+	}
+	entries := int(binary.BigEndian.Uint16(info))
+	res := append(make([]byte, 0, len(info) + 2), info[:2]...)
+	reader := &stackMapReader{info: info, pos: 2}
+
+	for ix := 0; ix < entries; ix++ {
+		frameType, err := reader.u1()
+		if nil != err {
+			return nil, err
+		}
+
+		delta := -1
+		var types int
+		switch {
+		case frameType <= 63:
+			// same_frame
+			delta = int(frameType)
+		case frameType <= 127:
+			// same_locals_1_stack_item_frame
+			delta = int(frameType) - 64
+			types = 1
+		case frameType < 247:
+			return nil, fmt.Errorf("invalid StackMapTable frame type %d", frameType)
+		}
+
+		if frameType >= 247 {
+			val, err := reader.u2()
+			if nil != err {
+				return nil, err
+			}
+			delta = int(val)
+		}
+		if 0 == ix {
+			delta += shift
+		}
+
+		// 写出帧类型和offset_delta, 加上shift后超过63时改用extended形式
+		switch {
+		case frameType <= 63 && delta <= 63:
+			res = append(res, byte(delta))
+		case frameType <= 63:
+			res = append(res, 251, byte(delta >> 8), byte(delta))
+		case frameType <= 127 && delta <= 63:
+			res = append(res, byte(64 + delta))
+		case frameType <= 127:
+			res = append(res, 247, byte(delta >> 8), byte(delta))
+		default:
+			res = append(res, frameType, byte(delta >> 8), byte(delta))
+		}
+
+		switch {
+		case 247 == frameType:
+			// same_locals_1_stack_item_frame_extended
+			types = 1
+		case frameType >= 252 && frameType <= 254:
+			// append_frame
+			types = int(frameType) - 251
+		case 255 == frameType:
+			// full_frame: locals和stack前各有一个u2个数
+			for _, part := range []string{"locals", "stack"} {
+				count, err := reader.u2()
+				if nil != err {
+					return nil, fmt.Errorf("invalid StackMapTable full_frame %s: %w", part, err)
+				}
+				res = append(res, byte(count >> 8), byte(count))
+				if res, err = reader.copyTypes(res, int(count), shift); nil != err {
+					return nil, err
+				}
+			}
+		}
+
+		if res, err = reader.copyTypes(res, types, shift); nil != err {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+type stackMapReader struct {
+	info []byte
+	pos  int
+}
+
+func (r *stackMapReader) u1() (byte, error) {
+	if r.pos >= len(r.info) {
+		return 0, fmt.Errorf("invalid StackMapTable: %w", io.ErrUnexpectedEOF)
+	}
+	r.pos++
+	return r.info[r.pos - 1], nil
+}
+
+func (r *stackMapReader) u2() (uint16, error) {
+	if r.pos + 2 > len(r.info) {
+		return 0, fmt.Errorf("invalid StackMapTable: %w", io.ErrUnexpectedEOF)
+	}
+	r.pos += 2
+	return binary.BigEndian.Uint16(r.info[r.pos - 2:]), nil
+}
+
+// 复制count个verification_type_info到res; Object(7)带常量池下标, Uninitialized(8)带new指令的pc
+func (r *stackMapReader) copyTypes(res []byte, count int, shift int) ([]byte, error) {
+	for ix := 0; ix < count; ix++ {
+		tag, err := r.u1()
+		if nil != err {
+			return nil, err
+		}
+		res = append(res, tag)
+		if 7 != tag && 8 != tag {
+			continue
+		}
+
+		val, err := r.u2()
+		if nil != err {
+			return nil, err
+		}
+		if 8 == tag {
+			val += uint16(shift)
+		}
+		res = append(res, byte(val >> 8), byte(val))
+	}
+
+	return res, nil
+}
+
+// 探针被执行, frame是改写后的方法的栈帧, 此时本地变量中只有参数
+func (r *Rewriter) enter(jvm *MiniJvm, id int, frame *MethodStackFrame) error {
+	r.probesLock.RLock()
+	var probe *rewriteProbe
+	if id >= 0 && id < len(r.probes) {
+		probe = r.probes[id]
+	}
+	r.probesLock.RUnlock()
+	if nil == probe {
+		return fmt.Errorf("unknown rewrite probe %d", id)
+	}
+
+	for _, rule := range probe.rules {
+		switch rule.Action {
+		case RewriteLog:
+			r.log(probe, frame)
+
+		case RewriteCount:
+			atomic.AddInt64(&probe.count, 1)
+
+		case RewriteDelay:
+			timer := time.NewTimer(rule.Delay)
+			ctx := jvm.hostContext()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return cancelledError("rewrite delay", ctx.Err())
+			}
+		}
+	}
+
+	return nil
+}
+
+// 如 [rewrite] thread 1 enter com.fh.Foo.bar(ILjava/lang/String;)V args [1, "a"]
+func (r *Rewriter) log(probe *rewriteProbe, frame *MethodStackFrame) {
+	renderer := r.Renderer
+	if nil == renderer {
+		renderer = DefaultObjectRenderer
+	}
+
+	argTypes, _ := class.ParseMethodDescriptor(probe.desc)
+	args := make([]string, 0, len(argTypes))
+	slot := 0
+	if !probe.static {
+		slot = 1
+	}
+	for _, argType := range argTypes {
+		if slot >= len(frame.localVariablesTable) {
+			break
+		}
+		args = append(args, renderer.Render(frame.getLocalTableAt(slot)))
+		slot++
+		if "J" == argType || "D" == argType {
+			slot++
+		}
+	}
+
+	out := r.Out
+	if nil == out {
+		out = hostStderr
+	}
+	r.outLock.Lock()
+	defer r.outLock.Unlock()
+	fmt.Fprintf(out, "[rewrite] thread %d enter %s args [%s]\n", frame.ThreadID(), probe.method, strings.Join(args, ", "))
+}
+
+func newProbeClass() *class.DefFile {
+	b := newClassBuilder(probeClassName, "java/lang/Object")
+	b.method(uint16(accflag.Public | accflag.Static | accflag.Native), "enter", "(I)V", 0, 0, nil)
+
+	return b.def
+}
+
+// 改写后的方法入口调用, 参数是探针编号
+func ProbeEnter(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	if nil == jvm.Rewriter {
+		return nil
+	}
+
+	if err := jvm.Rewriter.enter(jvm, args[2].(int), args[3].(*MethodStackFrame)); nil != err {
+		return err
+	}
+	return nil
+}
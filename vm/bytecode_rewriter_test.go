@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+// static int calc(long y, int x) { switch (x) { case 0: return 1; case 1: return 2; default: return x; } }
+func newRewriteTestClass() *class.DefFile {
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(accflag.Static, "calc", "(JI)I", 1, 3, newCodeAssembler().emit(bcode.Iload2).
+		tableswitch(0, "default", "zero", "one").
+		label("zero").emit(bcode.Iconst1, bcode.Ireturn).
+		label("one").emit(bcode.Iconst2, bcode.Ireturn).
+		label("default").emit(bcode.Iload2, bcode.Ireturn))
+	b.method(accflag.Static, "other", "()I", 1, 0, newCodeAssembler().emit(bcode.Iconst0, bcode.Ireturn))
+
+	codeAttr := b.def.Methods[0].Attrs[0].(*class.CodeAttr)
+	codeAttr.ExceptionTable = []*class.ExceptionTable{{StartPc: 0, EndPc: 24, HandlerPc: 28}}
+	codeAttr.Attrs = []interface{}{&class.LineNumberAttr{LineNumberTable: []*class.LineNumberInfo{
+		{StartPc: 0, LineNumber: 10}, {StartPc: 24, LineNumber: 11}, {StartPc: 28, LineNumber: 12},
+	}}}
+
+	return b.def
+}
+
+func TestRewriter(t *testing.T) {
+	var rules []*RewriteRule
+	for _, spec := range []string{"log:com.fh.Calc.calc", "count:com.fh.*.c*", "delay=0s:com/fh/Calc.*"} {
+		rule, err := ParseRewriteRule(spec)
+		if nil != err {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	if "delay=0s:com.fh.Calc.*" != rules[2].String() {
+		t.Fatalf("unexpected rule %s", rules[2])
+	}
+
+	var out bytes.Buffer
+	rewriter := NewRewriter(&out)
+	rewriter.Add(rules...)
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.NativeMethodTable = newBuiltinNativeMethodTable()
+	jvm.Rewriter = rewriter
+	def := newRewriteTestClass()
+	if err := jvm.MethodArea.DefineClass(def); nil != err {
+		t.Fatal(err)
+	}
+
+	// 探针插在入口, 异常表和行号表后移, 从0开始的行号不变
+	calc := def.Methods[0].Attrs[0].(*class.CodeAttr)
+	if bcode.Sipush != calc.Code[0] || bcode.Invokestatic != calc.Code[3] || bcode.Tableswitch != calc.Code[9] {
+		t.Fatalf("unexpected code % x", calc.Code)
+	}
+	if entry := calc.ExceptionTable[0]; 8 != entry.StartPc || 32 != entry.EndPc || 36 != entry.HandlerPc {
+		t.Fatalf("unexpected exception table %+v", entry)
+	}
+	lines := calc.Attrs[0].(*class.LineNumberAttr).LineNumberTable
+	if 0 != lines[0].StartPc || 32 != lines[1].StartPc || 36 != lines[2].StartPc {
+		t.Fatalf("unexpected line numbers %+v, %+v, %+v", lines[0], lines[1], lines[2])
+	}
+	if other := def.Methods[1].Attrs[0].(*class.CodeAttr); bcode.Sipush != other.Code[0] {
+		t.Fatalf("other should be rewritten by the delay rule, got % x", other.Code)
+	}
+
+	for _, c := range []struct {
+		x, expect int
+	}{
+		{0, 1}, {1, 2}, {5, 5},
+	} {
+		frame := newMethodStackFrame(3, 0)
+		frame.opStack.Push(int64(7))
+		frame.opStack.Push(c.x)
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "calc", "(JI)I", frame, false); nil != err {
+			t.Fatal(err)
+		}
+		if ret, _ := frame.opStack.Pop(); c.expect != ret {
+			t.Errorf("x = %d: expect %d, got %v", c.x, c.expect, ret)
+		}
+	}
+
+	logs := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if 3 != len(logs) || !strings.HasPrefix(logs[0], "[rewrite] thread ") ||
+		!strings.HasSuffix(logs[0], " enter com.fh.Calc.calc(JI)I args [7, 0]") || !strings.HasSuffix(logs[2], "args [7, 5]") {
+		t.Fatalf("unexpected log\n%s", out.String())
+	}
+	if counts := rewriter.Counts(); 1 != len(counts) || "com.fh.Calc.calc(JI)I" != counts[0].Method || 3 != counts[0].Count {
+		t.Fatalf("unexpected counts %+v", counts)
+	}
+
+	// 延迟可以被宿主取消
+	rule, _ := ParseRewriteRule("delay=1h:com.fh.Calc.other")
+	jvm, _ = newClassInitTestJvm()
+	jvm.NativeMethodTable = newBuiltinNativeMethodTable()
+	jvm.Rewriter = NewRewriter(nil)
+	jvm.Rewriter.Add(rule)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jvm.Context = ctx
+	def = newRewriteTestClass()
+	if err := jvm.MethodArea.DefineClass(def); nil != err {
+		t.Fatal(err)
+	}
+	err = jvm.ExecutionEngine.ExecuteWithFrame(def, "other", "()I", newMethodStackFrame(1, 0), false)
+	var cancelled *ExecutionCancelledError
+	if !errors.As(err, &cancelled) {
+		t.Fatalf("expect cancelled error, got %v", err)
+	}
+
+	for _, spec := range []string{"com.fh.Calc.calc", "trace:com.fh.Calc.calc", "delay=x:com.fh.Calc.calc", "log:calc", "log:com.fh.Calc.[", "log:com.fh.Calc."} {
+		if _, err := ParseRewriteRule(spec); nil == err {
+			t.Errorf("%s: expect parse error", spec)
+		}
+	}
+}
+
+func TestShiftStackMapTable(t *testing.T) {
+	info := []byte{
+		0, 4,
+		// same_frame, pc 10
+		10,
+		// append_frame, 1个Uninitialized(new在pc 3)
+		252, 0, 5, 8, 0, 3,
+		// same_locals_1_stack_item_frame, Object
+		64 + 2, 7, 0, 9,
+		// full_frame, locals [int], stack [Uninitialized(pc 3)]
+		255, 0, 1, 0, 1, 1, 0, 1, 8, 0, 3,
+	}
+	shifted, err := shiftStackMapTable(info, 8)
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := []byte{0, 4, 18, 252, 0, 5, 8, 0, 11, 66, 7, 0, 9, 255, 0, 1, 0, 1, 1, 0, 1, 8, 0, 11}
+	if !bytes.Equal(expect, shifted) {
+		t.Fatalf("expect % x, got % x", expect, shifted)
+	}
+	if 10 != info[2] {
+		t.Fatal("original info should not be modified")
+	}
+
+	// 超过63时改用extended形式
+	for _, c := range []struct {
+		info, expect []byte
+	}{
+		{[]byte{0, 1, 60}, []byte{0, 1, 251, 0, 68}},
+		{[]byte{0, 1, 64 + 60, 1}, []byte{0, 1, 247, 0, 68, 1}},
+		{[]byte{0, 1, 251, 1, 0}, []byte{0, 1, 251, 1, 8}},
+	} {
+		if shifted, err := shiftStackMapTable(c.info, 8); nil != err || !bytes.Equal(c.expect, shifted) {
+			t.Errorf("% x: expect % x, got % x, %v", c.info, c.expect, shifted, err)
+		}
+	}
+
+	if _, err := shiftStackMapTable([]byte{0, 1, 200}, 8); nil == err {
+		t.Fatal("expect error for reserved frame type")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
 	"io"
+	"sync"
 )
 
 func (c *DefFile) ReadAttr(reader io.Reader) (interface{}, error) {
@@ -59,19 +61,34 @@ func (c *DefFile) ReadAttr(reader io.Reader) (interface{}, error) {
 
 		return srcAttr, nil
 
-	} else if "StackMapTable" == attrName ||
-		"Signature" == attrName ||
+	} else if "StackMapTable" == attrName {
+		// 内容不解析, 只记录存在, 没有StackMapTable的方法由verify做结构检查
+		info, err := readAttrInfo(reader)
+		if nil != err {
+			return nil, fmt.Errorf("failed to skip StackMapTable attr: %w", err)
+		}
+
+		return &StackMapTableAttr{Info: info}, nil
+
+	} else if "Signature" == attrName ||
 		"Deprecated" == attrName ||
 		"RuntimeVisibleAnnotations" == attrName ||
-		"Exceptions" == attrName ||
-		"BootstrapMethods" == attrName {
+		"Exceptions" == attrName {
 		// 跳过此属性
-		err := c.skipAttr(reader)
+		info, err := readAttrInfo(reader)
 		if nil != err {
-			return nil, fmt.Errorf("failed to skip StackMapTable attr: %w", err)
+			return nil, fmt.Errorf("failed to skip %s attr: %w", attrName, err)
+		}
+
+		return &RawAttr{NameIndex: nameIndex, Name: attrName, Info: info}, nil
+
+	} else if "BootstrapMethods" == attrName {
+		bootstrapAttr, err := ReadBootstrapMethodsAttr(reader)
+		if nil != err {
+			return nil, fmt.Errorf("failed to read BootstrapMethods attr: %w", err)
 		}
 
-		return struct{}{}, nil
+		return bootstrapAttr, nil
 
 	} else if "InnerClasses" == attrName {
 		innerAttr, err := ReadInnerClassAttr(reader)
@@ -82,29 +99,51 @@ func (c *DefFile) ReadAttr(reader io.Reader) (interface{}, error) {
 		return innerAttr, nil
 	}
 
+	if nil != c.onUnknownAttr {
+		if err := c.onUnknownAttr(attrName); nil != err {
+			return nil, err
+		}
+
+		info, err := readAttrInfo(reader)
+		if nil != err {
+			return nil, fmt.Errorf("failed to skip %s attr: %w", attrName, err)
+		}
+
+		return &RawAttr{NameIndex: nameIndex, Name: attrName, Info: info}, nil
+	}
+
 	return nil, fmt.Errorf("unsupported attr type '%s'", attrName)
 }
 
-// 从常量池中取出常量
-func (c *DefFile) GetFromConstPool(index int) (interface{}, error) {
-	if index >= len(c.ConstPool) {
-		return nil, errors.New("cp index out of bound")
-	}
+// 解释器不使用的属性, 不解析内容, 只保存原始字节, 重新生成class文件时原样输出
+type RawAttr struct {
+	NameIndex uint16
+	Name string
+	// 属性长度之后的内容
+	Info []byte
+}
 
-	return c.ConstPool[index], nil
+func (r *RawAttr) String() string {
+	return r.Name
 }
 
-func (c *DefFile) skipAttr(reader io.Reader) error {
+// 读出属性长度和之后的内容, 不复制
+func readAttrInfo(reader io.Reader) ([]byte, error) {
 	attrLen, err := utils.ReadInt32(reader)
 	if nil != err {
-		return fmt.Errorf("failed to read skip len: %w", err)
+		return nil, fmt.Errorf("failed to read attr len: %w", err)
 	}
 
-	for ix := 0; ix < int(attrLen); ix++ {
-		utils.ReadInt8(reader)
+	return readBytes(reader, int(attrLen))
+}
+
+// 从常量池中取出常量
+func (c *DefFile) GetFromConstPool(index int) (interface{}, error) {
+	if index >= c.ConstPool.Len() {
+		return nil, errors.New("cp index out of bound")
 	}
 
-	return nil
+	return c.ConstPool.At(uint16(index)), nil
 }
 
 // code属性
@@ -124,12 +163,46 @@ type CodeAttr struct {
 
 	AttrCount uint16
 	Attrs []interface{}
+
+	// 链接时预解码得到的指令边界和跳转目标, 链接之前为nil
+	JumpMap *bcode.JumpMap
+	linkOnce sync.Once
+	linkErr error
 }
 
 func (c *CodeAttr) String() string {
 	return "Code"
 }
 
+// 是否带有StackMapTable属性, Java 6之前的class文件以及没有分支的方法没有此属性
+func (c *CodeAttr) HasStackMapTable() bool {
+	for _, attr := range c.Attrs {
+		if _, ok := attr.(*StackMapTableAttr); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StackMapTable属性, 只记录存在, 内容不解析
+type StackMapTableAttr struct {
+	Info []byte
+}
+
+func (s *StackMapTableAttr) String() string {
+	return "StackMapTable"
+}
+
+// 只执行一次链接, 并发调用时等待第一次完成, 之后返回第一次的结果
+func (c *CodeAttr) LinkOnce(link func() error) error {
+	c.linkOnce.Do(func() {
+		c.linkErr = link()
+	})
+
+	return c.linkErr
+}
+
 type ExceptionTable struct {
 	StartPc uint16
 	EndPc uint16
@@ -514,3 +587,61 @@ func ReadSourceFileAttr(reader io.Reader) (*SourceFileAttr, error) {
 		SourceFileIndex: idx,
 	}, nil
 }
+
+// invokedynamic引用的引导方法表
+type BootstrapMethodsAttr struct {
+	Length uint32
+	Methods []*BootstrapMethod
+}
+
+type BootstrapMethod struct {
+	// 指向MethodHandleConst
+	MethodRef uint16
+	// 静态参数在常量池中的下标
+	Args []uint16
+}
+
+func (b *BootstrapMethodsAttr) String() string {
+	return "BootstrapMethods"
+}
+
+func ReadBootstrapMethodsAttr(reader io.Reader) (*BootstrapMethodsAttr, error) {
+	length, err := utils.ReadInt32(reader)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load length: %w", err)
+	}
+
+	count, err := utils.ReadInt16(reader)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load num_bootstrap_methods: %w", err)
+	}
+
+	methods := make([]*BootstrapMethod, 0, count)
+	for ix := 0; ix < int(count); ix++ {
+		ref, err := utils.ReadInt16(reader)
+		if nil != err {
+			return nil, fmt.Errorf("failed to load bootstrap_method_ref: %w", err)
+		}
+
+		argCount, err := utils.ReadInt16(reader)
+		if nil != err {
+			return nil, fmt.Errorf("failed to load num_bootstrap_arguments: %w", err)
+		}
+
+		args := make([]uint16, 0, argCount)
+		for jx := 0; jx < int(argCount); jx++ {
+			arg, err := utils.ReadInt16(reader)
+			if nil != err {
+				return nil, fmt.Errorf("failed to load bootstrap_arguments: %w", err)
+			}
+			args = append(args, arg)
+		}
+
+		methods = append(methods, &BootstrapMethod{MethodRef: ref, Args: args})
+	}
+
+	return &BootstrapMethodsAttr{
+		Length:  length,
+		Methods: methods,
+	}, nil
+}
@@ -0,0 +1,154 @@
+package class
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// 紧凑的常量池;
+// 解析class时只记录每个常量的tag和内容在class文件字节(arena)中的偏移量, 常量第一次被访问时才解码成对应的结构体并缓存,
+// 大部分常量从不被访问, 不需要为每个常量分配一个结构体
+type ConstPool struct {
+	// 每个常量的tag, 下标0和long/double之后的占位为0
+	tags []uint8
+	// 常量内容(tag之后的字节)在arena中的偏移量
+	offsets []uint32
+	// class文件的原始字节, UTF-8常量直接引用其中的数据
+	arena []byte
+
+	// 已经解码的常量, key: 下标; 只有被访问过的常量占用空间
+	decoded map[uint16]interface{}
+	// 解码时加写锁, 保证同一个常量只解码一次, 不同线程拿到同一个结构体
+	decodedLock sync.RWMutex
+}
+
+// 用已经解码的常量创建常量池, items从下标1开始存放, 用于在内存中构造class
+func NewConstPool(items ...interface{}) *ConstPool {
+	p := &ConstPool{
+		tags:    make([]uint8, 1, len(items) + 1),
+		offsets: make([]uint32, 1, len(items) + 1),
+	}
+	for _, item := range items {
+		p.Add(item)
+	}
+
+	return p
+}
+
+// 追加一个已经解码的常量, 返回它的下标
+func (p *ConstPool) Add(item interface{}) uint16 {
+	p.tags = append(p.tags, 0)
+	p.offsets = append(p.offsets, 0)
+	index := uint16(len(p.tags) - 1)
+	if nil != item {
+		p.decodedLock.Lock()
+		if nil == p.decoded {
+			p.decoded = make(map[uint16]interface{})
+		}
+		p.decoded[index] = item
+		p.decodedLock.Unlock()
+	}
+
+	return index
+}
+
+// 常量池长度, 包括下标0
+func (p *ConstPool) Len() int {
+	return len(p.tags)
+}
+
+// 取出下标处的常量, 下标越界, 是占位元素或者解码失败时返回nil; 需要知道失败原因时使用Get
+func (p *ConstPool) At(index uint16) interface{} {
+	item, _ := p.Get(index)
+	return item
+}
+
+// 取出下标处的常量, 第一次访问时解码; 下标越界或者是占位元素时返回nil, 解码失败时返回错误
+func (p *ConstPool) Get(index uint16) (interface{}, error) {
+	if 0 == index || int(index) >= len(p.tags) {
+		return nil, nil
+	}
+
+	p.decodedLock.RLock()
+	item, ok := p.decoded[index]
+	p.decodedLock.RUnlock()
+	if ok {
+		return item, nil
+	}
+	if 0 == p.tags[index] {
+		return nil, nil
+	}
+
+	p.decodedLock.Lock()
+	defer p.decodedLock.Unlock()
+
+	if item, ok := p.decoded[index]; ok {
+		return item, nil
+	}
+	item, err := readConst(bytes.NewBuffer(p.arena[p.offsets[index]:]), p.tags[index])
+	if nil != err {
+		return nil, fmt.Errorf("failed to decode constant #%d: %w", index, err)
+	}
+	if nil == p.decoded {
+		p.decoded = make(map[uint16]interface{})
+	}
+	p.decoded[index] = item
+
+	return item, nil
+}
+
+// 扫描常量池, 只检查每个常量的长度, 不解码;
+// buf为整个class文件, start为常量池第一个常量的位置, 返回常量池结束的位置
+func scanConstPool(buf []byte, start int, cpCount int) (*ConstPool, int, error) {
+	p := &ConstPool{
+		tags:    make([]uint8, 1, cpCount + 1),
+		offsets: make([]uint32, 1, cpCount + 1),
+		arena:   buf,
+	}
+
+	pos := start
+	for ix := 0; ix < cpCount; ix++ {
+		if pos >= len(buf) {
+			return nil, 0, fmt.Errorf("constant #%d: unexpected end of class file", ix + 1)
+		}
+		tag := buf[pos]
+		pos++
+
+		var size int
+		switch tag {
+		case 1:
+			if pos + 2 > len(buf) {
+				return nil, 0, fmt.Errorf("constant #%d: unexpected end of class file", ix + 1)
+			}
+			size = 2 + int(binary.BigEndian.Uint16(buf[pos:]))
+		case 7, 8, 16:
+			size = 2
+		case 15:
+			size = 3
+		case 3, 4, 9, 10, 11, 12, 18:
+			size = 4
+		case 5, 6:
+			size = 8
+		default:
+			return nil, 0, fmt.Errorf("invalid cp tag %d", tag)
+		}
+		if pos + size > len(buf) {
+			return nil, 0, fmt.Errorf("constant #%d: unexpected end of class file", ix + 1)
+		}
+
+		p.tags = append(p.tags, tag)
+		p.offsets = append(p.offsets, uint32(pos))
+		pos += size
+
+		// long和double占两个位置, 第二个位置不可用
+		if 5 == tag || 6 == tag {
+			p.tags = append(p.tags, 0)
+			p.offsets = append(p.offsets, 0)
+			ix++
+		}
+	}
+
+	return p, pos, nil
+}
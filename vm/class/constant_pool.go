@@ -219,8 +219,8 @@ func ReadUtf8InfoConst(reader io.Reader, tag uint8) (*Utf8InfoConst, error) {
 	}
 	cpInfo.Length = length
 
-	utf8Buf := make([]byte, length)
-	_, err = reader.Read(utf8Buf)
+	// 从class文件的字节中直接切出, 不复制
+	utf8Buf, err := readBytes(reader, int(length))
 	if nil != err {
 		return nil, err
 	}
@@ -2,10 +2,12 @@ package class
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
 	"io"
+	"io/ioutil"
 	"sync"
 )
 
@@ -18,8 +20,8 @@ type DefFile struct {
 
 	// 常量池数量
 	ConstPoolCount uint16
-	// 常量池
-	ConstPool []interface{}
+	// 常量池, 通过At()按下标访问
+	ConstPool *ConstPool
 
 	// 访问标记
 	AccessFlag uint16
@@ -52,14 +54,22 @@ type DefFile struct {
 	// 保存static字段
 	// key: 字段名
 	ParsedStaticFields map[string]*ObjectField
+	// 保护ParsedStaticFields, 多个线程会同时读写static字段
+	staticFieldsLock sync.RWMutex
 
 	// 锁, synchronized使用
-	Monitor sync.Mutex
+	Monitor Monitor
 
 	// 虚方法表
 	VTable []*VTableItem
+
+	// 遇到不认识的属性时调用, 见LoadClassBufWith
+	onUnknownAttr UnknownAttrHandler
 }
 
+// 遇到不认识的属性时调用, 参数为属性名; 返回nil时跳过该属性继续解析, 返回错误时解析失败
+type UnknownAttrHandler func(attrName string) error
+
 type VTableItem struct {
 	MethodName string
 	MethodDescriptor string
@@ -69,8 +79,8 @@ type VTableItem struct {
 }
 
 func (c *DefFile) ExtractFullClassName() string {
-	classInfo := c.ConstPool[c.ThisClass].(*ClassInfoConstInfo)
-	return c.ConstPool[classInfo.FullClassNameIndex].(*Utf8InfoConst).String()
+	classInfo := c.ConstPool.At(c.ThisClass).(*ClassInfoConstInfo)
+	return c.ConstPool.At(classInfo.FullClassNameIndex).(*Utf8InfoConst).String()
 }
 
 func (c *DefFile) String() string {
@@ -83,22 +93,55 @@ type Loader interface {
 	LoadClass(fullyQualifiedName string) (*DefFile, error)
 }
 
+// 只加载类的结构, 不等待其他线程中的<clinit>; Loader同时实现此接口时, 创建对象按它加载父类和String,
+// 这样<clinit>中创建本类子类的对象时不会等待自己
+type Resolver interface {
+	ResolveClass(fullyQualifiedName string) (*DefFile, error)
+}
+
+// 加载只需要结构(字段布局)的类
+func resolveStructure(cl Loader, fullyQualifiedName string) (*DefFile, error) {
+	if resolver, ok := cl.(Resolver); ok {
+		return resolver.ResolveClass(fullyQualifiedName)
+	}
+
+	return cl.LoadClass(fullyQualifiedName)
+}
+
 const JVM_CLASS_FILE_MAGIC_NUMBER = 0xCAFEBABE
 
-// 从文件中加载class
+// Android dex文件开头的"dex\n"
+const DEX_FILE_MAGIC_NUMBER = 0x6465780A
+
+// 从文件中加载class;
+// 单个class文件很小, 直接读入内存, 不使用mmap: 映射至少占用一页, 类不会被卸载, 映射也无法释放
 func LoadClassFile(classPath string) (*DefFile, error) {
-	classBuf, err := utils.ReadAllFromFile(classPath)
+	return LoadClassFileWith(classPath, nil)
+}
+
+// 与LoadClassFile相同, 遇到不认识的属性时调用onUnknownAttr, 为nil时解析失败
+func LoadClassFileWith(classPath string, onUnknownAttr UnknownAttrHandler) (*DefFile, error) {
+	buf, err := ioutil.ReadFile(classPath)
 	if nil != err {
 		return nil, fmt.Errorf("failed to read class file, %w", err)
 	}
 
-	return LoadClassBuf(classBuf)
+	return LoadClassBufWith(buf, onUnknownAttr)
 }
 
-// 从字节路中加载class
+// 从字节路中加载class;
+// UTF-8常量和属性表的原始字节直接引用buf, 加载之后不能再修改buf
 func LoadClassBuf(buf []byte) (*DefFile, error) {
+	return LoadClassBufWith(buf, nil)
+}
+
+// 与LoadClassBuf相同, 遇到不认识的属性时调用onUnknownAttr, 为nil时解析失败;
+// 方法的属性可能在链接时才解码, 所以onUnknownAttr会一直保留在DefFile中
+func LoadClassBufWith(buf []byte, onUnknownAttr UnknownAttrHandler) (*DefFile, error) {
 	defFile := new(DefFile)
-	bufReader := bytes.NewReader(buf)
+	defFile.onUnknownAttr = onUnknownAttr
+	// bytes.Buffer可以通过Next()不复制地切出数据, 见readBytes
+	bufReader := bytes.NewBuffer(buf)
 
 	var err error
 
@@ -108,6 +151,9 @@ func LoadClassBuf(buf []byte) (*DefFile, error) {
 		return nil, fmt.Errorf("failed to load magic number, %w", err)
 	}
 	if defFile.MagicNumber != JVM_CLASS_FILE_MAGIC_NUMBER {
+		if DEX_FILE_MAGIC_NUMBER == defFile.MagicNumber {
+			return nil, errors.New("not a JVM class file but Android dex bytecode, convert it with dex2jar first")
+		}
 		return nil, errors.New("not a JVM class file")
 	}
 
@@ -128,11 +174,14 @@ func LoadClassBuf(buf []byte) (*DefFile, error) {
 		return nil, fmt.Errorf("failed to load const pool count, %w", err)
 	}
 
-	// 常量池
-	defFile.ConstPool, err = readConstPool(bufReader, int(defFile.ConstPoolCount) - 1)
+	// 常量池, 只记录位置, 使用时再解码
+	cpStart := len(buf) - bufReader.Len()
+	constPool, cpEnd, err := scanConstPool(buf, cpStart, int(defFile.ConstPoolCount) - 1)
 	if nil != err {
 		return nil, fmt.Errorf("failed to load const pool, %w", err)
 	}
+	defFile.ConstPool = constPool
+	bufReader.Next(cpEnd - cpStart)
 
 	// 访问标记
 	defFile.AccessFlag, err = utils.ReadInt16(bufReader)
@@ -236,141 +285,40 @@ func LoadClassBuf(buf []byte) (*DefFile, error) {
 }
 
 
-// 解析常量池
-func readConstPool(bufReader io.Reader, cpCount int) ([]interface{}, error) {
-	cpInfos := make([]interface{}, 1, cpCount + 1)
-
-	for ix := 0; ix < cpCount; ix++ {
-		// 读取一个常量
-
-		// 读取tag
-		tag, err := utils.ReadInt8(bufReader)
-		// fmt.Printf("#%v, tag = %v\n", ix + 1, tag)
-		if nil != err {
-			return nil, err
-		}
-
-		// 根据tag判断常量类型
-		switch tag {
-		case 1:
-			info, err := ReadUtf8InfoConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 3:
-			info, err := ReadIntegerInfoConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 4:
-			info, err := ReadFloatConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-
-		case 5:
-			info, err := ReadLongConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-			// All 8-byte constants take up two entries in the constant_pool table of the class file.
-			// If a CONSTANT_Long_info or CONSTANT_Double_info structure is the item in the constant_pool table at index n,
-			// then the next usable item in the pool is located at index n+2.
-			cpInfos = append(cpInfos, struct{}{}) // 加一个空的元素
-			ix++
-
-		case 6:
-			info, err := ReadDoubleConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-			// All 8-byte constants take up two entries in the constant_pool table of the class file.
-			// If a CONSTANT_Long_info or CONSTANT_Double_info structure is the item in the constant_pool table at index n,
-			// then the next usable item in the pool is located at index n+2.
-			cpInfos = append(cpInfos, struct{}{}) // 加一个空的元素
-			ix++
-
-		case 7:
-			info, err := ReadClassInfoConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 8:
-			info, err := ReadStringInfoConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 9:
-			info, err := ReadFieldRefConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 10:
-			info, err := ReadMethodRefConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 11:
-			info, err := ReadInterfaceMethodConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 12:
-			info, err := ReadNameAndTypeConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 15:
-			info, err := ReadMethodHandleConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 16:
-			info, err := ReadMethodTypeConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-		case 18:
-			info, err := ReadInvokeDynamicConst(bufReader, tag)
-			if nil != err {
-				return nil, err
-			}
-			cpInfos = append(cpInfos, info)
-
-
-
-		default:
-			return nil, fmt.Errorf("invalid cp tag %d", tag)
-		}
+// 根据tag读取一个常量
+func readConst(bufReader io.Reader, tag uint8) (interface{}, error) {
+	switch tag {
+	case 1:
+		return ReadUtf8InfoConst(bufReader, tag)
+	case 3:
+		return ReadIntegerInfoConst(bufReader, tag)
+	case 4:
+		return ReadFloatConst(bufReader, tag)
+	case 5:
+		return ReadLongConst(bufReader, tag)
+	case 6:
+		return ReadDoubleConst(bufReader, tag)
+	case 7:
+		return ReadClassInfoConst(bufReader, tag)
+	case 8:
+		return ReadStringInfoConst(bufReader, tag)
+	case 9:
+		return ReadFieldRefConst(bufReader, tag)
+	case 10:
+		return ReadMethodRefConst(bufReader, tag)
+	case 11:
+		return ReadInterfaceMethodConst(bufReader, tag)
+	case 12:
+		return ReadNameAndTypeConst(bufReader, tag)
+	case 15:
+		return ReadMethodHandleConst(bufReader, tag)
+	case 16:
+		return ReadMethodTypeConst(bufReader, tag)
+	case 18:
+		return ReadInvokeDynamicConst(bufReader, tag)
 	}
 
-	return cpInfos, nil
+	return nil, fmt.Errorf("invalid cp tag %d", tag)
 }
 
 
@@ -380,14 +328,21 @@ type FieldInfo struct {
 	DescriptorIndex uint16
 
 	AttrCount uint16
+	// 解码后的属性表, 通过Attributes()读取
 	Attrs []interface{}
+	lazyAttrs
 
 	// 所在的class定义文件
 	DefFile *DefFile
 }
 
+// 属性表, 第一次调用时才解码
+func (f *FieldInfo) Attributes() ([]interface{}, error) {
+	return f.decode(f.DefFile, f.AttrCount, &f.Attrs)
+}
+
 func (f *FieldInfo) String() string {
-	return f.DefFile.ConstPool[f.NameIndex].(*Utf8InfoConst).String()
+	return f.DefFile.ConstPool.At(f.NameIndex).(*Utf8InfoConst).String()
 }
 
 func (c *DefFile) ReadFieldInfo(reader io.Reader) (*FieldInfo, error) {
@@ -418,14 +373,9 @@ func (c *DefFile) ReadFieldInfo(reader io.Reader) (*FieldInfo, error) {
 	}
 	info.AttrCount = attrCount
 
-	info.Attrs = make([]interface{}, 0, attrCount)
-	for ix := 0; ix < int(attrCount); ix++ {
-		attr, err := c.ReadAttr(reader)
-		if nil != err {
-			return nil, fmt.Errorf("failed to read attr, %w", err)
-		}
-
-		info.Attrs = append(info.Attrs, attr)
+	info.rawAttrs, err = readRawAttrs(reader, attrCount)
+	if nil != err {
+		return nil, fmt.Errorf("failed to read attr, %w", err)
 	}
 
 	return info, nil
@@ -437,14 +387,21 @@ type MethodInfo struct {
 	DescriptorIndex uint16
 
 	AttrCount uint16
+	// 解码后的属性表, 通过Attributes()读取
 	Attrs []interface{}
+	lazyAttrs
 
 	// 所在的class定义文件
 	DefFile *DefFile
 }
 
+// 属性表(包括Code), 第一次调用时才解码, 大部分从不执行的方法不会解码
+func (f *MethodInfo) Attributes() ([]interface{}, error) {
+	return f.decode(f.DefFile, f.AttrCount, &f.Attrs)
+}
+
 func (f *MethodInfo) String() string {
-	return f.DefFile.ConstPool[f.NameIndex].(*Utf8InfoConst).String()
+	return f.DefFile.ConstPool.At(f.NameIndex).(*Utf8InfoConst).String()
 }
 
 func (c *DefFile) ReadMethodInfo(reader io.Reader) (*MethodInfo, error) {
@@ -468,15 +425,10 @@ func (c *DefFile) ReadMethodInfo(reader io.Reader) (*MethodInfo, error) {
 		return nil, fmt.Errorf("failed to read attr_count, %w", err)
 	}
 
-	// 读取属性表
-	attrs := make([]interface{}, 0, attrCount)
-	for ix := 0; ix < int(attrCount); ix++ {
-		attr, err := c.ReadAttr(reader)
-		if nil != err {
-			return nil, fmt.Errorf("failed to read attr, %w", err)
-		}
-
-		attrs = append(attrs, attr)
+	// 属性表只保存原始字节, 使用时再解码
+	rawAttrs, err := readRawAttrs(reader, attrCount)
+	if nil != err {
+		return nil, fmt.Errorf("failed to read attr, %w", err)
 	}
 
 	return &MethodInfo{
@@ -485,6 +437,157 @@ func (c *DefFile) ReadMethodInfo(reader io.Reader) (*MethodInfo, error) {
 		NameIndex:       nameIndex,
 		DescriptorIndex: descriptorIndex,
 		AttrCount:       attrCount,
-		Attrs:           attrs,
+		lazyAttrs:       lazyAttrs{rawAttrs: rawAttrs},
 	}, nil
 }
+
+// 延迟解码的属性表, 加载class时只保存原始字节
+type lazyAttrs struct {
+	rawAttrs []byte
+	attrsOnce sync.Once
+	attrsErr error
+}
+
+// 解码原始字节到attrs; 直接构造(没有原始字节)时attrs已经是解码后的结果
+func (l *lazyAttrs) decode(def *DefFile, attrCount uint16, attrs *[]interface{}) ([]interface{}, error) {
+	l.attrsOnce.Do(func() {
+		if nil == l.rawAttrs {
+			return
+		}
+
+		reader := bytes.NewReader(l.rawAttrs)
+		decoded := make([]interface{}, 0, attrCount)
+		for ix := 0; ix < int(attrCount); ix++ {
+			attr, err := def.ReadAttr(reader)
+			if nil != err {
+				l.attrsErr = fmt.Errorf("failed to read attr, %w", err)
+				return
+			}
+
+			decoded = append(decoded, attr)
+		}
+
+		*attrs = decoded
+		l.rawAttrs = nil
+	})
+
+	return *attrs, l.attrsErr
+}
+
+// 读出attrCount个属性的原始字节(包括名字下标和长度), 只检查长度不解码内容
+func readRawAttrs(reader io.Reader, attrCount uint16) ([]byte, error) {
+	if 0 == attrCount {
+		return nil, nil
+	}
+
+	// 能不复制切出数据时, 所有属性在原始字节中是连续的, 直接引用这一段
+	if buf, ok := reader.(*bytes.Buffer); ok {
+		data := buf.Bytes()
+		total := 0
+		for ix := 0; ix < int(attrCount); ix++ {
+			if total + 6 > len(data) {
+				return nil, fmt.Errorf("failed to read attr header: %w", io.ErrUnexpectedEOF)
+			}
+			total += 6 + int(binary.BigEndian.Uint32(data[total + 2:]))
+		}
+
+		return readBytes(reader, total)
+	}
+
+	raw := make([]byte, 0, 64)
+	for ix := 0; ix < int(attrCount); ix++ {
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(reader, header); nil != err {
+			return nil, fmt.Errorf("failed to read attr header: %w", err)
+		}
+
+		body := make([]byte, binary.BigEndian.Uint32(header[2:]))
+		if _, err := io.ReadFull(reader, body); nil != err {
+			return nil, fmt.Errorf("failed to read attr body: %w", err)
+		}
+
+		raw = append(raw, header...)
+		raw = append(raw, body...)
+	}
+
+	return raw, nil
+}
+
+// 读出n个字节; reader是bytes.Buffer时直接返回底层数组的切片, 不复制
+func readBytes(reader io.Reader, n int) ([]byte, error) {
+	if buf, ok := reader.(*bytes.Buffer); ok {
+		if buf.Len() < n {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		data := buf.Next(n)
+		// 限制容量, 防止append覆盖后面的数据
+		return data[:n:n], nil
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(reader, data); nil != err {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// 读取static字段, 不存在时返回nil
+func (d *DefFile) GetStaticField(name string) *ObjectField {
+	d.staticFieldsLock.RLock()
+	defer d.staticFieldsLock.RUnlock()
+
+	return d.ParsedStaticFields[name]
+}
+
+// 复制所有static字段, 遍历时不需要持有锁
+func (d *DefFile) CopyStaticFields() map[string]*ObjectField {
+	d.staticFieldsLock.RLock()
+	defer d.staticFieldsLock.RUnlock()
+
+	fields := make(map[string]*ObjectField, len(d.ParsedStaticFields))
+	for name, field := range d.ParsedStaticFields {
+		fields[name] = &ObjectField{
+			FieldValue: field.FieldValue,
+			FieldType:  field.FieldType,
+		}
+	}
+
+	return fields
+}
+
+// 设置static字段
+func (d *DefFile) SetStaticField(name string, field *ObjectField) {
+	d.staticFieldsLock.Lock()
+	defer d.staticFieldsLock.Unlock()
+
+	d.ParsedStaticFields[name] = field
+}
+
+// 读取static字段的值, 字段不存在时返回false
+func (d *DefFile) GetStaticFieldValue(name string) (interface{}, bool) {
+	d.staticFieldsLock.RLock()
+	defer d.staticFieldsLock.RUnlock()
+
+	field, ok := d.ParsedStaticFields[name]
+	if !ok {
+		return nil, false
+	}
+
+	return field.FieldValue, true
+}
+
+// 设置static字段的值, 保留字段原有的类型信息; 字段不存在时返回false
+func (d *DefFile) SetStaticFieldValue(name string, val interface{}) bool {
+	d.staticFieldsLock.Lock()
+	defer d.staticFieldsLock.Unlock()
+
+	field, ok := d.ParsedStaticFields[name]
+	if !ok {
+		return false
+	}
+	field.FieldValue = val
+
+	return true
+}
@@ -0,0 +1,141 @@
+package class
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLazyMethodAttributes(t *testing.T) {
+	def, err := LoadClassFile("../../testcase/classes/com/fh/Hanoi.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for _, method := range def.Methods {
+		if nil != method.Attrs {
+			t.Fatalf("method %s decoded before use", method)
+		}
+
+		attrs, err := method.Attributes()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, ok := attrs[0].(*CodeAttr); !ok {
+			t.Fatalf("method %s: expected Code attr, got %v", method, attrs[0])
+		}
+
+		// 第二次直接返回缓存
+		again, _ := method.Attributes()
+		if &attrs[0] != &again[0] {
+			t.Fatal("attributes decoded twice")
+		}
+	}
+}
+
+func TestCompactConstPool(t *testing.T) {
+	def, err := LoadClassFile("../../testcase/classes/com/fh/Hanoi.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if int(def.ConstPoolCount) != def.ConstPool.Len() {
+		t.Fatalf("expected %d constants, got %d", def.ConstPoolCount, def.ConstPool.Len())
+	}
+	if "com/fh/Hanoi" != def.FullClassName {
+		t.Fatalf("unexpected class name %s", def.FullClassName)
+	}
+
+	for ix := 1; ix < def.ConstPool.Len(); ix++ {
+		item := def.ConstPool.At(uint16(ix))
+		if nil == item {
+			t.Fatalf("constant #%d not decoded", ix)
+		}
+		// 同一个常量只解码一次
+		if item != def.ConstPool.At(uint16(ix)) {
+			t.Fatalf("constant #%d decoded twice", ix)
+		}
+	}
+	if nil != def.ConstPool.At(0) || nil != def.ConstPool.At(uint16(def.ConstPool.Len())) {
+		t.Fatal("expected nil outside of the pool")
+	}
+
+	pool := NewConstPool(&Utf8InfoConst{Bytes: []byte("a")})
+	if 2 != pool.Add(&Utf8InfoConst{Bytes: []byte("b")}) || "b" != pool.At(2).(*Utf8InfoConst).String() {
+		t.Fatal("unexpected Add result")
+	}
+
+	// 无法解码的常量返回错误, 不panic
+	broken := &ConstPool{tags: []uint8{0, 2}, offsets: []uint32{0, 0}}
+	if item, err := broken.Get(1); nil == err || nil != item {
+		t.Fatalf("expected decode error, got %v, %v", item, err)
+	}
+	if nil != broken.At(1) {
+		t.Fatal("expected nil for broken constant")
+	}
+}
+
+func TestCompactConstPoolMemory(t *testing.T) {
+	buf, err := ioutil.ReadFile("../../testcase/classes/com/fh/Hanoi.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+	def, err := LoadClassBuf(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	count := def.ConstPool.Len()
+
+	// 常量池从class文件第10个字节开始; 统计扫描一次分配的内存, arena引用buf, 不计算在内
+	const rounds = 1000
+	pools := make([]*ConstPool, rounds)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for ix := range pools {
+		pools[ix], _, err = scanConstPool(buf, 10, int(def.ConstPoolCount) - 1)
+		if nil != err {
+			t.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	perPool := (after.TotalAlloc - before.TotalAlloc) / rounds
+	t.Logf("%d constants: %d bytes per pool, %.1f bytes per constant", count, perPool, float64(perPool) / float64(count))
+	// 每个常量只有1字节tag和4字节偏移量, 加上结构体本身和切片容量的取整
+	if limit := uint64(5 * count + 256); perPool > limit {
+		t.Fatalf("constant pool uses %d bytes, expect at most %d", perPool, limit)
+	}
+}
+
+func TestLoadClassFileReadsIntoMemory(t *testing.T) {
+	buf, err := ioutil.ReadFile("../../testcase/classes/com/fh/Hanoi.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "mini-jvm-class")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "Hanoi.class")
+	if err := ioutil.WriteFile(path, buf, 0644); nil != err {
+		t.Fatal(err)
+	}
+	def, err := LoadClassFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 加载之后修改文件不影响已经加载的类; 常量在使用时才解码, 使用mmap时会读到修改后的内容
+	if err := ioutil.WriteFile(path, make([]byte, len(buf)), 0644); nil != err {
+		t.Fatal(err)
+	}
+	classInfo := def.ConstPool.At(def.ThisClass).(*ClassInfoConstInfo)
+	if name := def.ConstPool.At(classInfo.FullClassNameIndex).(*Utf8InfoConst).String(); "com/fh/Hanoi" != name {
+		t.Fatalf("unexpected class name %q", name)
+	}
+}
@@ -0,0 +1,164 @@
+package class
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 释放或wait没有持有的锁时返回
+var ErrMonitorNotOwned = errors.New("java.lang.IllegalMonitorStateException: current thread is not owner")
+
+// 对象和类的锁, 实现java的monitor语义: 同一线程可以重入, 支持wait/notify;
+// 等待加锁和wait都可以被context取消, 宿主取消执行时guest线程不会一直挂起. 零值可以直接使用
+type Monitor struct {
+	lock sync.Mutex
+
+	// 持有锁的线程编号和重入次数, count为0时没有线程持有
+	owner int64
+	count int
+
+	// 锁被完全释放时关闭, 唤醒所有等待加锁的线程; 没有线程等待时为nil
+	released chan struct{}
+	// 调用wait()的线程, notify按调用顺序唤醒
+	waiters []chan struct{}
+}
+
+// 加锁, 当前线程已经持有时重入; ctx被取消时放弃等待并返回ctx.Err()
+func (m *Monitor) Enter(ctx context.Context, threadID int64) error {
+	for {
+		m.lock.Lock()
+		if 0 == m.count || threadID == m.owner {
+			m.owner = threadID
+			m.count++
+			m.lock.Unlock()
+			return nil
+		}
+
+		if nil == m.released {
+			m.released = make(chan struct{})
+		}
+		released := m.released
+		m.lock.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// 释放一次锁, 重入次数减到0时其他线程才能加锁
+func (m *Monitor) Exit(threadID int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if 0 == m.count || threadID != m.owner {
+		return ErrMonitorNotOwned
+	}
+
+	m.count--
+	if 0 == m.count {
+		m.wakeEnterers()
+	}
+
+	return nil
+}
+
+// 完全释放锁并等待notify, timeout大于0时最多等待timeout; 返回前重新加锁并恢复重入次数.
+// ctx被取消时不再重新加锁, 直接返回ctx.Err()
+func (m *Monitor) Wait(ctx context.Context, threadID int64, timeout time.Duration) error {
+	m.lock.Lock()
+	if 0 == m.count || threadID != m.owner {
+		m.lock.Unlock()
+		return ErrMonitorNotOwned
+	}
+
+	count := m.count
+	m.count = 0
+	notified := make(chan struct{})
+	m.waiters = append(m.waiters, notified)
+	m.wakeEnterers()
+	m.lock.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-notified:
+	case <-timeoutCh:
+		m.removeWaiter(notified)
+	case <-ctx.Done():
+		m.removeWaiter(notified)
+		return ctx.Err()
+	}
+
+	if err := m.Enter(ctx, threadID); nil != err {
+		return err
+	}
+	m.lock.Lock()
+	m.count = count
+	m.lock.Unlock()
+
+	return nil
+}
+
+// 唤醒一个wait中的线程
+func (m *Monitor) Notify(threadID int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if 0 == m.count || threadID != m.owner {
+		return ErrMonitorNotOwned
+	}
+
+	if len(m.waiters) > 0 {
+		close(m.waiters[0])
+		m.waiters = m.waiters[1:]
+	}
+
+	return nil
+}
+
+// 唤醒所有wait中的线程
+func (m *Monitor) NotifyAll(threadID int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if 0 == m.count || threadID != m.owner {
+		return ErrMonitorNotOwned
+	}
+
+	for _, waiter := range m.waiters {
+		close(waiter)
+	}
+	m.waiters = nil
+
+	return nil
+}
+
+func (m *Monitor) wakeEnterers() {
+	if nil != m.released {
+		close(m.released)
+		m.released = nil
+	}
+}
+
+// 超时或取消的线程不再等待notify; 已经被notify取走时什么也不做
+func (m *Monitor) removeWaiter(waiter chan struct{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for ix, w := range m.waiters {
+		if w == waiter {
+			m.waiters = append(m.waiters[:ix], m.waiters[ix + 1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package class
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMonitorWaitNotify(t *testing.T) {
+	var monitor Monitor
+	ctx := context.Background()
+
+	// 重入两次后wait, 其他线程可以加锁并notify
+	monitor.Enter(ctx, 1)
+	monitor.Enter(ctx, 1)
+	woken := make(chan error)
+	go func() {
+		woken <- monitor.Wait(ctx, 1, 0)
+	}()
+
+	if err := monitor.Enter(ctx, 2); nil != err {
+		t.Fatal(err)
+	}
+	if err := monitor.Notify(2); nil != err {
+		t.Fatal(err)
+	}
+	monitor.Exit(2)
+	if err := <-woken; nil != err {
+		t.Fatal(err)
+	}
+
+	// 恢复了重入次数, 释放两次后才能被其他线程获得
+	monitor.Exit(1)
+	if err := monitor.Exit(2); ErrMonitorNotOwned != err {
+		t.Fatalf("expect not owned, got %v", err)
+	}
+	monitor.Exit(1)
+	if err := monitor.Exit(1); ErrMonitorNotOwned != err {
+		t.Fatalf("expect not owned, got %v", err)
+	}
+
+	if err := monitor.Wait(ctx, 1, 0); ErrMonitorNotOwned != err {
+		t.Fatalf("wait without lock should fail, got %v", err)
+	}
+}
+
+func TestMonitorWaitTimeout(t *testing.T) {
+	var monitor Monitor
+	monitor.Enter(context.Background(), 1)
+
+	start := time.Now()
+	if err := monitor.Wait(context.Background(), 1, 10 * time.Millisecond); nil != err {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 10 * time.Millisecond {
+		t.Fatal("wait returned before timeout")
+	}
+	if 0 != len(monitor.waiters) {
+		t.Fatal("timed out waiter should be removed")
+	}
+
+	// 宿主的context到期时, 即使没有guest超时也不会一直等待
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	if err := monitor.Wait(ctx, 1, 0); context.DeadlineExceeded != err {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if err := monitor.Enter(context.Background(), 2); nil != err {
+		t.Fatal("cancelled wait should leave the monitor released")
+	}
+}
@@ -3,6 +3,7 @@ package class
 import (
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
 	"math/rand"
 	"strings"
 	"sync"
@@ -25,7 +26,10 @@ type Reference struct {
 	Array *Array
 
 	// 锁
-	Monitor sync.Mutex
+	Monitor Monitor
+
+	// vm附加在对象上的标记(如堆统计), 不参与java语义
+	Tag interface{}
 }
 
 
@@ -37,6 +41,97 @@ type Object struct {
 
 	// 实例数据
 	ObjectFields map[string]*ObjectField
+
+	// 如果是java/lang/Class对象, 指向它所表示的类; 数组类为nil
+	Mirror *DefFile
+
+	// 本地方法在对象上保存的go端状态(如线程池, 查询结果), 随对象一起回收; 不属于实例数据, clone时不复制
+	hostState interface{}
+
+	// 保护字段值和hostState的读写, 多个线程可能同时访问同一个对象
+	fieldsLock sync.RWMutex
+}
+
+// 读取字段值, 字段不存在时第二个返回值为false
+func (o *Object) GetFieldValue(name string) (interface{}, bool) {
+	o.fieldsLock.RLock()
+	defer o.fieldsLock.RUnlock()
+
+	field, ok := o.ObjectFields[name]
+	if !ok {
+		return nil, false
+	}
+
+	return field.FieldValue, true
+}
+
+// 设置字段值, 字段不存在时返回false
+func (o *Object) SetFieldValue(name string, val interface{}) bool {
+	o.fieldsLock.Lock()
+	defer o.fieldsLock.Unlock()
+
+	field, ok := o.ObjectFields[name]
+	if !ok {
+		return false
+	}
+	field.FieldValue = val
+
+	return true
+}
+
+// 设置字段值, 字段不存在时添加; 用于不经过类定义直接构造的对象
+func (o *Object) PutFieldValue(name string, val interface{}) {
+	o.fieldsLock.Lock()
+	defer o.fieldsLock.Unlock()
+
+	if field, ok := o.ObjectFields[name]; ok {
+		field.FieldValue = val
+		return
+	}
+	o.ObjectFields[name] = NewObjectField(val)
+}
+
+// 本地方法保存的go端状态, 没有时返回nil
+func (o *Object) HostState() interface{} {
+	o.fieldsLock.RLock()
+	defer o.fieldsLock.RUnlock()
+
+	return o.hostState
+}
+
+// 保存go端状态, 替换已有的状态
+func (o *Object) SetHostState(state interface{}) {
+	o.fieldsLock.Lock()
+	defer o.fieldsLock.Unlock()
+
+	o.hostState = state
+}
+
+// 还没有状态时保存state, 返回对象最终的状态; 用于第一次使用时才创建状态的对象
+func (o *Object) LoadOrStoreHostState(state interface{}) interface{} {
+	o.fieldsLock.Lock()
+	defer o.fieldsLock.Unlock()
+
+	if nil == o.hostState {
+		o.hostState = state
+	}
+	return o.hostState
+}
+
+// 复制所有字段, clone使用
+func (o *Object) CopyFields() map[string]*ObjectField {
+	o.fieldsLock.RLock()
+	defer o.fieldsLock.RUnlock()
+
+	fields := make(map[string]*ObjectField, len(o.ObjectFields))
+	for name, field := range o.ObjectFields {
+		fields[name] = &ObjectField{
+			FieldValue: field.FieldValue,
+			FieldType:  field.FieldType,
+		}
+	}
+
+	return fields
 }
 
 
@@ -63,14 +158,14 @@ func NewObject(def *DefFile, cl Loader) (*Reference, error) {
 		}
 
 		// 父类
-		superClassCp := currentDef.ConstPool[currentDef.SuperClass].(*ClassInfoConstInfo)
-		superClassFullName := currentDef.ConstPool[superClassCp.FullClassNameIndex].(*Utf8InfoConst).String()
+		superClassCp := currentDef.ConstPool.At(currentDef.SuperClass).(*ClassInfoConstInfo)
+		superClassFullName := currentDef.ConstPool.At(superClassCp.FullClassNameIndex).(*Utf8InfoConst).String()
 		if "java/lang/Exception" == superClassFullName {
 		//if "java/lang/Object" == superClassFullName || "java/lang/Exception" == superClassFullName {
 			break
 		}
 
-		superClassDef, err := cl.LoadClass(superClassFullName)
+		superClassDef, err := resolveStructure(cl, superClassFullName)
 		if nil != err {
 			return nil, fmt.Errorf("failed to load super class '%s' for field allcation: %w", superClassFullName, err)
 		}
@@ -79,9 +174,7 @@ func NewObject(def *DefFile, cl Loader) (*Reference, error) {
 	}
 
 	// 生成hashcode
-	rand.Seed(time.Now().UnixNano())
-	hashCode := rand.Intn(65535)
-	o.HashCode = hashCode
+	o.HashCode = nextHashCode()
 
 	return &Reference{
 		RefType: ReferanceTypeObject,
@@ -90,13 +183,28 @@ func NewObject(def *DefFile, cl Loader) (*Reference, error) {
 	}, nil
 }
 
+// 生成对象hashCode用的随机数, rand.Rand不能被多个goroutine同时使用
+var hashCodeRand = struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}{
+	rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+func nextHashCode() int {
+	hashCodeRand.lock.Lock()
+	defer hashCodeRand.lock.Unlock()
+
+	return hashCodeRand.rand.Intn(65535)
+}
+
 func allocateFields(def *DefFile, fields map[string]*ObjectField) error {
 	for _, fieldInfo := range def.Fields {
 		f := new(ObjectField)
 
 		// 实例名
-		name := def.ConstPool[fieldInfo.NameIndex].(*Utf8InfoConst).String()
-		descriptor := def.ConstPool[fieldInfo.DescriptorIndex].(*Utf8InfoConst).String()
+		name := def.ConstPool.At(fieldInfo.NameIndex).(*Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(fieldInfo.DescriptorIndex).(*Utf8InfoConst).String()
 
 		// 根据不同的字段类型, 分配不同的初始值
 		if "I" == descriptor {
@@ -106,7 +214,7 @@ func allocateFields(def *DefFile, fields map[string]*ObjectField) error {
 		} else if "D" == descriptor {
 			// double
 			f.FieldType = "float64"
-			f.FieldValue = 0.00
+			f.FieldValue = float64(0)
 
 
 		} else if "C" == descriptor {
@@ -123,7 +231,17 @@ func allocateFields(def *DefFile, fields map[string]*ObjectField) error {
 			f.FieldValue = ref
 
 		} else if "J" == descriptor {
+			// 与lconst_0压入的值一样是int64, dup2, lcmp等按类型区分long
 			f.FieldType = "long"
+			f.FieldValue = int64(0)
+
+		} else if "F" == descriptor {
+			f.FieldType = "float32"
+			f.FieldValue = float32(0)
+
+		} else if "B" == descriptor || "S" == descriptor {
+			// byte, short与int一样用int表示
+			f.FieldType = "int"
 			f.FieldValue = 0
 
 		} else if "Z" == descriptor {
@@ -142,6 +260,10 @@ func allocateFields(def *DefFile, fields map[string]*ObjectField) error {
 			// 值初始化为nil
 			f.FieldValue = nil
 
+		} else if strings.HasPrefix(descriptor, "[") {
+			// 其他基本类型数组和多维数组
+			f.FieldType = "null;" + descriptor
+			f.FieldValue = nil
 
 		} else if "[Ljava/io/ObjectStreamField;" == descriptor ||
 			"Ljava/util/Comparator;" == descriptor {
@@ -157,43 +279,74 @@ func allocateFields(def *DefFile, fields map[string]*ObjectField) error {
 	return nil
 }
 
-// 创建一个String对象, 用于String字面值常量的创建
+// 创建一个String对象, 用于String字面值常量的创建;
+// 字段按java/lang/String的定义分配, value为char[], 与字节码中的String方法使用同一种布局
 func NewStringObject(val []rune, cl Loader) (*Reference, error) {
-	stringDef, err := cl.LoadClass("java/lang/String")
+	stringDef, err := resolveStructure(cl, "java/lang/String")
 	if nil != err {
 		return nil, fmt.Errorf("failed to new String object:%w", err)
 	}
 
-	obj := &Object{
-		DefFile:      stringDef,
-		ObjectFields: make(map[string]*ObjectField),
+	ref, err := NewObject(stringDef, cl)
+	if nil != err {
+		return nil, fmt.Errorf("failed to new String object:%w", err)
 	}
 
-	// 给value和hash这两个最重要的字段赋值
-	//obj.ObjectFields["value"] = &ObjectField{
-	//	FieldValue: val,
-	//	FieldType:  "[]rune",
-	//}
-
 	// value
-	valueArrayRef, _ := NewArray(len(val), 5)
+	valueArrayRef, _ := NewArray(len(val), atype.Char)
 	utils.FillInterfaceArrayRune(valueArrayRef.Array.Data, val)
 
-	obj.ObjectFields["value"] = &ObjectField{
+	// 两个字段一次分配
+	fields := make([]ObjectField, 2)
+	fields[0] = ObjectField{
 		FieldValue: valueArrayRef,
 		FieldType:  "array",
 	}
-	// hash
-	obj.ObjectFields["hash"] = &ObjectField{
+	// hash, 0表示还没有计算过
+	fields[1] = ObjectField{
 		FieldValue: 0,
 		FieldType:  "int",
 	}
+	ref.Object.ObjectFields["value"] = &fields[0]
+	ref.Object.ObjectFields["hash"] = &fields[1]
 
-	return &Reference{
-		RefType: ReferanceTypeObject,
-		Object:  obj,
-		Array:   nil,
-	}, nil
+	return ref, nil
+}
+
+// 取出String对象中的字符;
+// value为char[]时元素可能是rune(go代码写入)或int(castore写入);
+// value为byte[]时(JDK9之后的布局)按coder字段解码, 0为LATIN1, 1为UTF16
+func StringRunes(strRef *Reference) ([]rune, error) {
+	if nil == strRef || nil == strRef.Object {
+		return nil, fmt.Errorf("java.lang.NullPointerException: string is null")
+	}
+
+	val, _ := strRef.Object.GetFieldValue("value")
+	arrRef, _ := val.(*Reference)
+	if nil == arrRef || nil == arrRef.Array {
+		return nil, fmt.Errorf("invalid String object: missing value array")
+	}
+
+	if atype.Byte != arrRef.Array.Type {
+		return utils.InterfaceArrayToRuneArray(arrRef.Array.Data), nil
+	}
+
+	data := arrRef.Array.Bytes
+
+	coder, _ := strRef.Object.GetFieldValue("coder")
+	if c, _ := coder.(int); 1 == c {
+		runes := make([]rune, 0, len(data) / 2)
+		for ix := 0; ix + 1 < len(data); ix += 2 {
+			runes = append(runes, rune(data[ix]) << 8 | rune(data[ix + 1]))
+		}
+		return runes, nil
+	}
+
+	runes := make([]rune, len(data))
+	for ix, b := range data {
+		runes[ix] = rune(b)
+	}
+	return runes, nil
 }
 
 
@@ -252,10 +405,12 @@ func ParseMethodDescriptor(descriptor string) ([]string, string) {
 			continue
 		}
 
-		// 进入数组模式
+		// 进入数组模式, 多维数组从第一个[开始
 		if '[' == ch {
+			if 2 != mode {
+				arrayStartIndex = ix
+			}
 			mode = 2
-			arrayStartIndex = ix
 
 			continue
 		}
@@ -330,18 +485,96 @@ type Array struct {
 
 	// 数据
 	Data []interface{}
+	// byte[]的数据, 此时Data为nil; 本地方法可以不经复制直接作为go的[]byte读写
+	Bytes []byte
+	// 保护元素的读写, 多个线程可能同时访问同一个数组
+	lock sync.RWMutex
+}
+
+// 读取元素, byte[]的元素与baload压栈的一样为int
+func (a *Array) Load(index int) interface{} {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if nil != a.Bytes {
+		return int(int8(a.Bytes[index]))
+	}
+	return a.Data[index]
+}
+
+// 写入元素
+func (a *Array) Store(index int, val interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if nil != a.Bytes {
+		a.Bytes[index] = toByte(val)
+		return
+	}
+	a.Data[index] = val
+}
+
+// 数组长度
+func (a *Array) Len() int {
+	if nil != a.Bytes {
+		return len(a.Bytes)
+	}
+	return len(a.Data)
+}
+
+func toByte(val interface{}) byte {
+	switch v := val.(type) {
+	case int:
+		return byte(v)
+	case int8:
+		return byte(v)
+	case uint8:
+		return v
+	case int32:
+		return byte(v)
+	case int64:
+		return byte(v)
+	case bool:
+		if v {
+			return 1
+		}
+	}
+
+	return 0
 }
 
-func NewArray(maxLen int, atype byte) (*Reference, error) {
+func NewArray(maxLen int, arrType byte) (*Reference, error) {
 	//if atype < 4 || atype > 11 {
 	//	return nil, fmt.Errorf("unsupported array type '%d'", atype)
 	//}
 
+	if atype.Byte == arrType {
+		return NewByteArray(make([]byte, maxLen)), nil
+	}
+
 	arr := &Array{
-		Type: atype,
+		Type: arrType,
 		Data: make([]interface{}, maxLen),
 	}
 
+	// 元素初始值为0, 类型与iaload, laload, faload, daload压栈的一致
+	var zero interface{}
+	switch arrType {
+	case atype.Boolean, atype.Char, atype.Short, atype.Int:
+		zero = 0
+	case atype.Long:
+		zero = int64(0)
+	case atype.Float:
+		zero = float32(0)
+	case atype.Double:
+		zero = float64(0)
+	}
+	if nil != zero {
+		for ix := range arr.Data {
+			arr.Data[ix] = zero
+		}
+	}
+
 	return &Reference{
 		RefType: ReferanceTypeArray,
 		Object:  nil,
@@ -349,6 +582,19 @@ func NewArray(maxLen int, atype byte) (*Reference, error) {
 	}, nil
 }
 
+// 用data作为byte[]的数据, 不复制; 之后guest代码对数组的写入对data可见
+func NewByteArray(data []byte) *Reference {
+	if nil == data {
+		data = []byte{}
+	}
+
+	return &Reference{
+		RefType: ReferanceTypeArray,
+		Object:  nil,
+		Array:   &Array{Type: atype.Byte, Bytes: data},
+	}
+}
+
 func NewObjectArray(maxLen int, className string) (*Reference, error) {
 	arr := &Array{
 		ObjectType: className,
@@ -360,4 +606,73 @@ func NewObjectArray(maxLen int, className string) (*Reference, error) {
 		Object:  nil,
 		Array:   arr,
 	}, nil
-}
\ No newline at end of file
+}
+// 创建多维数组, 与multianewarray一样; arrayClassName为数组的描述符, 如[[I, [[Ljava/lang/String;
+// counts为前几维的长度, 可以少于数组的维数, 此时最内层创建的数组元素为null, 如new int[3][]
+func NewMultiArray(arrayClassName string, counts []int) (*Reference, error) {
+	if 0 == len(counts) || !strings.HasPrefix(arrayClassName, "[") {
+		return nil, fmt.Errorf("invalid multi-dimensional array '%s' with %d dimensions", arrayClassName, len(counts))
+	}
+	for _, count := range counts {
+		if count < 0 {
+			return nil, fmt.Errorf("negative array size %d", count)
+		}
+	}
+
+	return newMultiArray(arrayClassName, counts)
+}
+
+func newMultiArray(arrayClassName string, counts []int) (*Reference, error) {
+	elemDesc := arrayClassName[1:]
+	if 1 == len(counts) {
+		if arrType, ok := primitiveArrayType(elemDesc); ok {
+			return NewArray(counts[0], arrType)
+		}
+		if strings.HasPrefix(elemDesc, "L") {
+			return NewObjectArray(counts[0], strings.TrimSuffix(elemDesc[1:], ";"))
+		}
+	}
+
+	if !strings.HasPrefix(elemDesc, "[") {
+		return nil, fmt.Errorf("array '%s' has less than %d dimensions", arrayClassName, len(counts))
+	}
+
+	// 元素是数组, ObjectType与anewarray创建的数组一样为元素的描述符
+	arrRef, _ := NewObjectArray(counts[0], elemDesc)
+	if 1 == len(counts) {
+		return arrRef, nil
+	}
+	for ix := range arrRef.Array.Data {
+		sub, err := newMultiArray(elemDesc, counts[1:])
+		if nil != err {
+			return nil, err
+		}
+		arrRef.Array.Data[ix] = sub
+	}
+
+	return arrRef, nil
+}
+
+// 基本类型的描述符对应的newarray类型
+func primitiveArrayType(desc string) (byte, bool) {
+	switch desc {
+	case "Z":
+		return atype.Boolean, true
+	case "C":
+		return atype.Char, true
+	case "F":
+		return atype.Float, true
+	case "D":
+		return atype.Double, true
+	case "B":
+		return atype.Byte, true
+	case "S":
+		return atype.Short, true
+	case "I":
+		return atype.Int, true
+	case "J":
+		return atype.Long, true
+	}
+
+	return 0, false
+}
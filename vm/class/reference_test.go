@@ -2,6 +2,7 @@ package class
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -19,4 +20,42 @@ func TestParseMethodDescriptor(t *testing.T) {
 	if args[0] != "I" || args[1] != "I" || args[2] != "[C" || args[3] != "I" {
 		t.FailNow()
 	}
+
+	// 多维数组和对象数组
+	args, _ = ParseMethodDescriptor("([[ILjava/lang/Object;[[Ljava/lang/String;J)V")
+	if 4 != len(args) || args[0] != "[[I" || args[1] != "Ljava/lang/Object" || args[2] != "[[Ljava/lang/String" || args[3] != "J" {
+		t.Fatal(args)
+	}
+}
+
+// 多个goroutine同时读写同一个对象, 数组和static字段, 需要用-race运行
+func TestConcurrentFieldAccess(t *testing.T) {
+	obj := &Object{ObjectFields: map[string]*ObjectField{"count": NewObjectField(0)}}
+	arrRef, _ := NewArray(1, 10)
+	def := &DefFile{ParsedStaticFields: make(map[string]*ObjectField)}
+
+	var wg sync.WaitGroup
+	for ix := 0; ix < 8; ix++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				obj.SetFieldValue("count", n)
+				obj.GetFieldValue("count")
+				arrRef.Array.Store(0, n)
+				arrRef.Array.Load(0)
+				def.SetStaticField("total", NewObjectField(n))
+				def.GetStaticField("total")
+				nextHashCode()
+			}
+		}(ix)
+	}
+	wg.Wait()
+
+	if _, ok := obj.GetFieldValue("missing"); ok {
+		t.Fatal("missing field should not be found")
+	}
+	if obj.SetFieldValue("missing", 1) {
+		t.Fatal("missing field should not be set")
+	}
 }
@@ -0,0 +1,193 @@
+package class
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// class文件中可以单独比较的一段, 如一个常量, 一个方法头, 一个属性
+type classChunk struct {
+	label string
+	data  []byte
+}
+
+// 比较原始class文件和重新生成的class文件, 同一个属性表中属性的顺序可以不同;
+// 不一致时返回的错误说明第一个不同的位置, 如 method #2 (main) attribute Code
+func DiffClassBytes(original []byte, rewritten []byte) error {
+	expect, err := splitClassChunks(original)
+	if nil != err {
+		return fmt.Errorf("failed to scan original class: %w", err)
+	}
+	actual, err := splitClassChunks(rewritten)
+	if nil != err {
+		return fmt.Errorf("failed to scan rewritten class: %w", err)
+	}
+
+	for ix := 0; ix < len(expect) && ix < len(actual); ix++ {
+		if expect[ix].label != actual[ix].label {
+			return fmt.Errorf("%s: rewritten class has %s instead", expect[ix].label, actual[ix].label)
+		}
+		if !bytes.Equal(expect[ix].data, actual[ix].data) {
+			return fmt.Errorf("%s differs: original % x, rewritten % x", expect[ix].label, abbreviate(expect[ix].data), abbreviate(actual[ix].data))
+		}
+	}
+	if len(expect) != len(actual) {
+		return fmt.Errorf("original class has %d parts, rewritten class has %d", len(expect), len(actual))
+	}
+
+	return nil
+}
+
+// 错误信息中最多显示的字节数
+func abbreviate(data []byte) []byte {
+	if len(data) > 32 {
+		return data[:32]
+	}
+
+	return data
+}
+
+// 按class文件结构切分, 每个属性表按字节排序, 不解码常量和属性的内容
+func splitClassChunks(buf []byte) ([]classChunk, error) {
+	s := &chunkScanner{buf: buf}
+	header, err := s.next(10)
+	if nil != err {
+		return nil, err
+	}
+	s.add("header", header)
+
+	cpCount := int(binary.BigEndian.Uint16(header[8:]))
+	pool, cpEnd, err := scanConstPool(buf, s.pos, cpCount - 1)
+	if nil != err {
+		return nil, err
+	}
+	for ix := 1; ix < len(pool.tags); ix++ {
+		if 0 == pool.tags[ix] {
+			continue
+		}
+		// 常量内容到下一个常量的tag为止
+		end := cpEnd
+		for next := ix + 1; next < len(pool.tags); next++ {
+			if 0 != pool.tags[next] {
+				end = int(pool.offsets[next]) - 1
+				break
+			}
+		}
+		s.add(fmt.Sprintf("constant #%d", ix), buf[pool.offsets[ix] - 1:end])
+	}
+	s.pos = cpEnd
+
+	if _, err := s.next(6); nil != err {
+		return nil, err
+	}
+	interfaces, err := s.u2()
+	if nil != err {
+		return nil, err
+	}
+	if _, err := s.next(2 * int(interfaces)); nil != err {
+		return nil, err
+	}
+	s.add("class header", buf[cpEnd:s.pos])
+
+	for _, kind := range []string{"field", "method"} {
+		count, err := s.u2()
+		if nil != err {
+			return nil, err
+		}
+		s.add(kind + "s count", buf[s.pos - 2:s.pos])
+
+		for ix := 0; ix < int(count); ix++ {
+			member, err := s.next(8)
+			if nil != err {
+				return nil, err
+			}
+			label := fmt.Sprintf("%s #%d (%s)", kind, ix, utf8At(buf, pool, binary.BigEndian.Uint16(member[2:])))
+			s.add(label, member)
+			if err := s.addAttrs(label, pool, int(binary.BigEndian.Uint16(member[6:]))); nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	count, err := s.u2()
+	if nil != err {
+		return nil, err
+	}
+	s.add("class attributes count", buf[s.pos - 2:s.pos])
+	if err := s.addAttrs("class", pool, int(count)); nil != err {
+		return nil, err
+	}
+	if s.pos != len(buf) {
+		s.add("trailing data", buf[s.pos:])
+	}
+
+	return s.chunks, nil
+}
+
+type chunkScanner struct {
+	buf    []byte
+	pos    int
+	chunks []classChunk
+}
+
+func (s *chunkScanner) add(label string, data []byte) {
+	s.chunks = append(s.chunks, classChunk{label: label, data: data})
+}
+
+func (s *chunkScanner) next(n int) ([]byte, error) {
+	if s.pos + n > len(s.buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := s.buf[s.pos:s.pos + n]
+	s.pos += n
+
+	return data, nil
+}
+
+func (s *chunkScanner) u2() (uint16, error) {
+	data, err := s.next(2)
+	if nil != err {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(data), nil
+}
+
+// 读出count个属性, 按字节排序后加入, 所以属性的顺序不影响比较结果
+func (s *chunkScanner) addAttrs(owner string, pool *ConstPool, count int) error {
+	attrs := make([][]byte, 0, count)
+	for ix := 0; ix < count; ix++ {
+		start := s.pos
+		header, err := s.next(6)
+		if nil != err {
+			return err
+		}
+		if _, err := s.next(int(binary.BigEndian.Uint32(header[2:]))); nil != err {
+			return err
+		}
+		attrs = append(attrs, s.buf[start:s.pos])
+	}
+
+	sort.Slice(attrs, func(i, j int) bool {
+		return bytes.Compare(attrs[i], attrs[j]) < 0
+	})
+	for _, attr := range attrs {
+		s.add(fmt.Sprintf("%s attribute %s", owner, utf8At(s.buf, pool, binary.BigEndian.Uint16(attr))), attr)
+	}
+
+	return nil
+}
+
+// 常量池中UTF-8常量的内容, 用于错误信息
+func utf8At(buf []byte, pool *ConstPool, index uint16) string {
+	if 0 == index || int(index) >= len(pool.tags) || 1 != pool.tags[index] {
+		return fmt.Sprintf("#%d", index)
+	}
+
+	start := int(pool.offsets[index])
+	length := int(binary.BigEndian.Uint16(buf[start:]))
+	return string(buf[start + 2:start + 2 + length])
+}
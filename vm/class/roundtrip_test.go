@@ -0,0 +1,80 @@
+package class
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 解析并重新生成所有测试用例的class, 与原始字节比较
+func TestWriteClassRoundTrip(t *testing.T) {
+	acceptAll := func(string) error { return nil }
+	count := 0
+	err := filepath.Walk("../../testcase/classes", func(path string, info os.FileInfo, err error) error {
+		if nil != err || !strings.HasSuffix(path, ".class") {
+			return err
+		}
+
+		original, err := ioutil.ReadFile(path)
+		if nil != err {
+			return err
+		}
+		def, err := LoadClassBufWith(original, acceptAll)
+		if nil != err {
+			t.Fatalf("%s: %v", path, err)
+		}
+		rewritten, err := WriteClass(def)
+		if nil != err {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if err := DiffClassBytes(original, rewritten); nil != err {
+			t.Errorf("%s: %v", path, err)
+		}
+		count++
+
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0 == count {
+		t.Fatal("no class found")
+	}
+}
+
+func TestDiffClassBytes(t *testing.T) {
+	original, err := ioutil.ReadFile("../../testcase/classes/com/fh/Hanoi.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+	def, err := LoadClassBuf(original)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 属性的顺序不同不算差异
+	source := &RawAttr{NameIndex: def.ThisClass, Info: []byte{1, 2}}
+	def.Attrs = append(def.Attrs, source)
+	first, err := WriteClass(def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	def.Attrs = append([]interface{}{source}, def.Attrs[:len(def.Attrs) - 1]...)
+	second, _ := WriteClass(def)
+	if err := DiffClassBytes(first, second); nil != err {
+		t.Fatal(err)
+	}
+	if err := DiffClassBytes(original, second); nil == err || !strings.Contains(err.Error(), "class attributes count") {
+		t.Fatalf("expect attribute count difference, got %v", err)
+	}
+
+	def, _ = LoadClassBuf(original)
+	rewritten, _ := WriteClass(def)
+	// 修改一个常量
+	rewritten[11]++
+	if err := DiffClassBytes(original, rewritten); nil == err || !strings.Contains(err.Error(), "constant #1 differs") {
+		t.Fatalf("expect constant difference, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package class
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 在内存中构造的类没有版本号时按Java 8输出
+const defaultMajorVersion = 52
+
+// 把DefFile重新编码成class文件, 各部分的顺序与解析时相同;
+// 不使用的属性按解析时保存的原始字节输出. 在内存中构造的类(如bench_class.go生成的类)常量池中没有属性名时, 属性名追加到常量池末尾
+func WriteClass(def *DefFile) ([]byte, error) {
+	w := &classWriter{def: def, names: make(map[string]uint16)}
+	for ix := 1; ix < def.ConstPool.Len(); ix++ {
+		if utf8, ok := def.ConstPool.At(uint16(ix)).(*Utf8InfoConst); ok {
+			if _, exists := w.names[utf8.String()]; !exists {
+				w.names[utf8.String()] = uint16(ix)
+			}
+		}
+	}
+
+	// 先输出常量池之后的部分, 确定需要追加的属性名
+	var body bytes.Buffer
+	if err := w.writeBody(&body); nil != err {
+		return nil, fmt.Errorf("failed to write class %s: %w", def.FullClassName, err)
+	}
+
+	var out bytes.Buffer
+	majorVersion := def.MajorVersion
+	if 0 == majorVersion {
+		majorVersion = defaultMajorVersion
+	}
+	writeU4(&out, JVM_CLASS_FILE_MAGIC_NUMBER)
+	writeU2(&out, def.MinorVersion)
+	writeU2(&out, majorVersion)
+
+	poolLen := def.ConstPool.Len() + len(w.extraNames)
+	if poolLen > 0xffff {
+		return nil, fmt.Errorf("failed to write class %s: too many constants", def.FullClassName)
+	}
+	writeU2(&out, uint16(poolLen))
+	for ix := 1; ix < def.ConstPool.Len(); ix++ {
+		item := def.ConstPool.At(uint16(ix))
+		if nil == item {
+			// long和double之后的占位
+			continue
+		}
+		if err := writeConst(&out, item); nil != err {
+			return nil, fmt.Errorf("failed to write class %s: constant #%d: %w", def.FullClassName, ix, err)
+		}
+	}
+	for _, name := range w.extraNames {
+		writeConst(&out, &Utf8InfoConst{Bytes: []byte(name)})
+	}
+
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+type classWriter struct {
+	def *DefFile
+
+	// 属性名 -> 常量池下标, 同名的UTF-8常量取第一个
+	names map[string]uint16
+	// 需要追加到常量池末尾的属性名
+	extraNames []string
+}
+
+func (w *classWriter) writeBody(buf *bytes.Buffer) error {
+	def := w.def
+	writeU2(buf, def.AccessFlag)
+	writeU2(buf, def.ThisClass)
+	writeU2(buf, def.SuperClass)
+
+	writeU2(buf, uint16(len(def.Interfaces)))
+	for _, index := range def.Interfaces {
+		writeU2(buf, index)
+	}
+
+	writeU2(buf, uint16(len(def.Fields)))
+	for _, field := range def.Fields {
+		attrs, err := field.Attributes()
+		if nil != err {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		if err := w.writeMember(buf, field.AccessFlags, field.NameIndex, field.DescriptorIndex, attrs); nil != err {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	writeU2(buf, uint16(len(def.Methods)))
+	for _, method := range def.Methods {
+		attrs, err := method.Attributes()
+		if nil != err {
+			return fmt.Errorf("method %s: %w", method, err)
+		}
+		if err := w.writeMember(buf, method.AccessFlags, method.NameIndex, method.DescriptorIndex, attrs); nil != err {
+			return fmt.Errorf("method %s: %w", method, err)
+		}
+	}
+
+	return w.writeAttrs(buf, def.Attrs)
+}
+
+func (w *classWriter) writeMember(buf *bytes.Buffer, flags uint16, nameIndex uint16, descIndex uint16, attrs []interface{}) error {
+	writeU2(buf, flags)
+	writeU2(buf, nameIndex)
+	writeU2(buf, descIndex)
+
+	return w.writeAttrs(buf, attrs)
+}
+
+func (w *classWriter) writeAttrs(buf *bytes.Buffer, attrs []interface{}) error {
+	writeU2(buf, uint16(len(attrs)))
+	for _, attr := range attrs {
+		if err := w.writeAttr(buf, attr); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 输出属性名下标, 长度和内容; 长度按内容重新计算, 不使用解析时记录的长度
+func (w *classWriter) writeAttr(buf *bytes.Buffer, attr interface{}) error {
+	var name string
+	var info bytes.Buffer
+
+	switch a := attr.(type) {
+	case *RawAttr:
+		writeU2(buf, a.NameIndex)
+		writeU4(buf, uint32(len(a.Info)))
+		buf.Write(a.Info)
+		return nil
+
+	case *CodeAttr:
+		name = "Code"
+		writeU2(&info, a.MaxStack)
+		writeU2(&info, a.MaxLocals)
+		writeU4(&info, uint32(len(a.Code)))
+		info.Write(a.Code)
+		writeU2(&info, uint16(len(a.ExceptionTable)))
+		for _, entry := range a.ExceptionTable {
+			writeU2(&info, entry.StartPc)
+			writeU2(&info, entry.EndPc)
+			writeU2(&info, entry.HandlerPc)
+			writeU2(&info, entry.CatchType)
+		}
+		if err := w.writeAttrs(&info, a.Attrs); nil != err {
+			return err
+		}
+
+	case *ConstantValueAttr:
+		name = "ConstantValue"
+		writeU2(&info, a.ConstantValueIndex)
+
+	case *LineNumberAttr:
+		name = "LineNumberTable"
+		writeU2(&info, uint16(len(a.LineNumberTable)))
+		for _, line := range a.LineNumberTable {
+			writeU2(&info, line.StartPc)
+			writeU2(&info, line.LineNumber)
+		}
+
+	case *SourceFileAttr:
+		name = "SourceFile"
+		writeU2(&info, a.SourceFileIndex)
+
+	case *StackMapTableAttr:
+		name = "StackMapTable"
+		info.Write(a.Info)
+
+	case *InnerClassAttr:
+		name = "InnerClasses"
+		writeU2(&info, uint16(len(a.InnerClasses)))
+		for _, inner := range a.InnerClasses {
+			writeU2(&info, inner.InnerClassInfoIndex)
+			writeU2(&info, inner.OuterClassInfoIndex)
+			writeU2(&info, inner.InnerNameIndex)
+			writeU2(&info, inner.InnerClassAccessFlags)
+		}
+
+	case *BootstrapMethodsAttr:
+		name = "BootstrapMethods"
+		writeU2(&info, uint16(len(a.Methods)))
+		for _, method := range a.Methods {
+			writeU2(&info, method.MethodRef)
+			writeU2(&info, uint16(len(method.Args)))
+			for _, arg := range method.Args {
+				writeU2(&info, arg)
+			}
+		}
+
+	default:
+		return fmt.Errorf("cannot write attr %T", attr)
+	}
+
+	writeU2(buf, w.nameIndex(name))
+	writeU4(buf, uint32(info.Len()))
+	buf.Write(info.Bytes())
+
+	return nil
+}
+
+func (w *classWriter) nameIndex(name string) uint16 {
+	if index, ok := w.names[name]; ok {
+		return index
+	}
+
+	index := uint16(w.def.ConstPool.Len() + len(w.extraNames))
+	w.extraNames = append(w.extraNames, name)
+	w.names[name] = index
+
+	return index
+}
+
+// 按常量的类型输出tag和内容; 在内存中构造的常量Tag字段可能为0, 所以不使用Tag字段
+func writeConst(buf *bytes.Buffer, item interface{}) error {
+	switch c := item.(type) {
+	case *Utf8InfoConst:
+		if len(c.Bytes) > 0xffff {
+			return fmt.Errorf("utf8 constant too long")
+		}
+		buf.WriteByte(1)
+		writeU2(buf, uint16(len(c.Bytes)))
+		buf.Write(c.Bytes)
+	case *IntegerInfoConst:
+		buf.WriteByte(3)
+		writeU4(buf, c.Bytes)
+	case *FloatConst:
+		buf.WriteByte(4)
+		writeU4(buf, c.Bytes)
+	case *LongConst:
+		buf.WriteByte(5)
+		writeU4(buf, c.HighByte)
+		writeU4(buf, c.LowByte)
+	case *DoubleConst:
+		buf.WriteByte(6)
+		writeU4(buf, c.HighByte)
+		writeU4(buf, c.LowByte)
+	case *ClassInfoConstInfo:
+		buf.WriteByte(7)
+		writeU2(buf, c.FullClassNameIndex)
+	case *StringInfoConst:
+		buf.WriteByte(8)
+		writeU2(buf, c.StringIndex)
+	case *FieldRefConstInfo:
+		buf.WriteByte(9)
+		writeU2(buf, c.ClassIndex)
+		writeU2(buf, c.NameAndTypeIndex)
+	case *MethodRefConstInfo:
+		buf.WriteByte(10)
+		writeU2(buf, c.ClassIndex)
+		writeU2(buf, c.NameAndTypeIndex)
+	case *InterfaceMethodConst:
+		buf.WriteByte(11)
+		writeU2(buf, c.InterfaceClassIndex)
+		writeU2(buf, c.NameAndTypeIndex)
+	case *NameAndTypeConst:
+		buf.WriteByte(12)
+		writeU2(buf, c.NameIndex)
+		writeU2(buf, c.DescIndex)
+	case *MethodHandleConst:
+		buf.WriteByte(15)
+		buf.WriteByte(c.ReferenceKind)
+		writeU2(buf, c.ReferenceIndex)
+	case *MethodTypeConst:
+		buf.WriteByte(16)
+		writeU2(buf, c.DescriptorIndex)
+	case *InvokeDynamicConst:
+		buf.WriteByte(18)
+		writeU2(buf, c.BootstrapMethodAttrIndex)
+		writeU2(buf, c.NameAndTypeIndex)
+	default:
+		return fmt.Errorf("unknown constant type %T", item)
+	}
+
+	return nil
+}
+
+func writeU2(buf *bytes.Buffer, v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeU4(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
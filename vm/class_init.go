@@ -0,0 +1,308 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 一个类的<clinit>执行状态
+type classInit struct {
+	// 执行<clinit>的线程编号
+	thread int64
+	// <clinit>栈帧的上一个栈帧, 即触发初始化的栈帧
+	frame *MethodStackFrame
+	// <clinit>执行完成后关闭, 类没有<clinit>时为nil
+	done chan struct{}
+}
+
+// 登记类正在由frame所在的线程初始化;
+// frame为nil时(不是由字节码触发的加载)在新线程中执行<clinit>
+func (m *MethodArea) beginInit(frame *MethodStackFrame, def *class.DefFile) *classInit {
+	init := newClassInit(frame, def)
+
+	m.initLock.Lock()
+	m.registerInit(def, init)
+	m.initLock.Unlock()
+
+	return init
+}
+
+func newClassInit(frame *MethodStackFrame, def *class.DefFile) *classInit {
+	if nil == findMethodInDef(def, "<clinit>", "()V") {
+		return &classInit{}
+	}
+
+	if nil == frame {
+		frame = newRootFrame()
+	}
+	return &classInit{thread: frame.ThreadID(), frame: frame, done: make(chan struct{})}
+}
+
+// 调用者需要持有initLock
+func (m *MethodArea) registerInit(def *class.DefFile, init *classInit) {
+	if nil == init.done {
+		return
+	}
+
+	if nil == m.initializing {
+		m.initializing = make(map[string]*classInit)
+	}
+	m.initializing[def.FullClassName] = init
+}
+
+// 执行<clinit>, 完成后唤醒等待的线程;
+// 只有初始化死锁会作为错误返回, <clinit>的其他错误不中断类加载; StrictInit下返回ExceptionInInitializerError
+func (m *MethodArea) initialize(def *class.DefFile, init *classInit) error {
+	if nil == init.done {
+		return nil
+	}
+
+	err := m.Jvm.ExecutionEngine.ExecuteWithFrame(def, "<clinit>", "()V", init.frame, false)
+
+	var deadlock *ClassInitDeadlockError
+	isDeadlock := errors.As(err, &deadlock)
+
+	// 先记录失败再唤醒等待的线程, 它们醒来后能看到初始化失败
+	m.initLock.Lock()
+	delete(m.initializing, def.FullClassName)
+	if nil != err && !isDeadlock && m.strictInit() {
+		if nil == m.failedInits {
+			m.failedInits = make(map[string]bool)
+		}
+		m.failedInits[def.FullClassName] = true
+	}
+	m.initLock.Unlock()
+	close(init.done)
+
+	if isDeadlock {
+		return fmt.Errorf("failed to execute <clinit> for class '%s':%w", def.FullClassName, err)
+	}
+	if nil != err && m.strictInit() {
+		return fmt.Errorf("java.lang.ExceptionInInitializerError: <clinit> of class '%s' failed: %v", def.FullClassName, err)
+	}
+
+	return nil
+}
+
+func (m *MethodArea) strictInit() bool {
+	return nil != m.Jvm && m.Jvm.StrictInit
+}
+
+// StrictInit下登记类已经链接, <clinit>等到第一次主动使用时再执行
+func (m *MethodArea) deferInit(def *class.DefFile) {
+	m.initLock.Lock()
+	defer m.initLock.Unlock()
+
+	if nil == m.pendingInits {
+		m.pendingInits = make(map[string]bool)
+	}
+	m.pendingInits[def.FullClassName] = true
+}
+
+// 主动使用类(JLS 12.4.1)时调用, StrictInit下按JVMS 5.5的顺序初始化:
+// 先初始化父类和声明了非抽象实例方法的父接口, 再执行本类的<clinit>; 默认模式下类在加载时已经初始化, 直接返回
+func (m *MethodArea) initializeClass(frame *MethodStackFrame, def *class.DefFile) error {
+	if !m.strictInit() {
+		return nil
+	}
+
+	m.initLock.Lock()
+	pending := m.pendingInits[def.FullClassName]
+	m.initLock.Unlock()
+
+	if pending {
+		parents, err := m.initParentsOf(def)
+		if nil != err {
+			return err
+		}
+		for _, parent := range parents {
+			if err := m.initializeClass(frame, parent); nil != err {
+				return err
+			}
+		}
+
+		// 多个线程同时走到这里时只有一个能取得初始化权, 其他线程与默认模式一样等待
+		if init := m.claimInit(frame, def); nil != init {
+			return m.initialize(def, init)
+		}
+	}
+
+	if _, err := m.awaitInitialized(frame, def); nil != err {
+		return err
+	}
+
+	m.initLock.Lock()
+	failed := m.failedInits[def.FullClassName]
+	m.initLock.Unlock()
+	if failed {
+		return fmt.Errorf("java.lang.NoClassDefFoundError: Could not initialize class %s", def.FullClassName)
+	}
+
+	return nil
+}
+
+// 类仍未初始化时登记由frame所在的线程初始化, 已经被其他线程登记时返回nil
+// 移出pendingInits和登记initializing在同一把锁内完成, 否则其他线程会在两者之间把类当作已经初始化
+func (m *MethodArea) claimInit(frame *MethodStackFrame, def *class.DefFile) *classInit {
+	init := newClassInit(frame, def)
+
+	m.initLock.Lock()
+	defer m.initLock.Unlock()
+
+	if !m.pendingInits[def.FullClassName] {
+		return nil
+	}
+	delete(m.pendingInits, def.FullClassName)
+	m.registerInit(def, init)
+
+	return init
+}
+
+// 初始化def之前需要先初始化的类: 父类, 以及def为类时所有声明了非抽象实例方法的父接口(包括间接的),
+// 按接口表的顺序深度优先, 父接口在子接口之前
+func (m *MethodArea) initParentsOf(def *class.DefFile) ([]*class.DefFile, error) {
+	var parents []*class.DefFile
+	if 0 != def.SuperClass {
+		superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+		superName := def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+		superDef, err := m.ResolveClass(superName)
+		if nil != err {
+			return nil, fmt.Errorf("cannot load parent class '%s': %w", superName, err)
+		}
+		parents = append(parents, superDef)
+	}
+
+	// 接口初始化时不初始化父接口
+	if def.AccessFlag & accflag.Interface > 0 {
+		return parents, nil
+	}
+
+	visited := make(map[string]bool)
+	var visit func(names []string) error
+	visit = func(names []string) error {
+		for _, name := range names {
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			ifaceDef, err := m.ResolveClass(name)
+			if nil != err {
+				return fmt.Errorf("cannot load interface '%s': %w", name, err)
+			}
+			if err := visit(interfaceNamesOf(ifaceDef)); nil != err {
+				return err
+			}
+			if declaresInstanceMethod(ifaceDef) {
+				parents = append(parents, ifaceDef)
+			}
+		}
+
+		return nil
+	}
+	if err := visit(interfaceNamesOf(def)); nil != err {
+		return nil, err
+	}
+
+	return parents, nil
+}
+
+// 接口中是否有default方法或private实例方法
+func declaresInstanceMethod(ifaceDef *class.DefFile) bool {
+	for _, methodInfo := range ifaceDef.Methods {
+		if methodInfo.AccessFlags & (accflag.Abstarct | accflag.Static) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invokestatic对类的主动使用: 初始化声明方法的类, 方法继承自父类时不初始化def本身
+func (m *MethodArea) initializeMethodOwner(frame *MethodStackFrame, def *class.DefFile, name string, descriptor string) error {
+	if !m.strictInit() {
+		return nil
+	}
+
+	owner := def
+	for nil == findMethodInDef(owner, name, descriptor) && 0 != owner.SuperClass {
+		superInfo := owner.ConstPool.At(owner.SuperClass).(*class.ClassInfoConstInfo)
+		superName := owner.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+		superDef, err := m.ResolveClass(superName)
+		if nil != err {
+			return fmt.Errorf("cannot load parent class '%s': %w", superName, err)
+		}
+		owner = superDef
+	}
+	if nil == findMethodInDef(owner, name, descriptor) {
+		// 找不到时由调用本身报告错误
+		owner = def
+	}
+
+	return m.initializeClass(frame, owner)
+}
+
+// 类正在被其他线程初始化时等待完成;
+// 本线程正在初始化(<clinit>中访问本类)时直接返回, 等待会形成环时返回ClassInitDeadlockError
+func (m *MethodArea) awaitInitialized(frame *MethodStackFrame, def *class.DefFile) (*class.DefFile, error) {
+	// 没有栈帧的调用者只解析类的结构, 不需要等待初始化
+	if nil == frame {
+		return def, nil
+	}
+	thread := frame.ThreadID()
+
+	m.initLock.Lock()
+	init, ok := m.initializing[def.FullClassName]
+	if !ok || init.thread == thread {
+		m.initLock.Unlock()
+		return def, nil
+	}
+
+	if cycle := m.findInitCycle(thread, def.FullClassName); nil != cycle {
+		m.initLock.Unlock()
+		return nil, &ClassInitDeadlockError{Cycle: cycle}
+	}
+
+	if nil == m.initWaiters {
+		m.initWaiters = make(map[int64]string)
+	}
+	m.initWaiters[thread] = def.FullClassName
+	m.initLock.Unlock()
+
+	<-init.done
+
+	m.initLock.Lock()
+	delete(m.initWaiters, thread)
+	m.initLock.Unlock()
+
+	return def, nil
+}
+
+// 沿"线程等待的类 -> 初始化该类的线程"查找, 回到thread时返回等待环, 否则返回nil;
+// 调用者需要持有initLock
+func (m *MethodArea) findInitCycle(thread int64, className string) []ClassInitWait {
+	owner := m.initializing[className].thread
+	cycle := []ClassInitWait{{ThreadID: thread, ClassName: className, OwnerThreadID: owner}}
+
+	for len(cycle) <= len(m.initWaiters) + 1 {
+		if owner == thread {
+			return cycle
+		}
+
+		waiting, ok := m.initWaiters[owner]
+		if !ok {
+			return nil
+		}
+		init, ok := m.initializing[waiting]
+		if !ok {
+			return nil
+		}
+
+		cycle = append(cycle, ClassInitWait{ThreadID: owner, ClassName: waiting, OwnerThreadID: init.thread})
+		owner = init.thread
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// JLS 12.4的初始化时机和顺序, 类都经过defineClass加载, 与从classpath加载一致
+
+// 记录<clinit>执行顺序的测试环境
+type initOrderTest struct {
+	jvm   *MiniJvm
+	order []string
+}
+
+// 把构造好的类登记为内置类, 使它们按需经过defineClass加载, 而不是预先放入ClassMap
+func newInitOrderTest(t *testing.T, strict bool, defs ...*class.DefFile) *initOrderTest {
+	for _, def := range defs {
+		def := def
+		builtinClasses[def.FullClassName] = func() *class.DefFile { return def }
+	}
+	t.Cleanup(func() {
+		for _, def := range defs {
+			delete(builtinClasses, def.FullClassName)
+		}
+	})
+
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.StrictInit = strict
+
+	test := &initOrderTest{jvm: jvm}
+	for _, def := range defs {
+		name := def.FullClassName
+		jvm.NativeMethodTable.RegisterMethod(strings.ReplaceAll(name, "/", "."), "hook", "()V", func(args ...interface{}) interface{} {
+			test.order = append(test.order, name)
+			return nil
+		})
+	}
+
+	return test
+}
+
+// 执行com/fh/Main.run()
+func (test *initOrderTest) run() error {
+	def, err := test.jvm.MethodArea.LoadClass("com/fh/Main")
+	if nil != err {
+		return err
+	}
+
+	return test.jvm.ExecutionEngine.ExecuteWithDescriptor(def, "run", "()V")
+}
+
+// <clinit>调用native的hook()记录自己被初始化, 有static int x
+func newInitOrderClass(name string, superName string, interfaces ...string) *classBuilder {
+	b := newClassBuilder(name, superName)
+	for _, iface := range interfaces {
+		b.implements(iface)
+	}
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"x": {FieldValue: 0, FieldType: "int"}}
+	b.method(accflag.Static | accflag.Native, "hook", "()V", 0, 0, nil)
+	b.method(accflag.Static, "<clinit>", "()V", 0, 0, newCodeAssembler().
+		emitIndex(bcode.Invokestatic, b.methodRef(name, "hook", "()V")).
+		emit(bcode.Return))
+
+	return b
+}
+
+func newInitOrderMain(body func(b *classBuilder, code *codeAssembler)) *class.DefFile {
+	b := newClassBuilder("com/fh/Main", "java/lang/Object")
+	code := newCodeAssembler()
+	body(b, code)
+	b.method(accflag.Static, "run", "()V", 2, 0, code.emit(bcode.Return))
+
+	return b.def
+}
+
+func expectInitOrder(t *testing.T, test *initOrderTest, expected ...string) {
+	if err := test.run(); nil != err {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 && len(test.order) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, test.order) {
+		t.Fatalf("expect <clinit> order %v, got %v", expected, test.order)
+	}
+}
+
+// 12.4.1: 父类先于子类初始化, 默认模式下也必须满足
+func TestInitSuperclassBeforeSubclass(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			main := newInitOrderMain(func(b *classBuilder, code *codeAssembler) {
+				code.emitIndex(bcode.New, b.classRef("com/fh/Sub")).emit(bcode.Pop)
+			})
+			test := newInitOrderTest(t, strict, main,
+				newInitOrderClass("com/fh/Super", "java/lang/Object").def,
+				newInitOrderClass("com/fh/Sub", "com/fh/Super").def)
+
+			expectInitOrder(t, test, "com/fh/Super", "com/fh/Sub")
+		})
+	}
+}
+
+// 12.4.1: 通过子类访问父类声明的静态成员, 只初始化声明它的类
+func TestStrictInitInheritedStaticMember(t *testing.T) {
+	tests := map[string]func(b *classBuilder, code *codeAssembler){
+		"getstatic": func(b *classBuilder, code *codeAssembler) {
+			code.emitIndex(bcode.Getstatic, b.fieldRef("com/fh/Sub", "x", "I")).emit(bcode.Pop)
+		},
+		"putstatic": func(b *classBuilder, code *codeAssembler) {
+			code.emit(bcode.Iconst1).emitIndex(bcode.Putstatic, b.fieldRef("com/fh/Sub", "x", "I"))
+		},
+		"invokestatic": func(b *classBuilder, code *codeAssembler) {
+			code.emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Sub", "m", "()V"))
+		},
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			super := newInitOrderClass("com/fh/Super", "java/lang/Object")
+			super.method(accflag.Static, "m", "()V", 0, 0, newCodeAssembler().emit(bcode.Return))
+			// Sub没有自己的x
+			sub := newInitOrderClass("com/fh/Sub", "com/fh/Super")
+			sub.def.ParsedStaticFields = map[string]*class.ObjectField{}
+
+			test := newInitOrderTest(t, true, newInitOrderMain(body), super.def, sub.def)
+			expectInitOrder(t, test, "com/fh/Super")
+		})
+	}
+}
+
+// 12.4.1: 类字面量不是主动使用, 不触发初始化
+func TestStrictInitClassLiteral(t *testing.T) {
+	main := newInitOrderMain(func(b *classBuilder, code *codeAssembler) {
+		code.emit(bcode.Ldc, byte(b.classRef("com/fh/Foo"))).emit(bcode.Pop)
+	})
+	test := newInitOrderTest(t, true, main, newInitOrderClass("com/fh/Foo", "java/lang/Object").def,
+		newTestClass("java/lang/Class", "java/lang/Object", nil))
+
+	expectInitOrder(t, test)
+}
+
+// 12.4.1, JVMS 5.5: 初始化类时不初始化它实现的接口, 除非接口声明了default方法
+func TestStrictInitInterfaces(t *testing.T) {
+	plain := newInitOrderClass("com/fh/Plain", "java/lang/Object")
+	plain.def.AccessFlag = accflag.Interface | accflag.Abstarct
+	withDefault := newInitOrderClass("com/fh/WithDefault", "java/lang/Object")
+	withDefault.def.AccessFlag = accflag.Interface | accflag.Abstarct
+	withDefault.method(accflag.Public, "d", "()V", 0, 1, newCodeAssembler().emit(bcode.Return))
+
+	main := newInitOrderMain(func(b *classBuilder, code *codeAssembler) {
+		code.emitIndex(bcode.New, b.classRef("com/fh/Impl")).emit(bcode.Pop)
+	})
+	test := newInitOrderTest(t, true, main, plain.def, withDefault.def,
+		newInitOrderClass("com/fh/Impl", "java/lang/Object", "com/fh/Plain", "com/fh/WithDefault").def)
+
+	expectInitOrder(t, test, "com/fh/WithDefault", "com/fh/Impl")
+}
+
+// 12.4.2: <clinit>抛出异常时报告ExceptionInInitializerError, 之后再使用该类时报告NoClassDefFoundError
+func TestStrictInitFailure(t *testing.T) {
+	newTest := func(strict bool) *initOrderTest {
+		main := newInitOrderMain(func(b *classBuilder, code *codeAssembler) {
+			code.emitIndex(bcode.Getstatic, b.fieldRef("com/fh/Bad", "x", "I")).emit(bcode.Pop)
+		})
+		test := newInitOrderTest(t, strict, main, newInitOrderClass("com/fh/Bad", "java/lang/Object").def)
+		test.jvm.NativeMethodTable.RegisterMethod("com.fh.Bad", "hook", "()V", func(args ...interface{}) interface{} {
+			return fmt.Errorf("java.lang.IllegalStateException: boom")
+		})
+
+		return test
+	}
+
+	// 默认模式忽略<clinit>的错误
+	if err := newTest(false).run(); nil != err {
+		t.Fatal(err)
+	}
+
+	test := newTest(true)
+	err := test.run()
+	if nil == err || !strings.Contains(err.Error(), "java.lang.ExceptionInInitializerError") ||
+		!strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect ExceptionInInitializerError, got %v", err)
+	}
+
+	err = test.run()
+	if nil == err || !strings.Contains(err.Error(), "java.lang.NoClassDefFoundError: Could not initialize class com/fh/Bad") {
+		t.Fatalf("expect NoClassDefFoundError, got %v", err)
+	}
+	if ExitClassNotFound != ExitCodeOf(err) {
+		t.Fatalf("unexpected exit code %d", ExitCodeOf(err))
+	}
+}
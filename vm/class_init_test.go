@@ -0,0 +1,253 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newClassInitTestJvm(defs ...*class.DefFile) (*MiniJvm, error) {
+	ma, err := newTestMethodArea(append(defs, newTestClass("java/lang/Object", "", nil))...)
+	if nil != err {
+		return nil, err
+	}
+
+	jvm := &MiniJvm{
+		MethodArea:        ma,
+		NativeMethodTable: NewNativeMethodTable(),
+		IntrinsicTable:    NewNativeMethodTable(),
+		stats:             new(vmStats),
+	}
+	ma.Jvm = jvm
+	jvm.ExecutionEngine = NewInterpretedExecutionEngine(jvm)
+
+	return jvm, nil
+}
+
+// 与从classpath加载一样登记初始化状态, 放入ClassMap, 然后在当前goroutine中执行<clinit>
+func defineTestClass(ma *MethodArea, def *class.DefFile) error {
+	if err := ma.initVTable(def); nil != err {
+		return err
+	}
+
+	init := ma.beginInit(nil, def)
+	ma.ClassMapLock.Lock()
+	ma.ClassMap[def.FullClassName] = def
+	ma.ClassMapLock.Unlock()
+
+	return ma.initialize(def, init)
+}
+
+// static int x; <clinit>先调用native的hook(), 再执行x = other.x + 1
+func newClassInitTestClass(name string, other string) *class.DefFile {
+	b := newClassBuilder(name, "java/lang/Object")
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"x": {FieldValue: 0, FieldType: "int"}}
+	b.method(accflag.Static | accflag.Native, "hook", "()V", 0, 0, nil)
+
+	code := newCodeAssembler().
+		emitIndex(bcode.Invokestatic, b.methodRef(name, "hook", "()V")).
+		emitIndex(bcode.Getstatic, b.fieldRef(other, "x", "I")).
+		emit(bcode.Iconst1, bcode.Iadd).
+		emitIndex(bcode.Putstatic, b.fieldRef(name, "x", "I")).
+		emit(bcode.Return)
+	b.method(accflag.Static, "<clinit>", "()V", 2, 0, code)
+
+	return b.def
+}
+
+func TestClassInitDeadlockDetected(t *testing.T) {
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 两个<clinit>都开始执行后才互相访问
+	barrier := new(sync.WaitGroup)
+	barrier.Add(2)
+	hook := func(args ...interface{}) interface{} {
+		barrier.Done()
+		barrier.Wait()
+		return nil
+	}
+	jvm.NativeMethodTable.RegisterMethod("com.fh.A", "hook", "()V", hook)
+	jvm.NativeMethodTable.RegisterMethod("com.fh.B", "hook", "()V", hook)
+
+	errs := make(chan error, 2)
+	for _, def := range []*class.DefFile{newClassInitTestClass("com/fh/A", "com/fh/B"), newClassInitTestClass("com/fh/B", "com/fh/A")} {
+		go func(def *class.DefFile) {
+			errs <- defineTestClass(jvm.MethodArea, def)
+		}(def)
+	}
+
+	var deadlocks []*ClassInitDeadlockError
+	for ix := 0; ix < 2; ix++ {
+		select {
+		case err := <-errs:
+			var deadlock *ClassInitDeadlockError
+			if errors.As(err, &deadlock) {
+				deadlocks = append(deadlocks, deadlock)
+			} else if nil != err {
+				t.Fatal(err)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatal("class initialization hangs")
+		}
+	}
+
+	// 后开始等待的线程发现死锁, 另一个线程随后完成初始化
+	if 1 != len(deadlocks) {
+		t.Fatalf("expect exactly one deadlock, got %d", len(deadlocks))
+	}
+	cycle := deadlocks[0].Cycle
+	if 2 != len(cycle) || cycle[0].ClassName == cycle[1].ClassName ||
+		cycle[0].OwnerThreadID != cycle[1].ThreadID || cycle[1].OwnerThreadID != cycle[0].ThreadID {
+		t.Fatalf("unexpected cycle: %v", deadlocks[0])
+	}
+}
+
+func TestClassInitWaitsForOtherThread(t *testing.T) {
+	// Reader.read()读取A.x, A的<clinit>把A.x设置为B.x + 1
+	reader := newClassBuilder("com/fh/Reader", "java/lang/Object")
+	reader.method(accflag.Static, "read", "()I", 1, 0, newCodeAssembler().
+		emitIndex(bcode.Getstatic, reader.fieldRef("com/fh/A", "x", "I")).
+		emit(bcode.Ireturn))
+	b := newClassBuilder("com/fh/B", "java/lang/Object")
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"x": {FieldValue: 41, FieldType: "int"}}
+
+	jvm, err := newClassInitTestJvm(reader.def, b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma := jvm.MethodArea
+
+	// A的<clinit>开始后, 等到读取线程进入等待才继续
+	started := make(chan struct{})
+	jvm.NativeMethodTable.RegisterMethod("com.fh.A", "hook", "()V", func(args ...interface{}) interface{} {
+		close(started)
+		for {
+			ma.initLock.Lock()
+			waiting := len(ma.initWaiters)
+			ma.initLock.Unlock()
+			if waiting > 0 {
+				return nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- defineTestClass(ma, newClassInitTestClass("com/fh/A", "com/fh/B"))
+	}()
+	<-started
+
+	frame := &MethodStackFrame{opStack: NewOpStack(1), threadID: nextThreadID()}
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(reader.def, "read", "()I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if val, _ := frame.opStack.Pop(); 42 != val {
+		t.Fatalf("read A.x before <clinit> completed: %v", val)
+	}
+	if err := <-errs; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestClassInitWaitsWithoutFrame(t *testing.T) {
+	b := newClassBuilder("com/fh/B", "java/lang/Object")
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"x": {FieldValue: 41, FieldType: "int"}}
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma := jvm.MethodArea
+
+	// <clinit>中的本地方法用自己的栈帧加载A, 与<clinit>是同一个线程, 不能等待自己
+	started := make(chan struct{})
+	release := make(chan struct{})
+	jvm.NativeMethodTable.RegisterFrameAwareMethod("com.fh.A", "hook", "()V", func(args ...interface{}) interface{} {
+		if _, err := ma.loadClassInFrame(args[2].(*MethodStackFrame), "com/fh/A"); nil != err {
+			return err
+		}
+		close(started)
+		<-release
+		return nil
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- defineTestClass(ma, newClassInitTestClass("com/fh/A", "com/fh/B"))
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("<clinit> blocked on its own class")
+	}
+
+	// 没有栈帧的调用者作为新的线程, 等到<clinit>完成后才拿到类
+	loaded := make(chan *class.DefFile, 1)
+	go func() {
+		def, _ := ma.LoadClass("com/fh/A")
+		loaded <- def
+	}()
+	select {
+	case <-loaded:
+		t.Fatal("got class before <clinit> completed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	def := <-loaded
+	if x := def.GetStaticField("x"); nil == x || 42 != x.FieldValue {
+		t.Fatalf("unexpected A.x %v", x)
+	}
+	if err := <-errs; nil != err {
+		t.Fatal(err)
+	}
+}
+
+// class A { static A inst = new B(); }  class B extends A {}
+// <clinit>中创建子类对象时按结构加载父类A, 不能等待自己
+func TestClassInitCreatesSubclass(t *testing.T) {
+	a := newClassBuilder("com/fh/A", "java/lang/Object")
+	a.def.ParsedStaticFields = map[string]*class.ObjectField{"inst": {FieldType: "Lcom/fh/A;"}}
+	a.method(accflag.Public, "<init>", "()V", 0, 1, newCodeAssembler().emit(bcode.Return))
+	a.method(accflag.Static, "<clinit>", "()V", 2, 0, newCodeAssembler().
+		emitIndex(bcode.New, a.classRef("com/fh/B")).
+		emit(bcode.Dup).
+		emitIndex(bcode.Invokespecial, a.methodRef("com/fh/B", "<init>", "()V")).
+		emitIndex(bcode.Putstatic, a.fieldRef("com/fh/A", "inst", "Lcom/fh/A;")).
+		emit(bcode.Return))
+	b := newClassBuilder("com/fh/B", "com/fh/A")
+	b.method(accflag.Public, "<init>", "()V", 1, 1, newCodeAssembler().
+		emit(bcode.Aload0).
+		emitIndex(bcode.Invokespecial, b.methodRef("com/fh/A", "<init>", "()V")).
+		emit(bcode.Return))
+	jvm, err := newClassInitTestJvm(a.def, b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	loaded := make(chan error, 1)
+	go func() {
+		loaded <- defineTestClass(jvm.MethodArea, a.def)
+	}()
+	select {
+	case err := <-loaded:
+		if nil != err {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("<clinit> blocked on its own class")
+	}
+
+	inst, _ := a.def.GetStaticFieldValue("inst")
+	if ref, ok := inst.(*class.Reference); !ok || nil == ref || "com/fh/B" != ref.Object.DefFile.FullClassName {
+		t.Fatalf("unexpected A.inst %v", inst)
+	}
+}
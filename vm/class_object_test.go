@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestClassObjectIsCanonical(t *testing.T) {
+	object := newTestClass("java/lang/Object", "", nil)
+	classDef := newTestClass("java/lang/Class", "java/lang/Object", nil)
+	foo := newTestClass("com/fh/Foo", "java/lang/Object", nil)
+	bar := newTestClass("com/fh/Bar", "java/lang/Object", nil)
+
+	ma, err := newTestMethodArea(object, classDef, foo, bar)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	fooClass, err := ma.ClassObjectOf(foo)
+	if nil != err {
+		t.Fatal(err)
+	}
+	again, err := ma.ClassObjectOf(foo)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if fooClass != again {
+		t.Fatal("class object of the same class should be identical")
+	}
+	if foo != fooClass.Object.Mirror {
+		t.Fatal("class object should refer to the class it represents")
+	}
+
+	barClass, err := ma.ClassObjectOf(bar)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if fooClass == barClass {
+		t.Fatal("different classes should have different class objects")
+	}
+
+	if ClassIsInterface(nil, barClass).(bool) {
+		t.Fatal("com/fh/Bar is not an interface")
+	}
+}
+
+func TestArrayClassObjectIsCanonical(t *testing.T) {
+	object := newTestClass("java/lang/Object", "", nil)
+	classDef := newTestClass("java/lang/Class", "java/lang/Object", nil)
+	str := newTestClass("java/lang/String", "java/lang/Object", nil)
+	ma, err := newTestMethodArea(object, classDef, str)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm := &MiniJvm{MethodArea: ma}
+
+	// ldc [Ljava/lang/String;
+	ldcClass, err := ma.ArrayClassObjectOf("[Ljava/lang/String;")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	arr, err := class.NewObjectArray(2, "java/lang/String")
+	if nil != err {
+		t.Fatal(err)
+	}
+	getClass, ok := ObjectGetClass(jvm, arr).(*class.Reference)
+	if !ok {
+		t.Fatalf("getClass failed: %v", ObjectGetClass(jvm, arr))
+	}
+	if ldcClass != getClass || getClass != ObjectGetClass(jvm, arr) {
+		t.Fatal("class object of the same array type should be identical")
+	}
+
+	intArr, err := class.NewArray(3, atype.Int)
+	if nil != err {
+		t.Fatal(err)
+	}
+	intClass := ObjectGetClass(jvm, intArr).(*class.Reference)
+	if intClass == getClass {
+		t.Fatal("different array types should have different class objects")
+	}
+
+	for expected, classRef := range map[string]*class.Reference{"[Ljava.lang.String;": getClass, "[I": intClass} {
+		nameRef, ok := ClassGetName0(jvm, classRef).(*class.Reference)
+		if !ok {
+			t.Fatalf("getName failed: %v", ClassGetName0(jvm, classRef))
+		}
+		name, err := class.StringRunes(nameRef)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if expected != string(name) {
+			t.Fatalf("expected %s, got %s", expected, string(name))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 类级别的加载/执行策略, 与本地方法的Policy互补: 被拒绝的类既不能加载, 已加载的也不能再被new, 调用static方法或访问static字段;
+// 模式是类全名(如java.io.File), 或者以.*结尾的包名前缀(包括子包, 如com.sun.*)
+type ClassPolicy struct {
+	lock sync.RWMutex
+
+	// 不为空时只允许匹配的类; 注意guest程序用到的java.lang等基础类也需要加入
+	allow []string
+	// 匹配的类一律拒绝, 优先于allow
+	deny []string
+}
+
+func NewClassPolicy() *ClassPolicy {
+	return new(ClassPolicy)
+}
+
+func (p *ClassPolicy) Allow(patterns ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.allow = append(p.allow, normalizeClassPatterns(patterns)...)
+}
+
+func (p *ClassPolicy) Deny(patterns ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.deny = append(p.deny, normalizeClassPatterns(patterns)...)
+}
+
+// 类是否允许加载和执行, 类名可以用/或.分隔
+func (p *ClassPolicy) Allowed(className string) bool {
+	className = strings.ReplaceAll(className, "/", ".")
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, pattern := range p.deny {
+		if matchClassPattern(pattern, className) {
+			return false
+		}
+	}
+
+	if 0 == len(p.allow) {
+		return true
+	}
+	for _, pattern := range p.allow {
+		if matchClassPattern(pattern, className) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 不允许时返回java.lang.SecurityException
+func (p *ClassPolicy) check(className string) error {
+	if p.Allowed(className) {
+		return nil
+	}
+
+	return fmt.Errorf("java.lang.SecurityException: class '%s' is denied by class policy", strings.ReplaceAll(className, "/", "."))
+}
+
+func normalizeClassPatterns(patterns []string) []string {
+	var res []string
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); "" != pattern {
+			res = append(res, strings.ReplaceAll(pattern, "/", "."))
+		}
+	}
+
+	return res
+}
+
+func matchClassPattern(pattern string, className string) bool {
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(className, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return pattern == className
+}
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassPolicyAllowed(t *testing.T) {
+	policy := NewClassPolicy()
+	if !policy.Allowed("java/io/File") {
+		t.Fatal("empty policy should allow everything")
+	}
+
+	policy.Allow("java.lang.*", "com.fh.*")
+	policy.Deny("com/fh/internal/*", "java.lang.Runtime")
+
+	cases := map[string]bool{
+		"java/lang/String":         true,
+		"java.lang.reflect.Method": true,
+		"java/lang/Runtime":        false,
+		"com/fh/Main":              true,
+		"com/fh/internal/Secret":   false,
+		"java/io/File":             false,
+		"com/fhx/Other":            false,
+	}
+	for name, expected := range cases {
+		if expected != policy.Allowed(name) {
+			t.Errorf("%s: expect allowed=%v", name, expected)
+		}
+	}
+}
+
+func TestClassPolicyDeniesLoadedClass(t *testing.T) {
+	ma, err := newTestMethodArea(append(benchRuntimeClasses(), newClassBuilder("java/io/File", "java/lang/Object").def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma.Jvm = &MiniJvm{MethodArea: ma}
+
+	if _, err := ma.LoadClass("java/io/File"); nil != err {
+		t.Fatal(err)
+	}
+
+	// 策略设置之后, 已加载的类也不能再使用
+	ma.ClassPolicy = NewClassPolicy()
+	ma.ClassPolicy.Deny("java.io.*")
+	_, err = ma.LoadClass("java/io/File")
+	if nil == err || !strings.HasPrefix(err.Error(), "java.lang.SecurityException") {
+		t.Fatalf("expect SecurityException, got %v", err)
+	}
+	if _, err := ma.LoadClass("java/lang/String"); nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"sync"
+	"time"
+)
+
+// 虚拟机时钟, System.currentTimeMillis()/nanoTime()以及java.time中获取当前时间的地方都从这里取时间;
+// 替换成FixedClock可以让依赖当前时间的程序输出可复现
+type Clock interface {
+	Now() time.Time
+}
+
+// 使用宿主机时间
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var SystemClock Clock = systemClock{}
+
+// 确定性时钟, 从Start开始, 每读取一次前进Step
+type FixedClock struct {
+	Start time.Time
+	Step  time.Duration
+
+	lock    sync.Mutex
+	current time.Time
+	started bool
+}
+
+func NewFixedClock(start time.Time, step time.Duration) *FixedClock {
+	return &FixedClock{
+		Start: start,
+		Step:  step,
+	}
+}
+
+func (c *FixedClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.started {
+		c.current = c.Start
+		c.started = true
+	}
+
+	now := c.current
+	c.current = c.current.Add(c.Step)
+
+	return now
+}
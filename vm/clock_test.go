@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	jvm := &MiniJvm{Clock: NewFixedClock(start, time.Millisecond)}
+
+	millis := SystemCurrentTimeMillis(jvm, nil).(int64)
+	if start.UnixNano() / int64(time.Millisecond) != millis {
+		t.Fatalf("unexpected millis %d", millis)
+	}
+
+	// 每次读取前进1毫秒
+	nanos := SystemNanoTime(jvm, nil).(int64)
+	if start.Add(time.Millisecond).UnixNano() != nanos {
+		t.Fatalf("unexpected nanos %d", nanos)
+	}
+
+	adjustment := VMGetNanoTimeAdjustment(jvm, nil, start.Unix()).(int64)
+	if int64(2 * time.Millisecond) != adjustment {
+		t.Fatalf("unexpected adjustment %d", adjustment)
+	}
+}
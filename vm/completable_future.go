@@ -0,0 +1,269 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+)
+
+// CompletableFuture的go实现;
+// JDK的实现依赖ForkJoinPool和大量Unsafe操作, 这里创建的仍然是java/util/concurrent/CompletableFuture对象,
+// 状态保存在go端, 常用方法注册为intrinsic; 异步任务在新的goroutine中执行, 相当于每个任务一个线程
+const completableFutureClassName = "java/util/concurrent/CompletableFuture"
+
+type guestCompletable struct {
+	result interface{}
+	// 任务抛出的异常, 或者执行出错
+	err error
+
+	// 完成后关闭
+	done chan struct{}
+	// 完成时在完成者的线程中执行的回调, 参数为完成者线程的栈帧
+	callbacks []func(frame *MethodStackFrame)
+	lock      sync.Mutex
+}
+
+// 状态保存在CompletableFuture对象上, 随对象一起回收
+func completableOf(ref *class.Reference) *guestCompletable {
+	if state, ok := ref.Object.HostState().(*guestCompletable); ok {
+		return state
+	}
+
+	// new CompletableFuture<>()创建的对象第一次使用时才有go端状态
+	return ref.Object.LoadOrStoreHostState(&guestCompletable{done: make(chan struct{})}).(*guestCompletable)
+}
+
+func newCompletableFuture(jvm *MiniJvm) (*class.Reference, *guestCompletable, error) {
+	def, err := jvm.MethodArea.LoadClass(completableFutureClassName)
+	if nil != err {
+		return nil, nil, fmt.Errorf("failed to load '%s': %w", completableFutureClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	return ref, completableOf(ref), nil
+}
+
+// 完成并执行回调, 已经完成时返回false
+func (c *guestCompletable) complete(frame *MethodStackFrame, result interface{}, err error) bool {
+	c.lock.Lock()
+	select {
+	case <-c.done:
+		c.lock.Unlock()
+		return false
+	default:
+	}
+
+	c.result, c.err = result, err
+	close(c.done)
+	callbacks := c.callbacks
+	c.callbacks = nil
+	c.lock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(frame)
+	}
+
+	return true
+}
+
+// 已经完成时在当前线程立即执行回调, 否则在完成者的线程中执行
+func (c *guestCompletable) whenComplete(frame *MethodStackFrame, callback func(frame *MethodStackFrame)) {
+	c.lock.Lock()
+	select {
+	case <-c.done:
+		c.lock.Unlock()
+		callback(frame)
+		return
+	default:
+	}
+
+	c.callbacks = append(c.callbacks, callback)
+	c.lock.Unlock()
+}
+
+// 等待完成, 异常按exceptionClass包装, join()为CompletionException, get()为ExecutionException
+func (c *guestCompletable) await(exceptionClass string) interface{} {
+	<-c.done
+
+	if thrown, ok := c.err.(*ExceptionThrownError); ok {
+		return fmt.Errorf("%s: %s", exceptionClass, thrown.ExceptionRef.Object.DefFile.FullClassName)
+	}
+	if nil != c.err {
+		return fmt.Errorf("%s: %v", exceptionClass, c.err)
+	}
+
+	return c.result
+}
+
+// 在frame所在线程中按实际类型调用receiver的实例方法, 返回值类型为void时返回nil
+func (m *MiniJvm) invokeMethod(frame *MethodStackFrame, receiver *class.Reference, methodName string, descriptor string, args ...interface{}) (interface{}, error) {
+	if nil == receiver {
+		return nil, fmt.Errorf("java.lang.NullPointerException: cannot invoke '%s' on null", methodName)
+	}
+
+	// 辅助栈帧只用来传递参数和返回值, 不出现在调用栈中
+	helper := &MethodStackFrame{
+		opStack:   NewOpStack(len(args) + 1),
+		depth:     frame.depth,
+		prevFrame: frame,
+	}
+	helper.opStack.Push(receiver)
+	for _, arg := range args {
+		helper.opStack.Push(arg)
+	}
+
+	err := m.ExecutionEngine.ExecuteWithFrame(receiver.Object.DefFile, methodName, descriptor, helper, true)
+	if nil != err {
+		return nil, err
+	}
+	if 'V' == descriptor[len(descriptor) - 1] {
+		return nil, nil
+	}
+
+	ret, _ := helper.opStack.Pop()
+	return ret, nil
+}
+
+// 在新的goroutine中执行task, 结果放入新创建的CompletableFuture
+func runAsync(jvm *MiniJvm, task func(frame *MethodStackFrame) (interface{}, error)) interface{} {
+	ref, state, err := newCompletableFuture(jvm)
+	if nil != err {
+		return err
+	}
+
+	go func() {
+		root := newRootFrame()
+
+		// 与MiniThread一样, 防止任务中的错误导致进程崩溃
+		defer func() {
+			if r := recover(); nil != r {
+				state.complete(root, nil, fmt.Errorf("task panicked: %v", r))
+			}
+		}()
+
+		result, err := task(root)
+		state.complete(root, result, err)
+	}()
+
+	return ref
+}
+
+// 源完成后在完成者线程中执行fn, 结果放入新创建的CompletableFuture; 源异常完成时不执行fn, 直接传递异常
+func thenDepend(jvm *MiniJvm, sourceRef *class.Reference, frame *MethodStackFrame, fn func(frame *MethodStackFrame, result interface{}) (interface{}, error)) interface{} {
+	ref, state, err := newCompletableFuture(jvm)
+	if nil != err {
+		return err
+	}
+
+	source := completableOf(sourceRef)
+	source.whenComplete(frame, func(frame *MethodStackFrame) {
+		if nil != source.err {
+			state.complete(frame, nil, source.err)
+			return
+		}
+
+		result, err := fn(frame, source.result)
+		state.complete(frame, result, err)
+	})
+
+	return ref
+}
+
+// public static <U> CompletableFuture<U> supplyAsync(Supplier<U> supplier)
+func CompletableFutureSupplyAsync(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	supplier, _ := args[2].(*class.Reference)
+
+	return runAsync(jvm, func(frame *MethodStackFrame) (interface{}, error) {
+		return jvm.invokeMethod(frame, supplier, "get", "()Ljava/lang/Object;")
+	})
+}
+
+// public static CompletableFuture<Void> runAsync(Runnable runnable)
+func CompletableFutureRunAsync(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	runnable, _ := args[2].(*class.Reference)
+
+	return runAsync(jvm, func(frame *MethodStackFrame) (interface{}, error) {
+		return jvm.invokeMethod(frame, runnable, "run", "()V")
+	})
+}
+
+// public static <U> CompletableFuture<U> completedFuture(U value)
+func CompletableFutureCompletedFuture(args ...interface{}) interface{} {
+	ref, state, err := newCompletableFuture(args[0].(*MiniJvm))
+	if nil != err {
+		return err
+	}
+	state.complete(nil, args[2], nil)
+
+	return ref
+}
+
+// public <U> CompletableFuture<U> thenApply(Function<? super T,? extends U> fn)
+func CompletableFutureThenApply(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	fn, _ := args[2].(*class.Reference)
+
+	return thenDepend(jvm, args[1].(*class.Reference), args[3].(*MethodStackFrame), func(frame *MethodStackFrame, result interface{}) (interface{}, error) {
+		return jvm.invokeMethod(frame, fn, "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", result)
+	})
+}
+
+// public CompletableFuture<Void> thenAccept(Consumer<? super T> action)
+func CompletableFutureThenAccept(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	action, _ := args[2].(*class.Reference)
+
+	return thenDepend(jvm, args[1].(*class.Reference), args[3].(*MethodStackFrame), func(frame *MethodStackFrame, result interface{}) (interface{}, error) {
+		return jvm.invokeMethod(frame, action, "accept", "(Ljava/lang/Object;)V", result)
+	})
+}
+
+// public CompletableFuture<Void> thenRun(Runnable action)
+func CompletableFutureThenRun(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	action, _ := args[2].(*class.Reference)
+
+	return thenDepend(jvm, args[1].(*class.Reference), args[3].(*MethodStackFrame), func(frame *MethodStackFrame, result interface{}) (interface{}, error) {
+		return jvm.invokeMethod(frame, action, "run", "()V")
+	})
+}
+
+// public T join(), 异常完成时抛出CompletionException
+func CompletableFutureJoin(args ...interface{}) interface{} {
+	return completableOf(args[1].(*class.Reference)).await("java.util.concurrent.CompletionException")
+}
+
+// public T get(), 异常完成时抛出ExecutionException
+func CompletableFutureGet(args ...interface{}) interface{} {
+	return completableOf(args[1].(*class.Reference)).await("java.util.concurrent.ExecutionException")
+}
+
+// public T getNow(T valueIfAbsent)
+func CompletableFutureGetNow(args ...interface{}) interface{} {
+	state := completableOf(args[1].(*class.Reference))
+	select {
+	case <-state.done:
+		return state.await("java.util.concurrent.CompletionException")
+	default:
+		return args[2]
+	}
+}
+
+// public boolean complete(T value), 在调用者线程中执行已注册的回调
+func CompletableFutureComplete(args ...interface{}) interface{} {
+	return completableOf(args[1].(*class.Reference)).complete(args[3].(*MethodStackFrame), args[2], nil)
+}
+
+func CompletableFutureIsDone(args ...interface{}) interface{} {
+	select {
+	case <-completableOf(args[1].(*class.Reference)).done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestCompletableFutureChain(t *testing.T) {
+	// get()返回自身, apply(x)返回参数x, accept(x)把x保存到静态字段last
+	task := newClassBuilder("com/fh/Task", "java/lang/Object")
+	task.def.ParsedStaticFields = map[string]*class.ObjectField{"last": {FieldValue: nil, FieldType: "null;java/lang/Object"}}
+	task.method(accflag.Public, "get", "()Ljava/lang/Object;", 1, 1, newCodeAssembler().emit(bcode.Aload0, bcode.Areturn))
+	task.method(accflag.Public, "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", 1, 2, newCodeAssembler().emit(bcode.Aload1, bcode.Areturn))
+	task.method(accflag.Public, "accept", "(Ljava/lang/Object;)V", 1, 2, newCodeAssembler().
+		emit(bcode.Aload1).
+		emitIndex(bcode.Putstatic, task.fieldRef("com/fh/Task", "last", "Ljava/lang/Object;")).
+		emit(bcode.Return))
+
+	jvm, err := newExecutorTestJvm(task.def, newTestClass(completableFutureClassName, "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+	taskRef, err := class.NewObject(task.def, jvm.MethodArea)
+	if nil != err {
+		t.Fatal(err)
+	}
+	frame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+
+	// supplyAsync(task).thenApply(task).join()
+	supplied := CompletableFutureSupplyAsync(jvm, nil, taskRef).(*class.Reference)
+	applied := CompletableFutureThenApply(jvm, supplied, taskRef, frame).(*class.Reference)
+	if result := CompletableFutureJoin(jvm, applied); taskRef != result {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if true != CompletableFutureIsDone(jvm, supplied) {
+		t.Fatal("source should be done")
+	}
+
+	// 完成前注册的回调由complete()的调用者执行
+	ref, _, err := newCompletableFuture(jvm)
+	if nil != err {
+		t.Fatal(err)
+	}
+	accepted := CompletableFutureThenAccept(jvm, ref, taskRef, frame).(*class.Reference)
+	if taskRef != CompletableFutureGetNow(jvm, accepted, taskRef) {
+		t.Fatal("callback executed before completion")
+	}
+	if true != CompletableFutureComplete(jvm, ref, supplied, frame) {
+		t.Fatal("complete should succeed")
+	}
+	if last, _ := task.def.GetStaticFieldValue("last"); supplied != last {
+		t.Fatalf("callback not executed: %v", last)
+	}
+	if nil != CompletableFutureJoin(jvm, accepted) {
+		t.Fatal("thenAccept should complete with null")
+	}
+	if false != CompletableFutureComplete(jvm, ref, taskRef, frame) {
+		t.Fatal("future can only be completed once")
+	}
+}
@@ -0,0 +1,45 @@
+//go:build js && wasm
+// +build js,wasm
+
+package vm
+
+import (
+	"bytes"
+	"sync"
+	"syscall/js"
+)
+
+func init() {
+	hostStdout = newConsoleWriter("log")
+	hostStderr = newConsoleWriter("error")
+}
+
+// 按行输出到浏览器控制台的Writer, 不完整的行先缓存, 等到换行时再输出
+type consoleWriter struct {
+	method string
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+func newConsoleWriter(method string) *consoleWriter {
+	return &consoleWriter{method: method}
+}
+
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		ix := bytes.IndexByte(w.buf, '\n')
+		if -1 == ix {
+			break
+		}
+
+		js.Global().Get("console").Call(w.method, string(w.buf[:ix]))
+		w.buf = w.buf[ix + 1:]
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,488 @@
+package convert
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"reflect"
+	"sort"
+	"unicode/utf16"
+)
+
+// guest对象与go值之间的转换;
+// guest -> go:
+//   String -> string, 包装类型 -> 对应的数值/bool/rune, 数组和ArrayList -> []interface{},
+//   HashMap -> map[string]interface{}, 其他对象 -> 以字段名为key的map[string]interface{}
+// go -> guest:
+//   string -> String, 数值/bool/rune -> 包装类型, []interface{} -> ArrayList,
+//   其他slice -> 数组, map[string]X -> HashMap
+type Converter struct {
+	Loader class.Loader
+}
+
+func NewConverter(loader class.Loader) *Converter {
+	return &Converter{Loader: loader}
+}
+
+// 包装类型对应的go类型
+var boxedTypes = map[string]bool{
+	"java/lang/Integer":   true,
+	"java/lang/Long":      true,
+	"java/lang/Short":     true,
+	"java/lang/Byte":      true,
+	"java/lang/Float":     true,
+	"java/lang/Double":    true,
+	"java/lang/Boolean":   true,
+	"java/lang/Character": true,
+}
+
+// 把guest中的值转换成go值
+func (c *Converter) ToGo(val interface{}) (interface{}, error) {
+	return c.toGo(val, make(map[*class.Reference]bool))
+}
+
+// visiting: 当前转换路径上的对象, 用来检测循环引用
+func (c *Converter) toGo(val interface{}, visiting map[*class.Reference]bool) (interface{}, error) {
+	ref, ok := val.(*class.Reference)
+	if !ok {
+		// 基本类型的值原样返回
+		return val, nil
+	}
+	if nil == ref {
+		return nil, nil
+	}
+
+	if visiting[ref] {
+		return nil, fmt.Errorf("cycle detected while converting %s", describe(ref))
+	}
+	visiting[ref] = true
+	defer delete(visiting, ref)
+
+	if class.ReferanceTypeArray == ref.RefType {
+		return c.toGoSlice(ref.Array, ref.Array.Len(), visiting)
+	}
+
+	def := ref.Object.DefFile
+	if "java/lang/String" == def.FullClassName {
+		return string(stringValue(ref)), nil
+	}
+	if boxedTypes[def.FullClassName] {
+		return unbox(def.FullClassName, fieldValue(ref, "value")), nil
+	}
+
+	isList, err := c.isSubclassOf(def, "java/util/ArrayList")
+	if nil != err {
+		return nil, err
+	}
+	if isList {
+		elements, _ := fieldValue(ref, "elementData").(*class.Reference)
+		size, _ := fieldValue(ref, "size").(int)
+		if nil == elements {
+			return []interface{}{}, nil
+		}
+
+		return c.toGoSlice(elements.Array, size, visiting)
+	}
+
+	isMap, err := c.isSubclassOf(def, "java/util/HashMap")
+	if nil != err {
+		return nil, err
+	}
+	if isMap {
+		return c.toGoMap(ref, visiting)
+	}
+
+	return c.toGoFields(ref, visiting)
+}
+
+// byte[]的元素与baload压栈的一样为int
+func (c *Converter) toGoSlice(arr *class.Array, size int, visiting map[*class.Reference]bool) (interface{}, error) {
+	if size > arr.Len() {
+		size = arr.Len()
+	}
+
+	result := make([]interface{}, size)
+	for ix := 0; ix < size; ix++ {
+		elem, err := c.toGo(arr.Load(ix), visiting)
+		if nil != err {
+			return nil, err
+		}
+		result[ix] = elem
+	}
+
+	return result, nil
+}
+
+// 遍历HashMap.table中的每个桶; 树化的桶中TreeNode仍然维护了next链表, 可以同样遍历
+func (c *Converter) toGoMap(ref *class.Reference, visiting map[*class.Reference]bool) (interface{}, error) {
+	result := make(map[string]interface{})
+
+	table, _ := fieldValue(ref, "table").(*class.Reference)
+	if nil == table {
+		return result, nil
+	}
+
+	for ix := 0; ix < table.Array.Len(); ix++ {
+		node, _ := table.Array.Load(ix).(*class.Reference)
+		for nil != node {
+			key, err := c.toGo(fieldValue(node, "key"), visiting)
+			if nil != err {
+				return nil, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key must be string, got %T", key)
+			}
+
+			value, err := c.toGo(fieldValue(node, "value"), visiting)
+			if nil != err {
+				return nil, err
+			}
+			result[keyStr] = value
+
+			node, _ = fieldValue(node, "next").(*class.Reference)
+		}
+	}
+
+	return result, nil
+}
+
+// 普通对象转换成字段名到字段值的map, 只包含非static字段(包括父类字段)
+func (c *Converter) toGoFields(ref *class.Reference, visiting map[*class.Reference]bool) (interface{}, error) {
+	result := make(map[string]interface{})
+
+	for def := ref.Object.DefFile; nil != def; {
+		for _, info := range def.Fields {
+			if info.AccessFlags & accflag.Static > 0 {
+				continue
+			}
+
+			name := def.ConstPool.At(info.NameIndex).(*class.Utf8InfoConst).String()
+			if _, ok := result[name]; ok {
+				// 子类字段覆盖了父类同名字段
+				continue
+			}
+
+			value, err := c.toGo(fieldValue(ref, name), visiting)
+			if nil != err {
+				return nil, err
+			}
+			result[name] = value
+		}
+
+		superName := superClassName(def)
+		if "" == superName || "java/lang/Object" == superName {
+			break
+		}
+
+		var err error
+		def, err = c.Loader.LoadClass(superName)
+		if nil != err {
+			return nil, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+	}
+
+	return result, nil
+}
+
+// 把go值转换成guest中的值
+func (c *Converter) FromGo(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case *class.Reference:
+		return v, nil
+	case string:
+		return class.NewStringObject([]rune(v), c.Loader)
+	case bool:
+		boolVal := 0
+		if v {
+			boolVal = 1
+		}
+		return c.box("java/lang/Boolean", boolVal)
+	case rune:
+		return c.box("java/lang/Character", v)
+	case int:
+		return c.box("java/lang/Integer", v)
+	case int8:
+		return c.box("java/lang/Byte", int(v))
+	case int16:
+		return c.box("java/lang/Short", int(v))
+	case int64:
+		return c.box("java/lang/Long", v)
+	case float32:
+		return c.box("java/lang/Float", v)
+	case float64:
+		return c.box("java/lang/Double", v)
+	case []interface{}:
+		return c.newArrayList(v)
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return c.newArray(rv)
+	case reflect.Map:
+		if reflect.String != rv.Type().Key().Kind() {
+			return nil, fmt.Errorf("map key must be string, got %s", rv.Type().Key())
+		}
+		return c.newHashMap(rv)
+	}
+
+	return nil, fmt.Errorf("unsupported go value type %T", val)
+}
+
+func (c *Converter) box(className string, val interface{}) (interface{}, error) {
+	ref, err := c.newObject(className)
+	if nil != err {
+		return nil, err
+	}
+	setField(ref, "value", val)
+
+	return ref, nil
+}
+
+func (c *Converter) newObject(className string) (*class.Reference, error) {
+	def, err := c.Loader.LoadClass(className)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load '%s': %w", className, err)
+	}
+
+	ref, err := class.NewObject(def, c.Loader)
+	if nil != err {
+		return nil, fmt.Errorf("failed to create '%s' object: %w", className, err)
+	}
+
+	return ref, nil
+}
+
+func (c *Converter) newArrayList(values []interface{}) (interface{}, error) {
+	elements, _ := class.NewObjectArray(len(values), "java/lang/Object")
+	for ix, v := range values {
+		elem, err := c.FromGo(v)
+		if nil != err {
+			return nil, err
+		}
+		elements.Array.Store(ix, elem)
+	}
+
+	list, err := c.newObject("java/util/ArrayList")
+	if nil != err {
+		return nil, err
+	}
+	setField(list, "elementData", elements)
+	setField(list, "size", len(values))
+
+	return list, nil
+}
+
+// 基本类型slice转换成基本类型数组, 其他slice转换成对象数组
+func (c *Converter) newArray(rv reflect.Value) (interface{}, error) {
+	length := rv.Len()
+
+	primitiveTypes := map[reflect.Kind]byte{
+		reflect.Int: atype.Int, reflect.Int32: atype.Char, reflect.Int64: atype.Long, reflect.Int16: atype.Short,
+		reflect.Int8: atype.Byte, reflect.Uint8: atype.Byte, reflect.Bool: atype.Boolean,
+		reflect.Float32: atype.Float, reflect.Float64: atype.Double,
+	}
+
+	elemKind := rv.Type().Elem().Kind()
+	if arrType, ok := primitiveTypes[elemKind]; ok {
+		arr, _ := class.NewArray(length, arrType)
+		for ix := 0; ix < length; ix++ {
+			elem := rv.Index(ix)
+			switch elemKind {
+			case reflect.Int, reflect.Int16, reflect.Int8:
+				arr.Array.Store(ix, int(elem.Int()))
+			case reflect.Uint8:
+				arr.Array.Store(ix, int(int8(elem.Uint())))
+			case reflect.Bool:
+				if elem.Bool() {
+					arr.Array.Store(ix, 1)
+				} else {
+					arr.Array.Store(ix, 0)
+				}
+			default:
+				arr.Array.Store(ix, elem.Interface())
+			}
+		}
+
+		return arr, nil
+	}
+
+	elemClass := "java/lang/Object"
+	if reflect.String == elemKind {
+		elemClass = "java/lang/String"
+	}
+	arr, _ := class.NewObjectArray(length, elemClass)
+	for ix := 0; ix < length; ix++ {
+		elem, err := c.FromGo(rv.Index(ix).Interface())
+		if nil != err {
+			return nil, err
+		}
+		arr.Array.Store(ix, elem)
+	}
+
+	return arr, nil
+}
+
+// 按照HashMap的内部结构直接构造table, 与HashMap.put()的结果一致
+func (c *Converter) newHashMap(rv reflect.Value) (interface{}, error) {
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	// 容量为2的幂, 且保证size不超过容量的3/4
+	capacity := 16
+	for len(keys) > capacity * 3 / 4 {
+		capacity <<= 1
+	}
+
+	table, _ := class.NewObjectArray(capacity, "java/util/HashMap$Node")
+	for _, key := range keys {
+		keyRef, err := class.NewStringObject([]rune(key), c.Loader)
+		if nil != err {
+			return nil, err
+		}
+		value, err := c.FromGo(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+		if nil != err {
+			return nil, err
+		}
+
+		node, err := c.newObject("java/util/HashMap$Node")
+		if nil != err {
+			return nil, err
+		}
+		hash := spreadHash(stringHashCode(key))
+		setField(node, "hash", int(hash))
+		setField(node, "key", keyRef)
+		setField(node, "value", value)
+
+		// 追加到桶的末尾
+		index := int(uint32(hash) & uint32(capacity - 1))
+		if head, _ := table.Array.Load(index).(*class.Reference); nil == head {
+			table.Array.Store(index, node)
+		} else {
+			tail := head
+			for next, _ := fieldValue(tail, "next").(*class.Reference); nil != next; next, _ = fieldValue(tail, "next").(*class.Reference) {
+				tail = next
+			}
+			setField(tail, "next", node)
+		}
+	}
+
+	m, err := c.newObject("java/util/HashMap")
+	if nil != err {
+		return nil, err
+	}
+	setField(m, "table", table)
+	setField(m, "size", len(keys))
+	setField(m, "threshold", capacity * 3 / 4)
+	setField(m, "loadFactor", float32(0.75))
+
+	return m, nil
+}
+
+// String.hashCode()
+func stringHashCode(s string) int32 {
+	var h int32
+	for _, unit := range utf16.Encode([]rune(s)) {
+		h = 31 * h + int32(unit)
+	}
+
+	return h
+}
+
+// HashMap.hash(): 高16位异或到低16位
+func spreadHash(h int32) int32 {
+	return h ^ int32(uint32(h) >> 16)
+}
+
+func unbox(className string, val interface{}) interface{} {
+	switch className {
+	case "java/lang/Boolean":
+		switch v := val.(type) {
+		case bool:
+			return v
+		case int:
+			return 0 != v
+		}
+		return false
+
+	case "java/lang/Character":
+		switch v := val.(type) {
+		case rune:
+			return v
+		case int:
+			return rune(v)
+		}
+		return rune(0)
+
+	case "java/lang/Long":
+		if v, ok := val.(int); ok {
+			return int64(v)
+		}
+
+	case "java/lang/Float":
+		if v, ok := val.(float64); ok {
+			return float32(v)
+		}
+	}
+
+	return val
+}
+
+func fieldValue(ref *class.Reference, name string) interface{} {
+	val, _ := ref.Object.GetFieldValue(name)
+	return val
+}
+
+func setField(ref *class.Reference, name string, val interface{}) {
+	ref.Object.PutFieldValue(name, val)
+}
+
+func stringValue(strRef *class.Reference) []rune {
+	runes, _ := class.StringRunes(strRef)
+	return runes
+}
+
+func superClassName(def *class.DefFile) string {
+	if 0 == def.SuperClass {
+		return ""
+	}
+
+	superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+	return def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+}
+
+func (c *Converter) isSubclassOf(def *class.DefFile, className string) (bool, error) {
+	for current := def; nil != current; {
+		if className == current.FullClassName {
+			return true, nil
+		}
+
+		superName := superClassName(current)
+		if "" == superName || "java/lang/Object" == superName {
+			return false, nil
+		}
+
+		var err error
+		current, err = c.Loader.LoadClass(superName)
+		if nil != err {
+			return false, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+	}
+
+	return false, nil
+}
+
+func describe(ref *class.Reference) string {
+	if class.ReferanceTypeArray == ref.RefType {
+		return "array"
+	}
+
+	return ref.Object.DefFile.FullClassName
+}
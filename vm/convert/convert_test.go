@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"github.com/wanghongfei/mini-jvm/vm/internal/testutil"
+	"reflect"
+	"testing"
+)
+
+func TestArrayRoundTrip(t *testing.T) {
+	c := NewConverter(testutil.NewStubLoader())
+
+	guest, err := c.FromGo([]string{"hello", "世界"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "java/lang/String" != guest.(*class.Reference).Array.ObjectType {
+		t.Fatal("String[] expected")
+	}
+
+	val, err := c.ToGo(guest)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]interface{}{"hello", "世界"}, val) {
+		t.Fatalf("unexpected value %v", val)
+	}
+
+	guest, err = c.FromGo([]int{1, 2, 3})
+	if nil != err {
+		t.Fatal(err)
+	}
+	val, err = c.ToGo(guest)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]interface{}{1, 2, 3}, val) {
+		t.Fatalf("unexpected value %v", val)
+	}
+}
+
+func TestCycleDetection(t *testing.T) {
+	c := NewConverter(testutil.NewStubLoader())
+
+	arr, _ := class.NewObjectArray(1, "java/lang/Object")
+	arr.Array.Data[0] = arr
+	if _, err := c.ToGo(arr); nil == err {
+		t.Fatal("cycle should be detected")
+	}
+}
+
+func TestStringHashCode(t *testing.T) {
+	// "hello".hashCode()
+	if 99162322 != stringHashCode("hello") {
+		t.Fatalf("unexpected hash %d", stringHashCode("hello"))
+	}
+	if 99162322 ^ (99162322 >> 16) != spreadHash(99162322) {
+		t.Fatal("unexpected spread hash")
+	}
+}
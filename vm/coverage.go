@@ -0,0 +1,565 @@
+package vm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 指令级的代码覆盖率: 记录每个方法中每条指令的执行次数, 由MiniJvm.CoverageReport()按LineNumberTable汇总成行覆盖率,
+// 可以输出文本摘要, lcov和JaCoCo XML格式, 让虚拟机可以作为轻量的覆盖率工具使用
+type Coverage struct {
+	// 只统计匹配的类, 如com.fh.*, 为空时统计所有类
+	patterns []string
+
+	// key: *class.MethodInfo, val: *methodHits
+	methods sync.Map
+}
+
+// 一个方法中每个pc的执行次数, 只有指令起点的计数有意义;
+// 不统计的类hits为nil, 避免每个栈帧都重新匹配类名
+type methodHits struct {
+	hits []uint32
+}
+
+// classPatterns为空时统计所有类
+func NewCoverage(classPatterns ...string) *Coverage {
+	return &Coverage{patterns: normalizeClassPatterns(classPatterns)}
+}
+
+func (c *Coverage) matches(className string) bool {
+	return 0 == len(c.patterns) || matchAnyClassPattern(c.patterns, strings.ReplaceAll(className, "/", "."))
+}
+
+// 执行引擎每条指令执行前调用; 计数器在栈帧中缓存, 每个栈帧只查找一次
+func (c *Coverage) onInstruction(frame *MethodStackFrame) {
+	if nil == frame.coverage {
+		frame.coverage = c.hitsOf(frame.method, len(frame.codeAttr.Code))
+	}
+	if nil != frame.coverage.hits {
+		atomic.AddUint32(&frame.coverage.hits[frame.pc], 1)
+	}
+}
+
+func (c *Coverage) hitsOf(method *class.MethodInfo, codeLength int) *methodHits {
+	if val, ok := c.methods.Load(method); ok {
+		return val.(*methodHits)
+	}
+
+	newHits := new(methodHits)
+	if c.matches(method.DefFile.FullClassName) {
+		newHits.hits = make([]uint32, codeLength)
+	}
+	val, _ := c.methods.LoadOrStore(method, newHits)
+
+	return val.(*methodHits)
+}
+
+// 方法中每个pc的执行次数, 没有执行过时返回nil
+func (c *Coverage) loadHits(method *class.MethodInfo) []uint32 {
+	val, ok := c.methods.Load(method)
+	if !ok {
+		return nil
+	}
+
+	src := val.(*methodHits).hits
+	if nil == src {
+		return nil
+	}
+	hits := make([]uint32, len(src))
+	for pc := range src {
+		hits[pc] = atomic.LoadUint32(&src[pc])
+	}
+
+	return hits
+}
+
+// 覆盖率的计数, 如100条指令执行过80条
+type CoverageCounter struct {
+	Covered int
+	Total   int
+}
+
+func (c CoverageCounter) Missed() int {
+	return c.Total - c.Covered
+}
+
+func (c CoverageCounter) Percent() float64 {
+	if 0 == c.Total {
+		return 0
+	}
+
+	return float64(c.Covered) * 100 / float64(c.Total)
+}
+
+func (c CoverageCounter) String() string {
+	return fmt.Sprintf("%d/%d %5.1f%%", c.Covered, c.Total, c.Percent())
+}
+
+func (c *CoverageCounter) add(covered bool) {
+	c.Total++
+	if covered {
+		c.Covered++
+	}
+}
+
+func (c *CoverageCounter) merge(other CoverageCounter) {
+	c.Covered += other.Covered
+	c.Total += other.Total
+}
+
+// 按类汇总的覆盖率, 只包含已经加载的类; 从未执行的方法也会列出, 覆盖率为0
+type CoverageReport struct {
+	Classes []*ClassCoverage
+}
+
+type ClassCoverage struct {
+	// 以/分隔的类全名
+	Name string
+	// SourceFile属性中的源文件名, 没有时为空
+	SourceFile string
+
+	Methods []*MethodCoverage
+}
+
+type MethodCoverage struct {
+	Name       string
+	Descriptor string
+	// 方法的第一行, 没有LineNumberTable时为-1
+	FirstLine int
+	// 方法入口的执行次数, 即调用次数
+	Calls uint32
+
+	Instructions CoverageCounter
+	// 按行号排序, 没有LineNumberTable时为空
+	Lines []*LineCoverage
+}
+
+// 一行源代码的覆盖率; 一行中有指令执行过就算覆盖
+type LineCoverage struct {
+	Line         int
+	Instructions CoverageCounter
+	// 该行的指令中执行次数最多的次数
+	Hits uint32
+}
+
+// 按已加载的类生成覆盖率报告, 没有设置Coverage时返回空报告
+func (m *MiniJvm) CoverageReport() *CoverageReport {
+	report := new(CoverageReport)
+	if nil == m.Coverage {
+		return report
+	}
+
+	m.MethodArea.ClassMapLock.RLock()
+	defs := make([]*class.DefFile, 0, len(m.MethodArea.ClassMap))
+	for _, def := range m.MethodArea.ClassMap {
+		defs = append(defs, def)
+	}
+	m.MethodArea.ClassMapLock.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].FullClassName < defs[j].FullClassName
+	})
+
+	for _, def := range defs {
+		if !m.Coverage.matches(def.FullClassName) {
+			continue
+		}
+
+		classCoverage := &ClassCoverage{Name: def.FullClassName, SourceFile: sourceFileOf(def)}
+		for _, method := range def.Methods {
+			if methodCoverage := m.Coverage.methodCoverage(method); nil != methodCoverage {
+				classCoverage.Methods = append(classCoverage.Methods, methodCoverage)
+			}
+		}
+		if len(classCoverage.Methods) > 0 {
+			report.Classes = append(report.Classes, classCoverage)
+		}
+	}
+
+	return report
+}
+
+// 没有字节码(抽象方法和native方法)时返回nil
+func (c *Coverage) methodCoverage(method *class.MethodInfo) *MethodCoverage {
+	codeAttr, err := findCodeAttr(method)
+	if nil != err || nil == codeAttr {
+		return nil
+	}
+
+	def := method.DefFile
+	res := &MethodCoverage{
+		Name:       def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String(),
+		Descriptor: def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String(),
+		FirstLine:  -1,
+	}
+
+	hits := c.loadHits(method)
+	hitsAt := func(pc int) uint32 {
+		if nil == hits {
+			return 0
+		}
+		return hits[pc]
+	}
+	res.Calls = hitsAt(0)
+
+	var lineTable []*class.LineNumberInfo
+	for _, attr := range codeAttr.Attrs {
+		if lineAttr, ok := attr.(*class.LineNumberAttr); ok {
+			lineTable = append(lineTable, lineAttr.LineNumberTable...)
+		}
+	}
+
+	lines := make(map[int]*LineCoverage)
+	for pc := 0; pc < len(codeAttr.Code); {
+		length, err := bcode.InstructionLength(codeAttr.Code, pc)
+		if nil != err {
+			break
+		}
+
+		count := hitsAt(pc)
+		res.Instructions.add(count > 0)
+		if line := lineAt(lineTable, pc); line > 0 {
+			lineCoverage, ok := lines[line]
+			if !ok {
+				lineCoverage = &LineCoverage{Line: line}
+				lines[line] = lineCoverage
+			}
+			lineCoverage.Instructions.add(count > 0)
+			if count > lineCoverage.Hits {
+				lineCoverage.Hits = count
+			}
+			if res.FirstLine < 0 || line < res.FirstLine {
+				res.FirstLine = line
+			}
+		}
+
+		pc += length
+	}
+	res.Lines = sortedLines(lines)
+
+	return res
+}
+
+// 取start_pc不大于pc的最后一项的行号, 没有时返回-1
+func lineAt(table []*class.LineNumberInfo, pc int) int {
+	line, bestStartPc := -1, -1
+	for _, entry := range table {
+		if int(entry.StartPc) <= pc && int(entry.StartPc) > bestStartPc {
+			bestStartPc = int(entry.StartPc)
+			line = int(entry.LineNumber)
+		}
+	}
+
+	return line
+}
+
+func sortedLines(lines map[int]*LineCoverage) []*LineCoverage {
+	res := make([]*LineCoverage, 0, len(lines))
+	for _, line := range lines {
+		res = append(res, line)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Line < res[j].Line
+	})
+
+	return res
+}
+
+// 合并多个方法(或多个类)中的同一行, 如字段初始化代码会出现在每个构造方法中
+func mergeLines(methods []*MethodCoverage) []*LineCoverage {
+	lines := make(map[int]*LineCoverage)
+	for _, method := range methods {
+		for _, line := range method.Lines {
+			merged, ok := lines[line.Line]
+			if !ok {
+				merged = &LineCoverage{Line: line.Line}
+				lines[line.Line] = merged
+			}
+			merged.Instructions.merge(line.Instructions)
+			if line.Hits > merged.Hits {
+				merged.Hits = line.Hits
+			}
+		}
+	}
+
+	return sortedLines(lines)
+}
+
+func sourceFileOf(def *class.DefFile) string {
+	for _, attr := range def.Attrs {
+		if srcAttr, ok := attr.(*class.SourceFileAttr); ok {
+			return def.ConstPool.At(srcAttr.SourceFileIndex).(*class.Utf8InfoConst).String()
+		}
+	}
+
+	return ""
+}
+
+// 类所在包, 以/分隔, 默认包为空
+func (c *ClassCoverage) Package() string {
+	if ix := strings.LastIndex(c.Name, "/"); ix >= 0 {
+		return c.Name[:ix]
+	}
+
+	return ""
+}
+
+// 源文件相对于源代码根目录的路径, 如com/fh/Foo.java; 没有SourceFile属性时按外部类的类名推断
+func (c *ClassCoverage) SourcePath() string {
+	fileName := c.SourceFile
+	if "" == fileName {
+		fileName = c.Name[strings.LastIndex(c.Name, "/") + 1:]
+		if ix := strings.Index(fileName, "$"); ix > 0 {
+			fileName = fileName[:ix]
+		}
+		fileName += ".java"
+	}
+
+	if pkg := c.Package(); "" != pkg {
+		return pkg + "/" + fileName
+	}
+	return fileName
+}
+
+// 类中所有行的覆盖率
+func (c *ClassCoverage) Lines() []*LineCoverage {
+	return mergeLines(c.Methods)
+}
+
+// 指令, 行和方法的覆盖率; 方法执行过任何一条指令就算覆盖
+func (c *ClassCoverage) Counters() (instructions CoverageCounter, lines CoverageCounter, methods CoverageCounter) {
+	for _, method := range c.Methods {
+		instructions.merge(method.Instructions)
+		methods.add(method.Instructions.Covered > 0)
+	}
+	for _, line := range c.Lines() {
+		lines.add(line.Instructions.Covered > 0)
+	}
+
+	return
+}
+
+// 每个类一行的摘要, 最后是总计
+func (r *CoverageReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%-50s %-22s %-22s %s\n", "class", "instructions", "lines", "methods")
+
+	var totalInstructions, totalLines, totalMethods CoverageCounter
+	for _, cls := range r.Classes {
+		instructions, lines, methods := cls.Counters()
+		totalInstructions.merge(instructions)
+		totalLines.merge(lines)
+		totalMethods.merge(methods)
+
+		fmt.Fprintf(w, "%-50s %-22s %-22s %s\n", strings.ReplaceAll(cls.Name, "/", "."), instructions, lines, methods)
+	}
+	_, err := fmt.Fprintf(w, "%-50s %-22s %-22s %s\n", "total", totalInstructions, totalLines, totalMethods)
+
+	return err
+}
+
+// 输出lcov的tracefile格式(genhtml可以直接生成网页); 同一个源文件中的多个类(如内部类)合并为一条记录
+func (r *CoverageReport) WriteLcov(w io.Writer) error {
+	var paths []string
+	bySource := make(map[string][]*ClassCoverage)
+	for _, cls := range r.Classes {
+		path := cls.SourcePath()
+		if _, ok := bySource[path]; !ok {
+			paths = append(paths, path)
+		}
+		bySource[path] = append(bySource[path], cls)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Fprintf(w, "TN:\nSF:%s\n", path)
+
+		var methods []*MethodCoverage
+		var functions CoverageCounter
+		for _, cls := range bySource[path] {
+			for _, method := range cls.Methods {
+				name := strings.ReplaceAll(cls.Name, "/", ".") + "." + method.Name + method.Descriptor
+				if method.FirstLine > 0 {
+					fmt.Fprintf(w, "FN:%d,%s\n", method.FirstLine, name)
+				}
+				fmt.Fprintf(w, "FNDA:%d,%s\n", method.Calls, name)
+				functions.add(method.Calls > 0)
+			}
+			methods = append(methods, cls.Methods...)
+		}
+		fmt.Fprintf(w, "FNF:%d\nFNH:%d\n", functions.Total, functions.Covered)
+
+		var lines CoverageCounter
+		for _, line := range mergeLines(methods) {
+			fmt.Fprintf(w, "DA:%d,%d\n", line.Line, line.Hits)
+			lines.add(line.Hits > 0)
+		}
+		if _, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", lines.Total, lines.Covered); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// JaCoCo XML报告的元素, 见https://www.jacoco.org/jacoco/trunk/coverage/report.dtd
+type jacocoReport struct {
+	XMLName  xml.Name         `xml:"report"`
+	Name     string           `xml:"name,attr"`
+	Packages []*jacocoPackage `xml:"package"`
+	Counters []*jacocoCounter `xml:"counter"`
+}
+
+type jacocoPackage struct {
+	Name        string              `xml:"name,attr"`
+	Classes     []*jacocoClass      `xml:"class"`
+	SourceFiles []*jacocoSourceFile `xml:"sourcefile"`
+	Counters    []*jacocoCounter    `xml:"counter"`
+}
+
+type jacocoClass struct {
+	Name           string           `xml:"name,attr"`
+	SourceFileName string           `xml:"sourcefilename,attr,omitempty"`
+	Methods        []*jacocoMethod  `xml:"method"`
+	Counters       []*jacocoCounter `xml:"counter"`
+}
+
+type jacocoMethod struct {
+	Name     string           `xml:"name,attr"`
+	Desc     string           `xml:"desc,attr"`
+	Line     int              `xml:"line,attr,omitempty"`
+	Counters []*jacocoCounter `xml:"counter"`
+}
+
+type jacocoSourceFile struct {
+	Name     string           `xml:"name,attr"`
+	Lines    []*jacocoLine    `xml:"line"`
+	Counters []*jacocoCounter `xml:"counter"`
+}
+
+// 不统计分支, mb和cb总是0
+type jacocoLine struct {
+	Nr int `xml:"nr,attr"`
+	Mi int `xml:"mi,attr"`
+	Ci int `xml:"ci,attr"`
+	Mb int `xml:"mb,attr"`
+	Cb int `xml:"cb,attr"`
+}
+
+type jacocoCounter struct {
+	Type    string `xml:"type,attr"`
+	Missed  int    `xml:"missed,attr"`
+	Covered int    `xml:"covered,attr"`
+}
+
+// 按INSTRUCTION, LINE, METHOD, CLASS的顺序生成counter元素, 某一项没有时跳过
+func jacocoCounters(instructions CoverageCounter, lines CoverageCounter, methods CoverageCounter, classes CoverageCounter) []*jacocoCounter {
+	var res []*jacocoCounter
+	for _, item := range []struct {
+		name    string
+		counter CoverageCounter
+	}{{"INSTRUCTION", instructions}, {"LINE", lines}, {"METHOD", methods}, {"CLASS", classes}} {
+		if item.counter.Total > 0 {
+			res = append(res, &jacocoCounter{Type: item.name, Missed: item.counter.Missed(), Covered: item.counter.Covered})
+		}
+	}
+
+	return res
+}
+
+// 输出JaCoCo的XML报告格式, 可以被CI的覆盖率插件读取; 不统计分支覆盖率
+func (r *CoverageReport) WriteJaCoCoXML(w io.Writer) error {
+	report := &jacocoReport{Name: "mini-jvm"}
+
+	var packageNames []string
+	byPackage := make(map[string][]*ClassCoverage)
+	for _, cls := range r.Classes {
+		pkg := cls.Package()
+		if _, ok := byPackage[pkg]; !ok {
+			packageNames = append(packageNames, pkg)
+		}
+		byPackage[pkg] = append(byPackage[pkg], cls)
+	}
+	sort.Strings(packageNames)
+
+	var totalInstructions, totalLines, totalMethods, totalClasses CoverageCounter
+	for _, pkgName := range packageNames {
+		pkg := &jacocoPackage{Name: pkgName}
+		var pkgInstructions, pkgLines, pkgMethods, pkgClasses CoverageCounter
+
+		var sourceNames []string
+		bySource := make(map[string][]*MethodCoverage)
+		for _, cls := range byPackage[pkgName] {
+			instructions, lines, methods := cls.Counters()
+			classes := CoverageCounter{}
+			classes.add(methods.Covered > 0)
+
+			jc := &jacocoClass{Name: cls.Name, SourceFileName: cls.SourceFile}
+			for _, method := range cls.Methods {
+				var methodLines, methodCount CoverageCounter
+				for _, line := range method.Lines {
+					methodLines.add(line.Instructions.Covered > 0)
+				}
+				methodCount.add(method.Instructions.Covered > 0)
+
+				jm := &jacocoMethod{Name: method.Name, Desc: method.Descriptor, Counters: jacocoCounters(method.Instructions, methodLines, methodCount, CoverageCounter{})}
+				if method.FirstLine > 0 {
+					jm.Line = method.FirstLine
+				}
+				jc.Methods = append(jc.Methods, jm)
+			}
+			jc.Counters = jacocoCounters(instructions, lines, methods, classes)
+			pkg.Classes = append(pkg.Classes, jc)
+
+			if "" != cls.SourceFile {
+				if _, ok := bySource[cls.SourceFile]; !ok {
+					sourceNames = append(sourceNames, cls.SourceFile)
+				}
+				bySource[cls.SourceFile] = append(bySource[cls.SourceFile], cls.Methods...)
+			}
+
+			pkgInstructions.merge(instructions)
+			pkgLines.merge(lines)
+			pkgMethods.merge(methods)
+			pkgClasses.merge(classes)
+		}
+
+		sort.Strings(sourceNames)
+		for _, name := range sourceNames {
+			source := &jacocoSourceFile{Name: name}
+			var instructions, lines CoverageCounter
+			for _, line := range mergeLines(bySource[name]) {
+				source.Lines = append(source.Lines, &jacocoLine{Nr: line.Line, Mi: line.Instructions.Missed(), Ci: line.Instructions.Covered})
+				instructions.merge(line.Instructions)
+				lines.add(line.Instructions.Covered > 0)
+			}
+			source.Counters = jacocoCounters(instructions, lines, CoverageCounter{}, CoverageCounter{})
+			pkg.SourceFiles = append(pkg.SourceFiles, source)
+		}
+
+		pkg.Counters = jacocoCounters(pkgInstructions, pkgLines, pkgMethods, pkgClasses)
+		report.Packages = append(report.Packages, pkg)
+
+		totalInstructions.merge(pkgInstructions)
+		totalLines.merge(pkgLines)
+		totalMethods.merge(pkgMethods)
+		totalClasses.merge(pkgClasses)
+	}
+	report.Counters = jacocoCounters(totalInstructions, totalLines, totalMethods, totalClasses)
+
+	io.WriteString(w, xml.Header)
+	io.WriteString(w, `<!DOCTYPE report PUBLIC "-//JACOCO//DTD Report 1.1//EN" "report.dtd">` + "\n")
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); nil != err {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
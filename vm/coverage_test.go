@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+// Calc.java:
+//   4: if (x < 0)
+//   5:     return 0 - x;
+//   6: return x;
+//   9: static void unused() {}
+func newCoverageTestClass() *class.DefFile {
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.def.Attrs = append(b.def.Attrs, &class.SourceFileAttr{SourceFileIndex: b.utf8("Calc.java")})
+
+	b.method(accflag.Static, "abs", "(I)I", 2, 1, newCodeAssembler().
+		emit(bcode.Iload0).jump(bcode.Ifge, "positive").
+		emit(bcode.Iconst0, bcode.Iload0, bcode.Isub, bcode.Ireturn).
+		label("positive").emit(bcode.Iload0, bcode.Ireturn))
+	b.method(accflag.Static, "unused", "()V", 0, 0, newCodeAssembler().emit(bcode.Return))
+
+	withLines := func(method *class.MethodInfo, lines ...uint16) {
+		table := &class.LineNumberAttr{}
+		for ix := 0; ix < len(lines); ix += 2 {
+			table.LineNumberTable = append(table.LineNumberTable, &class.LineNumberInfo{StartPc: lines[ix], LineNumber: lines[ix + 1]})
+		}
+		codeAttr := method.Attrs[0].(*class.CodeAttr)
+		codeAttr.Attrs = append(codeAttr.Attrs, table)
+	}
+	withLines(b.def.Methods[0], 0, 4, 4, 5, 8, 6)
+	withLines(b.def.Methods[1], 0, 9)
+
+	return b.def
+}
+
+func TestCoverage(t *testing.T) {
+	def := newCoverageTestClass()
+	jvm, err := newClassInitTestJvm(def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.Coverage = NewCoverage("com.fh.*")
+
+	frame := newMethodStackFrame(1, 0)
+	frame.opStack.Push(5)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "abs", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+
+	report := jvm.CoverageReport()
+	if 1 != len(report.Classes) || "com/fh/Calc" != report.Classes[0].Name {
+		t.Fatalf("only com.fh.Calc expected, got %d classes", len(report.Classes))
+	}
+	calc := report.Classes[0]
+	if "com/fh/Calc.java" != calc.SourcePath() {
+		t.Fatalf("unexpected source path %s", calc.SourcePath())
+	}
+
+	abs := calc.Methods[0]
+	if 1 != abs.Calls || 4 != abs.FirstLine || (CoverageCounter{Covered: 4, Total: 8}) != abs.Instructions {
+		t.Fatalf("unexpected abs coverage %+v", abs)
+	}
+	instructions, lines, methods := calc.Counters()
+	if 4 != instructions.Covered || 9 != instructions.Total {
+		t.Fatalf("unexpected instructions %v", instructions)
+	}
+	// 第5行没有执行, 第9行所在的方法没有调用
+	if (CoverageCounter{Covered: 2, Total: 4}) != lines || (CoverageCounter{Covered: 1, Total: 2}) != methods {
+		t.Fatalf("unexpected lines %v, methods %v", lines, methods)
+	}
+
+	text := new(bytes.Buffer)
+	if err := report.WriteText(text); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "com.fh.Calc") || !strings.Contains(text.String(), "2/4  50.0%") {
+		t.Fatalf("unexpected text report:\n%s", text)
+	}
+
+	lcov := new(bytes.Buffer)
+	if err := report.WriteLcov(lcov); nil != err {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"SF:com/fh/Calc.java", "FN:4,com.fh.Calc.abs(I)I", "FNDA:1,com.fh.Calc.abs(I)I", "FNDA:0,com.fh.Calc.unused()V",
+		"DA:4,1\nDA:5,0\nDA:6,1\nDA:9,0", "LF:4\nLH:2\nend_of_record"} {
+		if !strings.Contains(lcov.String(), expect) {
+			t.Fatalf("lcov does not contain '%s':\n%s", expect, lcov)
+		}
+	}
+
+	jacoco := new(bytes.Buffer)
+	if err := report.WriteJaCoCoXML(jacoco); nil != err {
+		t.Fatal(err)
+	}
+	parsed := new(jacocoReport)
+	if err := xml.Unmarshal(jacoco.Bytes(), parsed); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(parsed.Packages) || "com/fh" != parsed.Packages[0].Name || 4 != len(parsed.Packages[0].SourceFiles[0].Lines) {
+		t.Fatalf("unexpected jacoco report:\n%s", jacoco)
+	}
+	if counter := parsed.Counters[0]; "INSTRUCTION" != counter.Type || 5 != counter.Missed || 4 != counter.Covered {
+		t.Fatalf("unexpected counter %+v", counter)
+	}
+}
+
+func TestCoverageClassFilter(t *testing.T) {
+	def := newCoverageTestClass()
+	jvm, err := newClassInitTestJvm(def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.Coverage = NewCoverage("com.other.*")
+
+	frame := newMethodStackFrame(1, 0)
+	frame.opStack.Push(-5)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "abs", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if report := jvm.CoverageReport(); 0 != len(report.Classes) {
+		t.Fatalf("no class expected, got %d", len(report.Classes))
+	}
+}
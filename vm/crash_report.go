@@ -0,0 +1,303 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 崩溃报告中反汇编出错位置前后各显示的指令条数
+const crashDisasmWindow = 10
+
+// 第一次致命错误发生的位置, 生成崩溃报告时使用
+type crashSite struct {
+	// 出错的类, 字节码校验和链接失败时为被校验的类
+	def *class.DefFile
+	// 出错的方法, 整个类链接失败时为nil
+	method *class.MethodInfo
+	// 出错指令的pc, 方法还没有开始执行时为-1
+	pc int
+
+	// 出错时的调用链, 从栈顶到栈底; 没有栈帧(如加载主类时)为nil
+	frames []*StackTraceElement
+}
+
+// 需要生成崩溃报告的错误: 解释器panic, 字节码校验和链接失败, 内存耗尽;
+// guest抛出的其他异常, System.exit(), 资源限制和取消都不算
+func isFatalError(err error) bool {
+	if nil == err {
+		return false
+	}
+
+	// guest异常经常被用来控制流程, 这里只做最便宜的判断
+	if thrown, ok := err.(*ExceptionThrownError); ok {
+		return "java/lang/OutOfMemoryError" == thrown.ExceptionRef.Object.DefFile.FullClassName
+	}
+
+	var panicErr *EnginePanicError
+	var link *LinkError
+	if errors.As(err, &panicErr) || errors.As(err, &link) {
+		return true
+	}
+
+	// 链接时返回的"java.lang.VerifyError: ..."会被外层包装, 需要检查错误链的每一层
+	for ; nil != err; err = errors.Unwrap(err) {
+		matches := javaThrowablePattern.FindStringSubmatch(err.Error())
+		if nil == matches {
+			continue
+		}
+		switch matches[1] {
+		case "java.lang.VerifyError", "java.lang.ClassFormatError", "java.lang.OutOfMemoryError":
+			return true
+		}
+	}
+
+	return false
+}
+
+// 记录致命错误的位置, 只保留第一次: 错误沿调用链返回时外层会再次调用, 最内层的位置最有用;
+// frame为出错时的栈帧, 可以为nil
+func (m *MiniJvm) recordCrashSite(err error, def *class.DefFile, method *class.MethodInfo, pc int, frame *MethodStackFrame) {
+	if !isFatalError(err) {
+		return
+	}
+
+	m.crashLock.Lock()
+	defer m.crashLock.Unlock()
+
+	if nil != m.crash {
+		return
+	}
+
+	site := &crashSite{def: def, method: method, pc: pc}
+	if nil != frame {
+		site.frames = frame.StackTrace()
+	}
+	m.crash = site
+}
+
+// 把致命错误的现场写入dir下新建的目录, 返回新建目录的路径; err不是致命错误(见isFatalError)时不写入, 返回空字符串.
+// 目录中包含:
+//   error.txt    错误信息, 解释器panic时还有go的调用栈
+//   frames.txt   出错时的调用链
+//   类名.class   出错的类, 按解析后的内容重新生成
+//   disasm.txt   出错位置前后的字节码, 出错的指令以=>标出; 整个类校验失败时为整个类
+//   heap.txt     按类统计的存活对象数, 需要打开TrackHeap
+//   history.txt  出错线程最近执行的指令, 需要设置History
+//   options.txt  虚拟机的选项和宿主环境
+func (m *MiniJvm) WriteCrashBundle(dir string, err error) (string, error) {
+	if !isFatalError(err) {
+		return "", nil
+	}
+
+	if mkErr := os.MkdirAll(dir, 0755); nil != mkErr {
+		return "", mkErr
+	}
+	bundleDir, mkErr := ioutil.TempDir(dir, "crash-" + time.Now().Format("20060102-150405") + "-")
+	if nil != mkErr {
+		return "", mkErr
+	}
+
+	m.crashLock.Lock()
+	site := m.crash
+	m.crashLock.Unlock()
+
+	files := []crashFile{
+		{"error.txt", func(w io.Writer) error { return writeCrashError(w, err) }},
+		{"frames.txt", func(w io.Writer) error { return writeCrashFrames(w, site) }},
+		{"disasm.txt", func(w io.Writer) error { return writeCrashDisasm(w, site) }},
+		{"heap.txt", m.writeCrashHeap},
+		{"options.txt", m.writeCrashOptions},
+	}
+	if nil != m.History {
+		files = append(files, crashFile{"history.txt", func(w io.Writer) error {
+			m.History.Dump(w, ErrorThreadID(err), nil)
+			return nil
+		}})
+	}
+
+	for _, item := range files {
+		if writeErr := writeCrashFile(filepath.Join(bundleDir, item.name), item.write); nil != writeErr {
+			return bundleDir, fmt.Errorf("failed to write %s: %w", item.name, writeErr)
+		}
+	}
+
+	if nil != site && nil != site.def {
+		classBytes, writeErr := class.WriteClass(site.def)
+		if nil != writeErr {
+			return bundleDir, fmt.Errorf("failed to write class '%s': %w", site.def.FullClassName, writeErr)
+		}
+		name := strings.ReplaceAll(site.def.FullClassName, "/", ".") + ".class"
+		if writeErr := ioutil.WriteFile(filepath.Join(bundleDir, name), classBytes, 0644); nil != writeErr {
+			return bundleDir, writeErr
+		}
+	}
+
+	return bundleDir, nil
+}
+
+// 崩溃报告目录中的一个文件
+type crashFile struct {
+	name  string
+	write func(w io.Writer) error
+}
+
+func writeCrashFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if nil != err {
+		return err
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
+
+func writeCrashError(w io.Writer, err error) error {
+	report := NewErrorReport(err)
+	fmt.Fprintf(w, "kind: %s\n", report.Kind)
+	fmt.Fprintf(w, "time: %s\n\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintln(w, err.Error())
+
+	var panicErr *EnginePanicError
+	if errors.As(err, &panicErr) {
+		fmt.Fprintf(w, "\ngo stack:\n%s", panicErr.Stack)
+	}
+
+	return nil
+}
+
+func writeCrashFrames(w io.Writer, site *crashSite) error {
+	if nil == site || 0 == len(site.frames) {
+		fmt.Fprintln(w, "no guest frames")
+		return nil
+	}
+
+	for _, elem := range site.frames {
+		fmt.Fprintf(w, "at %s.%s%s pc=%d (%s)\n", elem.ClassName, elem.MethodName, elem.MethodDescriptor, elem.Pc, elem.String())
+	}
+
+	return nil
+}
+
+func writeCrashDisasm(w io.Writer, site *crashSite) error {
+	if nil == site || nil == site.def {
+		fmt.Fprintln(w, "no class recorded")
+		return nil
+	}
+
+	// 整个类链接失败时不知道是哪个方法, 反汇编整个类; 字节码本身有问题时输出到出错的位置为止
+	if nil == site.method {
+		if err := DisassembleClass(w, site.def); nil != err {
+			fmt.Fprintf(w, "\n%v\n", err)
+		}
+		return nil
+	}
+
+	def := site.def
+	name := def.ConstPool.At(site.method.NameIndex).(*class.Utf8InfoConst).String()
+	descriptor := def.ConstPool.At(site.method.DescriptorIndex).(*class.Utf8InfoConst).String()
+	fmt.Fprintf(w, "%s.%s%s\n", def.FullClassName, name, descriptor)
+
+	codeAttr, err := findCodeAttr(site.method)
+	if nil != err || nil == codeAttr {
+		fmt.Fprintf(w, "no code: %v\n", err)
+		return nil
+	}
+
+	// 先找出所有指令的起点, 再取出错指令前后的窗口
+	var starts []int
+	var decodeErr error
+	for pc := 0; pc < len(codeAttr.Code); {
+		length, err := bcode.InstructionLength(codeAttr.Code, pc)
+		if nil != err {
+			decodeErr = err
+			break
+		}
+		starts = append(starts, pc)
+		pc += length
+	}
+
+	// 调用方法时pc停在调用指令的最后一个字节, 标出pc所在的指令
+	current := -1
+	from, to := 0, len(starts)
+	if site.pc >= 0 && len(starts) > 0 {
+		ix := sort.SearchInts(starts, site.pc + 1) - 1
+		current = starts[ix]
+		if ix - crashDisasmWindow > from {
+			from = ix - crashDisasmWindow
+		}
+		if ix + crashDisasmWindow + 1 < to {
+			to = ix + crashDisasmWindow + 1
+		}
+	}
+
+	for _, pc := range starts[from:to] {
+		length, _ := bcode.InstructionLength(codeAttr.Code, pc)
+		marker := "  "
+		if pc == current {
+			marker = "=>"
+		}
+		fmt.Fprintf(w, "%s %d: %s\n", marker, pc, formatInstruction(def, codeAttr.Code, pc, length))
+	}
+	if nil != decodeErr && to == len(starts) {
+		fmt.Fprintf(w, "\n%v\n", decodeErr)
+	}
+
+	return nil
+}
+
+func (m *MiniJvm) writeCrashHeap(w io.Writer) error {
+	if !m.TrackHeap {
+		fmt.Fprintln(w, "heap tracking is off, set TrackHeap (-histoAtExit) to record live objects")
+		return nil
+	}
+
+	m.HeapHistogram().Dump(w)
+	return nil
+}
+
+func (m *MiniJvm) writeCrashOptions(w io.Writer) error {
+	fmt.Fprintf(w, "mainClass: %s\n", m.MainClass)
+	fmt.Fprintf(w, "args: %s\n", strings.Join(m.CmdArgs, " "))
+	if nil != m.MethodArea {
+		fmt.Fprintf(w, "classpath: %s\n", strings.Join(m.MethodArea.classPathSnapshot(), ","))
+	}
+
+	keys := make([]string, 0, len(m.Properties))
+	for key := range m.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "-D%s=%s\n", key, m.Properties[key])
+	}
+
+	fmt.Fprintf(w, "maxStackDepth: %d\n", m.MaxStackDepth)
+	fmt.Fprintf(w, "eagerLink: %v\n", m.EagerLink)
+	fmt.Fprintf(w, "lazyLink: %v\n", m.LazyLink)
+	fmt.Fprintf(w, "strictInit: %v\n", m.StrictInit)
+	fmt.Fprintf(w, "noIntrinsics: %v\n", m.DisableIntrinsics)
+	fmt.Fprintf(w, "trackHeap: %v\n", m.TrackHeap)
+	fmt.Fprintf(w, "locale: %s\n", m.Locale)
+	fmt.Fprintf(w, "timezone: %s\n", m.TimeZone)
+	if nil != m.ThreadLimits {
+		fmt.Fprintf(w, "threadMaxInstructions: %d\n", m.ThreadLimits.MaxInstructions)
+		fmt.Fprintf(w, "threadMaxAllocations: %d\n", m.ThreadLimits.MaxAllocations)
+	}
+
+	fmt.Fprintf(w, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrashBundleOnEnginePanic(t *testing.T) {
+	b := newClassBuilder("com/fh/Crash", "java/lang/Object")
+	b.method(accflag.Static | accflag.Native, "explode", "()V", 0, 0, nil)
+	// static void run() { int unused = 1; explode(); }
+	b.method(accflag.Static, "run", "()V", 1, 1, newCodeAssembler().
+		emit(bcode.Iconst1, bcode.Istore0).
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Crash", "explode", "()V")).
+		emit(bcode.Return))
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Crash", "explode", "()V", func(args ...interface{}) interface{} {
+		panic("boom")
+	})
+
+	// panic不会让宿主进程崩溃, 而是作为错误返回
+	runErr := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "run", "()V", newMethodStackFrame(0, 0), false)
+	var panicErr *EnginePanicError
+	if !errors.As(runErr, &panicErr) || "boom" != panicErr.Value {
+		t.Fatalf("expect engine panic, got %v", runErr)
+	}
+	if report := NewErrorReport(runErr); "internal" != report.Kind {
+		t.Fatalf("unexpected kind %s", report.Kind)
+	}
+
+	dir, err := ioutil.TempDir("", "mini-jvm-crash")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundleDir, err := jvm.WriteCrashBundle(dir, runErr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(bundleDir, name))
+		if nil != err {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	for name, expect := range map[string]string{
+		"error.txt":   "engine panic: boom",
+		"frames.txt":  "at com.fh.Crash.run()V pc=",
+		"disasm.txt":  "=> 2: invokestatic",
+		"heap.txt":    "heap tracking is off",
+		"options.txt": "go: go",
+	} {
+		if content := read(name); !strings.Contains(content, expect) {
+			t.Fatalf("%s does not contain '%s':\n%s", name, expect, content)
+		}
+	}
+	if !strings.Contains(read("error.txt"), "go stack:") {
+		t.Fatal("go stack missing")
+	}
+
+	def, err := class.LoadClassBuf([]byte(read("com.fh.Crash.class")))
+	if nil != err || "com/fh/Crash" != def.FullClassName {
+		t.Fatalf("unexpected class file: %v", err)
+	}
+}
+
+func TestCrashBundleOnVerifyError(t *testing.T) {
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// iinc使用的本地变量超出max locals, 链接时报告VerifyError
+	b := newClassBuilder("com/fh/Broken", "java/lang/Object")
+	b.method(accflag.Static, "bad", "()V", 0, 1, newCodeAssembler().emit(bcode.Iinc, 3, 1, bcode.Return))
+	defineErr := jvm.MethodArea.DefineClass(b.def)
+	if nil == defineErr || !strings.Contains(defineErr.Error(), "java.lang.VerifyError") {
+		t.Fatalf("expect VerifyError, got %v", defineErr)
+	}
+
+	dir, err := ioutil.TempDir("", "mini-jvm-crash")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 不是致命错误时不生成报告
+	if bundleDir, err := jvm.WriteCrashBundle(dir, errors.New("java.lang.IllegalStateException: x")); nil != err || "" != bundleDir {
+		t.Fatalf("unexpected bundle %s, %v", bundleDir, err)
+	}
+
+	bundleDir, err := jvm.WriteCrashBundle(dir, defineErr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	disasm, err := ioutil.ReadFile(filepath.Join(bundleDir, "disasm.txt"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 不知道出错的方法时反汇编整个类
+	if !strings.Contains(string(disasm), "class com/fh/Broken") || !strings.Contains(string(disasm), "0: iinc") {
+		t.Fatalf("unexpected disassembly:\n%s", disasm)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "com.fh.Broken.class")); nil != err {
+		t.Fatal(err)
+	}
+}
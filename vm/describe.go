@@ -0,0 +1,302 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 方法在本虚拟机中的执行情况
+const (
+	// 字节码中的指令解释器都支持
+	MethodSupported = "ok"
+	// 有go实现替代字节码
+	MethodIntrinsic = "intrinsic"
+	// native方法, 有go实现
+	MethodNative = "native"
+	// native方法, 没有注册go实现
+	MethodMissingNative = "missing-native"
+	// 字节码中有解释器不支持的指令
+	MethodUnsupported = "unsupported"
+	MethodAbstract = "abstract"
+)
+
+// 类的字段和方法说明, 描述符转换成java源码风格的签名, 方法附带能否执行
+type ClassDescription struct {
+	// java源码风格的类声明, 如public class com.fh.Foo extends com.fh.Bar
+	Header  string
+	Fields  []*MemberDescription
+	Methods []*MemberDescription
+}
+
+type MemberDescription struct {
+	Flags      uint16
+	Name       string
+	Descriptor string
+	// 如public static int add(int, java.lang.String[]), 字段为private long count
+	Signature string
+
+	// 以下只有方法才有
+	Support string
+	// 解释器不支持的指令名, 去重并排序
+	UnsupportedOps []string
+}
+
+func (m *MemberDescription) String() string {
+	if "" == m.Support {
+		return m.Signature
+	}
+
+	support := m.Support
+	if len(m.UnsupportedOps) > 0 {
+		support += ": " + strings.Join(m.UnsupportedOps, ", ")
+	}
+	return fmt.Sprintf("[%s] %s", support, m.Signature)
+}
+
+// 与disasm一样只解析class文件, 不执行<clinit>; 根据内置的本地方法表判断native方法能否执行
+type Describer struct {
+	jvm *MiniJvm
+}
+
+func NewDescriber(classPaths []string, options *ClassPathOptions) (*Describer, error) {
+	jvm := &MiniJvm{
+		ClassPathOptions:  options,
+		NativeMethodTable: newBuiltinNativeMethodTable(),
+		IntrinsicTable:    newBuiltinIntrinsicTable(),
+		stats:             new(vmStats),
+	}
+
+	ma, err := NewMethodArea(jvm, classPaths, nil)
+	if nil != err {
+		return nil, fmt.Errorf("unabled to create method area: %w", err)
+	}
+	jvm.MethodArea = ma
+
+	return &Describer{jvm: jvm}, nil
+}
+
+// 类名可以用.或者/分隔
+func (d *Describer) Describe(className string) (*ClassDescription, error) {
+	def, err := d.jvm.MethodArea.ParseClass(strings.ReplaceAll(className, ".", "/"))
+	if nil != err {
+		return nil, fmt.Errorf("failed to parse class '%s': %w", className, err)
+	}
+
+	return d.DescribeClass(def)
+}
+
+func (d *Describer) DescribeClass(def *class.DefFile) (*ClassDescription, error) {
+	desc := &ClassDescription{Header: describeClassHeader(def)}
+
+	for _, field := range def.Fields {
+		name := def.ConstPool.At(field.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(field.DescriptorIndex).(*class.Utf8InfoConst).String()
+		desc.Fields = append(desc.Fields, &MemberDescription{
+			Flags:      field.AccessFlags,
+			Name:       name,
+			Descriptor: descriptor,
+			Signature:  fieldModifiers(field.AccessFlags) + javaTypeName(descriptor) + " " + name,
+		})
+	}
+
+	for _, method := range def.Methods {
+		name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+		member := &MemberDescription{
+			Flags:      method.AccessFlags,
+			Name:       name,
+			Descriptor: descriptor,
+			Signature:  javaMethodSignature(def, method.AccessFlags, name, descriptor),
+		}
+
+		if err := d.checkSupport(def, method, member); nil != err {
+			return nil, fmt.Errorf("failed to describe %s.%s%s: %w", def.FullClassName, name, descriptor, err)
+		}
+		desc.Methods = append(desc.Methods, member)
+	}
+
+	return desc, nil
+}
+
+// 与执行时的查找顺序一致: 先查intrinsic, 再看是否native, 最后扫描字节码
+func (d *Describer) checkSupport(def *class.DefFile, method *class.MethodInfo, member *MemberDescription) error {
+	if nil != d.jvm.IntrinsicTable.FindMethodInfo(def.FullClassName, member.Name, member.Descriptor) {
+		member.Support = MethodIntrinsic
+		return nil
+	}
+
+	switch {
+	case method.AccessFlags & accflag.Native > 0:
+		member.Support = MethodMissingNative
+		if f, _ := d.jvm.NativeMethodTable.FindMethod(def.FullClassName, member.Name, member.Descriptor); nil != f {
+			member.Support = MethodNative
+		}
+		return nil
+
+	case method.AccessFlags & accflag.Abstarct > 0:
+		member.Support = MethodAbstract
+		return nil
+	}
+
+	codeAttr, err := findCodeAttr(method)
+	if nil != err {
+		return err
+	}
+
+	member.Support = MethodSupported
+	if nil == codeAttr {
+		return nil
+	}
+
+	unsupported := make(map[string]bool)
+	for pc := 0; pc < len(codeAttr.Code); {
+		length, err := bcode.InstructionLength(codeAttr.Code, pc)
+		if nil != err {
+			return err
+		}
+
+		if op := codeAttr.Code[pc]; !d.jvm.isByteCodeSupported(op) {
+			unsupported[bcode.ToName(op)] = true
+		}
+		pc += length
+	}
+
+	if len(unsupported) > 0 {
+		member.Support = MethodUnsupported
+		for name := range unsupported {
+			member.UnsupportedOps = append(member.UnsupportedOps, name)
+		}
+		sort.Strings(member.UnsupportedOps)
+	}
+
+	return nil
+}
+
+// 输出格式:
+// public class com.fh.Foo extends java.lang.Object
+//   fields:
+//     private int count
+//   methods:
+//     [ok] public static void main(java.lang.String[])
+//     [unsupported: lookupswitch] public int parse(java.lang.String)
+func (c *ClassDescription) Print(w io.Writer) {
+	fmt.Fprintln(w, c.Header)
+
+	if len(c.Fields) > 0 {
+		fmt.Fprintln(w, "  fields:")
+		for _, field := range c.Fields {
+			fmt.Fprintf(w, "    %s\n", field)
+		}
+	}
+
+	if len(c.Methods) > 0 {
+		fmt.Fprintln(w, "  methods:")
+		for _, method := range c.Methods {
+			fmt.Fprintf(w, "    %s\n", method)
+		}
+	}
+}
+
+// 不能执行的方法个数
+func (c *ClassDescription) UnsupportedCount() int {
+	count := 0
+	for _, method := range c.Methods {
+		if MethodUnsupported == method.Support || MethodMissingNative == method.Support {
+			count++
+		}
+	}
+
+	return count
+}
+
+func describeClassHeader(def *class.DefFile) string {
+	name := javaTypeName("L" + def.FullClassName + ";")
+
+	if def.AccessFlag & accflag.Interface > 0 {
+		header := classModifiers(def.AccessFlag &^ accflag.Abstarct) + "interface " + name
+		if names := interfaceNamesOf(def); len(names) > 0 {
+			header += " extends " + javaTypeNames(names)
+		}
+		return header
+	}
+
+	header := classModifiers(def.AccessFlag) + "class " + name
+	if 0 != def.SuperClass {
+		header += " extends " + javaTypeName("L" + classNameAt(def, def.SuperClass) + ";")
+	}
+	if names := interfaceNamesOf(def); len(names) > 0 {
+		header += " implements " + javaTypeNames(names)
+	}
+
+	return header
+}
+
+func javaTypeNames(classNames []string) string {
+	names := make([]string, len(classNames))
+	for ix, name := range classNames {
+		names[ix] = javaTypeName("L" + name + ";")
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func classModifiers(flags uint16) string {
+	modifiers := ""
+	if flags & accflag.Public > 0 {
+		modifiers += "public "
+	}
+	if flags & accflag.Abstarct > 0 {
+		modifiers += "abstract "
+	}
+	if flags & accflag.Final > 0 {
+		modifiers += "final "
+	}
+
+	return modifiers
+}
+
+func fieldModifiers(flags uint16) string {
+	var modifiers strings.Builder
+	for _, m := range []struct {
+		flag uint16
+		name string
+	}{
+		{accflag.Public, "public"}, {accflag.Private, "private"}, {accflag.Protected, "protected"},
+		{accflag.Static, "static"}, {accflag.Final, "final"}, {accflag.Volatile, "volatile"},
+		{accflag.Transient, "transient"},
+	} {
+		if flags & m.flag > 0 {
+			modifiers.WriteString(m.name + " ")
+		}
+	}
+
+	return modifiers.String()
+}
+
+// 构造器显示为类的简单名, <clinit>显示为static {}
+func javaMethodSignature(def *class.DefFile, flags uint16, name string, descriptor string) string {
+	if "<clinit>" == name {
+		return "static {}"
+	}
+
+	argDescs, retDesc := class.ParseMethodDescriptor(descriptor)
+	args := make([]string, len(argDescs))
+	for ix, argDesc := range argDescs {
+		args[ix] = javaTypeName(argDesc)
+	}
+
+	signature := methodModifiers(flags)
+	if "<init>" == name {
+		simpleName := def.FullClassName[strings.LastIndex(def.FullClassName, "/") + 1:]
+		signature += simpleName[strings.LastIndex(simpleName, "$") + 1:]
+	} else {
+		signature += javaTypeName(retDesc) + " " + name
+	}
+
+	return signature + "(" + strings.Join(args, ", ") + ")"
+}
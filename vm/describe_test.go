@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strings"
+	"testing"
+)
+
+func TestDescribeClass(t *testing.T) {
+	b := newClassBuilder("com/fh/Foo$Bar", "com/fh/Base").implements("java/lang/Runnable")
+	b.def.AccessFlag = accflag.Public | accflag.Final
+	b.field("names", "[[Ljava/lang/String;")
+	b.method(accflag.Public, "<init>", "(IJ)V", 0, 4, newCodeAssembler().emit(bcode.Return))
+	b.method(accflag.Public | accflag.Static, "sum", "([ILjava/util/List;)J", 1, 2, newCodeAssembler().
+		emit(0xa8, 0, 3).
+		emit(bcode.Lreturn))
+	b.method(accflag.Public | accflag.Native, "hashCode", "()I", 0, 0, nil)
+	b.method(accflag.Private | accflag.Native, "missing", "(D)Z", 0, 0, nil)
+	b.method(accflag.Public | accflag.Abstarct, "run", "()V", 0, 0, nil)
+	b.method(accflag.Static, "<clinit>", "()V", 0, 0, newCodeAssembler().emit(bcode.Return))
+
+	describer := &Describer{jvm: &MiniJvm{NativeMethodTable: NewNativeMethodTable(), IntrinsicTable: NewNativeMethodTable()}}
+	describer.jvm.NativeMethodTable.RegisterMethod("com.fh.Foo$Bar", "hashCode", "()I", func(args ...interface{}) interface{} {
+		return 0
+	})
+
+	desc, err := describer.DescribeClass(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	desc.Print(&out)
+	expected := []string{
+		"public final class com.fh.Foo.Bar extends com.fh.Base implements java.lang.Runnable",
+		"    public java.lang.String[][] names",
+		"    [ok] public Bar(int, long)",
+		"    [unsupported: jsr] public static long sum(int[], java.util.List)",
+		"    [native] public native int hashCode()",
+		"    [missing-native] private native boolean missing(double)",
+		"    [abstract] public abstract void run()",
+		"    [ok] static {}",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line + "\n") {
+			t.Fatalf("missing line %q in:\n%s", line, out.String())
+		}
+	}
+
+	if 2 != desc.UnsupportedCount() {
+		t.Fatalf("expect 2 methods cannot be executed, got %d", desc.UnsupportedCount())
+	}
+}
@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dex文件的魔术数, 之后是版本号, 如dex\n035\0
+var dexMagic = []byte("dex\n")
+
+// 调用dex2jar(d2j-dex2jar.sh或.bat)转换, 结果缓存在cacheDir(为空时与ClassPathOptions一样使用用户缓存目录)中,
+// 输入没有变化时不会重复转换
+func Dex2jarConverter(tool string, cacheDir string) func(dexPath string) (string, error) {
+	return func(dexPath string) (string, error) {
+		cacheDir, err := (&ClassPathOptions{CacheDir: cacheDir}).fatJarCacheDir(dexPath)
+		if nil != err {
+			return "", err
+		}
+		jarPath := cacheDir + "-dex2jar.jar"
+		if _, err := os.Stat(jarPath); nil == err {
+			return jarPath, nil
+		}
+
+		utils.LogInfoPrintf("convert %s to %s with %s", dexPath, jarPath, tool)
+		// 先输出到临时文件, 完成后再重命名, 防止留下转换了一半的缓存
+		tmp, err := ioutil.TempFile(filepath.Dir(jarPath), filepath.Base(jarPath) + ".*.tmp")
+		if nil != err {
+			return "", err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+
+		out, err := exec.Command(tool, "-f", "-o", tmp.Name(), dexPath).CombinedOutput()
+		if nil != err {
+			return "", fmt.Errorf("%s failed: %w\n%s", tool, err, strings.TrimSpace(string(out)))
+		}
+		if err := os.Rename(tmp.Name(), jarPath); nil != err {
+			return "", err
+		}
+
+		return jarPath, nil
+	}
+}
+
+// classpath中是否为Android的dex格式: dex文件, 包含classes.dex(多dex时还有classes2.dex等)但没有class的apk/zip/jar,
+// 或者根目录下有classes.dex的目录(解开的apk); 不是时返回nil
+func detectDex(cp string) *DexFormatError {
+	info, err := os.Stat(cp)
+	if nil != err {
+		// 不存在的classpath交给类加载流程处理
+		return nil
+	}
+
+	if info.IsDir() {
+		dexFiles, _ := filepath.Glob(filepath.Join(cp, "classes*.dex"))
+		if 0 == len(dexFiles) {
+			return nil
+		}
+		for ix := range dexFiles {
+			dexFiles[ix] = filepath.Base(dexFiles[ix])
+		}
+		sort.Strings(dexFiles)
+		return &DexFormatError{Path: cp, DexFiles: dexFiles}
+	}
+
+	f, err := os.Open(cp)
+	if nil != err {
+		return nil
+	}
+	defer f.Close()
+	magic := make([]byte, len(dexMagic))
+	if _, err := io.ReadFull(f, magic); nil != err {
+		return nil
+	}
+	if bytes.Equal(dexMagic, magic) {
+		return &DexFormatError{Path: cp}
+	}
+
+	zr, err := zip.OpenReader(cp)
+	if nil != err {
+		return nil
+	}
+	defer zr.Close()
+
+	var dexFiles []string
+	for _, entry := range zr.File {
+		// 有class时是普通jar(有的Android库同时带有dex), 照常加载
+		if strings.HasSuffix(entry.Name, ".class") {
+			return nil
+		}
+		if !strings.Contains(entry.Name, "/") && strings.HasPrefix(entry.Name, "classes") && ".dex" == path.Ext(entry.Name) {
+			dexFiles = append(dexFiles, entry.Name)
+		}
+	}
+	if 0 == len(dexFiles) {
+		return nil
+	}
+
+	sort.Strings(dexFiles)
+	return &DexFormatError{Path: cp, DexFiles: dexFiles}
+}
+
+// 设置了DexConverter时把dex转换成jar, 否则返回DexFormatError; 不是dex时原样返回
+func (o *ClassPathOptions) convertDexClassPath(cp string) (string, error) {
+	dexErr := detectDex(cp)
+	if nil == dexErr {
+		return cp, nil
+	}
+	if nil == o.DexConverter {
+		return "", dexErr
+	}
+
+	jarPath, err := o.DexConverter(cp)
+	if nil != err {
+		return "", fmt.Errorf("failed to convert dex '%s' to jar: %w", cp, err)
+	}
+
+	return jarPath, nil
+}
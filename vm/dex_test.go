@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDexDetection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mini-jvm-dex")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dex := append([]byte("dex\n035\x00"), make([]byte, 104)...)
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, data, 0644); nil != err {
+			t.Fatal(err)
+		}
+		return p
+	}
+	dexPath := write("classes.dex", dex)
+	apkPath := write("app.apk", buildTestJar(t, map[string][]byte{
+		"AndroidManifest.xml": []byte("<manifest/>"),
+		"classes2.dex":        dex,
+		"classes.dex":         dex,
+		"assets/classes3.dex": dex,
+	}))
+	// 同时带有class和dex的jar照常加载
+	mixedPath := write("mixed.jar", buildTestJar(t, map[string][]byte{
+		"com/fh/Person.class": readTestClass(t, "com/fh/Person"),
+		"classes.dex":         dex,
+	}))
+	unpacked := filepath.Join(dir, "unpacked")
+	if err := os.Mkdir(unpacked, 0755); nil != err {
+		t.Fatal(err)
+	}
+	write("unpacked/classes.dex", dex)
+
+	cases := []struct {
+		path     string
+		dexFiles []string
+	}{
+		{dexPath, nil},
+		{apkPath, []string{"classes.dex", "classes2.dex"}},
+		{unpacked, []string{"classes.dex"}},
+	}
+	for _, c := range cases {
+		_, err := NewMethodArea(nil, []string{c.path}, nil)
+		var dexErr *DexFormatError
+		if !errors.As(err, &dexErr) || c.path != dexErr.Path || !reflect.DeepEqual(c.dexFiles, dexErr.DexFiles) {
+			t.Fatalf("%s: expect dex format error, got %v", c.path, err)
+		}
+		if !strings.Contains(err.Error(), "dex2jar") {
+			t.Fatalf("error should suggest dex2jar: %v", err)
+		}
+		if report := NewErrorReport(err); "dexFormat" != report.Kind || ExitVerifyError != report.ExitCode {
+			t.Fatalf("unexpected error report %+v", report)
+		}
+	}
+	if _, err := NewMethodArea(nil, []string{mixedPath, filepath.Join(dir, "missing.jar")}, nil); nil != err {
+		t.Fatal(err)
+	}
+
+	// 改名成.class的dex文件
+	if _, err := class.LoadClassBuf(dex); nil == err || !strings.Contains(err.Error(), "dex") {
+		t.Fatalf("expect dex error, got %v", err)
+	}
+
+	// 设置了转换工具时使用转换后的jar
+	var converted []string
+	options := &ClassPathOptions{DexConverter: func(dexPath string) (string, error) {
+		converted = append(converted, dexPath)
+		return mixedPath, nil
+	}}
+	ma, err := NewMethodArea(&MiniJvm{ClassPathOptions: options, stats: new(vmStats)}, []string{apkPath}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{apkPath}, converted) || !reflect.DeepEqual([]string{mixedPath}, ma.ClassPaths) {
+		t.Fatalf("unexpected classpath %v, converted %v", ma.ClassPaths, converted)
+	}
+	if _, err := ma.ParseClass("com/fh/Person"); nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+)
+
+// 反汇编class中的方法, 与verify一样只解析class文件, 不执行<clinit>
+type Disassembler struct {
+	methodArea *MethodArea
+}
+
+func NewDisassembler(classPaths []string, options *ClassPathOptions) (*Disassembler, error) {
+	jvm := &MiniJvm{ClassPathOptions: options, stats: new(vmStats)}
+
+	ma, err := NewMethodArea(jvm, classPaths, nil)
+	if nil != err {
+		return nil, fmt.Errorf("unabled to create method area: %w", err)
+	}
+	jvm.MethodArea = ma
+
+	return &Disassembler{methodArea: ma}, nil
+}
+
+// 反汇编指定的class, 类名可以用.或者/分隔
+func (d *Disassembler) Disassemble(w io.Writer, className string) error {
+	def, err := d.methodArea.ParseClass(strings.ReplaceAll(className, ".", "/"))
+	if nil != err {
+		return fmt.Errorf("failed to parse class '%s': %w", className, err)
+	}
+
+	return DisassembleClass(w, def)
+}
+
+// 输出格式:
+// class com/fh/Foo extends java/lang/Object
+//   public static main([Ljava/lang/String;)V
+//     0: iconst_0
+//     1: istore_1
+func DisassembleClass(w io.Writer, def *class.DefFile) error {
+	header := "class " + def.FullClassName
+	if def.AccessFlag & accflag.Interface > 0 {
+		header = "interface " + def.FullClassName
+	}
+	if 0 != def.SuperClass {
+		header += " extends " + classNameAt(def, def.SuperClass)
+	}
+	if names := interfaceNamesOf(def); len(names) > 0 {
+		header += " implements " + strings.Join(names, ", ")
+	}
+	fmt.Fprintln(w, header)
+
+	for _, method := range def.Methods {
+		name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+		fmt.Fprintf(w, "  %s%s%s\n", methodModifiers(method.AccessFlags), name, descriptor)
+
+		codeAttr, err := findCodeAttr(method)
+		if nil != err {
+			return fmt.Errorf("failed to disassemble %s.%s%s: %w", def.FullClassName, name, descriptor, err)
+		}
+		if nil == codeAttr {
+			continue
+		}
+
+		for pc := 0; pc < len(codeAttr.Code); {
+			length, err := bcode.InstructionLength(codeAttr.Code, pc)
+			if nil != err {
+				return fmt.Errorf("failed to disassemble %s.%s%s: %w", def.FullClassName, name, descriptor, err)
+			}
+
+			fmt.Fprintf(w, "    %d: %s\n", pc, formatInstruction(def, codeAttr.Code, pc, length))
+			pc += length
+		}
+	}
+
+	return nil
+}
+
+func methodModifiers(flags uint16) string {
+	var modifiers strings.Builder
+	for _, m := range []struct {
+		flag uint16
+		name string
+	}{
+		{accflag.Public, "public"}, {accflag.Private, "private"}, {accflag.Protected, "protected"},
+		{accflag.Static, "static"}, {accflag.Final, "final"}, {accflag.Synchronized, "synchronized"},
+		{accflag.Native, "native"}, {accflag.Abstarct, "abstract"},
+	} {
+		if flags & m.flag > 0 {
+			modifiers.WriteString(m.name + " ")
+		}
+	}
+
+	return modifiers.String()
+}
+
+// 生成一条指令的文本: 跳转指令显示目标pc, 引用常量池的指令显示常量内容, 其他指令显示操作数
+func formatInstruction(def *class.DefFile, code []byte, pc int, length int) string {
+	op := code[pc]
+	name := bcode.ToName(op)
+	operands := code[pc + 1 : pc + length]
+
+	switch {
+	case op >= bcode.Ifeq && op <= 0xa8, op == bcode.Ifnull, op == bcode.Ifnonnull:
+		return fmt.Sprintf("%s %d", name, pc + int(int16(binary.BigEndian.Uint16(operands))))
+
+	case op == bcode.GotoW || op == 0xc9:
+		return fmt.Sprintf("%s %d", name, pc + int(int32(binary.BigEndian.Uint32(operands))))
+
+	case op == bcode.Ldc:
+		return fmt.Sprintf("%s #%d%s", name, operands[0], constComment(def, int(operands[0])))
+
+	case op == bcode.LdcW || op == bcode.Ldc2W || (op >= bcode.Getstatic && op <= bcode.Invokedynamic) ||
+		op == bcode.New || op == bcode.Anewarray || op == bcode.Checkcast || op == bcode.Instanceof:
+		index := int(binary.BigEndian.Uint16(operands))
+		return fmt.Sprintf("%s #%d%s", name, index, constComment(def, index))
+
+	case op == bcode.Multianewarray:
+		// 类型和维数, 如 multianewarray #2, 2 // class [[I
+		index := int(binary.BigEndian.Uint16(operands))
+		return fmt.Sprintf("%s #%d, %d%s", name, index, operands[2], constComment(def, index))
+
+	case op == bcode.Tableswitch:
+		// 显示每个值的目标pc, 如 tableswitch {1: 28, 2: 33, default: 40}, lookupswitch相同
+		base := pc + 1 + (4 - (pc + 1) % 4) % 4
+		low := int32(binary.BigEndian.Uint32(code[base + 4:]))
+		high := int32(binary.BigEndian.Uint32(code[base + 8:]))
+		var cases []string
+		for val := int64(low); val <= int64(high); val++ {
+			cases = append(cases, fmt.Sprintf("%d: %d", val, pc + int(tableswitchOffset(code, pc, int32(val)))))
+		}
+		cases = append(cases, fmt.Sprintf("default: %d", pc + int(int32(binary.BigEndian.Uint32(code[base:])))))
+		return fmt.Sprintf("%s {%s}", name, strings.Join(cases, ", "))
+
+	case op == bcode.Lookupswitch:
+		base := pc + 1 + (4 - (pc + 1) % 4) % 4
+		npairs := int(int32(binary.BigEndian.Uint32(code[base + 4:])))
+		var cases []string
+		for ix := 0; ix < npairs; ix++ {
+			pair := base + 8 + 8 * ix
+			cases = append(cases, fmt.Sprintf("%d: %d", int32(binary.BigEndian.Uint32(code[pair:])), pc + int(int32(binary.BigEndian.Uint32(code[pair + 4:])))))
+		}
+		cases = append(cases, fmt.Sprintf("default: %d", pc + int(int32(binary.BigEndian.Uint32(code[base:])))))
+		return fmt.Sprintf("%s {%s}", name, strings.Join(cases, ", "))
+
+	case op == bcode.Bipush:
+		return fmt.Sprintf("%s %d", name, int8(operands[0]))
+
+	case op == bcode.Sipush:
+		return fmt.Sprintf("%s %d", name, int16(binary.BigEndian.Uint16(operands)))
+
+	case op == bcode.Iinc:
+		return fmt.Sprintf("%s %d %d", name, operands[0], int8(operands[1]))
+	}
+
+	if 0 == len(operands) {
+		return name
+	}
+	values := make([]string, len(operands))
+	for ix, b := range operands {
+		values[ix] = fmt.Sprint(b)
+	}
+	return name + " " + strings.Join(values, " ")
+}
+
+// 常量池项的说明, 如 // Method java/lang/Object.<init>:()V
+func constComment(def *class.DefFile, index int) string {
+	if index <= 0 || index >= def.ConstPool.Len() {
+		return ""
+	}
+
+	memberRef := func(kind string, classIndex uint16, nameAndTypeIndex uint16) string {
+		nameAndType := def.ConstPool.At(nameAndTypeIndex).(*class.NameAndTypeConst)
+		return fmt.Sprintf(" // %s %s.%s:%s", kind, classNameAt(def, classIndex),
+			def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String(),
+			def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String())
+	}
+
+	switch item := def.ConstPool.At(uint16(index)).(type) {
+	case *class.ClassInfoConstInfo:
+		return " // class " + classNameAt(def, uint16(index))
+	case *class.StringInfoConst:
+		return fmt.Sprintf(" // String %q", def.ConstPool.At(item.StringIndex).(*class.Utf8InfoConst).String())
+	case *class.IntegerInfoConst:
+		return fmt.Sprintf(" // int %d", int32(item.Bytes))
+	case *class.FieldRefConstInfo:
+		return memberRef("Field", item.ClassIndex, item.NameAndTypeIndex)
+	case *class.MethodRefConstInfo:
+		return memberRef("Method", item.ClassIndex, item.NameAndTypeIndex)
+	case *class.InterfaceMethodConst:
+		return memberRef("InterfaceMethod", item.InterfaceClassIndex, item.NameAndTypeIndex)
+	case *class.InvokeDynamicConst:
+		nameAndType := def.ConstPool.At(item.NameAndTypeIndex).(*class.NameAndTypeConst)
+		return fmt.Sprintf(" // InvokeDynamic #%d:%s:%s", item.BootstrapMethodAttrIndex,
+			def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String(),
+			def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String())
+	}
+
+	return ""
+}
+
+func classNameAt(def *class.DefFile, index uint16) string {
+	info := def.ConstPool.At(index).(*class.ClassInfoConstInfo)
+	return def.ConstPool.At(info.FullClassNameIndex).(*class.Utf8InfoConst).String()
+}
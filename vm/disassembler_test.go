@@ -0,0 +1,38 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDisassembleClass(t *testing.T) {
+	def := newTestClass("com/fh/Foo", "java/lang/Object", nil)
+	boxClass := addTestClassRef(def, "com/fh/Box")
+	addTestCodeMethod(def, "loop", "()V", 1, 1, []byte{
+		bcode.Bipush, 0xff,
+		bcode.Istore0,
+		bcode.New, 0, byte(boxClass),
+		bcode.Goto, 0xff, 0xfa,
+	})
+
+	var out bytes.Buffer
+	if err := DisassembleClass(&out, def); nil != err {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"class com/fh/Foo extends java/lang/Object",
+		"  public static loop()V",
+		"    0: bipush -1",
+		"    3: new #" + strconv.Itoa(int(boxClass)) + " // class com/fh/Box",
+		"    6: goto 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line + "\n") {
+			t.Fatalf("missing line %q in:\n%s", line, out.String())
+		}
+	}
+}
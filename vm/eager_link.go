@@ -0,0 +1,269 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+)
+
+// 提前链接: 从main方法出发, 沿调用图找出所有可能执行到的方法, 在执行前一次性报告缺失的类, 字段,
+// 方法以及不支持的字节码和本地方法;
+// 虚方法调用按照已经new过的类查找可能的实现(类似RTA), 不执行任何字节码
+type eagerLinker struct {
+	verifier *Verifier
+	report   *VerifyReport
+
+	// 已经处理过的方法和初始化过的类
+	visitedMethods map[*class.MethodInfo]bool
+	initedClasses  map[*class.DefFile]bool
+
+	// 已经new过的类和出现过的虚方法调用(名字+描述符), 两者任一增加时都要补充可能的实现
+	instantiated []*class.DefFile
+	virtualCalls map[string]bool
+
+	worklist []*class.MethodInfo
+	reported map[string]bool
+}
+
+// 从mainClass的main方法出发链接所有可达的方法
+func (m *MiniJvm) LinkReachable(mainClass string) *VerifyReport {
+	linker := &eagerLinker{
+		verifier:       newVerifierFor(m),
+		report:         &VerifyReport{Problems: make([]*VerifyProblem, 0, 8)},
+		visitedMethods: make(map[*class.MethodInfo]bool),
+		initedClasses:  make(map[*class.DefFile]bool),
+		virtualCalls:   make(map[string]bool),
+		reported:       make(map[string]bool),
+	}
+
+	mainClass = strings.ReplaceAll(mainClass, ".", "/")
+	mainDef := linker.resolveClass(mainClass, mainClass, "", -1)
+	if nil == mainDef {
+		return linker.report
+	}
+	linker.initClass(mainDef)
+
+	mainMethod := linker.verifier.findMethod(mainDef, "main", "([Ljava/lang/String;)V")
+	if nil == mainMethod {
+		linker.addProblem(mainClass, "", -1, VerifyProblemUnresolvedMethod, "method 'main:([Ljava/lang/String;)V' not found")
+		return linker.report
+	}
+	linker.enqueue(mainMethod)
+
+	for len(linker.worklist) > 0 {
+		method := linker.worklist[len(linker.worklist) - 1]
+		linker.worklist = linker.worklist[:len(linker.worklist) - 1]
+		linker.linkMethod(method)
+	}
+	linker.report.ClassCount = len(linker.initedClasses)
+
+	return linker.report
+}
+
+func (l *eagerLinker) addProblem(className string, method string, pc int, kind string, detail string) {
+	// 同一个问题可能从多个调用点到达, 只报告一次
+	key := className + "|" + method + "|" + kind + "|" + detail
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+
+	l.report.Problems = append(l.report.Problems, &VerifyProblem{
+		ClassName: className,
+		Method:    method,
+		Pc:        pc,
+		Kind:      kind,
+		Detail:    detail,
+	})
+}
+
+func (l *eagerLinker) enqueue(method *class.MethodInfo) {
+	if nil == method || l.visitedMethods[method] {
+		return
+	}
+	l.visitedMethods[method] = true
+	l.worklist = append(l.worklist, method)
+}
+
+func (l *eagerLinker) resolveClass(name string, fromClass string, fromMethod string, pc int) *class.DefFile {
+	def := l.verifier.resolveClass(name)
+	if nil == def {
+		l.addProblem(fromClass, fromMethod, pc, VerifyProblemUnresolvedClass, fmt.Sprintf("class '%s' not found in classpath", name))
+	}
+
+	return def
+}
+
+// 类初始化会执行自己和父类的<clinit>
+func (l *eagerLinker) initClass(def *class.DefFile) {
+	for current := def; nil != current && !l.initedClasses[current]; current = l.verifier.superOf(current) {
+		l.initedClasses[current] = true
+		if strings.HasPrefix(current.FullClassName, "[") {
+			return
+		}
+		l.enqueue(l.findDeclaredMethod(current, "<clinit>", "()V"))
+	}
+}
+
+func (l *eagerLinker) findDeclaredMethod(def *class.DefFile, name string, desc string) *class.MethodInfo {
+	for _, m := range def.Methods {
+		if name == def.ConstPool.At(m.NameIndex).(*class.Utf8InfoConst).String() &&
+			desc == def.ConstPool.At(m.DescriptorIndex).(*class.Utf8InfoConst).String() {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (l *eagerLinker) linkMethod(method *class.MethodInfo) {
+	def := method.DefFile
+	name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+	desc := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+	methodKey := name + ":" + desc
+
+	// 有go实现替代的方法不需要检查字节码
+	if method.AccessFlags & accflag.Native == 0 && l.hasIntrinsic(def.FullClassName, name, desc) {
+		return
+	}
+
+	l.verifier.verifyMethod(def, method, func(_ string, pc int, kind string, detail string) {
+		l.addProblem(def.FullClassName, methodKey, pc, kind, detail)
+	})
+
+	codeAttr, _ := findCodeAttr(method)
+	if nil == codeAttr {
+		// 解码失败时verifyMethod已经报告过
+		return
+	}
+
+	code := codeAttr.Code
+	for pc := 0; pc < len(code); {
+		length, err := bcode.InstructionLength(code, pc)
+		if nil != err {
+			// verifyMethod已经报告过
+			return
+		}
+
+		op := code[pc]
+		switch {
+		case op == bcode.Ldc:
+			l.linkLdc(def, methodKey, pc, int(code[pc + 1]))
+
+		case op == bcode.LdcW:
+			l.linkLdc(def, methodKey, pc, int(binary.BigEndian.Uint16(code[pc + 1:])))
+
+		case op >= bcode.Getstatic && op <= bcode.Putfield:
+			l.linkField(def, methodKey, pc, op, binary.BigEndian.Uint16(code[pc + 1:]))
+
+		case op >= bcode.Invokevirtual && op <= bcode.Invokeinterface:
+			l.linkInvoke(def, methodKey, pc, op, binary.BigEndian.Uint16(code[pc + 1:]))
+
+		case op == bcode.New:
+			if target := l.classAt(def, methodKey, pc, binary.BigEndian.Uint16(code[pc + 1:])); nil != target {
+				l.initClass(target)
+				l.onInstantiated(target)
+			}
+
+		case op == bcode.Anewarray || op == bcode.Checkcast || op == bcode.Instanceof || op == bcode.Multianewarray:
+			l.classAt(def, methodKey, pc, binary.BigEndian.Uint16(code[pc + 1:]))
+		}
+
+		pc += length
+	}
+}
+
+func (l *eagerLinker) hasIntrinsic(className string, name string, desc string) bool {
+	jvm := l.verifier.jvm
+	if info := jvm.NativeMethodTable.FindMethodInfo(className, name, desc); nil != info && info.Intrinsic {
+		return true
+	}
+
+	return !jvm.DisableIntrinsics && nil != jvm.IntrinsicTable.FindMethodInfo(className, name, desc)
+}
+
+func (l *eagerLinker) classAt(def *class.DefFile, methodKey string, pc int, index uint16) *class.DefFile {
+	return l.resolveClass(classNameAt(def, index), def.FullClassName, methodKey, pc)
+}
+
+func (l *eagerLinker) linkLdc(def *class.DefFile, methodKey string, pc int, index int) {
+	if _, ok := def.ConstPool.At(uint16(index)).(*class.ClassInfoConstInfo); ok {
+		l.classAt(def, methodKey, pc, uint16(index))
+	}
+}
+
+func (l *eagerLinker) linkField(def *class.DefFile, methodKey string, pc int, op byte, index uint16) {
+	ref := def.ConstPool.At(index).(*class.FieldRefConstInfo)
+	owner, name, desc := l.verifier.memberRef(def, ref.ClassIndex, ref.NameAndTypeIndex)
+
+	ownerDef := l.resolveClass(owner, def.FullClassName, methodKey, pc)
+	if nil == ownerDef {
+		return
+	}
+	if nil == l.verifier.findField(ownerDef, name, desc) {
+		l.addProblem(def.FullClassName, methodKey, pc, VerifyProblemUnresolvedField, fmt.Sprintf("field '%s.%s:%s' not found", owner, name, desc))
+	}
+
+	if bcode.Getstatic == op || bcode.Putstatic == op {
+		l.initClass(ownerDef)
+	}
+}
+
+func (l *eagerLinker) linkInvoke(def *class.DefFile, methodKey string, pc int, op byte, index uint16) {
+	var owner, name, desc string
+	switch ref := def.ConstPool.At(index).(type) {
+	case *class.MethodRefConstInfo:
+		owner, name, desc = l.verifier.memberRef(def, ref.ClassIndex, ref.NameAndTypeIndex)
+	case *class.InterfaceMethodConst:
+		owner, name, desc = l.verifier.memberRef(def, ref.InterfaceClassIndex, ref.NameAndTypeIndex)
+	default:
+		return
+	}
+
+	ownerDef := l.resolveClass(owner, def.FullClassName, methodKey, pc)
+	if nil == ownerDef {
+		return
+	}
+
+	target := l.verifier.findMethod(ownerDef, name, desc)
+	if nil == target {
+		l.addProblem(def.FullClassName, methodKey, pc, VerifyProblemUnresolvedMethod, fmt.Sprintf("method '%s.%s:%s' not found", owner, name, desc))
+		return
+	}
+	l.enqueue(target)
+
+	if bcode.Invokestatic == op {
+		l.initClass(ownerDef)
+		return
+	}
+	if bcode.Invokespecial == op {
+		return
+	}
+
+	// 虚方法调用: 已经new过的子类中的实现都可能被调用
+	callKey := name + ":" + desc
+	if !l.virtualCalls[callKey] {
+		l.virtualCalls[callKey] = true
+		for _, instantiated := range l.instantiated {
+			l.enqueue(l.verifier.findMethod(instantiated, name, desc))
+		}
+	}
+}
+
+// 新实例化的类可能是之前虚方法调用的接收者
+func (l *eagerLinker) onInstantiated(def *class.DefFile) {
+	for _, seen := range l.instantiated {
+		if seen == def {
+			return
+		}
+	}
+	l.instantiated = append(l.instantiated, def)
+
+	for callKey := range l.virtualCalls {
+		sep := strings.Index(callKey, ":")
+		l.enqueue(l.verifier.findMethod(def, callKey[:sep], callKey[sep + 1:]))
+	}
+}
@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// main -> new Dog, Animal.speak(), Missing.run();
+// Dog.speak只能通过虚方法调用到达, 其中引用了不存在的字段; Cat没有被new过, Main.unused不可达
+func newEagerLinkJvm() *MiniJvm {
+	main := newClassBuilder("Main", "java/lang/Object")
+	main.method(accflag.Public | accflag.Static, "main", "([Ljava/lang/String;)V", 2, 1, newCodeAssembler().
+		emitIndex(bcode.New, main.classRef("Dog")).emit(bcode.Dup).
+		emitIndex(bcode.Invokespecial, main.methodRef("Dog", "<init>", "()V")).
+		emitIndex(bcode.Invokevirtual, main.methodRef("Animal", "speak", "()V")).
+		emitIndex(bcode.Invokestatic, main.methodRef("Missing", "run", "()V")).
+		emit(bcode.Return))
+	main.method(accflag.Public | accflag.Static, "unused", "()V", 0, 0, newCodeAssembler().
+		emitIndex(bcode.Invokestatic, main.methodRef("Unreachable", "run", "()V")).
+		emit(bcode.Return))
+
+	animal := newClassBuilder("Animal", "java/lang/Object")
+	animal.method(accflag.Public, "<init>", "()V", 0, 1, newCodeAssembler().emit(bcode.Return))
+	animal.method(accflag.Public, "speak", "()V", 0, 1, newCodeAssembler().emit(bcode.Return))
+
+	dog := newClassBuilder("Dog", "Animal")
+	dog.method(accflag.Public, "<init>", "()V", 0, 1, newCodeAssembler().emit(bcode.Return))
+	dog.method(accflag.Public, "speak", "()V", 1, 1, newCodeAssembler().
+		emitIndex(bcode.Getstatic, dog.fieldRef("Main", "nope", "I")).emit(bcode.Pop).
+		emit(bcode.Return))
+
+	cat := newClassBuilder("Cat", "Animal")
+	cat.method(accflag.Public, "speak", "()V", 0, 1, newCodeAssembler().
+		emitIndex(bcode.Invokestatic, cat.methodRef("CatFood", "eat", "()V")).
+		emit(bcode.Return))
+
+	jvm := &MiniJvm{
+		MainClass:         "Main",
+		NativeMethodTable: newBuiltinNativeMethodTable(),
+		IntrinsicTable:    newBuiltinIntrinsicTable(),
+		EagerLink:         true,
+		stats:             new(vmStats),
+	}
+	jvm.MethodArea = &MethodArea{
+		Jvm:            jvm,
+		ClassMap:       make(map[string]*class.DefFile),
+		IgnoredClasses: make(map[string]interface{}),
+		loadingLocks:   make(map[string]*sync.Mutex),
+		classObjects:   make(map[*class.DefFile]*class.Reference),
+	}
+	jvm.ExecutionEngine = NewInterpretedExecutionEngine(jvm)
+	for _, def := range append(benchRuntimeClasses(), main.def, animal.def, dog.def, cat.def) {
+		jvm.MethodArea.ClassMap[def.FullClassName] = def
+	}
+
+	return jvm
+}
+
+func TestLinkReachable(t *testing.T) {
+	report := newEagerLinkJvm().LinkReachable("Main")
+
+	problems := make([]string, 0, len(report.Problems))
+	for _, problem := range report.Problems {
+		problems = append(problems, problem.String())
+	}
+	joined := strings.Join(problems, "\n")
+
+	if 2 != len(report.Problems) {
+		t.Fatalf("unexpected problems:\n%s", joined)
+	}
+	if !strings.Contains(joined, "class 'Missing' not found") || !strings.Contains(joined, "field 'Main.nope:I' not found") {
+		t.Fatalf("missing expected problems:\n%s", joined)
+	}
+	if strings.Contains(joined, "CatFood") || strings.Contains(joined, "Unreachable") {
+		t.Fatalf("unreachable code reported:\n%s", joined)
+	}
+}
+
+func TestEagerLinkFailsBeforeMain(t *testing.T) {
+	err := newEagerLinkJvm().Start()
+
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) {
+		t.Fatalf("expected LinkError, got %v", err)
+	}
+	if ExitClassNotFound != ExitCodeOf(err) {
+		t.Fatalf("unexpected exit code %d", ExitCodeOf(err))
+	}
+}
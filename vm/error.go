@@ -1,6 +1,12 @@
 package vm
 
-import "github.com/wanghongfei/mini-jvm/vm/class"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+)
 
 // 遇到athrow指令, 当前方法的异常表中匹配不到异常时返回此错误
 type ExceptionThrownError struct {
@@ -15,3 +21,120 @@ func NewExceptionThrownError(ref *class.Reference) error {
 	return &ExceptionThrownError{ExceptionRef: ref}
 }
 
+
+// 解释器执行时发生panic(虚拟机自身的bug)时返回此错误, 不能被guest捕获
+type EnginePanicError struct {
+	Value interface{}
+	// panic时go的调用栈
+	Stack []byte
+}
+
+func (e EnginePanicError) Error() string {
+	return fmt.Sprintf("engine panic: %v", e.Value)
+}
+
+// 安全策略拒绝调用敏感本地方法时返回此错误
+type PermissionDeniedError struct {
+	Request *PolicyRequest
+}
+
+func (e PermissionDeniedError) Error() string {
+	return "permission denied: " + e.Request.String()
+}
+
+// guest调用System.exit(), 并且虚拟机不退出宿主进程时(见RunMain)返回此错误
+type SystemExitError struct {
+	Status int
+}
+
+func (e SystemExitError) Error() string {
+	return fmt.Sprintf("guest called System.exit(%d)", e.Status)
+}
+
+// 宿主的context被取消或到期时, 正在等待锁、wait()或join()的guest线程返回此错误, 不能被guest捕获
+type ExecutionCancelledError struct {
+	// 被打断的操作, 如monitorenter, wait, join
+	Op  string
+	Err error
+}
+
+func (e ExecutionCancelledError) Error() string {
+	return fmt.Sprintf("execution cancelled during %s: %v", e.Op, e.Err)
+}
+
+func (e ExecutionCancelledError) Unwrap() error {
+	return e.Err
+}
+
+// context被取消导致的错误转换成ExecutionCancelledError, 其他错误原样返回
+func cancelledError(op string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &ExecutionCancelledError{Op: op, Err: err}
+	}
+
+	return err
+}
+
+// classpath中找不到类时返回此错误
+type ClassNotFoundError struct {
+	ClassName string
+}
+
+func (e ClassNotFoundError) Error() string {
+	return fmt.Sprintf("cannot found class '%s' in classpath", e.ClassName)
+}
+
+// classpath中是Android的dex格式(dex文件, apk或解开的apk目录)而又没有设置DexConverter时返回此错误
+type DexFormatError struct {
+	Path string
+	// apk和目录中的dex文件, 多于一个时是multidex; Path本身是dex文件时为空
+	DexFiles []string
+}
+
+func (e DexFormatError) Error() string {
+	content := "an Android dex file"
+	if len(e.DexFiles) > 0 {
+		content = "Android dex bytecode (" + strings.Join(e.DexFiles, ", ") + ")"
+	}
+
+	return fmt.Sprintf("classpath '%s' is %s, which cannot be executed as JVM class files; "+
+		"convert it to a jar with dex2jar (d2j-dex2jar %s) and put the jar in classpath, or run with -dex2jar <path of d2j-dex2jar> to convert automatically",
+		e.Path, content, e.Path)
+}
+
+// 提前链接发现问题时返回此错误, 包含所有问题
+type LinkError struct {
+	Report *VerifyReport
+}
+
+func (e LinkError) Error() string {
+	lines := make([]string, 0, len(e.Report.Problems) + 1)
+	lines = append(lines, fmt.Sprintf("eager linking found %d problems in %d classes", len(e.Report.Problems), e.Report.ClassCount))
+	for _, problem := range e.Report.Problems {
+		lines = append(lines, "  " + problem.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// 多个线程的<clinit>互相等待对方初始化的类时返回此错误, 而不是一直挂起
+type ClassInitDeadlockError struct {
+	// 等待环, 每一项的OwnerThreadID是下一项的ThreadID, 最后一项回到第一项
+	Cycle []ClassInitWait
+}
+
+// 线程ThreadID在等待ClassName完成初始化, 该类正在由OwnerThreadID初始化
+type ClassInitWait struct {
+	ThreadID      int64
+	ClassName     string
+	OwnerThreadID int64
+}
+
+func (e ClassInitDeadlockError) Error() string {
+	waits := make([]string, 0, len(e.Cycle))
+	for _, wait := range e.Cycle {
+		waits = append(waits, fmt.Sprintf("thread %d waits for '%s' initialized by thread %d", wait.ThreadID, wait.ClassName, wait.OwnerThreadID))
+	}
+
+	return "class initialization deadlock: " + strings.Join(waits, " -> ")
+}
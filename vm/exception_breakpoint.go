@@ -0,0 +1,216 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 异常断点关心的事件
+const (
+	ExceptionThrow = 1 << iota
+	ExceptionCatch
+)
+
+// 异常断点: 匹配的异常被抛出(athrow, 虚拟机或本地方法抛出)或者被catch捕获时命中, 即使异常随后被捕获也会在抛出时命中
+type ExceptionBreakpoint struct {
+	// 异常类或者它的父类, 以.或/分隔; 以.*结尾时匹配整个包, 如com.fh.*
+	ClassName string
+	// ExceptionThrow, ExceptionCatch或两者
+	On int
+	// 第一次命中时中断执行, 返回ExceptionBreakpointError; 为false时只输出
+	Break bool
+
+	hits int64
+}
+
+// 解析 [throw:|catch:|all:]异常类名, 如catch:java.lang.IllegalStateException; 没有前缀时只在抛出时命中
+func ParseExceptionBreakpoint(spec string) (*ExceptionBreakpoint, error) {
+	spec = strings.TrimSpace(spec)
+	on := ExceptionThrow
+	if ix := strings.Index(spec, ":"); ix >= 0 {
+		switch spec[:ix] {
+		case "throw":
+		case "catch":
+			on = ExceptionCatch
+		case "all":
+			on = ExceptionThrow | ExceptionCatch
+		default:
+			return nil, fmt.Errorf("invalid exception breakpoint event '%s', expect throw, catch or all", spec[:ix])
+		}
+		spec = spec[ix + 1:]
+	}
+
+	if "" == spec {
+		return nil, fmt.Errorf("invalid exception breakpoint, expect exception class name")
+	}
+
+	return &ExceptionBreakpoint{ClassName: strings.ReplaceAll(spec, "/", "."), On: on}, nil
+}
+
+// 命中次数
+func (p *ExceptionBreakpoint) Hits() int64 {
+	return atomic.LoadInt64(&p.hits)
+}
+
+func (p *ExceptionBreakpoint) String() string {
+	on := map[int]string{ExceptionThrow: "throw:", ExceptionCatch: "catch:", ExceptionThrow | ExceptionCatch: "all:"}[p.On]
+	return on + p.ClassName
+}
+
+func (p *ExceptionBreakpoint) matches(jvm *MiniJvm, exceptionDef *class.DefFile) bool {
+	className := strings.ReplaceAll(exceptionDef.FullClassName, "/", ".")
+	if strings.HasSuffix(p.ClassName, ".*") {
+		return matchClassPattern(p.ClassName, className)
+	}
+	if p.ClassName == className {
+		return true
+	}
+
+	isSubClass, err := jvm.MethodArea.IsSubClassOf(exceptionDef, strings.ReplaceAll(p.ClassName, ".", "/"))
+	return nil == err && isSubClass
+}
+
+// 一次异常的抛出或捕获
+type ExceptionEvent struct {
+	Breakpoint *ExceptionBreakpoint
+	Catch      bool
+	ThreadID   int64
+	Exception  *class.Reference
+	// 抛出异常的位置, 或者捕获异常的方法中异常到达的位置(调用抛出异常的方法的指令)
+	Location *StackTraceElement
+	// 设置了ExceptionBreakpoints.DumpFrames时为命中时的调用链, 从栈顶到栈底
+	Frames []*StackTraceElement
+}
+
+// 异常断点命中并且设置了Break时返回此错误, 不能被guest捕获
+type ExceptionBreakpointError struct {
+	Event *ExceptionEvent
+}
+
+func (e ExceptionBreakpointError) Error() string {
+	return "exception breakpoint hit: " + e.Event.describe()
+}
+
+// 一组异常断点, 设置到MiniJvm.ExceptionBreakpoints上生效
+type ExceptionBreakpoints struct {
+	// 命中时输出一行, 为nil时不输出
+	Out io.Writer
+	// 命中时同时输出调用链
+	DumpFrames bool
+	// 不为nil时每次命中都调用; 返回error时中断执行
+	OnHit func(event *ExceptionEvent) error
+
+	points  []*ExceptionBreakpoint
+	on      int
+	outLock sync.Mutex
+}
+
+func NewExceptionBreakpoints(out io.Writer) *ExceptionBreakpoints {
+	return &ExceptionBreakpoints{Out: out}
+}
+
+// 需要在执行字节码之前添加
+func (b *ExceptionBreakpoints) Add(points ...*ExceptionBreakpoint) {
+	for _, point := range points {
+		b.on |= point.On
+	}
+	b.points = append(b.points, points...)
+}
+
+func (b *ExceptionBreakpoints) Points() []*ExceptionBreakpoint {
+	return b.points
+}
+
+// 是否有断点关心event(ExceptionThrow或ExceptionCatch), 没有时执行引擎不需要准备事件的位置
+func (b *ExceptionBreakpoints) watches(event int) bool {
+	return 0 != b.on & event
+}
+
+// 异常在frame的当前pc被抛出时调用
+func (b *ExceptionBreakpoints) onThrow(jvm *MiniJvm, frame *MethodStackFrame, exceptionRef *class.Reference) error {
+	if !b.watches(ExceptionThrow) {
+		return nil
+	}
+
+	return b.check(jvm, ExceptionThrow, frame, frame.stackTraceElement(), exceptionRef)
+}
+
+// 异常被frame中的handler捕获后调用, location为捕获之前异常到达的位置
+func (b *ExceptionBreakpoints) onCatch(jvm *MiniJvm, frame *MethodStackFrame, location *StackTraceElement, exceptionRef *class.Reference) error {
+	return b.check(jvm, ExceptionCatch, frame, location, exceptionRef)
+}
+
+func (b *ExceptionBreakpoints) check(jvm *MiniJvm, on int, frame *MethodStackFrame, location *StackTraceElement, exceptionRef *class.Reference) error {
+	for _, point := range b.points {
+		if 0 == point.On & on || !point.matches(jvm, exceptionRef.Object.DefFile) {
+			continue
+		}
+
+		atomic.AddInt64(&point.hits, 1)
+		event := &ExceptionEvent{
+			Breakpoint: point,
+			Catch:      ExceptionCatch == on,
+			ThreadID:   frame.ThreadID(),
+			Exception:  exceptionRef,
+			Location:   location,
+		}
+		if b.DumpFrames {
+			event.Frames = frame.StackTrace()
+			if len(event.Frames) > 0 {
+				event.Frames[0] = location
+			}
+		}
+		if err := b.onHit(event); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *ExceptionBreakpoints) onHit(event *ExceptionEvent) error {
+	if nil != b.Out {
+		b.outLock.Lock()
+		fmt.Fprintf(b.Out, "[exception] %s\n", event.describe())
+		for _, elem := range event.Frames {
+			fmt.Fprintf(b.Out, "\tat %s\n", elem)
+		}
+		b.outLock.Unlock()
+	}
+
+	if nil != b.OnHit {
+		if err := b.OnHit(event); nil != err {
+			return err
+		}
+	}
+	if event.Breakpoint.Break {
+		return &ExceptionBreakpointError{Event: event}
+	}
+
+	return nil
+}
+
+// 如 thread 1 com.fh.Main.main([Ljava/lang/String;)V pc 12 (Main.java:8): throw java.lang.IllegalStateException: bad state
+func (e *ExceptionEvent) describe() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "thread %d %s.%s%s pc %d", e.ThreadID, e.Location.ClassName, e.Location.MethodName, e.Location.MethodDescriptor, e.Location.Pc)
+	if e.Location.LineNumber >= 0 {
+		fmt.Fprintf(&sb, " (%s:%d)", e.Location.FileName, e.Location.LineNumber)
+	}
+
+	if e.Catch {
+		sb.WriteString(": catch ")
+	} else {
+		sb.WriteString(": throw ")
+	}
+	sb.WriteString(strings.ReplaceAll(e.Exception.Object.DefFile.FullClassName, "/", "."))
+	if msg := exceptionDetailMessage(e.Exception); "" != msg {
+		sb.WriteString(": " + msg)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestParseExceptionBreakpoint(t *testing.T) {
+	cases := []struct {
+		spec      string
+		className string
+		on        int
+	}{
+		{"java.lang.IllegalStateException", "java.lang.IllegalStateException", ExceptionThrow},
+		{"catch:java/lang/IllegalStateException", "java.lang.IllegalStateException", ExceptionCatch},
+		{" all:com.fh.* ", "com.fh.*", ExceptionThrow | ExceptionCatch},
+	}
+	for _, c := range cases {
+		point, err := ParseExceptionBreakpoint(c.spec)
+		if nil != err || c.className != point.ClassName || c.on != point.On {
+			t.Fatalf("%s: unexpected breakpoint %+v, %v", c.spec, point, err)
+		}
+	}
+
+	for _, spec := range []string{"", "catch:", "rethrow:java.lang.Exception"} {
+		if _, err := ParseExceptionBreakpoint(spec); nil == err {
+			t.Fatalf("%s: expect error", spec)
+		}
+	}
+}
+
+// static int calc(int a, int b) { try { return a / b; } catch (ArithmeticException e) { return -1; } }
+func newExceptionBreakpointJvm(t *testing.T) (*MiniJvm, *class.DefFile) {
+	// ArithmeticException extends RuntimeException { ArithmeticException(String s) { detailMessage = s; } }
+	exception := newClassBuilder("java/lang/ArithmeticException", "java/lang/RuntimeException")
+	exception.field("detailMessage", "Ljava/lang/String;")
+	exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef("java/lang/ArithmeticException", "detailMessage", "Ljava/lang/String;")).
+		emit(bcode.Return))
+
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(accflag.Static, "calc", "(II)I", 2, 2, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iload1, bcode.Idiv, bcode.Ireturn).
+		emit(bcode.Pop, bcode.Iconst1, bcode.Ineg, bcode.Ireturn))
+	b.def.Methods[0].Attrs[0].(*class.CodeAttr).ExceptionTable = []*class.ExceptionTable{
+		{StartPc: 0, EndPc: 4, HandlerPc: 4, CatchType: b.classRef("java/lang/ArithmeticException")},
+	}
+
+	jvm, err := newClassInitTestJvm(exception.def, b.def,
+		newTestClass("java/lang/RuntimeException", "java/lang/Object", nil),
+		newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return jvm, b.def
+}
+
+func runExceptionBreakpointCalc(jvm *MiniJvm, def *class.DefFile, a int, b int) (interface{}, error) {
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.Push(a)
+	frame.opStack.Push(b)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "calc", "(II)I", frame, false); nil != err {
+		return nil, err
+	}
+	ret, _ := frame.opStack.Pop()
+	return ret, nil
+}
+
+func TestExceptionBreakpointThrowAndCatch(t *testing.T) {
+	jvm, def := newExceptionBreakpointJvm(t)
+
+	out := new(bytes.Buffer)
+	jvm.ExceptionBreakpoints = NewExceptionBreakpoints(out)
+	// 按父类匹配抛出, 按包匹配捕获, 其他包不命中
+	throwPoint, _ := ParseExceptionBreakpoint("java.lang.RuntimeException")
+	catchPoint, _ := ParseExceptionBreakpoint("catch:java.lang.*")
+	otherPoint, _ := ParseExceptionBreakpoint("all:com.fh.*")
+	jvm.ExceptionBreakpoints.Add(throwPoint, catchPoint, otherPoint)
+
+	var events []*ExceptionEvent
+	jvm.ExceptionBreakpoints.OnHit = func(event *ExceptionEvent) error {
+		events = append(events, event)
+		return nil
+	}
+
+	// 被捕获的异常也会命中
+	if ret, err := runExceptionBreakpointCalc(jvm, def, 7, 0); nil != err || -1 != ret {
+		t.Fatalf("expect caught exception, got %v, %v", ret, err)
+	}
+	if ret, err := runExceptionBreakpointCalc(jvm, def, 7, 7); nil != err || 1 != ret {
+		t.Fatalf("unexpected result %v, %v", ret, err)
+	}
+
+	if 1 != throwPoint.Hits() || 1 != catchPoint.Hits() || 0 != otherPoint.Hits() {
+		t.Fatalf("unexpected hits %d, %d, %d", throwPoint.Hits(), catchPoint.Hits(), otherPoint.Hits())
+	}
+	if 2 != len(events) || events[0].Catch || !events[1].Catch {
+		t.Fatalf("expect throw then catch, got %d events", len(events))
+	}
+	for _, event := range events {
+		if 2 != event.Location.Pc || "calc" != event.Location.MethodName {
+			t.Fatalf("unexpected location %+v", event.Location)
+		}
+	}
+
+	for _, expect := range []string{
+		" com.fh.Calc.calc(II)I pc 2: throw java.lang.ArithmeticException: / by zero\n",
+		" com.fh.Calc.calc(II)I pc 2: catch java.lang.ArithmeticException: / by zero\n",
+	} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("output does not contain '%s':\n%s", expect, out)
+		}
+	}
+}
+
+func TestExceptionBreakpointBreak(t *testing.T) {
+	jvm, def := newExceptionBreakpointJvm(t)
+
+	out := new(bytes.Buffer)
+	jvm.ExceptionBreakpoints = NewExceptionBreakpoints(out)
+	jvm.ExceptionBreakpoints.DumpFrames = true
+	point, _ := ParseExceptionBreakpoint("java.lang.ArithmeticException")
+	point.Break = true
+	jvm.ExceptionBreakpoints.Add(point)
+
+	// 中断时异常不会被guest捕获
+	_, err := runExceptionBreakpointCalc(jvm, def, 7, 0)
+	var breakErr *ExceptionBreakpointError
+	if !errors.As(err, &breakErr) || point != breakErr.Event.Breakpoint {
+		t.Fatalf("expect exception breakpoint, got %v", err)
+	}
+	if report := NewErrorReport(err); "breakpoint" != report.Kind {
+		t.Fatalf("unexpected kind %s", report.Kind)
+	}
+
+	if 1 != len(breakErr.Event.Frames) || 2 != breakErr.Event.Frames[0].Pc {
+		t.Fatalf("unexpected frames %v", breakErr.Event.Frames)
+	}
+	if !strings.Contains(out.String(), "\tat com.fh.Calc.calc") {
+		t.Fatalf("frames not dumped:\n%s", out)
+	}
+}
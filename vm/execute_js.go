@@ -0,0 +1,124 @@
+//go:build js && wasm
+// +build js,wasm
+
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+// 在js全局对象上注册执行函数, 页面中的用法:
+//   miniJvmExecute({
+//       jars: [Uint8Array, ...],                   // 可选, 按顺序作为classpath
+//       classes: {"com/fh/Hello": Uint8Array},     // 可选, 单独的class文件
+//       mainClass: "com.fh.Hello",
+//       args: ["a", "b"],                          // 可选
+//       stdin: "input\n",                          // 可选
+//   }).then(r => console.log(r.stdout, r.stderr, r.exitCode, r.error))
+// 返回的Promise总是resolve, 执行失败时error为错误信息, 否则为null; 输出同时打印到浏览器控制台
+func RegisterJSExecute(name string) {
+	js.Global().Set(name, js.FuncOf(jsExecute))
+}
+
+func jsExecute(this js.Value, args []js.Value) interface{} {
+	var options js.Value
+	if len(args) > 0 {
+		options = args[0]
+	}
+
+	executor := js.FuncOf(func(this js.Value, promiseArgs []js.Value) interface{} {
+		resolve := promiseArgs[0]
+		// 不能阻塞js的事件循环, guest程序在单独的goroutine中执行
+		go func() {
+			resolve.Invoke(runJSExecute(options))
+		}()
+
+		return nil
+	})
+	defer executor.Release()
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+func runJSExecute(options js.Value) map[string]interface{} {
+	result := func(r *RunResult) map[string]interface{} {
+		var errText interface{}
+		if nil != r.Err {
+			errText = r.Err.Error()
+		}
+
+		return map[string]interface{}{
+			"stdout":   r.Stdout,
+			"stderr":   r.Stderr,
+			"exitCode": r.ExitCode,
+			"error":    errText,
+		}
+	}
+	fail := func(err error) map[string]interface{} {
+		return result(&RunResult{ExitCode: ExitCodeOf(err), Err: err})
+	}
+
+	if js.TypeObject != options.Type() {
+		return fail(fmt.Errorf("options object expected"))
+	}
+	mainClass := jsStringField(options, "mainClass")
+	if "" == mainClass {
+		return fail(fmt.Errorf("mainClass is required"))
+	}
+
+	var jars [][]byte
+	if value := options.Get("jars"); js.TypeObject == value.Type() {
+		for ix := 0; ix < value.Length(); ix++ {
+			jars = append(jars, jsBytes(value.Index(ix)))
+		}
+	}
+	if value := options.Get("classes"); js.TypeObject == value.Type() {
+		keys := js.Global().Get("Object").Call("keys", value)
+		classes := make(map[string][]byte, keys.Length())
+		for ix := 0; ix < keys.Length(); ix++ {
+			name := keys.Index(ix).String()
+			classes[name] = jsBytes(value.Get(name))
+		}
+
+		jar, err := buildClassesJar(classes)
+		if nil != err {
+			return fail(fmt.Errorf("failed to pack classes: %w", err))
+		}
+		// 单独的class优先于jar中的同名类
+		jars = append([][]byte{jar}, jars...)
+	}
+
+	var cmdArgs []string
+	if value := options.Get("args"); js.TypeObject == value.Type() {
+		for ix := 0; ix < value.Length(); ix++ {
+			cmdArgs = append(cmdArgs, value.Index(ix).String())
+		}
+	}
+
+	stdin := strings.NewReader(jsStringField(options, "stdin"))
+
+	return result(RunMainJars(jars, mainClass, cmdArgs, stdin, hostStdout, hostStderr))
+}
+
+func jsStringField(v js.Value, name string) string {
+	field := v.Get(name)
+	if js.TypeString != field.Type() {
+		return ""
+	}
+
+	return field.String()
+}
+
+// 把Uint8Array或ArrayBuffer复制到Go的切片中
+func jsBytes(v js.Value) []byte {
+	if v.InstanceOf(js.Global().Get("ArrayBuffer")) {
+		v = js.Global().Get("Uint8Array").New(v)
+	}
+
+	buf := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(buf, v)
+
+	return buf
+}
@@ -0,0 +1,235 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"sync"
+)
+
+// 每个线程最近执行的指令, 用于在出错或者观察点中断后倒退查看值是怎样变化的;
+// 每条指令执行前保存栈帧的快照(pc, 本地变量和操作数栈), 每个线程只保留最近Size条.
+// 本地变量按写时复制保存: 同一栈帧中上一条指令不写本地变量时, 快照共享上一个快照的本地变量
+type ExecutionHistory struct {
+	// 每个线程保留的快照个数
+	Size int
+
+	// key: 线程编号, val: *threadHistory
+	threads sync.Map
+}
+
+// 默认每个线程保留的快照个数
+const DefaultHistorySize = 1000
+
+// 一条指令执行前的栈帧状态
+type FrameSnapshot struct {
+	// 线程中指令的序号, 从1开始
+	Seq      int64
+	ThreadID int64
+	Depth    int
+	Pc       int
+	Opcode   byte
+
+	// 本地变量, long和double之后的槽为nil; 与其他快照共享时不能修改
+	Locals []interface{}
+	// 操作数栈, 从栈底到栈顶
+	Stack []interface{}
+
+	method *class.MethodInfo
+}
+
+// 一个线程的环形缓冲区
+type threadHistory struct {
+	lock      sync.Mutex
+	snapshots []*FrameSnapshot
+	// 下一个快照的位置
+	next  int
+	count int64
+
+	// 上一个快照的栈帧, 用于判断能否共享本地变量
+	lastFrame *MethodStackFrame
+	last      *FrameSnapshot
+}
+
+// size <= 0时使用DefaultHistorySize
+func NewExecutionHistory(size int) *ExecutionHistory {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	return &ExecutionHistory{Size: size}
+}
+
+// 每条指令执行前调用
+func (h *ExecutionHistory) onInstruction(frame *MethodStackFrame, byteCode byte) {
+	threadID := frame.ThreadID()
+	val, ok := h.threads.Load(threadID)
+	if !ok {
+		val, _ = h.threads.LoadOrStore(threadID, &threadHistory{snapshots: make([]*FrameSnapshot, h.Size)})
+	}
+	history := val.(*threadHistory)
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	history.count++
+	snapshot := &FrameSnapshot{
+		Seq:      history.count,
+		ThreadID: threadID,
+		Depth:    frame.depth,
+		Pc:       frame.pc,
+		Opcode:   byteCode,
+		Stack:    frame.opStack.Elements(),
+		method:   frame.method,
+	}
+	if frame == history.lastFrame && !writesLocal(history.last.Opcode) {
+		snapshot.Locals = history.last.Locals
+	} else {
+		snapshot.Locals = make([]interface{}, len(frame.localVariablesTable))
+		for ix := range snapshot.Locals {
+			snapshot.Locals[ix] = frame.getLocalTableAt(ix)
+		}
+	}
+
+	history.snapshots[history.next] = snapshot
+	history.next = (history.next + 1) % len(history.snapshots)
+	history.lastFrame = frame
+	history.last = snapshot
+}
+
+// 指令是否可能修改当前栈帧的本地变量: xstore, iinc, 以及wide修饰的这两类指令
+func writesLocal(op byte) bool {
+	return (op >= bcode.Istore && op <= bcode.Astore3) || bcode.Iinc == op || bcode.Wide == op
+}
+
+// 线程保留的快照, 从旧到新排列; 线程没有执行过指令时返回nil
+func (h *ExecutionHistory) Snapshots(threadID int64) []*FrameSnapshot {
+	val, ok := h.threads.Load(threadID)
+	if !ok {
+		return nil
+	}
+	history := val.(*threadHistory)
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	var snapshots []*FrameSnapshot
+	for ix := 0; ix < len(history.snapshots); ix++ {
+		if snapshot := history.snapshots[(history.next + ix) % len(history.snapshots)]; nil != snapshot {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	return snapshots
+}
+
+// 从线程最近执行的指令开始倒退查看
+func (h *ExecutionHistory) Cursor(threadID int64) *HistoryCursor {
+	snapshots := h.Snapshots(threadID)
+	return &HistoryCursor{snapshots: snapshots, pos: len(snapshots) - 1}
+}
+
+// 从新到旧输出线程的快照, 即逐条倒退的结果
+func (h *ExecutionHistory) Dump(w io.Writer, threadID int64, renderer *ObjectRenderer) {
+	cursor := h.Cursor(threadID)
+	if nil == cursor.Current() {
+		fmt.Fprintf(w, "no execution history for thread %d\n", threadID)
+		return
+	}
+
+	fmt.Fprintf(w, "last %d instructions of thread %d, newest first:\n", len(cursor.snapshots), threadID)
+	for snapshot := cursor.Current(); nil != snapshot; snapshot = cursor.StepBack() {
+		fmt.Fprintf(w, "  %s\n", snapshot.Describe(renderer))
+	}
+}
+
+// 出错的线程, 用于选择输出哪个线程的快照; 错误中没有线程编号时为主线程
+func ErrorThreadID(err error) int64 {
+	var watch *WatchpointError
+	if errors.As(err, &watch) {
+		return watch.Event.ThreadID
+	}
+	var exceptionBreak *ExceptionBreakpointError
+	if errors.As(err, &exceptionBreak) {
+		return exceptionBreak.Event.ThreadID
+	}
+
+	return 1
+}
+
+// 在快照之间前后移动的位置
+type HistoryCursor struct {
+	snapshots []*FrameSnapshot
+	pos       int
+}
+
+// 当前位置的快照, 没有快照时返回nil
+func (c *HistoryCursor) Current() *FrameSnapshot {
+	if c.pos < 0 || c.pos >= len(c.snapshots) {
+		return nil
+	}
+
+	return c.snapshots[c.pos]
+}
+
+// 倒退一条指令, 已经是最早的快照时返回nil
+func (c *HistoryCursor) StepBack() *FrameSnapshot {
+	if c.pos < 0 {
+		return nil
+	}
+
+	c.pos--
+	return c.Current()
+}
+
+// 前进一条指令, 已经是最新的快照时返回nil
+func (c *HistoryCursor) StepForward() *FrameSnapshot {
+	if c.pos >= len(c.snapshots) {
+		return nil
+	}
+
+	c.pos++
+	return c.Current()
+}
+
+// 倒退到满足条件的快照, 如本地变量第一次变成某个值之前; 找不到时返回nil
+func (c *HistoryCursor) StepBackUntil(match func(snapshot *FrameSnapshot) bool) *FrameSnapshot {
+	for snapshot := c.StepBack(); nil != snapshot; snapshot = c.StepBack() {
+		if match(snapshot) {
+			return snapshot
+		}
+	}
+
+	return nil
+}
+
+// 执行的方法, 如com.fh.Foo.bar(I)I
+func (s *FrameSnapshot) Method() string {
+	if nil == s.method {
+		return ""
+	}
+
+	def := s.method.DefFile
+	desc := def.ConstPool.At(s.method.DescriptorIndex).(*class.Utf8InfoConst).String()
+	return strings.ReplaceAll(def.FullClassName, "/", ".") + "." + s.method.String() + desc
+}
+
+// 如 #12 depth 1 com.fh.Foo.bar(I)I pc 3: iadd locals [1, 2] stack [1, 2]
+func (s *FrameSnapshot) Describe(renderer *ObjectRenderer) string {
+	if nil == renderer {
+		renderer = DefaultObjectRenderer
+	}
+	render := func(values []interface{}) string {
+		texts := make([]string, len(values))
+		for ix, val := range values {
+			texts[ix] = renderer.Render(val)
+		}
+		return "[" + strings.Join(texts, ", ") + "]"
+	}
+
+	return fmt.Sprintf("#%d depth %d %s pc %d: %s locals %s stack %s", s.Seq, s.Depth, s.Method(), s.Pc, bcode.ToName(s.Opcode),
+		render(s.Locals), render(s.Stack))
+}
@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strings"
+	"testing"
+)
+
+// static int calc(int x) { int y = x; y += 3; return y + x; }
+func runWithHistory(t *testing.T, history *ExecutionHistory, x int) int64 {
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(accflag.Static, "calc", "(I)I", 2, 2, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Istore1, bcode.Iinc, 1, 3, bcode.Iload1, bcode.Iload0, bcode.Iadd, bcode.Ireturn))
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.History = history
+
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.Push(x)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+
+	return frame.ThreadID()
+}
+
+func TestExecutionHistory(t *testing.T) {
+	history := NewExecutionHistory(0)
+	threadID := runWithHistory(t, history, 2)
+
+	snapshots := history.Snapshots(threadID)
+	var pcs []int
+	for _, snapshot := range snapshots {
+		pcs = append(pcs, snapshot.Pc)
+	}
+	if "[0 1 2 5 6 7 8]" != fmt.Sprint(pcs) {
+		t.Fatalf("unexpected pcs %v", pcs)
+	}
+	if "com.fh.Calc.calc(I)I" != snapshots[0].Method() || bcode.Iadd != snapshots[5].Opcode || 6 != snapshots[5].Seq {
+		t.Fatalf("unexpected snapshot %+v", snapshots[5])
+	}
+
+	// 本地变量只在xstore和iinc之后复制
+	if &snapshots[0].Locals[0] != &snapshots[1].Locals[0] || &snapshots[1].Locals[0] == &snapshots[2].Locals[0] ||
+		&snapshots[2].Locals[0] == &snapshots[3].Locals[0] || &snapshots[3].Locals[0] != &snapshots[6].Locals[0] {
+		t.Fatal("locals should be copied only after a store")
+	}
+	if 2 != snapshots[2].Locals[1] || 5 != snapshots[3].Locals[1] {
+		t.Fatalf("unexpected locals %v, %v", snapshots[2].Locals, snapshots[3].Locals)
+	}
+
+	// 从ireturn倒退到y第一次不是5的位置
+	cursor := history.Cursor(threadID)
+	if 8 != cursor.Current().Pc {
+		t.Fatalf("cursor should start at the newest snapshot, got pc %d", cursor.Current().Pc)
+	}
+	found := cursor.StepBackUntil(func(snapshot *FrameSnapshot) bool {
+		return 5 != snapshot.Locals[1]
+	})
+	if nil == found || 2 != found.Pc {
+		t.Fatalf("expect iinc at pc 2, got %+v", found)
+	}
+	if next := cursor.StepForward(); 5 != next.Pc {
+		t.Fatalf("expect pc 5 after stepping forward, got %d", next.Pc)
+	}
+	if 2 != cursor.StepBack().Pc || 1 != cursor.StepBack().Pc || 0 != cursor.StepBack().Pc || nil != cursor.StepBack() {
+		t.Fatal("cursor should stop before the oldest snapshot")
+	}
+
+	var out bytes.Buffer
+	history.Dump(&out, threadID, nil)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if 8 != len(lines) || !strings.Contains(lines[0], "last 7 instructions") ||
+		"#6 depth 1 com.fh.Calc.calc(I)I pc 7: iadd locals [2, 5] stack [5, 2]" != strings.TrimSpace(lines[2]) {
+		t.Fatalf("unexpected dump\n%s", out.String())
+	}
+
+	// 只保留最近的Size条
+	history = NewExecutionHistory(3)
+	threadID = runWithHistory(t, history, 2)
+	snapshots = history.Snapshots(threadID)
+	if 3 != len(snapshots) || 6 != snapshots[0].Pc || 8 != snapshots[2].Pc || 7 != snapshots[2].Seq {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+	if nil != history.Snapshots(threadID + 1) || nil != history.Cursor(threadID + 1).Current() {
+		t.Fatal("unknown thread should have no history")
+	}
+}
@@ -0,0 +1,517 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+	"time"
+)
+
+// Executors创建的线程池和submit返回的Future, 由go实现;
+// JDK的ThreadPoolExecutor依赖java.lang.Thread和AQS, 无法解释执行
+const (
+	executorServiceClassName = "cn/minijvm/concurrency/GoExecutorService"
+	futureClassName          = "cn/minijvm/concurrency/GoFuture"
+)
+
+func newExecutorServiceClass() *class.DefFile {
+	b := newClassBuilder(executorServiceClassName, "java/lang/Object").implements("java/util/concurrent/ExecutorService")
+	native := uint16(accflag.Public | accflag.Native)
+	b.method(native, "execute", "(Ljava/lang/Runnable;)V", 0, 0, nil)
+	b.method(native, "submit", "(Ljava/util/concurrent/Callable;)Ljava/util/concurrent/Future;", 0, 0, nil)
+	b.method(native, "submit", "(Ljava/lang/Runnable;)Ljava/util/concurrent/Future;", 0, 0, nil)
+	b.method(native, "shutdown", "()V", 0, 0, nil)
+	b.method(native, "isShutdown", "()Z", 0, 0, nil)
+	b.method(native, "isTerminated", "()Z", 0, 0, nil)
+	b.method(native, "awaitTermination", "(JLjava/util/concurrent/TimeUnit;)Z", 0, 0, nil)
+
+	return b.def
+}
+
+func newFutureClass() *class.DefFile {
+	b := newClassBuilder(futureClassName, "java/lang/Object").implements("java/util/concurrent/Future")
+	native := uint16(accflag.Public | accflag.Native)
+	b.method(native, "get", "()Ljava/lang/Object;", 0, 0, nil)
+	b.method(native, "get", "(JLjava/util/concurrent/TimeUnit;)Ljava/lang/Object;", 0, 0, nil)
+	b.method(native, "isDone", "()Z", 0, 0, nil)
+	b.method(native, "cancel", "(Z)Z", 0, 0, nil)
+	b.method(native, "isCancelled", "()Z", 0, 0, nil)
+
+	return b.def
+}
+
+// 线程池的go端状态
+type guestExecutor struct {
+	jvm *MiniJvm
+
+	// 待执行的任务, shutdown时关闭; 容量用完后submit会等待
+	tasks chan *guestFuture
+	// 工作线程数量, 0表示每个任务一个线程(newCachedThreadPool)
+	workers int
+
+	shutdown bool
+	lock     sync.Mutex
+	// 已经通过检查, 正在等待放入tasks的submit; shutdown等它们结束后才关闭tasks
+	submitting sync.WaitGroup
+	// 所有任务执行完, 工作线程退出后关闭
+	terminated chan struct{}
+	// 工作线程和正在执行的任务, 以及shutdown之前额外的一个计数
+	running sync.WaitGroup
+}
+
+// submit返回的Future的go端状态
+type guestFuture struct {
+	// Runnable或Callable对象
+	task *class.Reference
+	// true时调用call(), 否则调用run()
+	callable bool
+
+	result interface{}
+	err    error
+	// 任务执行完成或取消后关闭
+	done chan struct{}
+
+	// 0: 等待执行, 1: 执行中, 2: 完成, 3: 已取消
+	state int
+	lock  sync.Mutex
+}
+
+const (
+	futurePending = iota
+	futureRunning
+	futureCompleted
+	futureCancelled
+)
+
+const guestExecutorQueueSize = 1024
+
+func newGuestExecutor(jvm *MiniJvm, workers int) (*class.Reference, error) {
+	def, err := jvm.MethodArea.LoadClass(executorServiceClassName)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load '%s': %w", executorServiceClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return nil, err
+	}
+
+	executor := &guestExecutor{
+		jvm:        jvm,
+		tasks:      make(chan *guestFuture, guestExecutorQueueSize),
+		workers:    workers,
+		terminated: make(chan struct{}),
+	}
+	// shutdown时释放, 保证shutdown之前不会被标记为已终止
+	executor.running.Add(1)
+	for ix := 0; ix < workers; ix++ {
+		executor.running.Add(1)
+		go executor.work()
+	}
+	// 所有工作线程和任务结束后标记为已终止
+	go func() {
+		executor.running.Wait()
+		close(executor.terminated)
+	}()
+
+	// 状态保存在GoExecutorService对象上, 随对象一起回收
+	ref.Object.SetHostState(executor)
+	return ref, nil
+}
+
+// 工作线程, 同一个工作线程中执行的任务共用一个线程编号, 与java线程池中的线程对应
+func (e *guestExecutor) work() {
+	defer e.running.Done()
+
+	root := &MethodStackFrame{opStack: NewOpStack(1), threadID: nextThreadID()}
+	for future := range e.tasks {
+		future.run(e.jvm, root)
+	}
+}
+
+func (e *guestExecutor) submit(future *guestFuture) error {
+	e.lock.Lock()
+	if e.shutdown {
+		e.lock.Unlock()
+		return fmt.Errorf("java.util.concurrent.RejectedExecutionException: executor has been shut down")
+	}
+
+	if 0 == e.workers {
+		e.running.Add(1)
+		e.lock.Unlock()
+		go func() {
+			defer e.running.Done()
+			future.run(e.jvm, &MethodStackFrame{opStack: NewOpStack(1), threadID: nextThreadID()})
+		}()
+		return nil
+	}
+
+	// 队列满时会等待, 不能持有lock, 否则其他线程的shutdown, isShutdown也会被阻塞
+	e.submitting.Add(1)
+	e.lock.Unlock()
+
+	e.tasks <- future
+	e.submitting.Done()
+	return nil
+}
+
+func (e *guestExecutor) doShutdown() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.shutdown {
+		return
+	}
+	e.shutdown = true
+
+	// 之后不会再有submit通过检查, 等已经通过的放入队列后再关闭
+	go func() {
+		e.submitting.Wait()
+		close(e.tasks)
+		e.running.Done()
+	}()
+}
+
+// 在root所在的线程中执行任务
+func (f *guestFuture) run(jvm *MiniJvm, root *MethodStackFrame) {
+	f.lock.Lock()
+	if futurePending != f.state {
+		f.lock.Unlock()
+		return
+	}
+	f.state = futureRunning
+	f.lock.Unlock()
+
+	// 与MiniThread一样, 防止任务中的错误导致进程崩溃
+	defer func() {
+		if r := recover(); nil != r {
+			f.complete(nil, fmt.Errorf("task panicked: %v", r))
+		}
+	}()
+
+	methodName, descriptor := "run", "()V"
+	if f.callable {
+		methodName, descriptor = "call", "()Ljava/lang/Object;"
+	}
+
+	root.opStack.Push(f.task)
+	err := jvm.ExecutionEngine.ExecuteWithFrame(f.task.Object.DefFile, methodName, descriptor, root, true)
+	var result interface{}
+	if nil == err && f.callable {
+		result, _ = root.opStack.Pop()
+	}
+	if nil != err {
+		utils.LogInfoPrintf("task '%s' failed: %v", f.task.Object.DefFile.FullClassName, err)
+	}
+
+	f.complete(result, err)
+}
+
+func (f *guestFuture) complete(result interface{}, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if futureRunning != f.state {
+		return
+	}
+	f.result, f.err = result, err
+	f.state = futureCompleted
+	close(f.done)
+}
+
+func (f *guestFuture) cancel() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// 已经开始执行的任务不能中断
+	if futurePending != f.state {
+		return false
+	}
+	f.state = futureCancelled
+	close(f.done)
+
+	return true
+}
+
+// 任务完成后返回结果, 任务抛出的异常包装成ExecutionException
+func (f *guestFuture) get() interface{} {
+	<-f.done
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if futureCancelled == f.state {
+		return fmt.Errorf("java.util.concurrent.CancellationException: task was cancelled")
+	}
+	if thrown, ok := f.err.(*ExceptionThrownError); ok {
+		return fmt.Errorf("java.util.concurrent.ExecutionException: %s", thrown.ExceptionRef.Object.DefFile.FullClassName)
+	}
+	if nil != f.err {
+		return fmt.Errorf("java.util.concurrent.ExecutionException: %v", f.err)
+	}
+
+	return f.result
+}
+
+func executorOf(ref interface{}) (*guestExecutor, error) {
+	if obj := toReference(ref); nil != obj && nil != obj.Object {
+		if executor, ok := obj.Object.HostState().(*guestExecutor); ok {
+			return executor, nil
+		}
+	}
+
+	return nil, fmt.Errorf("object is not a executor created by Executors")
+}
+
+func futureOf(ref interface{}) (*guestFuture, error) {
+	if obj := toReference(ref); nil != obj && nil != obj.Object {
+		if future, ok := obj.Object.HostState().(*guestFuture); ok {
+			return future, nil
+		}
+	}
+
+	return nil, fmt.Errorf("object is not a future created by ExecutorService.submit()")
+}
+
+// 把TimeUnit枚举和数量转换成go的时长
+func timeUnitDuration(amount int64, unitRef interface{}) (time.Duration, error) {
+	ref, ok := unitRef.(*class.Reference)
+	if !ok || nil == ref {
+		return 0, fmt.Errorf("java.lang.NullPointerException: TimeUnit is null")
+	}
+
+	nameRef, _ := ref.Object.GetFieldValue("name")
+	nameStrRef, ok := nameRef.(*class.Reference)
+	if !ok || nil == nameStrRef {
+		return 0, fmt.Errorf("invalid TimeUnit object")
+	}
+	name, err := class.StringRunes(nameStrRef)
+	if nil != err {
+		return 0, err
+	}
+
+	units := map[string]time.Duration{
+		"NANOSECONDS":  time.Nanosecond,
+		"MICROSECONDS": time.Microsecond,
+		"MILLISECONDS": time.Millisecond,
+		"SECONDS":      time.Second,
+		"MINUTES":      time.Minute,
+		"HOURS":        time.Hour,
+		"DAYS":         24 * time.Hour,
+	}
+	unit, ok := units[string(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown TimeUnit '%s'", string(name))
+	}
+
+	return time.Duration(amount) * unit, nil
+}
+
+// Executors.newFixedThreadPool(int)
+func ExecutorsNewFixedThreadPool(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	threads := args[2].(int)
+	if threads <= 0 {
+		return fmt.Errorf("java.lang.IllegalArgumentException: nThreads must be positive: %d", threads)
+	}
+
+	ref, err := newGuestExecutor(jvm, threads)
+	if nil != err {
+		return err
+	}
+	return ref
+}
+
+// Executors.newSingleThreadExecutor()
+func ExecutorsNewSingleThreadExecutor(args ...interface{}) interface{} {
+	ref, err := newGuestExecutor(args[0].(*MiniJvm), 1)
+	if nil != err {
+		return err
+	}
+	return ref
+}
+
+// Executors.newCachedThreadPool(), 每个任务一个goroutine
+func ExecutorsNewCachedThreadPool(args ...interface{}) interface{} {
+	ref, err := newGuestExecutor(args[0].(*MiniJvm), 0)
+	if nil != err {
+		return err
+	}
+	return ref
+}
+
+func submitTask(args []interface{}, callable bool) (*class.Reference, error) {
+	jvm := args[0].(*MiniJvm)
+	executor, err := executorOf(args[1])
+	if nil != err {
+		return nil, err
+	}
+
+	task, ok := args[2].(*class.Reference)
+	if !ok || nil == task {
+		return nil, fmt.Errorf("java.lang.NullPointerException: task is null")
+	}
+
+	def, err := jvm.MethodArea.LoadClass(futureClassName)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load '%s': %w", futureClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return nil, err
+	}
+
+	future := &guestFuture{task: task, callable: callable, done: make(chan struct{})}
+	ref.Object.SetHostState(future)
+
+	if err := executor.submit(future); nil != err {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// ExecutorService.execute(Runnable)
+func ExecutorServiceExecute(args ...interface{}) interface{} {
+	if _, err := submitTask(args, false); nil != err {
+		return err
+	}
+	return nil
+}
+
+// ExecutorService.submit(Callable)
+func ExecutorServiceSubmitCallable(args ...interface{}) interface{} {
+	ref, err := submitTask(args, true)
+	if nil != err {
+		return err
+	}
+	return ref
+}
+
+// ExecutorService.submit(Runnable), Future.get()返回null
+func ExecutorServiceSubmitRunnable(args ...interface{}) interface{} {
+	ref, err := submitTask(args, false)
+	if nil != err {
+		return err
+	}
+	return ref
+}
+
+// ExecutorService.shutdown(), 已经提交的任务继续执行, 之后提交的任务被拒绝
+func ExecutorServiceShutdown(args ...interface{}) interface{} {
+	executor, err := executorOf(args[1])
+	if nil != err {
+		return err
+	}
+	executor.doShutdown()
+
+	return nil
+}
+
+func ExecutorServiceIsShutdown(args ...interface{}) interface{} {
+	executor, err := executorOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	executor.lock.Lock()
+	defer executor.lock.Unlock()
+	return executor.shutdown
+}
+
+func ExecutorServiceIsTerminated(args ...interface{}) interface{} {
+	executor, err := executorOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	select {
+	case <-executor.terminated:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExecutorService.awaitTermination(long, TimeUnit)
+func ExecutorServiceAwaitTermination(args ...interface{}) interface{} {
+	executor, err := executorOf(args[1])
+	if nil != err {
+		return err
+	}
+	timeout, err := timeUnitDuration(toInt64(args[2]), args[3])
+	if nil != err {
+		return err
+	}
+
+	select {
+	case <-executor.terminated:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Future.get()
+func FutureGet(args ...interface{}) interface{} {
+	future, err := futureOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	return future.get()
+}
+
+// Future.get(long, TimeUnit)
+func FutureGetTimeout(args ...interface{}) interface{} {
+	future, err := futureOf(args[1])
+	if nil != err {
+		return err
+	}
+	timeout, err := timeUnitDuration(toInt64(args[2]), args[3])
+	if nil != err {
+		return err
+	}
+
+	select {
+	case <-future.done:
+		return future.get()
+	case <-time.After(timeout):
+		return fmt.Errorf("java.util.concurrent.TimeoutException: task not completed in %v", timeout)
+	}
+}
+
+func FutureIsDone(args ...interface{}) interface{} {
+	future, err := futureOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	select {
+	case <-future.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Future.cancel(boolean), 只能取消尚未开始执行的任务
+func FutureCancel(args ...interface{}) interface{} {
+	future, err := futureOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	return future.cancel()
+}
+
+func FutureIsCancelled(args ...interface{}) interface{} {
+	future, err := futureOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	future.lock.Lock()
+	defer future.lock.Unlock()
+	return futureCancelled == future.state
+}
@@ -0,0 +1,151 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newExecutorTestJvm(defs ...*class.DefFile) (*MiniJvm, error) {
+	defs = append(defs,
+		newTestClass("java/lang/Object", "", nil),
+		newTestClass("java/util/concurrent/ExecutorService", "java/lang/Object", nil),
+		newTestClass("java/util/concurrent/Future", "java/lang/Object", nil))
+	ma, err := newTestMethodArea(defs...)
+	if nil != err {
+		return nil, err
+	}
+	ma.IgnoredClasses = make(map[string]interface{})
+
+	jvm := &MiniJvm{
+		MethodArea:        ma,
+		NativeMethodTable: newBuiltinNativeMethodTable(),
+		IntrinsicTable:    NewNativeMethodTable(),
+		stats:             new(vmStats),
+	}
+	ma.Jvm = jvm
+	jvm.ExecutionEngine = NewInterpretedExecutionEngine(jvm)
+
+	return jvm, nil
+}
+
+func TestExecutorSubmit(t *testing.T) {
+	// call()返回自身, run()把静态字段count加1
+	task := newClassBuilder("com/fh/Task", "java/lang/Object")
+	task.def.ParsedStaticFields = map[string]*class.ObjectField{"count": {FieldValue: 0, FieldType: "int"}}
+	task.method(accflag.Public, "call", "()Ljava/lang/Object;", 1, 1, newCodeAssembler().emit(bcode.Aload0, bcode.Areturn))
+	count := task.fieldRef("com/fh/Task", "count", "I")
+	task.method(accflag.Public, "run", "()V", 2, 1, newCodeAssembler().
+		emitIndex(bcode.Getstatic, count).
+		emit(bcode.Iconst1, bcode.Iadd).
+		emitIndex(bcode.Putstatic, count).
+		emit(bcode.Return))
+
+	jvm, err := newExecutorTestJvm(task.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pool := ExecutorsNewFixedThreadPool(jvm, nil, 4).(*class.Reference)
+	taskRefs := make([]*class.Reference, 0, 20)
+	futures := make([]*class.Reference, 0, 20)
+	for ix := 0; ix < 20; ix++ {
+		taskRef, err := class.NewObject(task.def, jvm.MethodArea)
+		if nil != err {
+			t.Fatal(err)
+		}
+		future, ok := ExecutorServiceSubmitCallable(jvm, pool, taskRef).(*class.Reference)
+		if !ok {
+			t.Fatal("submit failed")
+		}
+		taskRefs = append(taskRefs, taskRef)
+		futures = append(futures, future)
+	}
+	for ix, future := range futures {
+		if result := FutureGet(jvm, future); taskRefs[ix] != result {
+			t.Fatalf("unexpected result of task %d: %v", ix, result)
+		}
+		if true != FutureIsDone(jvm, future) {
+			t.Fatalf("task %d should be done", ix)
+		}
+	}
+
+	// 单线程的线程池中按提交顺序执行, 不会丢失更新
+	single := ExecutorsNewSingleThreadExecutor(jvm, nil).(*class.Reference)
+	for ix := 0; ix < 10; ix++ {
+		if err, ok := ExecutorServiceExecute(jvm, single, taskRefs[0]).(error); ok {
+			t.Fatal(err)
+		}
+	}
+	ExecutorServiceShutdown(jvm, single)
+	executor, _ := executorOf(single)
+	<-executor.terminated
+	if val, _ := task.def.GetStaticFieldValue("count"); 10 != val {
+		t.Fatalf("expect count 10, got %v", val)
+	}
+	if true != ExecutorServiceIsTerminated(jvm, single) {
+		t.Fatal("executor should be terminated")
+	}
+
+	err, _ = ExecutorServiceExecute(jvm, single, taskRefs[0]).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.util.concurrent.RejectedExecutionException") {
+		t.Fatalf("expect RejectedExecutionException, got %v", err)
+	}
+}
+
+func TestCachedExecutorTerminatesAfterShutdown(t *testing.T) {
+	jvm, err := newExecutorTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pool := ExecutorsNewCachedThreadPool(jvm, nil).(*class.Reference)
+	if false != ExecutorServiceIsTerminated(jvm, pool) {
+		t.Fatal("executor terminated before shutdown")
+	}
+	ExecutorServiceShutdown(jvm, pool)
+	if true != ExecutorServiceIsShutdown(jvm, pool) {
+		t.Fatal("executor should be shut down")
+	}
+	executor, _ := executorOf(pool)
+	<-executor.terminated
+}
+
+// 队列满时submit等待, 但不持有锁, shutdown不会被阻塞; 等待中的任务在shutdown之后仍然放入队列
+func TestShutdownWhileSubmitWaits(t *testing.T) {
+	// 没有工作线程消费, 队列没有容量
+	executor := &guestExecutor{tasks: make(chan *guestFuture), workers: 1, terminated: make(chan struct{})}
+	executor.running.Add(1)
+
+	future := &guestFuture{done: make(chan struct{})}
+	submitted := make(chan error)
+	go func() {
+		submitted <- executor.submit(future)
+	}()
+	// 等待submit通过检查, 阻塞在放入队列
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown := make(chan struct{})
+	go func() {
+		executor.doShutdown()
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown blocked by a waiting submit")
+	}
+
+	if future != <-executor.tasks {
+		t.Fatal("waiting task should still be queued")
+	}
+	if err := <-submitted; nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := <-executor.tasks; ok {
+		t.Fatal("tasks should be closed after shutdown")
+	}
+}
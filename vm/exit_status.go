@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"regexp"
+)
+
+// 进程退出码
+const (
+	ExitSuccess = 0
+	// 未捕获的异常, 以及不属于下面几类的其他运行错误
+	ExitUncaughtException = 1
+	ExitClassNotFound     = 2
+	ExitVerifyError       = 3
+	// 超过栈深度等限制, 被安全策略拒绝, 或者被宿主取消
+	ExitResourceLimit = 4
+)
+
+// 本地方法以"java.lang.XxxException: 描述"的形式返回的java异常
+var javaThrowablePattern = regexp.MustCompile(`^((?:[a-z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error))(?::\s*(.*))?$`)
+
+// 错误报告, 用于--error-json输出
+type ErrorReport struct {
+	ExitCode int `json:"exitCode"`
+	// exception, classNotFound, verifyError, resourceLimit, permissionDenied, cancelled, exit, watchpoint, breakpoint, dexFormat, internal
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+
+	// 异常类全名和异常描述, 只有java异常才有
+	Exception        string `json:"exception,omitempty"`
+	ExceptionMessage string `json:"exceptionMessage,omitempty"`
+
+	// 找不到的类
+	ClassName string `json:"className,omitempty"`
+
+	// verify发现的问题
+	Problems []string `json:"problems,omitempty"`
+}
+
+// 根据错误类型生成报告; err为nil时返回nil
+func NewErrorReport(err error) *ErrorReport {
+	if nil == err {
+		return nil
+	}
+
+	report := &ErrorReport{Message: err.Error()}
+
+	var thrown *ExceptionThrownError
+	var notFound *ClassNotFoundError
+	var denied *PermissionDeniedError
+	var link *LinkError
+	var limit *ThreadLimitExceededError
+	var exit *SystemExitError
+	var cancelled *ExecutionCancelledError
+	var watch *WatchpointError
+	var exceptionBreak *ExceptionBreakpointError
+	var dex *DexFormatError
+	var enginePanic *EnginePanicError
+	switch {
+	case errors.As(err, &exit):
+		report.ExitCode, report.Kind = exit.Status, "exit"
+
+	case errors.As(err, &link):
+		report.ExitCode, report.Kind = ExitVerifyError, "linkError"
+		for _, problem := range link.Report.Problems {
+			report.Problems = append(report.Problems, problem.String())
+			// 缺少类时与类加载失败的退出码一致
+			if VerifyProblemUnresolvedClass == problem.Kind {
+				report.ExitCode = ExitClassNotFound
+			}
+		}
+
+	case errors.As(err, &dex):
+		report.ExitCode, report.Kind = ExitVerifyError, "dexFormat"
+
+	case errors.As(err, &notFound):
+		report.ExitCode, report.Kind = ExitClassNotFound, "classNotFound"
+		report.ClassName = notFound.ClassName
+
+	case errors.As(err, &denied):
+		report.ExitCode, report.Kind = ExitResourceLimit, "permissionDenied"
+
+	case errors.As(err, &limit):
+		report.ExitCode, report.Kind = ExitResourceLimit, "resourceLimit"
+
+	case errors.As(err, &cancelled):
+		report.ExitCode, report.Kind = ExitResourceLimit, "cancelled"
+
+	case errors.As(err, &watch):
+		report.ExitCode, report.Kind = ExitUncaughtException, "watchpoint"
+
+	case errors.As(err, &exceptionBreak):
+		report.ExitCode, report.Kind = ExitUncaughtException, "breakpoint"
+
+	case errors.As(err, &enginePanic):
+		report.ExitCode, report.Kind = ExitUncaughtException, "internal"
+
+	case errors.As(err, &thrown):
+		report.ExitCode, report.Kind = ExitUncaughtException, "exception"
+		report.Exception = thrown.ExceptionRef.Object.DefFile.FullClassName
+		report.ExceptionMessage = exceptionDetailMessage(thrown.ExceptionRef)
+
+	default:
+		report.ExitCode, report.Kind = ExitUncaughtException, "internal"
+
+		// java异常可能在错误链的任意一层: 本地方法返回的在最内层, 链接时的"java.lang.VerifyError: ..."还包装着具体原因;
+		// 从外向内取第一个匹配的
+		var matches []string
+		for inner := err; nil != inner && nil == matches; inner = errors.Unwrap(inner) {
+			matches = javaThrowablePattern.FindStringSubmatch(inner.Error())
+		}
+		if nil == matches {
+			break
+		}
+
+		report.Kind = "exception"
+		report.Exception, report.ExceptionMessage = matches[1], matches[2]
+		switch report.Exception {
+		case "java.lang.NoClassDefFoundError", "java.lang.ClassNotFoundException":
+			report.ExitCode, report.Kind = ExitClassNotFound, "classNotFound"
+		case "java.lang.VerifyError", "java.lang.ClassFormatError":
+			report.ExitCode, report.Kind = ExitVerifyError, "verifyError"
+		case "java.lang.StackOverflowError", "java.lang.OutOfMemoryError":
+			report.ExitCode, report.Kind = ExitResourceLimit, "resourceLimit"
+		case "java.lang.SecurityException":
+			report.ExitCode, report.Kind = ExitResourceLimit, "permissionDenied"
+		}
+	}
+
+	return report
+}
+
+// 错误对应的退出码
+func ExitCodeOf(err error) int {
+	if nil == err {
+		return ExitSuccess
+	}
+
+	return NewErrorReport(err).ExitCode
+}
+
+func (r *ErrorReport) JSON() []byte {
+	buf, _ := json.Marshal(r)
+	return buf
+}
+
+// 读取Throwable的detailMessage字段
+func exceptionDetailMessage(ref *class.Reference) string {
+	msg, ok := ref.Object.GetFieldValue("detailMessage")
+	if !ok {
+		return ""
+	}
+	msgRef, ok := msg.(*class.Reference)
+	if !ok || nil == msgRef {
+		return ""
+	}
+
+	runes, err := class.StringRunes(msgRef)
+	if nil != err {
+		return ""
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	cases := []struct {
+		err       error
+		code      int
+		kind      string
+		exception string
+	}{
+		{nil, ExitSuccess, "", ""},
+		{NewExceptionThrownError(newTestException("java/lang/IllegalStateException")), ExitUncaughtException, "exception", "java/lang/IllegalStateException"},
+		{fmt.Errorf("native method 'A.b()V' failed: %w", errors.New("java.lang.ArithmeticException: / by zero")), ExitUncaughtException, "exception", "java.lang.ArithmeticException"},
+		{fmt.Errorf("failed to load class: %w", &ClassNotFoundError{ClassName: "com/fh/Foo"}), ExitClassNotFound, "classNotFound", ""},
+		{fmt.Errorf("link failed: %w", errors.New("java.lang.VerifyError: com/fh/Foo.bar()V: bad")), ExitVerifyError, "verifyError", "java.lang.VerifyError"},
+		{errors.New("java.lang.StackOverflowError: stack depth exceeds 10"), ExitResourceLimit, "resourceLimit", "java.lang.StackOverflowError"},
+		{errors.New("java.lang.SecurityException: class 'java.io.File' is denied by class policy"), ExitResourceLimit, "permissionDenied", "java.lang.SecurityException"},
+		{&PermissionDeniedError{Request: &PolicyRequest{}}, ExitResourceLimit, "permissionDenied", ""},
+		{&ThreadLimitExceededError{ThreadID: 2, Resource: "instructions", Limit: 10}, ExitResourceLimit, "resourceLimit", ""},
+		{errors.New("unsupported byte code 0xba"), ExitUncaughtException, "internal", ""},
+	}
+
+	for _, c := range cases {
+		if code := ExitCodeOf(c.err); c.code != code {
+			t.Fatalf("%v: expect exit code %d, got %d", c.err, c.code, code)
+		}
+		if nil == c.err {
+			continue
+		}
+
+		report := NewErrorReport(c.err)
+		if c.kind != report.Kind || c.exception != report.Exception {
+			t.Fatalf("%v: unexpected report %+v", c.err, report)
+		}
+	}
+}
+
+func TestExitCodeOfLinkError(t *testing.T) {
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// iinc使用的本地变量超出max locals, 链接时的VerifyError包装着具体原因
+	b := newClassBuilder("com/fh/Broken", "java/lang/Object")
+	b.method(accflag.Static, "bad", "()V", 0, 1, newCodeAssembler().emit(bcode.Iinc, 3, 1, bcode.Return))
+	defineErr := jvm.MethodArea.DefineClass(b.def)
+	if nil == defineErr || nil == errors.Unwrap(defineErr) {
+		t.Fatalf("expect wrapped VerifyError, got %v", defineErr)
+	}
+
+	report := NewErrorReport(fmt.Errorf("failed to load class: %w", defineErr))
+	if ExitVerifyError != report.ExitCode || "verifyError" != report.Kind || "java.lang.VerifyError" != report.Exception {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestErrorReportJSON(t *testing.T) {
+	jvm := newTestStringJvm(t)
+	exception := newTestException("java/lang/IllegalArgumentException")
+	exception.Object.ObjectFields = map[string]*class.ObjectField{
+		"detailMessage": class.NewObjectField(newTestString(t, jvm, "bad arg")),
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(NewErrorReport(NewExceptionThrownError(exception)).JSON(), &decoded); nil != err {
+		t.Fatal(err)
+	}
+	if "bad arg" != decoded["exceptionMessage"] || float64(ExitUncaughtException) != decoded["exitCode"] {
+		t.Fatalf("unexpected report %v", decoded)
+	}
+}
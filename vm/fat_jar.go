@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Spring Boot fat jar中应用class和依赖jar所在的目录
+const (
+	fatJarClassesDir = "BOOT-INF/classes/"
+	fatJarLibDir     = "BOOT-INF/lib/"
+)
+
+// 把Spring Boot形式的fat jar展开成普通的classpath, 普通jar原样返回;
+// BOOT-INF/classes解压成目录, BOOT-INF/lib/*.jar解压成独立的jar, 外层jar本身也保留(Spring Boot loader的类在根目录);
+// 展开结果缓存在本地, jar包没有变化时不会重复解压
+func (o *ClassPathOptions) expandFatJar(jarPath string) ([]string, error) {
+	zr, err := zip.OpenReader(jarPath)
+	if nil != err {
+		// 打不开的jar交给后面的类加载流程处理
+		return []string{jarPath}, nil
+	}
+	defer zr.Close()
+
+	isFatJar := false
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, fatJarClassesDir) || strings.HasPrefix(f.Name, fatJarLibDir) {
+			isFatJar = true
+			break
+		}
+	}
+	if !isFatJar {
+		return []string{jarPath}, nil
+	}
+
+	targetDir, err := o.fatJarCacheDir(jarPath)
+	if nil != err {
+		return nil, err
+	}
+
+	// 没有缓存时先解压到临时目录, 完成后再重命名, 防止留下解压了一半的缓存
+	if _, err := os.Stat(targetDir); nil != err {
+		utils.LogInfoPrintf("expand fat jar %s to %s", jarPath, targetDir)
+
+		tmpDir, err := ioutil.TempDir(filepath.Dir(targetDir), filepath.Base(targetDir) + ".*.tmp")
+		if nil != err {
+			return nil, fmt.Errorf("failed to expand fat jar '%s': %w", jarPath, err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		err = extractFatJar(&zr.Reader, tmpDir)
+		if nil != err {
+			return nil, fmt.Errorf("failed to expand fat jar '%s': %w", jarPath, err)
+		}
+
+		err = os.Rename(tmpDir, targetDir)
+		if nil != err {
+			return nil, fmt.Errorf("failed to expand fat jar '%s': %w", jarPath, err)
+		}
+	}
+
+	// 顺序与Spring Boot的LaunchedURLClassLoader一致: 应用class, 外层jar, 依赖jar(按jar包中的顺序)
+	result := []string{filepath.Join(targetDir, "classes"), jarPath}
+	for _, f := range zr.File {
+		if isFatJarLib(f.Name) {
+			result = append(result, filepath.Join(targetDir, "lib", path.Base(f.Name)))
+		}
+	}
+
+	return result, nil
+}
+
+// 展开后的缓存目录, 由jar的绝对路径, 大小和修改时间决定, jar包变化后会重新展开
+func (o *ClassPathOptions) fatJarCacheDir(jarPath string) (string, error) {
+	absPath, err := filepath.Abs(jarPath)
+	if nil != err {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if nil != err {
+		return "", err
+	}
+
+	cacheDir, err := o.cacheDir()
+	if nil != err {
+		return "", err
+	}
+
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", absPath, info.Size(), info.ModTime().UnixNano())))
+	return filepath.Join(cacheDir, hex.EncodeToString(key[:8]) + "-" + strings.TrimSuffix(filepath.Base(absPath), ".jar")), nil
+}
+
+func isFatJarLib(name string) bool {
+	return strings.HasPrefix(name, fatJarLibDir) && strings.HasSuffix(name, ".jar") &&
+		!strings.Contains(strings.TrimPrefix(name, fatJarLibDir), "/")
+}
+
+func extractFatJar(zr *zip.Reader, targetDir string) error {
+	err := os.MkdirAll(filepath.Join(targetDir, "classes"), 0755)
+	if nil != err {
+		return err
+	}
+	err = os.MkdirAll(filepath.Join(targetDir, "lib"), 0755)
+	if nil != err {
+		return err
+	}
+
+	for _, f := range zr.File {
+		var dest string
+		switch {
+		case isFatJarLib(f.Name):
+			dest = filepath.Join(targetDir, "lib", path.Base(f.Name))
+
+		case strings.HasPrefix(f.Name, fatJarClassesDir) && !strings.HasSuffix(f.Name, "/"):
+			rel := strings.TrimPrefix(f.Name, fatJarClassesDir)
+			// 防止../跳出目标目录
+			if strings.Contains(rel, "..") {
+				return fmt.Errorf("illegal entry name '%s'", f.Name)
+			}
+			dest = filepath.Join(targetDir, "classes", filepath.FromSlash(rel))
+
+		default:
+			continue
+		}
+
+		err := extractZipEntry(f, dest)
+		if nil != err {
+			return fmt.Errorf("failed to extract '%s': %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func extractZipEntry(f *zip.File, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if nil != err {
+		return err
+	}
+
+	reader, err := f.Open()
+	if nil != err {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.Create(dest)
+	if nil != err {
+		return err
+	}
+
+	_, err = io.Copy(out, reader)
+	closeErr := out.Close()
+	if nil != err {
+		return err
+	}
+
+	return closeErr
+}
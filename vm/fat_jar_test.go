@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFatJar(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "mini-jvm-cp")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	jvm := &MiniJvm{ClassPathOptions: &ClassPathOptions{CacheDir: cacheDir}, stats: new(vmStats)}
+
+	libJar := buildTestJar(t, map[string][]byte{"com/fh/Student.class": readTestClass(t, "com/fh/Student")})
+	fatJar := buildTestJar(t, map[string][]byte{
+		"BOOT-INF/classes/com/fh/Person.class": readTestClass(t, "com/fh/Person"),
+		"BOOT-INF/lib/student.jar":             libJar,
+	})
+
+	jarPath := filepath.Join(cacheDir, "app.jar")
+	err = ioutil.WriteFile(jarPath, fatJar, 0644)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	ma, err := NewMethodArea(jvm, []string{jarPath}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"com/fh/Person", "com/fh/Student"} {
+		def, err := ma.ParseClass(name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if name != def.ExtractFullClassName() {
+			t.Fatalf("unexpected class %s", def.ExtractFullClassName())
+		}
+	}
+
+	names, err := ma.ListClassNames()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(names) {
+		t.Fatalf("expected 2 classes, got %v", names)
+	}
+}
@@ -0,0 +1,258 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 宿主操作系统在文件路径和文本上的差异
+type HostOS struct {
+	Name string
+
+	// 路径分隔符
+	Separator byte
+	// 文件名是否不区分大小写, windows和macOS默认的文件系统都不区分
+	CaseInsensitive bool
+	// 写入文本时使用的换行
+	LineSeparator string
+}
+
+var (
+	WindowsHost = &HostOS{Name: "windows", Separator: '\\', CaseInsensitive: true, LineSeparator: "\r\n"}
+	DarwinHost  = &HostOS{Name: "darwin", Separator: '/', CaseInsensitive: true, LineSeparator: "\n"}
+	LinuxHost   = &HostOS{Name: "linux", Separator: '/', LineSeparator: "\n"}
+)
+
+// 当前进程所在的操作系统, 其他类unix系统与linux相同
+func CurrentHostOS() *HostOS {
+	switch runtime.GOOS {
+	case "windows":
+		return WindowsHost
+	case "darwin", "ios":
+		return DarwinHost
+	case "linux":
+		return LinuxHost
+	}
+
+	return &HostOS{Name: runtime.GOOS, Separator: '/', LineSeparator: "\n"}
+}
+
+// 统一用/分隔并清理.和.., 与java一样只有windows把\也当作分隔符(其他系统中\是文件名中的普通字符)
+func (h *HostOS) cleanPath(guestPath string) string {
+	p := guestPath
+	if '\\' == h.Separator {
+		p = strings.ReplaceAll(p, "\\", "/")
+	}
+	if "" == p {
+		return "."
+	}
+
+	// windows的UNC路径(//server/share)开头的两个分隔符不能合并
+	if '\\' == h.Separator && strings.HasPrefix(p, "//") {
+		return "/" + path.Clean(p[1:])
+	}
+
+	return path.Clean(p)
+}
+
+// 把guest的路径转换成宿主的形式, 如windows中a/b/../c转换成a\c
+func (h *HostOS) HostPath(guestPath string) string {
+	p := h.cleanPath(guestPath)
+	if '/' != h.Separator {
+		p = strings.ReplaceAll(p, "/", string(h.Separator))
+	}
+
+	return p
+}
+
+// 把宿主的路径转换成guest使用的/分隔的形式
+func (h *HostOS) GuestPath(hostPath string) string {
+	return h.cleanPath(hostPath)
+}
+
+// 是否为绝对路径; windows中需要盘符(C:/)或者是UNC路径, 只以/开头的是当前盘的相对路径
+func (h *HostOS) IsAbs(guestPath string) bool {
+	p := h.cleanPath(guestPath)
+	if '\\' != h.Separator {
+		return strings.HasPrefix(p, "/")
+	}
+
+	if strings.HasPrefix(p, "//") {
+		return true
+	}
+	return len(p) >= 3 && ':' == p[1] && '/' == p[2] &&
+		(('a' <= p[0] && p[0] <= 'z') || ('A' <= p[0] && p[0] <= 'Z'))
+}
+
+// 两个路径在宿主中是否指向同一个文件(只比较路径, 不解析符号链接)
+func (h *HostOS) SamePath(a string, b string) bool {
+	return h.pathKey(a) == h.pathKey(b)
+}
+
+func (h *HostOS) pathKey(guestPath string) string {
+	p := h.cleanPath(guestPath)
+	if h.CaseInsensitive {
+		return strings.ToLower(p)
+	}
+
+	return p
+}
+
+// 读取到的文本: 去掉UTF-8的BOM, \r\n换成\n; 不管文件来自哪个系统, guest看到的换行总是\n
+func (h *HostOS) DecodeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	return strings.ReplaceAll(string(data), "\r\n", "\n")
+}
+
+// 要写入的文本: 换行统一成宿主的换行, 已经是\r\n的不会变成\r\r\n
+func (h *HostOS) EncodeText(text string) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if "\n" != h.LineSeparator {
+		text = strings.ReplaceAll(text, "\n", h.LineSeparator)
+	}
+
+	return []byte(text)
+}
+
+// guest文件本地方法(mini-lib中的Files)使用的文件系统, 由它处理宿主系统的差异:
+// guest的路径总是可以用/分隔, 读到的文本换行总是\n, 写入时换成宿主的换行, 列出的文件名按字典序排序
+type FileSystem struct {
+	OS *HostOS
+	// 相对路径的基准目录, 为空时为宿主进程的当前目录
+	WorkDir string
+
+	// TryLock持有的锁, key为pathKey, 不区分大小写的系统中只是大小写不同的路径是同一把锁
+	locks     map[string]*os.File
+	locksLock sync.Mutex
+}
+
+func NewFileSystem(workDir string) *FileSystem {
+	return &FileSystem{OS: CurrentHostOS(), WorkDir: workDir}
+}
+
+// 没有设置MiniJvm.FileSystem时使用
+var defaultFileSystem = NewFileSystem("")
+
+// guest路径对应的宿主路径, 相对路径基于WorkDir
+func (fs *FileSystem) resolve(guestPath string) string {
+	if "" == fs.WorkDir || fs.OS.IsAbs(guestPath) {
+		return fs.OS.HostPath(guestPath)
+	}
+
+	return fs.OS.HostPath(fs.OS.GuestPath(fs.WorkDir) + "/" + fs.OS.cleanPath(guestPath))
+}
+
+func (fs *FileSystem) ReadText(guestPath string) (string, error) {
+	data, err := ioutil.ReadFile(fs.resolve(guestPath))
+	if nil != err {
+		return "", err
+	}
+
+	return fs.OS.DecodeText(data), nil
+}
+
+// 写入文本, appendMode为true时追加到文件末尾, 文件不存在时创建
+func (fs *FileSystem) WriteText(guestPath string, text string, appendMode bool) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(fs.resolve(guestPath), flag, 0644)
+	if nil != err {
+		return err
+	}
+
+	_, err = f.Write(fs.OS.EncodeText(text))
+	if closeErr := f.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
+
+func (fs *FileSystem) Exists(guestPath string) bool {
+	_, err := os.Stat(fs.resolve(guestPath))
+	return nil == err
+}
+
+// 删除文件或空目录, 文件不存在时返回false
+func (fs *FileSystem) Delete(guestPath string) (bool, error) {
+	err := os.Remove(fs.resolve(guestPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return nil == err, err
+}
+
+// 目录中的文件名, 按字典序排序, 不同系统返回的顺序一致
+func (fs *FileSystem) List(guestDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(fs.resolve(guestDir))
+	if nil != err {
+		return nil, err
+	}
+
+	names := make([]string, len(infos))
+	for ix, info := range infos {
+		names[ix] = info.Name()
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// 尝试锁住文件(不存在时创建), 已经被本虚拟机或者其他进程锁住时返回false;
+// 支持flock的系统中同时加系统的建议锁, 其他系统只在本虚拟机内互斥
+func (fs *FileSystem) TryLock(guestPath string) (bool, error) {
+	key := fs.OS.pathKey(fs.resolve(guestPath))
+
+	fs.locksLock.Lock()
+	defer fs.locksLock.Unlock()
+
+	if _, ok := fs.locks[key]; ok {
+		return false, nil
+	}
+
+	f, err := os.OpenFile(fs.resolve(guestPath), os.O_RDWR | os.O_CREATE, 0644)
+	if nil != err {
+		return false, err
+	}
+	locked, err := utils.TryLockFile(f)
+	if nil != err || !locked {
+		f.Close()
+		return false, err
+	}
+
+	if nil == fs.locks {
+		fs.locks = make(map[string]*os.File)
+	}
+	fs.locks[key] = f
+
+	return true, nil
+}
+
+func (fs *FileSystem) Unlock(guestPath string) error {
+	key := fs.OS.pathKey(fs.resolve(guestPath))
+
+	fs.locksLock.Lock()
+	defer fs.locksLock.Unlock()
+
+	f, ok := fs.locks[key]
+	if !ok {
+		return fmt.Errorf("'%s' is not locked", guestPath)
+	}
+	delete(fs.locks, key)
+
+	err := utils.UnlockFile(f)
+	if closeErr := f.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostOSPaths(t *testing.T) {
+	cases := []struct {
+		os    *HostOS
+		guest string
+		host  string
+		abs   bool
+	}{
+		{LinuxHost, "a/b/../c", "a/c", false},
+		{LinuxHost, "/tmp//x/", "/tmp/x", true},
+		// 其他系统中\是文件名中的普通字符
+		{LinuxHost, "a\\b", "a\\b", false},
+		{LinuxHost, "", ".", false},
+		{DarwinHost, "/Users/./fh/a.txt", "/Users/fh/a.txt", true},
+		{WindowsHost, "a/b/../c", "a\\c", false},
+		{WindowsHost, "C:\\Users\\fh/a.txt", "C:\\Users\\fh\\a.txt", true},
+		{WindowsHost, "c:/x/../y", "c:\\y", true},
+		{WindowsHost, "\\\\server\\share\\a", "\\\\server\\share\\a", true},
+		// 没有盘符的是当前盘的相对路径
+		{WindowsHost, "/temp", "\\temp", false},
+	}
+	for _, c := range cases {
+		if host := c.os.HostPath(c.guest); c.host != host {
+			t.Errorf("%s %q: expect host path %q, got %q", c.os.Name, c.guest, c.host, host)
+		}
+		if abs := c.os.IsAbs(c.guest); c.abs != abs {
+			t.Errorf("%s %q: expect abs %v", c.os.Name, c.guest, c.abs)
+		}
+		// 转换回guest路径后总是用/分隔
+		if guest := c.os.GuestPath(c.os.HostPath(c.guest)); '\\' == c.os.Separator && strings.Contains(guest, "\\") {
+			t.Errorf("%s %q: unexpected guest path %q", c.os.Name, c.guest, guest)
+		}
+	}
+
+	for _, c := range []struct {
+		os     *HostOS
+		a, b   string
+		expect bool
+	}{
+		{LinuxHost, "dir/A.txt", "dir/a.txt", false},
+		{DarwinHost, "dir/A.txt", "dir/./a.txt", true},
+		{WindowsHost, "DIR\\A.txt", "dir/a.TXT", true},
+	} {
+		if c.expect != c.os.SamePath(c.a, c.b) {
+			t.Errorf("%s: SamePath(%q, %q) should be %v", c.os.Name, c.a, c.b, c.expect)
+		}
+	}
+}
+
+func TestHostOSText(t *testing.T) {
+	for _, h := range []*HostOS{LinuxHost, DarwinHost, WindowsHost} {
+		// 不管来自哪个系统的文件, 读到的换行都是\n
+		if text := h.DecodeText([]byte("\uFEFFa\r\nb\nc\r\n")); "a\nb\nc\n" != text {
+			t.Errorf("%s: unexpected decoded text %q", h.Name, text)
+		}
+
+		expect := "a\nb\n"
+		if WindowsHost == h {
+			expect = "a\r\nb\r\n"
+		}
+		if data := h.EncodeText("a\r\nb\n"); expect != string(data) {
+			t.Errorf("%s: expect %q, got %q", h.Name, expect, data)
+		}
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mini-jvm-fs")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 用当前系统的分隔符模拟windows的换行和大小写规则
+	fs := NewFileSystem(dir)
+	fs.OS = &HostOS{Name: "test", Separator: CurrentHostOS().Separator, CaseInsensitive: true, LineSeparator: "\r\n"}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := fs.WriteText("sub/../b.txt", "line1\n", false); nil != err {
+		t.Fatal(err)
+	}
+	if err := fs.WriteText("b.txt", "line2\n", true); nil != err {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "b.txt")); "line1\r\nline2\r\n" != string(data) {
+		t.Fatalf("unexpected file content %q", data)
+	}
+	if text, err := fs.ReadText(filepath.Join(dir, "b.txt")); nil != err || "line1\nline2\n" != text {
+		t.Fatalf("unexpected text %q, %v", text, err)
+	}
+
+	fs.WriteText("a.txt", "", false)
+	if names, err := fs.List("."); nil != err || !reflect.DeepEqual([]string{"a.txt", "b.txt", "sub"}, names) {
+		t.Fatalf("unexpected names %v, %v", names, err)
+	}
+
+	// 不区分大小写时只是大小写不同的路径是同一把锁
+	if locked, err := fs.TryLock("lock"); nil != err || !locked {
+		t.Fatalf("expect locked, got %v, %v", locked, err)
+	}
+	if locked, _ := fs.TryLock("LOCK"); locked {
+		t.Fatal("lock should be held")
+	}
+	if err := fs.Unlock("Lock"); nil != err {
+		t.Fatal(err)
+	}
+	if err := fs.Unlock("lock"); nil == err {
+		t.Fatal("expect error for unlocking twice")
+	}
+
+	if deleted, err := fs.Delete("a.txt"); nil != err || !deleted || fs.Exists("a.txt") {
+		t.Fatalf("expect a.txt deleted, got %v, %v", deleted, err)
+	}
+	if deleted, err := fs.Delete("a.txt"); nil != err || deleted {
+		t.Fatalf("missing file should not be deleted, got %v, %v", deleted, err)
+	}
+}
+
+func TestFilesNatives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mini-jvm-files")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jvm, err := newClassInitTestJvm(newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.FileSystem = NewFileSystem(dir)
+	str := func(s string) *class.Reference {
+		ref, _ := class.NewStringObject([]rune(s), jvm.MethodArea)
+		return ref
+	}
+
+	if ret := FilesWriteString(jvm, nil, str("hello.txt"), str("hi\n")); nil != ret {
+		t.Fatal(ret)
+	}
+	text, ok := FilesReadString(jvm, nil, str("hello.txt")).(*class.Reference)
+	if runes, _ := class.StringRunes(text); !ok || "hi\n" != string(runes) {
+		t.Fatalf("unexpected text %v", text)
+	}
+	if true != FilesExists(jvm, nil, str("hello.txt")) {
+		t.Fatal("hello.txt should exist")
+	}
+	names := FilesList(jvm, nil, str(".")).(*class.Reference).Array
+	if runes, _ := class.StringRunes(names.Load(0).(*class.Reference)); 1 != names.Len() || "hello.txt" != string(runes) {
+		t.Fatal("unexpected file list")
+	}
+
+	err, _ = FilesReadString(jvm, nil, str("missing.txt")).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.io.FileNotFoundException: missing.txt") {
+		t.Fatalf("expect FileNotFoundException, got %v", err)
+	}
+	if err, _ := FilesReadString(jvm, nil, nil).(error); nil == err || !strings.Contains(err.Error(), "NullPointerException") {
+		t.Fatalf("expect NullPointerException, got %v", err)
+	}
+	if err, _ := FilesUnlock(jvm, nil, str("hello.txt")).(error); nil == err || !strings.Contains(err.Error(), "IllegalStateException") {
+		t.Fatalf("expect IllegalStateException, got %v", err)
+	}
+}
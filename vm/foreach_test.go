@@ -0,0 +1,206 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+// 在def的常量池中添加常量, 返回下标
+func addTestConst(def *class.DefFile, item interface{}) uint16 {
+	return def.ConstPool.Add(item)
+}
+
+func addTestClassRef(def *class.DefFile, className string) uint16 {
+	nameIndex := addTestConst(def, &class.Utf8InfoConst{Bytes: []byte(className)})
+	return addTestConst(def, &class.ClassInfoConstInfo{FullClassNameIndex: nameIndex})
+}
+
+func addTestNameAndType(def *class.DefFile, name string, descriptor string) uint16 {
+	nameIndex := addTestConst(def, &class.Utf8InfoConst{Bytes: []byte(name)})
+	descIndex := addTestConst(def, &class.Utf8InfoConst{Bytes: []byte(descriptor)})
+	return addTestConst(def, &class.NameAndTypeConst{NameIndex: nameIndex, DescIndex: descIndex})
+}
+
+// 给def添加带字节码的static方法
+func addTestCodeMethod(def *class.DefFile, name string, descriptor string, maxStack uint16, maxLocals uint16, code []byte) {
+	nameIndex := addTestConst(def, &class.Utf8InfoConst{Bytes: []byte(name)})
+	descIndex := addTestConst(def, &class.Utf8InfoConst{Bytes: []byte(descriptor)})
+	def.Methods = append(def.Methods, &class.MethodInfo{
+		AccessFlags:     accflag.Public | accflag.Static,
+		NameIndex:       nameIndex,
+		DescriptorIndex: descIndex,
+		Attrs:           []interface{}{&class.CodeAttr{MaxStack: maxStack, MaxLocals: maxLocals, Code: code}},
+		DefFile:         def,
+	})
+}
+
+// 构造for-each测试用的类:
+// com/fh/Range实现Iterable, 迭代器com/fh/RangeIterator依次返回装着0到end-1的com/fh/Box;
+// com/fh/Loops中的方法是javac对增强for循环的编译结果
+func newForEachFixture(t *testing.T) (*InterpretedExecutionEngine, *class.DefFile, *class.DefFile) {
+	abstract := uint16(accflag.Public | accflag.Abstarct)
+	native := uint16(accflag.Public | accflag.Native)
+
+	object := newTestClass("java/lang/Object", "", nil)
+	iterable := newTestClass("java/lang/Iterable", "java/lang/Object", nil,
+		testMethod{"iterator", "()Ljava/util/Iterator;", abstract})
+	iterable.AccessFlag = accflag.Interface
+	iterator := newTestClass("java/util/Iterator", "java/lang/Object", nil,
+		testMethod{"hasNext", "()Z", abstract},
+		testMethod{"next", "()Ljava/lang/Object;", abstract})
+	iterator.AccessFlag = accflag.Interface
+	box := newTestClass("com/fh/Box", "java/lang/Object", nil)
+	rangeDef := newTestClass("com/fh/Range", "java/lang/Object", []string{"java/lang/Iterable"},
+		testMethod{"iterator", "()Ljava/util/Iterator;", native})
+	rangeIterator := newTestClass("com/fh/RangeIterator", "java/lang/Object", []string{"java/util/Iterator"},
+		testMethod{"hasNext", "()Z", native},
+		testMethod{"next", "()Ljava/lang/Object;", native})
+	loops := newTestClass("com/fh/Loops", "java/lang/Object", nil)
+
+	// int sumArray(int[] arr) { int sum = 0; for (int n : arr) sum += n; return sum; }
+	addTestCodeMethod(loops, "sumArray", "([I)I", 2, 6, []byte{
+		bcode.Iconst0, bcode.Istore1,
+		bcode.Aload0, bcode.Astore2,
+		bcode.Aload2, bcode.Arraylength, bcode.Istore3,
+		bcode.Iconst0, bcode.Istore, 4,
+		bcode.Iload, 4, bcode.Iload3, bcode.Ificmpge, 0, 20,
+		bcode.Aload2, bcode.Iload, 4, bcode.Iaload, bcode.Istore, 5,
+		bcode.Iload1, bcode.Iload, 5, bcode.Iadd, bcode.Istore1,
+		bcode.Iinc, 4, 1,
+		bcode.Goto, 0xff, 0xec,
+		bcode.Iload1, bcode.Ireturn,
+	})
+
+	// int sumIterable(Iterable<Box> it) { int sum = 0; for (Box b : it) sum += b.value; return sum; }
+	iterableClass := addTestClassRef(loops, "java/lang/Iterable")
+	iteratorClass := addTestClassRef(loops, "java/util/Iterator")
+	boxClass := addTestClassRef(loops, "com/fh/Box")
+	iteratorRef := addTestConst(loops, &class.InterfaceMethodConst{InterfaceClassIndex: iterableClass,
+		NameAndTypeIndex: addTestNameAndType(loops, "iterator", "()Ljava/util/Iterator;")})
+	hasNextRef := addTestConst(loops, &class.InterfaceMethodConst{InterfaceClassIndex: iteratorClass,
+		NameAndTypeIndex: addTestNameAndType(loops, "hasNext", "()Z")})
+	nextRef := addTestConst(loops, &class.InterfaceMethodConst{InterfaceClassIndex: iteratorClass,
+		NameAndTypeIndex: addTestNameAndType(loops, "next", "()Ljava/lang/Object;")})
+	valueRef := addTestConst(loops, &class.FieldRefConstInfo{ClassIndex: boxClass,
+		NameAndTypeIndex: addTestNameAndType(loops, "value", "I")})
+	addTestCodeMethod(loops, "sumIterable", "(Ljava/lang/Iterable;)I", 2, 4, []byte{
+		bcode.Iconst0, bcode.Istore1,
+		bcode.Aload0, bcode.Invokeinterface, 0, byte(iteratorRef), 1, 0, bcode.Astore2,
+		bcode.Aload2, bcode.Invokeinterface, 0, byte(hasNextRef), 1, 0, bcode.Ifeq, 0, 23,
+		bcode.Aload2, bcode.Invokeinterface, 0, byte(nextRef), 1, 0,
+		bcode.Checkcast, 0, byte(boxClass), bcode.Astore3,
+		bcode.Iload1, bcode.Aload3, bcode.GetField, 0, byte(valueRef), bcode.Iadd, bcode.Istore1,
+		bcode.Goto, 0xff, 0xe6,
+		bcode.Iload1, bcode.Ireturn,
+	})
+
+	ma, err := newTestMethodArea(object, iterable, iterator, box, rangeDef, rangeIterator, loops)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	table := NewNativeMethodTable()
+	table.RegisterMethod("com/fh/Range", "iterator", "()Ljava/util/Iterator;", func(args ...interface{}) interface{} {
+		end, _ := args[1].(*class.Reference).Object.GetFieldValue("end")
+		itRef, _ := class.NewObject(rangeIterator, ma)
+		itRef.Object.ObjectFields["cur"] = class.NewObjectField(0)
+		itRef.Object.ObjectFields["end"] = class.NewObjectField(end)
+		return itRef
+	})
+	table.RegisterMethod("com/fh/RangeIterator", "hasNext", "()Z", func(args ...interface{}) interface{} {
+		obj := args[1].(*class.Reference).Object
+		cur, _ := obj.GetFieldValue("cur")
+		end, _ := obj.GetFieldValue("end")
+		if cur.(int) < end.(int) {
+			return 1
+		}
+		return 0
+	})
+	table.RegisterMethod("com/fh/RangeIterator", "next", "()Ljava/lang/Object;", func(args ...interface{}) interface{} {
+		obj := args[1].(*class.Reference).Object
+		cur, _ := obj.GetFieldValue("cur")
+		obj.SetFieldValue("cur", cur.(int) + 1)
+
+		boxRef, _ := class.NewObject(box, ma)
+		boxRef.Object.ObjectFields["value"] = class.NewObjectField(cur)
+		return boxRef
+	})
+
+	jvm := &MiniJvm{MethodArea: ma, NativeMethodTable: table, stats: new(vmStats)}
+	return NewInterpretedExecutionEngine(jvm), loops, rangeDef
+}
+
+func TestForEachOverArray(t *testing.T) {
+	engine, loops, _ := newForEachFixture(t)
+
+	arrRef, _ := class.NewArray(4, 10)
+	for ix, n := range []int{1, 2, 3, 4} {
+		arrRef.Array.Store(ix, n)
+	}
+
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.Push(arrRef)
+	if err := engine.ExecuteWithFrame(loops, "sumArray", "([I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if sum, _ := frame.opStack.PopInt(); 10 != sum {
+		t.Fatalf("unexpected sum %d", sum)
+	}
+
+	// null数组
+	frame.opStack.Push(nil)
+	if err := engine.ExecuteWithFrame(loops, "sumArray", "([I)I", frame, false); nil == err {
+		t.Fatal("for-each over null array should fail")
+	}
+}
+
+func TestForEachOverIterable(t *testing.T) {
+	engine, loops, rangeDef := newForEachFixture(t)
+
+	for _, end := range []int{0, 1, 5} {
+		rangeRef, _ := class.NewObject(rangeDef, engine.miniJvm.MethodArea)
+		rangeRef.Object.ObjectFields["end"] = class.NewObjectField(end)
+
+		frame := newMethodStackFrame(2, 0)
+		frame.opStack.Push(rangeRef)
+		if err := engine.ExecuteWithFrame(loops, "sumIterable", "(Ljava/lang/Iterable;)I", frame, false); nil != err {
+			t.Fatalf("range(%d): %v", end, err)
+		}
+		// 0 + 1 + ... + end-1
+		if sum, _ := frame.opStack.PopInt(); end * (end - 1) / 2 != sum {
+			t.Fatalf("range(%d): unexpected sum %d", end, sum)
+		}
+	}
+}
+
+func TestCheckcast(t *testing.T) {
+	engine, loops, rangeDef := newForEachFixture(t)
+	rangeRef, _ := class.NewObject(rangeDef, engine.miniJvm.MethodArea)
+
+	cases := []struct {
+		target string
+		ok     bool
+	}{
+		{"com/fh/Range", true},
+		{"java/lang/Iterable", true},
+		{"java/lang/Object", true},
+		{"com/fh/Box", false},
+	}
+	for _, c := range cases {
+		index := addTestClassRef(loops, c.target)
+		codeAttr := &class.CodeAttr{Code: []byte{bcode.Checkcast, byte(index >> 8), byte(index)}}
+
+		frame := newMethodStackFrame(1, 0)
+		frame.opStack.Push(rangeRef)
+		err := engine.bcodeCheckcast(loops, frame, codeAttr)
+		if c.ok != (nil == err) {
+			t.Fatalf("%s: unexpected result %v", c.target, err)
+		}
+		// 引用留在栈顶
+		if top, _ := frame.opStack.PopReference(); rangeRef != top {
+			t.Fatalf("%s: reference should stay on stack", c.target)
+		}
+	}
+}
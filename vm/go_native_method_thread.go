@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
 	"github.com/wanghongfei/mini-jvm/vm/class"
+	"runtime"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,16 +15,36 @@ const (
 	THREAD_STATUS_FINISHED = 0
 )
 
+// java.lang.Thread中的优先级范围
+const (
+	ThreadMinPriority  = 1
+	ThreadNormPriority = 5
+	ThreadMaxPriority  = 10
+)
+
+// 上一个分配的线程编号
+var lastThreadID int64
+
+// 分配线程编号, 主线程为1
+func nextThreadID() int64 {
+	return atomic.AddInt64(&lastThreadID, 1)
+}
+
 // java线程对应go里的表示
 type MiniThread struct {
 	Jvm *MiniJvm
 	JavaObjRef *class.Reference
+	// 启动线程的cn.minijvm.concurrency.MiniThread对象, 通过它join; 可以为nil
+	Handle *class.Reference
 
 	// 线程状态
 	// 0: created
 	// 1: running
 	// 2: finished
 	Status int
+
+	// 线程结束时关闭
+	done chan struct{}
 }
 
 func (t *MiniThread) Start() {
@@ -34,6 +56,12 @@ func (t *MiniThread) Start() {
 		localVariablesTable: nil,
 		opStack:             opStack,
 		pc:                  0,
+		threadID:            nextThreadID(),
+	}
+
+	t.done = make(chan struct{})
+	if nil != t.Handle {
+		t.Jvm.miniThreads.Store(t.Handle, t)
 	}
 
 	go func() {
@@ -49,6 +77,10 @@ func (t *MiniThread) Start() {
 
 		defer func() {
 			t.Status = THREAD_STATUS_FINISHED
+			if nil != t.Handle {
+				t.Jvm.miniThreads.Delete(t.Handle)
+			}
+			close(t.done)
 		}()
 
 		err := t.Jvm.ExecutionEngine.ExecuteWithFrame(t.JavaObjRef.Object.DefFile, "run", "()V", frame, false)
@@ -72,19 +104,115 @@ func ThreadSleep(args ...interface{}) interface{} {
 	return nil
 }
 
+// MiniThread.join(long)实现, 等待线程结束, millis为0时一直等待;
+// 超时后直接返回, 宿主取消执行时返回ExecutionCancelledError. 没有启动或已经结束的线程立即返回
+func MiniThreadJoin(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	threadRef := args[1].(*class.Reference)
+	millis := toInt64(args[2])
+
+	if millis < 0 {
+		return fmt.Errorf("java.lang.IllegalArgumentException: timeout value is negative")
+	}
+
+	val, ok := jvm.miniThreads.Load(threadRef)
+	if !ok {
+		return nil
+	}
+
+	var timeoutCh <-chan time.Time
+	if millis > 0 {
+		timer := time.NewTimer(time.Duration(millis) * time.Millisecond)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	ctx := jvm.hostContext()
+	select {
+	case <-val.(*MiniThread).done:
+	case <-timeoutCh:
+	case <-ctx.Done():
+		return cancelledError("join", ctx.Err())
+	}
+
+	return nil
+}
+
 // 在新的协程中执行字节码
 func ExecuteInThread(args ...interface{}) interface{} {
 	// 第一个参数为jvm指针
 	jvm := args[0].(*MiniJvm)
 	// 第三个参数是实现了Runnalbe接口的对象引用
 	objRef := args[2].(*class.Reference)
+	handle, _ := args[1].(*class.Reference)
 
 	miniThread := &MiniThread{
 		Jvm:        jvm,
 		JavaObjRef: objRef,
+		Handle:     handle,
 		Status: THREAD_STATUS_CREATED,
 	}
 	miniThread.Start()
 
 	return nil
 }
+
+// Thread.currentThread()实现;
+// 同一个线程多次调用返回同一个Thread对象
+func ThreadCurrentThread(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+
+	root := frame.rootFrame()
+	if nil != root.threadRef {
+		return root.threadRef
+	}
+
+	threadDef, err := jvm.MethodArea.loadClassInFrame(frame, "java/lang/Thread")
+	if nil != err {
+		return fmt.Errorf("failed to load java/lang/Thread def:%w", err)
+	}
+
+	threadRef, err := class.NewObject(threadDef, jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to create java/lang/Thread object:%w", err)
+	}
+	// 没有执行Thread的构造方法, 优先级与main线程一样为默认值
+	threadRef.Object.SetFieldValue("priority", ThreadNormPriority)
+	root.threadRef = threadRef
+
+	return threadRef
+}
+
+// Thread.yield()和MiniThread.yieldCurrentThread()实现, 让出当前goroutine的执行
+func ThreadYield(args ...interface{}) interface{} {
+	runtime.Gosched()
+
+	return nil
+}
+
+// Thread.setPriority(int)实现;
+// JDK的实现要通过ThreadGroup检查上限, 这里没有ThreadGroup, 只检查范围后写入priority字段;
+// goroutine没有优先级, 优先级只作为提示保存, 可以通过getPriority()读回, 不影响调度
+func ThreadSetPriority(args ...interface{}) interface{} {
+	threadRef := args[1].(*class.Reference)
+	priority := args[2].(int)
+
+	if priority < ThreadMinPriority || priority > ThreadMaxPriority {
+		return fmt.Errorf("java.lang.IllegalArgumentException: priority %d out of range [%d, %d]", priority, ThreadMinPriority, ThreadMaxPriority)
+	}
+	threadRef.Object.SetFieldValue("priority", priority)
+
+	return nil
+}
+
+// MiniThread.setCurrentThreadPriority(int)实现, 设置当前线程对应的Thread对象的优先级
+func MiniThreadSetCurrentThreadPriority(args ...interface{}) interface{} {
+	ret := ThreadCurrentThread(args[0], args[1], args[3])
+	threadRef, ok := ret.(*class.Reference)
+	if !ok {
+		return ret
+	}
+
+	return ThreadSetPriority(args[0], threadRef, args[2])
+}
@@ -0,0 +1,65 @@
+package vm
+
+import (
+	"context"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestThreadPriority(t *testing.T) {
+	thread := newClassBuilder("java/lang/Thread", "java/lang/Object")
+	thread.field("priority", "I")
+	ma, err := newTestMethodArea(newTestClass("java/lang/Object", "", nil), thread.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm := &MiniJvm{MethodArea: ma}
+	frame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+
+	threadRef := ThreadCurrentThread(jvm, nil, frame).(*class.Reference)
+	if priority, _ := threadRef.Object.GetFieldValue("priority"); ThreadNormPriority != priority {
+		t.Fatalf("unexpected default priority %v", priority)
+	}
+
+	if err := MiniThreadSetCurrentThreadPriority(jvm, nil, ThreadMaxPriority, frame); nil != err {
+		t.Fatal(err)
+	}
+	if priority, _ := threadRef.Object.GetFieldValue("priority"); ThreadMaxPriority != priority {
+		t.Fatalf("priority not updated: %v", priority)
+	}
+
+	err, _ = ThreadSetPriority(jvm, threadRef, ThreadMaxPriority + 1).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.lang.IllegalArgumentException") {
+		t.Fatalf("expect IllegalArgumentException, got %v", err)
+	}
+	if nil != ThreadYield(jvm, nil) {
+		t.Fatal("yield should return nothing")
+	}
+}
+
+func TestMiniThreadJoin(t *testing.T) {
+	jvm := &MiniJvm{}
+	handle := &class.Reference{}
+	thread := &MiniThread{Jvm: jvm, Handle: handle, done: make(chan struct{})}
+	jvm.miniThreads.Store(handle, thread)
+
+	// 线程没有结束, 超时后返回
+	if ret := MiniThreadJoin(jvm, handle, int64(10)); nil != ret {
+		t.Fatal(ret)
+	}
+
+	// 宿主取消时不再等待
+	ctx, cancel := context.WithCancel(context.Background())
+	jvm.Context = ctx
+	cancel()
+	if err, ok := MiniThreadJoin(jvm, handle, int64(0)).(*ExecutionCancelledError); !ok || "join" != err.Op {
+		t.Fatalf("expect cancelled join, got %v", err)
+	}
+
+	close(thread.done)
+	jvm.Context = nil
+	if ret := MiniThreadJoin(jvm, handle, int64(0)); nil != ret {
+		t.Fatal(ret)
+	}
+}
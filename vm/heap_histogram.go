@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 按类统计的存活对象数, 类似jmap -histo;
+// key: 类全名(以.分隔), 数组为[I, [Ljava.lang.String;这样的形式
+type HeapHistogram map[string]int64
+
+// 两次快照之间某个类的存活对象数变化
+type HeapHistogramDelta struct {
+	ClassName string
+	Before    int64
+	After     int64
+	Delta     int64
+}
+
+// 存活对象计数器;
+// 每个被统计的对象都带有一个heapTag, 对象被go回收后tag的finalizer把计数减一.
+// finalizer设置在tag上而不是对象上, 否则互相引用的对象永远不会被回收
+type heapTracker struct {
+	// key: 类名, val: *int64
+	counters sync.Map
+}
+
+type heapTag struct {
+	counter *int64
+}
+
+func (t *heapTracker) onAllocate(ref *class.Reference) {
+	var className string
+	if class.ReferanceTypeArray == ref.RefType {
+		className = arrayClassName(ref.Array)
+	} else {
+		className = strings.ReplaceAll(ref.Object.DefFile.FullClassName, "/", ".")
+	}
+
+	counter, ok := t.counters.Load(className)
+	if !ok {
+		counter, _ = t.counters.LoadOrStore(className, new(int64))
+	}
+	atomic.AddInt64(counter.(*int64), 1)
+
+	tag := &heapTag{counter: counter.(*int64)}
+	runtime.SetFinalizer(tag, func(tag *heapTag) {
+		atomic.AddInt64(tag.counter, -1)
+	})
+	ref.Tag = tag
+}
+
+// 先执行GC并等待finalizer运行, 再读取计数
+func (t *heapTracker) snapshot() HeapHistogram {
+	for round := 0; round < 2; round++ {
+		collectGarbage()
+	}
+
+	histo := make(HeapHistogram)
+	t.counters.Range(func(key, value interface{}) bool {
+		if count := atomic.LoadInt64(value.(*int64)); count > 0 {
+			histo[key.(string)] = count
+		}
+		return true
+	})
+
+	return histo
+}
+
+// 执行一次GC, 等待本轮回收的对象的finalizer执行完;
+// finalizer在同一个goroutine中按顺序执行, 哨兵对象的finalizer执行时其他对象的finalizer也已入队
+func collectGarbage() {
+	done := make(chan struct{})
+	runtime.SetFinalizer(&heapTag{}, func(*heapTag) {
+		close(done)
+	})
+
+	runtime.GC()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	// 让排在哨兵之后的finalizer也有机会执行
+	runtime.GC()
+	runtime.Gosched()
+}
+
+// 按类统计的存活对象数, 只有打开TrackHeap后解释器创建的对象(new, newarray, anewarray, multianewarray)才会统计;
+// 会触发go的GC, 不要在热路径中调用
+func (m *MiniJvm) HeapHistogram() HeapHistogram {
+	return m.heap.snapshot()
+}
+
+// 与之后的快照比较, 返回有变化的类, 按变化量的绝对值从大到小排序
+func (h HeapHistogram) Diff(after HeapHistogram) []*HeapHistogramDelta {
+	var deltas []*HeapHistogramDelta
+	for name, count := range after {
+		if count != h[name] {
+			deltas = append(deltas, &HeapHistogramDelta{ClassName: name, Before: h[name], After: count, Delta: count - h[name]})
+		}
+	}
+	for name, count := range h {
+		if _, ok := after[name]; !ok {
+			deltas = append(deltas, &HeapHistogramDelta{ClassName: name, Before: count, Delta: -count})
+		}
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		abs := func(n int64) int64 {
+			if n < 0 {
+				return -n
+			}
+			return n
+		}
+		if abs(deltas[i].Delta) != abs(deltas[j].Delta) {
+			return abs(deltas[i].Delta) > abs(deltas[j].Delta)
+		}
+
+		return deltas[i].ClassName < deltas[j].ClassName
+	})
+
+	return deltas
+}
+
+// 以jmap -histo的格式输出, 按对象数从多到少排列
+func (h HeapHistogram) Dump(w io.Writer) {
+	names := make([]string, 0, len(h))
+	var total int64
+	for name, count := range h {
+		names = append(names, name)
+		total += count
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if h[names[i]] != h[names[j]] {
+			return h[names[i]] > h[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintf(w, "%5s %12s  %s\n", "num", "#instances", "class name")
+	for ix, name := range names {
+		fmt.Fprintf(w, "%4d: %12d  %s\n", ix + 1, h[name], name)
+	}
+	fmt.Fprintf(w, "%5s %12d\n", "Total", total)
+}
@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestHeapHistogramDiff(t *testing.T) {
+	b := newClassBuilder("com/fh/Leak", "java/lang/Object")
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"kept": {FieldType: "Ljava/lang/Object;"}}
+	// kept = new Leak(); new int[4]; 只有kept在方法返回后仍然存活
+	code := newCodeAssembler().
+		emitIndex(bcode.New, b.classRef("com/fh/Leak")).
+		emitIndex(bcode.Putstatic, b.fieldRef("com/fh/Leak", "kept", "Ljava/lang/Object;")).
+		emit(bcode.Iconst4, bcode.Newarray, atype.Int).
+		emit(bcode.Pop).
+		emit(bcode.Return)
+	b.method(accflag.Static, "run", "()V", 1, 0, code)
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.TrackHeap = true
+
+	before := jvm.HeapHistogram()
+	for round := 0; round < 3; round++ {
+		frame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "run", "()V", frame, false); nil != err {
+			t.Fatal(err)
+		}
+	}
+	after := jvm.HeapHistogram()
+
+	if 1 != after["com.fh.Leak"] {
+		t.Fatalf("expect 1 live Leak, got %v", after)
+	}
+	if _, ok := after["[I"]; ok {
+		t.Fatalf("int[] should be collected, got %v", after)
+	}
+
+	deltas := before.Diff(after)
+	if 1 != len(deltas) || "com.fh.Leak" != deltas[0].ClassName || 1 != deltas[0].Delta {
+		t.Fatalf("unexpected diff %+v", deltas)
+	}
+
+	buf := new(bytes.Buffer)
+	after.Dump(buf)
+	if !strings.Contains(buf.String(), "1:            1  com.fh.Leak") {
+		t.Fatalf("unexpected dump:\n%s", buf.String())
+	}
+}
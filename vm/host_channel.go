@@ -0,0 +1,171 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"github.com/wanghongfei/mini-jvm/vm/convert"
+	"time"
+)
+
+const hostChannelClassName = "cn/minijvm/concurrency/HostChannel"
+
+// 把go channel以name注册给guest, guest通过mini-lib中的HostChannel.open(name)打开;
+// guest放入的元素经过convert包转换成go值后发送到ch, 宿主发送到ch的go值转换成guest对象后由guest取出;
+// 宿主关闭ch表示数据结束, 之后guest取出时得到null, 放入时抛出IllegalStateException
+func (m *MiniJvm) BindChannel(name string, ch chan interface{}) {
+	m.channelsLock.Lock()
+	defer m.channelsLock.Unlock()
+
+	if nil == m.channels {
+		m.channels = make(map[string]chan interface{})
+	}
+	m.channels[name] = ch
+}
+
+// 根据HostChannel对象的name字段找到绑定的channel
+func (m *MiniJvm) channelOf(ref interface{}) (chan interface{}, error) {
+	channelRef, ok := ref.(*class.Reference)
+	if !ok || nil == channelRef {
+		return nil, fmt.Errorf("java.lang.NullPointerException: channel is null")
+	}
+
+	nameVal, _ := channelRef.Object.GetFieldValue("name")
+	nameRef, _ := nameVal.(*class.Reference)
+	name, err := class.StringRunes(nameRef)
+	if nil != err {
+		return nil, fmt.Errorf("invalid HostChannel object: %w", err)
+	}
+
+	m.channelsLock.Lock()
+	defer m.channelsLock.Unlock()
+	ch, ok := m.channels[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("java.lang.IllegalArgumentException: channel '%s' not bound by host", string(name))
+	}
+
+	return ch, nil
+}
+
+// 向channel发送, timeout小于0时一直等待; 超时返回false
+func sendToChannel(ch chan interface{}, val interface{}, timeout time.Duration) (sent bool, err error) {
+	// 向已关闭的channel发送会panic
+	defer func() {
+		if r := recover(); nil != r {
+			sent, err = false, fmt.Errorf("java.lang.IllegalStateException: channel closed by host")
+		}
+	}()
+
+	if timeout < 0 {
+		ch <- val
+		return true, nil
+	}
+
+	select {
+	case ch <- val:
+		return true, nil
+	case <-time.After(timeout):
+		return false, nil
+	}
+}
+
+// 从channel接收并转换成guest对象, 超时或者channel已关闭时返回null
+func receiveFromChannel(jvm *MiniJvm, ch chan interface{}, timeout time.Duration) interface{} {
+	var val interface{}
+	var ok bool
+	if timeout < 0 {
+		val, ok = <-ch
+	} else {
+		select {
+		case val, ok = <-ch:
+		case <-time.After(timeout):
+		}
+	}
+	if !ok || nil == val {
+		return (*class.Reference)(nil)
+	}
+
+	guestVal, err := convert.NewConverter(jvm.MethodArea).FromGo(val)
+	if nil != err {
+		return fmt.Errorf("failed to convert channel item: %w", err)
+	}
+	return guestVal
+}
+
+// public static native HostChannel open(String name);
+func HostChannelOpen(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	nameRef, _ := args[2].(*class.Reference)
+
+	def, err := jvm.MethodArea.LoadClass(hostChannelClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", hostChannelClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	ref.Object.SetFieldValue("name", nameRef)
+
+	// 打开时就检查是否已经注册
+	if _, err := jvm.channelOf(ref); nil != err {
+		return err
+	}
+
+	return ref
+}
+
+func putToChannel(args []interface{}, timeout time.Duration) (bool, error) {
+	jvm := args[0].(*MiniJvm)
+	ch, err := jvm.channelOf(args[1])
+	if nil != err {
+		return false, err
+	}
+
+	val, err := convert.NewConverter(jvm.MethodArea).ToGo(args[2])
+	if nil != err {
+		return false, fmt.Errorf("failed to convert channel item: %w", err)
+	}
+
+	return sendToChannel(ch, val, timeout)
+}
+
+// public native void put(Object item);
+func HostChannelPut(args ...interface{}) interface{} {
+	if _, err := putToChannel(args, -1); nil != err {
+		return err
+	}
+
+	return nil
+}
+
+// public native boolean offer(Object item, long timeoutMillis);
+func HostChannelOffer(args ...interface{}) interface{} {
+	sent, err := putToChannel(args, time.Duration(toInt64(args[3])) * time.Millisecond)
+	if nil != err {
+		return err
+	}
+
+	return sent
+}
+
+// public native Object take();
+func HostChannelTake(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ch, err := jvm.channelOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	return receiveFromChannel(jvm, ch, -1)
+}
+
+// public native Object poll(long timeoutMillis);
+func HostChannelPoll(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ch, err := jvm.channelOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	return receiveFromChannel(jvm, ch, time.Duration(toInt64(args[2])) * time.Millisecond)
+}
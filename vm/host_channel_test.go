@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestHostChannel(t *testing.T) {
+	channelClass := newClassBuilder(hostChannelClassName, "java/lang/Object")
+	channelClass.field("name", "Ljava/lang/String;")
+	ma, err := newTestMethodArea(append(benchRuntimeClasses(), channelClass.def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma.IgnoredClasses = make(map[string]interface{})
+	jvm := &MiniJvm{MethodArea: ma}
+	ma.Jvm = jvm
+
+	ch := make(chan interface{}, 1)
+	jvm.BindChannel("jobs", ch)
+
+	name, err := class.NewStringObject([]rune("jobs"), ma)
+	if nil != err {
+		t.Fatal(err)
+	}
+	channelRef := HostChannelOpen(jvm, nil, name).(*class.Reference)
+
+	// guest -> host
+	item, _ := class.NewStringObject([]rune("hello"), ma)
+	if ret := HostChannelPut(jvm, channelRef, item); nil != ret {
+		t.Fatal(ret)
+	}
+	if val := <-ch; "hello" != val {
+		t.Fatalf("unexpected item %v", val)
+	}
+
+	// host -> guest
+	ch <- "world"
+	strRef := HostChannelTake(jvm, channelRef).(*class.Reference)
+	if runes, _ := class.StringRunes(strRef); "world" != string(runes) {
+		t.Fatalf("unexpected item %q", string(runes))
+	}
+
+	// 超时
+	if ret := HostChannelPoll(jvm, channelRef, int64(1)); nil != ret.(*class.Reference) {
+		t.Fatalf("expect null, got %v", ret)
+	}
+	ch <- "full"
+	if false != HostChannelOffer(jvm, channelRef, item, int64(1)) {
+		t.Fatal("offer to full channel should time out")
+	}
+	<-ch
+
+	// 宿主关闭channel
+	close(ch)
+	if ret := HostChannelTake(jvm, channelRef); nil != ret.(*class.Reference) {
+		t.Fatalf("expect null after close, got %v", ret)
+	}
+	err, _ = HostChannelPut(jvm, channelRef, item).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.lang.IllegalStateException") {
+		t.Fatalf("expect IllegalStateException, got %v", err)
+	}
+
+	// 没有注册的channel
+	unknown, _ := class.NewStringObject([]rune("unknown"), ma)
+	err, _ = HostChannelOpen(jvm, nil, unknown).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.lang.IllegalArgumentException") {
+		t.Fatalf("expect IllegalArgumentException, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"github.com/wanghongfei/mini-jvm/vm/convert"
+)
+
+// 绑定到guest中native方法的宿主函数;
+// 参数和返回值都是go值, 与guest对象之间的转换由convert包完成; 返回error时终止guest程序的执行
+type HostFunction func(args ...interface{}) (interface{}, error)
+
+// 把guest类中声明的native方法绑定到宿主函数, 用于向guest代码暴露数据库, HTTP等宿主能力;
+// className可以用.或者/分隔, 如 m.BindNative("com/acme/Host", "fetch", "(Ljava/lang/String;)Ljava/lang/String;", fetch)
+func (m *MiniJvm) BindNative(className string, methodName string, descriptor string, goFunc HostFunction) {
+	_, retDesc := class.ParseMethodDescriptor(descriptor)
+
+	m.NativeMethodTable.RegisterMethod(className, methodName, descriptor, func(args ...interface{}) interface{} {
+		jvm := args[0].(*MiniJvm)
+		converter := convert.NewConverter(jvm.MethodArea)
+
+		// 跳过jvm指针和接收者
+		hostArgs := make([]interface{}, len(args) - 2)
+		for ix, arg := range args[2:] {
+			val, err := converter.ToGo(arg)
+			if nil != err {
+				return fmt.Errorf("failed to convert argument %d: %w", ix, err)
+			}
+			hostArgs[ix] = val
+		}
+
+		ret, err := goFunc(hostArgs...)
+		if nil != err {
+			return err
+		}
+
+		switch retDesc[0] {
+		case 'V':
+			return nil
+		case 'L', '[':
+			guestRet, err := converter.FromGo(ret)
+			if nil != err {
+				return fmt.Errorf("failed to convert return value: %w", err)
+			}
+			return guestRet
+		}
+
+		// 基本类型返回值原样返回
+		return ret
+	})
+}
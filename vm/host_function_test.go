@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBindNative(t *testing.T) {
+	jvm := &MiniJvm{NativeMethodTable: NewNativeMethodTable()}
+
+	jvm.BindNative("com/acme/Host", "add", "(II)I", func(args ...interface{}) (interface{}, error) {
+		return args[0].(int) + args[1].(int), nil
+	})
+
+	info := jvm.NativeMethodTable.FindMethodInfo("com/acme/Host", "add", "(II)I")
+	if nil == info {
+		t.Fatal("native method not registered")
+	}
+	if ret := info.EntryFunc(jvm, nil, 1, 2); 3 != ret {
+		t.Fatalf("unexpected result %v", ret)
+	}
+
+	// 宿主函数返回的错误原样交给执行引擎
+	hostErr := errors.New("host failure")
+	jvm.BindNative("com.acme.Host", "fail", "()V", func(args ...interface{}) (interface{}, error) {
+		return nil, hostErr
+	})
+	ret := jvm.NativeMethodTable.FindMethodInfo("com/acme/Host", "fail", "()V").EntryFunc(jvm, nil)
+	if err, ok := ret.(error); !ok || !errors.Is(err, hostErr) {
+		t.Fatalf("unexpected result %v", ret)
+	}
+}
@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestInstanceof(t *testing.T) {
+	// Dog extends Base implements Pet, Pet extends Animal
+	animal := newTestClass("com/fh/Animal", "java/lang/Object", nil)
+	animal.AccessFlag = accflag.Interface
+	pet := newTestClass("com/fh/Pet", "java/lang/Object", []string{"com/fh/Animal"})
+	pet.AccessFlag = accflag.Interface
+	base := newTestClass("com/fh/Base", "java/lang/Object", nil)
+	dog := newTestClass("com/fh/Dog", "com/fh/Base", []string{"com/fh/Pet"})
+	cat := newTestClass("com/fh/Cat", "java/lang/Object", nil)
+	defs := []*class.DefFile{animal, pet, base, dog, cat}
+
+	// static int calc(Object o) { return o instanceof <target> ? 1 : 0; }
+	instanceOf := func(val *class.Reference, target string) interface{} {
+		b := newClassBuilder("com/fh/Check", "java/lang/Object")
+		b.method(accflag.Static, "calc", "(Ljava/lang/Object;)I", 1, 1, newCodeAssembler().
+			emit(bcode.Aload0).emitIndex(bcode.Instanceof, b.classRef(target)).emit(bcode.Ireturn))
+		jvm, err := newClassInitTestJvm(append(defs, b.def)...)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		frame := newMethodStackFrame(1, 0)
+		frame.opStack.Push(val)
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", "(Ljava/lang/Object;)I", frame, false); nil != err {
+			t.Fatalf("instanceof %s: %v", target, err)
+		}
+		ret, _ := frame.opStack.Pop()
+		return ret
+	}
+
+	dogRef := &class.Reference{RefType: class.ReferanceTypeObject, Object: &class.Object{DefFile: dog}}
+	dogs, _ := class.NewObjectArray(1, "com/fh/Dog")
+	ints, _ := class.NewArray(1, atype.Int)
+	matrix, _ := class.NewObjectArray(1, "[I")
+
+	cases := []struct {
+		val    *class.Reference
+		target string
+		expect int
+	}{
+		{dogRef, "com/fh/Dog", 1},
+		{dogRef, "com/fh/Base", 1},
+		{dogRef, "com/fh/Animal", 1},
+		{dogRef, "java/lang/Object", 1},
+		{dogRef, "com/fh/Cat", 0},
+		{dogRef, "[Lcom/fh/Dog;", 0},
+		{nil, "java/lang/Object", 0},
+		// 数组
+		{dogs, "[Lcom/fh/Animal;", 1},
+		{dogs, "[Ljava/lang/Object;", 1},
+		{dogs, "[Lcom/fh/Cat;", 0},
+		{dogs, "java/lang/Cloneable", 1},
+		{dogs, "com/fh/Dog", 0},
+		{ints, "[I", 1},
+		{ints, "[J", 0},
+		{ints, "[Ljava/lang/Object;", 0},
+		{ints, "java/io/Serializable", 1},
+		{matrix, "[Ljava/lang/Object;", 1},
+		{matrix, "[[I", 1},
+		{matrix, "[[J", 0},
+	}
+	for _, c := range cases {
+		if ret := instanceOf(c.val, c.target); c.expect != ret {
+			t.Errorf("%s instanceof %s: expect %d, got %v", DefaultObjectRenderer.Render(c.val), c.target, c.expect, ret)
+		}
+	}
+}
+
+func TestCheckcastThrowsClassCastException(t *testing.T) {
+	// ClassCastException(String s) { detailMessage = s; }
+	exception := newClassBuilder("java/lang/ClassCastException", "java/lang/Object")
+	exception.field("detailMessage", "Ljava/lang/String;")
+	exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef("java/lang/ClassCastException", "detailMessage", "Ljava/lang/String;")).
+		emit(bcode.Return))
+	dog := newTestClass("com/fh/Dog", "java/lang/Object", nil)
+	cat := newTestClass("com/fh/Cat", "java/lang/Object", nil)
+	defs := []*class.DefFile{exception.def, dog, cat, newTestClass("java/lang/String", "java/lang/Object", nil)}
+
+	// static int calc(Object o) { try { Object x = (<target>) o; return 1; } catch (<catchType> e) { return 0; } }
+	cast := func(val *class.Reference, target string, catchType string) (interface{}, error) {
+		b := newClassBuilder("com/fh/Check", "java/lang/Object")
+		b.method(accflag.Static, "calc", "(Ljava/lang/Object;)I", 2, 1, newCodeAssembler().
+			emit(bcode.Aload0).emitIndex(bcode.Checkcast, b.classRef(target)).emit(bcode.Pop, bcode.Iconst1, bcode.Ireturn).
+			emit(bcode.Pop, bcode.Iconst0, bcode.Ireturn))
+		b.def.Methods[0].Attrs[0].(*class.CodeAttr).ExceptionTable = []*class.ExceptionTable{
+			{StartPc: 0, EndPc: 7, HandlerPc: 7, CatchType: b.classRef(catchType)},
+		}
+		jvm, err := newClassInitTestJvm(append(defs, b.def)...)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		frame := newMethodStackFrame(1, 0)
+		frame.opStack.Push(val)
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", "(Ljava/lang/Object;)I", frame, false); nil != err {
+			return nil, err
+		}
+		ret, _ := frame.opStack.Pop()
+		return ret, nil
+	}
+
+	dogRef := &class.Reference{RefType: class.ReferanceTypeObject, Object: &class.Object{DefFile: dog}}
+	ints, _ := class.NewArray(1, atype.Int)
+	cases := []struct {
+		val    *class.Reference
+		target string
+		expect int
+	}{
+		{dogRef, "com/fh/Dog", 1},
+		{dogRef, "com/fh/Cat", 0},
+		{nil, "com/fh/Cat", 1},
+		{ints, "[I", 1},
+		{ints, "java/lang/Cloneable", 1},
+		{ints, "[J", 0},
+		{dogRef, "[Lcom/fh/Dog;", 0},
+	}
+	for _, c := range cases {
+		if ret, err := cast(c.val, c.target, "java/lang/ClassCastException"); nil != err || c.expect != ret {
+			t.Errorf("cast %s to %s: expect %d, got %v, %v", DefaultObjectRenderer.Render(c.val), c.target, c.expect, ret, err)
+		}
+	}
+
+	// 没有被捕获时作为java异常向上抛出, 带有消息
+	_, err := cast(dogRef, "com/fh/Cat", "java/lang/IllegalStateException")
+	var thrown *ExceptionThrownError
+	if !errors.As(err, &thrown) || "java/lang/ClassCastException" != thrown.ExceptionRef.Object.DefFile.FullClassName {
+		t.Fatalf("expect ClassCastException, got %v", err)
+	}
+	message, _ := thrown.ExceptionRef.Object.GetFieldValue("detailMessage")
+	if runes, err := class.StringRunes(message.(*class.Reference)); nil != err || "com.fh.Dog cannot be cast to com.fh.Cat" != string(runes) {
+		t.Fatalf("unexpected message %q, %v", string(runes), err)
+	}
+	_, err = cast(ints, "[Ljava/lang/Object;", "java/lang/IllegalStateException")
+	if !errors.As(err, &thrown) {
+		t.Fatalf("expect ClassCastException, got %v", err)
+	}
+	message, _ = thrown.ExceptionRef.Object.GetFieldValue("detailMessage")
+	if runes, _ := class.StringRunes(message.(*class.Reference)); "[I cannot be cast to [Ljava.lang.Object;" != string(runes) {
+		t.Fatalf("unexpected message %q", string(runes))
+	}
+}
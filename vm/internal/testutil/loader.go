@@ -0,0 +1,31 @@
+// 测试共用的辅助代码, 只能在vm及其子包中使用
+package testutil
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+)
+
+// 不读取classpath的class.Loader, 按类名返回只有类名的空DefFile, 同名的类总是返回同一个DefFile;
+// 用于只创建String, 数组等对象而不执行字节码的测试
+type StubLoader struct {
+	defs map[string]*class.DefFile
+	lock sync.Mutex
+}
+
+func NewStubLoader() *StubLoader {
+	return &StubLoader{defs: make(map[string]*class.DefFile)}
+}
+
+func (l *StubLoader) LoadClass(name string) (*class.DefFile, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	def, ok := l.defs[name]
+	if !ok {
+		def = &class.DefFile{FullClassName: name}
+		l.defs[name] = def
+	}
+
+	return def, nil
+}
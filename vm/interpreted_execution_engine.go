@@ -8,18 +8,29 @@ import (
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
 	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
 	"github.com/wanghongfei/mini-jvm/vm/bcode"
 	"github.com/wanghongfei/mini-jvm/vm/class"
+	"math"
 	"reflect"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 )
 
 // 解释执行引擎
+// java方法之间的调用不占用go的调用栈: invoke指令只创建被调用方法的栈帧, 由run()的循环切换到新栈帧执行,
+// 返回或者抛出异常时再沿prevFrame切回调用者; 调用深度只受MaxStackDepth限制.
+// 只有go代码(如本地方法, <clinit>)调用java方法时才会嵌套一层run()
 type InterpretedExecutionEngine struct {
 	miniJvm *MiniJvm
 
-	// methodStack *MethodStack
+	// 插件指令, 见RegisterOpcodeHandler
+	opcodeHandlers [256]OpcodeHandler
+
+	// 已经链接的invokedynamic调用点, key为callSiteKey
+	callSites sync.Map
 }
 
 func (i *InterpretedExecutionEngine) Execute(def *class.DefFile, methodName string) error {
@@ -31,49 +42,64 @@ func (i *InterpretedExecutionEngine) ExecuteWithDescriptor(def *class.DefFile, m
 }
 
 func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, methodName string, methodDescriptor string, lastFrame *MethodStackFrame, queryVTable bool) error {
+	return i.executeMethod(def, methodName, methodDescriptor, lastFrame, queryVTable, anyMethod)
+}
+
+// 在go代码中调用java方法, 直到方法返回或抛出没有捕获的异常;
+// kind: 调用指令要求的方法类型, invokestatic只能调用static方法, 其他invoke指令只能调用实例方法
+func (i *InterpretedExecutionEngine) executeMethod(def *class.DefFile, methodName string, methodDescriptor string, lastFrame *MethodStackFrame, queryVTable bool, kind int) error {
+	frame, err := i.invoke(def, methodName, methodDescriptor, lastFrame, queryVTable, kind)
+	if nil != err || nil == frame {
+		return err
+	}
+
+	return i.run(frame)
+}
+
+// 调用方法: 本地方法直接执行并返回nil栈帧; 字节码方法只创建栈帧并传参, 不执行
+func (i *InterpretedExecutionEngine) invoke(def *class.DefFile, methodName string, methodDescriptor string, lastFrame *MethodStackFrame, queryVTable bool, kind int) (*MethodStackFrame, error) {
 	// fmt.Printf("[DEBUG] %v: %v\n", methodName, methodDescriptor)
 	utils.LogInfoPrintf("execute method %s:%s", methodName, methodDescriptor)
 
 	// 查找方法
-	method, err := i.findMethod(def, methodName, methodDescriptor, queryVTable)
+	method, err := i.findMethod(def, methodName, methodDescriptor, queryVTable, kind)
 	if nil != err {
-		return fmt.Errorf("failed to find method: %w", err)
+		return nil, fmt.Errorf("failed to find method: %w", err)
 	}
 	// 因为method有可能是在父类中找到的，因此需要更新一下def到method对应的def
 	def = method.DefFile
 
+	if method.AccessFlags & accflag.Abstarct > 0 {
+		return nil, fmt.Errorf("java.lang.AbstractMethodError: %s.%s%s", def.FullClassName, methodName, methodDescriptor)
+	}
+
 	// 解析访问标记
 	flagMap := accflag.ParseAccFlags(method.AccessFlags)
-	// 是native方法
-	if _, ok := flagMap[accflag.Native]; ok {
-		// 查本地方法表
-		nativeFunc, methodArgCount := i.miniJvm.NativeMethodTable.FindMethod(def.FullClassName, methodName, methodDescriptor)
-		if nil == nativeFunc {
-			// 该本地方法尚未被支持
-			return fmt.Errorf("unsupported native method '%s'", method)
+	// 查本地方法表
+	nativeInfo := i.miniJvm.NativeMethodTable.FindMethodInfo(def.FullClassName, methodName, methodDescriptor)
+	if nil == nativeInfo && !i.miniJvm.DisableIntrinsics {
+		// 热点方法由go实现替代字节码
+		nativeInfo = i.miniJvm.IntrinsicTable.FindMethodInfo(def.FullClassName, methodName, methodDescriptor)
+	}
+	// 是native方法, 或者注册了替代java实现的go函数
+	_, isNative := flagMap[accflag.Native]
+	if isNative || (nil != nativeInfo && nativeInfo.Intrinsic) {
+		if nil == nativeInfo {
+			// 该本地方法尚未被支持, 按策略跳过或者交给hook
+			nativeInfo = i.miniJvm.unsupportedNativeStub(def.FullClassName, methodName, methodDescriptor,
+				fmt.Errorf("unsupported native method '%s'", method))
+			if nil == nativeInfo {
+				return nil, fmt.Errorf("unsupported native method '%s'", method)
+			}
 		}
+		nativeFunc := nativeInfo.EntryFunc
+		methodArgCount := class.ParseArgCount(nativeInfo.Descriptor)
 
 		// 调用本地方法时, 固定第一个参数时JVM指针
 		nativeSpecialArgJvm := i.miniJvm
 		// 第二个参数是方法接收者
 		var nativeSpecialArgReceiver interface{}
 
-		// 是否为static方法
-		_, isStatic := flagMap[accflag.Static]
-		if !isStatic {
-			// 取出this引用
-			if 0 == methodArgCount {
-				// 方法没有参数, 此时栈顶是接收者引用
-				nativeSpecialArgReceiver, _ = lastFrame.opStack.PopReference()
-			}
-			//obj, _ := lastFrame.opStack.GetTopObject()
-			//nativeSpecialArgReceiver = obj
-
-		} else {
-			// 接收者是class本身
-			nativeSpecialArgReceiver = def
-		}
-
 		// 构造参数数组, 长度是方法参数个数 + 2
 		argCount := methodArgCount + 2
 		args := make([]interface{}, argCount)
@@ -84,6 +110,17 @@ func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, method
 			// args = append(args, arg)
 		}
 
+		// 是否为static方法
+		_, isStatic := flagMap[accflag.Static]
+		if !isStatic {
+			// 参数都出栈后, 栈顶是接收者引用
+			nativeSpecialArgReceiver, _ = lastFrame.opStack.PopReference()
+
+		} else {
+			// 接收者是class本身
+			nativeSpecialArgReceiver = def
+		}
+
 		// 填充前2个固定参数
 		args[argCount - 1] = nativeSpecialArgJvm
 		args[argCount - 2] = nativeSpecialArgReceiver
@@ -93,29 +130,97 @@ func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, method
 			args[ix], args[argCount - 1 - ix] = args[argCount - 1 - ix], args[ix]
 		}
 
-		if strings.HasPrefix(methodName, "print") {
-			i.miniJvm.DebugPrintHistory = append(i.miniJvm.DebugPrintHistory, args[2:]...)
+		// 需要访问调用栈的本地方法, 把调用者栈帧放在最后
+		if nativeInfo.NeedCallerFrame {
+			args = append(args, lastFrame)
+		}
+
+		// 需要调用者栈帧的print方法(如printObject要调用toString())自己记录输出
+		if strings.HasPrefix(methodName, "print") && !nativeInfo.NeedCallerFrame {
+			i.miniJvm.capturePrint(lastFrame, methodDescriptor, args[2:2 + methodArgCount])
+		}
+
+		// 敏感本地方法需要经过安全策略检查
+		if "" != nativeInfo.Permission && nil != i.miniJvm.Policy {
+			err := i.miniJvm.Policy.Check(&PolicyRequest{
+				Permission: nativeInfo.Permission,
+				ClassName:  def.FullClassName,
+				MethodName: methodName,
+				Descriptor: methodDescriptor,
+				Args:       args[2:2 + methodArgCount],
+			})
+			if nil != err {
+				return nil, err
+			}
+		}
+
+		if nil != i.miniJvm.NativeAudit {
+			i.miniJvm.NativeAudit.Record(newNativeCallRecord(def.FullClassName, methodName, methodDescriptor, args[2:2 + methodArgCount], lastFrame))
 		}
 
 		// 调用go函数
+		i.miniJvm.stats.onNativeCall()
 		funcRet := nativeFunc(args...)
-		if nil != funcRet {
-			// native函数有返回值
-			// 返回值压入上一个栈中
-			lastFrame.opStack.Push(funcRet)
+		if err, ok := funcRet.(error); ok {
+			// 本地方法抛出的java异常原样向上传递, 其他错误终止执行
+			if thrown, isException := err.(*ExceptionThrownError); isException {
+				if breakpoints := i.miniJvm.ExceptionBreakpoints; nil != breakpoints && nil != lastFrame && nil != lastFrame.method {
+					if breakErr := breakpoints.onThrow(i.miniJvm, lastFrame, thrown.ExceptionRef); nil != breakErr {
+						return nil, breakErr
+					}
+				}
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("native method '%s.%s%s' failed: %w", def.FullClassName, methodName, methodDescriptor, err)
+		}
+		// 按描述符中的返回类型把返回值压入上一个栈中, void方法的返回值被丢弃
+		err = pushNativeReturn(lastFrame.opStack, returnKindOf(methodDescriptor), funcRet)
+		if nil != err {
+			return nil, fmt.Errorf("native method '%s.%s%s': %w", def.FullClassName, methodName, methodDescriptor, err)
 		}
 
-		return nil
+		return nil, nil
 	}
 
 	// 提取code属性
 	codeAttr, err := i.findCodeAttr(method)
 	if nil != err {
-		return fmt.Errorf("failed to extract code attr: %w", err)
+		// LazyLink时第一次执行才校验字节码, 记录被校验的方法而不是调用者
+		i.miniJvm.recordCrashSite(err, def, method, -1, lastFrame)
+		return nil, fmt.Errorf("failed to extract code attr: %w", err)
 	}
 
 	// 创建栈帧
 	frame := newMethodStackFrame(int(codeAttr.MaxStack), int(codeAttr.MaxLocals))
+	if nil != lastFrame {
+		frame.depth = lastFrame.depth + 1
+		if i.miniJvm.MaxStackDepth > 0 && frame.depth > i.miniJvm.MaxStackDepth {
+			return nil, fmt.Errorf("java.lang.StackOverflowError: stack depth exceeds %d", i.miniJvm.MaxStackDepth)
+		}
+		if 0 == lastFrame.threadID && nil == lastFrame.prevFrame {
+			// go代码构造的辅助栈帧没有指定线程时分配一个
+			lastFrame.threadID = nextThreadID()
+		}
+		frame.threadID = lastFrame.ThreadID()
+	} else {
+		frame.depth = 1
+		frame.threadID = nextThreadID()
+	}
+	i.miniJvm.stats.onFrameCreated(frame.depth)
+	frame.prevFrame = lastFrame
+	frame.method = method
+	frame.codeAttr = codeAttr
+	frame.returnKind = returnKindOf(methodDescriptor)
+	if nil != i.miniJvm.PreloadRecorder {
+		i.miniJvm.PreloadRecorder.onInvoke(method)
+	}
+	if nil != i.miniJvm.ThreadLimits {
+		i.miniJvm.threadUsageOf(frame)
+	}
+	if tracer := i.miniJvm.Tracer; nil != tracer {
+		tracer.onMethodEnter(def.FullClassName, methodName)
+	}
 
 	// 如果没有上层栈帧
 	if nil == lastFrame && "main" == methodName {
@@ -152,34 +257,24 @@ func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, method
 		}
 
 		// 取出方法描述符
-		descriptor := def.ConstPool[method.DescriptorIndex].(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
 		// 解析描述符
 		argDespList, _ := class.ParseMethodDescriptor(descriptor)
-		// 临时保存参数列表
-		argList := make([]interface{}, 0, len(argDespList))
-		// 按参数数量出栈, 取出参数
-		for _, arg := range argDespList {
-			// 是int/char参数
-			if "I" == arg || "C" == arg || "Ljava/lang/String" == arg || "[C" == arg {
-				// 从上一个栈帧中出栈, 保存到新栈帧的localVarTable中
-				op, _ := lastFrame.opStack.Pop()
-				argList = append(argList, op)
-
-				// frame.localVariablesTable[ix + localVarStartIndexOffset] = op
-
-			} else {
-				return fmt.Errorf("unsupported argument descriptor '%s' in '%s'", arg, descriptor)
+		// 放入变量曹, 与编译器分配的下标一致, long和double占两个槽
+		slot := localVarStartIndexOffset
+		for _, argDesp := range argDespList {
+			slot++
+			if "J" == argDesp || "D" == argDesp {
+				slot++
 			}
 		}
-
-		// 反转参数列表(因出栈顺序跟实际参数顺序相反)
-		for ix := 0; ix < len(argList) / 2; ix++ {
-			argList[ix], argList[len(argList) - 1 - ix] = argList[len(argList) - 1 - ix], argList[ix]
-		}
-
-		// 放入变量曹
-		for ix, arg := range argList {
-			frame.localVariablesTable[ix + localVarStartIndexOffset] = arg
+		// 所有类型的参数在操作数栈中都只占一个位置, 从最后一个参数开始从上一个栈帧中出栈
+		for ix := len(argDespList) - 1; ix >= 0; ix-- {
+			slot--
+			if "J" == argDespList[ix] || "D" == argDespList[ix] {
+				slot--
+			}
+			lastFrame.opStack.popToLocal(frame, slot)
 		}
 
 		if !isStatic {
@@ -191,7 +286,7 @@ func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, method
 		// 是否有同步关键字
 		if _, ok := flagMap[accflag.Synchronized]; ok {
 			// 决定用哪个锁
-			var lock *sync.Mutex
+			var lock *class.Monitor
 			// 如果是静态方法
 			if _, isStatic := flagMap[accflag.Static]; isStatic {
 				// 锁的是class
@@ -200,37 +295,127 @@ func (i *InterpretedExecutionEngine) ExecuteWithFrame(def *class.DefFile, method
 				lock = &(frame.localVariablesTable[0].(*class.Reference).Monitor)
 			}
 
-			defer func() {
-				lock.Unlock()
-			}()
-
-			// 上锁
-			lock.Lock()
+			// 上锁, 方法结束时由releaseMonitors释放
+			if err := frame.enterMonitor(i.miniJvm.hostContext(), lock); nil != err {
+				return nil, err
+			}
 		}
 	}
 
 
-
-	// 执行字节码
-	return i.executeInFrame(def, codeAttr, frame, lastFrame, methodName, methodDescriptor)
+	return frame, nil
 }
 
-func (i *InterpretedExecutionEngine) executeWithFrameAndExceptionAdvice(def *class.DefFile, methodName string,
-	methodDescriptor string, lastFrame *MethodStackFrame, queryVTable bool, codeAttr *class.CodeAttr) error {
+// 执行invoke指令; 本地方法抛出的异常在调用者的异常表中查找handler, 找到时返回nil;
+// callerDef和codeAttr为调用者的class和Code属性
+func (i *InterpretedExecutionEngine) executeWithFrameAndExceptionAdvice(callerDef *class.DefFile, def *class.DefFile, methodName string,
+	methodDescriptor string, lastFrame *MethodStackFrame, queryVTable bool, kind int, codeAttr *class.CodeAttr) (*MethodStackFrame, error) {
 
-	// 执行方法
-	err := i.ExecuteWithFrame(def, methodName, methodDescriptor, lastFrame, queryVTable)
+	callee, err := i.invoke(def, methodName, methodDescriptor, lastFrame, queryVTable, kind)
 	// 判断是否抛出了异常到此层面
 	if exceptionErr, ok := err.(*ExceptionThrownError); ok {
 		// 查异常表修改pc
-		return i.athrowJumpToTargetPc(def, lastFrame, codeAttr,
+		caught, catchErr := i.catchException(callerDef, lastFrame, codeAttr,
 			exceptionErr.ExceptionRef.Object.DefFile.FullClassName, exceptionErr.ExceptionRef)
+		if nil != catchErr {
+			return nil, catchErr
+		}
+		if caught {
+			return nil, nil
+		}
+
+		// 没有捕获, 同一个对象继续向上传递, 不重新包装
+		return nil, exceptionErr
 	}
 
-	return err
+	return callee, err
 }
 
-func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr *class.CodeAttr, frame *MethodStackFrame, lastFrame *MethodStackFrame, methodName string, methodDescriptor string) error {
+// 从entry栈帧开始执行, 直到entry返回;
+// 调用字节码方法时切换到被调用者的栈帧, 被调用者返回后回到调用者invoke指令的下一条继续执行
+func (i *InterpretedExecutionEngine) run(entry *MethodStackFrame) (err error) {
+	frame := entry
+
+	// 解释器自身的bug不应该让宿主进程崩溃: panic转换成EnginePanicError, 释放途经栈帧的锁后返回给调用run()的go代码
+	defer func() {
+		if r := recover(); nil != r {
+			panicErr := &EnginePanicError{Value: r, Stack: debug.Stack()}
+			i.miniJvm.recordCrashSite(panicErr, frame.method.DefFile, frame.method, frame.pc, frame)
+			_, err = i.unwind(entry, frame, panicErr)
+		}
+	}()
+
+	for {
+		callee, err := i.executeInFrame(frame)
+		if nil != err {
+			i.miniJvm.recordCrashSite(err, frame.method.DefFile, frame.method, frame.pc, frame)
+			frame, err = i.unwind(entry, frame, err)
+			if nil != err {
+				return err
+			}
+
+			// 调用者中找到了handler, pc已经指向handler的前一条
+			frame.pc++
+			continue
+		}
+
+		if nil != callee {
+			frame = callee
+			continue
+		}
+
+		// 当前方法返回
+		i.exitFrame(frame)
+		if entry == frame {
+			return nil
+		}
+		frame = frame.prevFrame
+		frame.pc++
+	}
+}
+
+// 异常或错误沿调用链向上传递: 依次丢弃栈帧, 直到某个调用者的异常表能处理此异常, 返回该调用者;
+// 传到entry仍没有处理时返回错误, 由调用run()的go代码处理
+func (i *InterpretedExecutionEngine) unwind(entry *MethodStackFrame, frame *MethodStackFrame, err error) (*MethodStackFrame, error) {
+	for {
+		i.exitFrame(frame)
+		if entry == frame {
+			return nil, err
+		}
+
+		caller := frame.prevFrame
+		if exceptionErr, ok := err.(*ExceptionThrownError); ok {
+			caught, catchErr := i.catchException(caller.method.DefFile, caller, caller.codeAttr,
+				exceptionErr.ExceptionRef.Object.DefFile.FullClassName, exceptionErr.ExceptionRef)
+			if nil != catchErr {
+				// 异常断点中断执行, 与其他错误一样继续丢弃栈帧
+				err = catchErr
+			} else if caught {
+				return caller, nil
+			}
+
+		} else {
+			err = fmt.Errorf("failed to execute '%s': %w", bcode.ToName(caller.callOpcode), err)
+		}
+
+		frame = caller
+	}
+}
+
+// 栈帧结束(包括抛出异常)时调用, 按加锁的相反顺序释放本栈帧还持有的锁
+func (i *InterpretedExecutionEngine) exitFrame(frame *MethodStackFrame) {
+	frame.releaseMonitors()
+
+	if tracer := i.miniJvm.Tracer; nil != tracer {
+		tracer.onMethodExit(frame.method.DefFile.FullClassName, frame.method.String())
+	}
+}
+
+// 执行栈帧中的字节码, 直到方法返回(返回nil, nil), 调用字节码方法(返回被调用者的栈帧)或者出错
+func (i *InterpretedExecutionEngine) executeInFrame(frame *MethodStackFrame) (*MethodStackFrame, error) {
+	def := frame.method.DefFile
+	codeAttr := frame.codeAttr
+	lastFrame := frame.prevFrame
 
 	isWideStatus := false
 	for {
@@ -238,6 +423,26 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 		byteCode := codeAttr.Code[frame.pc]
 		// fmt.Printf("[DEBUG] byte code: %v\n", bcode.ToName(byteCode))
 		utils.LogInfoPrintf("execute byte code: %v", bcode.ToName(byteCode))
+		i.miniJvm.stats.onByteCode(byteCode)
+		if nil != i.miniJvm.Tracer {
+			i.miniJvm.Tracer.onInstruction(frame, byteCode)
+		}
+		if nil != i.miniJvm.History {
+			i.miniJvm.History.onInstruction(frame, byteCode)
+		}
+		if nil != i.miniJvm.Coverage {
+			i.miniJvm.Coverage.onInstruction(frame)
+		}
+		if nil != i.miniJvm.Watchpoints {
+			if err := i.miniJvm.Watchpoints.onInstruction(i.miniJvm, frame, byteCode); nil != err {
+				return nil, err
+			}
+		}
+		if nil != frame.usage {
+			if err := frame.usage.onByteCode(byteCode, i.miniJvm.ThreadLimits); nil != err {
+				return nil, err
+			}
+		}
 
 		exitLoop := false
 
@@ -247,62 +452,67 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			frame.opStack.Push(nil)
 		case bcode.Iconst0:
 			// 将x压栈
-			frame.opStack.Push(0)
+			frame.opStack.PushInt(0)
 		case bcode.Iconst1:
-			frame.opStack.Push(1)
+			frame.opStack.PushInt(1)
 		case bcode.Iconst2:
-			frame.opStack.Push(2)
+			frame.opStack.PushInt(2)
 		case bcode.Iconst3:
-			frame.opStack.Push(3)
+			frame.opStack.PushInt(3)
 		case bcode.Iconst4:
-			frame.opStack.Push(4)
+			frame.opStack.PushInt(4)
 		case bcode.Iconst5:
-			frame.opStack.Push(5)
-
-		case bcode.Iaload:
-			// 将int型数组指定索引的值推送至栈顶
-			// Operand Stack
-			//..., arrayref, index →
-			//..., value
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-			frame.opStack.Push(arrRef.Array.Data[arrIndex])
+			frame.opStack.PushInt(5)
 
-		case bcode.Aaload:
-			// 将引用类型的数组指定索引值压栈
-			// Operand Stack
-			//..., arrayref, index →
-			//..., value
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-			frame.opStack.Push(arrRef.Array.Data[arrIndex])
+		case bcode.Iaload, bcode.Laload, bcode.Faload, bcode.Daload, bcode.Aaload, bcode.Baload, bcode.Caload, bcode.Saload:
+			err := i.bcodeArrayLoad(def, frame, codeAttr, byteCode)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
 
-		case bcode.Caload:
-			// 将char型数组指定索引的值推送至栈顶
-			// Operand Stack
-			//..., arrayref, index →
-			//..., value
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-			frame.opStack.Push(arrRef.Array.Data[arrIndex])
+				return nil, fmt.Errorf("failed to execute '%s': %w", bcode.ToName(byteCode), err)
+			}
 
+		case bcode.Istore0:
+			// 将栈顶int型数值存入第一个本地变量
+			top, _ := frame.opStack.PopInt()
+			frame.setLocalTableIntAt(0, top)
 		case bcode.Istore1:
 			// 将栈顶int型数值存入第二个本地变量
 			top, _ := frame.opStack.PopInt()
-			frame.localVariablesTable[1] = top
+			frame.setLocalTableIntAt(1, top)
 		case bcode.Istore2:
 			// 将栈顶int型数值存入第3个本地变量
 			top, _ := frame.opStack.PopInt()
-			frame.localVariablesTable[2] = top
+			frame.setLocalTableIntAt(2, top)
 		case bcode.Istore3:
 			// 将栈顶int型数值存入第4个本地变量
 			top, _ := frame.opStack.PopInt()
-			frame.localVariablesTable[3] = top
+			frame.setLocalTableIntAt(3, top)
+
+		case bcode.Lconst0, bcode.Lconst1:
+			frame.opStack.PushLong(int64(byteCode - bcode.Lconst0))
+
+		case bcode.Lload:
+			// lload index, long在本地变量表中占index和index + 1两个槽
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
 
-		case bcode.Lstore1:
+			frame.opStack.PushLong(frame.GetLocalTableLongAt(index))
+		case bcode.Lload0, bcode.Lload1, bcode.Lload2, bcode.Lload3:
+			frame.opStack.PushLong(frame.GetLocalTableLongAt(int(byteCode - bcode.Lload0)))
+
+		case bcode.Lstore:
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
+
+			val, _ := frame.opStack.PopLong()
+			frame.setLocalTableLongAt(index, val)
+		case bcode.Lstore0, bcode.Lstore1, bcode.Lstore2, bcode.Lstore3:
 			// 将栈顶long型数值存入本地变量
-			top, _ := frame.opStack.Pop()
-			frame.localVariablesTable[1] = top
+			val, _ := frame.opStack.PopLong()
+			frame.setLocalTableLongAt(int(byteCode - bcode.Lstore0), val)
 
 		case bcode.Iload:
 			// Load int from local variable
@@ -310,22 +520,22 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			index := codeAttr.Code[frame.pc + 1]
 			frame.pc++
 
-			frame.opStack.Push(frame.localVariablesTable[index])
+			frame.opStack.PushInt(frame.GetLocalTableIntAt(int(index)))
 		case bcode.Iload0:
 			// 将第1个slot中的值压栈
-			frame.opStack.Push(frame.localVariablesTable[0])
+			frame.opStack.PushInt(frame.GetLocalTableIntAt(0))
 		case bcode.Iload1:
-			frame.opStack.Push(frame.localVariablesTable[1])
+			frame.opStack.PushInt(frame.GetLocalTableIntAt(1))
 		case bcode.Iload2:
-			frame.opStack.Push(frame.localVariablesTable[2])
+			frame.opStack.PushInt(frame.GetLocalTableIntAt(2))
 		case bcode.Iload3:
-			frame.opStack.Push(frame.localVariablesTable[3])
+			frame.opStack.PushInt(frame.GetLocalTableIntAt(3))
 
 		case bcode.Aload:
 			index := codeAttr.Code[frame.pc + 1]
 			frame.pc++
 
-			frame.opStack.Push(frame.localVariablesTable[index])
+			frame.opStack.Push(frame.getLocalTableAt(int(index)))
 		case bcode.Aload0:
 			// 将第一个引用类型本地变量推送至栈顶
 			ref := frame.GetLocalTableObjectAt(0)
@@ -348,8 +558,8 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			idx := codeAttr.Code[frame.pc + 1]
 			frame.pc++
 
-			val, _ := frame.opStack.Pop()
-			frame.localVariablesTable[idx] = val
+			val, _ := frame.opStack.PopInt()
+			frame.setLocalTableIntAt(int(idx), val)
 
 		case bcode.Astore:
 			idx := codeAttr.Code[frame.pc + 1]
@@ -372,55 +582,56 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			ref, _ := frame.opStack.Pop()
 			frame.localVariablesTable[3] = ref
 
-		case bcode.Iastore:
-			// 在int数组中存储元素
-			// stack: arrayref, index, value →
-			val, _ := frame.opStack.PopInt()
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-
-			arrRef.Array.Data[arrIndex] = val
-
-		case bcode.Aastore:
-			// 在数组中保存引用类型
-			// stack: arrayref, index, value →
-			val, _ := frame.opStack.Pop()
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-
-			// todo 检查要保存的引用类型跟数组声明类型是否相符, 暂不实现
-			// 保存
-			arrRef.Array.Data[arrIndex] = val
-
+		case bcode.Iastore, bcode.Lastore, bcode.Fastore, bcode.Dastore, bcode.Aastore, bcode.Bastore, bcode.Castore, bcode.Sastore:
+			err := i.bcodeArrayStore(def, frame, codeAttr, byteCode)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
 
-		case bcode.Castore:
-			// Store into char array
-			// stack: arrayref, index, value →
-			val, _ := frame.opStack.Pop()
-			arrIndex, _ := frame.opStack.PopInt()
-			arrRef, _ := frame.opStack.PopReference()
-			arrRef.Array.Data[arrIndex] = val
+				return nil, fmt.Errorf("failed to execute '%s': %w", bcode.ToName(byteCode), err)
+			}
 
 		case bcode.Pop:
 			frame.opStack.Pop()
 
+		case bcode.Ldc2W:
+			// 将long或double常量值从常量池中推送至栈顶, 在操作数栈中占一个位置
+			// format: ldc2_w indexbyte1 indexbyte2
+			err := i.bcodeLdc2W(def, frame, codeAttr)
+			if nil != err {
+				return nil, fmt.Errorf("failed to execute 'ldc2_w': %w", err)
+			}
+
+		case bcode.LdcW:
+			// 与ldc相同, 常量池下标为两个字节, 用于下标超过255的常量
+			// format: ldc_w indexbyte1 indexbyte2
+			index := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1 : frame.pc + 3])
+			frame.pc += 2
+			err := i.bcodeLdc(def, frame, index)
+			if nil != err {
+				return nil, fmt.Errorf("failed to execute 'ldc_w': %w", err)
+			}
+
 		case bcode.Ldc:
 			// 将int、float或String类型常量值从常量池中推送至栈顶
-			// format: ldc byte
-			err := i.bcodeLdc(def, frame, codeAttr)
+			// format: ldc index
+			index := uint16(codeAttr.Code[frame.pc + 1])
+			frame.pc++
+			err := i.bcodeLdc(def, frame, index)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ldc': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ldc': %w", err)
 			}
 
 			//// 取出常量池数据项
-			//strConst := def.ConstPool[codeAttr.Code[frame.pc + 1]].(*class.StringInfoConst)
+			//strConst := def.ConstPool.At(uint16(codeAttr.Code[frame.pc + 1])).(*class.StringInfoConst)
 			//frame.pc++
 			//// 取出string字面值
-			//strVal := def.ConstPool[strConst.StringIndex].(*class.Utf8InfoConst).String()
+			//strVal := def.ConstPool.At(strConst.StringIndex).(*class.Utf8InfoConst).String()
 			//
 			//strRef, err := class.NewStringObject([]rune(strVal), i.miniJvm.MethodArea)
 			//if nil != err {
-			//	return fmt.Errorf("failed to execute 'ldc':%w", err)
+			//	return nil, fmt.Errorf("failed to execute 'ldc':%w", err)
 			//}
 			//
 			//// 入栈
@@ -429,20 +640,77 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 
 		case bcode.Dup:
 			// 复制栈顶数值并将复制值压入栈顶
-			top, _ := frame.opStack.GetTop()
-			frame.opStack.Push(top)
+			frame.opStack.Dup()
+
+		// long和double是第二类值, JVM规范中占两个字, 在这里的操作数栈中只占一个位置,
+		// 所以下面几条指令按栈中值的类型选择规范中的形式
+		case bcode.DupX1:
+			// ..., value2, value1 → ..., value1, value2, value1
+			frame.opStack.DupX(1, 2)
+
+		case bcode.DupX2:
+			// ..., value3, value2, value1 → ..., value1, value3, value2, value1
+			// value2为第二类值时: ..., value2, value1 → ..., value1, value2, value1
+			if frame.opStack.isCategory2(1) {
+				frame.opStack.DupX(1, 2)
+			} else {
+				frame.opStack.DupX(1, 3)
+			}
+
+		case bcode.Dup2:
+			// ..., value2, value1 → ..., value2, value1, value2, value1
+			// value1为第二类值时: ..., value → ..., value, value
+			if frame.opStack.isCategory2(0) {
+				frame.opStack.Dup()
+			} else {
+				frame.opStack.DupX(2, 2)
+			}
+
+		case bcode.Dup2X1:
+			// ..., value3, value2, value1 → ..., value2, value1, value3, value2, value1
+			// value1为第二类值时: ..., value2, value1 → ..., value1, value2, value1
+			if frame.opStack.isCategory2(0) {
+				frame.opStack.DupX(1, 2)
+			} else {
+				frame.opStack.DupX(2, 3)
+			}
+
+		case bcode.Dup2X2:
+			// ..., value4, value3, value2, value1 → ..., value2, value1, value4, value3, value2, value1
+			// 按value1和其下面的值是否为第二类值, 共有四种形式
+			switch {
+			case frame.opStack.isCategory2(0) && frame.opStack.isCategory2(1):
+				frame.opStack.DupX(1, 2)
+			case frame.opStack.isCategory2(0):
+				frame.opStack.DupX(1, 3)
+			case frame.opStack.isCategory2(2):
+				frame.opStack.DupX(2, 3)
+			default:
+				frame.opStack.DupX(2, 4)
+			}
+
+		case bcode.Pop2:
+			// 弹出一个第二类值或者两个第一类值
+			if !frame.opStack.isCategory2(0) {
+				frame.opStack.Pop()
+			}
+			frame.opStack.Pop()
+
+		case bcode.Swap:
+			// ..., value2, value1 → ..., value1, value2, 两个都是第一类值
+			frame.opStack.Swap()
 
 		case bcode.Iadd:
 			// 取出栈顶2元素，相加，入栈
 			op1, _ := frame.opStack.PopInt()
 			op2, _ := frame.opStack.PopInt()
 			sum := op1 + op2
-			frame.opStack.Push(sum)
+			frame.opStack.PushInt(sum)
 
 		case bcode.Bipush:
 			// 将单字节的常量值(-128~127)推送至栈顶
 			num := int8(codeAttr.Code[frame.pc + 1])
-			frame.opStack.Push(int(num))
+			frame.opStack.PushInt(int(num))
 			frame.pc++
 
 		case bcode.Sipush:
@@ -453,10 +721,10 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var op int16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &op)
 			if nil != err {
-				return fmt.Errorf("failed to read offset for sipush: %w", err)
+				return nil, fmt.Errorf("failed to read offset for sipush: %w", err)
 			}
 
-			frame.opStack.Push(int(op))
+			frame.opStack.PushInt(int(op))
 
 		case bcode.Ifle:
 			// 当栈顶int型数值小于等于0时跳转
@@ -465,7 +733,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ifle': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ifle': %w", err)
 			}
 		case bcode.Iflt:
 			// 当栈顶int型数值小于0时跳转
@@ -474,7 +742,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'iflt': %w", err)
+				return nil, fmt.Errorf("failed to execute 'iflt': %w", err)
 			}
 		case bcode.Ifge:
 			// >= 0
@@ -483,7 +751,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ifge': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ifge': %w", err)
 			}
 		case bcode.Ifgt:
 			// > 0
@@ -492,7 +760,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ifgt': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ifgt': %w", err)
 			}
 		case bcode.Ifne:
 			// != 0
@@ -501,7 +769,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ifne': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ifne': %w", err)
 			}
 		case bcode.Ifeq:
 			// == 0
@@ -510,7 +778,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			})
 
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ifeq': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ifeq': %w", err)
 			}
 
 		case bcode.Ificmpgt:
@@ -519,7 +787,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 - op1 > 0
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmpgt': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmpgt': %w", err)
 			}
 		case bcode.Ificmple:
 			// 比较栈顶两int型数值大小, 当结果<=0时跳转
@@ -528,7 +796,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 - op1 <= 0
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmple': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmple': %w", err)
 			}
 		case bcode.Ificmplt:
 			// 比较栈顶两int型数值大小, 当结果小于0时跳转
@@ -536,7 +804,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 - op1 < 0
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmplt': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmplt': %w", err)
 			}
 		case bcode.Ificmpge:
 			// 比较栈顶两int型数值大小, 当结果大于等于0时跳转
@@ -544,7 +812,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 - op1 >= 0
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmpge': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmpge': %w", err)
 			}
 		case bcode.Ificmpeq:
 			// 比较栈顶两int型数值大小, 当结果等于0时跳转
@@ -552,7 +820,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 - op1 == 0
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmpeq': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmpeq': %w", err)
 			}
 		case bcode.Ificmpne:
 			// 比较栈顶两int型数值大小, 当结果!=0时跳转
@@ -560,7 +828,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				return op2 != op1
 			})
 			if nil != err {
-				return fmt.Errorf("failed to execute 'ificmpne': %w", err)
+				return nil, fmt.Errorf("failed to execute 'ificmpne': %w", err)
 			}
 		case bcode.Ifacmpne:
 			// 比较栈顶两个引用不相等, 不相等就跳转
@@ -572,7 +840,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var offset int16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
 			if nil != err {
-				return fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
+				return nil, fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
 			}
 
 			if x != y {
@@ -592,16 +860,52 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var offset int16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
 			if nil != err {
-				return fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
+				return nil, fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
+			}
+
+			if !isNullReference(x) {
+				frame.pc = frame.pc + int(offset) - 1
+
+			} else {
+				frame.pc += 2
+			}
+
+		case bcode.Ifnull:
+			// Operand Stack
+			//..., value →
+			x, _ := frame.opStack.Pop()
+
+			// 跳转的偏移量
+			twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
+			var offset int16
+			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
+			if nil != err {
+				return nil, fmt.Errorf("failed to read offset for ifnull: %w", err)
 			}
 
-			if !reflect.ValueOf(x).IsNil() {
+			if isNullReference(x) {
 				frame.pc = frame.pc + int(offset) - 1
 
 			} else {
 				frame.pc += 2
 			}
 
+		case bcode.Checkcast:
+			err := i.bcodeCheckcast(def, frame, codeAttr)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'checkcast': %w", err)
+			}
+
+		case bcode.Instanceof:
+			err := i.bcodeInstanceof(def, frame, codeAttr)
+			if nil != err {
+				return nil, fmt.Errorf("failed to execute 'instanceof': %w", err)
+			}
+
 		case bcode.Ifacmpeq:
 			// 比较栈顶两个引用相等, 相等就跳转
 			x, _ := frame.opStack.Pop()
@@ -612,7 +916,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var offset int16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
 			if nil != err {
-				return fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
+				return nil, fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
 			}
 
 			if x == y {
@@ -630,26 +934,255 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			val1, _ := frame.opStack.PopInt()
 			val := val1 - val2
 
-			frame.opStack.Push(val)
+			frame.opStack.PushInt(val)
 
-		case bcode.Ishl:
-			// Operand Stack
-			//..., value1, value2 →
-			//
-			//..., result
+		case bcode.Imul:
+			// 结果按int溢出回绕
+			val2, _ := frame.opStack.PopInt()
+			val1, _ := frame.opStack.PopInt()
+			frame.opStack.PushInt(int(int32(val1) * int32(val2)))
 
-			// Both value1 and value2 must be of type int.
-			// The values are popped from the operand stack.
-			// An int result is calculated by shifting value1 left by s bit positions,
-			// where s is the value of the low 5 bits of value2.
-			// The result is pushed onto the operand stack.
+		case bcode.Idiv, bcode.Irem:
+			err := i.bcodeIntDivision(def, frame, codeAttr, byteCode)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute '%s': %w", bcode.ToName(byteCode), err)
+			}
+
+		case bcode.Ineg:
+			// Integer.MIN_VALUE取反仍然是Integer.MIN_VALUE
+			val, _ := frame.opStack.PopInt()
+			frame.opStack.PushInt(int(-int32(val)))
+
+		case bcode.Ishl, bcode.Ishr, bcode.Iushr:
+			// ..., value1, value2 →
+			// 只取value2的低5位作为移动的位数, 结果按int回绕; iushr按无符号右移, 高位补0
+			val2, _ := frame.opStack.PopInt()
+			val1, _ := frame.opStack.PopInt()
+			shift := uint(val2) & 0x1f
+
+			var result int32
+			switch byteCode {
+			case bcode.Ishl:
+				result = int32(val1) << shift
+			case bcode.Ishr:
+				result = int32(val1) >> shift
+			default:
+				result = int32(uint32(val1) >> shift)
+			}
+			frame.opStack.PushInt(int(result))
+
+		case bcode.Iand, bcode.Ior, bcode.Ixor:
 			val2, _ := frame.opStack.PopInt()
 			val1, _ := frame.opStack.PopInt()
 
-			shift := val2 & 0x1bb
-			val1 = val1 << shift
+			var result int32
+			switch byteCode {
+			case bcode.Iand:
+				result = int32(val1) & int32(val2)
+			case bcode.Ior:
+				result = int32(val1) | int32(val2)
+			default:
+				result = int32(val1) ^ int32(val2)
+			}
+			frame.opStack.PushInt(int(result))
+
+		case bcode.Ladd, bcode.Lsub, bcode.Lmul, bcode.Ldiv, bcode.Lrem, bcode.Land, bcode.Lor, bcode.Lxor:
+			err := i.bcodeLongArithmetic(def, frame, codeAttr, byteCode)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute '%s': %w", bcode.ToName(byteCode), err)
+			}
+
+		case bcode.Lneg:
+			val, _ := frame.opStack.PopLong()
+			frame.opStack.PushLong(-val)
+
+		case bcode.Lshl, bcode.Lshr, bcode.Lushr:
+			// ..., value1(long), value2(int) →
+			// 只取value2的低6位作为移动的位数
+			val2, _ := frame.opStack.PopInt()
+			val1, _ := frame.opStack.PopLong()
+			shift := uint(val2) & 0x3f
+
+			switch byteCode {
+			case bcode.Lshl:
+				val1 = val1 << shift
+			case bcode.Lshr:
+				val1 = val1 >> shift
+			default:
+				val1 = int64(uint64(val1) >> shift)
+			}
+			frame.opStack.PushLong(val1)
+
+		case bcode.Lcmp:
+			// ..., value1, value2 → ..., result(-1, 0, 1)
+			val2, _ := frame.opStack.PopLong()
+			val1, _ := frame.opStack.PopLong()
+
+			result := 0
+			if val1 > val2 {
+				result = 1
+			} else if val1 < val2 {
+				result = -1
+			}
+			frame.opStack.PushInt(result)
+
+		case bcode.Fconst0, bcode.Fconst1, bcode.Fconst2:
+			frame.opStack.PushFloat(float32(byteCode - bcode.Fconst0))
+
+		case bcode.Fload:
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
+
+			frame.opStack.PushFloat(frame.GetLocalTableFloatAt(index))
+		case bcode.Fload0, bcode.Fload1, bcode.Fload2, bcode.Fload3:
+			frame.opStack.PushFloat(frame.GetLocalTableFloatAt(int(byteCode - bcode.Fload0)))
+
+		case bcode.Fstore:
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
+
+			val, _ := frame.opStack.PopFloat()
+			frame.localVariablesTable[index] = val
+		case bcode.Fstore0, bcode.Fstore1, bcode.Fstore2, bcode.Fstore3:
+			val, _ := frame.opStack.PopFloat()
+			frame.localVariablesTable[byteCode - bcode.Fstore0] = val
+
+		case bcode.Fadd, bcode.Fsub, bcode.Fmul, bcode.Fdiv, bcode.Frem:
+			i.bcodeFloatArithmetic(frame, byteCode)
+
+		case bcode.Fneg:
+			val, _ := frame.opStack.PopFloat()
+			frame.opStack.PushFloat(-val)
+
+		case bcode.Fcmpl, bcode.Fcmpg:
+			// ..., value1, value2 → ..., result(-1, 0, 1)
+			// 有NaN时fcmpl压入-1, fcmpg压入1
+			val2, _ := frame.opStack.PopFloat()
+			val1, _ := frame.opStack.PopFloat()
+
+			var result int
+			switch {
+			case val1 > val2:
+				result = 1
+			case val1 == val2:
+				result = 0
+			case val1 < val2:
+				result = -1
+			case bcode.Fcmpg == byteCode:
+				result = 1
+			default:
+				result = -1
+			}
+			frame.opStack.PushInt(result)
+
+		case bcode.Dconst0, bcode.Dconst1:
+			frame.opStack.PushDouble(float64(byteCode - bcode.Dconst0))
+
+		case bcode.Dload:
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
+
+			frame.opStack.PushDouble(frame.GetLocalTableDoubleAt(index))
+		case bcode.Dload0, bcode.Dload1, bcode.Dload2, bcode.Dload3:
+			frame.opStack.PushDouble(frame.GetLocalTableDoubleAt(int(byteCode - bcode.Dload0)))
+
+		case bcode.Dstore:
+			index := readLocalIndex(frame, codeAttr, isWideStatus)
+			isWideStatus = false
+
+			val, _ := frame.opStack.PopDouble()
+			frame.setLocalTableDoubleAt(index, val)
+		case bcode.Dstore0, bcode.Dstore1, bcode.Dstore2, bcode.Dstore3:
+			val, _ := frame.opStack.PopDouble()
+			frame.setLocalTableDoubleAt(int(byteCode - bcode.Dstore0), val)
+
+		case bcode.Dadd, bcode.Dsub, bcode.Dmul, bcode.Ddiv, bcode.Drem:
+			i.bcodeDoubleArithmetic(frame, byteCode)
+
+		case bcode.Dneg:
+			val, _ := frame.opStack.PopDouble()
+			frame.opStack.PushDouble(-val)
+
+		case bcode.Dcmpl, bcode.Dcmpg:
+			// ..., value1, value2 → ..., result(-1, 0, 1)
+			// 有NaN时dcmpl压入-1, dcmpg压入1
+			val2, _ := frame.opStack.PopDouble()
+			val1, _ := frame.opStack.PopDouble()
+
+			var result int
+			switch {
+			case val1 > val2:
+				result = 1
+			case val1 == val2:
+				result = 0
+			case val1 < val2:
+				result = -1
+			case bcode.Dcmpg == byteCode:
+				result = 1
+			default:
+				result = -1
+			}
+			frame.opStack.PushInt(result)
+
+		case bcode.I2l, bcode.I2f, bcode.I2d, bcode.I2b, bcode.I2c, bcode.I2s:
+			val, _ := frame.opStack.PopInt()
+			switch byteCode {
+			case bcode.I2l:
+				frame.opStack.PushLong(int64(int32(val)))
+			case bcode.I2f:
+				frame.opStack.PushFloat(float32(int32(val)))
+			case bcode.I2d:
+				frame.opStack.PushDouble(float64(int32(val)))
+			case bcode.I2b:
+				frame.opStack.PushInt(int(int8(val)))
+			case bcode.I2c:
+				// char是无符号的
+				frame.opStack.PushInt(int(uint16(val)))
+			default:
+				frame.opStack.PushInt(int(int16(val)))
+			}
+
+		case bcode.L2i, bcode.L2f, bcode.L2d:
+			val, _ := frame.opStack.PopLong()
+			switch byteCode {
+			case bcode.L2i:
+				// 只保留低32位
+				frame.opStack.PushInt(int(int32(val)))
+			case bcode.L2f:
+				frame.opStack.PushFloat(float32(val))
+			default:
+				frame.opStack.PushDouble(float64(val))
+			}
+
+		case bcode.F2i, bcode.F2l, bcode.F2d:
+			val, _ := frame.opStack.PopFloat()
+			switch byteCode {
+			case bcode.F2i:
+				frame.opStack.PushInt(int(floatToInt32(float64(val))))
+			case bcode.F2l:
+				frame.opStack.PushLong(floatToInt64(float64(val)))
+			default:
+				frame.opStack.PushDouble(float64(val))
+			}
 
-			frame.opStack.Push(val1)
+		case bcode.D2i, bcode.D2l, bcode.D2f:
+			val, _ := frame.opStack.PopDouble()
+			switch byteCode {
+			case bcode.D2i:
+				frame.opStack.PushInt(int(floatToInt32(val)))
+			case bcode.D2l:
+				frame.opStack.PushLong(floatToInt64(val))
+			default:
+				frame.opStack.PushFloat(float32(val))
+			}
 
 		case bcode.Iinc:
 			// 将第op1个slot的变量增加op2
@@ -659,7 +1192,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				op2 := int8(codeAttr.Code[frame.pc + 2])
 				frame.pc += 2
 
-				frame.localVariablesTable[op1] = frame.GetLocalTableIntAt(int(op1)) + int(op2)
+				frame.setLocalTableIntAt(int(op1), frame.GetLocalTableIntAt(int(op1)) + int(op2))
 
 			} else {
 				// wide iinc byte1 byte2 constbyte1 constbyte2
@@ -667,7 +1200,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				var localVarIndex uint16
 				err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &localVarIndex)
 				if nil != err {
-					return fmt.Errorf("failed to read local_var_index for iinc_w: %w", err)
+					return nil, fmt.Errorf("failed to read local_var_index for iinc_w: %w", err)
 				}
 
 
@@ -675,13 +1208,13 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 				var num int16
 				err = binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &num)
 				if nil != err {
-					return fmt.Errorf("failed to read byte12 for iinc_w: %w", err)
+					return nil, fmt.Errorf("failed to read byte12 for iinc_w: %w", err)
 				}
 
 				frame.pc += 4
 
 				newVal := frame.GetLocalTableIntAt(int(localVarIndex)) + int(num)
-				frame.localVariablesTable[localVarIndex] = newVal
+				frame.setLocalTableIntAt(int(localVarIndex), newVal)
 
 				isWideStatus = false
 			}
@@ -691,11 +1224,11 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			//..., arrayref →
 			//..., length
 			arrRef, _ := frame.opStack.PopReference()
-			if nil == arrRef.Array {
-				fmt.Println("nil")
+			if nil == arrRef || nil == arrRef.Array {
+				return nil, fmt.Errorf("java.lang.NullPointerException: arraylength on null")
 			}
-			val := len(arrRef.Array.Data)
-			frame.opStack.Push(val)
+			val := arrRef.Array.Len()
+			frame.opStack.PushInt(val)
 
 
 		case bcode.New:
@@ -706,22 +1239,25 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var classCpIndex uint16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &classCpIndex)
 			if nil != err {
-				return fmt.Errorf("failed to read class_cp_index for 'new': %w", err)
+				return nil, fmt.Errorf("failed to read class_cp_index for 'new': %w", err)
 			}
 
 			// 常量池中找出引用的class信息
-			classCp := def.ConstPool[classCpIndex].(*class.ClassInfoConstInfo)
+			classCp := def.ConstPool.At(classCpIndex).(*class.ClassInfoConstInfo)
 			// 目标class全名
-			targetClassFullName := def.ConstPool[classCp.FullClassNameIndex].(*class.Utf8InfoConst).String()
+			targetClassFullName := def.ConstPool.At(classCp.FullClassNameIndex).(*class.Utf8InfoConst).String()
 			// 加载
-			targetDefClass, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+			targetDefClass, err := i.miniJvm.MethodArea.loadClassInFrame(frame, targetClassFullName)
 			if nil != err {
-				return fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
+				return nil, fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
 			}
 			// new
 			obj, err := class.NewObject(targetDefClass, i.miniJvm.MethodArea)
 			if nil != err {
-				return fmt.Errorf("failed to new object for '%s': %w", targetClassFullName, err)
+				return nil, fmt.Errorf("failed to new object for '%s': %w", targetClassFullName, err)
+			}
+			if i.miniJvm.TrackHeap {
+				i.miniJvm.heap.onAllocate(obj)
 			}
 			// 压栈
 			frame.opStack.Push(obj)
@@ -729,34 +1265,75 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 
 		case bcode.Goto:
 			// 跳转
-			twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
-			var offset int16
-			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
-			if nil != err {
-				return fmt.Errorf("failed to read pc offset for 'goto': %w", err)
-			}
+			offset := int16(binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:]))
+			frame.pc = frame.pc + int(offset) - 1
 
+		case bcode.Tableswitch:
+			// 按栈顶的int在跳转表中查找偏移量, 不在[low, high]中时跳到default
+			// format: tableswitch <0-3字节padding> default low high offsets...
+			index, _ := frame.opStack.PopInt()
+			frame.pc = frame.pc + int(tableswitchOffset(codeAttr.Code, frame.pc, int32(index))) - 1
+
+		case bcode.Lookupswitch:
+			// 在match-offset对中查找栈顶的int, 找不到时跳到default
+			// format: lookupswitch <0-3字节padding> default npairs match1 offset1 ...
+			key, _ := frame.opStack.PopInt()
+			frame.pc = frame.pc + int(lookupswitchOffset(codeAttr.Code, frame.pc, int32(key))) - 1
+
+		case bcode.GotoW:
+			// 跳转, 偏移量为4字节, 用于超过32K的方法
+			offset := int32(binary.BigEndian.Uint32(codeAttr.Code[frame.pc + 1:]))
 			frame.pc = frame.pc + int(offset) - 1
 
 		case bcode.Invokestatic:
 			// 调用静态方法
-			err := i.invokeStatic(def, frame, codeAttr)
+			callee, err := i.invokeStatic(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'invokestatic': %w", err)
+				// 没有捕获的异常原样返回, 由上层调用者查找handler
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'invokestatic': %w", err)
+			}
+			if nil != callee {
+				// 切换到被调用者的栈帧, 返回后从下一条指令继续
+				frame.callOpcode = byteCode
+				return callee, nil
 			}
 
 		case bcode.Invokespecial:
 			// 调用超类构建方法, 实例初始化方法, 私有方法
-			err := i.invokeSpecial(def, frame, codeAttr)
+			callee, err := i.invokeSpecial(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'invokespecial': %w", err)
+				// 没有捕获的异常原样返回, 由上层调用者查找handler
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'invokespecial': %w", err)
+			}
+			if nil != callee {
+				// 切换到被调用者的栈帧, 返回后从下一条指令继续
+				frame.callOpcode = byteCode
+				return callee, nil
 			}
 
 		case bcode.Invokevirtual:
 			// public method
-			err := i.invokeVirtual(def, frame, codeAttr)
+			callee, err := i.invokeVirtual(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'invokevirtual': %w", err)
+				// 没有捕获的异常原样返回, 由上层调用者查找handler
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'invokevirtual': %w", err)
+			}
+			if nil != callee {
+				// 切换到被调用者的栈帧, 返回后从下一条指令继续
+				frame.callOpcode = byteCode
+				return callee, nil
 			}
 
 		case bcode.Invokeinterface:
@@ -765,19 +1342,41 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			// indexbyte2
 			// count
 			// 0
-			err := i.invokeInterface(def, frame, codeAttr)
+			callee, err := i.invokeInterface(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'invokeinterface': %w", err)
+				// 没有捕获的异常原样返回, 由上层调用者查找handler
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'invokeinterface': %w", err)
+			}
+			if nil != callee {
+				// 切换到被调用者的栈帧, 返回后从下一条指令继续
+				frame.callOpcode = byteCode
+				return callee, nil
 			}
 
-		case bcode.Getstatic:
-			// format: getstatic byte1 byte2
-			// Operand Stack
-			// ..., →
-			// ..., value
+		case bcode.Invokedynamic:
+			// lambda和字符串拼接, 结果直接压入操作数栈, 不切换栈帧
+			err := i.invokeDynamic(def, frame, codeAttr)
+			if nil != err {
+				// 没有捕获的异常原样返回, 由上层调用者查找handler
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'invokedynamic': %w", err)
+			}
+
+		case bcode.Getstatic:
+			// format: getstatic byte1 byte2
+			// Operand Stack
+			// ..., →
+			// ..., value
 			err := i.bcodeGetStatic(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'getstatic': %w", err)
+				return nil, fmt.Errorf("failed to execute 'getstatic': %w", err)
 			}
 
 		case bcode.Putstatic:
@@ -787,7 +1386,7 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			//...
 			err := i.bcodePutStatic(def, frame, codeAttr)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'putstatic': %w", err)
+				return nil, fmt.Errorf("failed to execute 'putstatic': %w", err)
 			}
 
 
@@ -799,19 +1398,21 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var fieldRefCpIndex uint16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &fieldRefCpIndex)
 			if nil != err {
-				return fmt.Errorf("failed to read field_ref_cp_index: %w", err)
+				return nil, fmt.Errorf("failed to read field_ref_cp_index: %w", err)
 			}
 
 			// 取出引用的字段
-			fieldRef := def.ConstPool[fieldRefCpIndex].(*class.FieldRefConstInfo)
+			fieldRef := def.ConstPool.At(fieldRefCpIndex).(*class.FieldRefConstInfo)
 			// 取出字段名
-			nameAndType := def.ConstPool[fieldRef.NameAndTypeIndex].(*class.NameAndTypeConst)
-			fieldName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
+			nameAndType := def.ConstPool.At(fieldRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+			fieldName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
 
 			// 赋值
 			val, _ := frame.opStack.Pop()
 			ref, _ := frame.opStack.PopReference()
-			ref.Object.ObjectFields[fieldName].FieldValue = val
+			if !ref.Object.SetFieldValue(fieldName, val) {
+				return nil, fmt.Errorf("failed to execute 'putfield': field '%s' not found in '%s'", fieldName, ref.Object.DefFile.FullClassName)
+			}
 
 		case bcode.GetField:
 			// 获取指定对象的实例域, 并将其压入栈顶
@@ -821,21 +1422,23 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var fieldRefCpIndex uint16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &fieldRefCpIndex)
 			if nil != err {
-				return fmt.Errorf("failed to read field_ref_cp_index: %w", err)
+				return nil, fmt.Errorf("failed to read field_ref_cp_index: %w", err)
 			}
 
 			// 取出引用的字段
-			fieldRef := def.ConstPool[fieldRefCpIndex].(*class.FieldRefConstInfo)
+			fieldRef := def.ConstPool.At(fieldRefCpIndex).(*class.FieldRefConstInfo)
 			// 取出字段名
-			nameAndType := def.ConstPool[fieldRef.NameAndTypeIndex].(*class.NameAndTypeConst)
-			fieldName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
+			nameAndType := def.ConstPool.At(fieldRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+			fieldName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
 
 			// 取出引用的对象
 			targetObjRef, _ := frame.opStack.PopReference()
 
 			// 读取
-			field := targetObjRef.Object.ObjectFields[fieldName]
-			val := field.FieldValue
+			val, ok := targetObjRef.Object.GetFieldValue(fieldName)
+			if !ok {
+				return nil, fmt.Errorf("failed to execute 'getfield': field '%s' not found in '%s'", fieldName, targetObjRef.Object.DefFile.FullClassName)
+			}
 			// 压栈
 			frame.opStack.Push(val)
 
@@ -850,7 +1453,10 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 
 			arrRef, err := class.NewArray(arrLen, arrayType)
 			if nil != err {
-				return fmt.Errorf("failed to execute 'newarray': %w", err)
+				return nil, fmt.Errorf("failed to execute 'newarray': %w", err)
+			}
+			if i.miniJvm.TrackHeap {
+				i.miniJvm.heap.onAllocate(arrRef)
 			}
 
 			// 数组引用入栈
@@ -872,45 +1478,86 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			var objectRefCpIndex uint16
 			err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &objectRefCpIndex)
 			if nil != err {
-				return fmt.Errorf("failed to read field_ref_cp_index: %w", err)
+				return nil, fmt.Errorf("failed to read field_ref_cp_index: %w", err)
 			}
 
 			// 取出类型引用常量
 			// 暂时只支持class类型, 不支持interface类型
-			classInfoConst := def.ConstPool[objectRefCpIndex].(*class.ClassInfoConstInfo)
+			classInfoConst := def.ConstPool.At(objectRefCpIndex).(*class.ClassInfoConstInfo)
 			// 取出类名
-			className := def.ConstPool[classInfoConst.FullClassNameIndex].(*class.Utf8InfoConst).String()
+			className := def.ConstPool.At(classInfoConst.FullClassNameIndex).(*class.Utf8InfoConst).String()
 			// 取出数组容量
 			arrCap, _ := frame.opStack.PopInt()
 
 			// 创建数组
 			arrRef, _ := class.NewObjectArray(arrCap, className)
+			if i.miniJvm.TrackHeap {
+				i.miniJvm.heap.onAllocate(arrRef)
+			}
 			// 入栈
 			frame.opStack.Push(arrRef)
 
+		case bcode.Multianewarray:
+			err := i.bcodeMultianewarray(def, frame, codeAttr)
+			if nil != err {
+				if _, ok := err.(*ExceptionThrownError); ok {
+					return nil, err
+				}
+
+				return nil, fmt.Errorf("failed to execute 'multianewarray': %w", err)
+			}
+
 		case bcode.Athrow:
 			err := i.bcodeAthrow(def, frame, codeAttr)
 			if nil != err {
 				if _, ok := err.(*ExceptionThrownError); ok {
-					return err
+					return nil, err
 				}
 
-				return fmt.Errorf("failed to execute 'athrow': %w", err)
+				return nil, fmt.Errorf("failed to execute 'athrow': %w", err)
 			}
 
 		case bcode.Monitorenter:
-			i.bcodeMonitorEnter(def, frame, codeAttr)
+			err := i.bcodeMonitorEnter(def, frame, codeAttr)
+			if nil != err {
+				return nil, fmt.Errorf("failed to execute 'monitorenter': %w", err)
+			}
 		case bcode.Monitorexit:
-			i.bcodeMonitorExit(def, frame, codeAttr)
+			err := i.bcodeMonitorExit(def, frame, codeAttr)
+			if nil != err {
+				return nil, fmt.Errorf("failed to execute 'monitorexit': %w", err)
+			}
 
 		case bcode.Ireturn:
+			if err := checkReturnKind("ireturn", frame.returnKind, returnInt); nil != err {
+				return nil, err
+			}
 			// 当前栈出栈, 值压入上一个栈
 			op, _ := frame.opStack.PopInt()
-			lastFrame.opStack.Push(op)
+			lastFrame.opStack.PushInt(op)
+
+			exitLoop = true
+
+		case bcode.Lreturn, bcode.Freturn, bcode.Dreturn:
+			// long和double在操作数栈中只占一个位置, 本地变量表中占两个槽
+			kind := returnLong
+			if bcode.Freturn == byteCode {
+				kind = returnFloat
+			} else if bcode.Dreturn == byteCode {
+				kind = returnDouble
+			}
+			if err := checkReturnKind(bcode.ToName(byteCode), frame.returnKind, kind); nil != err {
+				return nil, err
+			}
+			val, _ := frame.opStack.Pop()
+			lastFrame.opStack.Push(val)
 
 			exitLoop = true
 
 		case bcode.Areturn:
+			if err := checkReturnKind("areturn", frame.returnKind, returnReference); nil != err {
+				return nil, err
+			}
 			// 当前栈出栈, 值压入上一个栈
 			ref, _ := frame.opStack.PopReference()
 			lastFrame.opStack.Push(ref)
@@ -918,6 +1565,9 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			exitLoop = true
 
 		case bcode.Return:
+			if err := checkReturnKind("return", frame.returnKind, returnVoid); nil != err {
+				return nil, err
+			}
 			// 返回
 			exitLoop = true
 
@@ -926,7 +1576,27 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 			isWideStatus = true
 
 		default:
-			return fmt.Errorf("unsupported byte code %s", hex.EncodeToString([]byte{byteCode}))
+			if nil == i.opcodeHandlers[byteCode] {
+				// 按策略放弃执行当前方法, 返回默认值
+				gap := &UnsupportedGap{Feature: UnsupportedOpcode, Name: bcode.ToName(byteCode), Frame: frame}
+				val, err := i.miniJvm.handleUnsupported(gap, fmt.Errorf("unsupported byte code %s", hex.EncodeToString([]byte{byteCode})))
+				if nil != err {
+					return nil, err
+				}
+				if nil == val {
+					val = defaultValueOf(frame.returnKind)
+				}
+				if nil != lastFrame {
+					if err := pushNativeReturn(lastFrame.opStack, frame.returnKind, val); nil != err {
+						return nil, fmt.Errorf("unsupported byte code %s: %w", bcode.ToName(byteCode), err)
+					}
+				}
+
+				exitLoop = true
+
+			} else if err := i.executeOpcodeHandler(frame, byteCode); nil != err {
+				return nil, err
+			}
 		}
 
 		if exitLoop {
@@ -937,115 +1607,122 @@ func (i *InterpretedExecutionEngine) executeInFrame(def *class.DefFile, codeAttr
 		frame.pc++
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (i *InterpretedExecutionEngine) invokeStatic(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+func (i *InterpretedExecutionEngine) invokeStatic(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) (*MethodStackFrame, error) {
 	twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
 	frame.pc += 2
 
 	var methodRefCpIndex uint16
 	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &methodRefCpIndex)
 	if nil != err {
-		return fmt.Errorf("failed to read method_ref_cp_index: %w", err)
+		return nil, fmt.Errorf("failed to read method_ref_cp_index: %w", err)
 	}
 
 	// 取出引用的方法
-	methodRef := def.ConstPool[methodRefCpIndex].(*class.MethodRefConstInfo)
+	methodRef := def.ConstPool.At(methodRefCpIndex).(*class.MethodRefConstInfo)
 	// 取出方法名
-	nameAndType := def.ConstPool[methodRef.NameAndTypeIndex].(*class.NameAndTypeConst)
-	methodName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
+	nameAndType := def.ConstPool.At(methodRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+	methodName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
 	// 描述符
-	descriptor := def.ConstPool[nameAndType.DescIndex].(*class.Utf8InfoConst).String()
+	descriptor := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
 	// 取出方法所在的class
-	classRef := def.ConstPool[methodRef.ClassIndex].(*class.ClassInfoConstInfo)
+	classRef := def.ConstPool.At(methodRef.ClassIndex).(*class.ClassInfoConstInfo)
 	// 取出目标class全名
-	targetClassFullName := def.ConstPool[classRef.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	targetClassFullName := def.ConstPool.At(classRef.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	// 加载
-	targetDef, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+	targetDef, err := i.miniJvm.MethodArea.resolveClassInFrame(frame, targetClassFullName)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
+	}
+	err = i.miniJvm.MethodArea.initializeMethodOwner(frame, targetDef, methodName, descriptor)
 	if nil != err {
-		return fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
+		return nil, fmt.Errorf("failed to initialize class for '%s': %w", targetClassFullName, err)
 	}
 
 	// 调用
-	return i.executeWithFrameAndExceptionAdvice(targetDef, methodName, descriptor, frame, false, codeAttr)
+	return i.executeWithFrameAndExceptionAdvice(def, targetDef, methodName, descriptor, frame, false, staticMethod, codeAttr)
 }
 
-func (i *InterpretedExecutionEngine) invokeSpecial(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+func (i *InterpretedExecutionEngine) invokeSpecial(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) (*MethodStackFrame, error) {
 	twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
 	frame.pc += 2
 
 	var methodRefCpIndex uint16
 	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &methodRefCpIndex)
 	if nil != err {
-		return fmt.Errorf("failed to read method_ref_cp_index: %w", err)
+		return nil, fmt.Errorf("failed to read method_ref_cp_index: %w", err)
 	}
 
 
 	// 取出引用的方法
-	methodRef := def.ConstPool[methodRefCpIndex].(*class.MethodRefConstInfo)
+	methodRef := def.ConstPool.At(methodRefCpIndex).(*class.MethodRefConstInfo)
 	// 取出方法名
-	nameAndType := def.ConstPool[methodRef.NameAndTypeIndex].(*class.NameAndTypeConst)
-	methodName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
+	nameAndType := def.ConstPool.At(methodRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+	methodName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
 	// 描述符
-	descriptor := def.ConstPool[nameAndType.DescIndex].(*class.Utf8InfoConst).String()
+	descriptor := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
 	// 取出方法所在的class
-	classRef := def.ConstPool[methodRef.ClassIndex].(*class.ClassInfoConstInfo)
+	classRef := def.ConstPool.At(methodRef.ClassIndex).(*class.ClassInfoConstInfo)
 	// 取出目标class全名
-	targetClassFullName := def.ConstPool[classRef.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	targetClassFullName := def.ConstPool.At(classRef.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	// 加载
-	targetDef, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+	targetDef, err := i.miniJvm.MethodArea.ResolveClass(targetClassFullName)
 	if nil != err {
-		return fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
+		return nil, fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
 	}
 
 	if "<init>" == methodName && "java/lang/String" != targetClassFullName {
 		// 忽略构造器
 		// 消耗一个引用
 		frame.opStack.PopReference()
-		return nil
+		return nil, nil
 	}
 
 	// 调用
-	return i.executeWithFrameAndExceptionAdvice(targetDef, methodName, descriptor, frame, false, codeAttr)
+	return i.executeWithFrameAndExceptionAdvice(def, targetDef, methodName, descriptor, frame, false, instanceMethod, codeAttr)
 }
 
-func (i *InterpretedExecutionEngine) invokeVirtual(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+func (i *InterpretedExecutionEngine) invokeVirtual(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) (*MethodStackFrame, error) {
 	twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
 	frame.pc += 2
 
 	var methodRefCpIndex uint16
 	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &methodRefCpIndex)
 	if nil != err {
-		return fmt.Errorf("failed to read method_ref_cp_index: %w", err)
+		return nil, fmt.Errorf("failed to read method_ref_cp_index: %w", err)
 	}
 
 	// 取出引用的方法
-	methodRef := def.ConstPool[methodRefCpIndex].(*class.MethodRefConstInfo)
+	methodRef := def.ConstPool.At(methodRefCpIndex).(*class.MethodRefConstInfo)
 	// 取出方法名
-	nameAndType := def.ConstPool[methodRef.NameAndTypeIndex].(*class.NameAndTypeConst)
-	methodName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
+	nameAndType := def.ConstPool.At(methodRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+	methodName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
 	// 描述符
-	descriptor := def.ConstPool[nameAndType.DescIndex].(*class.Utf8InfoConst).String()
+	descriptor := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
 
 	// 计算参数的个数
 	argCount := class.ParseArgCount(descriptor)
 
 	// 找到操作数栈中的引用, 此引用即为实际类型
 	// !!!如果有目标方法有参数, 则栈顶为参数而不是方法所在的实际对象，切记!!!
-	targetObjRef, _ := frame.opStack.GetObjectSkip(argCount)
+	targetObjRef, err := frame.opStack.GetReceiver(argCount)
+	if nil != err {
+		return nil, fmt.Errorf("failed to locate receiver for '%s%s': %w", methodName, descriptor, err)
+	}
 	targetDef := targetObjRef.Object.DefFile
 
 
 
 	//// 取出方法所在的class
-	//classRef := def.ConstPool[methodRef.ClassIndex].(*class.ClassInfoConstInfo)
+	//classRef := def.ConstPool.At(methodRef.ClassIndex).(*class.ClassInfoConstInfo)
 	//// 取出目标class全名
-	//targetClassFullName := def.ConstPool[classRef.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	//targetClassFullName := def.ConstPool.At(classRef.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	//// 加载
 	//targetDef, err := i.miniJvm.findDefClass(targetClassFullName)
 	//if nil != err {
-	//	return fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
+	//	return nil, fmt.Errorf("failed to load class for '%s': %w", targetClassFullName, err)
 	//}
 
 	// 取出栈顶对象引用
@@ -1053,10 +1730,10 @@ func (i *InterpretedExecutionEngine) invokeVirtual(def *class.DefFile, frame *Me
 
 
 	// 调用
-	return i.executeWithFrameAndExceptionAdvice(targetDef, methodName, descriptor, frame, true, codeAttr)
+	return i.executeWithFrameAndExceptionAdvice(def, targetDef, methodName, descriptor, frame, true, instanceMethod, codeAttr)
 }
 
-func (i *InterpretedExecutionEngine) invokeInterface(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+func (i *InterpretedExecutionEngine) invokeInterface(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) (*MethodStackFrame, error) {
 	// invokeinterface
 	// indexbyte1
 	// indexbyte2
@@ -1068,7 +1745,7 @@ func (i *InterpretedExecutionEngine) invokeInterface(def *class.DefFile, frame *
 	var interfaceConstIndex int16
 	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &interfaceConstIndex)
 	if nil != err {
-		return fmt.Errorf("failed to read interface_const_index for 'invokeinterface': %w", err)
+		return nil, fmt.Errorf("failed to read interface_const_index for 'invokeinterface': %w", err)
 	}
 
 	// 多消耗2 byte
@@ -1076,40 +1753,69 @@ func (i *InterpretedExecutionEngine) invokeInterface(def *class.DefFile, frame *
 	var nothing int16
 	err = binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &nothing)
 	if nil != err {
-		return fmt.Errorf("failed to read interface_const_index.nothing for 'invokeinterface': %w", err)
+		return nil, fmt.Errorf("failed to read interface_const_index.nothing for 'invokeinterface': %w", err)
 	}
 
 	// 移动计数器
 	frame.pc += 4
 
 	// 取出接口方法引用
-	interfaceMethodRef := def.ConstPool[interfaceConstIndex].(*class.InterfaceMethodConst)
-	nameAndType := def.ConstPool[interfaceMethodRef.NameAndTypeIndex].(*class.NameAndTypeConst)
+	interfaceMethodRef := def.ConstPool.At(uint16(interfaceConstIndex)).(*class.InterfaceMethodConst)
+	nameAndType := def.ConstPool.At(interfaceMethodRef.NameAndTypeIndex).(*class.NameAndTypeConst)
 
-	targetMethodName := def.ConstPool[nameAndType.NameIndex].(*class.Utf8InfoConst).String()
-	targetDescriptor := def.ConstPool[nameAndType.DescIndex].(*class.Utf8InfoConst).String()
+	targetMethodName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
+	targetDescriptor := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
 
-	// 出栈取出对象引用
-	ref, _ := frame.opStack.GetUntilObject()
-	return i.executeWithFrameAndExceptionAdvice(ref.Object.DefFile, targetMethodName, targetDescriptor, frame, false, codeAttr)
+	// 根据参数个数找到接收者, 不出栈
+	ref, err := frame.opStack.GetReceiver(class.ParseArgCount(targetDescriptor))
+	if nil != err {
+		return nil, fmt.Errorf("failed to locate receiver for '%s%s': %w", targetMethodName, targetDescriptor, err)
+	}
+	// 按接收者的实际类型查虚方法表, 父类中的实现和接口的default方法都在表中
+	return i.executeWithFrameAndExceptionAdvice(def, ref.Object.DefFile, targetMethodName, targetDescriptor, frame, true, instanceMethod, codeAttr)
 }
 
-func (i *InterpretedExecutionEngine) bcodeLdc(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
-	// 将int、float,String或者class从常量池中推送至栈顶
-	// format: ldc byte
+// tableswitch的跳转偏移量; 操作码之后补齐到相对方法开头4字节对齐, 指令长度已经在链接时检查过
+func tableswitchOffset(code []byte, pc int, index int32) int32 {
+	base := pc + 1 + (4 - (pc + 1) % 4) % 4
+	low := int32(binary.BigEndian.Uint32(code[base + 4:]))
+	high := int32(binary.BigEndian.Uint32(code[base + 8:]))
+	if index < low || index > high {
+		return int32(binary.BigEndian.Uint32(code[base:]))
+	}
+
+	return int32(binary.BigEndian.Uint32(code[base + 12 + 4 * int(index - low):]))
+}
 
+// lookupswitch的跳转偏移量; match按升序排列, 但链接时没有检查, 所以按顺序查找
+func lookupswitchOffset(code []byte, pc int, key int32) int32 {
+	base := pc + 1 + (4 - (pc + 1) % 4) % 4
+	npairs := int(int32(binary.BigEndian.Uint32(code[base + 4:])))
+	for ix := 0; ix < npairs; ix++ {
+		pair := base + 8 + 8 * ix
+		if int32(binary.BigEndian.Uint32(code[pair:])) == key {
+			return int32(binary.BigEndian.Uint32(code[pair + 4:]))
+		}
+	}
+
+	return int32(binary.BigEndian.Uint32(code[base:]))
+}
+
+// 将int、float,String或者class从常量池中推送至栈顶; ldc和ldc_w只是常量池下标的宽度不同,
+// 调用前已经读出下标并移动了pc
+func (i *InterpretedExecutionEngine) bcodeLdc(def *class.DefFile, frame *MethodStackFrame, index uint16) error {
 	// 取出常量池数据项
-	constItem := def.ConstPool[codeAttr.Code[frame.pc + 1]]
+	constItem := def.ConstPool.At(index)
 	var resultRef interface{}
 	switch constItem.(type) {
 	case *class.StringInfoConst:
 		// 是string类型, 构造string对象后入栈
-		strConst := def.ConstPool[codeAttr.Code[frame.pc + 1]].(*class.StringInfoConst)
-		frame.pc++
+		strConst := constItem.(*class.StringInfoConst)
 		// 取出string字面值
-		strVal := def.ConstPool[strConst.StringIndex].(*class.Utf8InfoConst).String()
+		strVal := def.ConstPool.At(strConst.StringIndex).(*class.Utf8InfoConst).String()
 
-		strRef, err := class.NewStringObject([]rune(strVal), i.miniJvm.MethodArea)
+		// 字面量从字符串常量池中取, 同一个字面量总是同一个对象
+		strRef, err := i.miniJvm.MethodArea.InternString(strVal)
 		if nil != err {
 			return fmt.Errorf("failed to execute 'ldc':%w", err)
 		}
@@ -1118,27 +1824,42 @@ func (i *InterpretedExecutionEngine) bcodeLdc(def *class.DefFile, frame *MethodS
 
 
 	case *class.ClassInfoConstInfo:
-		frame.pc++
+		// 是class类型, 取出类对应的唯一Class对象后入栈
+		classInfo := constItem.(*class.ClassInfoConstInfo)
+		className := def.ConstPool.At(classInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
 
-		// 是class类型, 构造class实例后入栈
-		classDef, err := i.miniJvm.MethodArea.LoadClass("java/lang/Class")
-		if nil != err {
-			return fmt.Errorf("failed to load java/lang/Class def:%w", err)
-		}
+		var classRef *class.Reference
+		var err error
+		if strings.HasPrefix(className, "[") {
+			// 数组类没有DefFile
+			classRef, err = i.miniJvm.MethodArea.ArrayClassObjectOf(className)
 
-		classRef, err := class.NewObject(classDef, i.miniJvm.MethodArea)
+		} else {
+			var targetDef *class.DefFile
+			targetDef, err = i.miniJvm.MethodArea.ResolveClass(className)
+			if nil == err {
+				classRef, err = i.miniJvm.MethodArea.ClassObjectOf(targetDef)
+			}
+		}
 		if nil != err {
-			return fmt.Errorf("failed to create java/lang/Class object:%w", err)
+			return fmt.Errorf("failed to execute 'ldc' for class '%s': %w", className, err)
 		}
 
 		resultRef = classRef
 
 	case *class.IntegerInfoConst:
-		frame.pc++
-
 		intConst := constItem.(*class.IntegerInfoConst)
 		resultRef = int(intConst.Bytes)
 
+	case *class.FloatConst:
+		resultRef = math.Float32frombits(constItem.(*class.FloatConst).Bytes)
+
+	case *class.LongConst, *class.DoubleConst:
+		// long和double只能用ldc2_w加载
+		return fmt.Errorf("category 2 constant %T at %d must be loaded by ldc2_w", constItem, index)
+
+	case nil:
+		return fmt.Errorf("invalid const pool index %d", index)
 
 	default:
 		return errors.New("unsupported const pool type " + reflect.TypeOf(constItem).String())
@@ -1149,66 +1870,176 @@ func (i *InterpretedExecutionEngine) bcodeLdc(def *class.DefFile, frame *MethodS
 	return nil
 }
 
+func (i *InterpretedExecutionEngine) bcodeLdc2W(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+	index := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1 : frame.pc + 3])
+	frame.pc += 2
+
+	constItem := def.ConstPool.At(index)
+	switch constItem.(type) {
+	case *class.LongConst:
+		longConst := constItem.(*class.LongConst)
+		frame.opStack.PushLong(int64(uint64(longConst.HighByte) << 32 | uint64(longConst.LowByte)))
+
+	case *class.DoubleConst:
+		doubleConst := constItem.(*class.DoubleConst)
+		bits := uint64(doubleConst.HighByte) << 32 | uint64(doubleConst.LowByte)
+		frame.opStack.PushDouble(math.Float64frombits(bits))
+
+	default:
+		return fmt.Errorf("unsupported const pool type %T at %d", constItem, index)
+	}
+
+	return nil
+}
+
 // 解释athrow指令
 func (i *InterpretedExecutionEngine) bcodeAthrow(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
-	// 栈顶一定是异常对象引用
-	ref, _ := frame.opStack.GetTopObject()
-
-	// 栈顶异常全名
-	thisExpInfo, _ := ref.Object.DefFile.ConstPool[ref.Object.DefFile.ThisClass].(*class.ClassInfoConstInfo)
-	thisExpFullName := ref.Object.DefFile.ConstPool[thisExpInfo.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	// 栈顶一定是异常对象引用, 出栈
+	ref, _ := frame.opStack.PopReference()
+	if nil == ref {
+		return fmt.Errorf("java.lang.NullPointerException: athrow with null reference")
+	}
+	i.miniJvm.stats.onExceptionThrown()
 
-	return i.athrowJumpToTargetPc(def, frame, codeAttr, thisExpFullName, ref)
+	return i.athrowJumpToTargetPc(def, frame, codeAttr, ref.Object.DefFile.FullClassName, ref)
 }
 
 // 查异常表,修改pc为需要跳转的值;
-// 如果没有找到匹配的异常，返回ExceptionThrownError
+// 找到handler时清空操作数栈, 只压入异常引用;
+// 如果没有找到匹配的异常, 当前栈帧会被丢弃, 同样清空操作数栈并返回ExceptionThrownError
 func (i *InterpretedExecutionEngine) athrowJumpToTargetPc(def *class.DefFile, frame *MethodStackFrame,
 	codeAttr *class.CodeAttr, thrownExceptionFullName string, thrownExceptionRef *class.Reference) error {
 
-	// 查异常表
-	if 0 == codeAttr.ExceptionTableLength {
-		// 没有异常表
-		return NewExceptionThrownError(thrownExceptionRef)
+	if breakpoints := i.miniJvm.ExceptionBreakpoints; nil != breakpoints {
+		if err := breakpoints.onThrow(i.miniJvm, frame, thrownExceptionRef); nil != err {
+			return err
+		}
+	}
+
+	caught, err := i.catchException(def, frame, codeAttr, thrownExceptionFullName, thrownExceptionRef)
+	if nil != err || caught {
+		return err
+	}
+
+	// 只在athrow时创建一次, 之后每一层栈帧都传递同一个对象
+	return NewExceptionThrownError(thrownExceptionRef)
+}
+
+// 在frame的异常表中查找handler, 找到时检查异常断点; 断点要求中断执行时返回错误
+func (i *InterpretedExecutionEngine) catchException(def *class.DefFile, frame *MethodStackFrame,
+	codeAttr *class.CodeAttr, thrownExceptionFullName string, thrownExceptionRef *class.Reference) (bool, error) {
+
+	// 查找handler会修改pc, 先记下异常到达的位置
+	breakpoints := i.miniJvm.ExceptionBreakpoints
+	var location *StackTraceElement
+	if nil != breakpoints && breakpoints.watches(ExceptionCatch) {
+		location = frame.stackTraceElement()
+	}
+
+	found, err := i.findExceptionHandler(def, frame, codeAttr, thrownExceptionFullName, thrownExceptionRef)
+	if nil != err || !found {
+		return false, err
+	}
+	if nil != location {
+		if err := breakpoints.onCatch(i.miniJvm, frame, location, thrownExceptionRef); nil != err {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// 由虚拟机抛出java异常: 创建异常对象并调用<init>(String), 然后与athrow一样在当前pc查异常表;
+// 异常类无法加载时(如classpath中没有rt.jar)退回为"类名: message"形式的go错误
+func (i *InterpretedExecutionEngine) throwJavaException(def *class.DefFile, frame *MethodStackFrame,
+	codeAttr *class.CodeAttr, exceptionClassName string, message string) error {
+
+	exceptionRef, err := newJavaException(i.miniJvm, frame, exceptionClassName, message)
+	if nil != err {
+		return err
+	}
+	i.miniJvm.stats.onExceptionThrown()
+
+	return i.athrowJumpToTargetPc(def, frame, codeAttr, exceptionClassName, exceptionRef)
+}
+
+// 创建异常对象并调用<init>(String); 本地方法返回NewExceptionThrownError(ref)即可在调用者中抛出.
+// 异常类无法加载时返回"类名: message"形式的go错误
+func newJavaException(jvm *MiniJvm, frame *MethodStackFrame, exceptionClassName string, message string) (*class.Reference, error) {
+	exceptionDef, err := jvm.MethodArea.loadClassInFrame(frame, exceptionClassName)
+	if nil != err {
+		return nil, fmt.Errorf("%s: %s", strings.ReplaceAll(exceptionClassName, "/", "."), message)
+	}
+	exceptionRef, err := class.NewObject(exceptionDef, jvm.MethodArea)
+	if nil != err {
+		return nil, fmt.Errorf("failed to create %s: %w", exceptionClassName, err)
+	}
+	messageRef, err := class.NewStringObject([]rune(message), jvm.MethodArea)
+	if nil != err {
+		return nil, fmt.Errorf("failed to create java/lang/String object:%w", err)
+	}
+
+	// 辅助栈帧只用来传递参数, 不出现在调用栈中
+	helper := &MethodStackFrame{
+		opStack:   NewOpStack(2),
+		depth:     frame.depth,
+		prevFrame: frame,
+	}
+	helper.opStack.Push(exceptionRef)
+	helper.opStack.Push(messageRef)
+	err = jvm.ExecutionEngine.ExecuteWithFrame(exceptionDef, "<init>", "(Ljava/lang/String;)V", helper, false)
+	if nil != err {
+		return nil, fmt.Errorf("failed to construct %s: %w", exceptionClassName, err)
 	}
 
-	// 遍历异常表
+	return exceptionRef, nil
+}
+
+// 与athrowJumpToTargetPc相同, 没有找到handler时返回false, 不分配内存;
+// catch的类型是抛出的异常本身或者它的父类时匹配, 加载父类失败时返回错误
+func (i *InterpretedExecutionEngine) findExceptionHandler(def *class.DefFile, frame *MethodStackFrame,
+	codeAttr *class.CodeAttr, thrownExceptionFullName string, thrownExceptionRef *class.Reference) (bool, error) {
+
+	// 遍历异常表, 按表中顺序匹配, 内层try块的表项在前
 	for _, expTable := range codeAttr.ExceptionTable {
-		// 确保当前pc是在范围内
-		if frame.pc < int(expTable.StartPc) || frame.pc > int(expTable.EndPc) {
+		// 确保当前pc是在范围内, 范围是[StartPc, EndPc), 不包括EndPc
+		if frame.pc < int(expTable.StartPc) || frame.pc >= int(expTable.EndPc) {
 			continue
 		}
 
-		if 0 == expTable.CatchType {
-			// 没有catch语句, 直接跳转pc
-			frame.pc = int(expTable.HandlerPc) - 1
-			// 清空栈
-			frame.opStack.Clean()
-			// 将异常引用压回
-			frame.opStack.Push(thrownExceptionRef)
-			return nil
-		}
+		// CatchType为0时没有catch语句(finally), 匹配所有异常
+		if 0 != expTable.CatchType {
+			// 取出目标异常类型
+			targetExpInfo := def.ConstPool.At(expTable.CatchType).(*class.ClassInfoConstInfo)
+			// 目标异常全名
+			targetExpFullName := def.ConstPool.At(targetExpInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
 
-		// 取出目标异常类型
-		targetExpInfo := def.ConstPool[expTable.CatchType].(*class.ClassInfoConstInfo)
-		// 目标异常全名
-		targetExpFullName := def.ConstPool[targetExpInfo.FullClassNameIndex].(*class.Utf8InfoConst).String()
+			// 判断跟栈顶异常是否匹配, catch父类也可以捕获子类异常
+			if targetExpFullName != thrownExceptionFullName {
+				isSubClass, err := i.miniJvm.MethodArea.IsSubClassOf(thrownExceptionRef.Object.DefFile, targetExpFullName)
+				if nil != err {
+					frame.opStack.Clean()
+					return false, fmt.Errorf("failed to match exception handler '%s': %w", targetExpFullName, err)
+				}
+				if !isSubClass {
+					continue
+				}
+			}
+		}
 
-		// 判断跟栈顶异常是否匹配
-		if targetExpFullName == thrownExceptionFullName {
-			// 修改pc实现跳转
-			frame.pc = int(expTable.HandlerPc) - 1
-			// 清空栈
-			frame.opStack.Clean()
-			// 将异常引用压回
-			frame.opStack.Push(thrownExceptionRef)
+		// 修改pc实现跳转
+		frame.pc = int(expTable.HandlerPc) - 1
+		// 清空栈
+		frame.opStack.Clean()
+		// 将异常引用压回
+		frame.opStack.Push(thrownExceptionRef)
 
-			return nil
-		}
+		return true, nil
 	}
 
 	// 异常表中没找到跑出的异常
-	return NewExceptionThrownError(thrownExceptionRef)
+	frame.opStack.Clean()
+	return false, nil
 }
 
 // 读取static字段
@@ -1228,26 +2059,40 @@ func (i *InterpretedExecutionEngine) bcodeGetStatic(def *class.DefFile, frame *M
 	frame.pc += 2
 
 	// 静态字段cp信息
-	fieldInfo := def.ConstPool[fieldCpIndex].(*class.FieldRefConstInfo)
+	fieldInfo := def.ConstPool.At(uint16(fieldCpIndex)).(*class.FieldRefConstInfo)
 	// 取出字段所属class
-	targetClassInfo := def.ConstPool[fieldInfo.ClassIndex].(*class.ClassInfoConstInfo)
+	targetClassInfo := def.ConstPool.At(fieldInfo.ClassIndex).(*class.ClassInfoConstInfo)
 	// 目标class全名
-	targetClassFullName := def.ConstPool[targetClassInfo.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	targetClassFullName := def.ConstPool.At(targetClassInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	// 加载
-	targetClassDef, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+	targetClassDef, err := i.miniJvm.MethodArea.resolveClassInFrame(frame, targetClassFullName)
 	if nil != err {
 		return fmt.Errorf("failed to load target class '%s':%w", targetClassFullName, err)
 	}
 
 	// 字段nameAndType
-	nameAndTypeInfo := def.ConstPool[fieldInfo.NameAndTypeIndex].(*class.NameAndTypeConst)
-	fieldName := def.ConstPool[nameAndTypeInfo.NameIndex].(*class.Utf8InfoConst).String()
-	// fieldDesc := def.ConstPool[nameAndTypeInfo.DescIndex].(*class.Utf8InfoConst).String()
+	nameAndTypeInfo := def.ConstPool.At(fieldInfo.NameAndTypeIndex).(*class.NameAndTypeConst)
+	fieldName := def.ConstPool.At(nameAndTypeInfo.NameIndex).(*class.Utf8InfoConst).String()
+	// fieldDesc := def.ConstPool.At(nameAndTypeInfo.DescIndex).(*class.Utf8InfoConst).String()
+
+	// 字段可能声明在父类或接口中
+	ownerDef, err := i.miniJvm.MethodArea.ResolveStaticField(targetClassDef, fieldName)
+	if nil != err {
+		return fmt.Errorf("failed to execute 'getstatic': %w", err)
+	}
+	// 只初始化声明字段的类
+	err = i.miniJvm.MethodArea.initializeClass(frame, ownerDef)
+	if nil != err {
+		return fmt.Errorf("failed to execute 'getstatic': %w", err)
+	}
 
-	// 查找目标字段
-	objectField := targetClassDef.ParsedStaticFields[fieldName]
+	// 读取字段值, 与getfield一样压入值本身而不是ObjectField
+	val, ok := ownerDef.GetStaticFieldValue(fieldName)
+	if !ok {
+		return fmt.Errorf("failed to execute 'getstatic': field '%s' not found in '%s'", fieldName, ownerDef.FullClassName)
+	}
 	// 压栈
-	frame.opStack.Push(objectField)
+	frame.opStack.Push(val)
 
 	return nil
 }
@@ -1264,46 +2109,291 @@ func (i *InterpretedExecutionEngine) bcodePutStatic(def *class.DefFile, frame *M
 	frame.pc += 2
 
 	// 静态字段cp信息
-	fieldInfo := def.ConstPool[fieldCpIndex].(*class.FieldRefConstInfo)
+	fieldInfo := def.ConstPool.At(uint16(fieldCpIndex)).(*class.FieldRefConstInfo)
 	// 取出字段所属class
-	targetClassInfo := def.ConstPool[fieldInfo.ClassIndex].(*class.ClassInfoConstInfo)
+	targetClassInfo := def.ConstPool.At(fieldInfo.ClassIndex).(*class.ClassInfoConstInfo)
 	// 目标class全名
-	targetClassFullName := def.ConstPool[targetClassInfo.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	targetClassFullName := def.ConstPool.At(targetClassInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	// 加载
-	targetClassDef, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+	targetClassDef, err := i.miniJvm.MethodArea.resolveClassInFrame(frame, targetClassFullName)
 	if nil != err {
 		return fmt.Errorf("failed to load target class '%s':%w", targetClassFullName, err)
 	}
 
 	// 字段nameAndType
-	nameAndTypeInfo := def.ConstPool[fieldInfo.NameAndTypeIndex].(*class.NameAndTypeConst)
-	fieldName := def.ConstPool[nameAndTypeInfo.NameIndex].(*class.Utf8InfoConst).String()
-	// fieldDesc := def.ConstPool[nameAndTypeInfo.DescIndex].(*class.Utf8InfoConst).String()
+	nameAndTypeInfo := def.ConstPool.At(fieldInfo.NameAndTypeIndex).(*class.NameAndTypeConst)
+	fieldName := def.ConstPool.At(nameAndTypeInfo.NameIndex).(*class.Utf8InfoConst).String()
+	// fieldDesc := def.ConstPool.At(nameAndTypeInfo.DescIndex).(*class.Utf8InfoConst).String()
+
 
+	// 字段可能声明在父类或接口中
+	ownerDef, err := i.miniJvm.MethodArea.ResolveStaticField(targetClassDef, fieldName)
+	if nil != err {
+		return fmt.Errorf("failed to execute 'putstatic': %w", err)
+	}
+	// 只初始化声明字段的类
+	err = i.miniJvm.MethodArea.initializeClass(frame, ownerDef)
+	if nil != err {
+		return fmt.Errorf("failed to execute 'putstatic': %w", err)
+	}
 
 	// 出栈
 	val, _ := frame.opStack.Pop()
 
 	// set字段
-	targetClassDef.ParsedStaticFields[fieldName] = class.NewObjectField(val)
+	if !ownerDef.SetStaticFieldValue(fieldName, val) {
+		return fmt.Errorf("failed to execute 'putstatic': field '%s' not found in '%s'", fieldName, ownerDef.FullClassName)
+	}
 
 	return nil
 }
 
 func (i *InterpretedExecutionEngine) bcodeMonitorEnter(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
 	ref, _ := frame.opStack.PopReference()
-	ref.Monitor.Lock()
-
-	return nil
+	if nil == ref {
+		return fmt.Errorf("java.lang.NullPointerException: monitorenter with null reference")
+	}
+	return frame.enterMonitor(i.miniJvm.hostContext(), &ref.Monitor)
 }
 
 func (i *InterpretedExecutionEngine) bcodeMonitorExit(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
 	ref, _ := frame.opStack.PopReference()
-	ref.Monitor.Unlock()
+	if nil == ref {
+		return fmt.Errorf("java.lang.NullPointerException: monitorexit with null reference")
+	}
+
+	return frame.exitMonitor(&ref.Monitor)
+}
+
+// 读写数组元素前检查: arrayref为null时抛出java/lang/NullPointerException,
+// 下标越界时抛出java/lang/ArrayIndexOutOfBoundsException; 返回false时异常已经抛出, 被当前方法捕获时error为nil
+func (i *InterpretedExecutionEngine) checkArrayAccess(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr,
+	arrRef *class.Reference, index int) (bool, error) {
+
+	if nil == arrRef || nil == arrRef.Array {
+		return false, i.throwJavaException(def, frame, codeAttr, "java/lang/NullPointerException", "")
+	}
+	if length := arrRef.Array.Len(); index < 0 || index >= length {
+		message := fmt.Sprintf("Index %d out of bounds for length %d", index, length)
+		return false, i.throwJavaException(def, frame, codeAttr, "java/lang/ArrayIndexOutOfBoundsException", message)
+	}
+
+	return true, nil
+}
+
+// iaload, laload, faload, daload, aaload, baload, caload, saload
+// ..., arrayref, index → ..., value
+// long和double与其他值一样在操作数栈中占一个位置
+func (i *InterpretedExecutionEngine) bcodeArrayLoad(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr, byteCode byte) error {
+	arrIndex, _ := frame.opStack.PopInt()
+	arrRef, _ := frame.opStack.PopReference()
+	if ok, err := i.checkArrayAccess(def, frame, codeAttr, arrRef, arrIndex); !ok {
+		return err
+	}
+
+	val := arrRef.Array.Load(arrIndex)
+	switch byteCode {
+	case bcode.Laload:
+		frame.opStack.PushLong(toInt64(val))
+	case bcode.Faload:
+		frame.opStack.PushFloat(toFloat32(val))
+	case bcode.Daload:
+		frame.opStack.PushDouble(toFloat64(val))
+	case bcode.Baload, bcode.Saload:
+		// 符号扩展成int, byte[]的元素在Load时已经符号扩展, 本地方法写入boolean[]的元素可能是bool
+		frame.opStack.Push(numericValue(val))
+	default:
+		frame.opStack.Push(val)
+	}
+
+	return nil
+}
+
+// iastore, lastore, fastore, dastore, aastore, bastore, castore, sastore
+// ..., arrayref, index, value →
+func (i *InterpretedExecutionEngine) bcodeArrayStore(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr, byteCode byte) error {
+	var val interface{}
+	switch byteCode {
+	case bcode.Lastore:
+		val, _ = frame.opStack.PopLong()
+	case bcode.Fastore:
+		val, _ = frame.opStack.PopFloat()
+	case bcode.Dastore:
+		val, _ = frame.opStack.PopDouble()
+	case bcode.Aastore, bcode.Castore:
+		val, _ = frame.opStack.Pop()
+	default:
+		val, _ = frame.opStack.PopInt()
+	}
+	arrIndex, _ := frame.opStack.PopInt()
+	arrRef, _ := frame.opStack.PopReference()
+	if ok, err := i.checkArrayAccess(def, frame, codeAttr, arrRef, arrIndex); !ok {
+		return err
+	}
+
+	switch {
+	case bcode.Sastore == byteCode:
+		// 截断成低16位
+		arrRef.Array.Store(arrIndex, int(int16(val.(int))))
+	case bcode.Bastore == byteCode && atype.Boolean == arrRef.Array.Type:
+		// boolean[]只保留最低位
+		arrRef.Array.Store(arrIndex, val.(int) & 1)
+	case bcode.Bastore == byteCode:
+		// byte[]截断成低8位
+		arrRef.Array.Store(arrIndex, int(int8(val.(int))))
+	default:
+		// todo aastore检查要保存的引用类型跟数组声明类型是否相符, 暂不实现
+		arrRef.Array.Store(arrIndex, val)
+	}
+
+	return nil
+}
+
+// idiv, irem
+// ..., value1, value2 → ..., result
+// 除数为0时抛出java/lang/ArithmeticException, 与athrow一样先查当前方法的异常表
+func (i *InterpretedExecutionEngine) bcodeIntDivision(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr, byteCode byte) error {
+	val2, _ := frame.opStack.PopInt()
+	val1, _ := frame.opStack.PopInt()
+	if 0 == val2 {
+		return i.throwJavaException(def, frame, codeAttr, "java/lang/ArithmeticException", "/ by zero")
+	}
+
+	// Integer.MIN_VALUE / -1溢出为Integer.MIN_VALUE, 余数为0, go的int32运算与java一致
+	if bcode.Idiv == byteCode {
+		frame.opStack.PushInt(int(int32(val1) / int32(val2)))
+	} else {
+		frame.opStack.PushInt(int(int32(val1) % int32(val2)))
+	}
 
 	return nil
 }
 
+// ladd, lsub, lmul, ldiv, lrem, land, lor, lxor
+// ..., value1, value2 → ..., result
+// ldiv, lrem的除数为0时与idiv一样抛出java/lang/ArithmeticException
+func (i *InterpretedExecutionEngine) bcodeLongArithmetic(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr, byteCode byte) error {
+	val2, _ := frame.opStack.PopLong()
+	val1, _ := frame.opStack.PopLong()
+
+	var result int64
+	switch byteCode {
+	case bcode.Ladd:
+		result = val1 + val2
+	case bcode.Lsub:
+		result = val1 - val2
+	case bcode.Lmul:
+		result = val1 * val2
+	case bcode.Ldiv, bcode.Lrem:
+		if 0 == val2 {
+			return i.throwJavaException(def, frame, codeAttr, "java/lang/ArithmeticException", "/ by zero")
+		}
+		// Long.MIN_VALUE / -1溢出为Long.MIN_VALUE, 余数为0, go的结果与java一致
+		if bcode.Ldiv == byteCode {
+			result = val1 / val2
+		} else {
+			result = val1 % val2
+		}
+	case bcode.Land:
+		result = val1 & val2
+	case bcode.Lor:
+		result = val1 | val2
+	case bcode.Lxor:
+		result = val1 ^ val2
+	}
+	frame.opStack.PushLong(result)
+
+	return nil
+}
+
+// fadd, fsub, fmul, fdiv, frem, 按IEEE 754计算, 除以0得到无穷大或NaN, 不抛出异常
+// ..., value1, value2 → ..., result
+func (i *InterpretedExecutionEngine) bcodeFloatArithmetic(frame *MethodStackFrame, byteCode byte) {
+	val2, _ := frame.opStack.PopFloat()
+	val1, _ := frame.opStack.PopFloat()
+
+	var result float32
+	switch byteCode {
+	case bcode.Fadd:
+		result = val1 + val2
+	case bcode.Fsub:
+		result = val1 - val2
+	case bcode.Fmul:
+		result = val1 * val2
+	case bcode.Fdiv:
+		result = val1 / val2
+	case bcode.Frem:
+		// 与java的%一样向0取整, 结果的符号与被除数相同; float64计算fmod没有误差
+		result = float32(math.Mod(float64(val1), float64(val2)))
+	}
+	frame.opStack.PushFloat(result)
+}
+
+// dadd, dsub, dmul, ddiv, drem, 与float相同按IEEE 754计算, 不抛出异常
+// ..., value1, value2 → ..., result
+func (i *InterpretedExecutionEngine) bcodeDoubleArithmetic(frame *MethodStackFrame, byteCode byte) {
+	val2, _ := frame.opStack.PopDouble()
+	val1, _ := frame.opStack.PopDouble()
+
+	var result float64
+	switch byteCode {
+	case bcode.Dadd:
+		result = val1 + val2
+	case bcode.Dsub:
+		result = val1 - val2
+	case bcode.Dmul:
+		result = val1 * val2
+	case bcode.Ddiv:
+		result = val1 / val2
+	case bcode.Drem:
+		result = math.Mod(val1, val2)
+	}
+	frame.opStack.PushDouble(result)
+}
+
+// f2i, d2i: 按java的规则向0取整, NaN为0, 超出范围时取int的最大或最小值;
+// go中超出范围的浮点数转换结果是不确定的, 需要先判断
+func floatToInt32(val float64) int32 {
+	switch {
+	case math.IsNaN(val):
+		return 0
+	case val >= math.MaxInt32:
+		return math.MaxInt32
+	case val <= math.MinInt32:
+		return math.MinInt32
+	}
+
+	return int32(val)
+}
+
+// f2l, d2l, 规则与floatToInt32相同
+func floatToInt64(val float64) int64 {
+	switch {
+	case math.IsNaN(val):
+		return 0
+	// float64(math.MaxInt64)等于2^63, 已经超出long的范围
+	case val >= math.MaxInt64:
+		return math.MaxInt64
+	case val <= math.MinInt64:
+		return math.MinInt64
+	}
+
+	return int64(val)
+}
+
+// xload, xstore的本地变量下标, 前面有wide时为两个字节
+func readLocalIndex(frame *MethodStackFrame, codeAttr *class.CodeAttr, wide bool) int {
+	if wide {
+		index := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:])
+		frame.pc += 2
+		return int(index)
+	}
+
+	index := codeAttr.Code[frame.pc + 1]
+	frame.pc++
+	return int(index)
+}
+
 func (i *InterpretedExecutionEngine) bcodeIfComp(frame *MethodStackFrame, codeAttr *class.CodeAttr, gotoJudgeFunc func(int, int) bool) error {
 	// 比较栈顶两int型数值大小
 
@@ -1311,13 +2401,8 @@ func (i *InterpretedExecutionEngine) bcodeIfComp(frame *MethodStackFrame, codeAt
 	x, _ := frame.opStack.PopInt()
 	y, _ := frame.opStack.PopInt()
 
-	// 跳转的偏移量
-	twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
-	var offset int16
-	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
-	if nil != err {
-		return fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
-	}
+	// 跳转的偏移量, 直接解码避免在循环中分配内存
+	offset := int16(binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:]))
 
 	if gotoJudgeFunc(x, y) {
 		frame.pc = frame.pc + int(offset) - 1
@@ -1332,12 +2417,7 @@ func (i *InterpretedExecutionEngine) bcodeIfComp(frame *MethodStackFrame, codeAt
 func (i *InterpretedExecutionEngine) bcodeIfCompZero(frame *MethodStackFrame, codeAttr *class.CodeAttr, gotoJudgeFunc func(int, int) bool) error {
 	// 当栈顶int型数值小于0时跳转
 	// 跳转的偏移量
-	twoByteNum := codeAttr.Code[frame.pc + 1 : frame.pc + 1 + 2]
-	var offset int16
-	err := binary.Read(bytes.NewBuffer(twoByteNum), binary.BigEndian, &offset)
-	if nil != err {
-		return fmt.Errorf("failed to read offset for if_icmpgt: %w", err)
-	}
+	offset := int16(binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:]))
 
 	op, _ := frame.opStack.PopInt()
 	if gotoJudgeFunc(op, 0) {
@@ -1351,63 +2431,237 @@ func (i *InterpretedExecutionEngine) bcodeIfCompZero(frame *MethodStackFrame, co
 }
 
 func (i *InterpretedExecutionEngine) findCodeAttr(method *class.MethodInfo) (*class.CodeAttr, error) {
-	for _, attrGeneric := range method.Attrs {
+	// native方法没有code属性;
+	// 开启LazyLink时加载类不会链接字节码, 第一次执行方法时才解码和链接
+	return linkMethod(method.DefFile, method)
+}
+
+// checkcast indexbyte1 indexbyte2
+// Operand Stack
+// ..., objectref →
+// ..., objectref
+// null可以转换成任何类型; 不能转换时抛出java.lang.ClassCastException, 可以被异常表捕获
+func (i *InterpretedExecutionEngine) bcodeCheckcast(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+	classCpIndex := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:])
+
+	top, _ := frame.opStack.GetTop()
+	ref, _ := top.(*class.Reference)
+	if nil == ref {
+		frame.pc += 2
+		return nil
+	}
+
+	classInfo := def.ConstPool.At(classCpIndex).(*class.ClassInfoConstInfo)
+	targetClassName := def.ConstPool.At(classInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+	ok, err := i.miniJvm.MethodArea.IsInstanceOf(ref, targetClassName)
+	if nil != err {
+		return fmt.Errorf("cannot check cast to '%s': %w", targetClassName, err)
+	}
+	if ok {
+		frame.pc += 2
+		return nil
+	}
+
+	// 与athrow一样, 在checkcast指令的位置查异常表
+	var sourceClassName string
+	if class.ReferanceTypeArray == ref.RefType {
+		sourceClassName = arrayDescriptor(ref.Array)
+	} else {
+		sourceClassName = ref.Object.DefFile.FullClassName
+	}
+	message := strings.ReplaceAll(sourceClassName, "/", ".") + " cannot be cast to " + strings.ReplaceAll(targetClassName, "/", ".")
+	return i.throwJavaException(def, frame, codeAttr, "java/lang/ClassCastException", message)
+}
+
+// multianewarray indexbyte1 indexbyte2 dimensions
+// Operand Stack
+// ..., count1, [count2, ...] →
+// ..., arrayref
+// 常量池中为数组类型(如[[I), 按每一维的长度递归创建数组; 长度为负数时抛出java.lang.NegativeArraySizeException
+func (i *InterpretedExecutionEngine) bcodeMultianewarray(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+	classCpIndex := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:])
+	dimensions := int(codeAttr.Code[frame.pc + 3])
+	arrayClassName := classNameAt(def, classCpIndex)
+
+	// 最后一维的长度在栈顶
+	counts := make([]int, dimensions)
+	for ix := dimensions - 1; ix >= 0; ix-- {
+		counts[ix], _ = frame.opStack.PopInt()
+	}
+	for _, count := range counts {
+		if count < 0 {
+			return i.throwJavaException(def, frame, codeAttr, "java/lang/NegativeArraySizeException", strconv.Itoa(count))
+		}
+	}
+
+	arrRef, err := class.NewMultiArray(arrayClassName, counts)
+	if nil != err {
+		return err
+	}
+	if i.miniJvm.TrackHeap {
+		i.trackMultiArray(arrRef, dimensions)
+	}
+	frame.pc += 3
+	frame.opStack.Push(arrRef)
+
+	return nil
+}
+
+// 把多维数组中每一层创建的数组都登记到堆统计中
+func (i *InterpretedExecutionEngine) trackMultiArray(arrRef *class.Reference, dimensions int) {
+	i.miniJvm.heap.onAllocate(arrRef)
+	if dimensions <= 1 {
+		return
+	}
+
+	for _, elem := range arrRef.Array.Data {
+		if sub, ok := elem.(*class.Reference); ok && nil != sub {
+			i.trackMultiArray(sub, dimensions - 1)
+		}
+	}
+}
+
+// instanceof indexbyte1 indexbyte2
+// Operand Stack
+// ..., objectref →
+// ..., result
+// 对象是目标类型(类, 接口或数组类型)的实例时压入1, 否则压入0; null压入0
+func (i *InterpretedExecutionEngine) bcodeInstanceof(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+	classCpIndex := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:])
+	frame.pc += 2
+
+	top, _ := frame.opStack.Pop()
+	ref, _ := top.(*class.Reference)
+	if nil == ref {
+		frame.opStack.PushInt(0)
+		return nil
+	}
+
+	classInfo := def.ConstPool.At(classCpIndex).(*class.ClassInfoConstInfo)
+	targetClassName := def.ConstPool.At(classInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+	ok, err := i.miniJvm.MethodArea.IsInstanceOf(ref, targetClassName)
+	if nil != err {
+		return fmt.Errorf("cannot check instance of '%s': %w", targetClassName, err)
+	}
+
+	if ok {
+		frame.opStack.PushInt(1)
+	} else {
+		frame.opStack.PushInt(0)
+	}
+	return nil
+}
+
+// 操作数栈中的值是否为null, aconst_null压入的是nil, 其他地方可能是值为nil的*class.Reference
+func isNullReference(val interface{}) bool {
+	ref, ok := val.(*class.Reference)
+	return nil == val || (ok && nil == ref)
+}
+
+// 取出方法的code属性, 没有时返回nil; 属性表在第一次使用时解码
+func findCodeAttr(method *class.MethodInfo) (*class.CodeAttr, error) {
+	attrs, err := method.Attributes()
+	if nil != err {
+		return nil, err
+	}
+
+	for _, attrGeneric := range attrs {
 		attr, ok := attrGeneric.(*class.CodeAttr)
 		if ok {
 			return attr, nil
 		}
 	}
 
-	// return nil, errors.New("no node attr in method")
-	// native方法没有code属性
 	return nil, nil
 }
 
+// 调用指令要求的方法类型
+const (
+	// 不限制, 如执行main方法和线程的run方法
+	anyMethod = iota
+	// invokestatic
+	staticMethod
+	// invokespecial, invokevirtual, invokeinterface
+	instanceMethod
+)
+
+// 方法是否满足调用指令的要求
+func matchMethodKind(method *class.MethodInfo, kind int) bool {
+	isStatic := method.AccessFlags & accflag.Static > 0
+	return anyMethod == kind || (staticMethod == kind) == isStatic
+}
+
+func newIncompatibleClassChangeError(method *class.MethodInfo, kind int) error {
+	expected := "non-static"
+	if staticMethod == kind {
+		expected = "static"
+	}
+
+	def := method.DefFile
+	return fmt.Errorf("java.lang.IncompatibleClassChangeError: expected %s method %s.%s%s", expected, def.FullClassName,
+		def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String(), def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String())
+}
+
 // 查找方法定义;
 // def: 当前class定义
 // methodName: 目标方法简单名
 // methodDescriptor: 目标方法描述符
 // queryVTable: 是否只在虚方法表中查找
-func (i *InterpretedExecutionEngine) findMethod(def *class.DefFile, methodName string, methodDescriptor string, queryVTable bool) (*class.MethodInfo, error) {
+// kind: 要求的方法类型, 只找到类型不符的同名方法时返回IncompatibleClassChangeError
+func (i *InterpretedExecutionEngine) findMethod(def *class.DefFile, methodName string, methodDescriptor string, queryVTable bool, kind int) (*class.MethodInfo, error) {
 	if queryVTable {
-		// 直接从虚方法表中查找
+		// 直接从虚方法表中查找, 虚方法表中没有static方法
 		for _, item := range def.VTable {
 			if item.MethodName == methodName && item.MethodDescriptor == methodDescriptor {
 				return item.MethodInfo, nil
 			}
 		}
 
+		// 可能是同名的static方法
+		if method, err := i.findMethod(def, methodName, methodDescriptor, false, anyMethod); nil == err && !matchMethodKind(method, kind) {
+			return nil, newIncompatibleClassChangeError(method, kind)
+		}
+
 		return nil, fmt.Errorf("method '%s' not found in VTable", methodName)
 	}
 
+	// 第一个名字和描述符匹配, 但类型不符的方法
+	var mismatched *class.MethodInfo
+
 	currentClassDef := def
 	for {
 		//className := currentClassDef.ExtractFullClassName()
 		//fmt.Println(className)
 		for _, method := range currentClassDef.Methods {
-			name := currentClassDef.ConstPool[method.NameIndex].(*class.Utf8InfoConst).String()
-			descriptor := currentClassDef.ConstPool[method.DescriptorIndex].(*class.Utf8InfoConst).String()
+			name := currentClassDef.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+			descriptor := currentClassDef.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
 			// 匹配简单名和描述符
 			if name == methodName && descriptor == methodDescriptor {
-				return method, nil
+				if matchMethodKind(method, kind) {
+					return method, nil
+				}
+
+				if nil == mismatched {
+					mismatched = method
+				}
 			}
 		}
 
-		if 0 == def.SuperClass {
+		if 0 == currentClassDef.SuperClass {
 			break
 		}
 
 		// 从父类中寻找
-		parentClassRef := currentClassDef.ConstPool[currentClassDef.SuperClass].(*class.ClassInfoConstInfo)
+		parentClassRef := currentClassDef.ConstPool.At(currentClassDef.SuperClass).(*class.ClassInfoConstInfo)
 		// 取出父类全名
-		targetClassFullName := currentClassDef.ConstPool[parentClassRef.FullClassNameIndex].(*class.Utf8InfoConst).String()
+		targetClassFullName := currentClassDef.ConstPool.At(parentClassRef.FullClassNameIndex).(*class.Utf8InfoConst).String()
 		// 查找到Exception就止步, 目前还没有支持这个class的加载
 		if "java/lang/Exception" == targetClassFullName {
 			break
 		}
 
 		// 加载父类
-		parentDef, err := i.miniJvm.MethodArea.LoadClass(targetClassFullName)
+		parentDef, err := i.miniJvm.MethodArea.ResolveClass(targetClassFullName)
 		if nil != err {
 			return nil, fmt.Errorf("failed to load superclass '%s': %w", targetClassFullName, err)
 		}
@@ -1415,14 +2669,59 @@ func (i *InterpretedExecutionEngine) findMethod(def *class.DefFile, methodName s
 		currentClassDef = parentDef
 	}
 
+	if nil != mismatched {
+		return nil, newIncompatibleClassChangeError(mismatched, kind)
+	}
 
 	return nil, fmt.Errorf("method '%s' not found", methodName)
 }
 
+// executeInFrame中已经实现了的字节码;
+// 新增字节码的case时需要同步加到这里, verify依赖此表判断程序能否运行
+var supportedByteCodes = map[byte]struct{}{
+	bcode.Aconstnull: {},
+	bcode.Iconst0: {}, bcode.Iconst1: {}, bcode.Iconst2: {}, bcode.Iconst3: {}, bcode.Iconst4: {}, bcode.Iconst5: {},
+	bcode.Bipush: {}, bcode.Sipush: {}, bcode.Ldc: {}, bcode.LdcW: {},
+	bcode.Iload: {}, bcode.Iload0: {}, bcode.Iload1: {}, bcode.Iload2: {}, bcode.Iload3: {},
+	bcode.Aload: {}, bcode.Aload0: {}, bcode.Aload1: {}, bcode.Aload2: {}, bcode.Aload3: {},
+	bcode.Iaload: {}, bcode.Laload: {}, bcode.Faload: {}, bcode.Daload: {}, bcode.Aaload: {}, bcode.Baload: {}, bcode.Caload: {}, bcode.Saload: {},
+	bcode.Istore: {}, bcode.Istore0: {}, bcode.Istore1: {}, bcode.Istore2: {}, bcode.Istore3: {},
+	bcode.Lconst0: {}, bcode.Lconst1: {}, bcode.Lload: {}, bcode.Lload0: {}, bcode.Lload1: {}, bcode.Lload2: {}, bcode.Lload3: {},
+	bcode.Lstore: {}, bcode.Lstore0: {}, bcode.Lstore1: {}, bcode.Lstore2: {}, bcode.Lstore3: {},
+	bcode.Astore: {}, bcode.Astore0: {}, bcode.Astore1: {}, bcode.Astore2: {}, bcode.Astore3: {},
+	bcode.Iastore: {}, bcode.Lastore: {}, bcode.Fastore: {}, bcode.Dastore: {}, bcode.Aastore: {}, bcode.Bastore: {}, bcode.Castore: {}, bcode.Sastore: {},
+	bcode.Pop: {}, bcode.Pop2: {}, bcode.Dup: {}, bcode.DupX1: {}, bcode.DupX2: {}, bcode.Dup2: {}, bcode.Dup2X1: {}, bcode.Dup2X2: {}, bcode.Swap: {},
+	bcode.Iadd: {}, bcode.Isub: {}, bcode.Imul: {}, bcode.Idiv: {}, bcode.Irem: {}, bcode.Ineg: {}, bcode.Iinc: {},
+	bcode.Ishl: {}, bcode.Ishr: {}, bcode.Iushr: {}, bcode.Iand: {}, bcode.Ior: {}, bcode.Ixor: {},
+	bcode.Ladd: {}, bcode.Lsub: {}, bcode.Lmul: {}, bcode.Ldiv: {}, bcode.Lrem: {}, bcode.Lneg: {},
+	bcode.Lshl: {}, bcode.Lshr: {}, bcode.Lushr: {}, bcode.Land: {}, bcode.Lor: {}, bcode.Lxor: {}, bcode.Lcmp: {},
+	bcode.I2l: {}, bcode.I2f: {}, bcode.I2d: {}, bcode.L2i: {}, bcode.L2f: {}, bcode.L2d: {}, bcode.F2i: {}, bcode.F2l: {},
+	bcode.F2d: {}, bcode.D2i: {}, bcode.D2l: {}, bcode.D2f: {}, bcode.I2b: {}, bcode.I2c: {}, bcode.I2s: {},
+	bcode.Fconst0: {}, bcode.Fconst1: {}, bcode.Fconst2: {}, bcode.Fload: {}, bcode.Fload0: {}, bcode.Fload1: {}, bcode.Fload2: {}, bcode.Fload3: {},
+	bcode.Fstore: {}, bcode.Fstore0: {}, bcode.Fstore1: {}, bcode.Fstore2: {}, bcode.Fstore3: {},
+	bcode.Fadd: {}, bcode.Fsub: {}, bcode.Fmul: {}, bcode.Fdiv: {}, bcode.Frem: {}, bcode.Fneg: {}, bcode.Fcmpl: {}, bcode.Fcmpg: {},
+	bcode.Dconst0: {}, bcode.Dconst1: {}, bcode.Dload: {}, bcode.Dload0: {}, bcode.Dload1: {}, bcode.Dload2: {}, bcode.Dload3: {},
+	bcode.Dstore: {}, bcode.Dstore0: {}, bcode.Dstore1: {}, bcode.Dstore2: {}, bcode.Dstore3: {},
+	bcode.Dadd: {}, bcode.Dsub: {}, bcode.Ddiv: {}, bcode.Dmul: {}, bcode.Drem: {}, bcode.Dneg: {}, bcode.Dcmpl: {}, bcode.Dcmpg: {}, bcode.Ldc2W: {},
+	bcode.Ifeq: {}, bcode.Ifne: {}, bcode.Iflt: {}, bcode.Ifge: {}, bcode.Ifgt: {}, bcode.Ifle: {},
+	bcode.Ificmpeq: {}, bcode.Ificmpne: {}, bcode.Ificmplt: {}, bcode.Ificmpge: {}, bcode.Ificmpgt: {}, bcode.Ificmple: {},
+	bcode.Ifacmpeq: {}, bcode.Ifacmpne: {}, bcode.Ifnull: {}, bcode.Ifnonnull: {}, bcode.Goto: {}, bcode.Tableswitch: {}, bcode.Lookupswitch: {}, bcode.GotoW: {},
+	bcode.Ireturn: {}, bcode.Lreturn: {}, bcode.Freturn: {}, bcode.Dreturn: {}, bcode.Areturn: {}, bcode.Return: {},
+	bcode.Getstatic: {}, bcode.Putstatic: {}, bcode.GetField: {}, bcode.Putfield: {},
+	bcode.Invokevirtual: {}, bcode.Invokespecial: {}, bcode.Invokestatic: {}, bcode.Invokeinterface: {}, bcode.Invokedynamic: {},
+	bcode.New: {}, bcode.Newarray: {}, bcode.Anewarray: {}, bcode.Multianewarray: {}, bcode.Arraylength: {},
+	bcode.Checkcast: {}, bcode.Instanceof: {}, bcode.Athrow: {}, bcode.Monitorenter: {}, bcode.Monitorexit: {}, bcode.Wide: {},
+}
+
+// 解释器是否已经支持此字节码
+func IsByteCodeSupported(code byte) bool {
+	_, ok := supportedByteCodes[code]
+	return ok
+}
+
 func NewInterpretedExecutionEngine(vm *MiniJvm) *InterpretedExecutionEngine {
 	return &InterpretedExecutionEngine{
-		miniJvm:     vm,
-		// methodStack: NewMethodStack(1024),
+		miniJvm: vm,
 	}
 }
 
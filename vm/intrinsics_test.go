@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestIntrinsicReplacesBytecode(t *testing.T) {
+	object := newTestClass("java/lang/Object", "", nil)
+	math := newTestClass("java/lang/Math", "java/lang/Object", nil)
+	// 故意返回0的字节码, 用来区分执行的是字节码还是intrinsic
+	addTestCodeMethod(math, "max", "(II)I", 1, 2, []byte{bcode.Iconst0, bcode.Ireturn})
+
+	ma, err := newTestMethodArea(object, math)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm := &MiniJvm{MethodArea: ma, NativeMethodTable: NewNativeMethodTable(), IntrinsicTable: newBuiltinIntrinsicTable(), stats: new(vmStats)}
+	engine := NewInterpretedExecutionEngine(jvm)
+
+	for _, c := range []struct {
+		disabled bool
+		expected int
+	}{
+		{false, 7},
+		{true, 0},
+	} {
+		jvm.DisableIntrinsics = c.disabled
+
+		frame := newMethodStackFrame(2, 0)
+		frame.opStack.Push(3)
+		frame.opStack.Push(7)
+		if err := engine.ExecuteWithFrame(math, "max", "(II)I", frame, false); nil != err {
+			t.Fatal(err)
+		}
+		if ret, _ := frame.opStack.PopInt(); c.expected != ret {
+			t.Fatalf("disabled = %v: expect %d, got %d", c.disabled, c.expected, ret)
+		}
+	}
+}
+
+func TestMathAndArraysIntrinsics(t *testing.T) {
+	if 7 != MathMaxInt(nil, nil, 3, 7) || 3 != MathMinInt(nil, nil, 3, 7) || 5 != MathAbsInt(nil, nil, -5) {
+		t.Fatal("unexpected int result")
+	}
+	if int64(-3) != MathMinLong(nil, nil, int64(-3), int64(7)) || int64(5) != MathAbsLong(nil, nil, int64(-5)) {
+		t.Fatal("unexpected long result")
+	}
+	// abs(Integer.MIN_VALUE)溢出后仍为负数
+	if -2147483648 != MathAbsInt(nil, nil, -2147483648) {
+		t.Fatal("unexpected abs(MIN_VALUE)")
+	}
+
+	arrRef, _ := class.NewArray(5, 10)
+	if nil != ArraysFill(nil, nil, arrRef, 9) {
+		t.Fatal("fill failed")
+	}
+	if nil != ArraysFillRange(nil, nil, arrRef, 1, 3, 2) {
+		t.Fatal("fill range failed")
+	}
+	for ix, expected := range []int{9, 2, 2, 9, 9} {
+		if expected != arrRef.Array.Load(ix) {
+			t.Fatalf("unexpected element %d: %v", ix, arrRef.Array.Load(ix))
+		}
+	}
+
+	if _, ok := ArraysFillRange(nil, nil, arrRef, 3, 1, 0).(error); !ok {
+		t.Fatal("fromIndex > toIndex should fail")
+	}
+	if _, ok := ArraysFillRange(nil, nil, arrRef, 0, 6, 0).(error); !ok {
+		t.Fatal("toIndex out of range should fail")
+	}
+	if _, ok := ArraysFill(nil, nil, (*class.Reference)(nil), 0).(error); !ok {
+		t.Fatal("fill(null) should fail")
+	}
+}
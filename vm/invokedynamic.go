@@ -0,0 +1,584 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 支持的引导方法所在的类
+const (
+	lambdaMetafactoryClassName = "java/lang/invoke/LambdaMetafactory"
+	stringConcatFactoryClassName = "java/lang/invoke/StringConcatFactory"
+)
+
+// MethodHandle常量的引用类型, 只支持指向方法的几种
+const (
+	refInvokeVirtual = 5
+	refInvokeStatic = 6
+	refInvokeSpecial = 7
+	refNewInvokeSpecial = 8
+	refInvokeInterface = 9
+)
+
+// altMetafactory的flags参数
+const (
+	lambdaFlagSerializable = 1
+	lambdaFlagMarkers = 2
+	lambdaFlagBridges = 4
+)
+
+// makeConcatWithConstants的recipe中代表动态参数和常量的字符
+const (
+	concatTagArg = '\u0001'
+	concatTagConst = '\u0002'
+)
+
+// 生成的lambda类的编号, 类名为"调用者$$Lambda$编号"
+var lambdaClassCounter int64
+
+// invokedynamic的调用点, 第一次执行时由引导方法链接, 之后同一条指令直接复用
+type callSite interface {
+	// 消耗操作数栈上的动态参数, 压入调用结果
+	invoke(frame *MethodStackFrame) error
+}
+
+type callSiteKey struct {
+	def   *class.DefFile
+	index uint16
+}
+
+// MethodHandle常量指向的方法
+type methodHandle struct {
+	kind       uint8
+	owner      string
+	name       string
+	descriptor string
+}
+
+func (h *methodHandle) String() string {
+	return fmt.Sprintf("%s.%s%s", h.owner, h.name, h.descriptor)
+}
+
+// format: invokedynamic indexbyte1 indexbyte2 0 0
+func (i *InterpretedExecutionEngine) invokeDynamic(def *class.DefFile, frame *MethodStackFrame, codeAttr *class.CodeAttr) error {
+	index := binary.BigEndian.Uint16(codeAttr.Code[frame.pc + 1:])
+	frame.pc += 4
+
+	key := callSiteKey{def: def, index: index}
+	site, ok := i.callSites.Load(key)
+	if !ok {
+		linked, err := i.linkCallSite(def, index)
+		if nil != err {
+			return err
+		}
+		// 多个线程同时链接时只保留先完成的
+		site, _ = i.callSites.LoadOrStore(key, linked)
+	}
+
+	err := site.(callSite).invoke(frame)
+	if exceptionErr, ok := err.(*ExceptionThrownError); ok {
+		// 拼接字符串时toString()抛出的异常在当前方法的异常表中查找handler
+		caught, catchErr := i.catchException(def, frame, codeAttr, exceptionErr.ExceptionRef.Object.DefFile.FullClassName, exceptionErr.ExceptionRef)
+		if nil != catchErr || caught {
+			return catchErr
+		}
+		return exceptionErr
+	}
+
+	return err
+}
+
+// 执行引导方法; 只支持LambdaMetafactory和StringConcatFactory, 由go实现, 不需要rt.jar中的java.lang.invoke
+func (i *InterpretedExecutionEngine) linkCallSite(def *class.DefFile, index uint16) (callSite, error) {
+	indy, ok := def.ConstPool.At(index).(*class.InvokeDynamicConst)
+	if !ok {
+		return nil, fmt.Errorf("constant #%d is not an InvokeDynamic", index)
+	}
+	nameAndType := def.ConstPool.At(indy.NameAndTypeIndex).(*class.NameAndTypeConst)
+	name := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
+	descriptor := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
+
+	bootstrap, err := bootstrapMethodOf(def, indy.BootstrapMethodAttrIndex)
+	if nil != err {
+		return nil, err
+	}
+	handle, err := methodHandleAt(def, bootstrap.MethodRef)
+	if nil != err {
+		return nil, fmt.Errorf("invalid bootstrap method #%d: %w", indy.BootstrapMethodAttrIndex, err)
+	}
+
+	switch handle.owner + "." + handle.name {
+	case lambdaMetafactoryClassName + ".metafactory", lambdaMetafactoryClassName + ".altMetafactory":
+		return i.linkLambda(def, name, descriptor, handle.name, bootstrap.Args)
+
+	case stringConcatFactoryClassName + ".makeConcatWithConstants":
+		return newConcatCallSite(i.miniJvm, def, descriptor, bootstrap.Args)
+
+	case stringConcatFactoryClassName + ".makeConcat":
+		argTypes, _ := splitMethodDescriptor(descriptor)
+		return &concatCallSite{jvm: i.miniJvm, argTypes: argTypes, recipe: strings.Repeat(string(concatTagArg), len(argTypes))}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported bootstrap method %s", handle)
+}
+
+func bootstrapMethodOf(def *class.DefFile, index uint16) (*class.BootstrapMethod, error) {
+	for _, attr := range def.Attrs {
+		if bootstrapAttr, ok := attr.(*class.BootstrapMethodsAttr); ok && int(index) < len(bootstrapAttr.Methods) {
+			return bootstrapAttr.Methods[index], nil
+		}
+	}
+
+	return nil, fmt.Errorf("bootstrap method #%d not found in %s", index, def.FullClassName)
+}
+
+func methodHandleAt(def *class.DefFile, index uint16) (*methodHandle, error) {
+	handle, ok := def.ConstPool.At(index).(*class.MethodHandleConst)
+	if !ok {
+		return nil, fmt.Errorf("constant #%d is not a MethodHandle", index)
+	}
+
+	var classIndex, nameAndTypeIndex uint16
+	switch ref := def.ConstPool.At(handle.ReferenceIndex).(type) {
+	case *class.MethodRefConstInfo:
+		classIndex, nameAndTypeIndex = ref.ClassIndex, ref.NameAndTypeIndex
+	case *class.InterfaceMethodConst:
+		classIndex, nameAndTypeIndex = ref.InterfaceClassIndex, ref.NameAndTypeIndex
+	default:
+		return nil, fmt.Errorf("MethodHandle #%d does not refer to a method", index)
+	}
+
+	nameAndType := def.ConstPool.At(nameAndTypeIndex).(*class.NameAndTypeConst)
+	return &methodHandle{
+		kind:       handle.ReferenceKind,
+		owner:      classNameAt(def, classIndex),
+		name:       def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String(),
+		descriptor: def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String(),
+	}, nil
+}
+
+func methodTypeAt(def *class.DefFile, index uint16) (string, error) {
+	methodType, ok := def.ConstPool.At(index).(*class.MethodTypeConst)
+	if !ok {
+		return "", fmt.Errorf("constant #%d is not a MethodType", index)
+	}
+
+	return def.ConstPool.At(methodType.DescriptorIndex).(*class.Utf8InfoConst).String(), nil
+}
+
+// 方法描述符中参数和返回值的完整描述符, 如(I[Ljava/lang/String;)V返回[I [Ljava/lang/String;]和V
+func splitMethodDescriptor(descriptor string) ([]string, string) {
+	end := strings.Index(descriptor, ")")
+
+	var args []string
+	for pos := 1; pos < end; {
+		start := pos
+		for '[' == descriptor[pos] {
+			pos++
+		}
+		if 'L' == descriptor[pos] {
+			pos += strings.Index(descriptor[pos:], ";")
+		}
+		pos++
+		args = append(args, descriptor[start:pos])
+	}
+
+	return args, descriptor[end + 1:]
+}
+
+// LambdaMetafactory: 生成实现函数式接口的类, 捕获的值放在arg$1, arg$2...字段中,
+// 接口方法依次压入捕获的值和自己的参数后调用实现方法;
+// 引导参数为接口方法的擦除类型, 实现方法和实例化类型, altMetafactory还有flags, 标记接口和桥接方法
+func (i *InterpretedExecutionEngine) linkLambda(caller *class.DefFile, samName string, invokedType string, factory string, args []uint16) (callSite, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("%s expects at least 3 bootstrap arguments, got %d", factory, len(args))
+	}
+	samType, err := methodTypeAt(caller, args[0])
+	if nil != err {
+		return nil, err
+	}
+	impl, err := methodHandleAt(caller, args[1])
+	if nil != err {
+		return nil, err
+	}
+
+	captured, ifaceDesc := splitMethodDescriptor(invokedType)
+	interfaces := []string{descriptorClassName(ifaceDesc)}
+	var bridges []string
+	if "altMetafactory" == factory {
+		interfaces, bridges, err = altMetafactoryOptions(caller, args[3:], interfaces)
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	name := fmt.Sprintf("%s$$Lambda$%d", caller.FullClassName, atomic.AddInt64(&lambdaClassCounter, 1))
+	b := newClassBuilder(name, "java/lang/Object")
+	b.def.AccessFlag = accflag.Final | accflag.Synthetic
+	for _, iface := range interfaces {
+		b.implements(iface)
+	}
+	for ix, desc := range captured {
+		b.field(fmt.Sprintf("arg$%d", ix + 1), desc)
+	}
+
+	err = addLambdaMethod(b, accflag.Public, samName, samType, captured, impl)
+	if nil != err {
+		return nil, fmt.Errorf("cannot implement %s%s with %s: %w", samName, samType, impl, err)
+	}
+	for _, bridge := range bridges {
+		if bridge == samType {
+			continue
+		}
+		err = addLambdaMethod(b, accflag.Public | accflag.Bridge | accflag.Synthetic, samName, bridge, captured, impl)
+		if nil != err {
+			return nil, fmt.Errorf("cannot implement bridge %s%s with %s: %w", samName, bridge, impl, err)
+		}
+	}
+
+	if err := i.miniJvm.MethodArea.DefineClass(b.def); nil != err {
+		return nil, fmt.Errorf("failed to define lambda class '%s': %w", name, err)
+	}
+
+	site := &lambdaCallSite{jvm: i.miniJvm, def: b.def, capturedCount: len(captured)}
+	if 0 == len(captured) {
+		// 不捕获值的lambda每次返回同一个对象
+		site.instance, err = site.newInstance()
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	return site, nil
+}
+
+// 解析altMetafactory在前3个参数之后的部分: flags, [标记接口数量, 接口...], [桥接方法数量, 方法类型...]
+func altMetafactoryOptions(caller *class.DefFile, args []uint16, interfaces []string) ([]string, []string, error) {
+	pos := 0
+	nextInt := func() (int, error) {
+		if pos >= len(args) {
+			return 0, fmt.Errorf("altMetafactory: missing bootstrap argument #%d", pos + 3)
+		}
+		item, ok := caller.ConstPool.At(args[pos]).(*class.IntegerInfoConst)
+		if !ok {
+			return 0, fmt.Errorf("altMetafactory: bootstrap argument #%d is not an int", pos + 3)
+		}
+		pos++
+		return int(int32(item.Bytes)), nil
+	}
+
+	flags, err := nextInt()
+	if nil != err {
+		return nil, nil, err
+	}
+	if flags & lambdaFlagSerializable > 0 {
+		interfaces = append(interfaces, "java/io/Serializable")
+	}
+	if flags & lambdaFlagMarkers > 0 {
+		count, err := nextInt()
+		if nil != err {
+			return nil, nil, err
+		}
+		if pos + count > len(args) {
+			return nil, nil, fmt.Errorf("altMetafactory: expect %d marker interfaces", count)
+		}
+		for _, index := range args[pos : pos + count] {
+			interfaces = append(interfaces, classNameAt(caller, index))
+		}
+		pos += count
+	}
+
+	var bridges []string
+	if flags & lambdaFlagBridges > 0 {
+		count, err := nextInt()
+		if nil != err {
+			return nil, nil, err
+		}
+		if pos + count > len(args) {
+			return nil, nil, fmt.Errorf("altMetafactory: expect %d bridge method types", count)
+		}
+		for _, index := range args[pos : pos + count] {
+			bridge, err := methodTypeAt(caller, index)
+			if nil != err {
+				return nil, nil, err
+			}
+			bridges = append(bridges, bridge)
+		}
+	}
+
+	return interfaces, bridges, nil
+}
+
+// 基本类型对应的包装类型和拆箱方法
+var primitiveWrappers = map[string][2]string{
+	"Z": {"java/lang/Boolean", "booleanValue"},
+	"B": {"java/lang/Byte", "byteValue"},
+	"C": {"java/lang/Character", "charValue"},
+	"S": {"java/lang/Short", "shortValue"},
+	"I": {"java/lang/Integer", "intValue"},
+	"J": {"java/lang/Long", "longValue"},
+	"F": {"java/lang/Float", "floatValue"},
+	"D": {"java/lang/Double", "doubleValue"},
+}
+
+// 在lambda类中生成descriptor方法: 压入捕获的字段和方法参数, 转换成实现方法的参数类型后调用,
+// 返回值再转换成descriptor的返回类型
+func addLambdaMethod(b *classBuilder, flags uint16, name string, descriptor string, captured []string, impl *methodHandle) error {
+	samArgs, samRet := splitMethodDescriptor(descriptor)
+	implArgs, implRet := splitMethodDescriptor(impl.descriptor)
+
+	code := newCodeAssembler()
+	maxStack := 2
+	switch impl.kind {
+	case refInvokeVirtual, refInvokeSpecial, refInvokeInterface:
+		// 第一个值是实现方法的接收者
+		implArgs = append([]string{"L" + impl.owner + ";"}, implArgs...)
+	case refNewInvokeSpecial:
+		// 构造方法引用, 如ArrayList::new
+		code.emitIndex(bcode.New, b.classRef(impl.owner)).emit(bcode.Dup)
+		implRet = "L" + impl.owner + ";"
+	case refInvokeStatic:
+	default:
+		return fmt.Errorf("unsupported method handle kind %d", impl.kind)
+	}
+	if len(captured) + len(samArgs) != len(implArgs) {
+		return fmt.Errorf("expect %d arguments, got %d", len(implArgs), len(captured) + len(samArgs))
+	}
+
+	for ix, desc := range captured {
+		code.emit(bcode.Aload0).emitIndex(bcode.GetField, b.fieldRef(b.def.FullClassName, fmt.Sprintf("arg$%d", ix + 1), desc))
+		if err := adaptLambdaValue(b, code, desc, implArgs[ix]); nil != err {
+			return err
+		}
+	}
+	slot := 1
+	for ix, desc := range samArgs {
+		code.emit(loadOpcodeOf(desc), byte(slot))
+		slot += typeSlots(desc)
+		if err := adaptLambdaValue(b, code, desc, implArgs[len(captured) + ix]); nil != err {
+			return err
+		}
+	}
+	for _, desc := range implArgs {
+		maxStack += typeSlots(desc)
+	}
+
+	switch impl.kind {
+	case refInvokeStatic:
+		code.emitIndex(bcode.Invokestatic, b.methodRef(impl.owner, impl.name, impl.descriptor))
+	case refInvokeVirtual:
+		code.emitIndex(bcode.Invokevirtual, b.methodRef(impl.owner, impl.name, impl.descriptor))
+	case refInvokeSpecial, refNewInvokeSpecial:
+		code.emitIndex(bcode.Invokespecial, b.methodRef(impl.owner, impl.name, impl.descriptor))
+	case refInvokeInterface:
+		ref := b.constant(&class.InterfaceMethodConst{InterfaceClassIndex: b.classRef(impl.owner), NameAndTypeIndex: b.nameAndType(impl.name, impl.descriptor)})
+		argSlots, _ := descriptorSlots(impl.descriptor)
+		code.emitIndex(bcode.Invokeinterface, ref).emit(byte(argSlots + 1), 0)
+	}
+
+	switch {
+	case "V" == samRet:
+		if "V" != implRet {
+			code.emit(bcode.Pop)
+		}
+		code.emit(bcode.Return)
+	case "V" == implRet:
+		return fmt.Errorf("void method cannot return %s", samRet)
+	default:
+		if err := adaptLambdaValue(b, code, implRet, samRet); nil != err {
+			return err
+		}
+		code.emit(returnOpcodeOf(samRet))
+	}
+
+	b.method(flags, name, descriptor, uint16(maxStack), uint16(slot), code)
+	return nil
+}
+
+// 把栈顶from类型的值转换成to类型: 装箱, 拆箱或者checkcast; 不支持基本类型之间的转换
+func adaptLambdaValue(b *classBuilder, code *codeAssembler, from string, to string) error {
+	if from == to {
+		return nil
+	}
+
+	fromWrapper, fromPrimitive := primitiveWrappers[from]
+	toWrapper, toPrimitive := primitiveWrappers[to]
+	switch {
+	case fromPrimitive && toPrimitive:
+		return fmt.Errorf("cannot convert %s to %s", from, to)
+	case fromPrimitive:
+		code.emitIndex(bcode.Invokestatic, b.methodRef(fromWrapper[0], "valueOf", "(" + from + ")L" + fromWrapper[0] + ";"))
+	case toPrimitive:
+		code.emitIndex(bcode.Checkcast, b.classRef(toWrapper[0]))
+		code.emitIndex(bcode.Invokevirtual, b.methodRef(toWrapper[0], toWrapper[1], "()" + to))
+	case "Ljava/lang/Object;" != to:
+		code.emitIndex(bcode.Checkcast, b.classRef(descriptorClassName(to)))
+	}
+
+	return nil
+}
+
+func loadOpcodeOf(desc string) byte {
+	switch desc {
+	case "Z", "B", "C", "S", "I":
+		return bcode.Iload
+	case "J":
+		return bcode.Lload
+	case "F":
+		return bcode.Fload
+	case "D":
+		return bcode.Dload
+	}
+
+	return bcode.Aload
+}
+
+func returnOpcodeOf(desc string) byte {
+	switch desc {
+	case "Z", "B", "C", "S", "I":
+		return bcode.Ireturn
+	case "J":
+		return bcode.Lreturn
+	case "F":
+		return bcode.Freturn
+	case "D":
+		return bcode.Dreturn
+	}
+
+	return bcode.Areturn
+}
+
+type lambdaCallSite struct {
+	jvm *MiniJvm
+	// 生成的lambda类
+	def *class.DefFile
+	capturedCount int
+	// 不捕获值时共享的实例
+	instance *class.Reference
+}
+
+func (s *lambdaCallSite) newInstance() (*class.Reference, error) {
+	ref, err := class.NewObject(s.def, s.jvm.MethodArea)
+	if nil != err {
+		return nil, fmt.Errorf("failed to new object for '%s': %w", s.def.FullClassName, err)
+	}
+	if s.jvm.TrackHeap {
+		s.jvm.heap.onAllocate(ref)
+	}
+
+	return ref, nil
+}
+
+func (s *lambdaCallSite) invoke(frame *MethodStackFrame) error {
+	if nil != s.instance {
+		frame.opStack.Push(s.instance)
+		return nil
+	}
+
+	ref, err := s.newInstance()
+	if nil != err {
+		return err
+	}
+	for ix := s.capturedCount; ix > 0; ix-- {
+		val, _ := frame.opStack.Pop()
+		ref.Object.SetFieldValue(fmt.Sprintf("arg$%d", ix), val)
+	}
+	frame.opStack.Push(ref)
+
+	return nil
+}
+
+// StringConcatFactory: 按recipe拼接字符串, \1为下一个动态参数, \2为下一个常量
+type concatCallSite struct {
+	jvm *MiniJvm
+	// 动态参数的描述符
+	argTypes []string
+	recipe string
+	constants []string
+}
+
+// 引导参数为recipe和recipe中用到的常量
+func newConcatCallSite(jvm *MiniJvm, caller *class.DefFile, descriptor string, args []uint16) (callSite, error) {
+	if 0 == len(args) {
+		return nil, fmt.Errorf("makeConcatWithConstants: missing recipe")
+	}
+
+	var texts []string
+	for _, index := range args {
+		str, ok := caller.ConstPool.At(index).(*class.StringInfoConst)
+		if !ok {
+			return nil, fmt.Errorf("makeConcatWithConstants: bootstrap argument #%d is not a String", index)
+		}
+		texts = append(texts, caller.ConstPool.At(str.StringIndex).(*class.Utf8InfoConst).String())
+	}
+
+	argTypes, _ := splitMethodDescriptor(descriptor)
+	site := &concatCallSite{jvm: jvm, argTypes: argTypes, recipe: texts[0], constants: texts[1:]}
+	if argCount := strings.Count(site.recipe, string(concatTagArg)); argCount != len(argTypes) {
+		return nil, fmt.Errorf("makeConcatWithConstants: recipe expects %d arguments, descriptor %s has %d", argCount, descriptor, len(argTypes))
+	}
+	if constCount := strings.Count(site.recipe, string(concatTagConst)); constCount != len(site.constants) {
+		return nil, fmt.Errorf("makeConcatWithConstants: recipe expects %d constants, got %d", constCount, len(site.constants))
+	}
+
+	return site, nil
+}
+
+func (s *concatCallSite) invoke(frame *MethodStackFrame) error {
+	args := make([]interface{}, len(s.argTypes))
+	for ix := len(args) - 1; ix >= 0; ix-- {
+		args[ix], _ = frame.opStack.Pop()
+	}
+
+	var text strings.Builder
+	argIndex, constIndex := 0, 0
+	for _, ch := range s.recipe {
+		switch ch {
+		case concatTagArg:
+			arg, err := s.jvm.concatValueString(frame, s.argTypes[argIndex], args[argIndex])
+			if nil != err {
+				return err
+			}
+			text.WriteString(arg)
+			argIndex++
+		case concatTagConst:
+			text.WriteString(s.constants[constIndex])
+			constIndex++
+		default:
+			text.WriteRune(ch)
+		}
+	}
+
+	ref, err := class.NewStringObject([]rune(text.String()), s.jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to create java/lang/String object:%w", err)
+	}
+	frame.opStack.Push(ref)
+
+	return nil
+}
+
+// 与StringBuilder.append()一样按参数类型生成文本, 对象调用toString()
+func (m *MiniJvm) concatValueString(frame *MethodStackFrame, desc string, val interface{}) (string, error) {
+	switch desc {
+	case "Z":
+		return strconv.FormatBool(toBool(val)), nil
+	case "C":
+		return string(rune(toInt64(val))), nil
+	case "B", "S", "I", "J":
+		return strconv.FormatInt(toInt64(val), 10), nil
+	case "F":
+		return formatJavaFloat(toFloat32(val)), nil
+	case "D":
+		return formatJavaDouble(toFloat64(val)), nil
+	}
+
+	ref, _ := val.(*class.Reference)
+	return m.objectToString(frame, ref)
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+// 添加一个引导方法和引用它的InvokeDynamic常量, 返回常量下标
+func addInvokeDynamic(b *classBuilder, factory string, factoryName string, name string, descriptor string, args ...uint16) uint16 {
+	var bootstrap *class.BootstrapMethodsAttr
+	for _, attr := range b.def.Attrs {
+		if found, ok := attr.(*class.BootstrapMethodsAttr); ok {
+			bootstrap = found
+		}
+	}
+	if nil == bootstrap {
+		bootstrap = &class.BootstrapMethodsAttr{}
+		b.def.Attrs = append(b.def.Attrs, bootstrap)
+	}
+
+	ref := b.constant(&class.MethodHandleConst{ReferenceKind: refInvokeStatic, ReferenceIndex: b.methodRef(factory, factoryName, "()V")})
+	bootstrap.Methods = append(bootstrap.Methods, &class.BootstrapMethod{MethodRef: ref, Args: args})
+
+	return b.constant(&class.InvokeDynamicConst{
+		BootstrapMethodAttrIndex: uint16(len(bootstrap.Methods) - 1),
+		NameAndTypeIndex:         b.nameAndType(name, descriptor),
+	})
+}
+
+func methodType(b *classBuilder, descriptor string) uint16 {
+	return b.constant(&class.MethodTypeConst{DescriptorIndex: b.utf8(descriptor)})
+}
+
+func methodHandleConst(b *classBuilder, kind uint8, owner string, name string, descriptor string) uint16 {
+	return b.constant(&class.MethodHandleConst{ReferenceKind: kind, ReferenceIndex: b.methodRef(owner, name, descriptor)})
+}
+
+func TestInvokeDynamic(t *testing.T) {
+	intOp := newClassBuilder("com/fh/IntOp", "java/lang/Object")
+	intOp.def.AccessFlag = accflag.Interface | accflag.Abstarct
+	intOp.method(accflag.Public | accflag.Abstarct, "applyAsInt", "(I)I", 0, 0, nil)
+	fn := newClassBuilder("com/fh/Func", "java/lang/Object")
+	fn.def.AccessFlag = accflag.Interface | accflag.Abstarct
+	fn.method(accflag.Public | accflag.Abstarct, "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", 0, 0, nil)
+	marker := newTestClass("com/fh/Marker", "java/lang/Object", nil)
+	marker.AccessFlag = accflag.Interface | accflag.Abstarct
+	node := newClassBuilder("com/fh/Node", "java/lang/Object")
+	node.method(accflag.Public, "self", "()Lcom/fh/Node;", 1, 1, newCodeAssembler().emit(bcode.Aload0, bcode.Areturn))
+
+	b := newClassBuilder("com/fh/Lambdas", "java/lang/Object")
+	// static int add(int base, int x) { IntOp op = y -> base + y; return op.applyAsInt(x); }
+	b.method(accflag.Private | accflag.Static | accflag.Synthetic, "lambda$add$0", "(II)I", 2, 2, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iload1, bcode.Iadd, bcode.Ireturn))
+	addSite := addInvokeDynamic(b, lambdaMetafactoryClassName, "metafactory", "applyAsInt", "(I)Lcom/fh/IntOp;",
+		methodType(b, "(I)I"), methodHandleConst(b, refInvokeStatic, "com/fh/Lambdas", "lambda$add$0", "(II)I"), methodType(b, "(I)I"))
+	b.method(accflag.Static, "add", "(II)I", 2, 2, newCodeAssembler().
+		emit(bcode.Iload0).emitIndex(bcode.Invokedynamic, addSite).emit(0, 0, bcode.Iload1).
+		emitIndex(bcode.Invokeinterface, b.constant(&class.InterfaceMethodConst{InterfaceClassIndex: b.classRef("com/fh/IntOp"), NameAndTypeIndex: b.nameAndType("applyAsInt", "(I)I")})).
+		emit(2, 0, bcode.Ireturn))
+
+	// static Func self() { return (Func & Marker) Node::self; }
+	selfSite := addInvokeDynamic(b, lambdaMetafactoryClassName, "altMetafactory", "apply", "()Lcom/fh/Func;",
+		methodType(b, "(Ljava/lang/Object;)Ljava/lang/Object;"), methodHandleConst(b, refInvokeVirtual, "com/fh/Node", "self", "()Lcom/fh/Node;"),
+		methodType(b, "(Lcom/fh/Node;)Lcom/fh/Node;"), b.constant(&class.IntegerInfoConst{Bytes: lambdaFlagMarkers}),
+		b.constant(&class.IntegerInfoConst{Bytes: 1}), b.classRef("com/fh/Marker"))
+	b.method(accflag.Static, "self", "()Lcom/fh/Func;", 1, 0, newCodeAssembler().
+		emitIndex(bcode.Invokedynamic, selfSite).emit(0, 0, bcode.Areturn))
+
+	// static String concat(String s, int i, long l, char c, boolean z, double d, Object o) { return "[" + s + i + l + c + z + d + o + "]"; }
+	concatDesc := "(Ljava/lang/String;IJCZDLjava/lang/Object;)Ljava/lang/String;"
+	concatSite := addInvokeDynamic(b, stringConcatFactoryClassName, "makeConcatWithConstants", "makeConcatWithConstants", concatDesc,
+		b.stringConst("\u0002\u0001: \u0001, \u0001 \u0001 \u0001 \u0001 \u0001]"), b.stringConst("["))
+	b.method(accflag.Static, "concat", concatDesc, 9, 9, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Iload1, bcode.Lload2, bcode.Iload, 4, bcode.Iload, 5, bcode.Dload, 6, bcode.Aload, 8).
+		emitIndex(bcode.Invokedynamic, concatSite).emit(0, 0, bcode.Areturn))
+
+	// 写出后重新解析, 检查BootstrapMethods属性
+	buf, err := class.WriteClass(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	caller, err := class.LoadClassBuf(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if bootstrap, ok := caller.Attrs[0].(*class.BootstrapMethodsAttr); !ok || 3 != len(bootstrap.Methods) || 6 != len(bootstrap.Methods[1].Args) {
+		t.Fatalf("unexpected attrs %v", caller.Attrs)
+	}
+
+	jvm, err := newClassInitTestJvm(newTestClass("java/lang/String", "java/lang/Object", nil), intOp.def, fn.def, marker, node.def, caller)
+	if nil != err {
+		t.Fatal(err)
+	}
+	call := func(name string, descriptor string, args ...interface{}) interface{} {
+		frame := newMethodStackFrame(len(args) + 1, 0)
+		for _, arg := range args {
+			frame.opStack.Push(arg)
+		}
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(caller, name, descriptor, frame, false); nil != err {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ret, _ := frame.opStack.Pop()
+		return ret
+	}
+
+	// 捕获的值每次创建新对象
+	if ret := call("add", "(II)I", 40, 2); 42 != ret {
+		t.Fatalf("expect 42, got %v", ret)
+	}
+	if ret := call("add", "(II)I", -1, 1); 0 != ret {
+		t.Fatalf("expect 0, got %v", ret)
+	}
+
+	// 不捕获值的lambda复用同一个对象, 接收者由checkcast检查
+	f := call("self", "()Lcom/fh/Func;").(*class.Reference)
+	if f != call("self", "()Lcom/fh/Func;") {
+		t.Fatal("non-capturing lambda should be cached")
+	}
+	if isMarker, _ := jvm.MethodArea.IsSubClassOf(f.Object.DefFile, "com/fh/Marker"); !isMarker {
+		t.Fatalf("%s should implement the marker interface", f.Object.DefFile.FullClassName)
+	}
+	nodeRef, _ := class.NewObject(node.def, jvm.MethodArea)
+	root := newMethodStackFrame(1, 0)
+	if ret, err := jvm.invokeMethod(root, f, "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", nodeRef); nil != err || nodeRef != ret {
+		t.Fatalf("expect the node itself, got %v, %v", ret, err)
+	}
+	if _, err := jvm.invokeMethod(root, f, "apply", "(Ljava/lang/Object;)Ljava/lang/Object;", f); nil == err {
+		t.Fatal("expect ClassCastException for a wrong receiver")
+	}
+
+	str, _ := class.NewStringObject([]rune("n"), jvm.MethodArea)
+	ret := call("concat", concatDesc, str, 1, int64(-2), int('x'), 1, 0.5, nil).(*class.Reference)
+	if text, _ := class.StringRunes(ret); "[n: 1, -2 x true 0.5 null]" != string(text) {
+		t.Fatalf("unexpected concat result %q", string(text))
+	}
+
+	attrs, _ := caller.Methods[1].Attributes()
+	expect := fmt.Sprintf("invokedynamic #%d // InvokeDynamic #0:applyAsInt:(I)Lcom/fh/IntOp;", addSite)
+	if text := formatInstruction(caller, attrs[0].(*class.CodeAttr).Code, 1, 5); expect != text {
+		t.Fatalf("unexpected disassembly %s", text)
+	}
+}
@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 链接时检查类中所有方法的字节码;
+// 预解码出指令边界, 检查跳转目标和iinc的本地变量下标, 执行时不再信任字节码中的偏移量
+func linkClass(def *class.DefFile) error {
+	for _, method := range def.Methods {
+		if _, err := linkMethod(def, method); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 解码并链接单个方法的code属性, 每个方法只链接一次; 没有code属性时返回nil
+func linkMethod(def *class.DefFile, method *class.MethodInfo) (*class.CodeAttr, error) {
+	name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+	desc := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+
+	codeAttr, err := findCodeAttr(method)
+	if nil != err {
+		return nil, fmt.Errorf("java.lang.ClassFormatError: %s.%s%s: %w", def.FullClassName, name, desc, err)
+	}
+	if nil == codeAttr {
+		return nil, nil
+	}
+
+	err = codeAttr.LinkOnce(func() error {
+		err := linkCode(codeAttr)
+		if nil != err {
+			return fmt.Errorf("java.lang.VerifyError: %s.%s%s: %w", def.FullClassName, name, desc, err)
+		}
+
+		err = checkExceptionTable(def, codeAttr)
+		if nil != err {
+			return fmt.Errorf("java.lang.ClassFormatError: %s.%s%s: %w", def.FullClassName, name, desc, err)
+		}
+
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	return codeAttr, nil
+}
+
+func linkCode(codeAttr *class.CodeAttr) error {
+	jumpMap, err := bcode.BuildJumpMap(codeAttr.Code)
+	if nil != err {
+		return err
+	}
+
+	// iinc和wide iinc的本地变量下标不能超出本地变量表
+	code := codeAttr.Code
+	for pc := 0; pc < len(code); pc++ {
+		if !jumpMap.IsInstructionStart(pc) {
+			continue
+		}
+
+		index := -1
+		if bcode.Iinc == code[pc] {
+			index = int(code[pc + 1])
+
+		} else if bcode.Wide == code[pc] && bcode.Iinc == code[pc + 1] {
+			index = int(binary.BigEndian.Uint16(code[pc + 2:]))
+		}
+
+		if index >= int(codeAttr.MaxLocals) {
+			return fmt.Errorf("iinc at pc %d uses local variable %d, max locals is %d", pc, index, codeAttr.MaxLocals)
+		}
+	}
+
+	codeAttr.JumpMap = jumpMap
+	return nil
+}
+
+// 检查异常表, 需要先执行linkCode得到指令边界;
+// [StartPc, EndPc)必须是非空的合法代码区间, StartPc和HandlerPc必须是指令的起始位置, EndPc是指令起始位置或者代码末尾
+func checkExceptionTable(def *class.DefFile, codeAttr *class.CodeAttr) error {
+	codeLen := len(codeAttr.Code)
+
+	for ix, entry := range codeAttr.ExceptionTable {
+		start, end, handler := int(entry.StartPc), int(entry.EndPc), int(entry.HandlerPc)
+
+		if start >= end || end > codeLen {
+			return fmt.Errorf("exception table entry %d has invalid range [%d, %d), code length is %d", ix, start, end, codeLen)
+		}
+		if !codeAttr.JumpMap.IsInstructionStart(start) {
+			return fmt.Errorf("exception table entry %d starts at %d, which is not an instruction boundary", ix, start)
+		}
+		if end != codeLen && !codeAttr.JumpMap.IsInstructionStart(end) {
+			return fmt.Errorf("exception table entry %d ends at %d, which is not an instruction boundary", ix, end)
+		}
+		if !codeAttr.JumpMap.IsInstructionStart(handler) {
+			return fmt.Errorf("exception table entry %d has handler pc %d, which is not an instruction boundary", ix, handler)
+		}
+
+		if 0 != entry.CatchType {
+			if int(entry.CatchType) >= def.ConstPool.Len() {
+				return fmt.Errorf("exception table entry %d has invalid catch type index %d", ix, entry.CatchType)
+			}
+			if _, ok := def.ConstPool.At(entry.CatchType).(*class.ClassInfoConstInfo); !ok {
+				return fmt.Errorf("exception table entry %d has catch type #%d which is not a class", ix, entry.CatchType)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestLinkCodeIinc(t *testing.T) {
+	// iinc 1 1; return
+	codeAttr := &class.CodeAttr{MaxLocals: 2, Code: []byte{0x84, 0x01, 0x01, 0xb1}}
+	if err := linkCode(codeAttr); nil != err {
+		t.Fatal(err)
+	}
+	if nil == codeAttr.JumpMap {
+		t.Fatal("jump map not built")
+	}
+
+	// wide iinc 300 -1; return
+	codeAttr = &class.CodeAttr{MaxLocals: 2, Code: []byte{0xc4, 0x84, 0x01, 0x2c, 0xff, 0xff, 0xb1}}
+	if err := linkCode(codeAttr); nil == err {
+		t.Fatal("expected error for local variable index out of range")
+	}
+}
+
+func TestCheckExceptionTable(t *testing.T) {
+	def := &class.DefFile{ConstPool: class.NewConstPool(&class.Utf8InfoConst{})}
+	// 0: iconst_0, 1: ifeq +4, 4: nop, 5: return
+	newCodeAttr := func(entry *class.ExceptionTable) *class.CodeAttr {
+		codeAttr := &class.CodeAttr{
+			Code:                 []byte{0x03, 0x99, 0x00, 0x04, 0x00, 0xb1},
+			ExceptionTableLength: 1,
+			ExceptionTable:       []*class.ExceptionTable{entry},
+		}
+		if err := linkCode(codeAttr); nil != err {
+			t.Fatal(err)
+		}
+
+		return codeAttr
+	}
+
+	valid := newCodeAttr(&class.ExceptionTable{StartPc: 0, EndPc: 6, HandlerPc: 5})
+	if err := checkExceptionTable(def, valid); nil != err {
+		t.Fatal(err)
+	}
+
+	invalidEntries := []*class.ExceptionTable{
+		// 空区间
+		{StartPc: 1, EndPc: 1, HandlerPc: 5},
+		// 超出代码范围
+		{StartPc: 0, EndPc: 7, HandlerPc: 5},
+		// 结束位置在指令中间
+		{StartPc: 0, EndPc: 2, HandlerPc: 5},
+		// handler在指令中间
+		{StartPc: 0, EndPc: 4, HandlerPc: 3},
+		// catch类型不是class
+		{StartPc: 0, EndPc: 4, HandlerPc: 5, CatchType: 1},
+	}
+	for ix, entry := range invalidEntries {
+		if err := checkExceptionTable(def, newCodeAttr(entry)); nil == err {
+			t.Fatalf("entry %d: expected error", ix)
+		}
+	}
+}
@@ -1,15 +1,14 @@
 package vm
 
 import (
-	"archive/zip"
 	"errors"
 	"fmt"
 	"github.com/wanghongfei/mini-jvm/utils"
 	"github.com/wanghongfei/mini-jvm/vm/accflag"
 	"github.com/wanghongfei/mini-jvm/vm/class"
-	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 )
@@ -20,17 +19,67 @@ var ClassIgnoredErr = errors.New("ignored")
 type MethodArea struct {
 	Jvm *MiniJvm
 
-	// 类路径
+	// 类路径; 创建方法区之后修改(AddJarBytes等)需要持有classPathsLock, 遍历时用classPathSnapshot()
 	ClassPaths []string
+	classPathsLock sync.RWMutex
 
 	// key: 类的选限定性名
 	// val: 加载完成后的DefFile
-	// 因为有可能在其他goroutine中加载类, 所以需要加锁
+	// 因为有可能在其他goroutine中加载类, 所以需要加锁;
+	// 目前只有这一个相当于bootstrap加载器的命名空间, 与JVM规范中bootstrap加载的类一样, 类加载后不会被卸载;
+	// 按加载器可达性卸载类需要先支持自定义类加载器(每个加载器独立的ClassMap)
 	ClassMap map[string]*class.DefFile
 	ClassMapLock sync.RWMutex
 
 	// 忽略的class的全名, 遇到这些class时不触发加载逻辑
 	IgnoredClasses map[string]interface{}
+
+	// 类级别的加载/执行策略, 为nil时不限制
+	ClassPolicy *ClassPolicy
+
+	// 正在加载中的类的锁, 保证同一个类只会被一个goroutine加载一次
+	// key: 类的全限定性名
+	loadingLocks map[string]*sync.Mutex
+	loadingLocksLock sync.Mutex
+
+	// 每个类唯一的java/lang/Class对象, 保证Foo.class == Foo.class
+	classObjects map[*class.DefFile]*class.Reference
+	// 数组类没有DefFile, 按Class.getName()的名字(如[I, [Ljava.lang.String;)保存唯一的Class对象
+	arrayClassObjects map[string]*class.Reference
+	// Class对象 -> 数组类名, 用于数组类的getName()
+	arrayClassNames map[*class.Reference]string
+	classObjectsLock sync.Mutex
+
+	// static字段解析结果缓存, staticFieldKey -> 声明字段的*class.DefFile
+	staticFieldOwners sync.Map
+
+	// 映射到内存的jar包, 每个jar只打开和解析一次目录; 从jar加载的类引用映射的内存, 所以jar在Close()之前一直不关闭
+	// key: jar包路径
+	jars map[string]*utils.MappedZip
+	jarsLock sync.Mutex
+
+	// 字符串常量池, 见InternString
+	internedStrings map[string]*class.Reference
+	internedStringsLock sync.Mutex
+
+	// PreloadClasses()提前解析和链接好的类, 第一次加载时取出使用, key: 类的全限定性名
+	preloaded map[string]*class.DefFile
+	preloadedLock sync.Mutex
+
+	// 正在执行<clinit>的类, key: 类的全限定性名
+	initializing map[string]*classInit
+	// 等待其他线程完成<clinit>的线程, key: 线程编号, val: 等待的类名; 用于检测初始化死锁
+	initWaiters map[int64]string
+	// StrictInit下已经链接但还没有执行<clinit>的类
+	pendingInits map[string]bool
+	// StrictInit下<clinit>抛出过异常的类, 之后再主动使用时抛出NoClassDefFoundError
+	failedInits map[string]bool
+	initLock sync.Mutex
+}
+
+type staticFieldKey struct {
+	def *class.DefFile
+	name string
 }
 
 func NewMethodArea(jvm *MiniJvm, classpaths []string, ignoredClasses []string) (*MethodArea, error) {
@@ -38,11 +87,46 @@ func NewMethodArea(jvm *MiniJvm, classpaths []string, ignoredClasses []string) (
 		return nil, fmt.Errorf("invalid classpath: %v", classpaths)
 	}
 
+	// 把http/https形式的classpath下载到本地, fat jar展开成普通classpath
+	options := jvm.classPathOptions()
+	localClasspaths := make([]string, 0, len(classpaths))
+	for _, cp := range classpaths {
+		if isRemoteClassPath(cp) {
+			localPath, err := options.fetchRemoteClassPath(cp)
+			if nil != err {
+				return nil, err
+			}
+			cp = localPath
+		}
+
+		// Android的dex和apk需要先转换成jar
+		cp, err := options.convertDexClassPath(cp)
+		if nil != err {
+			return nil, err
+		}
+
+		// fat jar展开成多个classpath
+		if strings.HasSuffix(cp, ".jar") {
+			expanded, err := options.expandFatJar(cp)
+			if nil != err {
+				return nil, err
+			}
+			localClasspaths = append(localClasspaths, expanded...)
+			continue
+		}
+
+		localClasspaths = append(localClasspaths, cp)
+	}
+
 	res := &MethodArea{
 		Jvm: jvm,
-		ClassPaths: classpaths,
+		ClassPaths: localClasspaths,
 		ClassMap: make(map[string]*class.DefFile),
 		IgnoredClasses: make(map[string]interface{}),
+		loadingLocks: make(map[string]*sync.Mutex),
+		classObjects: make(map[*class.DefFile]*class.Reference),
+		arrayClassObjects: make(map[string]*class.Reference),
+		arrayClassNames: make(map[*class.Reference]string),
 	}
 
 	if nil != ignoredClasses {
@@ -56,7 +140,35 @@ func NewMethodArea(jvm *MiniJvm, classpaths []string, ignoredClasses []string) (
 
 // 从classpath中加载一个类
 // fullname: 全限定性名
+// 没有栈帧的调用者(宿主代码, 本地方法)作为一个新的线程加载, 类正在初始化时等待<clinit>完成;
+// <clinit>中调用的本地方法需要用自己的栈帧加载本类(loadClassInFrame), 否则会等待自己
 func (m *MethodArea) LoadClass(fullyQualifiedName string) (*class.DefFile, error) {
+	return m.loadClassInFrame(newRootFrame(), fullyQualifiedName)
+}
+
+// 在frame所在的线程中加载类;
+// 类正在被其他线程初始化时等待<clinit>执行完成
+func (m *MethodArea) loadClassInFrame(frame *MethodStackFrame, fullyQualifiedName string) (*class.DefFile, error) {
+	def, err := m.resolveClassInFrame(frame, fullyQualifiedName)
+	if nil != err || !m.strictInit() {
+		return def, err
+	}
+
+	err = m.initializeClass(frame, def)
+	if nil != err {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+// 加载类, 但不算作对类的主动使用(如加载父类, 解析符号引用, 类字面量);
+// 默认与LoadClass相同, 开启StrictInit时只链接, 不执行<clinit>; 只需要类的结构, 不等待其他线程中的<clinit>
+func (m *MethodArea) ResolveClass(fullyQualifiedName string) (*class.DefFile, error) {
+	return m.resolveClassInFrame(nil, fullyQualifiedName)
+}
+
+func (m *MethodArea) resolveClassInFrame(frame *MethodStackFrame, fullyQualifiedName string) (*class.DefFile, error) {
 	utils.LogInfoPrintf("load class: %s", fullyQualifiedName)
 
 	// 查忽略列表
@@ -65,17 +177,314 @@ func (m *MethodArea) LoadClass(fullyQualifiedName string) (*class.DefFile, error
 		return nil, ClassIgnoredErr
 	}
 
+	// 已加载的类也要检查, 策略可能在加载之后才设置
+	if nil != m.ClassPolicy {
+		if err := m.ClassPolicy.check(fullyQualifiedName); nil != err {
+			return nil, err
+		}
+	}
+
 	// 先从已加载的类中寻找
 	m.ClassMapLock.RLock()
 	targetClassDef, ok := m.ClassMap[fullyQualifiedName]
 	m.ClassMapLock.RUnlock()
 	if ok {
 		utils.LogInfoPrintf("load class from cache: %s", fullyQualifiedName)
-		return targetClassDef, nil
+		return m.awaitInitialized(frame, targetClassDef)
+	}
+
+	defFile, init, err := m.defineClass(frame, fullyQualifiedName)
+	if nil != err {
+		return nil, err
+	}
+	if nil == init {
+		// 等锁期间已经被其他goroutine加载
+		return m.awaitInitialized(frame, defFile)
+	}
+
+	err = m.initialize(defFile, init)
+	if nil != err {
+		return nil, err
+	}
+
+	return defFile, nil
+}
+
+// 解析, 链接类并放入ClassMap, 不执行<clinit>;
+// 返回的classInit不为nil时需要由调用者执行<clinit>, 类已经在ClassMap中时返回nil
+func (m *MethodArea) defineClass(frame *MethodStackFrame, fullyQualifiedName string) (*class.DefFile, *classInit, error) {
+	// 同一时刻只允许一个goroutine加载此类, 其他goroutine等待加载完成后直接使用结果;
+	// <clinit>在释放此锁之后执行, 否则两个线程的<clinit>互相加载对方的类时会在这里死锁而无法检测
+	loadingLock := m.acquireLoadingLock(fullyQualifiedName)
+	defer m.releaseLoadingLock(fullyQualifiedName, loadingLock)
+
+	// 等锁期间可能已经被其他goroutine加载完成
+	m.ClassMapLock.RLock()
+	targetClassDef, ok := m.ClassMap[fullyQualifiedName]
+	m.ClassMapLock.RUnlock()
+	if ok {
+		utils.LogInfoPrintf("load class from cache: %s", fullyQualifiedName)
+		return targetClassDef, nil, nil
+	}
+
+	defFile := m.takePreloaded(fullyQualifiedName)
+	if nil == defFile {
+		parsed, err := m.ParseClass(fullyQualifiedName)
+		if nil != err {
+			return nil, nil, err
+		}
+		defFile = parsed
+	}
+
+	init, err := m.registerClass(frame, defFile)
+	if nil != err {
+		return nil, nil, err
+	}
+	if nil != m.Jvm.PreloadRecorder {
+		m.Jvm.PreloadRecorder.onClassLoaded(defFile)
+	}
+
+	return defFile, init, nil
+}
+
+// 定义在内存中生成的类(如REPL编译的片段), 与从classpath加载的类一样链接并执行<clinit>; 同名的类已经存在时返回错误
+func (m *MethodArea) DefineClass(def *class.DefFile) error {
+	loadingLock := m.acquireLoadingLock(def.FullClassName)
+
+	m.ClassMapLock.RLock()
+	_, ok := m.ClassMap[def.FullClassName]
+	m.ClassMapLock.RUnlock()
+	if ok {
+		m.releaseLoadingLock(def.FullClassName, loadingLock)
+		return fmt.Errorf("java.lang.LinkageError: duplicate class definition for %s", def.FullClassName)
+	}
+
+	init, err := m.registerClass(nil, def)
+	m.releaseLoadingLock(def.FullClassName, loadingLock)
+	if nil != err {
+		return err
+	}
+
+	return m.initialize(def, init)
+}
+
+// 链接已经解析好的类并放入ClassMap, 调用者需要持有类的加载锁
+func (m *MethodArea) registerClass(frame *MethodStackFrame, defFile *class.DefFile) (*classInit, error) {
+	fullyQualifiedName := defFile.FullClassName
+
+	// 按规则在方法入口插入探针, 需要在链接之前完成
+	if nil != m.Jvm.Rewriter {
+		if err := m.Jvm.Rewriter.rewriteClass(defFile); nil != err {
+			return nil, err
+		}
+	}
+
+	// 链接检查字节码, 不合法的类不会被放入ClassMap
+	if !m.Jvm.LazyLink {
+		err := linkClass(defFile)
+		if nil != err {
+			m.Jvm.recordCrashSite(err, defFile, nil, -1, frame)
+			return nil, err
+		}
+	}
+
+	// 初始化虚方法表;
+	// 放在放入ClassMap之前, 这样其他goroutine拿到的类一定是虚方法表已经初始化好的
+	err := m.initVTable(defFile)
+	if nil != err {
+		return nil, fmt.Errorf("failed to init vtable for class '%s':%w", fullyQualifiedName, err)
+	}
+
+	// 先登记初始化状态再放入ClassMap, 其他线程从ClassMap拿到此类时会等待<clinit>完成,
+	// 执行<clinit>的线程再次加载本类时直接返回;
+	// StrictInit下<clinit>推迟到第一次主动使用时执行, 这里返回不需要执行<clinit>的classInit
+	var init *classInit
+	if m.strictInit() {
+		m.deferInit(defFile)
+		init = &classInit{}
+	} else {
+		init = m.beginInit(frame, defFile)
+	}
+
+	m.ClassMapLock.Lock()
+	m.ClassMap[fullyQualifiedName] = defFile
+	m.ClassMapLock.Unlock()
+	m.Jvm.stats.onClassLoaded()
+
+	return init, nil
+}
+
+// 返回类对应的java/lang/Class对象, 同一个类每次返回同一个对象
+func (m *MethodArea) ClassObjectOf(def *class.DefFile) (*class.Reference, error) {
+	m.classObjectsLock.Lock()
+	classRef, ok := m.classObjects[def]
+	m.classObjectsLock.Unlock()
+	if ok {
+		return classRef, nil
+	}
+
+	// 在锁外加载和创建, 加载java/lang/Class时执行的<clinit>可能会再次进入此方法
+	classRef, err := m.newClassObject()
+	if nil != err {
+		return nil, err
+	}
+	classRef.Object.Mirror = def
+
+	m.classObjectsLock.Lock()
+	defer m.classObjectsLock.Unlock()
+
+	if nil == m.classObjects {
+		m.classObjects = make(map[*class.DefFile]*class.Reference)
+	}
+	// 其他goroutine可能已经创建过了, 以先放入的为准
+	if existing, ok := m.classObjects[def]; ok {
+		return existing, nil
 	}
+	m.classObjects[def] = classRef
+
+	return classRef, nil
+}
+
+// 返回数组类对应的java/lang/Class对象, 同一种数组每次返回同一个对象;
+// descriptor为数组的描述符, 以/或.分隔都可以, 如[I, [Ljava/lang/String;
+func (m *MethodArea) ArrayClassObjectOf(descriptor string) (*class.Reference, error) {
+	name := strings.ReplaceAll(descriptor, "/", ".")
+
+	m.classObjectsLock.Lock()
+	classRef, ok := m.arrayClassObjects[name]
+	m.classObjectsLock.Unlock()
+	if ok {
+		return classRef, nil
+	}
+
+	classRef, err := m.newClassObject()
+	if nil != err {
+		return nil, err
+	}
+
+	m.classObjectsLock.Lock()
+	defer m.classObjectsLock.Unlock()
+
+	if nil == m.arrayClassObjects {
+		m.arrayClassObjects = make(map[string]*class.Reference)
+		m.arrayClassNames = make(map[*class.Reference]string)
+	}
+	if existing, ok := m.arrayClassObjects[name]; ok {
+		return existing, nil
+	}
+	m.arrayClassObjects[name] = classRef
+	m.arrayClassNames[classRef] = name
+
+	return classRef, nil
+}
+
+// 数组类的Class对象对应的类名, 如[I, [Ljava.lang.String;; 不是数组类时返回false
+func (m *MethodArea) arrayClassNameOf(classRef *class.Reference) (string, bool) {
+	m.classObjectsLock.Lock()
+	defer m.classObjectsLock.Unlock()
+
+	name, ok := m.arrayClassNames[classRef]
+	return name, ok
+}
+
+// 创建不与任何类关联的java/lang/Class对象, 用于数组类
+func (m *MethodArea) newClassObject() (*class.Reference, error) {
+	classDef, err := m.LoadClass("java/lang/Class")
+	if nil != err {
+		return nil, fmt.Errorf("failed to load java/lang/Class def:%w", err)
+	}
+
+	classRef, err := class.NewObject(classDef, m)
+	if nil != err {
+		return nil, fmt.Errorf("failed to create java/lang/Class object:%w", err)
+	}
+
+	return classRef, nil
+}
+
+// 取得指定类的加载锁并加锁, 锁不存在时创建
+func (m *MethodArea) acquireLoadingLock(fullyQualifiedName string) *sync.Mutex {
+	m.loadingLocksLock.Lock()
+	lock, ok := m.loadingLocks[fullyQualifiedName]
+	if !ok {
+		lock = new(sync.Mutex)
+		m.loadingLocks[fullyQualifiedName] = lock
+	}
+	m.loadingLocksLock.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+// 释放指定类的加载锁;
+// 加载成功后类已经在ClassMap中, 之后不会再用到这把锁, 所以从map中删除;
+// 加载失败时保留, 让重试的goroutine继续串行加载
+func (m *MethodArea) releaseLoadingLock(fullyQualifiedName string, lock *sync.Mutex) {
+	m.ClassMapLock.RLock()
+	_, loaded := m.ClassMap[fullyQualifiedName]
+	m.ClassMapLock.RUnlock()
+
+	m.loadingLocksLock.Lock()
+	if loaded && m.loadingLocks[fullyQualifiedName] == lock {
+		delete(m.loadingLocks, fullyQualifiedName)
+	}
+	m.loadingLocksLock.Unlock()
+
+	lock.Unlock()
+}
+
+// 取出已经加载过的父类, 没有父类或者父类尚未加载时返回nil
+func (m *MethodArea) loadedSuperClass(def *class.DefFile) *class.DefFile {
+	if 0 == def.SuperClass {
+		return nil
+	}
+
+	superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+	superName := def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+
+	m.ClassMapLock.RLock()
+	superDef := m.ClassMap[superName]
+	m.ClassMapLock.RUnlock()
+
+	return superDef
+}
+
+func (m *MethodArea) isLoaded(fullyQualifiedName string) bool {
+	m.ClassMapLock.RLock()
+	_, ok := m.ClassMap[fullyQualifiedName]
+	m.ClassMapLock.RUnlock()
+
+	return ok
+}
+
+func (m *MethodArea) addPreloaded(defs map[string]*class.DefFile) {
+	m.preloadedLock.Lock()
+	defer m.preloadedLock.Unlock()
+
+	if nil == m.preloaded {
+		m.preloaded = make(map[string]*class.DefFile, len(defs))
+	}
+	for name, def := range defs {
+		m.preloaded[name] = def
+	}
+}
 
-	var defFile *class.DefFile
+// 取出预加载的类, 每个类只使用一次; 没有预加载时返回nil
+func (m *MethodArea) takePreloaded(fullyQualifiedName string) *class.DefFile {
+	m.preloadedLock.Lock()
+	defer m.preloadedLock.Unlock()
 
+	def, ok := m.preloaded[fullyQualifiedName]
+	if ok {
+		delete(m.preloaded, fullyQualifiedName)
+	}
+
+	return def
+}
+
+// 从classpath中找到并解析class文件, 但不放入方法区, 也不执行<clinit>;
+// verify等只需要读取类结构的场景使用
+func (m *MethodArea) ParseClass(fullyQualifiedName string) (*class.DefFile, error) {
 	// 从classpath寻找
 	filepath, err := m.findClassFilePath(fullyQualifiedName)
 	if nil != err {
@@ -83,46 +492,88 @@ func (m *MethodArea) LoadClass(fullyQualifiedName string) (*class.DefFile, error
 		// 从jar中寻找
 		classBuf, err := m.findClassBuf(fullyQualifiedName)
 		if nil != err {
-			// 还没找到
+			// 还没找到, 最后查虚拟机内置的类
+			if newBuiltin, ok := builtinClasses[fullyQualifiedName]; ok {
+				return newBuiltin(), nil
+			}
 			return nil, err
 		}
 
 		// 找到了
 		// 加载class
-		defFile, err = class.LoadClassBuf(classBuf)
+		defFile, err := class.LoadClassBufWith(classBuf, m.Jvm.unknownAttrHandler(fullyQualifiedName))
 		if nil != err {
 			return nil, fmt.Errorf("unabled to load class %s: %w", fullyQualifiedName, err)
 		}
 
-	} else {
-		defFile, err = class.LoadClassFile(filepath)
-		if nil != err {
-			return nil, fmt.Errorf("unabled to load class %s: %w", fullyQualifiedName, err)
-		}
+		return defFile, nil
 	}
 
-	m.ClassMapLock.Lock()
-	m.ClassMap[fullyQualifiedName] = defFile
-	m.ClassMapLock.Unlock()
+	defFile, err := class.LoadClassFileWith(filepath, m.Jvm.unknownAttrHandler(fullyQualifiedName))
+	if nil != err {
+		return nil, fmt.Errorf("unabled to load class %s: %w", fullyQualifiedName, err)
+	}
+
+	return defFile, nil
+}
+
+// 列出classpath中所有class的全限定性名(目录和jar包都会遍历)
+func (m *MethodArea) ListClassNames() ([]string, error) {
+	names := make([]string, 0, 16)
+
+	for _, cp := range m.classPathSnapshot() {
+		if strings.HasSuffix(cp, ".jar") {
+			jar, err := m.openJar(cp)
+			if nil != err {
+				return nil, fmt.Errorf("failed to list classes in '%s': %w", cp, err)
+			}
 
-	// 执行<clinit>方法
-	err = m.Jvm.ExecutionEngine.ExecuteWithDescriptor(defFile, "<clinit>", "()V")
-	if nil != err && "failed to find method" == err.Error() {
-		return nil, fmt.Errorf("failed to execute <clinit> for class '%s':%w", fullyQualifiedName, err)
+			for _, f := range jar.Reader.File {
+				// fat jar中BOOT-INF下的class已经展开成单独的classpath了
+				if strings.HasSuffix(f.Name, ".class") && !strings.HasPrefix(f.Name, "BOOT-INF/") {
+					names = append(names, strings.TrimSuffix(f.Name, ".class"))
+				}
+			}
+
+			continue
+		}
+
+		err := filepath.Walk(cp, func(path string, info os.FileInfo, err error) error {
+			if nil != err {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".class") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(cp, path)
+			if nil != err {
+				return err
+			}
+			names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), ".class"))
+
+			return nil
+		})
+		if nil != err {
+			return nil, fmt.Errorf("failed to list classes in '%s': %w", cp, err)
+		}
 	}
 
-	// 初始化虚方法表
-	err = m.initVTable(defFile)
-	if nil != err {
-		return nil, fmt.Errorf("failed to init vtable for class '%s':%w", fullyQualifiedName, err)
+	return names, nil
+}
+
+// 从classpath中读出class文件的原始字节, 不解析
+func (m *MethodArea) readClassBytes(fullyQualifiedName string) ([]byte, error) {
+	if path, err := m.findClassFilePath(fullyQualifiedName); nil == err {
+		return ioutil.ReadFile(path)
 	}
 
-	return defFile, nil
+	return m.findClassBuf(fullyQualifiedName)
 }
 
 func (m *MethodArea) findClassFilePath(fullyQualifiedName string) (string, error) {
 
-	for _, cp := range m.ClassPaths {
+	for _, cp := range m.classPathSnapshot() {
 		possiblePath := cp + "/" + fullyQualifiedName + ".class"
 		_, err := os.Stat(possiblePath)
 		if nil == err {
@@ -131,39 +582,117 @@ func (m *MethodArea) findClassFilePath(fullyQualifiedName string) (string, error
 
 	}
 
-	return "", fmt.Errorf("cannot found class '%s' in classpath", fullyQualifiedName)
+	return "", &ClassNotFoundError{ClassName: fullyQualifiedName}
 }
 
 func (m *MethodArea) findClassBuf(fullyQualifiedName string) ([]byte, error) {
-	var classFileBuf []byte
+	destName := fullyQualifiedName + ".class"
 
-	for _, cp := range m.ClassPaths {
+	for _, cp := range m.classPathSnapshot() {
 		if !strings.HasSuffix(cp, ".jar") {
 			continue
 		}
 
-		destName := fullyQualifiedName + ".class"
+		jar, err := m.openJar(cp)
+		if nil != err {
+			utils.LogErrorPrintf("failed to open jar '%s': %v", cp, err)
+			continue
+		}
 
-		// 构造访问zip文件所需要的函数
-		predicate := func(f *zip.File) bool {
-			return f.Name == destName
+		classFileBuf, err := jar.ReadFile(destName)
+		if nil != err {
+			return nil, fmt.Errorf("failed to read '%s' from '%s': %w", destName, cp, err)
+		}
+		if 0 != len(classFileBuf) {
+			return classFileBuf, nil
 		}
+	}
+
+	return nil, &ClassNotFoundError{ClassName: fullyQualifiedName}
+}
 
-		visitor := func(reader io.Reader) (bool, error) {
-			buf, err := ioutil.ReadAll(reader)
-			classFileBuf = buf
+// 打开并缓存jar包, 同一个jar只映射一次
+func (m *MethodArea) openJar(path string) (*utils.MappedZip, error) {
+	m.jarsLock.Lock()
+	defer m.jarsLock.Unlock()
 
-			return true, err
+	if jar, ok := m.jars[path]; ok {
+		return jar, nil
+	}
+
+	jar, err := utils.OpenMappedZip(path)
+	if nil != err {
+		return nil, err
+	}
+	if nil == m.jars {
+		m.jars = make(map[string]*utils.MappedZip)
+	}
+	m.jars[path] = jar
+
+	return jar, nil
+}
+
+// 解除jar包的映射并关闭; 从jar加载的类直接引用映射的内存, 调用之后不能再使用这个方法区以及其中的类
+func (m *MethodArea) Close() error {
+	m.jarsLock.Lock()
+	defer m.jarsLock.Unlock()
+
+	var firstErr error
+	for path, jar := range m.jars {
+		if err := jar.Close(); nil != err && nil == firstErr {
+			firstErr = fmt.Errorf("failed to close jar '%s': %w", path, err)
 		}
+	}
+	m.jars = nil
 
-		utils.VisitZip(cp, predicate, visitor)
+	return firstErr
+}
+
+// 把内存中的jar包加到classpath末尾, 用于没有文件系统的环境(如浏览器);
+// name只用于标识和错误信息, 不需要对应真实的文件, 不是.jar结尾时自动补上;
+// name已经在classpath中时(如创建方法区时传入的占位名)只登记内容, 不重复添加
+func (m *MethodArea) AddJarBytes(name string, data []byte) error {
+	if !strings.HasSuffix(name, ".jar") {
+		name += ".jar"
+	}
+
+	jar, err := utils.NewMemoryZip(data)
+	if nil != err {
+		return fmt.Errorf("failed to open jar '%s': %w", name, err)
 	}
 
-	if 0 != len(classFileBuf) {
-		return classFileBuf, nil
+	m.jarsLock.Lock()
+	if nil == m.jars {
+		m.jars = make(map[string]*utils.MappedZip)
 	}
+	m.jars[name] = jar
+	m.jarsLock.Unlock()
 
-	return nil, fmt.Errorf("cannot found class '%s' in classpath", fullyQualifiedName)
+	m.classPathsLock.Lock()
+	defer m.classPathsLock.Unlock()
+	for _, cp := range m.ClassPaths {
+		if name == cp {
+			return nil
+		}
+	}
+	m.ClassPaths = append(m.ClassPaths, name)
+
+	return nil
+}
+
+// 把目录加到classpath最前面, 优先于已有的类路径
+func (m *MethodArea) PrependClassPath(dir string) {
+	m.classPathsLock.Lock()
+	m.ClassPaths = append([]string{dir}, m.ClassPaths...)
+	m.classPathsLock.Unlock()
+}
+
+// 当前classpath的副本, 遍历期间其他goroutine可以继续添加类路径
+func (m *MethodArea) classPathSnapshot() []string {
+	m.classPathsLock.RLock()
+	defer m.classPathsLock.RUnlock()
+
+	return append([]string(nil), m.ClassPaths...)
 }
 
 // 为指定class初始化虚方法表;
@@ -182,16 +711,17 @@ func (m *MethodArea) initVTable(def *class.DefFile) error {
 			_, isPublic := flagMap[accflag.Public]
 			_, isProtected := flagMap[accflag.Protected]
 			_, isNative := flagMap[accflag.Native]
+			_, isStatic := flagMap[accflag.Static]
 
-			// 只添加public, protected, native方法
-			if !isPublic && !isProtected && !isNative {
+			// 只添加public, protected, native方法, static方法不参与虚分派
+			if (!isPublic && !isProtected && !isNative) || isStatic {
 				// 跳过
 				continue
 			}
 
 			// 取出方法名和描述符
-			name := def.ConstPool[methodInfo.NameIndex].(*class.Utf8InfoConst).String()
-			descriptor := def.ConstPool[methodInfo.DescriptorIndex].(*class.Utf8InfoConst).String()
+			name := def.ConstPool.At(methodInfo.NameIndex).(*class.Utf8InfoConst).String()
+			descriptor := def.ConstPool.At(methodInfo.DescriptorIndex).(*class.Utf8InfoConst).String()
 			// 忽略构造方法
 			if name == "<init>" {
 				continue
@@ -209,11 +739,11 @@ func (m *MethodArea) initVTable(def *class.DefFile) error {
 		return nil
 	}
 
-	superClassInfo := def.ConstPool[superClassIndex].(*class.ClassInfoConstInfo)
+	superClassInfo := def.ConstPool.At(superClassIndex).(*class.ClassInfoConstInfo)
 	// 取出父类全名
-	superClassFullName := def.ConstPool[superClassInfo.FullClassNameIndex].(*class.Utf8InfoConst).String()
+	superClassFullName := def.ConstPool.At(superClassInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
 	// 加载父类
-	superDef, err := m.LoadClass(superClassFullName)
+	superDef, err := m.ResolveClass(superClassFullName)
 	if nil != err {
 		return fmt.Errorf("cannot load parent class '%s'", superClassFullName)
 	}
@@ -242,8 +772,8 @@ func (m *MethodArea) initVTable(def *class.DefFile) error {
 	// 遍历自己的方法元数据, 替换或者追加虚方法表
 	for _, methodInfo := range def.Methods {
 		// 取出方法名和描述符
-		name := def.ConstPool[methodInfo.NameIndex].(*class.Utf8InfoConst).String()
-		descriptor := def.ConstPool[methodInfo.DescriptorIndex].(*class.Utf8InfoConst).String()
+		name := def.ConstPool.At(methodInfo.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(methodInfo.DescriptorIndex).(*class.Utf8InfoConst).String()
 		// 忽略构造方法
 		if name == "<init>" {
 			continue
@@ -254,8 +784,9 @@ func (m *MethodArea) initVTable(def *class.DefFile) error {
 		_, isPublic := flagMap[accflag.Public]
 		_, isProtected := flagMap[accflag.Protected]
 		_, isNative := flagMap[accflag.Native]
-		// 只添加public, protected, native方法
-		if !isPublic && !isProtected && !isNative {
+		_, isStatic := flagMap[accflag.Static]
+		// 只添加public, protected, native方法, static方法不参与虚分派
+		if (!isPublic && !isProtected && !isNative) || isStatic {
 			// 跳过
 			continue
 		}
@@ -283,6 +814,236 @@ func (m *MethodArea) initVTable(def *class.DefFile) error {
 		}
 	}
 
+	// 接口中的default方法
+	return m.addDefaultMethods(def)
+}
+
+// 把实现的接口(包括父接口)中的default方法加入虚方法表, 使invokeinterface可以统一通过虚方法表分派;
+// 类自己或父类中已经有实现时不覆盖, 只有抽象方法时用default方法替换
+func (m *MethodArea) addDefaultMethods(def *class.DefFile) error {
+	visited := make(map[string]bool)
+	pending := interfaceNamesOf(def)
+
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		ifaceDef, err := m.ResolveClass(name)
+		if nil != err {
+			return fmt.Errorf("cannot load interface '%s': %w", name, err)
+		}
+		pending = append(pending, interfaceNamesOf(ifaceDef)...)
+
+		for _, methodInfo := range ifaceDef.Methods {
+			if methodInfo.AccessFlags & (accflag.Abstarct | accflag.Static | accflag.Private) > 0 {
+				continue
+			}
+
+			methodName := ifaceDef.ConstPool.At(methodInfo.NameIndex).(*class.Utf8InfoConst).String()
+			descriptor := ifaceDef.ConstPool.At(methodInfo.DescriptorIndex).(*class.Utf8InfoConst).String()
+			if "<clinit>" == methodName {
+				continue
+			}
+
+			found := false
+			for _, item := range def.VTable {
+				if item.MethodName == methodName && item.MethodDescriptor == descriptor {
+					if item.MethodInfo.AccessFlags & accflag.Abstarct > 0 {
+						item.MethodInfo = methodInfo
+					}
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				def.VTable = append(def.VTable, &class.VTableItem{
+					MethodName:       methodName,
+					MethodDescriptor: descriptor,
+					MethodInfo:       methodInfo,
+				})
+			}
+		}
+	}
+
 	return nil
+}
+
+// 按JVMS 5.4.3.2的顺序查找声明了static字段的类: 类自身, 直接父接口(递归), 父类(递归); 结果会被缓存
+func (m *MethodArea) ResolveStaticField(def *class.DefFile, name string) (*class.DefFile, error) {
+	key := staticFieldKey{def, name}
+	if owner, ok := m.staticFieldOwners.Load(key); ok {
+		return owner.(*class.DefFile), nil
+	}
+
+	owner, err := m.lookupStaticField(def, name)
+	if nil != err {
+		return nil, err
+	}
+	if nil == owner {
+		return nil, fmt.Errorf("java.lang.NoSuchFieldError: %s.%s", def.FullClassName, name)
+	}
+
+	m.staticFieldOwners.Store(key, owner)
+	return owner, nil
+}
+
+// 找不到时返回nil
+func (m *MethodArea) lookupStaticField(def *class.DefFile, name string) (*class.DefFile, error) {
+	if _, ok := def.GetStaticFieldValue(name); ok {
+		return def, nil
+	}
+
+	// 父接口
+	for _, ifaceName := range interfaceNamesOf(def) {
+		ifaceDef, err := m.ResolveClass(ifaceName)
+		if nil != err {
+			return nil, fmt.Errorf("cannot load interface '%s': %w", ifaceName, err)
+		}
+
+		owner, err := m.lookupStaticField(ifaceDef, name)
+		if nil != owner || nil != err {
+			return owner, err
+		}
+	}
+
+	// 父类
+	if 0 == def.SuperClass {
+		return nil, nil
+	}
+	superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+	superName := def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+	superDef, err := m.ResolveClass(superName)
+	if nil != err {
+		return nil, fmt.Errorf("cannot load parent class '%s': %w", superName, err)
+	}
+
+	return m.lookupStaticField(superDef, name)
+}
+
+// ref是否为targetName类型的实例, 即instanceof的结果(JVMS 6.5 instanceof), null不是任何类型的实例;
+// targetName为类的全名或者数组描述符, 如com/fh/Foo, [I, [Ljava/lang/String;
+func (m *MethodArea) IsInstanceOf(ref *class.Reference, targetName string) (bool, error) {
+	if nil == ref {
+		return false, nil
+	}
+	if class.ReferanceTypeArray == ref.RefType {
+		return m.isAssignableFrom(targetName, arrayDescriptor(ref.Array))
+	}
+
+	return m.IsSubClassOf(ref.Object.DefFile, targetName)
+}
+
+// sourceName类型的值能否赋给targetName类型, 两者都是类的全名或者数组描述符;
+// 数组只能赋给Object, Cloneable, Serializable, 以及元素类型可以赋值的数组类型, 基本类型的元素类型必须相同
+func (m *MethodArea) isAssignableFrom(targetName string, sourceName string) (bool, error) {
+	if targetName == sourceName {
+		return true, nil
+	}
+
+	if !strings.HasPrefix(sourceName, "[") {
+		if strings.HasPrefix(targetName, "[") {
+			return false, nil
+		}
+
+		sourceDef, err := m.ResolveClass(sourceName)
+		if nil != err {
+			return false, err
+		}
+		return m.IsSubClassOf(sourceDef, targetName)
+	}
+
+	switch targetName {
+	case "java/lang/Object", "java/lang/Cloneable", "java/io/Serializable":
+		return true, nil
+	}
+	if !strings.HasPrefix(targetName, "[") {
+		return false, nil
+	}
+
+	// 比较元素类型, 只有引用类型的元素可能不同但兼容
+	sourceElem, targetElem := sourceName[1:], targetName[1:]
+	if !isReferenceDescriptor(sourceElem) || !isReferenceDescriptor(targetElem) {
+		return false, nil
+	}
+
+	return m.isAssignableFrom(descriptorClassName(targetElem), descriptorClassName(sourceElem))
+}
+
+// 数组的描述符, 如[I, [Ljava/lang/String;, [[I
+func arrayDescriptor(arr *class.Array) string {
+	if "" == arr.ObjectType {
+		return "[" + arrayElementDescriptor(arr.Type)
+	}
+	if strings.HasPrefix(arr.ObjectType, "[") {
+		return "[" + arr.ObjectType
+	}
+
+	return "[L" + arr.ObjectType + ";"
+}
+
+func isReferenceDescriptor(desc string) bool {
+	return strings.HasPrefix(desc, "L") || strings.HasPrefix(desc, "[")
+}
+
+// Lcom/fh/Foo;转换成com/fh/Foo, 数组描述符不变
+func descriptorClassName(desc string) string {
+	if strings.HasPrefix(desc, "L") {
+		return strings.TrimSuffix(desc[1:], ";")
+	}
+
+	return desc
+}
+
+// def是否为targetName本身, 或者是它的子类或实现类
+func (m *MethodArea) IsSubClassOf(def *class.DefFile, targetName string) (bool, error) {
+	if "java/lang/Object" == targetName {
+		return true, nil
+	}
+
+	visited := make(map[string]bool)
+	pending := []*class.DefFile{def}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current.FullClassName == targetName {
+			return true, nil
+		}
+
+		names := interfaceNamesOf(current)
+		if 0 != current.SuperClass {
+			superInfo := current.ConstPool.At(current.SuperClass).(*class.ClassInfoConstInfo)
+			names = append(names, current.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String())
+		}
+
+		for _, name := range names {
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			parentDef, err := m.ResolveClass(name)
+			if nil != err {
+				return false, fmt.Errorf("cannot load class '%s': %w", name, err)
+			}
+			pending = append(pending, parentDef)
+		}
+	}
+
+	return false, nil
+}
+
+// 类直接实现的接口全名
+func interfaceNamesOf(def *class.DefFile) []string {
+	names := make([]string, 0, len(def.Interfaces))
+	for _, index := range def.Interfaces {
+		info := def.ConstPool.At(index).(*class.ClassInfoConstInfo)
+		names = append(names, def.ConstPool.At(info.FullClassNameIndex).(*class.Utf8InfoConst).String())
+	}
 
+	return names
 }
@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentLoadClass(t *testing.T) {
+	miniJvm, err := NewMiniJvm("com.fh.ClassExtendTest", []string{"../testcase/classes", "../mini-lib/classes", rtJarPath})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	const goroutines = 16
+	defs := make([]*class.DefFile, goroutines)
+	errs := make([]error, goroutines)
+
+	var wg sync.WaitGroup
+	for ix := 0; ix < goroutines; ix++ {
+		wg.Add(1)
+		go func(ix int) {
+			defer wg.Done()
+			defs[ix], errs[ix] = miniJvm.MethodArea.LoadClass("com/fh/Student")
+		}(ix)
+	}
+	wg.Wait()
+
+	for ix := 0; ix < goroutines; ix++ {
+		if nil != errs[ix] {
+			t.Fatal(errs[ix])
+		}
+		// 所有goroutine拿到的必须是同一个DefFile
+		if defs[0] != defs[ix] {
+			t.Fatalf("class loaded more than once")
+		}
+	}
+
+	if 0 == len(defs[0].VTable) {
+		t.Fatal("vtable not initialized")
+	}
+}
+
+func TestMethodAreaClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mini-jvm-cp")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jarPath := filepath.Join(dir, "student.jar")
+	err = ioutil.WriteFile(jarPath, buildTestJar(t, map[string][]byte{"com/fh/Student.class": readTestClass(t, "com/fh/Student")}), 0644)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	ma, err := NewMethodArea(nil, []string{jarPath}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := ma.ParseClass("com/fh/Student"); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(ma.jars) {
+		t.Fatalf("expect 1 mapped jar, got %d", len(ma.jars))
+	}
+
+	if err := ma.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if 0 != len(ma.jars) {
+		t.Fatal("jars should be closed")
+	}
+}
+
+func TestAddJarBytesWhileLoading(t *testing.T) {
+	// app0.jar是创建方法区时的占位名, 添加时只登记内容
+	ma, err := NewMethodArea(nil, []string{"app0.jar"}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jar := buildTestJar(t, map[string][]byte{"com/fh/Student.class": readTestClass(t, "com/fh/Student")})
+	if err := ma.AddJarBytes("app0", jar); nil != err {
+		t.Fatal(err)
+	}
+
+	// 添加jar包的同时在其他goroutine中遍历classpath
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for ix := 0; ix < goroutines; ix++ {
+		wg.Add(2)
+		go func(ix int) {
+			defer wg.Done()
+			if err := ma.AddJarBytes(fmt.Sprintf("app%d", ix + 1), jar); nil != err {
+				t.Error(err)
+			}
+		}(ix)
+		go func() {
+			defer wg.Done()
+			ma.readClassBytes("com/fh/Missing")
+			if _, err := ma.ListClassNames(); nil != err {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if goroutines + 1 != len(ma.classPathSnapshot()) {
+		t.Fatalf("unexpected classpath %v", ma.ClassPaths)
+	}
+}
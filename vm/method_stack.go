@@ -1,31 +1,121 @@
 package vm
 
-import "github.com/wanghongfei/mini-jvm/vm/class"
+import (
+	"context"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
 
 // 方法栈的栈帧
 type MethodStackFrame struct {
 	// 本地变量表
 	localVariablesTable []interface{}
+	// int型本地变量, localVariablesTable中对应位置为intSlot, 与OpStack的int槽相同
+	localInts []int64
 
 	// 操作数栈
 	opStack *OpStack
 
 	// 程序计数器
 	pc int
+
+	// 栈深度, 线程的第一个栈帧为1
+	depth int
+
+	// 调用者的栈帧, 线程的第一个栈帧为nil
+	prevFrame *MethodStackFrame
+
+	// 正在执行的方法和code属性, 线程启动时构造的辅助栈帧为nil
+	method *class.MethodInfo
+	codeAttr *class.CodeAttr
+
+	// 当前线程对应的java/lang/Thread对象, 只保存在线程的第一个栈帧中
+	threadRef *class.Reference
+
+	// 线程编号, 线程的第一个栈帧中一定有值, 执行引擎创建栈帧时从调用者复制
+	threadID int64
+
+	// 方法的返回类型, return指令据此检查
+	returnKind returnKind
+
+	// 正在执行的invoke指令, 被调用者的栈帧还没有返回时有效, 用于包装被调用者返回的错误
+	callOpcode byte
+
+	// 线程的资源消耗计数器, 设置了ThreadLimits时才有值
+	usage *threadUsage
+
+	// 方法的指令执行计数器, 设置了Coverage时第一条指令执行前才赋值
+	coverage *methodHits
+
+	// 本栈帧持有的锁(synchronized方法和monitorenter), 按加锁顺序排列
+	monitors []*class.Monitor
 }
 
 func newMethodStackFrame(opStackDepth int, localVarTableAmount int) *MethodStackFrame {
 	return &MethodStackFrame{
 		localVariablesTable: make([]interface{}, localVarTableAmount),
+		localInts:           make([]int64, localVarTableAmount),
 		opStack:             NewOpStack(opStackDepth),
 		pc:                  0,
 	}
 }
 
+// 新线程的根栈帧, 没有栈帧的调用者(宿主代码, 本地方法启动的goroutine)用它表明自己的线程身份
+func newRootFrame() *MethodStackFrame {
+	return &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+}
+
 func (f *MethodStackFrame) GetLocalTableIntAt(index int) int {
+	if _, ok := f.localVariablesTable[index].(intSlot); ok {
+		return int(f.localInts[index])
+	}
+
 	return f.localVariablesTable[index].(int)
 }
 
+// 保存int型本地变量, 不装箱
+func (f *MethodStackFrame) setLocalTableIntAt(index int, v int) {
+	f.localVariablesTable[index] = intSlot{}
+	f.localInts[index] = int64(v)
+}
+
+func (f *MethodStackFrame) GetLocalTableLongAt(index int) int64 {
+	return toInt64(f.localVariablesTable[index])
+}
+
+// 保存long型本地变量, 占index和index + 1两个槽, 后一个槽被清空
+func (f *MethodStackFrame) setLocalTableLongAt(index int, v int64) {
+	f.localVariablesTable[index] = v
+	if index + 1 < len(f.localVariablesTable) {
+		f.localVariablesTable[index + 1] = nil
+	}
+}
+
+func (f *MethodStackFrame) GetLocalTableFloatAt(index int) float32 {
+	return toFloat32(f.localVariablesTable[index])
+}
+
+func (f *MethodStackFrame) GetLocalTableDoubleAt(index int) float64 {
+	return toFloat64(f.localVariablesTable[index])
+}
+
+// 保存double型本地变量, 与long一样占index和index + 1两个槽
+func (f *MethodStackFrame) setLocalTableDoubleAt(index int, v float64) {
+	f.localVariablesTable[index] = v
+	if index + 1 < len(f.localVariablesTable) {
+		f.localVariablesTable[index + 1] = nil
+	}
+}
+
+// 按原样取出本地变量, int槽中的值会装箱
+func (f *MethodStackFrame) getLocalTableAt(index int) interface{} {
+	if _, ok := f.localVariablesTable[index].(intSlot); ok {
+		return int(f.localInts[index])
+	}
+
+	return f.localVariablesTable[index]
+}
+
 func (f *MethodStackFrame) GetLocalTableObjectAt(index int) *class.Reference {
 	elem := f.localVariablesTable[index]
 	if nil == elem {
@@ -34,3 +124,34 @@ func (f *MethodStackFrame) GetLocalTableObjectAt(index int) *class.Reference {
 
 	return elem.(*class.Reference)
 }
+
+// 加锁并记录在本栈帧中, 同一线程可以重入; ctx被取消时放弃等待并返回ExecutionCancelledError
+func (f *MethodStackFrame) enterMonitor(ctx context.Context, lock *class.Monitor) error {
+	if err := lock.Enter(ctx, f.ThreadID()); nil != err {
+		return cancelledError("monitorenter", err)
+	}
+	f.monitors = append(f.monitors, lock)
+
+	return nil
+}
+
+// 释放本栈帧持有的锁, 不是本栈帧加的锁返回IllegalMonitorStateException
+func (f *MethodStackFrame) exitMonitor(lock *class.Monitor) error {
+	for ix := len(f.monitors) - 1; ix >= 0; ix-- {
+		if lock == f.monitors[ix] {
+			f.monitors = append(f.monitors[:ix], f.monitors[ix + 1:]...)
+			return lock.Exit(f.ThreadID())
+		}
+	}
+
+	return fmt.Errorf("java.lang.IllegalMonitorStateException: monitor not owned by current frame")
+}
+
+// 方法结束(包括抛出异常)时按加锁的相反顺序释放本栈帧还持有的锁;
+// wait()被取消时没有重新加锁, 这时的释放失败被忽略
+func (f *MethodStackFrame) releaseMonitors() {
+	for ix := len(f.monitors) - 1; ix >= 0; ix-- {
+		f.monitors[ix].Exit(f.ThreadID())
+	}
+	f.monitors = nil
+}
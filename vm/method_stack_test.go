@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 其他线程等待获取锁, 超时说明锁没有被释放
+func lockWithin(lock *class.Monitor, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if nil != lock.Enter(ctx, -1) {
+		return false
+	}
+	lock.Exit(-1)
+	return true
+}
+
+func TestFrameMonitors(t *testing.T) {
+	frame := newMethodStackFrame(1, 0)
+	frame.threadID = 1
+	methodLock := new(class.Monitor)
+	blockLock := new(class.Monitor)
+	ctx := context.Background()
+
+	frame.enterMonitor(ctx, methodLock)
+	frame.enterMonitor(ctx, blockLock)
+	if err := frame.exitMonitor(blockLock); nil != err {
+		t.Fatal(err)
+	}
+	if err := frame.exitMonitor(blockLock); nil == err {
+		t.Fatal("expected IllegalMonitorStateException")
+	}
+	if !lockWithin(blockLock, time.Second) {
+		t.Fatal("monitor not released by monitorexit")
+	}
+
+	// 同一线程重入, 抛出异常时还没有执行monitorexit的锁
+	frame.enterMonitor(ctx, blockLock)
+	frame.enterMonitor(ctx, blockLock)
+	frame.releaseMonitors()
+	if !lockWithin(methodLock, time.Second) || !lockWithin(blockLock, time.Second) {
+		t.Fatal("monitors not released when frame exits")
+	}
+}
+
+// 宿主取消执行时, 等待锁的线程返回ExecutionCancelledError
+func TestFrameMonitorCancelled(t *testing.T) {
+	lock := new(class.Monitor)
+	if err := lock.Enter(context.Background(), 2); nil != err {
+		t.Fatal(err)
+	}
+
+	frame := newMethodStackFrame(1, 0)
+	frame.threadID = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+
+	err := frame.enterMonitor(ctx, lock)
+	var cancelled *ExecutionCancelledError
+	if !errors.As(err, &cancelled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect ExecutionCancelledError, got %v", err)
+	}
+	if 0 != len(frame.monitors) || "cancelled" != NewErrorReport(err).Kind {
+		t.Fatal("cancelled monitor should not be recorded")
+	}
+}
+
+// static int depth(int n) { return 0 == n ? 0 : depth(n - 1) + 1; }
+func newDepthTestJvm(t *testing.T) (*MiniJvm, *class.DefFile) {
+	b := newClassBuilder("com/fh/Depth", "java/lang/Object")
+	code := newCodeAssembler().
+		emit(bcode.Iload0).
+		jump(bcode.Ifne, "recurse").
+		emit(bcode.Iconst0, bcode.Ireturn).
+		label("recurse").
+		emit(bcode.Iload0, bcode.Iconst1, bcode.Isub).
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Depth", "depth", "(I)I")).
+		emit(bcode.Iconst1, bcode.Iadd, bcode.Ireturn)
+	b.method(accflag.Static, "depth", "(I)I", 2, 1, code)
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return jvm, b.def
+}
+
+// java方法之间的调用不占用go的调用栈, 调用深度只受MaxStackDepth限制
+func TestDeepRecursionUsesFrameStack(t *testing.T) {
+	jvm, def := newDepthTestJvm(t)
+
+	// go栈限制在1MB, 每层java调用都嵌套go调用时远远不够
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	const depth = 200000
+	frame := newMethodStackFrame(1, 0)
+	frame.opStack.PushInt(depth)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "depth", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if ret, _ := frame.opStack.PopInt(); depth != ret {
+		t.Fatalf("expect %d, got %d", depth, ret)
+	}
+
+	jvm.MaxStackDepth = 100
+	frame.opStack.PushInt(depth)
+	err := jvm.ExecutionEngine.ExecuteWithFrame(def, "depth", "(I)I", frame, false)
+	if nil == err || !strings.Contains(err.Error(), "java.lang.StackOverflowError") {
+		t.Fatalf("expect StackOverflowError, got %v", err)
+	}
+	if strings.Count(err.Error(), "failed to execute 'invokestatic'") != 100 {
+		t.Fatalf("error should be wrapped once per unwound frame: %v", err)
+	}
+}
@@ -1,10 +1,18 @@
 package vm
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
 	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
 	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // VM定义
@@ -14,6 +22,8 @@ type MiniJvm struct {
 
 	// 方法区
 	MethodArea *MethodArea
+	// 创建方法区时解析classpath(下载远程jar包, 转换dex, 展开fat jar)的选项, 为nil时使用默认选项
+	ClassPathOptions *ClassPathOptions
 
 	// MainClass全限定性名
 	MainClass string
@@ -24,8 +34,131 @@ type MiniJvm struct {
 	// 本地方法表
 	NativeMethodTable *NativeMethodTable
 
-	// 保存调用print的历史记录, 单元测试用
+	// 用go实现替代字节码的热点方法(如String.hashCode, Math.max), 解释执行前先查此表
+	IntrinsicTable *NativeMethodTable
+	// 禁用IntrinsicTable, 所有方法都解释执行字节码, 用于一致性测试
+	DisableIntrinsics bool
+
+	// 执行main之前先沿调用图链接所有可达的类和方法, 一次性报告所有缺失项
+	EagerLink bool
+	// 加载类时不链接字节码, 每个方法第一次执行时才解码code属性并链接;
+	// 类中从不执行的方法不会解码, 代价是字节码错误推迟到执行时才发现
+	LazyLink bool
+	// 严格按JLS 12.4初始化类: 只有主动使用(new, 读写静态字段, 调用静态方法, 主类)才执行<clinit>,
+	// 访问继承的静态成员只初始化声明它的类; <clinit>抛出的异常不再被忽略, 而是报告ExceptionInInitializerError
+	StrictInit bool
+
+	// 保存调用print的历史记录, 单元测试用; 为nil时不记录(默认), 需要时先设置为非nil的空切片;
+	// Deprecated: 没有容量限制, 多线程读取不安全, 使用Output代替
 	DebugPrintHistory []interface{}
+	debugPrintLock sync.Mutex
+
+	// 捕获guest程序的输出, 单元测试用, 为nil时不捕获
+	Output *OutputCapture
+
+	// 时钟, 默认使用宿主机时间
+	Clock Clock
+
+	// 默认Locale(如en_US)和时区ID(如Asia/Shanghai), 默认取宿主机环境
+	Locale string
+	TimeZone string
+
+	// 允许反序列化的类, 为空时不做限制
+	SerializationAllowlist []string
+
+	// 敏感本地方法(文件, 网络, 进程, 环境变量, 反射, 退出)的安全策略, 为nil时不做限制
+	Policy *Policy
+	// 遇到尚未实现的字节码, 本地方法和属性时的处理策略, 为nil时报错终止
+	Unsupported *UnsupportedPolicy
+
+	// guest中HttpClient使用的客户端, 为nil时使用http.DefaultClient
+	HTTPClient *http.Client
+	// guest中Files使用的文件系统, 为nil时相对路径基于宿主进程的当前目录
+	FileSystem *FileSystem
+
+	// 本地方法调用的审计记录, 为nil时不记录
+	NativeAudit *NativeCallAudit
+
+	// 指令追踪, 为nil时不追踪
+	Tracer *Tracer
+
+	// 字段观察点, 为nil时不检查
+	Watchpoints *Watchpoints
+
+	// 异常断点, 为nil时不检查
+	ExceptionBreakpoints *ExceptionBreakpoints
+
+	// 最近执行的指令的快照, 为nil时不记录
+	History *ExecutionHistory
+
+	// 指令级代码覆盖率, 为nil时不统计
+	Coverage *Coverage
+
+	// 加载类时按规则改写字节码(入口日志, 计数, 延迟), 为nil时不改写
+	Rewriter *Rewriter
+
+	// 启动时按清单提前解析和链接类, 见PreloadManifest; 为nil时不预加载
+	Preload *PreloadManifest
+	// 记录加载的类和执行的方法, 用于生成下次启动的Preload, 为nil时不记录
+	PreloadRecorder *PreloadRecorder
+
+	// 系统属性(命令行-Dkey=value), guest通过System.getProperty()或mini-lib中的Environment.getProperty()读取;
+	// 没有设置的user.language, user.country等由Locale和TimeZone得到
+	Properties map[string]string
+
+	// 最大栈深度, 超过时抛出StackOverflowError, 0表示不限制
+	MaxStackDepth int
+
+	// 每个guest线程的资源限制, 超过时只终止该线程; 不为nil时统计每个线程的消耗, 见ThreadUsage()
+	ThreadLimits *ThreadLimits
+	// key: 线程编号, val: *threadUsage
+	threadUsages sync.Map
+	// 还在运行的MiniThread, join使用; key: MiniThread对象的引用, val: *MiniThread
+	miniThreads sync.Map
+
+	// 统计解释器创建的每个对象, 用于HeapHistogram(); 需要在执行之前设置
+	TrackHeap bool
+	heap heapTracker
+
+	// 大于0时在执行期间按此间隔在后台执行DeduplicateStrings(), 让内容相同的String共享value数组
+	StringDedupInterval time.Duration
+	stringDedup stringDeduplicator
+
+	// 本地方法通过ObjectHandle钉住的对象
+	pinned pinnedObjects
+
+	// 通过BindChannel注册给guest的channel, guest中用HostChannel.open(name)打开
+	channels map[string]chan interface{}
+	channelsLock sync.Mutex
+
+	// 通过BindDatabase注册给guest的数据库, guest中用Connection.open(name)打开
+	databases map[string]*sql.DB
+	databasesLock sync.Mutex
+
+	// guest程序通过java.util.logging.Logger输出的日志, 默认输出INFO及以上级别到stderr
+	Logger utils.Logger
+	// guest中getLogger()返回的对象, 同名返回同一个
+	guestLoggers map[string]*class.Reference
+	guestLoggersLock sync.Mutex
+
+	// 控制台输入, Scanner和BufferedReader从这里读取, 默认为os.Stdin
+	Stdin io.Reader
+	// Printer的输出, 为nil时输出到宿主的标准输出
+	Stdout io.Writer
+	// System.exit()时不退出宿主进程, 见RunMain
+	captureExit bool
+	stdinReader *bufio.Reader
+	stdinLock sync.Mutex
+
+	// 宿主的context, 取消或到期时正在等待锁、wait()和join()的guest线程以ExecutionCancelledError终止; 为nil时不会被取消
+	Context context.Context
+
+	// 执行统计
+	stats *vmStats
+
+	// 第一次致命错误的位置, 见WriteCrashBundle
+	crash *crashSite
+	crashLock sync.Mutex
 }
 
 type ExecutionEngine interface {
@@ -37,6 +170,11 @@ type ExecutionEngine interface {
 }
 
 func NewMiniJvm(mainClass string, classPaths []string, cmdArgs... string) (*MiniJvm, error) {
+	return NewMiniJvmWithOptions(mainClass, classPaths, nil, cmdArgs...)
+}
+
+// 与NewMiniJvm相同, 按options解析classpath; options为nil时使用默认选项
+func NewMiniJvmWithOptions(mainClass string, classPaths []string, options *ClassPathOptions, cmdArgs... string) (*MiniJvm, error) {
 	if "" == mainClass {
 		return nil, fmt.Errorf("invalid main class '%s'", mainClass)
 	}
@@ -50,8 +188,16 @@ func NewMiniJvm(mainClass string, classPaths []string, cmdArgs... string) (*Mini
 	vm := &MiniJvm{
 		CmdArgs:  vmArgs,
 		MethodArea: nil,
+		ClassPathOptions: options,
 		MainClass:  strings.ReplaceAll(mainClass, ".", "/"),
-		DebugPrintHistory: make([]interface{}, 0, 3),
+		Output: NewOutputCapture(defaultOutputCaptureCapacity),
+		Clock: SystemClock,
+		Locale: hostDefaultLocale(),
+		TimeZone: hostDefaultTimeZone(),
+		Stdin: os.Stdin,
+		Stdout: hostStdout,
+		Logger: utils.NewWriterLogger(hostStderr, utils.LogLevelInfo),
+		stats: new(vmStats),
 	}
 
 	// 方法区
@@ -65,37 +211,232 @@ func NewMiniJvm(mainClass string, classPaths []string, cmdArgs... string) (*Mini
 	vm.ExecutionEngine = NewInterpretedExecutionEngine(vm)
 
 	// 本地方法表
+	vm.NativeMethodTable = newBuiltinNativeMethodTable()
+	vm.IntrinsicTable = newBuiltinIntrinsicTable()
+
+	return vm, nil
+}
+
+// 创建本地方法表并注册所有内置的本地方法
+func newBuiltinNativeMethodTable() *NativeMethodTable {
 	nativeMethodTable := NewNativeMethodTable()
-	vm.NativeMethodTable = nativeMethodTable
-	// 注册本地方法
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "print", "(I)V", PrintInt)
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "printInt", "(I)V", PrintInt)
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "printInt2", "(II)V", PrintInt2)
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "printChar", "(C)V", PrintChar)
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "printString", "(Ljava/lang/String;)V", PrintString)
 	nativeMethodTable.RegisterMethod("cn.minijvm.io.Printer", "printBool", "(Z)V", PrintBoolean)
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.io.Printer", "printObject", "(Ljava/lang/Object;)V", PrintObject)
+
+	nativeMethodTable.RegisterMethod("cn.minijvm.io.ObjectSerializer", "serialize", "(Ljava/lang/Object;)[B", ObjectSerializerSerialize)
+	nativeMethodTable.RegisterMethod("cn.minijvm.io.ObjectSerializer", "deserialize", "([B)Ljava/lang/Object;", ObjectSerializerDeserialize)
 
 	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.MiniThread", "start", "(Ljava/lang/Runnable;)V", ExecuteInThread)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.MiniThread", "join", "(J)V", MiniThreadJoin)
 	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.MiniThread", "sleepCurrentThread", "(I)V", ThreadSleep)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.MiniThread", "yieldCurrentThread", "()V", ThreadYield)
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.concurrency.MiniThread", "setCurrentThreadPriority", "(I)V", MiniThreadSetCurrentThreadPriority)
+
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.agent.Probe", "enter", "(I)V", ProbeEnter)
+
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.Executors", "newFixedThreadPool", "(I)Ljava/util/concurrent/ExecutorService;", ExecutorsNewFixedThreadPool)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.Executors", "newSingleThreadExecutor", "()Ljava/util/concurrent/ExecutorService;", ExecutorsNewSingleThreadExecutor)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.Executors", "newCachedThreadPool", "()Ljava/util/concurrent/ExecutorService;", ExecutorsNewCachedThreadPool)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "execute", "(Ljava/lang/Runnable;)V", ExecutorServiceExecute)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "submit", "(Ljava/util/concurrent/Callable;)Ljava/util/concurrent/Future;", ExecutorServiceSubmitCallable)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "submit", "(Ljava/lang/Runnable;)Ljava/util/concurrent/Future;", ExecutorServiceSubmitRunnable)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "shutdown", "()V", ExecutorServiceShutdown)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "isShutdown", "()Z", ExecutorServiceIsShutdown)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "isTerminated", "()Z", ExecutorServiceIsTerminated)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoExecutorService", "awaitTermination", "(JLjava/util/concurrent/TimeUnit;)Z", ExecutorServiceAwaitTermination)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoFuture", "get", "()Ljava/lang/Object;", FutureGet)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoFuture", "get", "(JLjava/util/concurrent/TimeUnit;)Ljava/lang/Object;", FutureGetTimeout)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoFuture", "isDone", "()Z", FutureIsDone)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoFuture", "cancel", "(Z)Z", FutureCancel)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.GoFuture", "isCancelled", "()Z", FutureIsCancelled)
+
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "supplyAsync", "(Ljava/util/function/Supplier;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureSupplyAsync)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "runAsync", "(Ljava/lang/Runnable;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureRunAsync)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "completedFuture", "(Ljava/lang/Object;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureCompletedFuture)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.concurrent.CompletableFuture", "thenApply", "(Ljava/util/function/Function;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureThenApply)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.concurrent.CompletableFuture", "thenAccept", "(Ljava/util/function/Consumer;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureThenAccept)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.concurrent.CompletableFuture", "thenRun", "(Ljava/lang/Runnable;)Ljava/util/concurrent/CompletableFuture;", CompletableFutureThenRun)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.concurrent.CompletableFuture", "complete", "(Ljava/lang/Object;)Z", CompletableFutureComplete)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "join", "()Ljava/lang/Object;", CompletableFutureJoin)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "get", "()Ljava/lang/Object;", CompletableFutureGet)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "getNow", "(Ljava/lang/Object;)Ljava/lang/Object;", CompletableFutureGetNow)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.concurrent.CompletableFuture", "isDone", "()Z", CompletableFutureIsDone)
+
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.HostChannel", "open", "(Ljava/lang/String;)Lcn/minijvm/concurrency/HostChannel;", HostChannelOpen)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.HostChannel", "put", "(Ljava/lang/Object;)V", HostChannelPut)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.HostChannel", "offer", "(Ljava/lang/Object;J)Z", HostChannelOffer)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.HostChannel", "take", "()Ljava/lang/Object;", HostChannelTake)
+	nativeMethodTable.RegisterMethod("cn.minijvm.concurrency.HostChannel", "poll", "(J)Ljava/lang/Object;", HostChannelPoll)
+
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.Connection", "open", "(Ljava/lang/String;)Lcn/minijvm/sql/Connection;", PermissionDatabase, SQLConnectionOpen)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.Connection", "createStatement", "()Lcn/minijvm/sql/Statement;", PermissionDatabase, SQLConnectionCreateStatement)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.Statement", "executeQuery", "(Ljava/lang/String;[Ljava/lang/Object;)Lcn/minijvm/sql/ResultSet;", PermissionDatabase, SQLStatementExecuteQuery)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.Statement", "executeUpdate", "(Ljava/lang/String;[Ljava/lang/Object;)I", PermissionDatabase, SQLStatementExecuteUpdate)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "next", "()Z", PermissionDatabase, SQLResultSetNext)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "getObject", "(Ljava/lang/String;)Ljava/lang/Object;", PermissionDatabase, SQLResultSetGetObject)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "getString", "(Ljava/lang/String;)Ljava/lang/String;", PermissionDatabase, SQLResultSetGetString)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "getInt", "(Ljava/lang/String;)I", PermissionDatabase, SQLResultSetGetInt)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "getLong", "(Ljava/lang/String;)J", PermissionDatabase, SQLResultSetGetLong)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.sql.ResultSet", "close", "()V", PermissionDatabase, SQLResultSetClose)
+
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.lang.StackWalker", "getStackDepth", "()I", StackWalkerGetStackDepth)
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.lang.StackWalker", "getCallerClassName", "()Ljava/lang/String;", StackWalkerGetCallerClassName)
+	nativeMethodTable.RegisterFrameAwareMethod("cn.minijvm.lang.StackWalker", "getStackTrace", "()[Ljava/lang/String;", StackWalkerGetStackTrace)
 
 	nativeMethodTable.RegisterMethod("java.lang.Object", "hashCode", "()I", ObjectHashCode)
 	nativeMethodTable.RegisterMethod("java.lang.Object", "clone", "()Ljava/lang/Object;", ObjectClone)
 	nativeMethodTable.RegisterMethod("java.lang.Object", "getClass", "()Ljava/lang/Class;", ObjectGetClass)
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Object", "wait", "(J)V", ObjectWait)
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Object", "notify", "()V", ObjectNotify)
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Object", "notifyAll", "()V", ObjectNotifyAll)
+
+	nativeMethodTable.RegisterMethod("java.lang.String", "intern", "()Ljava/lang/String;", StringIntern)
 
 	nativeMethodTable.RegisterMethod("java.lang.Class", "getName0", "()Ljava/lang/String;", ClassGetName0)
 	nativeMethodTable.RegisterMethod("java.lang.Class", "isInterface", "()Z", ClassIsInterface)
 	nativeMethodTable.RegisterMethod("java.lang.Class", "isPrimitive", "()Z", ClassIsPrimitive)
 
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Thread", "currentThread", "()Ljava/lang/Thread;", ThreadCurrentThread)
+	nativeMethodTable.RegisterMethod("java.lang.Thread", "yield", "()V", ThreadYield)
+	// JDK的setPriority依赖ThreadGroup, 必须由go实现
+	nativeMethodTable.RegisterIntrinsicMethod("java.lang.Thread", "setPriority", "(I)V", ThreadSetPriority)
+
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Throwable", "fillInStackTrace", "(I)Ljava/lang/Throwable;", ThrowableFillInStackTrace)
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Throwable", "getStackTraceDepth", "()I", ThrowableGetStackTraceDepth)
+	nativeMethodTable.RegisterFrameAwareMethod("java.lang.Throwable", "getStackTraceElement", "(I)Ljava/lang/StackTraceElement;", ThrowableGetStackTraceElement)
+
 	//public static native void arraycopy(Object src,  int  srcPos,
 	//	Object dest, int destPos,
 	//	int length);
 	nativeMethodTable.RegisterMethod("java.lang.System", "arraycopy", "(Ljava/lang/Object;ILjava/lang/Object;II)V", SystemArrayCopy)
+	nativeMethodTable.RegisterMethod("java.lang.System", "currentTimeMillis", "()J", SystemCurrentTimeMillis)
+	nativeMethodTable.RegisterMethod("java.lang.System", "nanoTime", "()J", SystemNanoTime)
+	nativeMethodTable.RegisterIntrinsicMethod("java.lang.System", "getProperty", "(Ljava/lang/String;)Ljava/lang/String;", SystemGetProperty)
+	nativeMethodTable.RegisterIntrinsicMethod("java.lang.System", "getProperty", "(Ljava/lang/String;Ljava/lang/String;)Ljava/lang/String;", SystemGetPropertyWithDefault)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.security.AccessController", "doPrivileged", "(Ljava/security/PrivilegedAction;)Ljava/lang/Object;", AccessControllerDoPrivileged)
+	nativeMethodTable.RegisterSensitiveMethod("java.lang.ProcessEnvironment", "environ", "()[[B", PermissionEnv, ProcessEnvironmentEnviron)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.net.HttpClient", "send", "(Ljava/lang/String;Ljava/lang/String;[Ljava/lang/String;[B)Lcn/minijvm/net/HttpResponse;", PermissionNetwork, HttpClientSend)
+	nativeMethodTable.RegisterSensitiveMethod("java.lang.Shutdown", "halt0", "(I)V", PermissionExit, ShutdownHalt0)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "readString", "(Ljava/lang/String;)Ljava/lang/String;", PermissionFile, FilesReadString)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "writeString", "(Ljava/lang/String;Ljava/lang/String;)V", PermissionFile, FilesWriteString)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "appendString", "(Ljava/lang/String;Ljava/lang/String;)V", PermissionFile, FilesAppendString)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "exists", "(Ljava/lang/String;)Z", PermissionFile, FilesExists)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "delete", "(Ljava/lang/String;)Z", PermissionFile, FilesDelete)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "list", "(Ljava/lang/String;)[Ljava/lang/String;", PermissionFile, FilesList)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "tryLock", "(Ljava/lang/String;)Z", PermissionFile, FilesTryLock)
+	nativeMethodTable.RegisterSensitiveMethod("cn.minijvm.io.Files", "unlock", "(Ljava/lang/String;)V", PermissionFile, FilesUnlock)
+	nativeMethodTable.RegisterMethod("cn.minijvm.io.Files", "isCaseSensitive", "()Z", FilesIsCaseSensitive)
+	nativeMethodTable.RegisterMethod("jdk.internal.misc.VM", "getNanoTimeAdjustment", "(J)J", VMGetNanoTimeAdjustment)
 
-	return vm, nil
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "registerNatives", "()V", UnsafeRegisterNatives)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "objectFieldOffset", "(Ljava/lang/reflect/Field;)J", UnsafeObjectFieldOffset)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "arrayBaseOffset", "(Ljava/lang/Class;)I", UnsafeArrayBaseOffset)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "arrayIndexScale", "(Ljava/lang/Class;)I", UnsafeArrayIndexScale)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "compareAndSwapInt", "(Ljava/lang/Object;JII)Z", UnsafeCompareAndSwapInt)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "compareAndSwapLong", "(Ljava/lang/Object;JJJ)Z", UnsafeCompareAndSwapLong)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "compareAndSwapObject", "(Ljava/lang/Object;JLjava/lang/Object;Ljava/lang/Object;)Z", UnsafeCompareAndSwapObject)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "getIntVolatile", "(Ljava/lang/Object;J)I", UnsafeGetIntVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "getLongVolatile", "(Ljava/lang/Object;J)J", UnsafeGetLongVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "getObjectVolatile", "(Ljava/lang/Object;J)Ljava/lang/Object;", UnsafeGetObjectVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putIntVolatile", "(Ljava/lang/Object;JI)V", UnsafePutVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putObjectVolatile", "(Ljava/lang/Object;JLjava/lang/Object;)V", UnsafePutVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putOrderedInt", "(Ljava/lang/Object;JI)V", UnsafePutVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putOrderedObject", "(Ljava/lang/Object;JLjava/lang/Object;)V", UnsafePutVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putLongVolatile", "(Ljava/lang/Object;JJ)V", UnsafePutLongVolatile)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "putOrderedLong", "(Ljava/lang/Object;JJ)V", UnsafePutLongVolatile)
+	// 不执行构造方法就创建对象, 可以绕过构造方法中的检查
+	nativeMethodTable.RegisterSensitiveMethod("sun.misc.Unsafe", "allocateInstance", "(Ljava/lang/Class;)Ljava/lang/Object;", PermissionReflection, UnsafeAllocateInstance)
+	nativeMethodTable.RegisterFrameAwareMethod("sun.misc.Unsafe", "park", "(ZJ)V", UnsafePark)
+	nativeMethodTable.RegisterMethod("sun.misc.Unsafe", "unpark", "(Ljava/lang/Object;)V", UnsafeUnpark)
+
+	// java.util.logging的实现依赖LogManager和系统配置, 由go实现并转发到MiniJvm.Logger
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "getLogger", "(Ljava/lang/String;)Ljava/util/logging/Logger;", LoggerGetLogger)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "getName", "()Ljava/lang/String;", LoggerGetName)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "log", "(Ljava/util/logging/Level;Ljava/lang/String;)V", LoggerLog)
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "severe", "(Ljava/lang/String;)V", loggerLevelMethod("SEVERE", julLevelSevere))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "warning", "(Ljava/lang/String;)V", loggerLevelMethod("WARNING", julLevelWarning))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "info", "(Ljava/lang/String;)V", loggerLevelMethod("INFO", julLevelInfo))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "config", "(Ljava/lang/String;)V", loggerLevelMethod("CONFIG", julLevelConfig))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "fine", "(Ljava/lang/String;)V", loggerLevelMethod("FINE", julLevelFine))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "finer", "(Ljava/lang/String;)V", loggerLevelMethod("FINER", julLevelFiner))
+	nativeMethodTable.RegisterIntrinsicMethod("java.util.logging.Logger", "finest", "(Ljava/lang/String;)V", loggerLevelMethod("FINEST", julLevelFinest))
+
+	// Scanner和BufferedReader依赖的JDK实现无法解释执行, 必须由go实现, 不受DisableIntrinsics影响;
+	// 包装System.in时读取MiniJvm.Stdin, 包装其他流时调用它的read()
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "<init>", "(Ljava/io/InputStream;)V", ConsoleReaderInit)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "nextLine", "()Ljava/lang/String;", ScannerNextLine)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "next", "()Ljava/lang/String;", ScannerNext)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "nextInt", "()I", ScannerNextInt)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "hasNextLine", "()Z", ScannerHasNextLine)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.util.Scanner", "close", "()V", ConsoleReaderClose)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.io.InputStreamReader", "<init>", "(Ljava/io/InputStream;)V", ConsoleReaderInit)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.io.BufferedReader", "<init>", "(Ljava/io/Reader;)V", BufferedReaderInit)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.io.BufferedReader", "readLine", "()Ljava/lang/String;", BufferedReaderReadLine)
+	nativeMethodTable.RegisterFrameAwareIntrinsicMethod("java.io.BufferedReader", "close", "()V", ConsoleReaderClose)
+
+	nativeMethodTable.RegisterMethod("java.util.TimeZone", "getSystemTimeZoneID", "(Ljava/lang/String;)Ljava/lang/String;", TimeZoneGetSystemTimeZoneID)
+	nativeMethodTable.RegisterMethod("java.util.TimeZone", "getSystemGMTOffsetID", "()Ljava/lang/String;", TimeZoneGetSystemGMTOffsetID)
+	nativeMethodTable.RegisterMethod("cn.minijvm.lang.Environment", "getDefaultLocale", "()Ljava/lang/String;", EnvironmentGetDefaultLocale)
+	nativeMethodTable.RegisterMethod("cn.minijvm.lang.Environment", "getDefaultTimeZone", "()Ljava/lang/String;", EnvironmentGetDefaultTimeZone)
+	nativeMethodTable.RegisterMethod("cn.minijvm.lang.Environment", "getProperty", "(Ljava/lang/String;)Ljava/lang/String;", EnvironmentGetProperty)
+
+	return nativeMethodTable
+}
+
+// 热点方法的go实现, 可以通过DisableIntrinsics关闭;
+// System.arraycopy等本身就是native的方法在本地方法表中, 不需要放在这里
+func newBuiltinIntrinsicTable() *NativeMethodTable {
+	intrinsicTable := NewNativeMethodTable()
+
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "length", "()I", StringLength)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "charAt", "(I)C", StringCharAt)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "equals", "(Ljava/lang/Object;)Z", StringEquals)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "hashCode", "()I", StringHashCode)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "substring", "(I)Ljava/lang/String;", StringSubstring)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "substring", "(II)Ljava/lang/String;", StringSubstringRange)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "concat", "(Ljava/lang/String;)Ljava/lang/String;", StringConcat)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "indexOf", "(I)I", StringIndexOfChar)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.String", "indexOf", "(Ljava/lang/String;)I", StringIndexOfString)
+
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "max", "(II)I", MathMaxInt)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "max", "(JJ)J", MathMaxLong)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "min", "(II)I", MathMinInt)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "min", "(JJ)J", MathMinLong)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "abs", "(I)I", MathAbsInt)
+	intrinsicTable.RegisterIntrinsicMethod("java.lang.Math", "abs", "(J)J", MathAbsLong)
+
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([II)V", ArraysFill)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([CC)V", ArraysFill)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([BB)V", ArraysFill)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([ZZ)V", ArraysFill)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([Ljava/lang/Object;Ljava/lang/Object;)V", ArraysFill)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([IIII)V", ArraysFillRange)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([CIIC)V", ArraysFillRange)
+	intrinsicTable.RegisterIntrinsicMethod("java.util.Arrays", "fill", "([Ljava/lang/Object;IILjava/lang/Object;)V", ArraysFillRange)
+
+	return intrinsicTable
 }
 
 // 启动VM
 func (m *MiniJvm) Start() error {
+	if nil != m.Preload {
+		m.PreloadClasses(m.Preload)
+	}
+
+	if m.EagerLink {
+		if report := m.LinkReachable(m.MainClass); len(report.Problems) > 0 {
+			return &LinkError{Report: report}
+		}
+	}
+
+	stopDedup := m.startStringDedup()
+	defer stopDedup()
+
 	return m.executeMain()
 }
 
@@ -110,3 +451,12 @@ func (m *MiniJvm) executeMain() error {
 	// log.Printf("main class info: %+v\n", mainClassDef)
 	return m.ExecutionEngine.Execute(mainClassDef, "main")
 }
+
+// 宿主的context, 没有设置时返回永远不会取消的context.Background()
+func (m *MiniJvm) hostContext() context.Context {
+	if nil == m.Context {
+		return context.Background()
+	}
+
+	return m.Context
+}
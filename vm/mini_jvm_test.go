@@ -21,7 +21,35 @@ func TestHelloNative(t *testing.T) {
 	}
 
 	// assert
-	if 5050 != miniJvm.DebugPrintHistory[0] {
+	if 5050 != miniJvm.Output.Values()[0] {
+		t.FailNow()
+	}
+}
+
+func TestStats(t *testing.T) {
+	miniJvm, err := NewMiniJvm("com.fh.ForLoopPrintTest", []string{"../testcase/classes", "../mini-lib/classes", rtJarPath})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	err = miniJvm.Start()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// assert
+	stats := miniJvm.Stats()
+	if 0 == stats.ClassesLoaded {
+		t.FailNow()
+	}
+	// main + 100次add, 加载rt.jar中的类时执行的<clinit>也会计入
+	if stats.FramesCreated < 101 || stats.MaxStackDepth < 2 {
+		t.FailNow()
+	}
+	if stats.NativeCalls < 1 {
+		t.FailNow()
+	}
+	if stats.ByteCodes["iadd"] < 100 {
 		t.FailNow()
 	}
 }
@@ -38,7 +66,7 @@ func TestHelloClass(t *testing.T) {
 	}
 
 	// assert
-	if 5050 != miniJvm.DebugPrintHistory[0] {
+	if 5050 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
 }
@@ -55,7 +83,7 @@ func TestHelloMethod(t *testing.T) {
 	}
 
 	// assert
-	if 300 != miniJvm.DebugPrintHistory[0] {
+	if 300 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
 }
@@ -74,10 +102,10 @@ func TestClassExtend(t *testing.T) {
 	}
 
 	// assert
-	if 1 != miniJvm.DebugPrintHistory[0] {
+	if 1 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 10 != miniJvm.DebugPrintHistory[1] {
+	if 10 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
 }
@@ -96,10 +124,10 @@ func TestRecursion(t *testing.T) {
 	}
 
 	// assert
-	if 1 != miniJvm.DebugPrintHistory[0] {
+	if 1 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 100 != miniJvm.DebugPrintHistory[99] {
+	if 100 != miniJvm.Output.Values()[99] {
 		t.FailNow()
 	}
 }
@@ -116,10 +144,10 @@ func TestIfTest(t *testing.T) {
 	}
 
 	// assert
-	if -301 != miniJvm.DebugPrintHistory[0] {
+	if -301 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if -301 != miniJvm.DebugPrintHistory[1] {
+	if -301 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
 }
@@ -137,29 +165,29 @@ func TestArray(t *testing.T) {
 
 
 	// assert
-	if 1 != miniJvm.DebugPrintHistory[0] {
+	if 1 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 2 != miniJvm.DebugPrintHistory[1] {
+	if 2 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
-	if 3 != miniJvm.DebugPrintHistory[2] {
+	if 3 != miniJvm.Output.Values()[2] {
 		t.FailNow()
 	}
-	if 4 != miniJvm.DebugPrintHistory[3] {
+	if 4 != miniJvm.Output.Values()[3] {
 		t.FailNow()
 	}
-	if int('好') != miniJvm.DebugPrintHistory[4] {
+	if int('好') != miniJvm.Output.Values()[4] {
 		t.FailNow()
 	}
-	if int('吗') != miniJvm.DebugPrintHistory[5] {
+	if int('吗') != miniJvm.Output.Values()[5] {
 		t.FailNow()
 	}
 
-	if 3 != miniJvm.DebugPrintHistory[6] {
+	if 3 != miniJvm.Output.Values()[6] {
 		t.FailNow()
 	}
-	if 5 != miniJvm.DebugPrintHistory[7] {
+	if 5 != miniJvm.Output.Values()[7] {
 		t.FailNow()
 	}
 }
@@ -176,10 +204,10 @@ func TestObjectArray(t *testing.T) {
 	}
 
 	// assert
-	if 0 != miniJvm.DebugPrintHistory[0] {
+	if 0 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 100 != miniJvm.DebugPrintHistory[1] {
+	if 100 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
 }
@@ -196,13 +224,13 @@ func TestInterface(t *testing.T) {
 	}
 
 	// assert
-	if 100 != miniJvm.DebugPrintHistory[0] {
+	if 100 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 100 != miniJvm.DebugPrintHistory[1] {
+	if 100 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
-	if 500 != miniJvm.DebugPrintHistory[2] {
+	if 500 != miniJvm.Output.Values()[2] {
 		t.FailNow()
 	}
 }
@@ -219,13 +247,13 @@ func TestExceptionCase1(t *testing.T) {
 	}
 
 	// assert
-	if 10 != miniJvm.DebugPrintHistory[0] {
+	if 10 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 20 != miniJvm.DebugPrintHistory[1] {
+	if 20 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
-	if 30 != miniJvm.DebugPrintHistory[2] {
+	if 30 != miniJvm.Output.Values()[2] {
 		t.FailNow()
 	}
 }
@@ -242,10 +270,10 @@ func TestExceptionCase2(t *testing.T) {
 	}
 
 	// assert
-	if 10 != miniJvm.DebugPrintHistory[0] {
+	if 10 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
-	if 30 != miniJvm.DebugPrintHistory[1] {
+	if 30 != miniJvm.Output.Values()[1] {
 		t.FailNow()
 	}
 }
@@ -262,10 +290,10 @@ func TestExceptionCase3(t *testing.T) {
 	}
 
 	// assert
-	if 1 != len(miniJvm.DebugPrintHistory) {
+	if 1 != len(miniJvm.Output.Values()) {
 		t.FailNow()
 	}
-	if 10 != miniJvm.DebugPrintHistory[0] {
+	if 10 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
 }
@@ -282,10 +310,10 @@ func TestExceptionCase4(t *testing.T) {
 	}
 
 	// assert
-	if 1 != len(miniJvm.DebugPrintHistory) {
+	if 1 != len(miniJvm.Output.Values()) {
 		t.FailNow()
 	}
-	if 20 != miniJvm.DebugPrintHistory[0] {
+	if 20 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
 }
@@ -302,7 +330,7 @@ func TestHanoi(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if 127 != miniJvm.DebugPrintHistory[0] {
+	if 127 != miniJvm.Output.Values()[0] {
 		t.FailNow()
 	}
 }
@@ -319,10 +347,10 @@ func TestStaticField(t *testing.T) {
 	}
 
 	// assert
-	if 100 != miniJvm.DebugPrintHistory[0].(*class.ObjectField).FieldValue {
+	if 100 != miniJvm.Output.Values()[0].(*class.ObjectField).FieldValue {
 		t.FailNow()
 	}
-	if 400 != miniJvm.DebugPrintHistory[1].(*class.ObjectField).FieldValue {
+	if 400 != miniJvm.Output.Values()[1].(*class.ObjectField).FieldValue {
 		t.FailNow()
 	}
 }
@@ -352,12 +380,12 @@ func TestString(t *testing.T) {
 	}
 
 	// assert
-	arrRef := miniJvm.DebugPrintHistory[0].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	arrRef := miniJvm.Output.Values()[0].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
 	runeArr := utils.InterfaceArrayToRuneArray(arrRef.Array.Data)
 	if "hello, 世界" != string(runeArr) {
 		t.FailNow()
 	}
-	arrRef = miniJvm.DebugPrintHistory[1].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	arrRef = miniJvm.Output.Values()[1].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
 	runeArr = utils.InterfaceArrayToRuneArray(arrRef.Array.Data)
 	if "数字战斗模拟" != string(runeArr) {
 		t.FailNow()
@@ -389,20 +417,46 @@ func TestReflection(t *testing.T) {
 	}
 
 	// asset
-	arrRef := miniJvm.DebugPrintHistory[0].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	arrRef := miniJvm.Output.Values()[0].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
 	runeArr := utils.InterfaceArrayToRuneArray(arrRef.Array.Data)
 	if "java.lang.Class" != string(runeArr) {
 		t.FailNow()
 	}
-	arrRef = miniJvm.DebugPrintHistory[1].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	arrRef = miniJvm.Output.Values()[1].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
 	runeArr = utils.InterfaceArrayToRuneArray(arrRef.Array.Data)
 	if "java.lang.Class" != string(runeArr) {
 		t.FailNow()
 	}
-	arrRef = miniJvm.DebugPrintHistory[4].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	arrRef = miniJvm.Output.Values()[4].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
 	runeArr = utils.InterfaceArrayToRuneArray(arrRef.Array.Data)
 	if "class java.lang.Class" != string(runeArr) {
 		t.FailNow()
 	}
 
-}
\ No newline at end of file
+}
+func TestStackTrace(t *testing.T) {
+	miniJvm, err := NewMiniJvm("com.fh.StackTraceTest", []string{"../testcase/classes", "../mini-lib/classes", rtJarPath})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	err = miniJvm.Start()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// assert
+	if 1 != miniJvm.Output.Values()[0] {
+		t.FailNow()
+	}
+	if 2 != miniJvm.Output.Values()[1] {
+		t.FailNow()
+	}
+	if 2 != miniJvm.Output.Values()[2] {
+		t.FailNow()
+	}
+	arrRef := miniJvm.Output.Values()[3].(*class.Reference).Object.ObjectFields["value"].FieldValue.(*class.Reference)
+	if "com.fh.StackTraceTest.foo(StackTraceTest.java:15)" != string(utils.InterfaceArrayToRuneArray(arrRef.Array.Data)) {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestMultianewarray(t *testing.T) {
+	b := newClassBuilder("com/fh/Matrix", "java/lang/Object")
+	matrixType := b.classRef("[[I")
+	// static int calc(int rows, int cols) { int[][] m = new int[rows][cols]; m[1][2] = 5; return m.length + m[0].length + m[1][2]; }
+	b.method(accflag.Static, "calc", "(II)I", 4, 3, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iload1).emitIndex(bcode.Multianewarray, matrixType).emit(2, bcode.Astore2).
+		emit(bcode.Aload2, bcode.Iconst1, bcode.Aaload, bcode.Iconst2, bcode.Iconst5, bcode.Iastore).
+		emit(bcode.Aload2, bcode.Arraylength).
+		emit(bcode.Aload2, bcode.Iconst0, bcode.Aaload, bcode.Arraylength, bcode.Iadd).
+		emit(bcode.Aload2, bcode.Iconst1, bcode.Aaload, bcode.Iconst2, bcode.Iaload, bcode.Iadd, bcode.Ireturn))
+	// static int[][] matrix(int rows, int cols) { return new int[rows][cols]; }
+	b.method(accflag.Static, "matrix", "(II)[[I", 2, 2, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iload1).emitIndex(bcode.Multianewarray, matrixType).emit(2, bcode.Areturn))
+
+	jvm, err := newClassInitTestJvm(b.def, newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.TrackHeap = true
+	call := func(name string, descriptor string, rows int, cols int) (interface{}, error) {
+		frame := newMethodStackFrame(2, 0)
+		frame.opStack.Push(rows)
+		frame.opStack.Push(cols)
+		err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, name, descriptor, frame, false)
+		ret, _ := frame.opStack.Pop()
+		return ret, err
+	}
+
+	if ret, err := call("calc", "(II)I", 2, 7); nil != err || 14 != ret {
+		t.Fatalf("expect 14, got %v, %v", ret, err)
+	}
+	// 外层数组和每一行都算作一次分配
+	matrix, err := call("matrix", "(II)[[I", 2, 7)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if histogram := jvm.HeapHistogram(); 1 != histogram["[[I"] || 2 != histogram["[I"] {
+		t.Fatalf("unexpected histogram %v", histogram)
+	}
+	if rows := matrix.(*class.Reference).Array; 2 != rows.Len() || 7 != rows.Load(1).(*class.Reference).Array.Len() {
+		t.Fatal("unexpected matrix size")
+	}
+	if _, err := call("calc", "(II)I", 2, -1); nil == err || !strings.Contains(err.Error(), "java.lang.NegativeArraySizeException: -1") {
+		t.Fatalf("expect NegativeArraySizeException, got %v", err)
+	}
+
+	attrs, _ := b.def.Methods[0].Attributes()
+	expect := fmt.Sprintf("multianewarray #%d, 2 // class [[I", matrixType)
+	if text := formatInstruction(b.def, attrs[0].(*class.CodeAttr).Code, 2, 4); expect != text {
+		t.Fatalf("unexpected disassembly %s", text)
+	}
+
+	// 只指定前两维时最内层为null, 数组类型与anewarray创建的一致
+	arrRef, err := class.NewMultiArray("[[[Ljava/lang/String;", []int{2, 3})
+	if nil != err {
+		t.Fatal(err)
+	}
+	row := arrRef.Array.Load(1).(*class.Reference)
+	if "[[[Ljava/lang/String;" != arrayDescriptor(arrRef.Array) || "[[Ljava/lang/String;" != arrayDescriptor(row.Array) || 3 != row.Array.Len() || nil != row.Array.Load(0) {
+		t.Fatalf("unexpected array %s, %s", arrayDescriptor(arrRef.Array), arrayDescriptor(row.Array))
+	}
+	if ok, _ := jvm.MethodArea.IsInstanceOf(row, "[[Ljava/lang/Object;"); !ok {
+		t.Fatal("String[][] should be an instance of Object[][]")
+	}
+	if _, err := class.NewMultiArray("[I", []int{2, 3}); nil == err {
+		t.Fatal("expect error for too many dimensions")
+	}
+}
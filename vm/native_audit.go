@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审计记录中每个参数保留的最大长度
+const nativeAuditArgMaxLen = 64
+
+// 一次本地方法调用的审计记录
+type NativeCallRecord struct {
+	Time time.Time
+
+	// 本地方法, 类名用/分隔
+	ClassName  string
+	MethodName string
+	Descriptor string
+
+	// 参数的字符串形式(不含jvm指针和接收者), 过长时截断
+	Args []string
+
+	// 调用者栈帧, 没有调用者时为空
+	Caller string
+
+	// 调用所在的线程编号, 主线程为1
+	ThreadID int64
+}
+
+func (r *NativeCallRecord) String() string {
+	return fmt.Sprintf("%s [thread %d] %s.%s%s(%s) <- %s", r.Time.Format("15:04:05.000000"), r.ThreadID,
+		r.ClassName, r.MethodName, r.Descriptor, strings.Join(r.Args, ", "), r.Caller)
+}
+
+// 本地方法调用的审计记录, 只保留最近capacity条;
+// 可以被多个线程同时写入
+type NativeCallAudit struct {
+	lock sync.Mutex
+
+	records []*NativeCallRecord
+	// 下一条记录写入的位置
+	next int
+	// 是否已经写满过一轮
+	full bool
+}
+
+func NewNativeCallAudit(capacity int) *NativeCallAudit {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	return &NativeCallAudit{records: make([]*NativeCallRecord, capacity)}
+}
+
+func (a *NativeCallAudit) Record(rec *NativeCallRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.records[a.next] = rec
+	a.next++
+	if len(a.records) == a.next {
+		a.next = 0
+		a.full = true
+	}
+}
+
+// 返回所有记录, 从旧到新排列
+func (a *NativeCallAudit) Records() []*NativeCallRecord {
+	return a.Query(nil)
+}
+
+// 返回满足条件的记录, 从旧到新排列; filter为nil时返回全部
+func (a *NativeCallAudit) Query(filter func(rec *NativeCallRecord) bool) []*NativeCallRecord {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var ordered []*NativeCallRecord
+	if a.full {
+		ordered = append(ordered, a.records[a.next:]...)
+	}
+	ordered = append(ordered, a.records[:a.next]...)
+
+	result := make([]*NativeCallRecord, 0, len(ordered))
+	for _, rec := range ordered {
+		if nil == filter || filter(rec) {
+			result = append(result, rec)
+		}
+	}
+
+	return result
+}
+
+// 按从旧到新的顺序输出所有记录
+func (a *NativeCallAudit) Dump(w io.Writer) {
+	for _, rec := range a.Records() {
+		fmt.Fprintln(w, rec)
+	}
+}
+
+// 生成一次本地方法调用的审计记录
+func newNativeCallRecord(className string, methodName string, descriptor string, args []interface{}, callerFrame *MethodStackFrame) *NativeCallRecord {
+	rec := &NativeCallRecord{
+		Time:       time.Now(),
+		ClassName:  className,
+		MethodName: methodName,
+		Descriptor: descriptor,
+		Args:       make([]string, len(args)),
+	}
+
+	for ix, arg := range args {
+		rec.Args[ix] = formatAuditArg(arg)
+	}
+
+	if nil != callerFrame {
+		rec.ThreadID = callerFrame.ThreadID()
+		callerFrame.Walk(func(frame *MethodStackFrame) bool {
+			rec.Caller = frame.stackTraceElement().String()
+			return false
+		})
+	}
+
+	return rec
+}
+
+// 审计日志中只展开一层, 显示对象的字段和数组的元素
+var auditArgRenderer = &ObjectRenderer{MaxDepth: 1, MaxElements: 8}
+
+// 参数的字符串形式, String显示内容, 其他对象和数组按字段和元素显示, 见ObjectRenderer
+func formatAuditArg(arg interface{}) string {
+	s := auditArgRenderer.Render(arg)
+
+	if len(s) > nativeAuditArgMaxLen {
+		s = s[:nativeAuditArgMaxLen] + "..."
+	}
+
+	return s
+}
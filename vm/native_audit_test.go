@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNativeCallAuditRingBuffer(t *testing.T) {
+	audit := NewNativeCallAudit(3)
+	for ix := 0; ix < 5; ix++ {
+		audit.Record(newNativeCallRecord("cn/minijvm/io/Printer", "printInt", "(I)V", []interface{}{ix}, nil))
+	}
+
+	// 只保留最近3条, 从旧到新排列
+	records := audit.Records()
+	if 3 != len(records) {
+		t.Fatalf("unexpected record count %d", len(records))
+	}
+	for ix, rec := range records {
+		if want := []string{"2", "3", "4"}[ix]; want != rec.Args[0] {
+			t.Fatalf("record %d: unexpected args %v", ix, rec.Args)
+		}
+	}
+
+	odd := audit.Query(func(rec *NativeCallRecord) bool {
+		return "3" == rec.Args[0]
+	})
+	if 1 != len(odd) {
+		t.Fatalf("unexpected query result %v", odd)
+	}
+
+	buf := new(bytes.Buffer)
+	audit.Dump(buf)
+	if 3 != strings.Count(buf.String(), "cn/minijvm/io/Printer.printInt(I)V(") {
+		t.Fatalf("unexpected dump:\n%s", buf.String())
+	}
+}
+
+func TestFormatAuditArgTruncate(t *testing.T) {
+	s := formatAuditArg(strings.Repeat("x", 100))
+	if nativeAuditArgMaxLen + 3 != len(s) || !strings.HasSuffix(s, "...") {
+		t.Fatalf("unexpected arg %q", s)
+	}
+}
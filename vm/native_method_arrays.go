@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// java.util.Arrays中的热点方法, 作为intrinsic替代字节码
+
+// public static void fill(int[] a, int val), 以及char[], byte[], boolean[], Object[]的重载
+func ArraysFill(args ...interface{}) interface{} {
+	if isNullReference(args[2]) {
+		return fmt.Errorf("java.lang.NullPointerException: Arrays.fill(null)")
+	}
+	arr := args[2].(*class.Reference).Array
+
+	return fillArray(arr, 0, arr.Len(), args[3])
+}
+
+// public static void fill(int[] a, int fromIndex, int toIndex, int val), 以及char[], Object[]的重载
+func ArraysFillRange(args ...interface{}) interface{} {
+	if isNullReference(args[2]) {
+		return fmt.Errorf("java.lang.NullPointerException: Arrays.fill(null)")
+	}
+	arr := args[2].(*class.Reference).Array
+
+	from, to := int(toInt64(args[3])), int(toInt64(args[4]))
+	if from > to {
+		return fmt.Errorf("java.lang.IllegalArgumentException: fromIndex(%d) > toIndex(%d)", from, to)
+	}
+	if from < 0 || to > arr.Len() {
+		return fmt.Errorf("java.lang.ArrayIndexOutOfBoundsException: Array index out of range: %d", to)
+	}
+
+	return fillArray(arr, from, to, args[5])
+}
+
+func fillArray(arr *class.Array, from int, to int, val interface{}) interface{} {
+	for ix := from; ix < to; ix++ {
+		arr.Store(ix, val)
+	}
+
+	return nil
+}
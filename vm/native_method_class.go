@@ -11,8 +11,17 @@ import (
 func ClassGetName0(args ...interface{}) interface{} {
 	jvm := args[0].(*MiniJvm)
 	ref := args[1].(*class.Reference)
-	className := ref.Object.DefFile.FullClassName
-	className = strings.ReplaceAll(className, "/", ".")
+	var className string
+	if nil != ref.Object.Mirror {
+		className = strings.ReplaceAll(ref.Object.Mirror.FullClassName, "/", ".")
+
+	} else if arrayName, ok := jvm.MethodArea.arrayClassNameOf(ref); ok {
+		// 数组类, 如[I, [Ljava.lang.String;
+		className = arrayName
+
+	} else {
+		return fmt.Errorf("failed to get class name: class object does not refer to a class")
+	}
 
 	stringRef, err := class.NewStringObject([]rune(className), jvm.MethodArea)
 	if nil != err {
@@ -26,7 +35,11 @@ func ClassGetName0(args ...interface{}) interface{} {
 func ClassIsInterface(args ...interface{}) interface{} {
 	//  取出class中的accFlag字段
 	ref := args[1].(*class.Reference)
-	flag := ref.Object.DefFile.AccessFlag
+	if nil == ref.Object.Mirror {
+		// 数组类不是接口
+		return false
+	}
+	flag := ref.Object.Mirror.AccessFlag
 	flagMap := accflag.ParseAccFlags(flag)
 	// 判断有没有interface标记位
 	if _, ok := flagMap[accflag.Interface]; ok {
@@ -0,0 +1,364 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 控制台输入;
+// Scanner, BufferedReader和InputStreamReader的常用方法由go实现. 包装的是System.in时从MiniJvm.Stdin读取,
+// 包装其他InputStream/Reader时调用它们的read()读取
+
+// Scanner, InputStreamReader或BufferedReader对象的go端状态
+type guestTextReader struct {
+	// 从MiniJvm.Stdin读取, 所有这样的对象共用jvm.stdin()和jvm.stdinLock
+	console bool
+	// 包装的其他输入流, console为false时使用
+	source *guestInputStream
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+// key: Scanner/InputStreamReader/BufferedReader对象, val: *guestTextReader; close()时删除.
+// BufferedReader包装InputStreamReader时两者共用同一个状态, 保证缓冲区中的数据不丢失
+var guestTextReaders sync.Map
+
+// 通过guest对象的read()方法读取的输入流; InputStream.read()返回字节, Reader.read()返回字符, 字符按UTF-8编码
+type guestInputStream struct {
+	jvm *MiniJvm
+	ref *class.Reference
+	isReader bool
+	// 当前调用者的栈帧, 每次读取前设置
+	frame *MethodStackFrame
+	// 字符编码后没有放下的字节
+	pending []byte
+}
+
+func (s *guestInputStream) Read(p []byte) (int, error) {
+	if 0 == len(s.pending) {
+		ret, err := s.jvm.invokeMethod(s.frame, s.ref, "read", "()I")
+		if nil != err {
+			return 0, err
+		}
+		val := toInt64(ret)
+		if val < 0 {
+			return 0, io.EOF
+		}
+
+		if s.isReader {
+			s.pending = []byte(string(rune(val)))
+		} else {
+			s.pending = []byte{byte(val)}
+		}
+	}
+
+	// 每次只读取一个字符, 不多读guest流中的数据
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// 多个线程共用同一个带缓冲的reader, 调用方需要持有stdinLock
+func (m *MiniJvm) stdin() *bufio.Reader {
+	if nil == m.stdinReader {
+		in := m.Stdin
+		if nil == in {
+			in = strings.NewReader("")
+		}
+		m.stdinReader = bufio.NewReader(in)
+	}
+
+	return m.stdinReader
+}
+
+// System.in的当前值, System类还没有加载时为null
+func (m *MiniJvm) systemIn() *class.Reference {
+	m.MethodArea.ClassMapLock.RLock()
+	systemDef := m.MethodArea.ClassMap["java/lang/System"]
+	m.MethodArea.ClassMapLock.RUnlock()
+	if nil == systemDef {
+		return nil
+	}
+
+	val, _ := systemDef.GetStaticFieldValue("in")
+	ref, _ := val.(*class.Reference)
+	return ref
+}
+
+// 加锁并返回读取用的reader, 用完后调用unlock()
+func (r *guestTextReader) lockReader(jvm *MiniJvm, frame *MethodStackFrame) *bufio.Reader {
+	if r.console {
+		jvm.stdinLock.Lock()
+		return jvm.stdin()
+	}
+
+	r.lock.Lock()
+	r.source.frame = frame
+	return r.reader
+}
+
+func (r *guestTextReader) unlock(jvm *MiniJvm) {
+	if r.console {
+		jvm.stdinLock.Unlock()
+		return
+	}
+
+	r.source.frame = nil
+	r.lock.Unlock()
+}
+
+// 读取一行, 去掉行尾的\n或\r\n; 已经没有输入时返回io.EOF
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if nil != err && (io.EOF != err || "" == line) {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// 查看下一个以空白分隔的token, 不读取; 返回token和读取它(包括前面的空白)需要跳过的字节数
+func peekToken(reader *bufio.Reader) (string, int, error) {
+	start := -1
+	for size := 0; ; size++ {
+		buf, err := reader.Peek(size + 1)
+		if len(buf) <= size {
+			if io.EOF == err && start >= 0 {
+				return string(buf[start:size]), size, nil
+			}
+			return "", 0, err
+		}
+
+		b := buf[size]
+		space := b < utf8.RuneSelf && unicode.IsSpace(rune(b))
+		if start < 0 {
+			if !space {
+				start = size
+			}
+
+		} else if space {
+			return string(buf[start:size]), size, nil
+		}
+	}
+}
+
+// 抛出java异常, 创建异常对象失败时返回错误
+func throwConsoleException(jvm *MiniJvm, frame *MethodStackFrame, className string, message string) interface{} {
+	exceptionRef, err := newJavaException(jvm, frame, className, message)
+	if nil != err {
+		return err
+	}
+	jvm.stats.onExceptionThrown()
+
+	return NewExceptionThrownError(exceptionRef)
+}
+
+// 读取guest输入流时的错误: guest抛出的异常原样传递, 其他错误作为IOException抛出
+func consoleReadError(jvm *MiniJvm, frame *MethodStackFrame, err error) interface{} {
+	if _, ok := err.(*ExceptionThrownError); ok {
+		return err
+	}
+
+	return throwConsoleException(jvm, frame, "java/io/IOException", err.Error())
+}
+
+// Scanner(InputStream), InputStreamReader(InputStream)的构造方法, 不执行java实现;
+// 参数是System.in时从MiniJvm.Stdin读取, 否则调用它的read()
+func ConsoleReaderInit(args ...interface{}) interface{} {
+	return initTextReader(args[0].(*MiniJvm), args[1].(*class.Reference), args[2], false, args[3].(*MethodStackFrame))
+}
+
+// BufferedReader(Reader)的构造方法, 包装的Reader也由go实现时共用它的状态
+func BufferedReaderInit(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+	frame := args[3].(*MethodStackFrame)
+
+	if in, ok := args[2].(*class.Reference); ok && nil != in {
+		if state, ok := guestTextReaders.Load(in); ok {
+			guestTextReaders.Store(ref, state)
+			return nil
+		}
+	}
+
+	return initTextReader(jvm, ref, args[2], true, frame)
+}
+
+func initTextReader(jvm *MiniJvm, ref *class.Reference, arg interface{}, isReader bool, frame *MethodStackFrame) interface{} {
+	in, _ := arg.(*class.Reference)
+	// System.in没有设置时为null, 同样作为控制台输入
+	if in == jvm.systemIn() {
+		guestTextReaders.Store(ref, &guestTextReader{console: true})
+		return nil
+	}
+	if nil == in {
+		return throwConsoleException(jvm, frame, "java/lang/NullPointerException", "")
+	}
+
+	source := &guestInputStream{jvm: jvm, ref: in, isReader: isReader}
+	guestTextReaders.Store(ref, &guestTextReader{source: source, reader: bufio.NewReader(source)})
+	return nil
+}
+
+// close(), 包装其他输入流时同时关闭它
+func ConsoleReaderClose(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+
+	state, ok := guestTextReaders.Load(args[1])
+	if !ok {
+		return nil
+	}
+	guestTextReaders.Delete(args[1])
+
+	if reader := state.(*guestTextReader); !reader.console {
+		if _, err := jvm.invokeMethod(frame, reader.source.ref, "close", "()V"); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 取出对象的go端状态, 已经关闭时抛出异常
+func textReaderOf(jvm *MiniJvm, ref interface{}, frame *MethodStackFrame, closedException string, closedMessage string) (*guestTextReader, interface{}) {
+	state, ok := guestTextReaders.Load(ref)
+	if !ok {
+		return nil, throwConsoleException(jvm, frame, closedException, closedMessage)
+	}
+
+	return state.(*guestTextReader), nil
+}
+
+// Scanner.nextLine()
+func ScannerNextLine(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+	state, thrown := textReaderOf(jvm, args[1], frame, "java/lang/IllegalStateException", "Scanner closed")
+	if nil != thrown {
+		return thrown
+	}
+
+	reader := state.lockReader(jvm, frame)
+	line, err := readLine(reader)
+	state.unlock(jvm)
+	if io.EOF == err {
+		return throwConsoleException(jvm, frame, "java/util/NoSuchElementException", "No line found")
+	}
+	if nil != err {
+		return consoleReadError(jvm, frame, err)
+	}
+
+	return newStringResult(jvm, line)
+}
+
+// Scanner.next()
+func ScannerNext(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+	state, thrown := textReaderOf(jvm, args[1], frame, "java/lang/IllegalStateException", "Scanner closed")
+	if nil != thrown {
+		return thrown
+	}
+
+	reader := state.lockReader(jvm, frame)
+	token, size, err := peekToken(reader)
+	if nil == err {
+		reader.Discard(size)
+	}
+	state.unlock(jvm)
+	if io.EOF == err {
+		return throwConsoleException(jvm, frame, "java/util/NoSuchElementException", "")
+	}
+	if nil != err {
+		return consoleReadError(jvm, frame, err)
+	}
+
+	return newStringResult(jvm, token)
+}
+
+// Scanner.nextInt(), 不是整数时抛出InputMismatchException, token留在输入中, 与Scanner一致
+func ScannerNextInt(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+	state, thrown := textReaderOf(jvm, args[1], frame, "java/lang/IllegalStateException", "Scanner closed")
+	if nil != thrown {
+		return thrown
+	}
+
+	reader := state.lockReader(jvm, frame)
+	token, size, err := peekToken(reader)
+	var num int64
+	var parseErr error
+	if nil == err {
+		num, parseErr = strconv.ParseInt(token, 10, 32)
+		if nil == parseErr {
+			reader.Discard(size)
+		}
+	}
+	state.unlock(jvm)
+	if io.EOF == err {
+		return throwConsoleException(jvm, frame, "java/util/NoSuchElementException", "")
+	}
+	if nil != err {
+		return consoleReadError(jvm, frame, err)
+	}
+	if nil != parseErr {
+		return throwConsoleException(jvm, frame, "java/util/InputMismatchException", fmt.Sprintf("For input string: \"%s\"", token))
+	}
+
+	return int(num)
+}
+
+// Scanner.hasNextLine()
+func ScannerHasNextLine(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+	state, thrown := textReaderOf(jvm, args[1], frame, "java/lang/IllegalStateException", "Scanner closed")
+	if nil != thrown {
+		return thrown
+	}
+
+	reader := state.lockReader(jvm, frame)
+	_, err := reader.Peek(1)
+	state.unlock(jvm)
+	if nil != err && io.EOF != err {
+		return consoleReadError(jvm, frame, err)
+	}
+
+	if nil == err {
+		return 1
+	}
+	return 0
+}
+
+// BufferedReader.readLine(), 没有输入时返回null
+func BufferedReaderReadLine(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+	state, thrown := textReaderOf(jvm, args[1], frame, "java/io/IOException", "Stream closed")
+	if nil != thrown {
+		return thrown
+	}
+
+	reader := state.lockReader(jvm, frame)
+	line, err := readLine(reader)
+	state.unlock(jvm)
+	if io.EOF == err {
+		// 返回null
+		return (*class.Reference)(nil)
+	}
+	if nil != err {
+		return consoleReadError(jvm, frame, err)
+	}
+
+	return newStringResult(jvm, line)
+}
@@ -0,0 +1,172 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func stringResult(t *testing.T, val interface{}) string {
+	ref, ok := val.(*class.Reference)
+	if !ok {
+		t.Fatalf("unexpected result %v", val)
+	}
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return string(runes)
+}
+
+// 控制台测试用的jvm: 定义了读取时会抛出的异常, 以及read()由go实现的输入流com/fh/BytesIn
+func newConsoleTestJvm(t *testing.T, guestInput string) *MiniJvm {
+	defs := []*class.DefFile{
+		newTestClass("java/lang/String", "java/lang/Object", nil),
+		newTestClass("java/io/InputStream", "java/lang/Object", nil),
+	}
+	for _, name := range []string{"java/util/NoSuchElementException", "java/util/InputMismatchException"} {
+		// XxxException(String s) { detailMessage = s; }
+		exception := newClassBuilder(name, "java/lang/Object")
+		exception.field("detailMessage", "Ljava/lang/String;")
+		exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+			emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef(name, "detailMessage", "Ljava/lang/String;")).
+			emit(bcode.Return))
+		defs = append(defs, exception.def)
+	}
+	bytesIn := newClassBuilder("com/fh/BytesIn", "java/io/InputStream")
+	bytesIn.method(accflag.Public | accflag.Native, "read", "()I", 0, 1, nil)
+	defs = append(defs, bytesIn.def)
+
+	jvm, err := newClassInitTestJvm(defs...)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	source := strings.NewReader(guestInput)
+	jvm.NativeMethodTable.RegisterMethod("com.fh.BytesIn", "read", "()I", func(args ...interface{}) interface{} {
+		b, err := source.ReadByte()
+		if nil != err {
+			return -1
+		}
+		return int(b)
+	})
+
+	return jvm
+}
+
+func newConsoleTestObject(t *testing.T, jvm *MiniJvm, className string) *class.Reference {
+	def, err := jvm.MethodArea.LoadClass(className)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return ref
+}
+
+func expectThrown(t *testing.T, val interface{}, className string) {
+	var thrown *ExceptionThrownError
+	if err, _ := val.(error); !errors.As(err, &thrown) || className != thrown.ExceptionRef.Object.DefFile.FullClassName {
+		t.Fatalf("expect %s, got %v", className, val)
+	}
+}
+
+func TestScannerInput(t *testing.T) {
+	jvm := newConsoleTestJvm(t, "")
+	jvm.Stdin = strings.NewReader("  42 7\nhello world\r\nabc")
+	frame := newMethodStackFrame(0, 0)
+
+	// new Scanner(System.in), System.in没有设置时为null
+	scanner := newConsoleTestObject(t, jvm, "java/lang/Object")
+	if nil != ConsoleReaderInit(jvm, scanner, (*class.Reference)(nil), frame) {
+		t.Fatal("failed to init scanner")
+	}
+
+	if 42 != ScannerNextInt(jvm, scanner, frame) {
+		t.Fatal("unexpected first int")
+	}
+	if 7 != ScannerNextInt(jvm, scanner, frame) {
+		t.Fatal("unexpected second int")
+	}
+	// 与Scanner一致, nextInt()之后nextLine()读到当前行剩下的部分
+	if "" != stringResult(t, ScannerNextLine(jvm, scanner, frame)) {
+		t.Fatal("expected rest of line")
+	}
+	if "hello" != stringResult(t, ScannerNext(jvm, scanner, frame)) {
+		t.Fatal("unexpected token")
+	}
+	if " world" != stringResult(t, ScannerNextLine(jvm, scanner, frame)) {
+		t.Fatal("unexpected line")
+	}
+
+	// 不是整数时抛出InputMismatchException, token留在输入中
+	expectThrown(t, ScannerNextInt(jvm, scanner, frame), "java/util/InputMismatchException")
+	if "abc" != stringResult(t, ScannerNext(jvm, scanner, frame)) {
+		t.Fatal("mismatched token should be left unread")
+	}
+
+	if 0 != ScannerHasNextLine(jvm, scanner, frame) {
+		t.Fatal("input should be exhausted")
+	}
+	expectThrown(t, ScannerNextLine(jvm, scanner, frame), "java/util/NoSuchElementException")
+}
+
+func TestBufferedReaderInput(t *testing.T) {
+	jvm := newConsoleTestJvm(t, "")
+	jvm.Stdin = strings.NewReader("first\nlast")
+	frame := newMethodStackFrame(0, 0)
+
+	// new BufferedReader(new InputStreamReader(System.in))
+	inputStreamReader := newConsoleTestObject(t, jvm, "java/lang/Object")
+	reader := newConsoleTestObject(t, jvm, "java/lang/Object")
+	if nil != ConsoleReaderInit(jvm, inputStreamReader, (*class.Reference)(nil), frame) || nil != BufferedReaderInit(jvm, reader, inputStreamReader, frame) {
+		t.Fatal("failed to init reader")
+	}
+
+	if "first" != stringResult(t, BufferedReaderReadLine(jvm, reader, frame)) {
+		t.Fatal("unexpected first line")
+	}
+	if "last" != stringResult(t, BufferedReaderReadLine(jvm, reader, frame)) {
+		t.Fatal("unexpected last line")
+	}
+	if ref, ok := BufferedReaderReadLine(jvm, reader, frame).(*class.Reference); !ok || nil != ref {
+		t.Fatal("readLine at end of input should return null")
+	}
+}
+
+func TestScannerWrapsGuestStream(t *testing.T) {
+	jvm := newConsoleTestJvm(t, "12 from guest\n")
+	jvm.Stdin = strings.NewReader("from console\n")
+	frame := newMethodStackFrame(0, 0)
+
+	// new Scanner(new BytesIn())不读取控制台
+	in := newConsoleTestObject(t, jvm, "com/fh/BytesIn")
+	scanner := newConsoleTestObject(t, jvm, "java/lang/Object")
+	if nil != ConsoleReaderInit(jvm, scanner, in, frame) {
+		t.Fatal("failed to init scanner")
+	}
+
+	if 12 != ScannerNextInt(jvm, scanner, frame) {
+		t.Fatal("unexpected int")
+	}
+	if " from guest" != stringResult(t, ScannerNextLine(jvm, scanner, frame)) {
+		t.Fatal("unexpected line")
+	}
+	if 0 != ScannerHasNextLine(jvm, scanner, frame) {
+		t.Fatal("guest stream should be exhausted")
+	}
+
+	// 控制台输入没有被读取
+	console := newConsoleTestObject(t, jvm, "java/lang/Object")
+	ConsoleReaderInit(jvm, console, (*class.Reference)(nil), frame)
+	if "from console" != stringResult(t, ScannerNextLine(jvm, console, frame)) {
+		t.Fatal("console input should be untouched")
+	}
+}
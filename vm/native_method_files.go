@@ -0,0 +1,165 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"os"
+)
+
+func (m *MiniJvm) fileSystem() *FileSystem {
+	if nil == m.FileSystem {
+		return defaultFileSystem
+	}
+
+	return m.FileSystem
+}
+
+// Files的路径参数, null时抛出NullPointerException
+func filePathArg(val interface{}) (string, error) {
+	ref := toReference(val)
+	if nil == ref {
+		return "", fmt.Errorf("java.lang.NullPointerException: path is null")
+	}
+
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		return "", err
+	}
+	return string(runes), nil
+}
+
+// 宿主的文件错误转换成java异常
+func fileError(guestPath string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("java.io.FileNotFoundException: %s (No such file or directory)", guestPath)
+	}
+
+	return fmt.Errorf("java.io.IOException: %v", err)
+}
+
+// public static native String readString(String path);
+func FilesReadString(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	text, err := jvm.fileSystem().ReadText(p)
+	if nil != err {
+		return fileError(p, err)
+	}
+
+	strRef, err := class.NewStringObject([]rune(text), jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	return strRef
+}
+
+// public static native void writeString(String path, String content);
+func FilesWriteString(args ...interface{}) interface{} {
+	return filesWrite(false, args...)
+}
+
+// public static native void appendString(String path, String content);
+func FilesAppendString(args ...interface{}) interface{} {
+	return filesWrite(true, args...)
+}
+
+func filesWrite(appendMode bool, args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+	content, err := filePathArg(args[3])
+	if nil != err {
+		return fmt.Errorf("java.lang.NullPointerException: content is null")
+	}
+
+	if err := jvm.fileSystem().WriteText(p, content, appendMode); nil != err {
+		return fileError(p, err)
+	}
+	return nil
+}
+
+// public static native boolean exists(String path);
+func FilesExists(args ...interface{}) interface{} {
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	return args[0].(*MiniJvm).fileSystem().Exists(p)
+}
+
+// public static native boolean delete(String path);
+func FilesDelete(args ...interface{}) interface{} {
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	deleted, err := args[0].(*MiniJvm).fileSystem().Delete(p)
+	if nil != err {
+		return fileError(p, err)
+	}
+	return deleted
+}
+
+// public static native String[] list(String dir);
+func FilesList(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	names, err := jvm.fileSystem().List(p)
+	if nil != err {
+		return fileError(p, err)
+	}
+
+	arrRef, _ := class.NewObjectArray(len(names), "java/lang/String")
+	for ix, name := range names {
+		strRef, err := class.NewStringObject([]rune(name), jvm.MethodArea)
+		if nil != err {
+			return err
+		}
+		arrRef.Array.Data[ix] = strRef
+	}
+	return arrRef
+}
+
+// public static native boolean isCaseSensitive();
+func FilesIsCaseSensitive(args ...interface{}) interface{} {
+	return !args[0].(*MiniJvm).fileSystem().OS.CaseInsensitive
+}
+
+// public static native boolean tryLock(String path);
+func FilesTryLock(args ...interface{}) interface{} {
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	locked, err := args[0].(*MiniJvm).fileSystem().TryLock(p)
+	if nil != err {
+		return fileError(p, err)
+	}
+	return locked
+}
+
+// public static native void unlock(String path);
+func FilesUnlock(args ...interface{}) interface{} {
+	p, err := filePathArg(args[2])
+	if nil != err {
+		return err
+	}
+
+	if err := args[0].(*MiniJvm).fileSystem().Unlock(p); nil != err {
+		return fmt.Errorf("java.lang.IllegalStateException: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+const httpResponseClassName = "cn/minijvm/net/HttpResponse"
+
+// public static native HttpResponse send(String method, String url, String[] headers, byte[] body);
+// 通过MiniJvm.HTTPClient发送请求, 注册为需要network权限的敏感方法
+func HttpClientSend(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	method, err := class.StringRunes(toReference(args[2]))
+	if nil != err {
+		return err
+	}
+	url, err := class.StringRunes(toReference(args[3]))
+	if nil != err {
+		return err
+	}
+
+	// 请求体直接读取byte[]的数据, 请求发送完成之前保持钉住
+	var body io.Reader
+	if bodyRef := toReference(args[5]); nil != bodyRef {
+		handle, data, err := jvm.PinBytes(bodyRef, 0, bodyRef.Array.Len())
+		if nil != err {
+			return err
+		}
+		defer handle.Release()
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(string(method), string(url), body)
+	if nil != err {
+		return fmt.Errorf("java.lang.IllegalArgumentException: %v", err)
+	}
+
+	if headersRef := toReference(args[4]); nil != headersRef {
+		headers := headersRef.Array.Data
+		for ix := 0; ix + 1 < len(headers); ix += 2 {
+			name, err := class.StringRunes(toReference(headers[ix]))
+			if nil != err {
+				return err
+			}
+			val, err := class.StringRunes(toReference(headers[ix + 1]))
+			if nil != err {
+				return err
+			}
+			req.Header.Add(string(name), string(val))
+		}
+	}
+
+	client := jvm.HTTPClient
+	if nil == client {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return fmt.Errorf("java.io.IOException: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return fmt.Errorf("java.io.IOException: failed to read response body: %v", err)
+	}
+
+	return newHttpResponse(jvm, resp, respBody)
+}
+
+func newHttpResponse(jvm *MiniJvm, resp *http.Response, body []byte) interface{} {
+	def, err := jvm.MethodArea.LoadClass(httpResponseClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", httpResponseClassName, err)
+	}
+	respRef, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+
+	// 响应头按名称排序, 输出稳定
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([]interface{}, 0, len(names) * 2)
+	for _, name := range names {
+		for _, val := range resp.Header[name] {
+			for _, s := range []string{name, val} {
+				strRef, err := class.NewStringObject([]rune(s), jvm.MethodArea)
+				if nil != err {
+					return err
+				}
+				headers = append(headers, strRef)
+			}
+		}
+	}
+	headersRef, _ := class.NewObjectArray(len(headers), "java/lang/String")
+	copy(headersRef.Array.Data, headers)
+
+	bodyString, err := class.NewStringObject([]rune(string(body)), jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+
+	respRef.Object.SetFieldValue("statusCode", resp.StatusCode)
+	respRef.Object.SetFieldValue("headers", headersRef)
+	respRef.Object.SetFieldValue("body", class.NewByteArray(body))
+	respRef.Object.SetFieldValue("bodyString", bodyString)
+
+	return respRef
+}
+
+// 参数为null时可能是nil也可能是(*class.Reference)(nil)
+func toReference(val interface{}) *class.Reference {
+	ref, _ := val.(*class.Reference)
+	return ref
+}
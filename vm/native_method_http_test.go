@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpClientSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Echo", r.Header.Get("X-Token"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	defer server.Close()
+
+	response := newClassBuilder(httpResponseClassName, "java/lang/Object")
+	response.field("statusCode", "I")
+	response.field("headers", "[Ljava/lang/String;")
+	response.field("body", "[B")
+	response.field("bodyString", "Ljava/lang/String;")
+	ma, err := newTestMethodArea(append(benchRuntimeClasses(), response.def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma.IgnoredClasses = make(map[string]interface{})
+	jvm := &MiniJvm{MethodArea: ma}
+	ma.Jvm = jvm
+
+	str := func(s string) *class.Reference {
+		ref, _ := class.NewStringObject([]rune(s), ma)
+		return ref
+	}
+	headers, _ := class.NewObjectArray(2, "java/lang/String")
+	headers.Array.Data[0], headers.Array.Data[1] = str("X-Token"), str("secret")
+
+	ret := HttpClientSend(jvm, nil, str("POST"), str(server.URL), headers, class.NewByteArray([]byte("ping")))
+	respRef, ok := ret.(*class.Reference)
+	if !ok {
+		t.Fatal(ret)
+	}
+
+	if status, _ := respRef.Object.GetFieldValue("statusCode"); http.StatusCreated != status {
+		t.Fatalf("unexpected status %v", status)
+	}
+	bodyString, _ := respRef.Object.GetFieldValue("bodyString")
+	if runes, _ := class.StringRunes(bodyString.(*class.Reference)); "POST ping" != string(runes) {
+		t.Fatalf("unexpected body %q", string(runes))
+	}
+	body, _ := respRef.Object.GetFieldValue("body")
+	if arr := body.(*class.Reference).Array; atype.Byte != arr.Type || "POST ping" != string(arr.Bytes) {
+		t.Fatal("unexpected body bytes")
+	}
+
+	found := false
+	respHeaders, _ := respRef.Object.GetFieldValue("headers")
+	data := respHeaders.(*class.Reference).Array.Data
+	for ix := 0; ix + 1 < len(data); ix += 2 {
+		name, _ := class.StringRunes(data[ix].(*class.Reference))
+		val, _ := class.StringRunes(data[ix + 1].(*class.Reference))
+		found = found || ("X-Echo" == string(name) && "secret" == string(val))
+	}
+	if !found {
+		t.Fatal("response header not found")
+	}
+
+	// 无法连接时抛出IOException
+	err, _ = HttpClientSend(jvm, nil, str("GET"), str("http://127.0.0.1:1"), nil, nil).(error)
+	if nil == err {
+		t.Fatal("expect IOException")
+	}
+}
@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 从宿主机环境变量中取默认Locale, 格式与java.util.Locale.toString()一致, 如en_US;
+// 优先级与JDK相同: LC_ALL > LC_CTYPE > LANG
+func hostDefaultLocale() string {
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		val := os.Getenv(key)
+		if "" == val {
+			continue
+		}
+
+		// 去掉编码和修饰符, 如zh_CN.UTF-8, de_DE@euro
+		if ix := strings.IndexAny(val, ".@"); ix >= 0 {
+			val = val[:ix]
+		}
+		// C和POSIX在JDK中对应en
+		if "C" == val || "POSIX" == val || "" == val {
+			break
+		}
+
+		return val
+	}
+
+	return "en_US"
+}
+
+// 从宿主机环境中取默认时区ID, 如Asia/Shanghai;
+// 先读TZ环境变量, 再从/etc/localtime软链接的目标中解析, 都取不到时使用UTC
+func hostDefaultTimeZone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); "" != tz {
+		return tz
+	}
+
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); nil == err {
+		if ix := strings.Index(target, "zoneinfo/"); ix >= 0 {
+			return target[ix + len("zoneinfo/"):]
+		}
+	}
+
+	return "UTC"
+}
+
+func newStringResult(jvm *MiniJvm, val string) interface{} {
+	strRef, err := class.NewStringObject([]rune(val), jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to create java/lang/String object:%w", err)
+	}
+
+	return strRef
+}
+
+// private static native String getSystemTimeZoneID(String javaHome);
+func TimeZoneGetSystemTimeZoneID(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	return newStringResult(jvm, jvm.TimeZone)
+}
+
+// 时区ID无法识别时JDK会用这个方法取得GMT偏移形式的时区, 如GMT+08:00
+// private static native String getSystemGMTOffsetID();
+func TimeZoneGetSystemGMTOffsetID(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	loc, err := time.LoadLocation(jvm.TimeZone)
+	if nil != err {
+		return newStringResult(jvm, "GMT")
+	}
+
+	_, offset := jvm.Clock.Now().In(loc).Zone()
+	if 0 == offset {
+		return newStringResult(jvm, "GMT")
+	}
+
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	return newStringResult(jvm, fmt.Sprintf("GMT%c%02d:%02d", sign, offset / 3600, offset % 3600 / 60))
+}
+
+// Environment.getDefaultLocale()实现
+func EnvironmentGetDefaultLocale(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	return newStringResult(jvm, jvm.Locale)
+}
+
+// Environment.getDefaultTimeZone()实现
+func EnvironmentGetDefaultTimeZone(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	return newStringResult(jvm, jvm.TimeZone)
+}
+
+// Environment.getProperty(String key)实现, 没有设置时返回null
+func EnvironmentGetProperty(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	keyRef, _ := args[2].(*class.Reference)
+
+	return getSystemProperty(jvm, keyRef, nil)
+}
+
+// System.getProperty(String key)实现, 与Environment.getProperty()读取同一组属性
+func SystemGetProperty(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	keyRef, _ := args[2].(*class.Reference)
+
+	return getSystemProperty(jvm, keyRef, nil)
+}
+
+// System.getProperty(String key, String def)实现
+func SystemGetPropertyWithDefault(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	keyRef, _ := args[2].(*class.Reference)
+	defRef, _ := args[3].(*class.Reference)
+
+	return getSystemProperty(jvm, keyRef, defRef)
+}
+
+func getSystemProperty(jvm *MiniJvm, keyRef *class.Reference, defRef *class.Reference) interface{} {
+	if nil == keyRef {
+		return fmt.Errorf("java.lang.NullPointerException: key can't be null")
+	}
+	key, err := class.StringRunes(keyRef)
+	if nil != err {
+		return err
+	}
+
+	val, ok := jvm.systemProperty(string(key))
+	if !ok {
+		return defRef
+	}
+
+	return newStringResult(jvm, val)
+}
+
+// 取系统属性: 先取Properties(-D), 没有设置时由Locale和TimeZone得到user.language, user.country,
+// user.variant和user.timezone, 使JDK的Locale.getDefault()和TimeZone.getDefault()与选项一致
+func (m *MiniJvm) systemProperty(key string) (string, bool) {
+	if val, ok := m.Properties[key]; ok {
+		return val, true
+	}
+
+	// 与Locale.toString()格式一致: 语言_国家_变体
+	parts := strings.SplitN(m.Locale, "_", 3)
+	switch key {
+	case "user.language":
+		return parts[0], "" != parts[0]
+	case "user.country":
+		if len(parts) > 1 {
+			return parts[1], "" != parts[1]
+		}
+	case "user.variant":
+		if len(parts) > 2 {
+			return parts[2], "" != parts[2]
+		}
+	case "user.timezone":
+		return m.TimeZone, "" != m.TimeZone
+	}
+
+	return "", false
+}
+
+// AccessController.doPrivileged(PrivilegedAction)实现: 没有SecurityManager, 直接执行action.run();
+// JDK读取系统属性(如Locale.getDefault())时通过它调用System.getProperty()
+func AccessControllerDoPrivileged(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	action, _ := args[2].(*class.Reference)
+	frame := args[3].(*MethodStackFrame)
+
+	ret, err := jvm.invokeMethod(frame, action, "run", "()Ljava/lang/Object;")
+	if nil != err {
+		return err
+	}
+	if nil == ret {
+		return (*class.Reference)(nil)
+	}
+
+	return ret
+}
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHostDefaultLocale(t *testing.T) {
+	cases := map[string]string{
+		"zh_CN.UTF-8": "zh_CN",
+		"de_DE@euro":  "de_DE",
+		"C":           "en_US",
+		"":            "en_US",
+	}
+
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+
+	for lang, expected := range cases {
+		os.Setenv("LANG", lang)
+		if locale := hostDefaultLocale(); expected != locale {
+			t.Fatalf("LANG=%s: expected %s, got %s", lang, expected, locale)
+		}
+	}
+
+	// LC_ALL优先
+	os.Setenv("LC_ALL", "fr_FR.UTF-8")
+	if locale := hostDefaultLocale(); "fr_FR" != locale {
+		t.Fatalf("expected fr_FR, got %s", locale)
+	}
+}
+
+func TestHostDefaultTimeZone(t *testing.T) {
+	defer os.Setenv("TZ", os.Getenv("TZ"))
+
+	os.Setenv("TZ", ":Asia/Shanghai")
+	if tz := hostDefaultTimeZone(); "Asia/Shanghai" != tz {
+		t.Fatalf("expected Asia/Shanghai, got %s", tz)
+	}
+}
+
+func TestLocaleSystemProperties(t *testing.T) {
+	jvm := &MiniJvm{Locale: "de_DE_euro", TimeZone: "Europe/Berlin", Properties: map[string]string{"user.country": "AT"}}
+
+	cases := map[string]string{
+		"user.language": "de",
+		// -D优先于Locale
+		"user.country":  "AT",
+		"user.variant":  "euro",
+		"user.timezone": "Europe/Berlin",
+	}
+	for key, expected := range cases {
+		if val, ok := jvm.systemProperty(key); !ok || expected != val {
+			t.Fatalf("%s: expected %s, got %s, %v", key, expected, val, ok)
+		}
+	}
+
+	jvm.Locale = "en"
+	if val, ok := jvm.systemProperty("user.variant"); ok {
+		t.Fatalf("expected no user.variant, got %s", val)
+	}
+	if _, ok := jvm.systemProperty("java.home"); ok {
+		t.Fatal("expected no java.home")
+	}
+}
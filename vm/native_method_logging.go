@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// java.util.logging.Level中各级别的值
+const (
+	julLevelSevere  = 1000
+	julLevelWarning = 900
+	julLevelInfo    = 800
+	julLevelConfig  = 700
+	julLevelFine    = 500
+	julLevelFiner   = 400
+	julLevelFinest  = 300
+)
+
+const julLoggerClassName = "java/util/logging/Logger"
+
+// 把java.util.logging的级别映射到宿主日志级别
+func julLevelToLogLevel(value int) utils.LogLevel {
+	switch {
+	case value >= julLevelSevere:
+		return utils.LogLevelError
+	case value >= julLevelWarning:
+		return utils.LogLevelWarn
+	case value >= julLevelInfo:
+		return utils.LogLevelInfo
+	}
+
+	return utils.LogLevelDebug
+}
+
+// 转发一条guest日志, 附带记录器名称和guest中的级别名称
+func (m *MiniJvm) guestLog(loggerRef interface{}, levelName string, levelValue int, msgRef interface{}) interface{} {
+	if nil == m.Logger {
+		return nil
+	}
+
+	logger := toReference(loggerRef)
+	if nil == logger {
+		return fmt.Errorf("java.lang.NullPointerException: logger is null")
+	}
+	nameVal, _ := logger.Object.GetFieldValue("name")
+	name, _ := class.StringRunes(toReference(nameVal))
+
+	msg := "null"
+	if msgRef := toReference(msgRef); nil != msgRef {
+		runes, err := class.StringRunes(msgRef)
+		if nil != err {
+			return err
+		}
+		msg = string(runes)
+	}
+
+	m.Logger.Log(julLevelToLogLevel(levelValue), msg, map[string]interface{}{
+		"logger": string(name),
+		"level":  levelName,
+	})
+
+	return nil
+}
+
+// public static Logger getLogger(String name);
+func LoggerGetLogger(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	nameRef := toReference(args[2])
+	if nil == nameRef {
+		return fmt.Errorf("java.lang.NullPointerException: logger name is null")
+	}
+	name, err := class.StringRunes(nameRef)
+	if nil != err {
+		return err
+	}
+
+	jvm.guestLoggersLock.Lock()
+	defer jvm.guestLoggersLock.Unlock()
+	if ref, ok := jvm.guestLoggers[string(name)]; ok {
+		return ref
+	}
+
+	def, err := jvm.MethodArea.LoadClass(julLoggerClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", julLoggerClassName, err)
+	}
+	// 不执行构造方法, 只设置名称
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	ref.Object.SetFieldValue("name", nameRef)
+
+	if nil == jvm.guestLoggers {
+		jvm.guestLoggers = make(map[string]*class.Reference)
+	}
+	jvm.guestLoggers[string(name)] = ref
+
+	return ref
+}
+
+// public String getName();
+func LoggerGetName(args ...interface{}) interface{} {
+	nameVal, _ := toReference(args[1]).Object.GetFieldValue("name")
+	if nameRef := toReference(nameVal); nil != nameRef {
+		return nameRef
+	}
+
+	return (*class.Reference)(nil)
+}
+
+// public void log(Level level, String msg);
+func LoggerLog(args ...interface{}) interface{} {
+	levelRef := toReference(args[2])
+	if nil == levelRef {
+		return fmt.Errorf("java.lang.NullPointerException: level is null")
+	}
+
+	nameVal, _ := levelRef.Object.GetFieldValue("name")
+	levelName, _ := class.StringRunes(toReference(nameVal))
+	levelValue, _ := levelRef.Object.GetFieldValue("value")
+
+	return args[0].(*MiniJvm).guestLog(args[1], string(levelName), int(toInt64(levelValue)), args[3])
+}
+
+// 生成info(String), warning(String)等固定级别的方法
+func loggerLevelMethod(levelName string, levelValue int) NativeFunction {
+	return func(args ...interface{}) interface{} {
+		return args[0].(*MiniJvm).guestLog(args[1], levelName, levelValue, args[2])
+	}
+}
@@ -0,0 +1,96 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+type recordedLog struct {
+	level  utils.LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	logs []recordedLog
+}
+
+func (l *recordingLogger) Log(level utils.LogLevel, msg string, fields map[string]interface{}) {
+	l.logs = append(l.logs, recordedLog{level, msg, fields})
+}
+
+func TestGuestLogging(t *testing.T) {
+	loggerClass := newClassBuilder(julLoggerClassName, "java/lang/Object")
+	loggerClass.field("name", "Ljava/lang/String;")
+	levelClass := newClassBuilder("java/util/logging/Level", "java/lang/Object")
+	levelClass.field("name", "Ljava/lang/String;")
+	levelClass.field("value", "I")
+	ma, err := newTestMethodArea(append(benchRuntimeClasses(), loggerClass.def, levelClass.def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma.IgnoredClasses = make(map[string]interface{})
+	recorder := &recordingLogger{}
+	jvm := &MiniJvm{MethodArea: ma, Logger: recorder}
+	ma.Jvm = jvm
+
+	str := func(s string) *class.Reference {
+		ref, err := class.NewStringObject([]rune(s), ma)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ref
+	}
+
+	loggerRef := LoggerGetLogger(jvm, nil, str("com.fh.App")).(*class.Reference)
+	if loggerRef != LoggerGetLogger(jvm, nil, str("com.fh.App")) {
+		t.Fatal("same name should return the same logger")
+	}
+	if runes, _ := class.StringRunes(LoggerGetName(jvm, loggerRef).(*class.Reference)); "com.fh.App" != string(runes) {
+		t.Fatalf("unexpected logger name %q", string(runes))
+	}
+
+	loggerLevelMethod("WARNING", julLevelWarning)(jvm, loggerRef, str("disk almost full"))
+	loggerLevelMethod("FINE", julLevelFine)(jvm, loggerRef, (*class.Reference)(nil))
+
+	levelDef, _ := ma.LoadClass("java/util/logging/Level")
+	levelRef, _ := class.NewObject(levelDef, ma)
+	levelRef.Object.SetFieldValue("name", str("SEVERE"))
+	levelRef.Object.SetFieldValue("value", julLevelSevere)
+	if ret := LoggerLog(jvm, loggerRef, levelRef, str("crashed")); nil != ret {
+		t.Fatal(ret)
+	}
+
+	expected := []recordedLog{
+		{utils.LogLevelWarn, "disk almost full", map[string]interface{}{"logger": "com.fh.App", "level": "WARNING"}},
+		{utils.LogLevelDebug, "null", map[string]interface{}{"logger": "com.fh.App", "level": "FINE"}},
+		{utils.LogLevelError, "crashed", map[string]interface{}{"logger": "com.fh.App", "level": "SEVERE"}},
+	}
+	if len(expected) != len(recorder.logs) {
+		t.Fatalf("expect %d logs, got %v", len(expected), recorder.logs)
+	}
+	for ix, exp := range expected {
+		got := recorder.logs[ix]
+		if exp.level != got.level || exp.msg != got.msg || exp.fields["logger"] != got.fields["logger"] || exp.fields["level"] != got.fields["level"] {
+			t.Errorf("log %d: expect %v, got %v", ix, exp, got)
+		}
+	}
+}
+
+func TestWriterLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := utils.NewWriterLogger(buf, utils.LogLevelInfo)
+	logger.Log(utils.LogLevelDebug, "hidden", nil)
+	logger.Log(utils.LogLevelWarn, "shown", map[string]interface{}{"logger": "a", "level": "WARNING"})
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("debug log should be dropped: %q", out)
+	}
+	if !strings.Contains(out, "WARN shown level=WARNING logger=a") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
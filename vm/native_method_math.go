@@ -0,0 +1,64 @@
+package vm
+
+// java.lang.Math中的热点方法, 作为intrinsic替代字节码
+
+// public static int max(int a, int b)
+func MathMaxInt(args ...interface{}) interface{} {
+	a, b := toInt64(args[2]), toInt64(args[3])
+	if a > b {
+		return int(a)
+	}
+
+	return int(b)
+}
+
+// public static long max(long a, long b)
+func MathMaxLong(args ...interface{}) interface{} {
+	a, b := toInt64(args[2]), toInt64(args[3])
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// public static int min(int a, int b)
+func MathMinInt(args ...interface{}) interface{} {
+	a, b := toInt64(args[2]), toInt64(args[3])
+	if a < b {
+		return int(a)
+	}
+
+	return int(b)
+}
+
+// public static long min(long a, long b)
+func MathMinLong(args ...interface{}) interface{} {
+	a, b := toInt64(args[2]), toInt64(args[3])
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// public static int abs(int a)
+// 与java一致, abs(Integer.MIN_VALUE)仍然是Integer.MIN_VALUE
+func MathAbsInt(args ...interface{}) interface{} {
+	a := int32(toInt64(args[2]))
+	if a < 0 {
+		return int(-a)
+	}
+
+	return int(a)
+}
+
+// public static long abs(long a)
+func MathAbsLong(args ...interface{}) interface{} {
+	a := toInt64(args[2])
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
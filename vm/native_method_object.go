@@ -2,8 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"time"
 	"github.com/wanghongfei/mini-jvm/vm/class"
-	"sync"
 )
 
 // Object.hashcode()方法实现
@@ -21,14 +21,14 @@ func ObjectClone(args ...interface{}) interface{} {
 	targetObj := &class.Object{
 		DefFile:      targetRef.Object.DefFile,
 		HashCode:     targetRef.Object.HashCode + 1,
-		ObjectFields: targetRef.Object.ObjectFields,
+		// 复制字段, 不能与原对象共用同一个map
+		ObjectFields: targetRef.Object.CopyFields(),
 	}
 
 	newRef := &class.Reference{
 		RefType: targetRef.RefType,
 		Object:  targetObj,
 		Array:   nil,
-		Monitor: sync.Mutex{},
 	}
 
 	return newRef
@@ -37,17 +37,64 @@ func ObjectClone(args ...interface{}) interface{} {
 // Object.getClass()实现
 func ObjectGetClass(args ...interface{}) interface{} {
 	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+
+	var classRef *class.Reference
+	var err error
+	if class.ReferanceTypeArray == ref.RefType {
+		// 数组类没有DefFile
+		classRef, err = jvm.MethodArea.ArrayClassObjectOf(arrayClassName(ref.Array))
 
-	classDef, err := jvm.MethodArea.LoadClass("java/lang/Class")
+	} else {
+		classRef, err = jvm.MethodArea.ClassObjectOf(ref.Object.DefFile)
+	}
 	if nil != err {
-		return fmt.Errorf("failed to load java/lang/Class def:%w", err)
+		return fmt.Errorf("failed to get class object: %w", err)
+	}
+
+	return classRef
+}
+
+// Object.wait(long)实现, 需要调用者栈帧确定当前线程;
+// 释放对象的锁直到被notify、超时(0表示不超时)或宿主取消执行, 返回前重新加锁
+func ObjectWait(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+	millis := toInt64(args[2])
+	frame := args[3].(*MethodStackFrame)
+
+	if millis < 0 {
+		return fmt.Errorf("java.lang.IllegalArgumentException: timeout value is negative")
 	}
 
-	classRef, err := class.NewObject(classDef, jvm.MethodArea)
+	err := ref.Monitor.Wait(jvm.hostContext(), frame.ThreadID(), time.Duration(millis) * time.Millisecond)
 	if nil != err {
-		return fmt.Errorf("failed to create java/lang/Class object:%w", err)
+		return cancelledError("wait", err)
 	}
 
-	return classRef
+	return nil
 }
 
+// Object.notify()实现
+func ObjectNotify(args ...interface{}) interface{} {
+	ref := args[1].(*class.Reference)
+	frame := args[2].(*MethodStackFrame)
+
+	if err := ref.Monitor.Notify(frame.ThreadID()); nil != err {
+		return err
+	}
+
+	return nil
+}
+
+// Object.notifyAll()实现
+func ObjectNotifyAll(args ...interface{}) interface{} {
+	ref := args[1].(*class.Reference)
+	frame := args[2].(*MethodStackFrame)
+
+	if err := ref.Monitor.NotifyAll(frame.ThreadID()); nil != err {
+		return err
+	}
+
+	return nil
+}
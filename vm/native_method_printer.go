@@ -2,49 +2,246 @@ package vm
 
 import (
 	"fmt"
-	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
 	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
 )
 
+// 宿主的标准输出和错误输出, 浏览器中(GOOS=js)分别为console.log和console.error, 见console_js.go
+var (
+	hostStdout io.Writer = os.Stdout
+	hostStderr io.Writer = os.Stderr
+)
+
+// Printer的输出目标
+func (m *MiniJvm) stdout() io.Writer {
+	if nil == m.Stdout {
+		return hostStdout
+	}
+
+	return m.Stdout
+}
+
 func PrintInt(args ...interface{}) interface{} {
-	fmt.Println(args[2])
+	fmt.Fprintln(args[0].(*MiniJvm).stdout(), args[2])
 
 	return nil
 }
 
 func PrintInt2(args ...interface{}) interface{} {
-	fmt.Println(args[2])
-	fmt.Println(args[3])
+	out := args[0].(*MiniJvm).stdout()
+	fmt.Fprintln(out, args[2])
+	fmt.Fprintln(out, args[3])
 
 	return nil
 }
 
 func PrintChar(args ...interface{}) interface{} {
-	fmt.Printf("%c\n", args[2])
+	fmt.Fprintf(args[0].(*MiniJvm).stdout(), "%c\n", args[2])
 
 	return nil
 }
 
 func PrintString(args ...interface{}) interface{} {
 	strRef := args[2].(*class.Reference)
-	field := strRef.Object.ObjectFields["value"]
-	strArrayRef := field.FieldValue.(*class.Reference)
-
-	runeArr := utils.InterfaceArrayToRuneArray(strArrayRef.Array.Data)
+	runeArr, err := class.StringRunes(strRef)
+	if nil != err {
+		return fmt.Errorf("failed to print string: %w", err)
+	}
 
-	fmt.Printf("%v\n", string(runeArr))
+	fmt.Fprintf(args[0].(*MiniJvm).stdout(), "%v\n", string(runeArr))
 
 	return nil
 }
 
 func PrintBoolean(args ...interface{}) interface{} {
-	boolInt := args[2].(int)
-	if 0 == boolInt {
-		fmt.Println("false")
+	// boolean参数可能是int也可能是bool
+	if toBool(args[2]) {
+		fmt.Fprintln(args[0].(*MiniJvm).stdout(), "true")
 
 	} else {
-		fmt.Println("true")
+		fmt.Fprintln(args[0].(*MiniJvm).stdout(), "false")
 	}
 
 	return nil
 }
+
+// 与System.out.println(Object)一致, 输出String.valueOf(obj)
+func PrintObject(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref, _ := args[2].(*class.Reference)
+	frame := args[3].(*MethodStackFrame)
+
+	text, err := jvm.objectToString(frame, ref)
+	if nil != err {
+		return err
+	}
+	fmt.Fprintln(jvm.stdout(), text)
+	jvm.recordOutput(frame, text, args[2:3])
+
+	return nil
+}
+
+// 与String.valueOf(Object)一致: null, String和包装类型直接生成文本,
+// 其他对象按实际类型的虚方法表调用toString(), 没有重写时为"类名@hashCode"
+func (m *MiniJvm) objectToString(frame *MethodStackFrame, ref *class.Reference) (string, error) {
+	if nil == ref || class.ReferanceTypeArray == ref.RefType {
+		return plainObjectString(ref), nil
+	}
+	if text, ok := boxedValueString(ref); ok {
+		return text, nil
+	}
+
+	def := ref.Object.DefFile
+	var toString *class.VTableItem
+	for _, item := range def.VTable {
+		if "toString" == item.MethodName && "()Ljava/lang/String;" == item.MethodDescriptor {
+			toString = item
+			break
+		}
+	}
+	if nil == toString || "java/lang/Object" == toString.MethodInfo.DefFile.FullClassName {
+		return plainObjectString(ref), nil
+	}
+
+	// 辅助栈帧只用来传递接收者和返回值, 不出现在调用栈中
+	helper := &MethodStackFrame{
+		opStack:   NewOpStack(1),
+		depth:     frame.depth,
+		prevFrame: frame,
+	}
+	helper.opStack.Push(ref)
+	err := m.ExecutionEngine.ExecuteWithFrame(def, "toString", "()Ljava/lang/String;", helper, true)
+	if nil != err {
+		return "", err
+	}
+
+	strRef, _ := helper.opStack.PopReference()
+	if nil == strRef {
+		return "null", nil
+	}
+	runes, err := class.StringRunes(strRef)
+	if nil != err {
+		return "", err
+	}
+
+	return string(runes), nil
+}
+
+// 不调用java方法生成对象的文本, 非String和包装类型的对象为"类名@hashCode"
+func plainObjectString(ref *class.Reference) string {
+	if nil == ref {
+		return "null"
+	}
+
+	if class.ReferanceTypeArray == ref.RefType {
+		// 数组没有hashCode, 用地址代替
+		addr := strings.TrimPrefix(fmt.Sprintf("%p", ref.Array), "0x")
+		if "" != ref.Array.ObjectType {
+			return fmt.Sprintf("[L%s;@%s", strings.ReplaceAll(ref.Array.ObjectType, "/", "."), addr)
+		}
+		return fmt.Sprintf("[%s@%s", arrayElementDescriptor(ref.Array.Type), addr)
+	}
+
+	if text, ok := boxedValueString(ref); ok {
+		return text
+	}
+
+	return fmt.Sprintf("%s@%x", strings.ReplaceAll(ref.Object.DefFile.FullClassName, "/", "."), ref.Object.HashCode)
+}
+
+// String和包装类型的文本, 不是这些类型时返回false
+func boxedValueString(ref *class.Reference) (string, bool) {
+	className := ref.Object.DefFile.FullClassName
+	if "java/lang/String" == className {
+		runes, err := class.StringRunes(ref)
+		return string(runes), nil == err
+	}
+
+	val, ok := ref.Object.GetFieldValue("value")
+	if !ok {
+		return "", false
+	}
+
+	switch className {
+	case "java/lang/Integer", "java/lang/Long", "java/lang/Short", "java/lang/Byte":
+		return strconv.FormatInt(toInt64(val), 10), true
+
+	case "java/lang/Character":
+		return string(rune(toInt64(val))), true
+
+	case "java/lang/Boolean":
+		return strconv.FormatBool(toBool(val)), true
+
+	case "java/lang/Float", "java/lang/Double":
+		var f float64
+		switch v := val.(type) {
+		case float32:
+			f = float64(v)
+		case float64:
+			f = v
+		}
+		return formatJavaDouble(f), true
+	}
+
+	return "", false
+}
+
+// 与Double.toString()一样, 整数值也带小数点
+func formatJavaDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	text := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+
+	return text
+}
+
+// 与Float.toString()一致, 按float的精度取最短的表示
+func formatJavaFloat(f float32) string {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return formatJavaDouble(float64(f))
+	}
+
+	text := strconv.FormatFloat(float64(f), 'f', -1, 32)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+
+	return text
+}
+
+// 基本类型数组的元素描述符
+func arrayElementDescriptor(arrayType byte) string {
+	switch arrayType {
+	case atype.Boolean:
+		return "Z"
+	case atype.Char:
+		return "C"
+	case atype.Float:
+		return "F"
+	case atype.Double:
+		return "D"
+	case atype.Byte:
+		return "B"
+	case atype.Short:
+		return "S"
+	case atype.Long:
+		return "J"
+	}
+
+	return "I"
+}
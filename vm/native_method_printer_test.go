@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestPrintObject(t *testing.T) {
+	public := uint16(accflag.Public)
+	native := uint16(accflag.Public | accflag.Native)
+
+	object := newTestClass("java/lang/Object", "", nil, testMethod{"toString", "()Ljava/lang/String;", public})
+	str := newTestClass("java/lang/String", "java/lang/Object", nil)
+	integer := newTestClass("java/lang/Integer", "java/lang/Object", nil)
+	boolean := newTestClass("java/lang/Boolean", "java/lang/Object", nil)
+	plain := newTestClass("com/fh/Plain", "java/lang/Object", nil)
+	named := newTestClass("com/fh/Named", "java/lang/Object", nil, testMethod{"toString", "()Ljava/lang/String;", native})
+	ma, err := newTestMethodArea(object, str, integer, boolean, plain, named)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	jvm := &MiniJvm{MethodArea: ma, NativeMethodTable: NewNativeMethodTable(), Output: NewOutputCapture(10), stats: new(vmStats)}
+	jvm.ExecutionEngine = NewInterpretedExecutionEngine(jvm)
+	jvm.NativeMethodTable.RegisterMethod("com/fh/Named", "toString", "()Ljava/lang/String;", func(args ...interface{}) interface{} {
+		return newStringResult(args[0].(*MiniJvm), "named object")
+	})
+
+	newObject := func(def *class.DefFile, value interface{}) *class.Reference {
+		ref, _ := class.NewObject(def, ma)
+		if nil != value {
+			ref.Object.ObjectFields["value"] = class.NewObjectField(value)
+		}
+		return ref
+	}
+	plainRef := newObject(plain, nil)
+
+	cases := []struct {
+		ref      *class.Reference
+		expected string
+	}{
+		{nil, "null"},
+		{newTestString(t, jvm, "hello"), "hello"},
+		{newObject(integer, 42), "42"},
+		{newObject(boolean, 1), "true"},
+		{newObject(boolean, false), "false"},
+		// 没有重写toString()
+		{plainRef, fmt.Sprintf("com.fh.Plain@%x", plainRef.Object.HashCode)},
+		// 通过虚方法表调用重写的toString()
+		{newObject(named, nil), "named object"},
+	}
+
+	frame := newMethodStackFrame(1, 0)
+	for _, c := range cases {
+		if err, ok := PrintObject(jvm, nil, c.ref, frame).(error); ok {
+			t.Fatalf("%s: %v", c.expected, err)
+		}
+	}
+
+	texts := jvm.Output.Texts()
+	if len(cases) != len(texts) {
+		t.Fatalf("unexpected output count %d", len(texts))
+	}
+	for ix, c := range cases {
+		if c.expected != texts[ix] {
+			t.Fatalf("expected '%s', got '%s'", c.expected, texts[ix])
+		}
+	}
+}
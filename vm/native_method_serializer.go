@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+)
+
+// ObjectSerializer.serialize()实现
+func ObjectSerializerSerialize(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	data, err := SerializeObject(jvm.MethodArea, args[2])
+	if nil != err {
+		return fmt.Errorf("failed to serialize object: %w", err)
+	}
+
+	// 序列化结果不再被go代码使用, 直接作为byte[]的数据
+	return class.NewByteArray(data)
+}
+
+// ObjectSerializer.deserialize()实现
+func ObjectSerializerDeserialize(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	arrRef := toReference(args[2])
+	if nil == arrRef {
+		return fmt.Errorf("java.lang.NullPointerException: deserialize(null)")
+	}
+
+	handle, data, err := jvm.PinBytes(arrRef, 0, arrRef.Array.Len())
+	if nil != err {
+		return err
+	}
+	defer handle.Release()
+
+	obj, err := DeserializeObject(jvm.MethodArea, data, jvm.serializationAllowed)
+	if nil != err {
+		return fmt.Errorf("failed to deserialize object: %w", err)
+	}
+
+	return obj
+}
+
+// 类是否允许被反序列化, 没有配置允许列表时不做限制;
+// 列表中的项是类全名, 或者以.*结尾的包名前缀(包括子包)
+func (m *MiniJvm) serializationAllowed(className string) bool {
+	for _, pattern := range m.SerializationAllowlist {
+		if strings.HasSuffix(pattern, ".*") {
+			if strings.HasPrefix(className, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+			continue
+		}
+
+		if pattern == className {
+			return true
+		}
+	}
+
+	return 0 == len(m.SerializationAllowlist)
+}
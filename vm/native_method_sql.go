@@ -0,0 +1,361 @@
+package vm
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"github.com/wanghongfei/mini-jvm/vm/convert"
+	"sync"
+	"time"
+)
+
+const (
+	sqlConnectionClassName = "cn/minijvm/sql/Connection"
+	sqlStatementClassName  = "cn/minijvm/sql/Statement"
+	sqlResultSetClassName  = "cn/minijvm/sql/ResultSet"
+)
+
+// 把数据库以name注册给guest, guest通过mini-lib中的Connection.open(name)打开;
+// 驱动和连接池由宿主配置, guest只能访问宿主注册的数据库
+func (m *MiniJvm) BindDatabase(name string, db *sql.DB) {
+	m.databasesLock.Lock()
+	defer m.databasesLock.Unlock()
+
+	if nil == m.databases {
+		m.databases = make(map[string]*sql.DB)
+	}
+	m.databases[name] = db
+}
+
+// 根据Connection对象的name字段找到绑定的数据库
+func (m *MiniJvm) databaseOf(ref interface{}) (*sql.DB, error) {
+	connRef := toReference(ref)
+	if nil == connRef {
+		return nil, fmt.Errorf("java.lang.NullPointerException: connection is null")
+	}
+
+	nameVal, _ := connRef.Object.GetFieldValue("name")
+	name, err := class.StringRunes(toReference(nameVal))
+	if nil != err {
+		return nil, fmt.Errorf("invalid Connection object: %w", err)
+	}
+
+	m.databasesLock.Lock()
+	defer m.databasesLock.Unlock()
+	db, ok := m.databases[string(name)]
+	if !ok {
+		return nil, fmt.Errorf("java.lang.IllegalArgumentException: database '%s' not bound by host", string(name))
+	}
+
+	return db, nil
+}
+
+// 读入内存的查询结果
+type guestResultSet struct {
+	columns []string
+	rows    [][]interface{}
+	// 当前行, next()之前为-1
+	cursor int
+	lock   sync.Mutex
+}
+
+// 查询结果保存在ResultSet对象上, close()时释放
+func resultSetOf(ref interface{}) (*guestResultSet, error) {
+	if rsRef := toReference(ref); nil != rsRef && nil != rsRef.Object {
+		if rs, ok := rsRef.Object.HostState().(*guestResultSet); ok {
+			return rs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("java.sql.SQLException: result set is closed")
+}
+
+// 当前行中指定列的值
+func (rs *guestResultSet) value(column string) (interface{}, error) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	if rs.cursor < 0 || rs.cursor >= len(rs.rows) {
+		return nil, fmt.Errorf("java.sql.SQLException: no current row")
+	}
+	for ix, name := range rs.columns {
+		if name == column {
+			return rs.rows[rs.cursor][ix], nil
+		}
+	}
+
+	return nil, fmt.Errorf("java.sql.SQLException: column '%s' not found", column)
+}
+
+// 把Object[]参数转换成go值
+func sqlParams(jvm *MiniJvm, paramsRef *class.Reference) ([]interface{}, error) {
+	if nil == paramsRef {
+		return nil, nil
+	}
+
+	converter := convert.NewConverter(jvm.MethodArea)
+	params := make([]interface{}, len(paramsRef.Array.Data))
+	for ix, param := range paramsRef.Array.Data {
+		val, err := converter.ToGo(param)
+		if nil != err {
+			return nil, fmt.Errorf("failed to convert parameter %d: %w", ix + 1, err)
+		}
+		params[ix] = val
+	}
+
+	return params, nil
+}
+
+// 驱动返回的值统一成convert支持的类型: []byte -> string, time.Time -> RFC3339字符串
+func normalizeSQLValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int32:
+		return int(v)
+	}
+
+	return val
+}
+
+// public static native Connection open(String name);
+func SQLConnectionOpen(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	def, err := jvm.MethodArea.LoadClass(sqlConnectionClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", sqlConnectionClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	ref.Object.SetFieldValue("name", args[2])
+
+	// 打开时就检查是否已经注册
+	if _, err := jvm.databaseOf(ref); nil != err {
+		return err
+	}
+
+	return ref
+}
+
+// public native Statement createStatement();
+// 解释器不执行<init>, 所以Statement由go创建并设置connection字段
+func SQLConnectionCreateStatement(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	def, err := jvm.MethodArea.LoadClass(sqlStatementClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", sqlStatementClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	ref.Object.SetFieldValue("connection", args[1])
+
+	return ref
+}
+
+// Statement对象所属连接的数据库
+func (m *MiniJvm) statementDatabase(ref interface{}) (*sql.DB, error) {
+	stmtRef := toReference(ref)
+	if nil == stmtRef {
+		return nil, fmt.Errorf("java.lang.NullPointerException: statement is null")
+	}
+
+	connRef, _ := stmtRef.Object.GetFieldValue("connection")
+	return m.databaseOf(connRef)
+}
+
+// public native ResultSet executeQuery(String sql, Object... params);
+func SQLStatementExecuteQuery(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	db, err := jvm.statementDatabase(args[1])
+	if nil != err {
+		return err
+	}
+	query, err := class.StringRunes(toReference(args[2]))
+	if nil != err {
+		return err
+	}
+	params, err := sqlParams(jvm, toReference(args[3]))
+	if nil != err {
+		return err
+	}
+
+	rows, err := db.Query(string(query), params...)
+	if nil != err {
+		return fmt.Errorf("java.sql.SQLException: %v", err)
+	}
+	defer rows.Close()
+
+	rs := &guestResultSet{cursor: -1}
+	rs.columns, err = rows.Columns()
+	if nil != err {
+		return fmt.Errorf("java.sql.SQLException: %v", err)
+	}
+	for rows.Next() {
+		row := make([]interface{}, len(rs.columns))
+		dest := make([]interface{}, len(row))
+		for ix := range row {
+			dest[ix] = &row[ix]
+		}
+		if err := rows.Scan(dest...); nil != err {
+			return fmt.Errorf("java.sql.SQLException: %v", err)
+		}
+		for ix := range row {
+			row[ix] = normalizeSQLValue(row[ix])
+		}
+		rs.rows = append(rs.rows, row)
+	}
+	if err := rows.Err(); nil != err {
+		return fmt.Errorf("java.sql.SQLException: %v", err)
+	}
+
+	def, err := jvm.MethodArea.LoadClass(sqlResultSetClassName)
+	if nil != err {
+		return fmt.Errorf("failed to load '%s': %w", sqlResultSetClassName, err)
+	}
+	ref, err := class.NewObject(def, jvm.MethodArea)
+	if nil != err {
+		return err
+	}
+	ref.Object.SetHostState(rs)
+
+	return ref
+}
+
+// public native int executeUpdate(String sql, Object... params);
+func SQLStatementExecuteUpdate(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	db, err := jvm.statementDatabase(args[1])
+	if nil != err {
+		return err
+	}
+	query, err := class.StringRunes(toReference(args[2]))
+	if nil != err {
+		return err
+	}
+	params, err := sqlParams(jvm, toReference(args[3]))
+	if nil != err {
+		return err
+	}
+
+	result, err := db.Exec(string(query), params...)
+	if nil != err {
+		return fmt.Errorf("java.sql.SQLException: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if nil != err {
+		return fmt.Errorf("java.sql.SQLException: %v", err)
+	}
+
+	return int(affected)
+}
+
+// public native boolean next();
+func SQLResultSetNext(args ...interface{}) interface{} {
+	rs, err := resultSetOf(args[1])
+	if nil != err {
+		return err
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.cursor < len(rs.rows) {
+		rs.cursor++
+	}
+
+	return rs.cursor < len(rs.rows)
+}
+
+func resultSetValue(args []interface{}) (interface{}, error) {
+	rs, err := resultSetOf(args[1])
+	if nil != err {
+		return nil, err
+	}
+	column, err := class.StringRunes(toReference(args[2]))
+	if nil != err {
+		return nil, err
+	}
+
+	return rs.value(string(column))
+}
+
+// public native Object getObject(String column);
+func SQLResultSetGetObject(args ...interface{}) interface{} {
+	val, err := resultSetValue(args)
+	if nil != err {
+		return err
+	}
+	if nil == val {
+		return (*class.Reference)(nil)
+	}
+
+	guestVal, err := convert.NewConverter(args[0].(*MiniJvm).MethodArea).FromGo(val)
+	if nil != err {
+		return fmt.Errorf("failed to convert column value: %w", err)
+	}
+	return guestVal
+}
+
+// public native String getString(String column);
+func SQLResultSetGetString(args ...interface{}) interface{} {
+	val, err := resultSetValue(args)
+	if nil != err {
+		return err
+	}
+	if nil == val {
+		return (*class.Reference)(nil)
+	}
+
+	return newStringResult(args[0].(*MiniJvm), fmt.Sprint(val))
+}
+
+// public native long getLong(String column);
+func SQLResultSetGetLong(args ...interface{}) interface{} {
+	val, err := resultSetValue(args)
+	if nil != err {
+		return err
+	}
+
+	switch v := val.(type) {
+	case nil:
+		return int64(0)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	}
+
+	return fmt.Errorf("java.sql.SQLException: cannot convert %T to long", val)
+}
+
+// public native int getInt(String column);
+func SQLResultSetGetInt(args ...interface{}) interface{} {
+	ret := SQLResultSetGetLong(args...)
+	if v, ok := ret.(int64); ok {
+		return int(int32(v))
+	}
+
+	return ret
+}
+
+// public native void close();
+func SQLResultSetClose(args ...interface{}) interface{} {
+	if rsRef := toReference(args[1]); nil != rsRef && nil != rsRef.Object {
+		rsRef.Object.SetHostState(nil)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package vm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"testing"
+)
+
+// 只支持固定语句的驱动, 用来测试参数和结果的转换
+type fakeSQLDriver struct {
+	execArgs []driver.Value
+}
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	return &fakeSQLConn{driver: d}, nil
+}
+
+type fakeSQLConn struct {
+	driver *fakeSQLDriver
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if "update users" != s.query {
+		return nil, errors.New("syntax error")
+	}
+	s.conn.driver.execArgs = args
+	return driver.RowsAffected(2), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if "select users" != s.query {
+		return nil, errors.New("syntax error")
+	}
+	return &fakeSQLRows{rows: [][]driver.Value{
+		{int64(1), []byte("alice")},
+		{int64(2), nil},
+	}}, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	return []string{"id", "name"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if 0 == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLBridge(t *testing.T) {
+	connClass := newClassBuilder(sqlConnectionClassName, "java/lang/Object")
+	connClass.field("name", "Ljava/lang/String;")
+	stmtClass := newClassBuilder(sqlStatementClassName, "java/lang/Object")
+	stmtClass.field("connection", "Lcn/minijvm/sql/Connection;")
+	rsClass := newClassBuilder(sqlResultSetClassName, "java/lang/Object")
+	ma, err := newTestMethodArea(append(benchRuntimeClasses(), connClass.def, stmtClass.def, rsClass.def)...)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ma.IgnoredClasses = make(map[string]interface{})
+	jvm := &MiniJvm{MethodArea: ma}
+	ma.Jvm = jvm
+
+	fake := &fakeSQLDriver{}
+	sql.Register("minijvm-fake", fake)
+	db, err := sql.Open("minijvm-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	jvm.BindDatabase("main", db)
+
+	str := func(s string) *class.Reference {
+		ref, err := class.NewStringObject([]rune(s), ma)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ref
+	}
+
+	connRef := SQLConnectionOpen(jvm, nil, str("main")).(*class.Reference)
+	stmtRef := SQLConnectionCreateStatement(jvm, connRef).(*class.Reference)
+
+	// 查询
+	rsRef := SQLStatementExecuteQuery(jvm, stmtRef, str("select users"), (*class.Reference)(nil)).(*class.Reference)
+	if true != SQLResultSetNext(jvm, rsRef) {
+		t.Fatal("expect first row")
+	}
+	if id := SQLResultSetGetInt(jvm, rsRef, str("id")); 1 != id {
+		t.Fatalf("unexpected id %v", id)
+	}
+	nameRef := SQLResultSetGetString(jvm, rsRef, str("name")).(*class.Reference)
+	if runes, _ := class.StringRunes(nameRef); "alice" != string(runes) {
+		t.Fatalf("unexpected name %q", string(runes))
+	}
+	if true != SQLResultSetNext(jvm, rsRef) {
+		t.Fatal("expect second row")
+	}
+	if ret := SQLResultSetGetObject(jvm, rsRef, str("name")); nil != ret.(*class.Reference) {
+		t.Fatalf("expect null, got %v", ret)
+	}
+	err, _ = SQLResultSetGetObject(jvm, rsRef, str("missing")).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.sql.SQLException") {
+		t.Fatalf("expect SQLException, got %v", err)
+	}
+	if false != SQLResultSetNext(jvm, rsRef) {
+		t.Fatal("expect end of rows")
+	}
+	SQLResultSetClose(jvm, rsRef)
+	if _, ok := SQLResultSetNext(jvm, rsRef).(error); !ok {
+		t.Fatal("expect error after close")
+	}
+
+	// 更新, 参数经过转换传给驱动
+	params, err := class.NewObjectArray(2, "java/lang/Object")
+	if nil != err {
+		t.Fatal(err)
+	}
+	params.Array.Data[0] = str("bob")
+	params.Array.Data[1] = (*class.Reference)(nil)
+	if affected := SQLStatementExecuteUpdate(jvm, stmtRef, str("update users"), params); 2 != affected {
+		t.Fatalf("unexpected affected rows %v", affected)
+	}
+	if 2 != len(fake.execArgs) || "bob" != fake.execArgs[0] || nil != fake.execArgs[1] {
+		t.Fatalf("unexpected exec args %v", fake.execArgs)
+	}
+
+	// 数据库错误
+	err, _ = SQLStatementExecuteUpdate(jvm, stmtRef, str("drop users"), (*class.Reference)(nil)).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.sql.SQLException") {
+		t.Fatalf("expect SQLException, got %v", err)
+	}
+
+	// 没有注册的数据库
+	err, _ = SQLConnectionOpen(jvm, nil, str("unknown")).(error)
+	if nil == err || !strings.HasPrefix(err.Error(), "java.lang.IllegalArgumentException") {
+		t.Fatalf("expect IllegalArgumentException, got %v", err)
+	}
+}
+
+// guest代码通过createStatement()得到Statement并执行更新, 经过本地方法表和安全策略
+func TestSQLStatementFromGuest(t *testing.T) {
+	connClass := newClassBuilder(sqlConnectionClassName, "java/lang/Object")
+	connClass.field("name", "Ljava/lang/String;")
+	connClass.method(accflag.Public | accflag.Static | accflag.Native, "open", "(Ljava/lang/String;)Lcn/minijvm/sql/Connection;", 0, 1, nil)
+	connClass.method(accflag.Public | accflag.Native, "createStatement", "()Lcn/minijvm/sql/Statement;", 0, 1, nil)
+	stmtClass := newClassBuilder(sqlStatementClassName, "java/lang/Object")
+	stmtClass.field("connection", "Lcn/minijvm/sql/Connection;")
+	stmtClass.method(accflag.Public | accflag.Native | accflag.Varargs, "executeUpdate", "(Ljava/lang/String;[Ljava/lang/Object;)I", 0, 3, nil)
+
+	// static int calc() { return Connection.open("main").createStatement().executeUpdate("update users", "bob", null); }
+	main := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	main.method(accflag.Static, "calc", "()I", 6, 0, newCodeAssembler().
+		emitIndex(bcode.LdcW, main.stringConst("main")).
+		emitIndex(bcode.Invokestatic, main.methodRef(sqlConnectionClassName, "open", "(Ljava/lang/String;)Lcn/minijvm/sql/Connection;")).
+		emitIndex(bcode.Invokevirtual, main.methodRef(sqlConnectionClassName, "createStatement", "()Lcn/minijvm/sql/Statement;")).
+		emitIndex(bcode.LdcW, main.stringConst("update users")).
+		emit(bcode.Iconst2).emitIndex(bcode.Anewarray, main.classRef("java/lang/Object")).
+		emit(bcode.Dup, bcode.Iconst0).emitIndex(bcode.LdcW, main.stringConst("bob")).emit(bcode.Aastore).
+		emit(bcode.Dup, bcode.Iconst1, bcode.Aconstnull, bcode.Aastore).
+		emitIndex(bcode.Invokevirtual, main.methodRef(sqlStatementClassName, "executeUpdate", "(Ljava/lang/String;[Ljava/lang/Object;)I")).
+		emit(bcode.Ireturn))
+
+	jvm, err := newClassInitTestJvm(newTestClass("java/lang/String", "java/lang/Object", nil), connClass.def, stmtClass.def, main.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.NativeMethodTable = newBuiltinNativeMethodTable()
+
+	fake := &fakeSQLDriver{}
+	sql.Register("minijvm-fake-statement", fake)
+	db, err := sql.Open("minijvm-fake-statement", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	jvm.BindDatabase("main", db)
+
+	frame := newMethodStackFrame(1, 0)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(main.def, "calc", "()I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if affected, _ := frame.opStack.Pop(); 2 != affected {
+		t.Fatalf("unexpected affected rows %v", affected)
+	}
+	if 2 != len(fake.execArgs) || "bob" != fake.execArgs[0] || nil != fake.execArgs[1] {
+		t.Fatalf("unexpected exec args %v", fake.execArgs)
+	}
+
+	// 禁止database权限后不能打开连接
+	jvm.Policy = NewPolicy(PolicyAllow)
+	jvm.Policy.Deny(PermissionDatabase)
+	var denied *PermissionDeniedError
+	err = jvm.ExecutionEngine.ExecuteWithFrame(main.def, "calc", "()I", newMethodStackFrame(1, 0), false)
+	if !errors.As(err, &denied) || PermissionDatabase != denied.Request.Permission {
+		t.Fatalf("expect database permission denied, got %v", err)
+	}
+}
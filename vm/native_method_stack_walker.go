@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// StackWalker.getStackDepth()实现, 返回调用者所在的栈深度
+func StackWalkerGetStackDepth(args ...interface{}) interface{} {
+	frame := args[2].(*MethodStackFrame)
+	return frame.Depth()
+}
+
+// StackWalker.getCallerClassName()实现, 返回调用者的调用者的类名
+func StackWalkerGetCallerClassName(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+
+	trace := frame.StackTrace()
+	if len(trace) < 2 {
+		return nil
+	}
+
+	nameRef, err := class.NewStringObject([]rune(trace[1].ClassName), jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to create java/lang/String object:%w", err)
+	}
+
+	return nameRef
+}
+
+// StackWalker.getStackTrace()实现, 以String[]的形式返回调用栈, 第一个元素为调用者
+func StackWalkerGetStackTrace(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	frame := args[2].(*MethodStackFrame)
+
+	trace := frame.StackTrace()
+	arrRef, _ := class.NewObjectArray(len(trace), "java/lang/String")
+	for ix, elem := range trace {
+		strRef, err := class.NewStringObject([]rune(elem.String()), jvm.MethodArea)
+		if nil != err {
+			return fmt.Errorf("failed to create java/lang/String object:%w", err)
+		}
+
+		arrRef.Array.Data[ix] = strRef
+	}
+
+	return arrRef
+}
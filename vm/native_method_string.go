@@ -0,0 +1,214 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// String的常用方法由go实现, 直接读取value数组, 与字节码写入的布局一致;
+// boolean和char返回值与操作数栈上的表示一致, 都用int
+
+// public int length()
+func StringLength(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	return len(runes)
+}
+
+// public char charAt(int index)
+func StringCharAt(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	index := int(toInt64(args[2]))
+	if index < 0 || index >= len(runes) {
+		return fmt.Errorf("java.lang.StringIndexOutOfBoundsException: index %d, length %d", index, len(runes))
+	}
+
+	return int(runes[index])
+}
+
+// public boolean equals(Object anObject)
+func StringEquals(args ...interface{}) interface{} {
+	ref := args[1].(*class.Reference)
+	other, _ := args[2].(*class.Reference)
+	if ref == other {
+		return 1
+	}
+	if nil == other || class.ReferanceTypeObject != other.RefType || "java/lang/String" != other.Object.DefFile.FullClassName {
+		return 0
+	}
+
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		return err
+	}
+	otherRunes, err := class.StringRunes(other)
+	if nil != err {
+		return err
+	}
+
+	if len(runes) != len(otherRunes) {
+		return 0
+	}
+	for ix, r := range runes {
+		if r != otherRunes[ix] {
+			return 0
+		}
+	}
+
+	return 1
+}
+
+// public int hashCode()
+// s[0]*31^(n-1) + s[1]*31^(n-2) + ... + s[n-1], 计算结果缓存在hash字段中
+func StringHashCode(args ...interface{}) interface{} {
+	ref := args[1].(*class.Reference)
+	if cached, _ := ref.Object.GetFieldValue("hash"); nil != cached && 0 != cached {
+		return cached
+	}
+
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		return err
+	}
+
+	var h int32
+	for _, r := range runes {
+		h = 31 * h + int32(r)
+	}
+	ref.Object.SetFieldValue("hash", int(h))
+
+	return int(h)
+}
+
+// public String substring(int beginIndex)
+func StringSubstring(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	return newSubstring(args[0].(*MiniJvm), runes, int(toInt64(args[2])), len(runes))
+}
+
+// public String substring(int beginIndex, int endIndex)
+func StringSubstringRange(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	return newSubstring(args[0].(*MiniJvm), runes, int(toInt64(args[2])), int(toInt64(args[3])))
+}
+
+func newSubstring(jvm *MiniJvm, runes []rune, begin int, end int) interface{} {
+	if begin < 0 || end > len(runes) || begin > end {
+		return fmt.Errorf("java.lang.StringIndexOutOfBoundsException: begin %d, end %d, length %d", begin, end, len(runes))
+	}
+
+	strRef, err := class.NewStringObject(runes[begin:end], jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to create substring: %w", err)
+	}
+
+	return strRef
+}
+
+// public String concat(String str)
+func StringConcat(args ...interface{}) interface{} {
+	ref := args[1].(*class.Reference)
+	if isNullReference(args[2]) {
+		return fmt.Errorf("java.lang.NullPointerException: concat(null)")
+	}
+	other := args[2].(*class.Reference)
+
+	otherRunes, err := class.StringRunes(other)
+	if nil != err {
+		return err
+	}
+	if 0 == len(otherRunes) {
+		return ref
+	}
+
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		return err
+	}
+
+	strRef, err := class.NewStringObject(append(append(make([]rune, 0, len(runes) + len(otherRunes)), runes...), otherRunes...), args[0].(*MiniJvm).MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to concat string: %w", err)
+	}
+
+	return strRef
+}
+
+// public int indexOf(int ch)
+func StringIndexOfChar(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	ch := rune(toInt64(args[2]))
+	for ix, r := range runes {
+		if ch == r {
+			return ix
+		}
+	}
+
+	return -1
+}
+
+// public int indexOf(String str)
+func StringIndexOfString(args ...interface{}) interface{} {
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+	targetRef, _ := args[2].(*class.Reference)
+	target, err := class.StringRunes(targetRef)
+	if nil != err {
+		return err
+	}
+
+	for ix := 0; ix + len(target) <= len(runes); ix++ {
+		matched := true
+		for j, r := range target {
+			if r != runes[ix + j] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return ix
+		}
+	}
+
+	return -1
+}
+
+// public native String intern()
+// 返回字符串常量池中内容相同的对象
+func StringIntern(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	runes, err := class.StringRunes(args[1].(*class.Reference))
+	if nil != err {
+		return err
+	}
+
+	ref, err := jvm.MethodArea.InternString(string(runes))
+	if nil != err {
+		return err
+	}
+
+	return ref
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func newTestStringJvm(t *testing.T) *MiniJvm {
+	object := newTestClass("java/lang/Object", "", nil)
+	str := newTestClass("java/lang/String", "java/lang/Object", nil)
+	ma, err := newTestMethodArea(object, str)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return &MiniJvm{MethodArea: ma}
+}
+
+func newTestString(t *testing.T, jvm *MiniJvm, val string) *class.Reference {
+	ref, err := class.NewStringObject([]rune(val), jvm.MethodArea)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return ref
+}
+
+func TestStringNatives(t *testing.T) {
+	jvm := newTestStringJvm(t)
+	hello := newTestString(t, jvm, "hello, world")
+
+	if 12 != StringLength(jvm, hello) {
+		t.Fatal("unexpected length")
+	}
+	if int('w') != StringCharAt(jvm, hello, 7) {
+		t.Fatal("unexpected charAt")
+	}
+	if _, ok := StringCharAt(jvm, hello, 12).(error); !ok {
+		t.Fatal("charAt out of range should fail")
+	}
+
+	if 1 != StringEquals(jvm, hello, newTestString(t, jvm, "hello, world")) {
+		t.Fatal("equal strings should be equal")
+	}
+	if 0 != StringEquals(jvm, hello, newTestString(t, jvm, "hello")) || 0 != StringEquals(jvm, hello, nil) {
+		t.Fatal("different strings should not be equal")
+	}
+
+	// 与java.lang.String.hashCode()的结果一致
+	if -640608884 != StringHashCode(jvm, hello) {
+		t.Fatalf("unexpected hashCode %v", StringHashCode(jvm, hello))
+	}
+	if hash, _ := hello.Object.GetFieldValue("hash"); -640608884 != hash {
+		t.Fatal("hashCode should be cached in hash field")
+	}
+
+	sub, ok := StringSubstringRange(jvm, hello, 7, 12).(*class.Reference)
+	if !ok {
+		t.Fatal("substring failed")
+	}
+	if 1 != StringEquals(jvm, sub, newTestString(t, jvm, "world")) {
+		t.Fatal("unexpected substring")
+	}
+	if _, ok := StringSubstring(jvm, hello, 13).(error); !ok {
+		t.Fatal("substring out of range should fail")
+	}
+
+	if 4 != StringIndexOfChar(jvm, hello, int('o')) || -1 != StringIndexOfChar(jvm, hello, int('z')) {
+		t.Fatal("unexpected indexOf(char)")
+	}
+	if 7 != StringIndexOfString(jvm, hello, sub) || 0 != StringIndexOfString(jvm, hello, newTestString(t, jvm, "")) {
+		t.Fatal("unexpected indexOf(String)")
+	}
+
+	joined, ok := StringConcat(jvm, hello, newTestString(t, jvm, "!")).(*class.Reference)
+	if !ok || 1 != StringEquals(jvm, joined, newTestString(t, jvm, "hello, world!")) {
+		t.Fatal("unexpected concat")
+	}
+	if _, ok := StringConcat(jvm, hello, nil).(error); !ok {
+		t.Fatal("concat(null) should fail")
+	}
+}
+
+// 字节码通过castore写入的char是int, go代码需要读出同样的内容
+func TestStringWrittenByBytecode(t *testing.T) {
+	jvm := newTestStringJvm(t)
+	ref := newTestString(t, jvm, "abc")
+
+	val, _ := ref.Object.GetFieldValue("value")
+	val.(*class.Reference).Array.Store(1, int('x'))
+
+	runes, err := class.StringRunes(ref)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "axc" != string(runes) {
+		t.Fatalf("unexpected value '%s'", string(runes))
+	}
+}
+
+func TestInternString(t *testing.T) {
+	jvm := newTestStringJvm(t)
+
+	first, err := jvm.MethodArea.InternString("hello")
+	if nil != err {
+		t.Fatal(err)
+	}
+	second, _ := jvm.MethodArea.InternString("hello")
+	if first != second {
+		t.Fatal("same literal should be the same object")
+	}
+
+	// new出来的字符串intern之后得到常量池中的对象
+	if first != StringIntern(jvm, newTestString(t, jvm, "hello")) {
+		t.Fatal("intern should return the pooled string")
+	}
+	if first == StringIntern(jvm, newTestString(t, jvm, "world")) {
+		t.Fatal("different strings should not be interned together")
+	}
+}
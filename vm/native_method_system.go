@@ -1,6 +1,11 @@
 package vm
 
-import "github.com/wanghongfei/mini-jvm/vm/class"
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"os"
+	"strings"
+	"time"
+)
 
 //public static native void arraycopy(Object src,  int  srcPos,
 //                                    Object dest, int destPos,
@@ -12,15 +17,75 @@ func SystemArrayCopy(args ...interface{}) interface{} {
 	rawDestPos := args[5]
 	rawLength := args[6]
 
-	srcArr := rawSrc.(*class.Reference).Array.Data
+	srcArr := rawSrc.(*class.Reference).Array
 	srcPos := rawSrcPos.(int)
-	destArr := rawDest.(*class.Reference).Array.Data
+	destArr := rawDest.(*class.Reference).Array
 	destPos := rawDestPos.(int)
 	length := rawLength.(int)
 
 	for ix := 0; ix < length; ix++ {
-		destArr[destPos + ix] = srcArr[srcPos + ix]
+		destArr.Store(destPos + ix, srcArr.Load(srcPos + ix))
 	}
 
 	return nil
 }
+
+// public static native long currentTimeMillis();
+func SystemCurrentTimeMillis(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	return jvm.Clock.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// public static native long nanoTime();
+func SystemNanoTime(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	return jvm.Clock.Now().UnixNano()
+}
+
+// JDK9之后Instant.now()通过此方法取得纳秒精度的时间
+// public static native long getNanoTimeAdjustment(long offsetInSeconds);
+func VMGetNanoTimeAdjustment(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+
+	var offset int64
+	switch val := args[2].(type) {
+	case int64:
+		offset = val
+	case int:
+		offset = int64(val)
+	}
+
+	return jvm.Clock.Now().UnixNano() - offset * int64(time.Second)
+}
+
+// private static native byte[][] environ();
+// 返回宿主机的环境变量, 按 key, value, key, value... 排列
+func ProcessEnvironmentEnviron(args ...interface{}) interface{} {
+	env := os.Environ()
+
+	arrRef, _ := class.NewObjectArray(len(env) * 2, "[B")
+	for ix, kv := range env {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) < 2 {
+			pair = append(pair, "")
+		}
+
+		for j, s := range pair {
+			arrRef.Array.Data[ix * 2 + j] = class.NewByteArray([]byte(s))
+		}
+	}
+
+	return arrRef
+}
+
+// static native void halt0(int status);
+// 在RunMain中执行时不退出宿主进程, 而是结束guest程序并报告退出码
+func ShutdownHalt0(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	if jvm.captureExit {
+		return &SystemExitError{Status: args[2].(int)}
+	}
+
+	os.Exit(args[2].(int))
+	return nil
+}
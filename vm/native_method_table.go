@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"fmt"
 	"github.com/wanghongfei/mini-jvm/vm/class"
 	"strings"
 )
@@ -22,6 +23,17 @@ type NativeMethodInfo struct {
 
 	// 对应的go函数
 	EntryFunc NativeFunction
+
+	// 是否需要调用者栈帧;
+	// 为true时调用者的*MethodStackFrame会作为最后一个参数传给go函数
+	NeedCallerFrame bool
+
+	// 调用前需要安全策略检查的权限, 为空时不检查
+	Permission string
+
+	// 是否替代java实现;
+	// 为true时即使方法没有native标记也会调用go函数, 如String的常用方法
+	Intrinsic bool
 }
 
 
@@ -46,6 +58,50 @@ func (t *NativeMethodTable) RegisterMethod(className string, methodName string,
 	}
 }
 
+// 注册需要访问调用者栈帧的本地方法, 如获取调用栈
+func (t *NativeMethodTable) RegisterFrameAwareMethod(className string, methodName string, descriptor string, goFunc NativeFunction) {
+	t.RegisterMethod(className, methodName, descriptor, goFunc)
+	t.MethodInfoMap[t.genKey(strings.ReplaceAll(className, ".", "/"), methodName, descriptor)].NeedCallerFrame = true
+}
+
+// 注册需要权限的敏感本地方法, 调用前会经过MiniJvm.Policy检查
+func (t *NativeMethodTable) RegisterSensitiveMethod(className string, methodName string, descriptor string, permission string, goFunc NativeFunction) {
+	t.RegisterMethod(className, methodName, descriptor, goFunc)
+	t.SetPermission(className, methodName, descriptor, permission)
+}
+
+// 注册替代java实现的本地方法, 方法本身不是native的也会调用go函数
+func (t *NativeMethodTable) RegisterIntrinsicMethod(className string, methodName string, descriptor string, goFunc NativeFunction) {
+	t.RegisterMethod(className, methodName, descriptor, goFunc)
+	t.MethodInfoMap[t.genKey(strings.ReplaceAll(className, ".", "/"), methodName, descriptor)].Intrinsic = true
+}
+
+// 注册替代java实现并且需要访问调用者栈帧的本地方法
+func (t *NativeMethodTable) RegisterFrameAwareIntrinsicMethod(className string, methodName string, descriptor string, goFunc NativeFunction) {
+	t.RegisterIntrinsicMethod(className, methodName, descriptor, goFunc)
+	t.MethodInfoMap[t.genKey(strings.ReplaceAll(className, ".", "/"), methodName, descriptor)].NeedCallerFrame = true
+}
+
+// 给已注册的本地方法设置所需权限, 如BindNative绑定的宿主函数
+func (t *NativeMethodTable) SetPermission(className string, methodName string, descriptor string, permission string) error {
+	info := t.FindMethodInfo(strings.ReplaceAll(className, ".", "/"), methodName, descriptor)
+	if nil == info {
+		return fmt.Errorf("native method '%s.%s%s' not registered", className, methodName, descriptor)
+	}
+	info.Permission = permission
+
+	return nil
+}
+
+// 查本地方法表, 找出本地方法信息, 没有注册时返回nil
+func (t *NativeMethodTable) FindMethodInfo(className, name string, descriptor string) *NativeMethodInfo {
+	if nil == t {
+		return nil
+	}
+
+	return t.MethodInfoMap[t.genKey(className, name, descriptor)]
+}
+
 // 查本地方法表, 找出目标go函数
 func (t *NativeMethodTable) FindMethod(className, name string, descriptor string) (NativeFunction, int) {
 	key := t.genKey(className, name, descriptor)
@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// Throwable.fillInStackTrace(int)实现, 把当前调用栈保存到backtrace字段中
+func ThrowableFillInStackTrace(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+	frame := args[3].(*MethodStackFrame)
+
+	fillBacktrace(jvm, ref, frame)
+
+	return ref
+}
+
+// Throwable.getStackTraceDepth()实现
+func ThrowableGetStackTraceDepth(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+	frame := args[2].(*MethodStackFrame)
+
+	return len(getBacktrace(jvm, ref, frame))
+}
+
+// Throwable.getStackTraceElement(int)实现
+func ThrowableGetStackTraceElement(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	ref := args[1].(*class.Reference)
+	index := args[2].(int)
+	frame := args[3].(*MethodStackFrame)
+
+	backtrace := getBacktrace(jvm, ref, frame)
+	if index < 0 || index >= len(backtrace) {
+		exceptionRef, err := newJavaException(jvm, frame, "java/lang/IndexOutOfBoundsException",
+			fmt.Sprintf("Index %d out of bounds for length %d", index, len(backtrace)))
+		if nil != err {
+			return err
+		}
+		jvm.stats.onExceptionThrown()
+
+		return NewExceptionThrownError(exceptionRef)
+	}
+	elemRef, err := newStackTraceElementObject(jvm, backtrace[index])
+	if nil != err {
+		return fmt.Errorf("failed to create java/lang/StackTraceElement object:%w", err)
+	}
+
+	return elemRef
+}
+
+// 取出异常对象中保存的调用栈;
+// 由于解释器会忽略构造方法, 异常对象可能没有执行过fillInStackTrace, 此时以当前调用栈为准
+func getBacktrace(jvm *MiniJvm, ref *class.Reference, frame *MethodStackFrame) []*StackTraceElement {
+	if field, ok := ref.Object.ObjectFields["backtrace"]; ok {
+		if backtrace, ok := field.FieldValue.([]*StackTraceElement); ok {
+			return backtrace
+		}
+	}
+
+	return fillBacktrace(jvm, ref, frame)
+}
+
+func fillBacktrace(jvm *MiniJvm, ref *class.Reference, frame *MethodStackFrame) []*StackTraceElement {
+	// 异常类自身及其父类中的栈帧(构造方法, fillInStackTrace等)不属于调用栈
+	throwableClasses := make(map[string]struct{})
+	for def := ref.Object.DefFile; nil != def; def = jvm.MethodArea.loadedSuperClass(def) {
+		throwableClasses[def.FullClassName] = struct{}{}
+	}
+
+	skipping := true
+	backtrace := make([]*StackTraceElement, 0, frame.depth)
+	frame.Walk(func(f *MethodStackFrame) bool {
+		if skipping {
+			if _, ok := throwableClasses[f.method.DefFile.FullClassName]; ok {
+				return true
+			}
+			// Thread.getStackTrace()内部通过new Exception()获取调用栈
+			if "java/lang/Thread" == f.method.DefFile.FullClassName && "getStackTrace" == f.method.String() {
+				return true
+			}
+
+			skipping = false
+		}
+
+		backtrace = append(backtrace, f.stackTraceElement())
+		return true
+	})
+
+	ref.Object.ObjectFields["backtrace"] = &class.ObjectField{
+		FieldValue: backtrace,
+		FieldType:  "backtrace",
+	}
+
+	return backtrace
+}
+
+// 创建java/lang/StackTraceElement对象
+func newStackTraceElementObject(jvm *MiniJvm, elem *StackTraceElement) (*class.Reference, error) {
+	elemDef, err := jvm.MethodArea.LoadClass("java/lang/StackTraceElement")
+	if nil != err {
+		return nil, err
+	}
+
+	elemRef, err := class.NewObject(elemDef, jvm.MethodArea)
+	if nil != err {
+		return nil, err
+	}
+
+	declaringClass, err := class.NewStringObject([]rune(elem.ClassName), jvm.MethodArea)
+	if nil != err {
+		return nil, err
+	}
+	methodName, err := class.NewStringObject([]rune(elem.MethodName), jvm.MethodArea)
+	if nil != err {
+		return nil, err
+	}
+
+	elemRef.Object.ObjectFields["declaringClass"] = class.NewObjectField(declaringClass)
+	elemRef.Object.ObjectFields["methodName"] = class.NewObjectField(methodName)
+	elemRef.Object.ObjectFields["lineNumber"] = class.NewObjectField(elem.LineNumber)
+	if "" != elem.FileName {
+		fileName, err := class.NewStringObject([]rune(elem.FileName), jvm.MethodArea)
+		if nil != err {
+			return nil, err
+		}
+		elemRef.Object.ObjectFields["fileName"] = class.NewObjectField(fileName)
+	}
+
+	return elemRef, nil
+}
@@ -0,0 +1,379 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+	"time"
+)
+
+// sun.misc.Unsafe的字段偏移量;
+// 对象的字段是按字段名存放的(父类字段也在同一个map中), 所以偏移量就是字段名的编号, 与字段所在的类无关;
+// 数组的偏移量就是下标(arrayBaseOffset为0, arrayIndexScale为1)
+var unsafeFieldOffsets = struct {
+	lock    sync.Mutex
+	offsets map[string]int64
+	names   []string
+}{
+	offsets: make(map[string]int64),
+}
+
+// 所有compareAndSwap/volatile读写都在这把锁里完成, 保证比较和写入是原子的;
+// 字段值是interface{}, 没法直接用atomic包, 也不能用对象的Monitor(持有synchronized锁时会死锁)
+var unsafeLock sync.Mutex
+
+// park/unpark使用的许可, key为Thread对象引用, 值为容量为1的channel
+var parkPermits sync.Map
+
+func fieldOffsetOf(name string) int64 {
+	unsafeFieldOffsets.lock.Lock()
+	defer unsafeFieldOffsets.lock.Unlock()
+
+	offset, ok := unsafeFieldOffsets.offsets[name]
+	if !ok {
+		offset = int64(len(unsafeFieldOffsets.names))
+		unsafeFieldOffsets.offsets[name] = offset
+		unsafeFieldOffsets.names = append(unsafeFieldOffsets.names, name)
+	}
+
+	return offset
+}
+
+func fieldNameOf(offset int64) (string, bool) {
+	unsafeFieldOffsets.lock.Lock()
+	defer unsafeFieldOffsets.lock.Unlock()
+
+	if offset < 0 || offset >= int64(len(unsafeFieldOffsets.names)) {
+		return "", false
+	}
+
+	return unsafeFieldOffsets.names[offset], true
+}
+
+// long参数在操作数栈中可能是int也可能是int64
+func toInt64(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case rune:
+		// caload压入的char
+		return int64(v)
+	}
+
+	return 0
+}
+
+// float值在操作数栈中是float32, 本地方法的返回值也可能是float64或int
+func toFloat32(val interface{}) float32 {
+	switch v := val.(type) {
+	case float32:
+		return v
+	case float64:
+		return float32(v)
+	case int:
+		return float32(v)
+	}
+
+	return 0
+}
+
+// double值在操作数栈中是float64, 本地方法的返回值也可能是float32或int
+func toFloat64(val interface{}) float64 {
+	switch v := val.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+
+	return 0
+}
+
+// boolean参数在操作数栈中可能是int也可能是bool
+func toBool(val interface{}) bool {
+	switch v := val.(type) {
+	case bool:
+		return v
+	case int:
+		return 0 != v
+	}
+
+	return false
+}
+
+// 读取对象字段或数组元素, 调用方需要持有unsafeLock
+func unsafeGet(target *class.Reference, offset int64) (interface{}, error) {
+	if class.ReferanceTypeArray == target.RefType {
+		if offset < 0 || offset >= int64(target.Array.Len()) {
+			return nil, fmt.Errorf("array offset %d out of range", offset)
+		}
+
+		return target.Array.Load(int(offset)), nil
+	}
+
+	name, ok := fieldNameOf(offset)
+	if !ok {
+		return nil, fmt.Errorf("invalid field offset %d", offset)
+	}
+	val, ok := target.Object.GetFieldValue(name)
+	if !ok {
+		return nil, fmt.Errorf("field '%s' not found in '%s'", name, target.Object.DefFile.FullClassName)
+	}
+
+	return val, nil
+}
+
+// 写入对象字段或数组元素, 调用方需要持有unsafeLock
+func unsafePut(target *class.Reference, offset int64, val interface{}) error {
+	if class.ReferanceTypeArray == target.RefType {
+		if offset < 0 || offset >= int64(target.Array.Len()) {
+			return fmt.Errorf("array offset %d out of range", offset)
+		}
+
+		target.Array.Store(int(offset), val)
+		return nil
+	}
+
+	name, ok := fieldNameOf(offset)
+	if !ok {
+		return fmt.Errorf("invalid field offset %d", offset)
+	}
+	if !target.Object.SetFieldValue(name, val) {
+		return fmt.Errorf("field '%s' not found in '%s'", name, target.Object.DefFile.FullClassName)
+	}
+
+	return nil
+}
+
+// CAS的公共逻辑, equal用来比较当前值和期望值
+func unsafeCompareAndSwap(target *class.Reference, offset int64, expected interface{}, newVal interface{},
+	equal func(current interface{}, expected interface{}) bool) interface{} {
+
+	unsafeLock.Lock()
+	defer unsafeLock.Unlock()
+
+	current, err := unsafeGet(target, offset)
+	if nil != err {
+		return fmt.Errorf("failed to compare and swap: %w", err)
+	}
+	if !equal(current, expected) {
+		return false
+	}
+
+	err = unsafePut(target, offset, newVal)
+	if nil != err {
+		return fmt.Errorf("failed to compare and swap: %w", err)
+	}
+
+	return true
+}
+
+func unsafeGetVolatile(args []interface{}) interface{} {
+	target := args[2].(*class.Reference)
+	offset := toInt64(args[3])
+
+	unsafeLock.Lock()
+	defer unsafeLock.Unlock()
+
+	val, err := unsafeGet(target, offset)
+	if nil != err {
+		return fmt.Errorf("failed to get volatile: %w", err)
+	}
+
+	return val
+}
+
+func unsafePutVolatile(args []interface{}) interface{} {
+	target := args[2].(*class.Reference)
+	offset := toInt64(args[3])
+
+	unsafeLock.Lock()
+	defer unsafeLock.Unlock()
+
+	err := unsafePut(target, offset, args[4])
+	if nil != err {
+		return fmt.Errorf("failed to put volatile: %w", err)
+	}
+
+	return nil
+}
+
+// private static native void registerNatives();
+// 本地方法都已经在本地方法表中注册过了, 什么都不用做
+func UnsafeRegisterNatives(args ...interface{}) interface{} {
+	return nil
+}
+
+// public native long objectFieldOffset(Field f);
+func UnsafeObjectFieldOffset(args ...interface{}) interface{} {
+	fieldRef := args[2].(*class.Reference)
+
+	nameVal, _ := fieldRef.Object.GetFieldValue("name")
+	name, err := class.StringRunes(toReference(nameVal))
+	if nil != err {
+		return fmt.Errorf("failed to read field name: %w", err)
+	}
+
+	return fieldOffsetOf(string(name))
+}
+
+// public native int arrayBaseOffset(Class<?> arrayClass);
+func UnsafeArrayBaseOffset(args ...interface{}) interface{} {
+	return 0
+}
+
+// public native int arrayIndexScale(Class<?> arrayClass);
+func UnsafeArrayIndexScale(args ...interface{}) interface{} {
+	return 1
+}
+
+// public final native boolean compareAndSwapInt(Object o, long offset, int expected, int x);
+func UnsafeCompareAndSwapInt(args ...interface{}) interface{} {
+	return unsafeCompareAndSwap(args[2].(*class.Reference), toInt64(args[3]), args[4], args[5],
+		func(current interface{}, expected interface{}) bool {
+			return current == expected
+		})
+}
+
+// public final native boolean compareAndSwapLong(Object o, long offset, long expected, long x);
+func UnsafeCompareAndSwapLong(args ...interface{}) interface{} {
+	// 期望值可能是int或int64(见toInt64), 按数值比较
+	return unsafeCompareAndSwap(args[2].(*class.Reference), toInt64(args[3]), args[4], toInt64(args[5]),
+		func(current interface{}, expected interface{}) bool {
+			return toInt64(current) == toInt64(expected)
+		})
+}
+
+// public final native boolean compareAndSwapObject(Object o, long offset, Object expected, Object x);
+func UnsafeCompareAndSwapObject(args ...interface{}) interface{} {
+	return unsafeCompareAndSwap(args[2].(*class.Reference), toInt64(args[3]), args[4], args[5],
+		func(current interface{}, expected interface{}) bool {
+			// 比较引用是否相同, nil和类型为*class.Reference的nil也视为相同
+			currentRef, _ := current.(*class.Reference)
+			expectedRef, _ := expected.(*class.Reference)
+			return currentRef == expectedRef
+		})
+}
+
+// public native int getIntVolatile(Object o, long offset);
+func UnsafeGetIntVolatile(args ...interface{}) interface{} {
+	return unsafeGetVolatile(args)
+}
+
+// public native long getLongVolatile(Object o, long offset);
+func UnsafeGetLongVolatile(args ...interface{}) interface{} {
+	val := unsafeGetVolatile(args)
+	if err, ok := val.(error); ok {
+		return err
+	}
+
+	return toInt64(val)
+}
+
+// public native Object getObjectVolatile(Object o, long offset);
+func UnsafeGetObjectVolatile(args ...interface{}) interface{} {
+	return unsafeGetVolatile(args)
+}
+
+// public native void putIntVolatile(Object o, long offset, int x);
+// public native void putObjectVolatile(Object o, long offset, Object x);
+// public native void putOrderedInt(Object o, long offset, int x);
+// public native void putOrderedObject(Object o, long offset, Object x);
+func UnsafePutVolatile(args ...interface{}) interface{} {
+	return unsafePutVolatile(args)
+}
+
+// public native void putLongVolatile(Object o, long offset, long x);
+// public native void putOrderedLong(Object o, long offset, long x);
+func UnsafePutLongVolatile(args ...interface{}) interface{} {
+	args[4] = toInt64(args[4])
+	return unsafePutVolatile(args)
+}
+
+// public native Object allocateInstance(Class<?> cls);
+// 创建对象但不执行构造方法
+func UnsafeAllocateInstance(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	classRef := args[2].(*class.Reference)
+	if nil == classRef {
+		return fmt.Errorf("java.lang.NullPointerException: class is null")
+	}
+	if nil == classRef.Object.Mirror {
+		return fmt.Errorf("java.lang.InstantiationException: cannot allocate instance of array class")
+	}
+
+	objRef, err := class.NewObject(classRef.Object.Mirror, jvm.MethodArea)
+	if nil != err {
+		return fmt.Errorf("failed to allocate instance of '%s': %w", classRef.Object.Mirror.FullClassName, err)
+	}
+
+	return objRef
+}
+
+func parkPermitOf(threadRef *class.Reference) chan struct{} {
+	permit, _ := parkPermits.LoadOrStore(threadRef, make(chan struct{}, 1))
+	return permit.(chan struct{})
+}
+
+// public native void park(boolean isAbsolute, long time);
+// isAbsolute为true时time是毫秒时间戳, 否则是纳秒超时时间, 0表示一直等待
+func UnsafePark(args ...interface{}) interface{} {
+	jvm := args[0].(*MiniJvm)
+	isAbsolute := toBool(args[2])
+	timeout := toInt64(args[3])
+	frame := args[4].(*MethodStackFrame)
+
+	threadRef, ok := ThreadCurrentThread(args[0], args[1], frame).(*class.Reference)
+	if !ok {
+		return fmt.Errorf("failed to park: current thread not available")
+	}
+	permit := parkPermitOf(threadRef)
+
+	if isAbsolute {
+		timeout = (timeout - time.Now().UnixNano() / int64(time.Millisecond)) * int64(time.Millisecond)
+		if timeout <= 0 {
+			return nil
+		}
+	} else if timeout < 0 {
+		return nil
+	}
+
+	// 没有超时时间时一直等待许可
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout))
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	// 与wait(), join()一样, 宿主取消时不再等待
+	ctx := jvm.hostContext()
+	select {
+	case <-permit:
+	case <-timeoutCh:
+	case <-ctx.Done():
+		return cancelledError("park", ctx.Err())
+	}
+
+	return nil
+}
+
+// public native void unpark(Object thread);
+func UnsafeUnpark(args ...interface{}) interface{} {
+	threadRef, ok := args[2].(*class.Reference)
+	if !ok || nil == threadRef {
+		return nil
+	}
+
+	// 许可最多只有一个, 已经有许可时忽略
+	select {
+	case parkPermitOf(threadRef) <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
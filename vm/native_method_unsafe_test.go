@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+	"time"
+)
+
+func TestUnsafeCompareAndSwap(t *testing.T) {
+	obj := &class.Reference{
+		RefType: class.ReferanceTypeObject,
+		Object: &class.Object{
+			DefFile:      &class.DefFile{FullClassName: "java/util/concurrent/atomic/AtomicInteger"},
+			ObjectFields: map[string]*class.ObjectField{"value": class.NewObjectField(1)},
+		},
+	}
+	offset := fieldOffsetOf("value")
+
+	if false != UnsafeCompareAndSwapInt(nil, nil, obj, offset, 2, 3) {
+		t.Fatal("cas should fail")
+	}
+	if true != UnsafeCompareAndSwapInt(nil, nil, obj, offset, 1, 3) {
+		t.Fatal("cas should succeed")
+	}
+	if 3 != UnsafeGetIntVolatile(nil, nil, obj, offset) {
+		t.Fatal("unexpected value")
+	}
+
+	// 数组的偏移量就是下标
+	arr, _ := class.NewObjectArray(2, "java/lang/Object")
+	if true != UnsafeCompareAndSwapObject(nil, nil, arr, int64(1), nil, obj) {
+		t.Fatal("cas should succeed")
+	}
+	if obj != arr.Array.Data[1] {
+		t.Fatal("unexpected element")
+	}
+}
+
+func TestUnsafeParkUnpark(t *testing.T) {
+	threadRef := &class.Reference{}
+	frame := &MethodStackFrame{threadRef: threadRef}
+
+	// 先unpark, park立即返回
+	UnsafeUnpark(nil, nil, threadRef)
+	done := make(chan struct{})
+	go func() {
+		UnsafePark(&MiniJvm{}, nil, 0, int64(0), frame)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("park should return after unpark")
+	}
+
+	// 带超时的park
+	start := time.Now()
+	UnsafePark(&MiniJvm{}, nil, 0, int64(10 * time.Millisecond), frame)
+	if time.Since(start) < 10 * time.Millisecond {
+		t.Fatal("park returned before timeout")
+	}
+}
+
+func TestUnsafeParkCancelled(t *testing.T) {
+	frame := &MethodStackFrame{threadRef: &class.Reference{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan interface{})
+	go func() {
+		done <- UnsafePark(&MiniJvm{Context: ctx}, nil, 0, int64(0), frame)
+	}()
+	cancel()
+
+	select {
+	case ret := <-done:
+		var cancelled *ExecutionCancelledError
+		if err, _ := ret.(error); !errors.As(err, &cancelled) {
+			t.Fatalf("expect ExecutionCancelledError, got %v", ret)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("park should return after the host context is cancelled")
+	}
+}
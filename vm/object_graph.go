@@ -0,0 +1,266 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 导出对象图时默认最多包含的对象个数
+const DefaultObjectGraphMaxNodes = 10000
+
+// 从根出发可达的guest对象, 用于查看程序在堆上构造的数据结构(教学, 排查泄漏);
+// String和包装类型作为带值的节点, 不展开内部的char数组. 可以输出为JSON或Graphviz的DOT格式
+type ObjectGraph struct {
+	Roots []*ObjectGraphRoot `json:"roots"`
+	Nodes []*ObjectGraphNode `json:"nodes"`
+	// 对象个数达到上限, 有引用没有导出
+	Truncated bool `json:"truncated"`
+}
+
+// 根引用, 如static字段com.fh.Cache.entries
+type ObjectGraphRoot struct {
+	Name string `json:"name"`
+	Ref  int    `json:"ref"`
+}
+
+// 一个对象或数组
+type ObjectGraphNode struct {
+	// 从1开始编号
+	ID int `json:"id"`
+	// java类名, 数组为int[], java.lang.String[]这样的形式
+	Class string `json:"class"`
+	// 数组长度, 不是数组时为nil
+	Length *int `json:"length,omitempty"`
+	// String和包装类型的值, Class对象所表示的类
+	Value string `json:"value,omitempty"`
+	// 按名字排序的字段; 引用类型数组的非null元素名为[下标], 基本类型数组不列出元素
+	Fields []*ObjectGraphField `json:"fields,omitempty"`
+}
+
+type ObjectGraphField struct {
+	Name string `json:"name"`
+	// 基本类型的值或null; 引用没有导出时为<truncated>
+	Value string `json:"value,omitempty"`
+	// 引用的对象编号
+	Ref int `json:"ref,omitempty"`
+}
+
+// 对象个数达到上限后没有导出的引用
+const objectGraphTruncated = "<truncated>"
+
+// 以所有已加载类的static字段为根导出对象图; classPatterns不为空时只取匹配的类, 如com.fh.*, com.fh.Cache;
+// maxNodes <= 0时使用DefaultObjectGraphMaxNodes
+func (m *MiniJvm) StaticObjectGraph(maxNodes int, classPatterns ...string) *ObjectGraph {
+	patterns := normalizeClassPatterns(classPatterns)
+
+	m.MethodArea.ClassMapLock.RLock()
+	defs := make([]*class.DefFile, 0, len(m.MethodArea.ClassMap))
+	for _, def := range m.MethodArea.ClassMap {
+		defs = append(defs, def)
+	}
+	m.MethodArea.ClassMapLock.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].FullClassName < defs[j].FullClassName
+	})
+
+	b := newObjectGraphBuilder(maxNodes)
+	for _, def := range defs {
+		className := strings.ReplaceAll(def.FullClassName, "/", ".")
+		if len(patterns) > 0 && !matchAnyClassPattern(patterns, className) {
+			continue
+		}
+		if nil == def.ParsedStaticFields {
+			continue
+		}
+
+		fields := def.CopyStaticFields()
+		for _, name := range sortedFieldNames(fields) {
+			if ref, ok := fields[name].FieldValue.(*class.Reference); ok && nil != ref {
+				b.addRoot(className + "." + name, ref)
+			}
+		}
+	}
+
+	return b.build()
+}
+
+// 以句柄引用的对象为根导出对象图, 根的名字为handle
+func (h *ObjectHandle) ObjectGraph(maxNodes int) *ObjectGraph {
+	b := newObjectGraphBuilder(maxNodes)
+	if nil != h.ref {
+		b.addRoot("handle", h.ref)
+	}
+
+	return b.build()
+}
+
+func matchAnyClassPattern(patterns []string, className string) bool {
+	for _, pattern := range patterns {
+		if matchClassPattern(pattern, className) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 按广度优先遍历, 离根近的对象先编号
+type objectGraphBuilder struct {
+	graph    *ObjectGraph
+	maxNodes int
+
+	ids map[*class.Reference]int
+	// 已编号还没有展开的对象
+	queue []*class.Reference
+}
+
+func newObjectGraphBuilder(maxNodes int) *objectGraphBuilder {
+	if maxNodes <= 0 {
+		maxNodes = DefaultObjectGraphMaxNodes
+	}
+
+	return &objectGraphBuilder{
+		graph:    &ObjectGraph{Roots: []*ObjectGraphRoot{}, Nodes: []*ObjectGraphNode{}},
+		maxNodes: maxNodes,
+		ids:      make(map[*class.Reference]int),
+	}
+}
+
+func (b *objectGraphBuilder) addRoot(name string, ref *class.Reference) {
+	if id := b.id(ref); id > 0 {
+		b.graph.Roots = append(b.graph.Roots, &ObjectGraphRoot{Name: name, Ref: id})
+	}
+}
+
+// 对象的编号, 第一次出现时编号并等待展开; 达到上限时返回0
+func (b *objectGraphBuilder) id(ref *class.Reference) int {
+	if id, ok := b.ids[ref]; ok {
+		return id
+	}
+	if len(b.ids) >= b.maxNodes {
+		b.graph.Truncated = true
+		return 0
+	}
+
+	id := len(b.ids) + 1
+	b.ids[ref] = id
+	b.queue = append(b.queue, ref)
+
+	return id
+}
+
+func (b *objectGraphBuilder) build() *ObjectGraph {
+	for len(b.queue) > 0 {
+		ref := b.queue[0]
+		b.queue = b.queue[1:]
+		b.graph.Nodes = append(b.graph.Nodes, b.node(ref))
+	}
+
+	return b.graph
+}
+
+func (b *objectGraphBuilder) node(ref *class.Reference) *ObjectGraphNode {
+	node := &ObjectGraphNode{ID: b.ids[ref]}
+
+	if class.ReferanceTypeArray == ref.RefType {
+		arr := ref.Array
+		length := arr.Len()
+		node.Class = arrayElementTypeName(arr) + "[]"
+		node.Length = &length
+		if "" == arr.ObjectType {
+			return node
+		}
+
+		for ix := 0; ix < length; ix++ {
+			if elem, ok := arr.Load(ix).(*class.Reference); ok && nil != elem {
+				node.Fields = append(node.Fields, b.field("[" + strconv.Itoa(ix) + "]", elem, ""))
+			}
+		}
+		return node
+	}
+
+	obj := ref.Object
+	node.Class = strings.ReplaceAll(obj.DefFile.FullClassName, "/", ".")
+	if text, ok := boxedValueString(ref); ok {
+		node.Value = text
+		return node
+	}
+	if nil != obj.Mirror {
+		node.Value = strings.ReplaceAll(obj.Mirror.FullClassName, "/", ".")
+	}
+
+	fields := obj.CopyFields()
+	for _, name := range sortedFieldNames(fields) {
+		node.Fields = append(node.Fields, b.field(name, fields[name].FieldValue, fields[name].FieldType))
+	}
+
+	return node
+}
+
+func (b *objectGraphBuilder) field(name string, val interface{}, fieldType string) *ObjectGraphField {
+	ref, isRef := val.(*class.Reference)
+	if !isRef || nil == ref {
+		return &ObjectGraphField{Name: name, Value: renderPrimitive(val, fieldType)}
+	}
+
+	if id := b.id(ref); id > 0 {
+		return &ObjectGraphField{Name: name, Ref: id}
+	}
+	return &ObjectGraphField{Name: name, Value: objectGraphTruncated}
+}
+
+func (g *ObjectGraph) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 输出Graphviz的DOT格式, 可以用dot -Tsvg生成图片; 引用画成以字段名为标签的边, 基本类型字段显示在节点中
+func (g *ObjectGraph) WriteDot(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph objects {\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+
+	for ix, root := range g.Roots {
+		fmt.Fprintf(&sb, "  root%d [shape=plaintext, label=\"%s\"];\n", ix, dotEscaper.Replace(root.Name))
+		fmt.Fprintf(&sb, "  root%d -> n%d;\n", ix, root.Ref)
+	}
+
+	for _, node := range g.Nodes {
+		label := node.Class
+		if nil != node.Length {
+			label = fmt.Sprintf("%s[%d]", strings.TrimSuffix(node.Class, "[]"), *node.Length)
+		}
+		label = dotEscaper.Replace(fmt.Sprintf("#%d %s", node.ID, label)) + `\n`
+		if "" != node.Value {
+			label += dotEscaper.Replace(strconv.Quote(node.Value)) + `\l`
+		}
+		for _, field := range node.Fields {
+			if 0 == field.Ref {
+				label += dotEscaper.Replace(field.Name + " = " + field.Value) + `\l`
+			}
+		}
+		fmt.Fprintf(&sb, "  n%d [label=\"%s\"];\n", node.ID, label)
+
+		for _, field := range node.Fields {
+			if field.Ref > 0 {
+				fmt.Fprintf(&sb, "  n%d -> n%d [label=\"%s\"];\n", node.ID, field.Ref, dotEscaper.Replace(field.Name))
+			}
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestObjectGraph(t *testing.T) {
+	node := newClassBuilder("com/fh/Node", "java/lang/Object")
+	node.field("value", "I")
+	node.field("name", "Ljava/lang/String;")
+	node.field("next", "Lcom/fh/Node;")
+	holder := newClassBuilder("com/fh/Holder", "java/lang/Object")
+	other := newClassBuilder("org/other/Holder", "java/lang/Object")
+	jvm, err := newClassInitTestJvm(newTestClass("java/lang/String", "java/lang/Object", nil), node.def, holder.def, other.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	newNode := func(value int, name string) *class.Reference {
+		ref, err := class.NewObject(node.def, jvm.MethodArea)
+		if nil != err {
+			t.Fatal(err)
+		}
+		nameRef, _ := class.NewStringObject([]rune(name), jvm.MethodArea)
+		ref.Object.SetFieldValue("value", value)
+		ref.Object.SetFieldValue("name", nameRef)
+		ref.Object.SetFieldValue("next", (*class.Reference)(nil))
+		return ref
+	}
+
+	// Holder.head: a -> b -> a, Holder.nodes: Node[3]{a, null, b}, Holder.counts: int[2]
+	first, second := newNode(1, "a"), newNode(2, "b")
+	first.Object.SetFieldValue("next", second)
+	second.Object.SetFieldValue("next", first)
+	nodes, _ := class.NewObjectArray(3, "com/fh/Node")
+	nodes.Array.Store(0, first)
+	nodes.Array.Store(2, second)
+	counts, _ := class.NewArray(2, atype.Int)
+	holder.def.ParsedStaticFields = map[string]*class.ObjectField{
+		"head":   {FieldValue: first, FieldType: "Lcom/fh/Node;"},
+		"nodes":  {FieldValue: nodes, FieldType: "[Lcom/fh/Node;"},
+		"counts": {FieldValue: counts, FieldType: "[I"},
+		"size":   {FieldValue: 2, FieldType: "I"},
+	}
+	other.def.ParsedStaticFields = map[string]*class.ObjectField{
+		"node": {FieldValue: newNode(3, "c"), FieldType: "Lcom/fh/Node;"},
+	}
+
+	graph := jvm.StaticObjectGraph(0, "com.fh.*")
+	var roots []string
+	for _, root := range graph.Roots {
+		roots = append(roots, root.Name)
+	}
+	if "com.fh.Holder.counts,com.fh.Holder.head,com.fh.Holder.nodes" != strings.Join(roots, ",") {
+		t.Fatalf("unexpected roots %v", roots)
+	}
+	// int[2], a, Node[3], "a", b, "b"; 环中的对象只出现一次
+	if 6 != len(graph.Nodes) || graph.Truncated {
+		t.Fatalf("expect 6 nodes, got %d, truncated %v", len(graph.Nodes), graph.Truncated)
+	}
+	if n := graph.Nodes[0]; "int[]" != n.Class || nil == n.Length || 2 != *n.Length || 0 != len(n.Fields) {
+		t.Fatalf("unexpected int array node %+v", n)
+	}
+	a := graph.Nodes[1]
+	if "com.fh.Node" != a.Class || 3 != len(a.Fields) || "name" != a.Fields[0].Name || "next" != a.Fields[1].Name || "1" != a.Fields[2].Value {
+		t.Fatalf("unexpected node %+v", a)
+	}
+	if name := graph.Nodes[a.Fields[0].Ref - 1]; "java.lang.String" != name.Class || "a" != name.Value {
+		t.Fatalf("unexpected string node %+v", name)
+	}
+	b := graph.Nodes[a.Fields[1].Ref - 1]
+	if b.Fields[1].Ref != a.ID {
+		t.Fatalf("b.next should point back to a, got %+v", b.Fields[1])
+	}
+	arr := graph.Nodes[2]
+	if "com.fh.Node[]" != arr.Class || 3 != *arr.Length || 2 != len(arr.Fields) || "[2]" != arr.Fields[1].Name || b.ID != arr.Fields[1].Ref {
+		t.Fatalf("unexpected object array node %+v", arr)
+	}
+
+	// 不指定类时包含所有类的static字段
+	if all := jvm.StaticObjectGraph(0); 4 != len(all.Roots) || 8 != len(all.Nodes) {
+		t.Fatalf("expect 4 roots and 8 nodes, got %d, %d", len(all.Roots), len(all.Nodes))
+	}
+
+	// 从句柄出发, 达到上限时标记为截断
+	small := jvm.NewObjectHandle(first).ObjectGraph(2)
+	if 2 != len(small.Nodes) || !small.Truncated || "handle" != small.Roots[0].Name {
+		t.Fatalf("unexpected truncated graph %+v", small)
+	}
+	if field := small.Nodes[0].Fields[1]; objectGraphTruncated != field.Value || 0 != field.Ref {
+		t.Fatalf("expect truncated reference, got %+v", field)
+	}
+
+	var out bytes.Buffer
+	if err := graph.WriteJSON(&out); nil != err {
+		t.Fatal(err)
+	}
+	var decoded ObjectGraph
+	if err := json.Unmarshal(out.Bytes(), &decoded); nil != err || 6 != len(decoded.Nodes) {
+		t.Fatalf("failed to decode json: %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	if err := graph.WriteDot(&out); nil != err {
+		t.Fatal(err)
+	}
+	dot := out.String()
+	for _, expect := range []string{"digraph objects {", `label="com.fh.Holder.head"`, `label="#1 int[2]\n"`,
+		`n2 -> n5 [label="next"]`, `n3 -> n2 [label="[0]"]`, `value = 1\l`, `\"a\"\l`} {
+		if !strings.Contains(dot, expect) {
+			t.Errorf("dot output should contain %s\n%s", expect, dot)
+		}
+	}
+}
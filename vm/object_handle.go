@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sync"
+)
+
+// 本地方法在一次调用之外持有guest对象时使用的句柄, 如在goroutine中异步读写guest的byte[];
+// 通过Reference()访问对象, 以后的收集器移动对象时只需要更新句柄.
+// 钉住(Pin)的对象不会被回收或移动, 直到对应次数的Unpin; 目前对象由go的GC管理, 不会移动,
+// 钉住的对象由虚拟机持有, 即使本地方法只保留了从对象中取出的数据也不会被回收
+type ObjectHandle struct {
+	jvm *MiniJvm
+	ref *class.Reference
+
+	lock sync.Mutex
+	// 本句柄的钉住次数
+	pins int
+}
+
+// 钉住计数, 同一个对象可以被多个句柄钉住
+type pinnedObjects struct {
+	// key: *class.Reference, val: 钉住次数
+	counts map[*class.Reference]int
+	lock sync.Mutex
+}
+
+func (m *MiniJvm) NewObjectHandle(ref *class.Reference) *ObjectHandle {
+	return &ObjectHandle{jvm: m, ref: ref}
+}
+
+func (h *ObjectHandle) Reference() *class.Reference {
+	return h.ref
+}
+
+// 可以多次调用, 每次Pin需要对应一次Unpin
+func (h *ObjectHandle) Pin() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.pins++
+	h.jvm.pinned.add(h.ref, 1)
+}
+
+// 本句柄没有钉住对象时返回错误
+func (h *ObjectHandle) Unpin() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if 0 == h.pins {
+		return fmt.Errorf("object handle is not pinned")
+	}
+
+	h.pins--
+	h.jvm.pinned.add(h.ref, -1)
+	return nil
+}
+
+// 释放本句柄的所有钉住, 本地方法不再使用对象时调用
+func (h *ObjectHandle) Release() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.pins > 0 {
+		h.jvm.pinned.add(h.ref, -h.pins)
+		h.pins = 0
+	}
+}
+
+// 对象是否被任意句柄钉住
+func (m *MiniJvm) IsPinned(ref *class.Reference) bool {
+	m.pinned.lock.Lock()
+	defer m.pinned.lock.Unlock()
+
+	return m.pinned.counts[ref] > 0
+}
+
+// 被钉住的对象个数
+func (m *MiniJvm) PinnedCount() int {
+	m.pinned.lock.Lock()
+	defer m.pinned.lock.Unlock()
+
+	return len(m.pinned.counts)
+}
+
+func (p *pinnedObjects) add(ref *class.Reference, delta int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.counts {
+		p.counts = make(map[*class.Reference]int)
+	}
+
+	count := p.counts[ref] + delta
+	if count <= 0 {
+		delete(p.counts, ref)
+		return
+	}
+	p.counts[ref] = count
+}
+
+// 钉住byte[], 返回数组中[offset, offset + length)的数据, 不做复制, 用于文件/网络等本地方法直接读写guest的缓冲区;
+// 返回的slice与数组共享存储, 写入对guest代码立即可见. 使用期间不经过数组的锁, 与guest线程的并发读写需要由Java代码同步,
+// 与read(byte[], int, int)等方法的约定一致. 不再使用时调用handle.Release()
+func (m *MiniJvm) PinBytes(ref *class.Reference, offset int, length int) (*ObjectHandle, []byte, error) {
+	if nil == ref {
+		return nil, nil, fmt.Errorf("java.lang.NullPointerException: byte array is null")
+	}
+	if nil == ref.Array || nil == ref.Array.Bytes {
+		return nil, nil, fmt.Errorf("java.lang.IllegalArgumentException: not a byte array")
+	}
+
+	data := ref.Array.Bytes
+	if offset < 0 || length < 0 || offset + length > len(data) {
+		return nil, nil, fmt.Errorf("java.lang.ArrayIndexOutOfBoundsException: offset %d, length %d, array length %d", offset, length, len(data))
+	}
+
+	handle := m.NewObjectHandle(ref)
+	handle.Pin()
+
+	return handle, data[offset : offset + length], nil
+}
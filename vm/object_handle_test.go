@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestObjectHandlePin(t *testing.T) {
+	jvm := &MiniJvm{}
+	buf, err := class.NewArray(16, atype.Byte)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	first := jvm.NewObjectHandle(buf)
+	second := jvm.NewObjectHandle(buf)
+	if first.Reference() != buf {
+		t.Fatal("handle should refer to the object")
+	}
+	if err := first.Unpin(); nil == err {
+		t.Fatal("unpin without pin should fail")
+	}
+
+	// 两个句柄都钉住同一个对象, 全部解除后才不再钉住
+	first.Pin()
+	first.Pin()
+	second.Pin()
+	if !jvm.IsPinned(buf) || 1 != jvm.PinnedCount() {
+		t.Fatalf("expect 1 pinned object, got %d", jvm.PinnedCount())
+	}
+
+	second.Release()
+	if err := first.Unpin(); nil != err {
+		t.Fatal(err)
+	}
+	if !jvm.IsPinned(buf) {
+		t.Fatal("object should still be pinned by the remaining pin")
+	}
+
+	if err := first.Unpin(); nil != err {
+		t.Fatal(err)
+	}
+	if jvm.IsPinned(buf) || 0 != jvm.PinnedCount() {
+		t.Fatal("object should be unpinned")
+	}
+}
+
+func TestPinBytes(t *testing.T) {
+	jvm := &MiniJvm{}
+	buf, _ := class.NewArray(8, atype.Byte)
+	buf.Array.Store(1, -1)
+
+	handle, data, err := jvm.PinBytes(buf, 1, 4)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 4 != len(data) || 0xff != data[0] || !jvm.IsPinned(buf) {
+		t.Fatalf("unexpected view %v", data)
+	}
+
+	// 与数组共享存储, 两边的写入互相可见
+	copy(data[1:], "abc")
+	if int('a') != buf.Array.Load(2) || 8 != buf.Array.Len() {
+		t.Fatalf("write through view not visible, got %v", buf.Array.Load(2))
+	}
+	buf.Array.Store(4, 300)
+	if 44 != data[3] {
+		t.Fatalf("store not visible through view, got %d", data[3])
+	}
+
+	handle.Release()
+	if jvm.IsPinned(buf) {
+		t.Fatal("byte array should be unpinned after release")
+	}
+
+	if _, _, err := jvm.PinBytes(buf, 6, 4); nil == err {
+		t.Fatal("out of range view should fail")
+	}
+	intArr, _ := class.NewArray(2, atype.Int)
+	if _, _, err := jvm.PinBytes(intArr, 0, 1); nil == err {
+		t.Fatal("int array cannot be viewed as bytes")
+	}
+}
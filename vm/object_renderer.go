@@ -0,0 +1,308 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 诊断功能(指令追踪、本地方法审计、调试器、REPL等)显示和比较guest对象的方式;
+// 不执行guest的toString/equals/hashCode, 只按字段反射生成结果, 不会输出go结构体.
+// 展开的层数和元素个数有限制, 对象出现在自己的字段中时不再展开
+type ObjectRenderer struct {
+	// 最多展开的对象层数, 超过时只显示 类名@hashCode{...}, 比较时按同一对象比较
+	MaxDepth int
+	// 数组最多显示的元素个数和对象最多显示的字段个数
+	MaxElements int
+}
+
+// 各诊断功能共用的默认设置
+var DefaultObjectRenderer = &ObjectRenderer{MaxDepth: 2, MaxElements: 16}
+
+// 生成值的文本, 如com.fh.Person@1f{age=3, name="Tom"}, int[3]{1, 2, 3}
+func (r *ObjectRenderer) Render(val interface{}) string {
+	var sb strings.Builder
+	r.render(&sb, val, "", 0, make(map[*class.Reference]bool))
+
+	return sb.String()
+}
+
+// fieldType为字段的类型, 用于区分char和int
+func (r *ObjectRenderer) render(sb *strings.Builder, val interface{}, fieldType string, depth int, visiting map[*class.Reference]bool) {
+	ref, isRef := val.(*class.Reference)
+	if !isRef {
+		sb.WriteString(renderPrimitive(val, fieldType))
+		return
+	}
+	if nil == ref {
+		sb.WriteString("null")
+		return
+	}
+
+	if class.ReferanceTypeArray == ref.RefType {
+		r.renderArray(sb, ref, depth, visiting)
+		return
+	}
+
+	if "java/lang/String" == ref.Object.DefFile.FullClassName {
+		runes, _ := class.StringRunes(ref)
+		sb.WriteString(fmt.Sprintf("%q", string(runes)))
+		return
+	}
+	if text, ok := boxedValueString(ref); ok {
+		sb.WriteString(text)
+		return
+	}
+
+	sb.WriteString(plainObjectString(ref))
+	if visiting[ref] {
+		sb.WriteString("{<cycle>}")
+		return
+	}
+	if depth >= r.MaxDepth {
+		sb.WriteString("{...}")
+		return
+	}
+
+	visiting[ref] = true
+	defer delete(visiting, ref)
+
+	fields := ref.Object.CopyFields()
+	sb.WriteString("{")
+	for ix, name := range sortedFieldNames(fields) {
+		if ix > 0 {
+			sb.WriteString(", ")
+		}
+		if ix == r.MaxElements {
+			fmt.Fprintf(sb, "...%d more", len(fields) - ix)
+			break
+		}
+
+		sb.WriteString(name)
+		sb.WriteString("=")
+		r.render(sb, fields[name].FieldValue, fields[name].FieldType, depth + 1, visiting)
+	}
+	sb.WriteString("}")
+}
+
+func (r *ObjectRenderer) renderArray(sb *strings.Builder, ref *class.Reference, depth int, visiting map[*class.Reference]bool) {
+	arr := ref.Array
+	elemType := arrayElementTypeName(arr)
+	fmt.Fprintf(sb, "%s[%d]", elemType, arr.Len())
+
+	if visiting[ref] {
+		sb.WriteString("{<cycle>}")
+		return
+	}
+	if depth >= r.MaxDepth {
+		sb.WriteString("{...}")
+		return
+	}
+
+	visiting[ref] = true
+	defer delete(visiting, ref)
+
+	sb.WriteString("{")
+	for ix := 0; ix < arr.Len(); ix++ {
+		if ix > 0 {
+			sb.WriteString(", ")
+		}
+		if ix == r.MaxElements {
+			fmt.Fprintf(sb, "...%d more", arr.Len() - ix)
+			break
+		}
+		r.render(sb, arr.Load(ix), elemType, depth + 1, visiting)
+	}
+	sb.WriteString("}")
+}
+
+// 按字段比较两个值, equals()的反射版本; 超过MaxDepth的引用按是否同一对象比较
+func (r *ObjectRenderer) Equal(a interface{}, b interface{}) bool {
+	return r.equal(a, b, 0, make(map[[2]*class.Reference]bool))
+}
+
+func (r *ObjectRenderer) equal(a interface{}, b interface{}, depth int, comparing map[[2]*class.Reference]bool) bool {
+	refA, isRefA := a.(*class.Reference)
+	refB, isRefB := b.(*class.Reference)
+	if !isRefA || !isRefB {
+		if isRefA || isRefB {
+			// 引用和基本类型只有都是null时相等
+			return (isRefA && nil == refA || nil == a) && (isRefB && nil == refB || nil == b)
+		}
+		return normalizePrimitive(a) == normalizePrimitive(b)
+	}
+
+	if refA == refB {
+		return true
+	}
+	if nil == refA || nil == refB || refA.RefType != refB.RefType {
+		return false
+	}
+	if class.ReferanceTypeObject == refA.RefType {
+		if refA.Object.DefFile != refB.Object.DefFile {
+			return false
+		}
+		// String和包装类型按值比较, 不受层数限制
+		if textA, ok := boxedValueString(refA); ok {
+			textB, _ := boxedValueString(refB)
+			return textA == textB
+		}
+	}
+
+	// 正在比较的一对对象再次出现时认为相等, 由外层的比较决定结果
+	pair := [2]*class.Reference{refA, refB}
+	if comparing[pair] {
+		return true
+	}
+	if depth >= r.MaxDepth {
+		return false
+	}
+	comparing[pair] = true
+	defer delete(comparing, pair)
+
+	if class.ReferanceTypeArray == refA.RefType {
+		arrA, arrB := refA.Array, refB.Array
+		if arrA.Type != arrB.Type || arrA.ObjectType != arrB.ObjectType || arrA.Len() != arrB.Len() {
+			return false
+		}
+		for ix := 0; ix < arrA.Len(); ix++ {
+			if !r.equal(arrA.Load(ix), arrB.Load(ix), depth + 1, comparing) {
+				return false
+			}
+		}
+		return true
+	}
+
+	fieldsA, fieldsB := refA.Object.CopyFields(), refB.Object.CopyFields()
+	if len(fieldsA) != len(fieldsB) {
+		return false
+	}
+	for name, field := range fieldsA {
+		other, ok := fieldsB[name]
+		if !ok || !r.equal(field.FieldValue, other.FieldValue, depth + 1, comparing) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 与Equal一致的hash, Equal为true的两个值hash相同
+func (r *ObjectRenderer) Hash(val interface{}) uint64 {
+	h := fnv.New64a()
+	r.hash(h, val, 0, make(map[*class.Reference]bool))
+
+	return h.Sum64()
+}
+
+func (r *ObjectRenderer) hash(w io.Writer, val interface{}, depth int, visiting map[*class.Reference]bool) {
+	ref, isRef := val.(*class.Reference)
+	if !isRef || nil == ref {
+		if isRef {
+			val = nil
+		}
+		fmt.Fprintf(w, "%T:%v;", normalizePrimitive(val), normalizePrimitive(val))
+		return
+	}
+
+	if class.ReferanceTypeObject == ref.RefType {
+		fmt.Fprintf(w, "object:%s;", ref.Object.DefFile.FullClassName)
+		if text, ok := boxedValueString(ref); ok {
+			fmt.Fprintf(w, "%s;", text)
+			return
+		}
+	}
+
+	// 超过层数时Equal按同一对象比较, 环中的对象Equal认为相等, 都只计入类型
+	if depth >= r.MaxDepth || visiting[ref] {
+		fmt.Fprintf(w, "ref:%d;", ref.RefType)
+		return
+	}
+	visiting[ref] = true
+	defer delete(visiting, ref)
+
+	if class.ReferanceTypeArray == ref.RefType {
+		fmt.Fprintf(w, "array:%d:%s:%d;", ref.Array.Type, ref.Array.ObjectType, ref.Array.Len())
+		for ix := 0; ix < ref.Array.Len(); ix++ {
+			r.hash(w, ref.Array.Load(ix), depth + 1, visiting)
+		}
+		return
+	}
+
+	fields := ref.Object.CopyFields()
+	for _, name := range sortedFieldNames(fields) {
+		fmt.Fprintf(w, "%s=", name)
+		r.hash(w, fields[name].FieldValue, depth + 1, visiting)
+	}
+}
+
+// 基本类型的文本, char按字符显示
+func renderPrimitive(val interface{}, fieldType string) string {
+	if nil == val {
+		return "null"
+	}
+
+	if "char" == fieldType || "C" == fieldType {
+		if c, ok := val.(int); ok {
+			val = rune(c)
+		}
+		if c, ok := val.(rune); ok {
+			return fmt.Sprintf("%q", c)
+		}
+	}
+
+	return fmt.Sprint(val)
+}
+
+// 同一个值在操作数栈、字段和数组中可能是不同的go类型(如long为int或int64), 统一后再比较
+func normalizePrimitive(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		if math.IsNaN(float64(v)) {
+			return "NaN"
+		}
+		return float64(v)
+	case float64:
+		if math.IsNaN(v) {
+			return "NaN"
+		}
+		return v
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	}
+
+	return val
+}
+
+// 数组元素的java类型名, 如int, java.lang.String
+func arrayElementTypeName(arr *class.Array) string {
+	if strings.HasPrefix(arr.ObjectType, "[") {
+		return javaTypeName(arr.ObjectType)
+	}
+	if "" != arr.ObjectType {
+		return javaTypeName("L" + arr.ObjectType + ";")
+	}
+
+	return javaTypeName(arrayElementDescriptor(arr.Type))
+}
+
+func sortedFieldNames(fields map[string]*class.ObjectField) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
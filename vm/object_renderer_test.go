@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestObjectRenderer(t *testing.T) {
+	node := newClassBuilder("com/fh/Node", "java/lang/Object")
+	node.field("value", "I")
+	node.field("tag", "C")
+	node.field("name", "Ljava/lang/String;")
+	node.field("next", "Lcom/fh/Node;")
+	ma, err := newTestMethodArea(newTestClass("java/lang/Object", "", nil), newTestClass("java/lang/String", "java/lang/Object", nil), node.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	newNode := func(value int, name string) *class.Reference {
+		ref, err := class.NewObject(node.def, ma)
+		if nil != err {
+			t.Fatal(err)
+		}
+		nameRef, _ := class.NewStringObject([]rune(name), ma)
+		ref.Object.SetFieldValue("value", value)
+		ref.Object.SetFieldValue("tag", 'x')
+		ref.Object.SetFieldValue("name", nameRef)
+		ref.Object.SetFieldValue("next", (*class.Reference)(nil))
+		return ref
+	}
+
+	first, second := newNode(1, "a"), newNode(2, "b")
+	first.Object.SetFieldValue("next", second)
+	second.Object.SetFieldValue("next", first)
+
+	// 环中的对象不再展开, 超过层数只显示类名
+	text := DefaultObjectRenderer.Render(first)
+	expect := plainObjectString(first) + `{name="a", next=` + plainObjectString(second) + `{name="b", next=` + plainObjectString(first) + `{<cycle>}, tag='x', value=2}, tag='x', value=1}`
+	if expect != text {
+		t.Fatalf("unexpected rendering\n%s\n%s", text, expect)
+	}
+	shallow := &ObjectRenderer{MaxDepth: 1, MaxElements: 2}
+	if expect := plainObjectString(first) + `{name="a", next=` + plainObjectString(second) + `{...}, ...2 more}`; expect != shallow.Render(first) {
+		t.Fatalf("unexpected rendering %s", shallow.Render(first))
+	}
+
+	arr, _ := class.NewArray(3, atype.Int)
+	arr.Array.Store(1, 7)
+	if text := DefaultObjectRenderer.Render(arr); "int[3]{0, 7, 0}" != text {
+		t.Fatalf("unexpected array rendering %s", text)
+	}
+	if "null" != DefaultObjectRenderer.Render((*class.Reference)(nil)) {
+		t.Fatal("null reference should render as null")
+	}
+
+	// 字段相同的不同对象相等, hash也相同
+	copyFirst, copySecond := newNode(1, "a"), newNode(2, "b")
+	copyFirst.Object.SetFieldValue("next", copySecond)
+	copySecond.Object.SetFieldValue("next", copyFirst)
+	if !DefaultObjectRenderer.Equal(first, copyFirst) || DefaultObjectRenderer.Hash(first) != DefaultObjectRenderer.Hash(copyFirst) {
+		t.Fatal("objects with equal fields should be equal")
+	}
+	copySecond.Object.SetFieldValue("value", 3)
+	if DefaultObjectRenderer.Equal(first, copyFirst) {
+		t.Fatal("objects with different fields should not be equal")
+	}
+	if !DefaultObjectRenderer.Equal(int64(5), 5) || DefaultObjectRenderer.Equal(nil, 0) {
+		t.Fatal("unexpected primitive comparison")
+	}
+}
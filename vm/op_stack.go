@@ -1,19 +1,28 @@
 package vm
 
-import "github.com/wanghongfei/mini-jvm/vm/class"
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
 
 // 操作数栈
 type OpStack struct {
 	elems []interface{}
+	// int值保存在这里, elems中对应位置为intSlot, 避免每次压栈都把int装箱成interface{}
+	ints []int64
 
 	// 永远指向栈顶元素
 	topIndex int
 }
 
+// 标记值保存在int槽中; 零大小的值放入interface{}不会分配内存
+type intSlot struct{}
+
 
 func NewOpStack(maxDepth int) *OpStack {
 	return &OpStack{
 		elems:        make([]interface{}, maxDepth),
+		ints:         make([]int64, maxDepth),
 		topIndex:    -1,
 	}
 }
@@ -49,6 +58,9 @@ func (s *OpStack) Pop() (interface{}, bool) {
 	}
 
 	data := s.elems[s.topIndex]
+	if _, ok := data.(intSlot); ok {
+		data = int(s.ints[s.topIndex])
+	}
 	s.elems[s.topIndex] = nil
 	s.topIndex--
 
@@ -61,12 +73,40 @@ func (s *OpStack) GetTop() (interface{}, bool) {
 		return nil, false
 	}
 
+	if _, ok := s.elems[s.topIndex].(intSlot); ok {
+		return int(s.ints[s.topIndex]), true
+	}
+
 	return s.elems[s.topIndex], true
 }
 
+// 压入int, 不分配内存
+func (s *OpStack) PushInt(v int) bool {
+	if s.topIndex == len(s.elems) - 1 {
+		// 栈满了
+		return false
+	}
+
+	s.topIndex++
+	s.elems[s.topIndex] = intSlot{}
+	s.ints[s.topIndex] = int64(v)
+
+	return true
+}
 
 // 出栈
 func (s *OpStack) PopInt() (int, bool) {
+	if -1 == s.topIndex {
+		return 0, false
+	}
+
+	// 用PushInt压入的值直接从int槽中取
+	if _, ok := s.elems[s.topIndex].(intSlot); ok {
+		s.elems[s.topIndex] = nil
+		s.topIndex--
+		return int(s.ints[s.topIndex + 1]), true
+	}
+
 	elem, ok := s.Pop()
 	if !ok {
 		return 0, ok
@@ -76,6 +116,139 @@ func (s *OpStack) PopInt() (int, bool) {
 	return v, ok
 }
 
+// 压入long, 与其他类型一样只占一个位置
+func (s *OpStack) PushLong(v int64) bool {
+	return s.Push(v)
+}
+
+// 弹出long; 字段默认值等处压入的int也按long返回
+func (s *OpStack) PopLong() (int64, bool) {
+	elem, ok := s.Pop()
+	if !ok {
+		return 0, ok
+	}
+
+	return toInt64(elem), true
+}
+
+func (s *OpStack) PushFloat(v float32) bool {
+	return s.Push(v)
+}
+
+// 弹出float; 字段默认值等处压入的int也按float返回
+func (s *OpStack) PopFloat() (float32, bool) {
+	elem, ok := s.Pop()
+	if !ok {
+		return 0, ok
+	}
+
+	return toFloat32(elem), true
+}
+
+// 从栈底到栈顶的所有元素, 诊断用
+func (s *OpStack) Elements() []interface{} {
+	elems := make([]interface{}, s.topIndex + 1)
+	for ix := range elems {
+		if _, ok := s.elems[ix].(intSlot); ok {
+			elems[ix] = int(s.ints[ix])
+		} else {
+			elems[ix] = s.elems[ix]
+		}
+	}
+
+	return elems
+}
+
+func (s *OpStack) PushDouble(v float64) bool {
+	return s.Push(v)
+}
+
+// 弹出double; 字段默认值等处压入的int也按double返回
+func (s *OpStack) PopDouble() (float64, bool) {
+	elem, ok := s.Pop()
+	if !ok {
+		return 0, ok
+	}
+
+	return toFloat64(elem), true
+}
+
+// 出栈并保存到frame的本地变量表中, int值不装箱
+func (s *OpStack) popToLocal(frame *MethodStackFrame, slot int) bool {
+	if -1 == s.topIndex {
+		return false
+	}
+
+	if _, ok := s.elems[s.topIndex].(intSlot); ok {
+		frame.setLocalTableIntAt(slot, int(s.ints[s.topIndex]))
+	} else {
+		frame.localVariablesTable[slot] = s.elems[s.topIndex]
+	}
+	s.elems[s.topIndex] = nil
+	s.topIndex--
+
+	return true
+}
+
+// 复制栈顶元素, int值不装箱
+func (s *OpStack) Dup() bool {
+	if -1 == s.topIndex || s.topIndex == len(s.elems) - 1 {
+		return false
+	}
+
+	s.elems[s.topIndex + 1] = s.elems[s.topIndex]
+	s.ints[s.topIndex + 1] = s.ints[s.topIndex]
+	s.topIndex++
+
+	return true
+}
+
+// 复制栈顶count个元素, 插入到栈顶depth个元素之下, 如dup_x1为DupX(1, 2); int值不装箱
+func (s *OpStack) DupX(count int, depth int) bool {
+	if count > depth || s.topIndex + 1 < depth || s.topIndex + count >= len(s.elems) {
+		return false
+	}
+
+	// 栈顶depth个元素上移count个位置, 空出的位置放入复制的元素
+	bottom := s.topIndex - depth + 1
+	copy(s.elems[bottom + count:], s.elems[bottom : s.topIndex + 1])
+	copy(s.ints[bottom + count:], s.ints[bottom : s.topIndex + 1])
+	copy(s.elems[bottom:], s.elems[bottom + depth : bottom + depth + count])
+	copy(s.ints[bottom:], s.ints[bottom + depth : bottom + depth + count])
+	s.topIndex += count
+
+	return true
+}
+
+// 交换栈顶两个元素
+func (s *OpStack) Swap() bool {
+	if s.topIndex < 1 {
+		return false
+	}
+
+	top := s.topIndex
+	s.elems[top], s.elems[top - 1] = s.elems[top - 1], s.elems[top]
+	s.ints[top], s.ints[top - 1] = s.ints[top - 1], s.ints[top]
+
+	return true
+}
+
+// 距栈顶offset(栈顶为0)的元素是否为long或double(第二类值);
+// 第二类值在操作数栈中也只占一个位置, pop2, dup2等指令按此区分不同的形式
+func (s *OpStack) isCategory2(offset int) bool {
+	index := s.topIndex - offset
+	if index < 0 {
+		return false
+	}
+
+	switch s.elems[index].(type) {
+	case int64, float64:
+		return true
+	}
+
+	return false
+}
+
 func (s *OpStack) PopReference() (*class.Reference, bool) {
 	elem, ok := s.Pop()
 	if !ok {
@@ -106,31 +279,21 @@ func (s *OpStack) GetTopObject() (*class.Reference, bool) {
 	return v, ok
 }
 
-// 跳过skipCount个元素后获取栈元素
-func (s *OpStack) GetObjectSkip(skipCount int) (*class.Reference, bool) {
-	v, ok := s.elems[s.topIndex - skipCount].(*class.Reference)
-	if ok {
-		return v, true
+// 取出方法调用的接收者(不出栈);
+// 接收者在所有参数之下, 每个参数(包括long和double)在操作数栈中只占一个位置, 所以跳过argCount个元素即可
+func (s *OpStack) GetReceiver(argCount int) (*class.Reference, error) {
+	index := s.topIndex - argCount
+	if index < 0 {
+		return nil, fmt.Errorf("operand stack underflow: %d elements, %d arguments", s.topIndex + 1, argCount)
 	}
 
-	return nil, false
-}
-
-func (s *OpStack) GetUntilObject() (*class.Reference, bool) {
-
-	index := s.topIndex
-	for {
-		if -1 == index {
-			break
-		}
-
-		v, ok := s.elems[index].(*class.Reference)
-		if ok {
-			return v, true
-		}
-
-		index--
+	if nil == s.elems[index] {
+		return nil, fmt.Errorf("java.lang.NullPointerException: receiver is null")
+	}
+	ref, ok := s.elems[index].(*class.Reference)
+	if !ok || nil == ref {
+		return nil, fmt.Errorf("receiver is not a reference: %v", s.elems[index])
 	}
 
-	return nil, false
+	return ref, nil
 }
@@ -2,6 +2,9 @@ package vm
 
 import (
 	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
 	"testing"
 )
 
@@ -24,3 +27,140 @@ func TestOpStack_Push(t *testing.T) {
 
 	fmt.Println(s.Pop())
 }
+
+func TestOpStack_GetReceiver(t *testing.T) {
+	receiver := &class.Reference{}
+	argRef := &class.Reference{}
+	arrRef, _ := class.NewArray(1, 10)
+
+	// foo(Ljava/lang/Object;[IJ)V, 参数中有对象, 数组和long
+	s := NewOpStack(5)
+	s.Push(receiver)
+	s.Push(argRef)
+	s.Push(arrRef)
+	s.Push(int64(1))
+
+	ref, err := s.GetReceiver(class.ParseArgCount("(Ljava/lang/Object;[IJ)V"))
+	if nil != err || receiver != ref {
+		t.Fatalf("unexpected receiver %v, err %v", ref, err)
+	}
+
+	// 接收者为null
+	s = NewOpStack(2)
+	s.Push(nil)
+	s.Push(argRef)
+	if _, err := s.GetReceiver(1); nil == err {
+		t.Fatal("expected NullPointerException")
+	}
+
+	if _, err := s.GetReceiver(2); nil == err {
+		t.Fatal("expected stack underflow")
+	}
+}
+
+func TestOpStack_PushInt(t *testing.T) {
+	s := NewOpStack(4)
+	s.PushInt(1000)
+	s.Push("ref")
+	s.PushInt(-7)
+	s.Dup()
+
+	if v, ok := s.PopInt(); !ok || -7 != v {
+		t.Fatalf("expected -7, got %v", v)
+	}
+	// 通用的Pop也能取出int
+	if v, _ := s.Pop(); -7 != v.(int) {
+		t.Fatalf("expected -7, got %v", v)
+	}
+	if v, _ := s.Pop(); "ref" != v {
+		t.Fatalf("expected ref, got %v", v)
+	}
+	if v, _ := s.GetTop(); 1000 != v.(int) {
+		t.Fatalf("expected 1000, got %v", v)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.PushInt(123456)
+		v, _ := s.PopInt()
+		s.PushInt(v + 1)
+		s.PopInt()
+	})
+	if 0 != allocs {
+		t.Fatalf("expected no allocation, got %v", allocs)
+	}
+}
+
+func TestStackInstructions(t *testing.T) {
+	const a, b, c, d = 1, 10, 100, 1000
+	cases := []struct {
+		name   string
+		desc   string
+		code   []byte
+		args   []interface{}
+		expect interface{}
+	}{
+		// a b → b a b → b (a - b) → 2b - a
+		{"dup_x1", "(II)I", []byte{bcode.Iload0, bcode.Iload1, bcode.DupX1, bcode.Isub, bcode.Isub, bcode.Ireturn}, []interface{}{a, b}, 2 * b - a},
+		// a b c → c a b c → b - a
+		{"dup_x2", "(III)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Iload2, bcode.DupX2, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Ireturn}, []interface{}{a, b, c}, b - a},
+		// long a → a long a
+		{"dup_x2 long", "(JI)I", []byte{bcode.Lload0, bcode.Iload2, bcode.DupX2, bcode.Pop, bcode.Pop2, bcode.Ireturn}, []interface{}{int64(a), b}, b},
+		// a b → a b a b → 2a - 2b
+		{"dup2", "(II)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Dup2, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Ireturn}, []interface{}{a, b}, 2 * a - 2 * b},
+		{"dup2 long", "(J)J", []byte{bcode.Lload0, bcode.Dup2, bcode.Ladd, bcode.Lreturn}, []interface{}{int64(c)}, int64(2 * c)},
+		// a b c → b c a b c → a
+		{"dup2_x1", "(III)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Iload2, bcode.Dup2X1, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Ireturn}, []interface{}{a, b, c}, a},
+		// a long → long a long
+		{"dup2_x1 long", "(IJ)J", []byte{bcode.Iload0, bcode.Lload1, bcode.Dup2X1, bcode.Pop2, bcode.Pop, bcode.Lreturn}, []interface{}{a, int64(c)}, int64(c)},
+		// a b c d → c d a b c d → a - b + 2c - 2d
+		{"dup2_x2", "(IIII)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Iload2, bcode.Iload3, bcode.Dup2X2, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Isub, bcode.Ireturn}, []interface{}{a, b, c, d}, a - b + 2 * c - 2 * d},
+		// a b long → long a b long
+		{"dup2_x2 long on ints", "(IIJ)J", []byte{bcode.Iload0, bcode.Iload1, bcode.Lload2, bcode.Dup2X2, bcode.Pop2, bcode.Pop2, bcode.Lreturn}, []interface{}{a, b, int64(c)}, int64(c)},
+		// long a b → a b long a b → a - b
+		{"dup2_x2 ints on long", "(JII)I", []byte{bcode.Lload0, bcode.Iload2, bcode.Iload3, bcode.Dup2X2, bcode.Pop2, bcode.Pop2, bcode.Isub, bcode.Ireturn}, []interface{}{int64(c), a, b}, a - b},
+		// long1 long2 → long2 long1 long2 → 2b - a
+		{"dup2_x2 longs", "(JJ)J", []byte{bcode.Lload0, bcode.Lload2, bcode.Dup2X2, bcode.Lsub, bcode.Lsub, bcode.Lreturn}, []interface{}{int64(a), int64(b)}, int64(2 * b - a)},
+		{"pop2", "(II)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Iload0, bcode.Iload1, bcode.Pop2, bcode.Isub, bcode.Ireturn}, []interface{}{a, b}, a - b},
+		{"pop2 long", "(JJ)J", []byte{bcode.Lload0, bcode.Lload2, bcode.Pop2, bcode.Lreturn}, []interface{}{int64(a), int64(b)}, int64(a)},
+		{"swap", "(II)I", []byte{bcode.Iload0, bcode.Iload1, bcode.Swap, bcode.Isub, bcode.Ireturn}, []interface{}{a, b}, b - a},
+	}
+	for _, cs := range cases {
+		builder := newClassBuilder("com/fh/Calc", "java/lang/Object")
+		builder.method(accflag.Static, "calc", cs.desc, 6, 4, newCodeAssembler().emit(cs.code...))
+		ret, err := runCalcClass(t, builder, cs.desc, cs.args...)
+		if nil != err || cs.expect != ret {
+			t.Errorf("%s: expect %v, got %v, %v", cs.name, cs.expect, ret, err)
+		}
+	}
+
+	// 没有赋值过的long/double字段的默认值也是第二类值: static long calc() { long v = new Calc().x; return 1 - (v + v); }
+	for _, field := range []struct {
+		desc          string
+		one, add, sub byte
+		ret           byte
+		expect        interface{}
+	}{
+		{"J", bcode.Lconst1, bcode.Ladd, bcode.Lsub, bcode.Lreturn, int64(1)},
+		{"D", bcode.Dconst1, bcode.Dadd, bcode.Dsub, bcode.Dreturn, float64(1)},
+	} {
+		builder := newClassBuilder("com/fh/Calc", "java/lang/Object")
+		builder.field("x", field.desc)
+		builder.method(accflag.Static, "calc", "()" + field.desc, 6, 0, newCodeAssembler().
+			emit(field.one).
+			emitIndex(bcode.New, builder.classRef("com/fh/Calc")).
+			emitIndex(bcode.GetField, builder.fieldRef("com/fh/Calc", "x", field.desc)).
+			emit(bcode.Dup2, field.add, field.sub, field.ret))
+		ret, err := runCalcClass(t, builder, "()" + field.desc)
+		if nil != err || field.expect != ret {
+			t.Errorf("dup2 on default %s field: expect %v, got %v, %v", field.desc, field.expect, ret, err)
+		}
+	}
+
+	// 栈满时不复制
+	s := NewOpStack(3)
+	s.PushInt(1)
+	s.Push(int64(2))
+	if s.DupX(2, 2) || !s.DupX(1, 2) || fmt.Sprint([]interface{}{int64(2), 1, int64(2)}) != fmt.Sprint(s.Elements()) {
+		t.Fatalf("unexpected elements %v", s.Elements())
+	}
+}
@@ -0,0 +1,295 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+// 按指令族划分的微基准测试, 用来单独衡量解释器改动对某一类指令的影响:
+//   go test ./vm -run NONE -bench 'Opcodes/array'
+// 每个用例生成 static int run(int n), 循环体中把body展开opcodeBenchUnroll次;
+// loop用例的循环体为空, 其他用例的耗时减去loop即为指令本身的开销
+const opcodeBenchUnroll = 8
+
+type opcodeBench struct {
+	name string
+	// 局部变量0为n, 1为sum, 2为i, 3以后由setup和body使用
+	maxLocals uint16
+	// 准备额外的类, 返回的类会一起加入方法区
+	classes func(main *classBuilder) []*class.DefFile
+	setup   func(main *classBuilder, a *codeAssembler)
+	// body不能在操作数栈上留下值, ix用于生成不重复的标签
+	body func(main *classBuilder, a *codeAssembler, ix int)
+	// 执行n次循环后run()的返回值
+	expect func(n int) int
+}
+
+const opcodeBenchNodeClass = "cn/minijvm/bench/Node"
+
+// class Node { int value; int get() { return 1; } }
+func opcodeBenchNode(main *classBuilder) []*class.DefFile {
+	node := newClassBuilder(opcodeBenchNodeClass, "java/lang/Object")
+	node.field("value", "I")
+	node.method(accflag.Public, "get", "()I", 1, 1, newCodeAssembler().emit(bcode.Iconst1, bcode.Ireturn))
+
+	return []*class.DefFile{node.def}
+}
+
+func opcodeBenches() []*opcodeBench {
+	perIteration := func(delta int) func(n int) int {
+		return func(n int) int { return delta * opcodeBenchUnroll * n }
+	}
+
+	return []*opcodeBench{
+		{
+			name:   "loop",
+			body:   func(main *classBuilder, a *codeAssembler, ix int) {},
+			expect: perIteration(0),
+		},
+		{
+			name: "const",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iconst3, bcode.Bipush, 100).emitIndex(bcode.Sipush, 1000).
+					emit(bcode.Pop, bcode.Pop, bcode.Pop, bcode.Aconstnull, bcode.Pop)
+			},
+			expect: perIteration(0),
+		},
+		{
+			name:      "local",
+			maxLocals: 5,
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Istore3, bcode.Iload3, bcode.Istore, 4, bcode.Iload, 4, bcode.Istore1)
+			},
+			expect: perIteration(0),
+		},
+		{
+			name: "arith",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Iconst3, bcode.Iadd, bcode.Iconst2, bcode.Isub, bcode.Istore1)
+				a.emit(bcode.Iconst1, bcode.Iconst2, bcode.Ishl, bcode.Pop)
+			},
+			expect: perIteration(1),
+		},
+		{
+			name: "iinc",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iinc, 1, 1)
+			},
+			expect: perIteration(1),
+		},
+		{
+			name: "stack",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Dup, bcode.Pop, bcode.Istore1)
+			},
+			expect: perIteration(0),
+		},
+		{
+			name: "branch",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				// 每个分支都不跳转, 最后iinc一定执行
+				skip := fmt.Sprintf("skip%d", ix)
+				a.emit(bcode.Iload2, bcode.Iload0).jump(bcode.Ificmpge, skip)
+				a.emit(bcode.Iload2).jump(bcode.Iflt, skip)
+				a.emit(bcode.Aconstnull).jump(bcode.Ifnonnull, skip)
+				a.emit(bcode.Iinc, 1, 1)
+				a.label(skip)
+			},
+			expect: perIteration(1),
+		},
+		{
+			name:      "array",
+			maxLocals: 4,
+			setup: func(main *classBuilder, a *codeAssembler) {
+				a.emit(bcode.Bipush, 8, bcode.Newarray, atype.Int, bcode.Astore3)
+			},
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Aload3, bcode.Iconst1, bcode.Iconst5, bcode.Iastore)
+				a.emit(bcode.Iload1, bcode.Aload3, bcode.Iconst1, bcode.Iaload, bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(5),
+		},
+		{
+			name: "newarray",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Bipush, 8, bcode.Newarray, atype.Int, bcode.Arraylength, bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(8),
+		},
+		{
+			name:    "new",
+			classes: opcodeBenchNode,
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				valueRef := main.fieldRef(opcodeBenchNodeClass, "value", "I")
+				a.emit(bcode.Iload1).emitIndex(bcode.New, main.classRef(opcodeBenchNodeClass)).
+					emit(bcode.Dup, bcode.Iconst3).emitIndex(bcode.Putfield, valueRef).
+					emitIndex(bcode.GetField, valueRef).emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(3),
+		},
+		{
+			name:      "field",
+			maxLocals: 4,
+			classes:   opcodeBenchNode,
+			setup: func(main *classBuilder, a *codeAssembler) {
+				a.emitIndex(bcode.New, main.classRef(opcodeBenchNodeClass)).emit(bcode.Astore3)
+			},
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				valueRef := main.fieldRef(opcodeBenchNodeClass, "value", "I")
+				a.emit(bcode.Aload3, bcode.Iconst2).emitIndex(bcode.Putfield, valueRef)
+				a.emit(bcode.Iload1, bcode.Aload3).emitIndex(bcode.GetField, valueRef).emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(2),
+		},
+		{
+			name: "static",
+			classes: func(main *classBuilder) []*class.DefFile {
+				// 生成的类不经过解析, 直接分配static字段
+				main.def.ParsedStaticFields = map[string]*class.ObjectField{"counter": class.NewObjectField(0)}
+				return nil
+			},
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				counterRef := main.fieldRef(benchMainClass, "counter", "I")
+				a.emit(bcode.Iconst2).emitIndex(bcode.Putstatic, counterRef)
+				a.emit(bcode.Iload1).emitIndex(bcode.Getstatic, counterRef).emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(2),
+		},
+		{
+			name: "invokestatic",
+			classes: func(main *classBuilder) []*class.DefFile {
+				main.method(accflag.Public | accflag.Static, "one", "()I", 1, 0, newCodeAssembler().emit(bcode.Iconst1, bcode.Ireturn))
+				return nil
+			},
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1).emitIndex(bcode.Invokestatic, main.methodRef(benchMainClass, "one", "()I")).
+					emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(1),
+		},
+		{
+			name:      "invokevirtual",
+			maxLocals: 4,
+			classes:   opcodeBenchNode,
+			setup: func(main *classBuilder, a *codeAssembler) {
+				a.emitIndex(bcode.New, main.classRef(opcodeBenchNodeClass)).emit(bcode.Astore3)
+			},
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Aload3).emitIndex(bcode.Invokevirtual, main.methodRef(opcodeBenchNodeClass, "get", "()I")).
+					emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(1),
+		},
+		{
+			// ldc字符串字面量 + String.length()的intrinsic
+			name: "ldc-intrinsic",
+			body: func(main *classBuilder, a *codeAssembler, ix int) {
+				a.emit(bcode.Iload1, bcode.Ldc, byte(main.stringConst("abc"))).
+					emitIndex(bcode.Invokevirtual, main.methodRef("java/lang/String", "length", "()I")).
+					emit(bcode.Iadd, bcode.Istore1)
+			},
+			expect: perIteration(3),
+		},
+	}
+}
+
+func (o *opcodeBench) newJvm() (*MiniJvm, error) {
+	bench := &Benchmark{
+		Name: o.name,
+		classes: func() []*class.DefFile {
+			main := newClassBuilder(benchMainClass, "java/lang/Object")
+			defs := make([]*class.DefFile, 0, 2)
+			if nil != o.classes {
+				defs = append(defs, o.classes(main)...)
+			}
+
+			maxLocals := o.maxLocals
+			if maxLocals < 3 {
+				maxLocals = 3
+			}
+			benchRunMethod(main, maxLocals, func(a *codeAssembler) {
+				if nil != o.setup {
+					o.setup(main, a)
+				}
+			}, func(a *codeAssembler) {
+				for ix := 0; ix < opcodeBenchUnroll; ix++ {
+					o.body(main, a, ix)
+				}
+			})
+
+			return append(defs, main.def)
+		},
+	}
+
+	return bench.newJvm()
+}
+
+// 执行run(n)并校验返回值
+func (o *opcodeBench) run(jvm *MiniJvm, def *class.DefFile, n int) error {
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.Push(n)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "run", "(I)I", frame, false); nil != err {
+		return err
+	}
+
+	ret, _ := frame.opStack.Pop()
+	if o.expect(n) != ret {
+		return fmt.Errorf("%s: unexpected result for n = %d: expect %d, got %v", o.name, n, o.expect(n), ret)
+	}
+
+	return nil
+}
+
+func (o *opcodeBench) prepare() (*MiniJvm, *class.DefFile, error) {
+	jvm, err := o.newJvm()
+	if nil != err {
+		return nil, nil, err
+	}
+
+	def, err := jvm.MethodArea.LoadClass(benchMainClass)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	return jvm, def, nil
+}
+
+// 所有用例的字节码都能正确执行
+func TestOpcodeBenches(t *testing.T) {
+	for _, o := range opcodeBenches() {
+		jvm, def, err := o.prepare()
+		if nil != err {
+			t.Fatalf("%s: %v", o.name, err)
+		}
+		if err := o.run(jvm, def, 3); nil != err {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 一次op为循环体执行一次, 即body执行opcodeBenchUnroll次
+func BenchmarkOpcodes(b *testing.B) {
+	for _, o := range opcodeBenches() {
+		o := o
+		b.Run(o.name, func(b *testing.B) {
+			jvm, def, err := o.prepare()
+			if nil != err {
+				b.Fatal(err)
+			}
+			byteCodes := jvm.Stats().TotalByteCodes()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			if err := o.run(jvm, def, b.N); nil != err {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(jvm.Stats().TotalByteCodes() - byteCodes) / float64(b.N), "bytecodes/op")
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// 按操作码计数的字节码执行次数, 下标为操作码;
+// 解释器每执行一条字节码就会累加一次, 始终开启
+type OpcodeCounter [256]int64
+
+func (c *OpcodeCounter) inc(code byte) {
+	atomic.AddInt64(&c[code], 1)
+}
+
+// 单个字节码的执行次数
+type OpcodeCount struct {
+	Opcode byte
+	Name   string
+	Count  int64
+}
+
+// 返回执行过的字节码, 按执行次数从多到少排序
+func (c *OpcodeCounter) Histogram() []*OpcodeCount {
+	result := make([]*OpcodeCount, 0, 32)
+	for code := range c {
+		count := atomic.LoadInt64(&c[code])
+		if 0 == count {
+			continue
+		}
+
+		result = append(result, &OpcodeCount{
+			Opcode: byte(code),
+			Name:   bcode.ToName(byte(code)),
+			Count:  count,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Opcode < result[j].Opcode
+	})
+
+	return result
+}
+
+// 以文本直方图的形式输出, 每行: 助记符 次数 占比 柱状条
+func (c *OpcodeCounter) Dump(w io.Writer) {
+	histogram := c.Histogram()
+
+	var total int64
+	for _, item := range histogram {
+		total += item.Count
+	}
+	if 0 == total {
+		fmt.Fprintln(w, "no byte code executed")
+		return
+	}
+
+	// 柱状条的最大宽度
+	const maxBarWidth = 40
+	for _, item := range histogram {
+		barWidth := int(item.Count * maxBarWidth / histogram[0].Count)
+		fmt.Fprintf(w, "%-16s %12d %6.2f%% %s\n", item.Name, item.Count,
+			float64(item.Count) * 100 / float64(total), strings.Repeat("#", barWidth))
+	}
+	fmt.Fprintf(w, "%-16s %12d\n", "total", total)
+}
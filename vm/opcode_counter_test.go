@@ -0,0 +1,47 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpcodeCounter_Histogram(t *testing.T) {
+	counter := new(OpcodeCounter)
+	counter.inc(bcode.Iload0)
+	counter.inc(bcode.Iadd)
+	counter.inc(bcode.Iadd)
+
+	histogram := counter.Histogram()
+	if 2 != len(histogram) {
+		t.FailNow()
+	}
+	if "iadd" != histogram[0].Name || 2 != histogram[0].Count {
+		t.FailNow()
+	}
+
+	buf := new(bytes.Buffer)
+	counter.Dump(buf)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if 3 != len(lines) {
+		t.Fatalf("unexpected dump:\n%s", buf)
+	}
+	// 按次数从多到少, 柱状条按最大次数缩放, 最后一行为总数
+	for ix, expect := range [][]string{
+		{"iadd", "2", "66.67%", strings.Repeat("#", 40)},
+		{"iload_0", "1", "33.33%", strings.Repeat("#", 20)},
+		{"total", "3"},
+	} {
+		if fields := strings.Fields(lines[ix]); !reflect.DeepEqual(expect, fields) {
+			t.Fatalf("line %d: expect %v, got %v", ix, expect, fields)
+		}
+	}
+
+	empty := new(bytes.Buffer)
+	new(OpcodeCounter).Dump(empty)
+	if "no byte code executed\n" != empty.String() {
+		t.Fatalf("unexpected empty dump %q", empty)
+	}
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 插件指令的实现, 执行时frame的pc指向操作码, 返回后解释器跳过整条指令;
+// 返回的错误与内置指令的错误一样处理, 如"java.lang.XxxException: 描述"
+type OpcodeHandler func(jvm *MiniJvm, frame *MethodStackFrame) error
+
+// 注册插件指令, 不用修改解释器就能执行插桩工具生成的伪指令, 或者实验解释器尚未支持的字节码;
+// 伪指令需要先用bcode.DefineOpcode定义名字和操作数长度; 解释器已经支持的字节码不能替换.
+// 需要在执行字节码之前注册
+func (i *InterpretedExecutionEngine) RegisterOpcodeHandler(op byte, handler OpcodeHandler) error {
+	if !bcode.IsValid(op) {
+		return fmt.Errorf("opcode 0x%02x is not defined, define it with bcode.DefineOpcode first", op)
+	}
+	if IsByteCodeSupported(op) {
+		return fmt.Errorf("opcode '%s' is already implemented by the interpreter", bcode.ToName(op))
+	}
+
+	i.opcodeHandlers[op] = handler
+	return nil
+}
+
+// 解释器内置或者注册了插件的字节码
+func (m *MiniJvm) isByteCodeSupported(op byte) bool {
+	if IsByteCodeSupported(op) {
+		return true
+	}
+
+	engine, ok := m.ExecutionEngine.(*InterpretedExecutionEngine)
+	return ok && nil != engine.opcodeHandlers[op]
+}
+
+// 执行插件指令, 调用者需要确认已经注册; 完成后pc指向指令的最后一个字节, 与内置指令一致
+func (i *InterpretedExecutionEngine) executeOpcodeHandler(frame *MethodStackFrame, op byte) error {
+	length, err := bcode.InstructionLength(frame.codeAttr.Code, frame.pc)
+	if nil != err {
+		return err
+	}
+
+	// ExceptionThrownError不能包装, 否则调用者的异常表无法捕获
+	pc := frame.pc
+	if err := i.opcodeHandlers[op](i.miniJvm, frame); nil != err {
+		return err
+	}
+	frame.pc = pc + length - 1
+
+	return nil
+}
+
+func (f *MethodStackFrame) OpStack() *OpStack {
+	return f.opStack
+}
+
+// 当前指令的操作数, 不包括操作码
+func (f *MethodStackFrame) Operands() []byte {
+	length, err := bcode.InstructionLength(f.codeAttr.Code, f.pc)
+	if nil != err {
+		return nil
+	}
+
+	return f.codeAttr.Code[f.pc + 1 : f.pc + length]
+}
+
+// 正在执行的方法
+func (f *MethodStackFrame) Method() *class.MethodInfo {
+	return f.method
+}
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strings"
+	"testing"
+)
+
+// 插桩工具生成的伪指令: iaddmul n, 弹出两个int, 压入(a + b) * n
+const testOpIaddmul = 0xe0
+
+func TestRegisterOpcodeHandler(t *testing.T) {
+	if err := bcode.DefineOpcode(testOpIaddmul, "iaddmul", 1); nil != err {
+		t.Fatal(err)
+	}
+	if err := bcode.DefineOpcode(bcode.Iadd, "iadd2", 0); nil == err {
+		t.Fatal("standard opcode should not be redefined")
+	}
+
+	b := newClassBuilder("com/fh/Plugin", "java/lang/Object")
+	// static int run() { return iaddmul(2, 3, 4) + 1; }
+	b.method(accflag.Static, "run", "()I", 2, 0, newCodeAssembler().
+		emit(bcode.Iconst2, bcode.Iconst3, testOpIaddmul, 4, bcode.Iconst1, bcode.Iadd, bcode.Ireturn))
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	engine := jvm.ExecutionEngine.(*InterpretedExecutionEngine)
+
+	frame := newMethodStackFrame(1, 0)
+	err = engine.ExecuteWithFrame(b.def, "run", "()I", frame, false)
+	if nil == err || !strings.Contains(err.Error(), "unsupported byte code") {
+		t.Fatalf("expect unsupported byte code before registering, got %v", err)
+	}
+
+	err = engine.RegisterOpcodeHandler(testOpIaddmul, func(jvm *MiniJvm, frame *MethodStackFrame) error {
+		b, _ := frame.OpStack().PopInt()
+		a, _ := frame.OpStack().PopInt()
+		frame.OpStack().PushInt((a + b) * int(frame.Operands()[0]))
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !jvm.isByteCodeSupported(testOpIaddmul) {
+		t.Fatal("registered opcode should be reported as supported")
+	}
+
+	frame = newMethodStackFrame(1, 0)
+	if err := engine.ExecuteWithFrame(b.def, "run", "()I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if ret, _ := frame.opStack.PopInt(); 21 != ret {
+		t.Fatalf("expect 21, got %d", ret)
+	}
+
+	// 内置指令不能替换, 没有定义的操作码不能注册
+	if err := engine.RegisterOpcodeHandler(bcode.Iadd, nil); nil == err {
+		t.Fatal("built-in opcode should not be replaced")
+	}
+	if err := engine.RegisterOpcodeHandler(0xe1, nil); nil == err {
+		t.Fatal("undefined opcode should be rejected")
+	}
+}
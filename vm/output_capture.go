@@ -0,0 +1,165 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"sync"
+)
+
+// 默认保留的输出条数
+const defaultOutputCaptureCapacity = 1024
+
+const (
+	OutputStreamStdout = "stdout"
+	OutputStreamStderr = "stderr"
+)
+
+// guest程序的一次输出
+type OutputEntry struct {
+	// 输出所在的线程编号, 主线程为1
+	ThreadID int64
+
+	// 输出流, stdout或stderr
+	Stream string
+
+	// 输出的文本, 不含末尾换行
+	Text string
+
+	// 传给print方法的原始参数
+	Values []interface{}
+}
+
+// 捕获guest程序通过Printer输出的内容, 单元测试用;
+// 只保留最近capacity条, 可以被多个线程同时写入
+type OutputCapture struct {
+	lock sync.Mutex
+
+	capacity int
+	entries []*OutputEntry
+}
+
+func NewOutputCapture(capacity int) *OutputCapture {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	return &OutputCapture{capacity: capacity}
+}
+
+func (c *OutputCapture) Add(entry *OutputEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// 超出容量时丢弃最旧的
+	if len(c.entries) == c.capacity {
+		copy(c.entries, c.entries[1:])
+		c.entries = c.entries[:c.capacity - 1]
+	}
+	c.entries = append(c.entries, entry)
+}
+
+// 返回所有输出, 从旧到新排列
+func (c *OutputCapture) Entries() []*OutputEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]*OutputEntry(nil), c.entries...)
+}
+
+// 返回所有输出的文本
+func (c *OutputCapture) Texts() []string {
+	entries := c.Entries()
+
+	texts := make([]string, len(entries))
+	for ix, entry := range entries {
+		texts[ix] = entry.Text
+	}
+
+	return texts
+}
+
+// 返回所有输出的原始参数, 按输出顺序展开, 与原来的DebugPrintHistory内容相同
+func (c *OutputCapture) Values() []interface{} {
+	var values []interface{}
+	for _, entry := range c.Entries() {
+		values = append(values, entry.Values...)
+	}
+
+	return values
+}
+
+// 清空已捕获的输出
+func (c *OutputCapture) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = nil
+}
+
+// 记录一次print本地方法调用
+func (m *MiniJvm) capturePrint(frame *MethodStackFrame, descriptor string, values []interface{}) {
+	argDescs, _ := class.ParseMethodDescriptor(descriptor)
+
+	// 每个参数输出一行
+	lines := make([]string, len(values))
+	for ix, val := range values {
+		desc := ""
+		if ix < len(argDescs) {
+			desc = argDescs[ix]
+		}
+		lines[ix] = renderPrintValue(desc, val)
+	}
+
+	m.recordOutput(frame, strings.Join(lines, "\n"), values)
+}
+
+// 记录一条已经生成好文本的输出
+func (m *MiniJvm) recordOutput(frame *MethodStackFrame, text string, values []interface{}) {
+	entry := &OutputEntry{
+		Stream: OutputStreamStdout,
+		Text:   text,
+		Values: append([]interface{}(nil), values...),
+	}
+	if nil != frame {
+		entry.ThreadID = frame.ThreadID()
+	}
+
+	if nil != m.Output {
+		m.Output.Add(entry)
+	}
+
+	// 只有调用者显式打开时才记录, 否则长时间运行的程序会无限增长
+	m.debugPrintLock.Lock()
+	if nil != m.DebugPrintHistory {
+		m.DebugPrintHistory = append(m.DebugPrintHistory, values...)
+	}
+	m.debugPrintLock.Unlock()
+}
+
+// 按参数类型生成与Printer相同的输出文本
+func renderPrintValue(desc string, val interface{}) string {
+	switch desc {
+	case "C":
+		return fmt.Sprintf("%c", val)
+
+	case "Z":
+		if toBool(val) {
+			return "true"
+		}
+		return "false"
+
+	case "Ljava/lang/String;":
+		if strRef, ok := val.(*class.Reference); ok && nil != strRef {
+			runes, _ := class.StringRunes(strRef)
+			return string(runes)
+		}
+		return "null"
+	}
+
+	if ref, ok := val.(*class.Reference); ok {
+		return plainObjectString(ref)
+	}
+
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,59 @@
+package vm
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestOutputCapture(t *testing.T) {
+	jvm := &MiniJvm{Output: NewOutputCapture(2)}
+
+	jvm.capturePrint(nil, "(I)V", []interface{}{1})
+	jvm.capturePrint(nil, "(II)V", []interface{}{2, 3})
+	jvm.capturePrint(nil, "(C)V", []interface{}{'x'})
+	jvm.capturePrint(nil, "(Z)V", []interface{}{0})
+
+	// 只保留最近2条
+	texts := jvm.Output.Texts()
+	if 2 != len(texts) || "x" != texts[0] || "false" != texts[1] {
+		t.Fatalf("unexpected texts %q", texts)
+	}
+	if OutputStreamStdout != jvm.Output.Entries()[0].Stream {
+		t.Fatal("unexpected stream")
+	}
+
+	jvm.Output.Reset()
+	if 0 != len(jvm.Output.Values()) {
+		t.Fatal("output not reset")
+	}
+
+	// DebugPrintHistory默认不记录, 设置为空切片后才记录
+	if nil != jvm.DebugPrintHistory {
+		t.Fatalf("unexpected history %v", jvm.DebugPrintHistory)
+	}
+	jvm.DebugPrintHistory = []interface{}{}
+	jvm.capturePrint(nil, "(II)V", []interface{}{2, 3})
+	if 2 != len(jvm.DebugPrintHistory) || 3 != jvm.DebugPrintHistory[1] {
+		t.Fatalf("unexpected history %v", jvm.DebugPrintHistory)
+	}
+}
+
+func TestOutputCaptureConcurrent(t *testing.T) {
+	jvm := &MiniJvm{Output: NewOutputCapture(100)}
+
+	var wg sync.WaitGroup
+	for ix := 0; ix < 10; ix++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				jvm.capturePrint(nil, "(I)V", []interface{}{n})
+			}
+		}(ix)
+	}
+	wg.Wait()
+
+	if 100 != len(jvm.Output.Entries()) {
+		t.Fatalf("unexpected entry count %d", len(jvm.Output.Entries()))
+	}
+}
@@ -0,0 +1,144 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"strings"
+	"sync"
+)
+
+// 敏感本地方法所需的权限; 内置的本地方法中:
+// file: cn.minijvm.io.Files, network: cn.minijvm.net.HttpClient, env: ProcessEnvironment.environ,
+// reflection: Unsafe.allocateInstance, exit: Shutdown.halt0, database: cn.minijvm.sql;
+// 虚拟机没有实现创建进程的本地方法, process留给宿主通过BindNative和SetPermission绑定的本地方法使用
+const (
+	PermissionFile       = "file"
+	PermissionNetwork    = "network"
+	PermissionProcess    = "process"
+	PermissionEnv        = "env"
+	PermissionReflection = "reflection"
+	PermissionExit       = "exit"
+	PermissionDatabase   = "database"
+)
+
+// 策略对某个权限的处理方式
+type PolicyDecision int
+
+const (
+	PolicyAllow PolicyDecision = iota
+	PolicyDeny
+	// 交给Prompt回调决定
+	PolicyPrompt
+)
+
+// 一次敏感本地方法调用的权限检查请求
+type PolicyRequest struct {
+	Permission string
+
+	// 本地方法, 类名用/分隔
+	ClassName  string
+	MethodName string
+	Descriptor string
+
+	// 方法参数, 不含jvm指针和接收者
+	Args []interface{}
+}
+
+func (r *PolicyRequest) String() string {
+	return fmt.Sprintf("%s %s.%s%s", r.Permission, r.ClassName, r.MethodName, r.Descriptor)
+}
+
+// 本地方法的安全策略, 类似于SecurityManager;
+// 每次调用需要权限的本地方法前都会检查, 检查不通过时终止guest程序
+type Policy struct {
+	lock sync.RWMutex
+
+	// 没有单独配置的权限使用的处理方式
+	defaultDecision PolicyDecision
+	decisions map[string]PolicyDecision
+
+	// 处理方式为PolicyPrompt时调用, 返回是否放行; 为nil时拒绝
+	Prompt func(req *PolicyRequest) bool
+
+	// 记录每次检查的结果; 为nil时写入JVM日志
+	Audit func(req *PolicyRequest, allowed bool)
+}
+
+func NewPolicy(defaultDecision PolicyDecision) *Policy {
+	return &Policy{
+		defaultDecision: defaultDecision,
+		decisions:       make(map[string]PolicyDecision),
+	}
+}
+
+// 设置某个权限的处理方式
+func (p *Policy) Set(permission string, decision PolicyDecision) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.decisions[permission] = decision
+}
+
+func (p *Policy) Allow(permissions ...string) {
+	for _, perm := range permissions {
+		p.Set(perm, PolicyAllow)
+	}
+}
+
+func (p *Policy) Deny(permissions ...string) {
+	for _, perm := range permissions {
+		p.Set(perm, PolicyDeny)
+	}
+}
+
+func (p *Policy) decisionOf(permission string) PolicyDecision {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	decision, ok := p.decisions[permission]
+	if !ok {
+		return p.defaultDecision
+	}
+
+	return decision
+}
+
+// 检查权限, 不允许时返回*PermissionDeniedError
+func (p *Policy) Check(req *PolicyRequest) error {
+	allowed := false
+	switch p.decisionOf(req.Permission) {
+	case PolicyAllow:
+		allowed = true
+
+	case PolicyPrompt:
+		allowed = nil != p.Prompt && p.Prompt(req)
+	}
+
+	if nil != p.Audit {
+		p.Audit(req, allowed)
+
+	} else if allowed {
+		utils.LogInfoPrintf("policy: allow %s", req)
+
+	} else {
+		utils.LogInfoPrintf("policy: deny %s", req)
+	}
+
+	if !allowed {
+		return &PermissionDeniedError{Request: req}
+	}
+
+	return nil
+}
+
+// 解析逗号分隔的权限列表, 如"file,network"
+func ParsePermissions(s string) []string {
+	var perms []string
+	for _, perm := range strings.Split(s, ",") {
+		if perm = strings.TrimSpace(perm); "" != perm {
+			perms = append(perms, perm)
+		}
+	}
+
+	return perms
+}
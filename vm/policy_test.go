@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := NewPolicy(PolicyDeny)
+	policy.Allow(PermissionEnv)
+	policy.Set(PermissionFile, PolicyPrompt)
+
+	audited := make(map[string]bool)
+	policy.Audit = func(req *PolicyRequest, allowed bool) {
+		audited[req.Permission] = allowed
+	}
+
+	if err := policy.Check(&PolicyRequest{Permission: PermissionEnv}); nil != err {
+		t.Fatalf("env should be allowed: %v", err)
+	}
+
+	err := policy.Check(&PolicyRequest{Permission: PermissionExit, ClassName: "java/lang/Shutdown", MethodName: "halt0", Descriptor: "(I)V"})
+	if _, ok := err.(*PermissionDeniedError); !ok {
+		t.Fatalf("exit should be denied, got %v", err)
+	}
+
+	// 没有Prompt回调时拒绝
+	if err := policy.Check(&PolicyRequest{Permission: PermissionFile}); nil == err {
+		t.Fatal("file should be denied without prompt callback")
+	}
+	policy.Prompt = func(req *PolicyRequest) bool {
+		return "cn/minijvm/io/Files" == req.ClassName
+	}
+	if err := policy.Check(&PolicyRequest{Permission: PermissionFile, ClassName: "cn/minijvm/io/Files"}); nil != err {
+		t.Fatalf("file should be allowed by prompt: %v", err)
+	}
+
+	if !audited[PermissionEnv] || audited[PermissionExit] || !audited[PermissionFile] {
+		t.Fatalf("unexpected audit log %v", audited)
+	}
+}
+
+func TestSetPermission(t *testing.T) {
+	table := NewNativeMethodTable()
+	if nil == table.SetPermission("com/acme/Host", "fetch", "()V", PermissionNetwork) {
+		t.Fatal("expected error for unregistered method")
+	}
+
+	table.RegisterMethod("com.acme.Host", "fetch", "()V", func(args ...interface{}) interface{} { return nil })
+	if err := table.SetPermission("com.acme.Host", "fetch", "()V", PermissionNetwork); nil != err {
+		t.Fatal(err)
+	}
+	if PermissionNetwork != table.FindMethodInfo("com/acme/Host", "fetch", "()V").Permission {
+		t.Fatal("permission not set")
+	}
+}
+
+func TestBuiltinSensitiveMethods(t *testing.T) {
+	table := newBuiltinNativeMethodTable()
+	cases := []struct {
+		className, methodName, descriptor, permission string
+	}{
+		{"cn/minijvm/io/Files", "readString", "(Ljava/lang/String;)Ljava/lang/String;", PermissionFile},
+		{"cn/minijvm/net/HttpClient", "send", "(Ljava/lang/String;Ljava/lang/String;[Ljava/lang/String;[B)Lcn/minijvm/net/HttpResponse;", PermissionNetwork},
+		{"java/lang/ProcessEnvironment", "environ", "()[[B", PermissionEnv},
+		{"sun/misc/Unsafe", "allocateInstance", "(Ljava/lang/Class;)Ljava/lang/Object;", PermissionReflection},
+		{"java/lang/Shutdown", "halt0", "(I)V", PermissionExit},
+		{"cn/minijvm/sql/Statement", "executeQuery", "(Ljava/lang/String;[Ljava/lang/Object;)Lcn/minijvm/sql/ResultSet;", PermissionDatabase},
+	}
+	for _, c := range cases {
+		info := table.FindMethodInfo(c.className, c.methodName, c.descriptor)
+		if nil == info || c.permission != info.Permission {
+			t.Fatalf("%s.%s should require %s permission", c.className, c.methodName, c.permission)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"sync"
+)
+
+// 预加载清单: 启动时提前读取, 解析和链接(解码字节码)的类和方法, 减少第一次请求时加载类的延迟;
+// 通常由上一次运行的PreloadRecorder生成. 文本格式, 每行一项, #开头为注释:
+//   com.fh.Foo                   类
+//   com.fh.Foo.bar(I)V           方法, 所在的类也会被预加载
+// 预加载不执行<clinit>, 也不放入ClassMap, 类第一次被使用时才按原来的顺序初始化
+type PreloadManifest struct {
+	// 类全名, 以/分隔, 按上次运行的加载顺序
+	Classes []string
+	// 按上次运行第一次调用的顺序; LazyLink时只链接这些方法, 以后JIT也从这里选择方法
+	Methods []*PreloadMethod
+}
+
+type PreloadMethod struct {
+	// 以/分隔
+	ClassName  string
+	Name       string
+	Descriptor string
+}
+
+func (p *PreloadMethod) String() string {
+	return strings.ReplaceAll(p.ClassName, "/", ".") + "." + p.Name + p.Descriptor
+}
+
+// 读取清单, 格式见PreloadManifest
+func ReadPreloadManifest(r io.Reader) (*PreloadManifest, error) {
+	manifest := new(PreloadManifest)
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		paren := strings.Index(line, "(")
+		if paren < 0 {
+			manifest.Classes = append(manifest.Classes, strings.ReplaceAll(line, ".", "/"))
+			continue
+		}
+
+		dot := strings.LastIndex(line[:paren], ".")
+		if dot <= 0 || dot + 1 == paren {
+			return nil, fmt.Errorf("invalid preload entry at line %d: '%s', expect com.fh.Foo or com.fh.Foo.bar(I)V", lineNumber, line)
+		}
+		manifest.Methods = append(manifest.Methods, &PreloadMethod{
+			ClassName:  strings.ReplaceAll(line[:dot], ".", "/"),
+			Name:       line[dot + 1:paren],
+			Descriptor: line[paren:],
+		})
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// 按ReadPreloadManifest能读取的格式输出
+func (p *PreloadManifest) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# mini-jvm preload manifest: %d classes, %d methods\n", len(p.Classes), len(p.Methods))
+	for _, name := range p.Classes {
+		fmt.Fprintln(bw, strings.ReplaceAll(name, "/", "."))
+	}
+	for _, method := range p.Methods {
+		fmt.Fprintln(bw, method.String())
+	}
+
+	return bw.Flush()
+}
+
+// 清单中所有需要预加载的类, 去重后保持顺序
+func (p *PreloadManifest) classNames() []string {
+	names := make([]string, 0, len(p.Classes))
+	seen := make(map[string]bool, len(p.Classes))
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range p.Classes {
+		add(name)
+	}
+	for _, method := range p.Methods {
+		add(method.ClassName)
+	}
+
+	return names
+}
+
+// 预加载的结果
+type PreloadResult struct {
+	// 解析好等待使用的类的数量
+	Classes int
+	// 链接过的方法的数量
+	Methods int
+	// 跳过的项和原因, 如classpath改变后找不到的类; 这些类使用时按原来的方式加载和报错
+	Skipped []string
+}
+
+// 按清单提前解析和链接类, 结果保存在方法区中, 类第一次加载时直接使用; 需要在执行字节码之前调用.
+// 清单可能是旧的, 找不到或者链接失败的项只记录在结果中, 不返回错误
+func (m *MiniJvm) PreloadClasses(manifest *PreloadManifest) *PreloadResult {
+	result := new(PreloadResult)
+
+	defs := make(map[string]*class.DefFile)
+	for _, name := range manifest.classNames() {
+		if strings.HasPrefix(name, "[") || m.MethodArea.isLoaded(name) {
+			continue
+		}
+
+		def, err := m.MethodArea.ParseClass(name)
+		if nil != err {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+
+		// Rewriter在链接之前改写字节码, 只能等到加载类时再链接
+		if nil == m.Rewriter && !m.LazyLink {
+			if err := linkClass(def); nil != err {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			result.Methods += len(def.Methods)
+		}
+
+		defs[name] = def
+	}
+
+	// LazyLink时只链接上次运行执行过的方法
+	if nil == m.Rewriter && m.LazyLink {
+		for _, method := range manifest.Methods {
+			def, ok := defs[method.ClassName]
+			if !ok {
+				continue
+			}
+
+			methodInfo := findDeclaredMethod(def, method.Name, method.Descriptor)
+			if nil == methodInfo {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: method not found", method))
+				continue
+			}
+			if _, err := linkMethod(def, methodInfo); nil != err {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", method, err))
+				continue
+			}
+			result.Methods++
+		}
+	}
+
+	m.MethodArea.addPreloaded(defs)
+	result.Classes = len(defs)
+	utils.LogInfoPrintf("preloaded %d classes, %d methods, skipped %d", result.Classes, result.Methods, len(result.Skipped))
+
+	return result
+}
+
+func findDeclaredMethod(def *class.DefFile, name string, descriptor string) *class.MethodInfo {
+	for _, method := range def.Methods {
+		if name == def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String() &&
+			descriptor == def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String() {
+			return method
+		}
+	}
+
+	return nil
+}
+
+// 记录一次运行中从classpath加载的类和执行过的方法, 退出时用Manifest()生成下次启动的预加载清单;
+// 设置到MiniJvm.PreloadRecorder上生效
+type PreloadRecorder struct {
+	classes []string
+	methods []*class.MethodInfo
+	// 已经记录过的方法
+	seen map[*class.MethodInfo]bool
+	lock sync.Mutex
+}
+
+func NewPreloadRecorder() *PreloadRecorder {
+	return &PreloadRecorder{seen: make(map[*class.MethodInfo]bool)}
+}
+
+func (r *PreloadRecorder) onClassLoaded(def *class.DefFile) {
+	r.lock.Lock()
+	r.classes = append(r.classes, def.FullClassName)
+	r.lock.Unlock()
+}
+
+func (r *PreloadRecorder) onInvoke(method *class.MethodInfo) {
+	r.lock.Lock()
+	if !r.seen[method] {
+		r.seen[method] = true
+		r.methods = append(r.methods, method)
+	}
+	r.lock.Unlock()
+}
+
+// 到目前为止的记录; 只包含从classpath加载的类中的方法, 内存中定义的类(如REPL片段)下次启动时不存在
+func (r *PreloadRecorder) Manifest() *PreloadManifest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	manifest := &PreloadManifest{Classes: append([]string(nil), r.classes...)}
+	loaded := make(map[string]bool, len(r.classes))
+	for _, name := range r.classes {
+		loaded[name] = true
+	}
+
+	for _, method := range r.methods {
+		def := method.DefFile
+		if !loaded[def.FullClassName] {
+			continue
+		}
+		manifest.Methods = append(manifest.Methods, &PreloadMethod{
+			ClassName:  def.FullClassName,
+			Name:       def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String(),
+			Descriptor: def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String(),
+		})
+	}
+
+	return manifest
+}
@@ -0,0 +1,128 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// class Hello { static int twice(int x) { return Util.add(x, x); } }
+// class Util { static int add(int a, int b) { return a + b; } static void unused() {} }
+func newPreloadTestJvm(t *testing.T) *MiniJvm {
+	hello := newClassBuilder("com/fh/Hello", "java/lang/Object")
+	hello.method(accflag.Static, "twice", "(I)I", 2, 1, newCodeAssembler().
+		emit(bcode.Iload0, bcode.Iload0).
+		emitIndex(bcode.Invokestatic, hello.methodRef("com/fh/Util", "add", "(II)I")).
+		emit(bcode.Ireturn))
+	util := newClassBuilder("com/fh/Util", "java/lang/Object")
+	util.method(accflag.Static, "add", "(II)I", 2, 2, newCodeAssembler().emit(bcode.Iload0, bcode.Iload1, bcode.Iadd, bcode.Ireturn))
+	util.method(accflag.Static, "unused", "()V", 0, 0, newCodeAssembler().emit(bcode.Return))
+
+	classes := make(map[string][]byte)
+	for _, def := range []*class.DefFile{hello.def, util.def} {
+		buf, err := class.WriteClass(def)
+		if nil != err {
+			t.Fatal(err)
+		}
+		classes[def.FullClassName] = buf
+	}
+	jar, err := buildClassesJar(classes)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	jvm, err := newClassInitTestJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := jvm.MethodArea.AddJarBytes("app.jar", jar); nil != err {
+		t.Fatal(err)
+	}
+
+	return jvm
+}
+
+func runPreloadTwice(t *testing.T, jvm *MiniJvm) {
+	def, err := jvm.MethodArea.LoadClass("com/fh/Hello")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	frame := newMethodStackFrame(1, 0)
+	frame.opStack.Push(21)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(def, "twice", "(I)I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if ret, _ := frame.opStack.Pop(); 42 != ret {
+		t.Fatalf("unexpected result %v", ret)
+	}
+}
+
+func TestPreloadRecorder(t *testing.T) {
+	jvm := newPreloadTestJvm(t)
+	jvm.PreloadRecorder = NewPreloadRecorder()
+	runPreloadTwice(t, jvm)
+
+	manifest := jvm.PreloadRecorder.Manifest()
+	if !reflect.DeepEqual([]string{"com/fh/Hello", "com/fh/Util"}, manifest.Classes) {
+		t.Fatalf("unexpected classes %v", manifest.Classes)
+	}
+	// 没有执行过的方法不记录
+	if 2 != len(manifest.Methods) || "com.fh.Hello.twice(I)I" != manifest.Methods[0].String() || "com.fh.Util.add(II)I" != manifest.Methods[1].String() {
+		t.Fatalf("unexpected methods %v", manifest.Methods)
+	}
+
+	out := new(bytes.Buffer)
+	if err := manifest.Write(out); nil != err {
+		t.Fatal(err)
+	}
+	parsed, err := ReadPreloadManifest(out)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest, parsed) {
+		t.Fatalf("manifest changed after write and read:\n%s", out)
+	}
+}
+
+func TestPreloadClasses(t *testing.T) {
+	manifest, err := ReadPreloadManifest(strings.NewReader("# comment\ncom.fh.Hello\ncom.fh.Gone\n\ncom.fh.Util.add(II)I\ncom.fh.Util.missing()V\n"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for _, lazyLink := range []bool{false, true} {
+		jvm := newPreloadTestJvm(t)
+		jvm.LazyLink = lazyLink
+
+		// 找不到的类和方法跳过; 不开启LazyLink时链接类中所有方法, 否则只链接清单中的方法
+		result := jvm.PreloadClasses(manifest)
+		expectMethods, expectSkipped := 3, 1
+		if lazyLink {
+			expectMethods, expectSkipped = 1, 2
+		}
+		if 2 != result.Classes || expectMethods != result.Methods || expectSkipped != len(result.Skipped) {
+			t.Fatalf("lazyLink %v: unexpected result %+v", lazyLink, result)
+		}
+
+		// 预加载不放入ClassMap, 也不执行<clinit>
+		if jvm.MethodArea.isLoaded("com/fh/Hello") {
+			t.Fatalf("lazyLink %v: preloaded class should not be registered", lazyLink)
+		}
+		preloaded := jvm.MethodArea.preloaded["com/fh/Hello"]
+
+		runPreloadTwice(t, jvm)
+		def, _ := jvm.MethodArea.LoadClass("com/fh/Hello")
+		if preloaded != def || 0 != len(jvm.MethodArea.preloaded) {
+			t.Fatalf("lazyLink %v: preloaded class not used", lazyLink)
+		}
+	}
+
+	if _, err := ReadPreloadManifest(strings.NewReader("com.fh.Hello.(I)I")); nil == err {
+		t.Fatal("expect invalid entry error")
+	}
+}
@@ -0,0 +1,247 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 下载远程classpath的默认超时时间
+const defaultRemoteClassPathTimeout = 60 * time.Second
+
+// 解析classpath(下载远程jar包, 转换dex, 展开fat jar)时的选项, 零值使用默认设置
+type ClassPathOptions struct {
+	// 远程classpath下载和fat jar展开后的本地缓存目录, 为空时使用用户缓存目录下的mini-jvm/classpath
+	CacheDir string
+
+	// 下载远程classpath的超时时间, 为0时使用默认的60秒
+	Timeout time.Duration
+
+	// 为true时允许下载没有校验和的https jar包, 默认拒绝, 防止被篡改的jar包在本地执行
+	AllowUnverified bool
+
+	// 下载使用的client, 为nil时按Timeout创建
+	Client *http.Client
+
+	// 把Android的dex, apk转换成jar的工具, 返回转换后的jar路径, 如Dex2jarConverter;
+	// 为nil时classpath中出现dex返回DexFormatError
+	DexConverter func(dexPath string) (string, error)
+}
+
+// 是否为http/https形式的classpath
+func isRemoteClassPath(cp string) bool {
+	return strings.HasPrefix(cp, "http://") || strings.HasPrefix(cp, "https://")
+}
+
+// 创建方法区时使用的classpath选项, 没有设置时返回默认选项
+func (m *MiniJvm) classPathOptions() *ClassPathOptions {
+	if nil == m || nil == m.ClassPathOptions {
+		return new(ClassPathOptions)
+	}
+
+	return m.ClassPathOptions
+}
+
+func (o *ClassPathOptions) httpClient() *http.Client {
+	if nil != o.Client {
+		return o.Client
+	}
+
+	timeout := o.Timeout
+	if 0 == timeout {
+		timeout = defaultRemoteClassPathTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// 把远程jar包下载到本地缓存, 返回本地路径; 与URLClassLoader一样, 只在启动时下载一次;
+// 校验和来源(优先级从高到低):
+// 1. url中的fragment, 如 https://host/demo.jar#sha256=xxx
+// 2. 服务器上同名的.sha256文件, 如 https://host/demo.jar.sha256, 只用于https
+// 都没有时报错, 除非设置了AllowUnverified; http传输的内容和.sha256文件都可能被篡改, 所以http必须在fragment中指定校验和.
+// 下载成功后把校验和记录在缓存文件旁边的.sha256文件中, 之后先按记录校验缓存, 不需要访问网络
+func (o *ClassPathOptions) fetchRemoteClassPath(rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if nil != err {
+		return "", fmt.Errorf("invalid classpath url '%s': %w", rawUrl, err)
+	}
+
+	expectedSum := ""
+	if strings.HasPrefix(u.Fragment, "sha256=") {
+		expectedSum = strings.ToLower(strings.TrimPrefix(u.Fragment, "sha256="))
+	}
+	u.Fragment = ""
+	downloadUrl := u.String()
+
+	if "http" == u.Scheme && "" == expectedSum {
+		return "", fmt.Errorf("refuse to download classpath '%s' over http without checksum: append #sha256=<checksum> to the url or use https", downloadUrl)
+	}
+
+	// 目前只支持jar包, 不支持远程目录
+	if !strings.HasSuffix(u.Path, ".jar") {
+		return "", fmt.Errorf("unsupported classpath url '%s': only jar file is supported", rawUrl)
+	}
+
+	cacheDir, err := o.cacheDir()
+	if nil != err {
+		return "", err
+	}
+
+	// 缓存文件名带上url的摘要, 防止不同服务器上的同名jar冲突
+	urlSum := sha256.Sum256([]byte(downloadUrl))
+	localPath := filepath.Join(cacheDir, hex.EncodeToString(urlSum[:8]) + "-" + path.Base(u.Path))
+
+	// 命中缓存: 与记录的校验和一致, 并且与fragment中指定的校验和(如果有)一致
+	if recordedSum := readRecordedChecksum(localPath); "" != recordedSum && ("" == expectedSum || recordedSum == expectedSum) {
+		sum, err := fileSha256(localPath)
+		if nil == err && sum == recordedSum {
+			utils.LogInfoPrintf("use cached classpath %s for %s", localPath, downloadUrl)
+			return localPath, nil
+		}
+
+		utils.LogInfoPrintf("checksum of cached classpath %s mismatched, download again", localPath)
+	}
+
+	client := o.httpClient()
+
+	if "" == expectedSum {
+		expectedSum, err = fetchRemoteChecksum(client, downloadUrl + ".sha256")
+		if nil != err {
+			return "", err
+		}
+	}
+	if "" == expectedSum && !o.AllowUnverified {
+		return "", fmt.Errorf("refuse to download classpath '%s' without checksum: append #sha256=<checksum> to the url, "+
+			"publish %s.sha256, or allow unverified classpath explicitly", downloadUrl, downloadUrl)
+	}
+
+	utils.LogInfoPrintf("download classpath %s", downloadUrl)
+	sum, err := downloadFile(client, downloadUrl, localPath, expectedSum)
+	if nil != err {
+		return "", fmt.Errorf("failed to download classpath '%s': %w", downloadUrl, err)
+	}
+	if err := ioutil.WriteFile(localPath + ".sha256", []byte(sum + "\n"), 0644); nil != err {
+		return "", fmt.Errorf("failed to record checksum of classpath '%s': %w", downloadUrl, err)
+	}
+
+	return localPath, nil
+}
+
+// 读取下载时记录的校验和, 没有记录时返回空串
+func readRecordedChecksum(localPath string) string {
+	buf, err := ioutil.ReadFile(localPath + ".sha256")
+	if nil != err {
+		return ""
+	}
+
+	return strings.TrimSpace(string(buf))
+}
+
+func (o *ClassPathOptions) cacheDir() (string, error) {
+	dir := o.CacheDir
+	if "" == dir {
+		userCacheDir, err := os.UserCacheDir()
+		if nil != err {
+			return "", fmt.Errorf("failed to locate cache dir: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, "mini-jvm", "classpath")
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if nil != err {
+		return "", fmt.Errorf("failed to create cache dir '%s': %w", dir, err)
+	}
+
+	return dir, nil
+}
+
+// 读取.sha256文件中的校验和, 文件不存在时返回空串
+func fetchRemoteChecksum(client *http.Client, sumUrl string) (string, error) {
+	resp, err := client.Get(sumUrl)
+	if nil != err {
+		return "", fmt.Errorf("failed to fetch checksum '%s': %w", sumUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if http.StatusNotFound == resp.StatusCode {
+		return "", nil
+	}
+	if http.StatusOK != resp.StatusCode {
+		return "", fmt.Errorf("failed to fetch checksum '%s': %s", sumUrl, resp.Status)
+	}
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return "", fmt.Errorf("failed to fetch checksum '%s': %w", sumUrl, err)
+	}
+
+	// 兼容sha256sum的输出格式: <校验和>  <文件名>
+	fields := strings.Fields(string(buf))
+	if 0 == len(fields) {
+		return "", fmt.Errorf("empty checksum file '%s'", sumUrl)
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+// 先下载到临时文件, 校验通过后再重命名, 防止留下不完整的缓存; 返回文件的校验和
+func downloadFile(client *http.Client, fileUrl string, localPath string, expectedSum string) (string, error) {
+	resp, err := client.Get(fileUrl)
+	if nil != err {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if http.StatusOK != resp.StatusCode {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(localPath), filepath.Base(localPath) + ".*.tmp")
+	if nil != err {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), resp.Body)
+	closeErr := tmpFile.Close()
+	if nil != err {
+		return "", err
+	}
+	if nil != closeErr {
+		return "", closeErr
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if "" != expectedSum && sum != expectedSum {
+		return "", fmt.Errorf("checksum mismatched, expected %s, got %s", expectedSum, sum)
+	}
+
+	return sum, os.Rename(tmpFile.Name(), localPath)
+}
+
+func fileSha256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if nil != err {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if nil != err {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 把entries打包成jar, key为jar中的文件名
+func buildTestJar(t *testing.T, entries map[string][]byte) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, content := range entries {
+		f, err := w.Create(name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func readTestClass(t *testing.T, name string) []byte {
+	classBuf, err := ioutil.ReadFile("../testcase/classes/" + name + ".class")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return classBuf
+}
+
+func TestRemoteClassPath(t *testing.T) {
+	jarBuf := buildTestJar(t, map[string][]byte{"com/fh/Person.class": readTestClass(t, "com/fh/Person")})
+	sum := sha256.Sum256(jarBuf)
+
+	downloads := 0
+	unverifiedJar := buildTestJar(t, map[string][]byte{"com/fh/Person.class": readTestClass(t, "com/fh/Person")})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/demo.jar":
+			downloads++
+			w.Write(jarBuf)
+		case "/unverified.jar":
+			w.Write(unverifiedJar)
+		case "/demo.jar.sha256":
+			w.Write([]byte(hex.EncodeToString(sum[:]) + "  demo.jar\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "mini-jvm-cp")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	jvm := &MiniJvm{ClassPathOptions: &ClassPathOptions{CacheDir: cacheDir, Client: server.Client()}, stats: new(vmStats)}
+
+	for ix := 0; ix < 2; ix++ {
+		ma, err := NewMethodArea(jvm, []string{server.URL + "/demo.jar"}, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		def, err := ma.ParseClass("com/fh/Person")
+		if nil != err {
+			t.Fatal(err)
+		}
+		if "com/fh/Person" != def.ExtractFullClassName() {
+			t.Fatalf("unexpected class %s", def.ExtractFullClassName())
+		}
+	}
+
+	// 第二次命中本地缓存
+	if 1 != downloads {
+		t.Fatalf("expected 1 download, got %d", downloads)
+	}
+
+	// fragment中的校验和不匹配时报错
+	_, err = NewMethodArea(jvm, []string{server.URL + "/demo.jar#sha256=00"}, nil)
+	if nil == err {
+		t.Fatal("expected checksum error")
+	}
+
+	// 没有校验和时默认拒绝, 显式允许后才下载
+	if _, err = NewMethodArea(jvm, []string{server.URL + "/unverified.jar"}, nil); nil == err || !strings.Contains(err.Error(), "without checksum") {
+		t.Fatalf("expected unverified classpath to be refused, got %v", err)
+	}
+	jvm.ClassPathOptions.AllowUnverified = true
+	_, err = NewMethodArea(jvm, []string{server.URL + "/unverified.jar"}, nil)
+	jvm.ClassPathOptions.AllowUnverified = false
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 离线时按记录的校验和使用缓存
+	server.Close()
+	for _, cp := range []string{server.URL + "/demo.jar", server.URL + "/demo.jar#sha256=" + hex.EncodeToString(sum[:]), server.URL + "/unverified.jar"} {
+		if _, err := NewMethodArea(jvm, []string{cp}, nil); nil != err {
+			t.Fatalf("%s: %v", cp, err)
+		}
+	}
+}
+
+func TestHttpClassPathRequiresChecksum(t *testing.T) {
+	jarBuf := buildTestJar(t, map[string][]byte{"com/fh/Person.class": readTestClass(t, "com/fh/Person")})
+	sum := sha256.Sum256(jarBuf)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/demo.jar":
+			w.Write(jarBuf)
+		case "/demo.jar.sha256":
+			w.Write([]byte(hex.EncodeToString(sum[:])))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "mini-jvm-cp")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	jvm := &MiniJvm{ClassPathOptions: &ClassPathOptions{CacheDir: cacheDir, AllowUnverified: true}, stats: new(vmStats)}
+
+	// http传输的.sha256文件不可信, 允许没有校验和的classpath时也不例外
+	if _, err := NewMethodArea(jvm, []string{server.URL + "/demo.jar"}, nil); nil == err || !strings.Contains(err.Error(), "over http") {
+		t.Fatalf("expected http classpath without fragment to be refused, got %v", err)
+	}
+	if _, err := NewMethodArea(jvm, []string{server.URL + "/demo.jar#sha256=" + hex.EncodeToString(sum[:])}, nil); nil != err {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,234 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// REPL生成的类名前缀, 第n个片段的类名为ReplSnippet<n>
+const ReplClassPrefix = "ReplSnippet"
+
+const replPrompt = "mini-jvm> "
+
+const replHelp = `输入java表达式或语句, 回车后执行并显示结果
+  /help  显示帮助
+  /exit  退出
+没有指定-javac时只支持数字和字符串字面量组成的算术/字符串表达式, 整数按long计算`
+
+// 用javac编译表达式时的包装类, 结果按Object返回(基本类型自动装箱)
+const replExpressionTemplate = `public class %s {
+    public static Object eval() throws Throwable {
+        return (%s);
+    }
+}
+`
+
+// 表达式编译失败时按语句编译
+const replStatementTemplate = `public class %s {
+    public static void eval() throws Throwable {
+        %s
+    }
+}
+`
+
+// 交互式执行java片段(简化版jshell): 每个片段包装成合成类的静态方法eval, 在虚拟机中执行并显示结果;
+// 配置了javac时用javac编译, 否则使用内置的表达式编译器(见compileReplExpression). 所有片段在同一个虚拟机中执行
+type Repl struct {
+	Jvm *MiniJvm
+	// javac的路径, 为空时使用内置的表达式编译器
+	Javac string
+	// 显示结果的方式
+	Renderer *ObjectRenderer
+
+	// 已经执行的片段个数, 用于生成类名和结果名
+	count int
+	// javac输出class的临时目录, 第一次使用javac时创建并加入classpath
+	workDir string
+}
+
+// 一个片段的执行结果
+type ReplResult struct {
+	// 结果名, 如$1; 片段是语句或者void方法调用时为空
+	Name string
+	// 结果的java类型, 如long, java.lang.String
+	Type string
+	Value interface{}
+
+	text string
+}
+
+// 与jshell一样显示为 $1 ==> 3
+func (r *ReplResult) String() string {
+	if "" == r.Name {
+		return ""
+	}
+
+	return r.Name + " ==> " + r.text
+}
+
+func NewRepl(jvm *MiniJvm, javac string) *Repl {
+	return &Repl{Jvm: jvm, Javac: javac, Renderer: DefaultObjectRenderer}
+}
+
+// 编译并执行一个片段; 编译错误和guest没有捕获的异常都作为error返回, 不影响以后的片段
+func (r *Repl) Eval(snippet string) (*ReplResult, error) {
+	snippet = strings.TrimSpace(snippet)
+	r.count++
+	className := fmt.Sprintf("%s%d", ReplClassPrefix, r.count)
+
+	var def *class.DefFile
+	var desc string
+	var err error
+	if "" == r.Javac {
+		def, desc, err = compileReplExpression(className, snippet)
+		if nil != err {
+			return nil, err
+		}
+		err = r.Jvm.MethodArea.DefineClass(def)
+
+	} else {
+		desc, err = r.compileWithJavac(className, snippet)
+		if nil != err {
+			return nil, err
+		}
+		def, err = r.Jvm.MethodArea.LoadClass(className)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	// 返回值放在调用者栈帧的操作数栈上
+	frame := newMethodStackFrame(1, 0)
+	if err := r.Jvm.ExecutionEngine.ExecuteWithFrame(def, "eval", desc, frame, false); nil != err {
+		return nil, err
+	}
+
+	returnDesc := desc[strings.Index(desc, ")") + 1:]
+	if "V" == returnDesc {
+		return &ReplResult{}, nil
+	}
+
+	val, _ := frame.opStack.Pop()
+	return &ReplResult{
+		Name:  fmt.Sprintf("$%d", r.count),
+		Type:  javaTypeName(returnDesc),
+		Value: val,
+		text:  r.render(val),
+	}, nil
+}
+
+// 与Double.toString()一致显示浮点数, 其他值由Renderer显示
+func (r *Repl) render(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		return formatJavaDouble(v)
+	case float32:
+		return formatJavaDouble(float64(v))
+	}
+
+	return r.Renderer.Render(val)
+}
+
+// 先按表达式编译, 失败时(如void方法调用, 语句)再按语句编译; 返回eval的描述符
+func (r *Repl) compileWithJavac(className string, snippet string) (string, error) {
+	if "" == r.workDir {
+		dir, err := ioutil.TempDir("", "mini-jvm-repl")
+		if nil != err {
+			return "", err
+		}
+		r.workDir = dir
+		r.Jvm.MethodArea.PrependClassPath(dir)
+	}
+
+	exprErr := r.javac(className, fmt.Sprintf(replExpressionTemplate, className, strings.TrimSuffix(snippet, ";")))
+	if nil == exprErr {
+		return "()Ljava/lang/Object;", nil
+	}
+
+	isStatement := strings.HasSuffix(snippet, ";") || strings.HasSuffix(snippet, "}")
+	if !isStatement {
+		snippet += ";"
+	}
+	if err := r.javac(className, fmt.Sprintf(replStatementTemplate, className, snippet)); nil != err {
+		// 报告与片段形式对应的错误
+		if isStatement {
+			return "", err
+		}
+		return "", exprErr
+	}
+
+	return "()V", nil
+}
+
+func (r *Repl) javac(className string, source string) error {
+	path := filepath.Join(r.workDir, className + ".java")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); nil != err {
+		return err
+	}
+
+	snapshot := r.Jvm.MethodArea.classPathSnapshot()
+	classPaths := make([]string, 0, len(snapshot))
+	for _, cp := range snapshot {
+		if "" != cp {
+			classPaths = append(classPaths, cp)
+		}
+	}
+
+	cmd := exec.Command(r.Javac, "-nowarn", "-d", r.workDir, "-cp", strings.Join(classPaths, string(os.PathListSeparator)), path)
+	out, err := cmd.CombinedOutput()
+	if nil != err {
+		return fmt.Errorf("compile error: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// 逐行读取片段并执行, 输入结束或者/exit时返回; guest的输出和结果都写入out
+func (r *Repl) Run(in io.Reader, out io.Writer) error {
+	r.Jvm.Stdout = out
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(out, replPrompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case "/exit":
+			return nil
+		case "/help":
+			fmt.Fprintln(out, replHelp)
+			continue
+		}
+
+		result, err := r.Eval(line)
+		if nil != err {
+			fmt.Fprintf(out, "|  error: %v\n", err)
+			continue
+		}
+		if "" != result.Name {
+			fmt.Fprintln(out, result)
+		}
+	}
+}
+
+// 删除javac的临时目录
+func (r *Repl) Close() error {
+	if "" == r.workDir {
+		return nil
+	}
+
+	return os.RemoveAll(r.workDir)
+}
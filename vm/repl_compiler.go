@@ -0,0 +1,501 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 内置表达式编译器中值的类型
+type replExprKind int
+
+const (
+	replLong replExprKind = iota
+	replDouble
+	replString
+)
+
+// 表达式语法树的节点, op为0时是字面量, 'n'为取负
+type replExpr struct {
+	kind  replExprKind
+	op    byte
+	left  *replExpr
+	right *replExpr
+
+	longVal   int64
+	doubleVal float64
+	strVal    string
+}
+
+// 没有配置javac时REPL使用的编译器, 只支持数字和字符串字面量组成的表达式: + - * / %, 括号和负号.
+// 整数按long计算, 带小数点或指数的数按double计算, 有字符串时+为拼接;
+// 与javac一样, 字符串拼接和整数提升为double在编译时计算(常量表达式), 其余运算生成字节码由解释器执行.
+// 生成的类只有一个静态方法eval, 返回描述符为()J, ()D或()Ljava/lang/String;
+func compileReplExpression(className string, source string) (*class.DefFile, string, error) {
+	p := &replParser{source: source}
+	expr, err := p.parse()
+	if nil != err {
+		return nil, "", err
+	}
+
+	b := newClassBuilder(className, "java/lang/Object")
+	code := newCodeAssembler()
+	if err := emitReplExpr(b, code, expr, expr.kind); nil != err {
+		return nil, "", err
+	}
+
+	var desc string
+	switch expr.kind {
+	case replLong:
+		desc = "()J"
+		code.emit(bcode.Lreturn)
+	case replDouble:
+		desc = "()D"
+		code.emit(bcode.Dreturn)
+	default:
+		desc = "()Ljava/lang/String;"
+		code.emit(bcode.Areturn)
+	}
+	b.method(accflag.Public | accflag.Static, "eval", desc, uint16(replStackDepth(expr)), 0, code)
+
+	return b.def, desc, nil
+}
+
+// 按kind类型把表达式的值压栈, kind与节点类型不同时在编译时计算出常量
+func emitReplExpr(b *classBuilder, code *codeAssembler, expr *replExpr, kind replExprKind) error {
+	if kind != expr.kind || 0 == expr.op || replString == kind {
+		val, err := foldReplExpr(expr)
+		if nil != err {
+			return err
+		}
+		return emitReplConst(b, code, val, kind)
+	}
+
+	if 'n' == expr.op {
+		if err := emitReplExpr(b, code, expr.left, kind); nil != err {
+			return err
+		}
+		if replLong == kind {
+			code.emit(bcode.Lneg)
+		} else {
+			code.emit(bcode.Dneg)
+		}
+		return nil
+	}
+
+	if err := emitReplExpr(b, code, expr.left, kind); nil != err {
+		return err
+	}
+	if err := emitReplExpr(b, code, expr.right, kind); nil != err {
+		return err
+	}
+
+	ops := map[byte][2]byte{
+		'+': {bcode.Ladd, bcode.Dadd},
+		'-': {bcode.Lsub, bcode.Dsub},
+		'*': {bcode.Lmul, bcode.Dmul},
+		'/': {bcode.Ldiv, bcode.Ddiv},
+		'%': {bcode.Lrem, bcode.Drem},
+	}
+	if replLong == kind {
+		code.emit(ops[expr.op][0])
+	} else {
+		code.emit(ops[expr.op][1])
+	}
+
+	return nil
+}
+
+// val为int64, float64或string, 转换成kind类型后压栈
+func emitReplConst(b *classBuilder, code *codeAssembler, val interface{}, kind replExprKind) error {
+	switch kind {
+	case replLong:
+		v := val.(int64)
+		if 0 == v || 1 == v {
+			code.emit(bcode.Lconst0 + byte(v))
+			return nil
+		}
+		index := b.constant(&class.LongConst{HighByte: uint32(uint64(v) >> 32), LowByte: uint32(v)})
+		// long和double在常量池中占两个位置
+		b.constant(nil)
+		code.emitIndex(bcode.Ldc2W, index)
+
+	case replDouble:
+		v := replToDouble(val)
+		if 0 == v && !math.Signbit(v) || 1 == v {
+			code.emit(bcode.Dconst0 + byte(v))
+			return nil
+		}
+		bits := math.Float64bits(v)
+		index := b.constant(&class.DoubleConst{HighByte: uint32(bits >> 32), LowByte: uint32(bits)})
+		b.constant(nil)
+		code.emitIndex(bcode.Ldc2W, index)
+
+	default:
+		index := b.stringConst(replConstString(val))
+		if index > math.MaxUint8 {
+			code.emitIndex(bcode.LdcW, index)
+		} else {
+			code.emit(bcode.Ldc, byte(index))
+		}
+	}
+
+	return nil
+}
+
+// 在编译时计算表达式的值, 与java的常量表达式规则一致
+func foldReplExpr(expr *replExpr) (interface{}, error) {
+	if 0 == expr.op {
+		switch expr.kind {
+		case replLong:
+			return expr.longVal, nil
+		case replDouble:
+			return expr.doubleVal, nil
+		default:
+			return expr.strVal, nil
+		}
+	}
+
+	left, err := foldReplExpr(expr.left)
+	if nil != err {
+		return nil, err
+	}
+	if 'n' == expr.op {
+		if replLong == expr.kind {
+			return -left.(int64), nil
+		}
+		return -left.(float64), nil
+	}
+
+	right, err := foldReplExpr(expr.right)
+	if nil != err {
+		return nil, err
+	}
+
+	switch expr.kind {
+	case replString:
+		return replConstString(left) + replConstString(right), nil
+
+	case replLong:
+		a, b := left.(int64), right.(int64)
+		switch expr.op {
+		case '+':
+			return a + b, nil
+		case '-':
+			return a - b, nil
+		case '*':
+			return a * b, nil
+		}
+		if 0 == b {
+			return nil, fmt.Errorf("java.lang.ArithmeticException: / by zero")
+		}
+		if '/' == expr.op {
+			return a / b, nil
+		}
+		return a % b, nil
+
+	default:
+		a, b := replToDouble(left), replToDouble(right)
+		switch expr.op {
+		case '+':
+			return a + b, nil
+		case '-':
+			return a - b, nil
+		case '*':
+			return a * b, nil
+		case '/':
+			return a / b, nil
+		}
+		return math.Mod(a, b), nil
+	}
+}
+
+func replToDouble(val interface{}) float64 {
+	if l, ok := val.(int64); ok {
+		return float64(l)
+	}
+
+	return val.(float64)
+}
+
+// 字符串拼接时常量的文本, 与String.valueOf()一致
+func replConstString(val interface{}) string {
+	switch v := val.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatJavaDouble(v)
+	}
+
+	return val.(string)
+}
+
+// 执行表达式需要的操作数栈深度, 常量只占一个位置
+func replStackDepth(expr *replExpr) int {
+	if 0 == expr.op {
+		return 1
+	}
+	if 'n' == expr.op {
+		return replStackDepth(expr.left)
+	}
+
+	left, right := replStackDepth(expr.left), replStackDepth(expr.right) + 1
+	if left > right {
+		return left
+	}
+	return right
+}
+
+// 递归下降解析:
+// expr  := term (('+' | '-') term)*
+// term  := unary (('*' | '/' | '%') unary)*
+// unary := '-' unary | '+' unary | '(' expr ')' | number | string
+type replParser struct {
+	source string
+	pos    int
+}
+
+func (p *replParser) parse() (*replExpr, error) {
+	expr, err := p.parseExpr()
+	if nil != err {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.source) {
+		return nil, p.errorf("unexpected '%c'", p.source[p.pos])
+	}
+
+	return expr, nil
+}
+
+func (p *replParser) parseExpr() (*replExpr, error) {
+	left, err := p.parseTerm()
+	if nil != err {
+		return nil, err
+	}
+
+	for {
+		op := p.peekOp("+-")
+		if 0 == op {
+			return left, nil
+		}
+		right, err := p.parseTerm()
+		if nil != err {
+			return nil, err
+		}
+		if left, err = p.binary(op, left, right); nil != err {
+			return nil, err
+		}
+	}
+}
+
+func (p *replParser) parseTerm() (*replExpr, error) {
+	left, err := p.parseUnary()
+	if nil != err {
+		return nil, err
+	}
+
+	for {
+		op := p.peekOp("*/%")
+		if 0 == op {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if nil != err {
+			return nil, err
+		}
+		if left, err = p.binary(op, left, right); nil != err {
+			return nil, err
+		}
+	}
+}
+
+func (p *replParser) parseUnary() (*replExpr, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.source) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	switch c := p.source[p.pos]; {
+	case '-' == c || '+' == c:
+		p.pos++
+		operand, err := p.parseUnary()
+		if nil != err {
+			return nil, err
+		}
+		if replString == operand.kind {
+			return nil, p.errorf("bad operand type String for unary operator '%c'", c)
+		}
+		if '+' == c {
+			return operand, nil
+		}
+		return &replExpr{kind: operand.kind, op: 'n', left: operand}, nil
+
+	case '(' == c:
+		p.pos++
+		expr, err := p.parseExpr()
+		if nil != err {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.source) || ')' != p.source[p.pos] {
+			return nil, p.errorf("')' expected")
+		}
+		p.pos++
+		return expr, nil
+
+	case '"' == c:
+		return p.parseString()
+
+	case '.' == c || c >= '0' && c <= '9':
+		return p.parseNumber()
+	}
+
+	return nil, p.errorf("unexpected '%c', only arithmetic and string expressions are supported without javac", p.source[p.pos])
+}
+
+func (p *replParser) binary(op byte, left *replExpr, right *replExpr) (*replExpr, error) {
+	kind := replLong
+	switch {
+	case replString == left.kind || replString == right.kind:
+		if '+' != op {
+			return nil, p.errorf("bad operand types for binary operator '%c'", op)
+		}
+		kind = replString
+	case replDouble == left.kind || replDouble == right.kind:
+		kind = replDouble
+	}
+
+	return &replExpr{kind: kind, op: op, left: left, right: right}, nil
+}
+
+func (p *replParser) parseNumber() (*replExpr, error) {
+	start := p.pos
+	isDouble := false
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		if c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		if '.' == c || 'e' == c || 'E' == c {
+			isDouble = true
+			p.pos++
+			// 指数的符号
+			if ('e' == c || 'E' == c) && p.pos < len(p.source) && strings.IndexByte("+-", p.source[p.pos]) >= 0 {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+	text := p.source[start:p.pos]
+
+	// 后缀: L为long, d/f为double(float也按double计算)
+	if p.pos < len(p.source) {
+		switch p.source[p.pos] {
+		case 'L', 'l':
+			if isDouble {
+				return nil, p.errorf("malformed number '%sL'", text)
+			}
+			p.pos++
+		case 'D', 'd', 'F', 'f':
+			isDouble = true
+			p.pos++
+		}
+	}
+
+	if isDouble {
+		v, err := strconv.ParseFloat(text, 64)
+		if nil != err {
+			return nil, p.errorf("malformed number '%s'", text)
+		}
+		return &replExpr{kind: replDouble, doubleVal: v}, nil
+	}
+
+	v, err := strconv.ParseInt(text, 10, 64)
+	if nil != err {
+		return nil, p.errorf("integer number too large: %s", text)
+	}
+	return &replExpr{kind: replLong, longVal: v}, nil
+}
+
+func (p *replParser) parseString() (*replExpr, error) {
+	// 跳过开头的引号
+	p.pos++
+
+	var sb strings.Builder
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		p.pos++
+		if '"' == c {
+			return &replExpr{kind: replString, strVal: sb.String()}, nil
+		}
+		if '\\' != c {
+			sb.WriteByte(c)
+			continue
+		}
+
+		if p.pos >= len(p.source) {
+			break
+		}
+		escape := p.source[p.pos]
+		p.pos++
+		switch escape {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case '"', '\'', '\\':
+			sb.WriteByte(escape)
+		case 'u':
+			if p.pos + 4 > len(p.source) {
+				return nil, p.errorf("illegal unicode escape")
+			}
+			code, err := strconv.ParseUint(p.source[p.pos:p.pos + 4], 16, 16)
+			if nil != err {
+				return nil, p.errorf("illegal unicode escape")
+			}
+			p.pos += 4
+			var buf [utf8.UTFMax]byte
+			sb.Write(buf[:utf8.EncodeRune(buf[:], rune(code))])
+		default:
+			return nil, p.errorf("illegal escape character '\\%c'", escape)
+		}
+	}
+
+	return nil, p.errorf("unclosed string literal")
+}
+
+// 跳过空白后如果下一个字符是ops之一则读取它, 否则返回0
+func (p *replParser) peekOp(ops string) byte {
+	p.skipSpaces()
+	if p.pos < len(p.source) && strings.IndexByte(ops, p.source[p.pos]) >= 0 {
+		p.pos++
+		return p.source[p.pos - 1]
+	}
+
+	return 0
+}
+
+func (p *replParser) skipSpaces() {
+	for p.pos < len(p.source) && strings.IndexByte(" \t\r\n", p.source[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *replParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("column %d: %s", p.pos + 1, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newTestRepl(t *testing.T) *Repl {
+	jvm, err := newClassInitTestJvm(newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return NewRepl(jvm, "")
+}
+
+func TestReplBuiltinCompiler(t *testing.T) {
+	repl := newTestRepl(t)
+
+	cases := []struct {
+		snippet string
+		expect  string
+		typ     string
+	}{
+		{"1 + 2 * 3", "7", "long"},
+		{"-(10 - 4) % 4 + 5000000000L", "4999999998", "long"},
+		{"(1 + 2.5) * 2", "7.0", "double"},
+		// 整数除法在提升为double之前计算
+		{"7 / 2 * 1.0", "3.0", "double"},
+		{"1e3 / 0", "Infinity", "double"},
+		{`"a" + 1 + 2`, `"a12"`, "java.lang.String"},
+		{`1 + 2 + "a\t" + 0.5`, `"3a\t0.5"`, "java.lang.String"},
+	}
+	for ix, c := range cases {
+		result, err := repl.Eval(c.snippet)
+		if nil != err {
+			t.Fatalf("%s: %v", c.snippet, err)
+		}
+		if expect := "$" + string(rune('1' + ix)) + " ==> " + c.expect; expect != result.String() || c.typ != result.Type {
+			t.Errorf("%s: expect %s (%s), got %s (%s)", c.snippet, expect, c.typ, result, result.Type)
+		}
+	}
+
+	// 除以0在解释器中执行时抛出异常
+	if _, err := repl.Eval("1 / (2 - 2)"); nil == err || !strings.Contains(err.Error(), "java.lang.ArithmeticException") {
+		t.Fatalf("expect ArithmeticException, got %v", err)
+	}
+	for _, snippet := range []string{"1 +", `"a" - 1`, "foo()", `"abc`} {
+		if _, err := repl.Eval(snippet); nil == err {
+			t.Errorf("%s: expect compile error", snippet)
+		}
+	}
+}
+
+func TestReplRun(t *testing.T) {
+	var out bytes.Buffer
+	in := strings.NewReader("1 + 1\n\n/help\n2 *\n\"x\" + 3\n/exit\n4\n")
+	if err := newTestRepl(t).Run(in, &out); nil != err {
+		t.Fatal(err)
+	}
+
+	text := out.String()
+	for _, expect := range []string{"$1 ==> 2\n", "/exit  退出", "|  error: column 4", `$3 ==> "x3"`} {
+		if !strings.Contains(text, expect) {
+			t.Errorf("expect %q in output:\n%s", expect, text)
+		}
+	}
+	if strings.Contains(text, "==> 4") {
+		t.Errorf("snippets after /exit should not run:\n%s", text)
+	}
+}
@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+)
+
+// 方法返回值的类型, 由方法描述符决定;
+// 执行引擎按它检查return指令, 并决定本地方法的返回值是否以及如何压入调用者的操作数栈
+type returnKind byte
+
+const (
+	returnVoid returnKind = iota
+	// I, Z, B, C, S, 在操作数栈中都是int
+	returnInt
+	returnLong
+	returnFloat
+	returnDouble
+	// 对象和数组
+	returnReference
+)
+
+func (k returnKind) String() string {
+	switch k {
+	case returnVoid:
+		return "void"
+	case returnInt:
+		return "int"
+	case returnLong:
+		return "long"
+	case returnFloat:
+		return "float"
+	case returnDouble:
+		return "double"
+	}
+
+	return "reference"
+}
+
+// 按方法描述符中)之后的部分得到返回值类型
+func returnKindOf(descriptor string) returnKind {
+	ix := strings.LastIndexByte(descriptor, ')')
+	if ix < 0 || ix == len(descriptor) - 1 {
+		return returnVoid
+	}
+
+	switch descriptor[ix + 1] {
+	case 'V':
+		return returnVoid
+	case 'I', 'Z', 'B', 'C', 'S':
+		return returnInt
+	case 'J':
+		return returnLong
+	case 'F':
+		return returnFloat
+	case 'D':
+		return returnDouble
+	}
+
+	return returnReference
+}
+
+// 把本地方法的返回值按方法的返回类型压入调用者的操作数栈;
+// void方法返回的值被丢弃, 引用类型返回nil时压入null
+func pushNativeReturn(stack *OpStack, kind returnKind, val interface{}) error {
+	switch kind {
+	case returnVoid:
+		return nil
+
+	case returnInt:
+		switch v := val.(type) {
+		case int:
+			stack.PushInt(v)
+			return nil
+		case bool:
+			if v {
+				stack.PushInt(1)
+			} else {
+				stack.PushInt(0)
+			}
+			return nil
+		}
+
+	case returnLong:
+		switch v := val.(type) {
+		case int64:
+			stack.Push(v)
+			return nil
+		case int:
+			stack.Push(int64(v))
+			return nil
+		}
+
+	case returnFloat:
+		switch v := val.(type) {
+		case float32:
+			stack.Push(v)
+			return nil
+		case float64:
+			stack.Push(float32(v))
+			return nil
+		}
+
+	case returnDouble:
+		if v, ok := val.(float64); ok {
+			stack.Push(v)
+			return nil
+		}
+
+	case returnReference:
+		switch v := val.(type) {
+		case nil:
+			stack.Push(nil)
+			return nil
+		case *class.Reference:
+			stack.Push(v)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("native method returned %T for return type %s", val, kind)
+}
+
+// return指令与方法的返回类型不一致时返回VerifyError
+func checkReturnKind(op string, expected returnKind, actual returnKind) error {
+	if expected == actual {
+		return nil
+	}
+
+	return fmt.Errorf("java.lang.VerifyError: '%s' in method returning %s", op, expected)
+}
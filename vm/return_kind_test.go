@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strings"
+	"testing"
+)
+
+func TestReturnKindOf(t *testing.T) {
+	cases := map[string]returnKind{
+		"()V":                   returnVoid,
+		"(I)Z":                  returnInt,
+		"([CII)C":               returnInt,
+		"()J":                   returnLong,
+		"(Ljava/lang/String;)F": returnFloat,
+		"()D":                   returnDouble,
+		"()Ljava/lang/Object;":  returnReference,
+		"(I)[I":                 returnReference,
+	}
+	for desc, expected := range cases {
+		if actual := returnKindOf(desc); expected != actual {
+			t.Errorf("%s: expect %s, got %s", desc, expected, actual)
+		}
+	}
+}
+
+func TestPushNativeReturn(t *testing.T) {
+	stack := NewOpStack(4)
+
+	// void方法的返回值被丢弃
+	if err := pushNativeReturn(stack, returnVoid, 42); nil != err || -1 != stack.topIndex {
+		t.Fatalf("void return should be dropped, err: %v", err)
+	}
+
+	// boolean按int压栈, 后续的ifeq等指令才能读取
+	if err := pushNativeReturn(stack, returnInt, true); nil != err {
+		t.Fatal(err)
+	}
+	if v, ok := stack.PopInt(); !ok || 1 != v {
+		t.Fatalf("expect int 1, got %v", v)
+	}
+
+	if err := pushNativeReturn(stack, returnReference, nil); nil != err || 0 != stack.topIndex {
+		t.Fatalf("null should be pushed for reference return, err: %v", err)
+	}
+	stack.Pop()
+
+	if err := pushNativeReturn(stack, returnInt, "oops"); nil == err {
+		t.Fatal("expect error for mismatched return value")
+	}
+}
+
+func TestNativeVoidReturnKeepsCallerStack(t *testing.T) {
+	b := newClassBuilder("com/fh/Ret", "java/lang/Object")
+	b.method(accflag.Static | accflag.Native, "sentinel", "()V", 0, 0, nil)
+	// static int run() { sentinel(); return 5; }
+	run := newCodeAssembler().
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Ret", "sentinel", "()V")).
+		emit(bcode.Iconst5, bcode.Ireturn)
+	b.method(accflag.Static, "run", "()I", 1, 0, run)
+	// static void bad() { return 5; }, 编译器不会生成, 手写的字节码可能有
+	bad := newCodeAssembler().
+		emit(bcode.Iconst5, bcode.Ireturn)
+	b.method(accflag.Static, "bad", "()V", 1, 0, bad)
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// void本地方法返回了一个非nil的值
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Ret", "sentinel", "()V", func(args ...interface{}) interface{} {
+		return 42
+	})
+
+	frame := newMethodStackFrame(2, 0)
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "run", "()I", frame, false); nil != err {
+		t.Fatal(err)
+	}
+	if ret, _ := frame.opStack.PopInt(); 5 != ret || -1 != frame.opStack.topIndex {
+		t.Fatalf("caller stack corrupted, ret %d, depth %d", ret, frame.opStack.topIndex + 1)
+	}
+
+	err = jvm.ExecutionEngine.ExecuteWithFrame(b.def, "bad", "()V", frame, false)
+	if nil == err || !strings.Contains(err.Error(), "java.lang.VerifyError") {
+		t.Fatalf("expect VerifyError, got %v", err)
+	}
+}
+
+func TestLongDoubleReturns(t *testing.T) {
+	b := newClassBuilder("com/fh/Wide", "java/lang/Object")
+	b.method(accflag.Static | accflag.Native, "millis", "()J", 0, 0, nil)
+	b.method(accflag.Static | accflag.Native, "ratio", "()D", 0, 0, nil)
+	b.method(accflag.Static | accflag.Native, "scale", "()F", 0, 0, nil)
+	// static long now() { return millis(); }, double和float同理
+	for _, m := range []struct {
+		name, native, desc string
+		ret                byte
+	}{
+		{"now", "millis", "()J", bcode.Lreturn},
+		{"half", "ratio", "()D", bcode.Dreturn},
+		{"twice", "scale", "()F", bcode.Freturn},
+	} {
+		code := newCodeAssembler().
+			emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Wide", m.native, m.desc)).
+			emit(m.ret)
+		b.method(accflag.Static, m.name, m.desc, 1, 0, code)
+	}
+	// static int bad() { return millis(); }
+	bad := newCodeAssembler().
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Wide", "millis", "()J")).
+		emit(bcode.Lreturn)
+	b.method(accflag.Static, "bad", "()I", 1, 0, bad)
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Wide", "millis", "()J", func(args ...interface{}) interface{} {
+		return int64(1) << 40
+	})
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Wide", "ratio", "()D", func(args ...interface{}) interface{} {
+		return 0.5
+	})
+	// float方法返回go的float64时转换成float32
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Wide", "scale", "()F", func(args ...interface{}) interface{} {
+		return 2.0
+	})
+
+	expected := map[string]interface{}{"now": int64(1) << 40, "half": 0.5, "twice": float32(2)}
+	descs := map[string]string{"now": "()J", "half": "()D", "twice": "()F"}
+	for name, want := range expected {
+		frame := newMethodStackFrame(1, 0)
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, name, descs[name], frame, false); nil != err {
+			t.Fatal(err)
+		}
+		if got, _ := frame.opStack.Pop(); want != got {
+			t.Errorf("%s: expect %v(%T), got %v(%T)", name, want, want, got, got)
+		}
+	}
+
+	err = jvm.ExecutionEngine.ExecuteWithFrame(b.def, "bad", "()I", newMethodStackFrame(1, 0), false)
+	if nil == err || !strings.Contains(err.Error(), "java.lang.VerifyError: 'lreturn' in method returning int") {
+		t.Fatalf("expect VerifyError, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sort"
+	"strings"
+)
+
+// 解析classpath中的class, 用class.WriteClass重新生成后与原始字节比较(属性的顺序可以不同),
+// 一次找出常量池和属性表解析的错误; 不认识的属性按原始字节保留, 不算作问题. names为空时检查classpath中的所有class
+func RoundTripClasses(classPaths []string, options *ClassPathOptions, names []string) (*VerifyReport, error) {
+	jvm := &MiniJvm{ClassPathOptions: options, stats: new(vmStats)}
+	ma, err := NewMethodArea(jvm, classPaths, nil)
+	if nil != err {
+		return nil, fmt.Errorf("unabled to create method area: %w", err)
+	}
+
+	if 0 == len(names) {
+		names, err = ma.ListClassNames()
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	report := &VerifyReport{
+		Problems: make([]*VerifyProblem, 0, 8),
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		className := strings.ReplaceAll(name, ".", "/")
+		if err := roundTripClass(ma, className); nil != err {
+			report.Problems = append(report.Problems, &VerifyProblem{
+				ClassName: className,
+				Pc:        -1,
+				Kind:      VerifyProblemRoundTrip,
+				Detail:    err.Error(),
+			})
+		}
+		report.ClassCount++
+	}
+
+	return report, nil
+}
+
+func roundTripClass(ma *MethodArea, className string) error {
+	original, err := ma.readClassBytes(className)
+	if nil != err {
+		return err
+	}
+
+	def, err := class.LoadClassBufWith(original, func(string) error { return nil })
+	if nil != err {
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	rewritten, err := class.WriteClass(def)
+	if nil != err {
+		return err
+	}
+
+	return class.DiffClassBytes(original, rewritten)
+}
@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"testing"
+)
+
+func TestRoundTripClasses(t *testing.T) {
+	report, err := RoundTripClasses([]string{"../testcase/classes"}, nil, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0 == report.ClassCount {
+		t.Fatal("no class checked")
+	}
+	for _, problem := range report.Problems {
+		t.Error(problem)
+	}
+
+	report, _ = RoundTripClasses([]string{"../testcase/classes"}, nil, []string{"com.fh.Missing"})
+	if 1 != len(report.Problems) || VerifyProblemRoundTrip != report.Problems[0].Kind {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RunMain的执行结果
+type RunResult struct {
+	// guest程序输出到stdout和stderr的全部内容
+	Stdout string
+	Stderr string
+
+	// 与命令行的退出码一致, 调用System.exit()时为其参数
+	ExitCode int
+	// 没有捕获的异常或者其他错误, 正常结束以及System.exit()时为nil
+	Err error
+}
+
+// 用指定的命令行参数和标准输入执行主类的main方法, 一次返回输出和退出码, 测试guest程序时使用;
+// stdin为nil时没有输入, stdout和stderr不为nil时输出同时写入它们
+func RunMain(classPaths []string, mainClass string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *RunResult {
+	jvm, err := NewMiniJvm(mainClass, classPaths)
+	if nil != err {
+		return &RunResult{ExitCode: ExitCodeOf(err), Err: err}
+	}
+
+	return jvm.RunMain(args, stdin, stdout, stderr)
+}
+
+// 与RunMain相同, classpath为内存中的jar包, 按顺序查找, 在浏览器等没有文件系统的环境中使用
+func RunMainJars(jars [][]byte, mainClass string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *RunResult {
+	// 先用占位名创建方法区, 再登记jar的内容
+	names := make([]string, len(jars))
+	for ix := range jars {
+		names[ix] = fmt.Sprintf("memory:%d.jar", ix)
+	}
+	jvm, err := NewMiniJvm(mainClass, names)
+	if nil == err {
+		for ix, data := range jars {
+			if err = jvm.MethodArea.AddJarBytes(names[ix], data); nil != err {
+				break
+			}
+		}
+	}
+	if nil != err {
+		return &RunResult{ExitCode: ExitCodeOf(err), Err: err}
+	}
+
+	return jvm.RunMain(args, stdin, stdout, stderr)
+}
+
+// 把单独的class文件打包成jar, key为类的全限定性名, 如com/fh/Hello或com.fh.Hello
+func buildClassesJar(classes map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range names {
+		entry := strings.ReplaceAll(strings.TrimSuffix(name, ".class"), ".", "/") + ".class"
+		f, err := w.CreateHeader(&zip.FileHeader{Name: entry, Method: zip.Store})
+		if nil != err {
+			return nil, err
+		}
+		if _, err := f.Write(classes[name]); nil != err {
+			return nil, err
+		}
+	}
+	if err := w.Close(); nil != err {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// 与RunMain相同, 使用已经创建并设置好的虚拟机, 一个虚拟机只能执行一次
+func (m *MiniJvm) RunMain(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *RunResult {
+	var outBuf, errBuf syncBuffer
+
+	m.CmdArgs = append([]string{os.Args[0]}, args...)
+	if nil == stdin {
+		stdin = strings.NewReader("")
+	}
+	m.Stdin = stdin
+	m.Stdout = teeWriter(&outBuf, stdout)
+	errWriter := teeWriter(&errBuf, stderr)
+	m.Logger = utils.NewWriterLogger(errWriter, utils.LogLevelInfo)
+	m.captureExit = true
+
+	err := m.Start()
+
+	result := &RunResult{ExitCode: ExitCodeOf(err)}
+	var exit *SystemExitError
+	if nil != err && !errors.As(err, &exit) {
+		result.Err = err
+		fmt.Fprintf(errWriter, "error: %v\n", err)
+	}
+	result.Stdout = outBuf.String()
+	result.Stderr = errBuf.String()
+
+	return result
+}
+
+func teeWriter(buf *syncBuffer, w io.Writer) io.Writer {
+	if nil == w {
+		return buf
+	}
+
+	return io.MultiWriter(buf, w)
+}
+
+// 可以被多个guest线程同时写入的缓冲区
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+// main: 打印参数个数和第一个参数, 读一行输入并打印, 然后以code退出, code为0时正常返回
+func newRunMainTestJvm(t *testing.T, code int) *MiniJvm {
+	printer := newClassBuilder("cn/minijvm/io/Printer", "java/lang/Object")
+	printer.method(accflag.Static | accflag.Native, "printInt", "(I)V", 0, 1, nil)
+	printer.method(accflag.Static | accflag.Native, "printString", "(Ljava/lang/String;)V", 0, 1, nil)
+	shutdown := newClassBuilder("java/lang/Shutdown", "java/lang/Object")
+	shutdown.method(accflag.Static | accflag.Native, "halt0", "(I)V", 0, 1, nil)
+
+	b := newClassBuilder("com/fh/Echo", "java/lang/Object")
+	b.method(accflag.Static | accflag.Native, "readLine", "()Ljava/lang/String;", 0, 0, nil)
+	asm := newCodeAssembler().
+		emit(bcode.Aload0, bcode.Arraylength).
+		emitIndex(bcode.Invokestatic, b.methodRef("cn/minijvm/io/Printer", "printInt", "(I)V")).
+		emit(bcode.Aload0, bcode.Iconst1, bcode.Aaload).
+		emitIndex(bcode.Invokestatic, b.methodRef("cn/minijvm/io/Printer", "printString", "(Ljava/lang/String;)V")).
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Echo", "readLine", "()Ljava/lang/String;")).
+		emitIndex(bcode.Invokestatic, b.methodRef("cn/minijvm/io/Printer", "printString", "(Ljava/lang/String;)V"))
+	if 0 != code {
+		asm.emit(bcode.Bipush, byte(code)).
+			emitIndex(bcode.Invokestatic, b.methodRef("java/lang/Shutdown", "halt0", "(I)V"))
+	}
+	b.method(accflag.Public | accflag.Static, "main", "([Ljava/lang/String;)V", 2, 1, asm.emit(bcode.Return))
+
+	jvm, err := newClassInitTestJvm(printer.def, shutdown.def, b.def, newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.MainClass = "com/fh/Echo"
+	jvm.NativeMethodTable = newBuiltinNativeMethodTable()
+	jvm.NativeMethodTable.RegisterMethod("com.fh.Echo", "readLine", "()Ljava/lang/String;", func(args ...interface{}) interface{} {
+		jvm := args[0].(*MiniJvm)
+		jvm.stdinLock.Lock()
+		defer jvm.stdinLock.Unlock()
+
+		line, err := readLine(jvm.stdin())
+		if nil != err {
+			return err
+		}
+		return newStringResult(jvm, line)
+	})
+
+	return jvm
+}
+
+func TestRunMain(t *testing.T) {
+	var stdout bytes.Buffer
+	result := newRunMainTestJvm(t, 3).RunMain([]string{"hello", "world"}, strings.NewReader("input line\n"), &stdout, nil)
+	if nil != result.Err {
+		t.Fatal(result.Err)
+	}
+	// 与命令行一样, 第0个参数是宿主程序路径
+	expect := "3\nhello\ninput line\n"
+	if expect != result.Stdout || expect != stdout.String() {
+		t.Fatalf("unexpected stdout %q, %q", result.Stdout, stdout.String())
+	}
+	if 3 != result.ExitCode {
+		t.Fatalf("expect exit code 3, got %d", result.ExitCode)
+	}
+
+	// 正常结束时退出码为0
+	result = newRunMainTestJvm(t, 0).RunMain([]string{"a"}, strings.NewReader("b"), nil, nil)
+	if nil != result.Err || 0 != result.ExitCode || "2\na\nb\n" != result.Stdout {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// 主类不存在, 错误写入stderr
+	jvm := newRunMainTestJvm(t, 0)
+	jvm.MainClass = "com/fh/Missing"
+	result = jvm.RunMain(nil, nil, nil, nil)
+	if nil == result.Err || 0 == result.ExitCode || !strings.Contains(result.Stderr, "error:") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestRunMainJars(t *testing.T) {
+	writeClass := func(def *class.DefFile) []byte {
+		buf, err := class.WriteClass(def)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	printer := newClassBuilder("cn/minijvm/io/Printer", "java/lang/Object")
+	printer.method(accflag.Static | accflag.Native, "printInt", "(I)V", 0, 1, nil)
+	b := newClassBuilder("com/fh/Hello", "java/lang/Object")
+	b.method(accflag.Public | accflag.Static, "main", "([Ljava/lang/String;)V", 1, 1, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Arraylength).
+		emitIndex(bcode.Invokestatic, b.methodRef("cn/minijvm/io/Printer", "printInt", "(I)V")).
+		emit(bcode.Return))
+
+	// 基础类和主类分别在两个jar中, 主类的key可以用点号分隔
+	libJar, err := buildClassesJar(map[string][]byte{
+		"java/lang/Object":      writeClass(newTestClass("java/lang/Object", "", nil)),
+		"java/lang/String":      writeClass(newTestClass("java/lang/String", "java/lang/Object", nil)),
+		"cn/minijvm/io/Printer": writeClass(printer.def),
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	appJar, err := buildClassesJar(map[string][]byte{"com.fh.Hello": writeClass(b.def)})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	result := RunMainJars([][]byte{libJar, appJar}, "com.fh.Hello", []string{"a", "b"}, nil, nil, nil)
+	if nil != result.Err || 0 != result.ExitCode || "3\n" != result.Stdout {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	result = RunMainJars([][]byte{[]byte("not a jar")}, "com.fh.Hello", nil, nil, nil, nil)
+	if nil == result.Err || !strings.Contains(result.Err.Error(), "memory:0.jar") {
+		t.Fatalf("expect invalid jar error, got %+v", result)
+	}
+}
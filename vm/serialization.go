@@ -0,0 +1,1308 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Java序列化流格式中的常量, 见java.io.ObjectStreamConstants
+const (
+	streamMagic   = 0xaced
+	streamVersion = 5
+
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcException      = 0x7b
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	baseWireHandle = 0x7e0000
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scEnum           = 0x10
+)
+
+// 流中类描述符里的一个字段
+type streamField struct {
+	// 类型码, 与字段描述符的第一个字符相同
+	typeCode byte
+	name     string
+	// 对象/数组类型字段的描述符, 如Ljava/lang/String;
+	className string
+}
+
+func (f *streamField) isPrimitive() bool {
+	return 'L' != f.typeCode && '[' != f.typeCode
+}
+
+// 流中的类描述符, 对应ObjectStreamClass
+type streamClassDesc struct {
+	// 类全名, 以.分隔
+	name  string
+	suid  int64
+	flags byte
+
+	fields []*streamField
+	super  *streamClassDesc
+}
+
+// 从最顶层的可序列化父类开始, 依次返回类描述符
+func (d *streamClassDesc) hierarchy() []*streamClassDesc {
+	chain := make([]*streamClassDesc, 0, 2)
+	for current := d; nil != current; current = current.super {
+		chain = append([]*streamClassDesc{current}, chain...)
+	}
+
+	return chain
+}
+
+// 把对象序列化成Java序列化流格式, 与ObjectOutputStream.writeObject()的输出兼容;
+// 只支持使用默认序列化机制的类, 声明了writeObject方法或实现了Externalizable的类会返回错误
+func SerializeObject(loader class.Loader, obj interface{}) ([]byte, error) {
+	w := &objectStreamWriter{
+		loader:      loader,
+		handles:     make(map[interface{}]int),
+		typeStrings: make(map[string]int),
+		descs:       make(map[string]*streamClassDesc),
+	}
+
+	binary.Write(&w.buf, binary.BigEndian, uint16(streamMagic))
+	binary.Write(&w.buf, binary.BigEndian, uint16(streamVersion))
+
+	err := w.writeObject(obj)
+	if nil != err {
+		return nil, err
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// 从Java序列化流中读取一个对象;
+// allowed不为nil时, 只允许反序列化allowed返回true的类(String和基本类型数组总是允许的)
+func DeserializeObject(loader class.Loader, data []byte, allowed func(className string) bool) (interface{}, error) {
+	r := &objectStreamReader{
+		loader:  loader,
+		reader:  bytes.NewReader(data),
+		handles: make([]interface{}, 0, 8),
+		allowed: allowed,
+	}
+
+	var magic, version uint16
+	if err := binary.Read(r.reader, binary.BigEndian, &magic); nil != err {
+		return nil, fmt.Errorf("invalid stream header: %w", err)
+	}
+	if err := binary.Read(r.reader, binary.BigEndian, &version); nil != err {
+		return nil, fmt.Errorf("invalid stream header: %w", err)
+	}
+	if streamMagic != magic || streamVersion != version {
+		return nil, errors.New("invalid stream header")
+	}
+
+	return r.readObject()
+}
+
+type objectStreamWriter struct {
+	loader class.Loader
+	buf    bytes.Buffer
+
+	// 已经写过的对象, 数组, 字符串和类描述符, 值为句柄编号
+	handles map[interface{}]int
+	// 字段类型字符串单独按值记录句柄
+	typeStrings map[string]int
+	// 类描述符缓存, key为类全名
+	descs map[string]*streamClassDesc
+}
+
+func (w *objectStreamWriter) assignHandle(key interface{}) {
+	w.handles[key] = len(w.handles) + len(w.typeStrings)
+}
+
+func (w *objectStreamWriter) writeHandle(handle int) {
+	w.buf.WriteByte(tcReference)
+	binary.Write(&w.buf, binary.BigEndian, int32(baseWireHandle + handle))
+}
+
+func (w *objectStreamWriter) writeObject(val interface{}) error {
+	ref, ok := val.(*class.Reference)
+	if nil == val || (ok && nil == ref) {
+		w.buf.WriteByte(tcNull)
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("cannot write primitive value %v as object", val)
+	}
+
+	if handle, ok := w.handles[ref]; ok {
+		w.writeHandle(handle)
+		return nil
+	}
+
+	if class.ReferanceTypeArray == ref.RefType {
+		return w.writeArray(ref)
+	}
+
+	def := ref.Object.DefFile
+	if "java/lang/String" == def.FullClassName {
+		w.writeString(ref, stringValue(ref))
+		return nil
+	}
+
+	enumDef, err := enumClassOf(w.loader, def)
+	if nil != err {
+		return err
+	}
+	if nil != enumDef {
+		return w.writeEnum(ref, enumDef)
+	}
+
+	desc, err := w.classDescOf(def)
+	if nil != err {
+		return err
+	}
+
+	w.buf.WriteByte(tcObject)
+	w.writeClassDesc(desc)
+	w.assignHandle(ref)
+
+	// 从顶层父类开始依次写出每个类的字段
+	for _, current := range desc.hierarchy() {
+		for _, field := range current.fields {
+			var fieldVal interface{}
+			if f, ok := ref.Object.ObjectFields[field.name]; ok {
+				fieldVal = f.FieldValue
+			}
+
+			if field.isPrimitive() {
+				w.writePrimitive(field.typeCode, fieldVal)
+				continue
+			}
+
+			err := w.writeObject(fieldVal)
+			if nil != err {
+				return fmt.Errorf("failed to write field '%s' of '%s': %w", field.name, current.name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *objectStreamWriter) writeString(key interface{}, val []rune) {
+	utf := encodeModifiedUTF8(val)
+	if len(utf) > math.MaxUint16 {
+		w.buf.WriteByte(tcLongString)
+		w.assignHandle(key)
+		binary.Write(&w.buf, binary.BigEndian, int64(len(utf)))
+	} else {
+		w.buf.WriteByte(tcString)
+		w.assignHandle(key)
+		binary.Write(&w.buf, binary.BigEndian, uint16(len(utf)))
+	}
+
+	w.buf.Write(utf)
+}
+
+func (w *objectStreamWriter) writeUTF(val string) {
+	utf := encodeModifiedUTF8([]rune(val))
+	binary.Write(&w.buf, binary.BigEndian, uint16(len(utf)))
+	w.buf.Write(utf)
+}
+
+func (w *objectStreamWriter) writeEnum(ref *class.Reference, enumDef *class.DefFile) error {
+	desc, err := w.classDescOf(enumDef)
+	if nil != err {
+		return err
+	}
+
+	w.buf.WriteByte(tcEnum)
+	w.writeClassDesc(desc)
+	w.assignHandle(ref)
+
+	nameRef, _ := ref.Object.ObjectFields["name"].FieldValue.(*class.Reference)
+	if nil == nameRef {
+		return fmt.Errorf("enum constant of '%s' has no name", enumDef.FullClassName)
+	}
+
+	return w.writeObject(nameRef)
+}
+
+func (w *objectStreamWriter) writeArray(ref *class.Reference) error {
+	name := arrayClassName(ref.Array)
+	desc, ok := w.descs[name]
+	if !ok {
+		desc = &streamClassDesc{
+			name:  name,
+			suid:  arrayDefaultSUID(name),
+			flags: scSerializable,
+		}
+		w.descs[name] = desc
+	}
+
+	w.buf.WriteByte(tcArray)
+	w.writeClassDesc(desc)
+	w.assignHandle(ref)
+
+	binary.Write(&w.buf, binary.BigEndian, int32(ref.Array.Len()))
+	elemType := name[1]
+	for ix := 0; ix < ref.Array.Len(); ix++ {
+		if 'L' != elemType && '[' != elemType {
+			w.writePrimitive(elemType, ref.Array.Load(ix))
+			continue
+		}
+
+		err := w.writeObject(ref.Array.Load(ix))
+		if nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *objectStreamWriter) writeClassDesc(desc *streamClassDesc) {
+	if nil == desc {
+		w.buf.WriteByte(tcNull)
+		return
+	}
+	if handle, ok := w.handles[desc]; ok {
+		w.writeHandle(handle)
+		return
+	}
+
+	w.buf.WriteByte(tcClassDesc)
+	w.assignHandle(desc)
+	w.writeUTF(desc.name)
+	binary.Write(&w.buf, binary.BigEndian, desc.suid)
+	w.buf.WriteByte(desc.flags)
+
+	binary.Write(&w.buf, binary.BigEndian, uint16(len(desc.fields)))
+	for _, field := range desc.fields {
+		w.buf.WriteByte(field.typeCode)
+		w.writeUTF(field.name)
+		if field.isPrimitive() {
+			continue
+		}
+
+		// 类型字符串按值复用句柄
+		if handle, ok := w.typeStrings[field.className]; ok {
+			w.writeHandle(handle)
+		} else {
+			w.buf.WriteByte(tcString)
+			w.typeStrings[field.className] = len(w.handles) + len(w.typeStrings)
+			w.writeUTF(field.className)
+		}
+	}
+
+	// 没有classAnnotation
+	w.buf.WriteByte(tcEndBlockData)
+	w.writeClassDesc(desc.super)
+}
+
+func (w *objectStreamWriter) writePrimitive(typeCode byte, val interface{}) {
+	switch typeCode {
+	case 'B', 'Z':
+		w.buf.WriteByte(byte(toInt64(numericValue(val))))
+	case 'C', 'S':
+		binary.Write(&w.buf, binary.BigEndian, uint16(toInt64(numericValue(val))))
+	case 'I':
+		binary.Write(&w.buf, binary.BigEndian, int32(toInt64(numericValue(val))))
+	case 'J':
+		binary.Write(&w.buf, binary.BigEndian, toInt64(numericValue(val)))
+	case 'F':
+		binary.Write(&w.buf, binary.BigEndian, math.Float32bits(float32(floatValue(val))))
+	case 'D':
+		binary.Write(&w.buf, binary.BigEndian, math.Float64bits(floatValue(val)))
+	}
+}
+
+// 生成类描述符, 同时检查类是否可以序列化
+func (w *objectStreamWriter) classDescOf(def *class.DefFile) (*streamClassDesc, error) {
+	name := strings.ReplaceAll(def.FullClassName, "/", ".")
+	if desc, ok := w.descs[name]; ok {
+		return desc, nil
+	}
+
+	if ok, err := implementsInterface(w.loader, def, "java/io/Serializable"); nil != err || !ok {
+		return nil, fmt.Errorf("java.io.NotSerializableException: %s", name)
+	}
+	if ok, _ := implementsInterface(w.loader, def, "java/io/Externalizable"); ok {
+		return nil, fmt.Errorf("externalizable class '%s' is not supported", name)
+	}
+
+	desc := &streamClassDesc{
+		name:  name,
+		flags: scSerializable,
+	}
+
+	// 枚举类型的描述符固定为serialVersionUID为0, 没有字段
+	isEnum := "java/lang/Enum" == def.FullClassName || "java/lang/Enum" == superClassName(def)
+	if isEnum {
+		desc.flags |= scEnum
+	} else {
+		if nil != findMethodInDef(def, "writeObject", "(Ljava/io/ObjectOutputStream;)V") {
+			return nil, fmt.Errorf("class '%s' with custom writeObject is not supported", name)
+		}
+
+		desc.suid = serialVersionUIDOf(def)
+		desc.fields = serialFieldsOf(def)
+	}
+	w.descs[name] = desc
+
+	// 父类也可以序列化时才写出父类描述符
+	if superName := superClassName(def); "" != superName && "java/lang/Enum" != def.FullClassName {
+		superDef, err := w.loader.LoadClass(superName)
+		if nil != err {
+			return nil, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+
+		if ok, err := implementsInterface(w.loader, superDef, "java/io/Serializable"); nil == err && ok {
+			desc.super, err = w.classDescOf(superDef)
+			if nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	return desc, nil
+}
+
+type objectStreamReader struct {
+	loader  class.Loader
+	reader  *bytes.Reader
+	handles []interface{}
+	allowed func(className string) bool
+}
+
+func (r *objectStreamReader) assignHandle(val interface{}) int {
+	r.handles = append(r.handles, val)
+	return len(r.handles) - 1
+}
+
+func (r *objectStreamReader) readHandle() (interface{}, error) {
+	var handle int32
+	err := binary.Read(r.reader, binary.BigEndian, &handle)
+	if nil != err {
+		return nil, err
+	}
+
+	ix := int(handle) - baseWireHandle
+	if ix < 0 || ix >= len(r.handles) {
+		return nil, fmt.Errorf("invalid handle 0x%x", handle)
+	}
+
+	return r.handles[ix], nil
+}
+
+func (r *objectStreamReader) readObject() (interface{}, error) {
+	tc, err := r.reader.ReadByte()
+	if nil != err {
+		return nil, fmt.Errorf("failed to read type code: %w", err)
+	}
+
+	switch tc {
+	case tcNull:
+		return nil, nil
+
+	case tcReference:
+		return r.readHandle()
+
+	case tcString, tcLongString:
+		val, err := r.readUTF(tcLongString == tc)
+		if nil != err {
+			return nil, err
+		}
+
+		strRef, err := class.NewStringObject(val, r.loader)
+		if nil != err {
+			return nil, err
+		}
+		r.assignHandle(strRef)
+
+		return strRef, nil
+
+	case tcArray:
+		return r.readArray()
+
+	case tcEnum:
+		return r.readEnum()
+
+	case tcObject:
+		return r.readOrdinaryObject()
+
+	case tcReset:
+		r.handles = r.handles[:0]
+		return r.readObject()
+
+	default:
+		return nil, fmt.Errorf("unsupported type code 0x%x", tc)
+	}
+}
+
+func (r *objectStreamReader) readUTF(long bool) ([]rune, error) {
+	var length int64
+	if long {
+		err := binary.Read(r.reader, binary.BigEndian, &length)
+		if nil != err {
+			return nil, err
+		}
+	} else {
+		var shortLen uint16
+		err := binary.Read(r.reader, binary.BigEndian, &shortLen)
+		if nil != err {
+			return nil, err
+		}
+		length = int64(shortLen)
+	}
+
+	if length < 0 || length > int64(r.reader.Len()) {
+		return nil, fmt.Errorf("invalid string length %d", length)
+	}
+
+	buf := make([]byte, length)
+	_, err := io.ReadFull(r.reader, buf)
+	if nil != err {
+		return nil, err
+	}
+
+	return decodeModifiedUTF8(buf)
+}
+
+// 读取一个字符串类型的对象, 返回go字符串
+func (r *objectStreamReader) readStringValue() (string, error) {
+	obj, err := r.readObject()
+	if nil != err {
+		return "", err
+	}
+
+	ref, ok := obj.(*class.Reference)
+	if !ok || nil == ref || class.ReferanceTypeObject != ref.RefType || "java/lang/String" != ref.Object.DefFile.FullClassName {
+		return "", errors.New("string expected")
+	}
+
+	return string(stringValue(ref)), nil
+}
+
+func (r *objectStreamReader) readClassDesc() (*streamClassDesc, error) {
+	tc, err := r.reader.ReadByte()
+	if nil != err {
+		return nil, fmt.Errorf("failed to read class desc: %w", err)
+	}
+
+	switch tc {
+	case tcNull:
+		return nil, nil
+
+	case tcReference:
+		handle, err := r.readHandle()
+		if nil != err {
+			return nil, err
+		}
+		desc, ok := handle.(*streamClassDesc)
+		if !ok {
+			return nil, errors.New("class desc expected")
+		}
+
+		return desc, nil
+
+	case tcClassDesc:
+		desc := new(streamClassDesc)
+		r.assignHandle(desc)
+
+		name, err := r.readUTF(false)
+		if nil != err {
+			return nil, err
+		}
+		desc.name = string(name)
+
+		err = binary.Read(r.reader, binary.BigEndian, &desc.suid)
+		if nil != err {
+			return nil, fmt.Errorf("failed to read serialVersionUID of '%s': %w", desc.name, err)
+		}
+		desc.flags, err = r.reader.ReadByte()
+		if nil != err {
+			return nil, fmt.Errorf("failed to read flags of '%s': %w", desc.name, err)
+		}
+
+		var fieldCount uint16
+		err = binary.Read(r.reader, binary.BigEndian, &fieldCount)
+		if nil != err {
+			return nil, err
+		}
+
+		for ix := 0; ix < int(fieldCount); ix++ {
+			field := new(streamField)
+			field.typeCode, err = r.reader.ReadByte()
+			if nil != err {
+				return nil, err
+			}
+
+			fieldName, err := r.readUTF(false)
+			if nil != err {
+				return nil, err
+			}
+			field.name = string(fieldName)
+
+			if !field.isPrimitive() {
+				field.className, err = r.readStringValue()
+				if nil != err {
+					return nil, fmt.Errorf("failed to read type of field '%s': %w", field.name, err)
+				}
+			}
+
+			desc.fields = append(desc.fields, field)
+		}
+
+		// 跳过classAnnotation
+		err = r.skipBlockData()
+		if nil != err {
+			return nil, err
+		}
+
+		desc.super, err = r.readClassDesc()
+		if nil != err {
+			return nil, err
+		}
+
+		return desc, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported class desc type code 0x%x", tc)
+	}
+}
+
+// 跳过自定义写入的数据, 直到TC_ENDBLOCKDATA
+func (r *objectStreamReader) skipBlockData() error {
+	for {
+		tc, err := r.reader.ReadByte()
+		if nil != err {
+			return err
+		}
+
+		switch tc {
+		case tcEndBlockData:
+			return nil
+
+		case tcBlockData:
+			length, err := r.reader.ReadByte()
+			if nil != err {
+				return err
+			}
+			_, err = r.reader.Seek(int64(length), io.SeekCurrent)
+			if nil != err {
+				return err
+			}
+
+		case tcBlockDataLong:
+			var length int32
+			err := binary.Read(r.reader, binary.BigEndian, &length)
+			if nil != err {
+				return err
+			}
+			_, err = r.reader.Seek(int64(length), io.SeekCurrent)
+			if nil != err {
+				return err
+			}
+
+		default:
+			r.reader.UnreadByte()
+			_, err := r.readObject()
+			if nil != err {
+				return err
+			}
+		}
+	}
+}
+
+// 检查允许列表并加载类
+func (r *objectStreamReader) loadClass(desc *streamClassDesc) (*class.DefFile, error) {
+	if nil != r.allowed && !r.allowed(desc.name) {
+		return nil, fmt.Errorf("java.io.InvalidClassException: %s: class is not allowed to be deserialized", desc.name)
+	}
+
+	def, err := r.loader.LoadClass(strings.ReplaceAll(desc.name, ".", "/"))
+	if nil != err {
+		return nil, fmt.Errorf("java.lang.ClassNotFoundException: %s: %w", desc.name, err)
+	}
+
+	return def, nil
+}
+
+func (r *objectStreamReader) readOrdinaryObject() (interface{}, error) {
+	desc, err := r.readClassDesc()
+	if nil != err {
+		return nil, err
+	}
+	if nil == desc {
+		return nil, errors.New("class desc of object is null")
+	}
+	if desc.flags & scExternalizable > 0 {
+		return nil, fmt.Errorf("externalizable class '%s' is not supported", desc.name)
+	}
+
+	def, err := r.loadClass(desc)
+	if nil != err {
+		return nil, err
+	}
+	if localSUID := serialVersionUIDOf(def); localSUID != desc.suid {
+		return nil, fmt.Errorf("java.io.InvalidClassException: %s; local class incompatible: stream classdesc serialVersionUID = %d, local class serialVersionUID = %d",
+			desc.name, desc.suid, localSUID)
+	}
+
+	localFields, err := localSerialFields(r.loader, def)
+	if nil != err {
+		return nil, err
+	}
+
+	obj, err := class.NewObject(def, r.loader)
+	if nil != err {
+		return nil, err
+	}
+	r.assignHandle(obj)
+
+	for _, current := range desc.hierarchy() {
+		if current != desc && nil != r.allowed && !r.allowed(current.name) {
+			return nil, fmt.Errorf("java.io.InvalidClassException: %s: class is not allowed to be deserialized", current.name)
+		}
+
+		for _, field := range current.fields {
+			// 流中的字段类型必须与本地类中同名字段的类型兼容, 否则按错误的类型读取会破坏后续数据
+			if local, ok := localFields[current.name][field.name]; ok {
+				if err := checkFieldType(r.loader, current.name, field, local); nil != err {
+					return nil, err
+				}
+			}
+
+			var val interface{}
+			if field.isPrimitive() {
+				val, err = r.readPrimitive(field.typeCode)
+			} else {
+				val, err = r.readObject()
+			}
+			if nil != err {
+				return nil, fmt.Errorf("failed to read field '%s' of '%s': %w", field.name, current.name, err)
+			}
+
+			// 本地类中已经没有的字段直接丢弃
+			if _, ok := localFields[current.name][field.name]; ok {
+				obj.Object.SetFieldValue(field.name, val)
+			}
+		}
+
+		// 自定义writeObject写入的额外数据
+		if current.flags & scWriteMethod > 0 {
+			err = r.skipBlockData()
+			if nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	return obj, nil
+}
+
+// 本地类及其父类中可以序列化的字段, key依次为类全名(以.分隔)和字段名
+func localSerialFields(loader class.Loader, def *class.DefFile) (map[string]map[string]*streamField, error) {
+	result := make(map[string]map[string]*streamField)
+	for current := def; nil != current; {
+		fields := make(map[string]*streamField)
+		for _, field := range serialFieldsOf(current) {
+			fields[field.name] = field
+		}
+		result[strings.ReplaceAll(current.FullClassName, "/", ".")] = fields
+
+		superName := superClassName(current)
+		if "" == superName {
+			break
+		}
+
+		var err error
+		current, err = loader.LoadClass(superName)
+		if nil != err {
+			return nil, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+	}
+
+	return result, nil
+}
+
+// 与ObjectStreamClass.matchFields()一样, 基本类型必须完全相同; 引用类型要求流中声明的类型可以赋值给本地字段的类型
+func checkFieldType(loader class.Loader, className string, field *streamField, local *streamField) error {
+	if field.isPrimitive() || local.isPrimitive() {
+		if field.typeCode != local.typeCode {
+			return fmt.Errorf("java.io.InvalidClassException: %s; incompatible types for field %s", className, field.name)
+		}
+		return nil
+	}
+
+	ok, err := isAssignableDescriptor(loader, local.className, field.className)
+	if nil != err {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("java.io.InvalidClassException: %s; incompatible types for field %s: stream type %s, local type %s",
+			className, field.name, field.className, local.className)
+	}
+
+	return nil
+}
+
+// source描述符表示的类型能否赋值给target, 如Ljava/lang/String;可以赋值给Ljava/lang/Object;
+func isAssignableDescriptor(loader class.Loader, target string, source string) (bool, error) {
+	if target == source || "Ljava/lang/Object;" == target {
+		return true, nil
+	}
+	// 数组只支持元素类型完全相同
+	if !strings.HasPrefix(target, "L") || !strings.HasPrefix(source, "L") {
+		return false, nil
+	}
+
+	targetName := strings.TrimSuffix(target[1:], ";")
+	sourceDef, err := loader.LoadClass(strings.TrimSuffix(source[1:], ";"))
+	if nil != err {
+		return false, fmt.Errorf("java.lang.ClassNotFoundException: %s: %w", source, err)
+	}
+	for current := sourceDef; nil != current; {
+		if targetName == current.FullClassName {
+			return true, nil
+		}
+
+		superName := superClassName(current)
+		if "" == superName {
+			break
+		}
+		current, err = loader.LoadClass(superName)
+		if nil != err {
+			return false, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+	}
+
+	return implementsInterface(loader, sourceDef, targetName)
+}
+
+func (r *objectStreamReader) readEnum() (interface{}, error) {
+	desc, err := r.readClassDesc()
+	if nil != err {
+		return nil, err
+	}
+	if nil == desc || 0 == desc.flags & scEnum {
+		return nil, errors.New("enum class desc expected")
+	}
+
+	def, err := r.loadClass(desc)
+	if nil != err {
+		return nil, err
+	}
+
+	// 先占位, 读出常量名后再替换
+	handle := r.assignHandle(nil)
+	name, err := r.readStringValue()
+	if nil != err {
+		return nil, err
+	}
+
+	constant := def.GetStaticField(name)
+	if nil == constant {
+		return nil, fmt.Errorf("java.lang.IllegalArgumentException: no enum constant %s.%s", desc.name, name)
+	}
+	r.handles[handle] = constant.FieldValue
+
+	return constant.FieldValue, nil
+}
+
+func (r *objectStreamReader) readArray() (interface{}, error) {
+	desc, err := r.readClassDesc()
+	if nil != err {
+		return nil, err
+	}
+	if nil == desc || !strings.HasPrefix(desc.name, "[") || len(desc.name) < 2 {
+		return nil, errors.New("array class desc expected")
+	}
+
+	var length int32
+	err = binary.Read(r.reader, binary.BigEndian, &length)
+	if nil != err {
+		return nil, err
+	}
+	if length < 0 || int(length) > r.reader.Len() {
+		return nil, fmt.Errorf("invalid array length %d", length)
+	}
+
+	elemType := desc.name[1]
+	var arrRef *class.Reference
+	switch elemType {
+	case 'L':
+		elemName := strings.TrimSuffix(desc.name[2:], ";")
+		if nil != r.allowed && !r.allowed(elemName) {
+			return nil, fmt.Errorf("java.io.InvalidClassException: %s: class is not allowed to be deserialized", desc.name)
+		}
+		arrRef, _ = class.NewObjectArray(int(length), strings.ReplaceAll(elemName, ".", "/"))
+
+	case '[':
+		arrRef, _ = class.NewObjectArray(int(length), strings.ReplaceAll(desc.name[1:], ".", "/"))
+
+	default:
+		arrType, ok := primitiveArrayTypes[elemType]
+		if !ok {
+			return nil, fmt.Errorf("invalid array class '%s'", desc.name)
+		}
+		arrRef, _ = class.NewArray(int(length), arrType)
+	}
+	r.assignHandle(arrRef)
+
+	for ix := 0; ix < arrRef.Array.Len(); ix++ {
+		var elem interface{}
+		if 'L' == elemType || '[' == elemType {
+			elem, err = r.readObject()
+		} else {
+			elem, err = r.readPrimitive(elemType)
+		}
+		if nil != err {
+			return nil, err
+		}
+
+		arrRef.Array.Store(ix, elem)
+	}
+
+	return arrRef, nil
+}
+
+// 与解释器中的表示保持一致: byte, short, int, boolean都是int, char是rune
+func (r *objectStreamReader) readPrimitive(typeCode byte) (interface{}, error) {
+	var err error
+	switch typeCode {
+	case 'B':
+		var val int8
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return int(val), err
+	case 'Z':
+		var val uint8
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return int(val), err
+	case 'C':
+		var val uint16
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return rune(val), err
+	case 'S':
+		var val int16
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return int(val), err
+	case 'I':
+		var val int32
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return int(val), err
+	case 'J':
+		var val int64
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return val, err
+	case 'F':
+		var val uint32
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return math.Float32frombits(val), err
+	case 'D':
+		var val uint64
+		err = binary.Read(r.reader, binary.BigEndian, &val)
+		return math.Float64frombits(val), err
+	}
+
+	return nil, fmt.Errorf("invalid primitive type code '%c'", typeCode)
+}
+
+// 基本类型数组元素类型码与newarray的atype的对应关系
+var primitiveArrayTypes = map[byte]byte{
+	'Z': atype.Boolean,
+	'C': atype.Char,
+	'F': atype.Float,
+	'D': atype.Double,
+	'B': atype.Byte,
+	'S': atype.Short,
+	'I': atype.Int,
+	'J': atype.Long,
+}
+
+// 数组的类名, 与Class.getName()一致, 如[I, [Ljava.lang.String;
+func arrayClassName(arr *class.Array) string {
+	if "" == arr.ObjectType {
+		for code, t := range primitiveArrayTypes {
+			if t == arr.Type {
+				return "[" + string(code)
+			}
+		}
+
+		return "[I"
+	}
+
+	elemName := strings.ReplaceAll(arr.ObjectType, "/", ".")
+	if strings.HasPrefix(elemName, "[") {
+		return "[" + elemName
+	}
+
+	return "[L" + elemName + ";"
+}
+
+func stringValue(strRef *class.Reference) []rune {
+	runes, _ := class.StringRunes(strRef)
+	return runes
+}
+
+// 整数类型的值在解释器中可能是int, int64, rune或bool, 未初始化的数组元素为nil
+func numericValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case rune:
+		return int(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case nil:
+		return 0
+	}
+
+	return val
+}
+
+func floatValue(val interface{}) float64 {
+	switch v := val.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+
+	return 0
+}
+
+func superClassName(def *class.DefFile) string {
+	if 0 == def.SuperClass {
+		return ""
+	}
+
+	superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+	return def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+}
+
+// 类或者它的父类是否实现了指定接口(包括间接继承的接口)
+func implementsInterface(loader class.Loader, def *class.DefFile, interfaceName string) (bool, error) {
+	for current := def; nil != current; {
+		for _, index := range current.Interfaces {
+			info := current.ConstPool.At(index).(*class.ClassInfoConstInfo)
+			name := current.ConstPool.At(info.FullClassNameIndex).(*class.Utf8InfoConst).String()
+			if interfaceName == name {
+				return true, nil
+			}
+
+			ifaceDef, err := loader.LoadClass(name)
+			if nil != err {
+				return false, fmt.Errorf("failed to load interface '%s': %w", name, err)
+			}
+			if ok, err := implementsInterface(loader, ifaceDef, interfaceName); nil != err || ok {
+				return ok, err
+			}
+		}
+
+		superName := superClassName(current)
+		if "" == superName {
+			break
+		}
+
+		var err error
+		current, err = loader.LoadClass(superName)
+		if nil != err {
+			return false, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+		}
+	}
+
+	return false, nil
+}
+
+// 枚举常量所属的枚举类; 带有方法体的枚举常量是枚举类的匿名子类, 此时返回父类; 不是枚举时返回nil
+func enumClassOf(loader class.Loader, def *class.DefFile) (*class.DefFile, error) {
+	superName := superClassName(def)
+	if "java/lang/Enum" == superName {
+		return def, nil
+	}
+	if 0 == def.AccessFlag & accflag.Enum || "" == superName {
+		return nil, nil
+	}
+
+	superDef, err := loader.LoadClass(superName)
+	if nil != err {
+		return nil, fmt.Errorf("failed to load super class '%s': %w", superName, err)
+	}
+	if "java/lang/Enum" == superClassName(superDef) {
+		return superDef, nil
+	}
+
+	return nil, nil
+}
+
+func findMethodInDef(def *class.DefFile, name string, descriptor string) *class.MethodInfo {
+	for _, method := range def.Methods {
+		if name == def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String() &&
+			descriptor == def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String() {
+			return method
+		}
+	}
+
+	return nil
+}
+
+// 参与默认序列化的字段: 非static, 非transient; 基本类型在前, 各自按字段名排序
+func serialFieldsOf(def *class.DefFile) []*streamField {
+	fields := make([]*streamField, 0, len(def.Fields))
+	for _, info := range def.Fields {
+		if info.AccessFlags & (accflag.Static | accflag.Transient) > 0 {
+			continue
+		}
+
+		descriptor := def.ConstPool.At(info.DescriptorIndex).(*class.Utf8InfoConst).String()
+		field := &streamField{
+			typeCode: descriptor[0],
+			name:     def.ConstPool.At(info.NameIndex).(*class.Utf8InfoConst).String(),
+		}
+		if !field.isPrimitive() {
+			field.className = descriptor
+		}
+
+		fields = append(fields, field)
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].isPrimitive() != fields[j].isPrimitive() {
+			return fields[i].isPrimitive()
+		}
+
+		return fields[i].name < fields[j].name
+	})
+
+	return fields
+}
+
+// 取类中声明的serialVersionUID, 没有声明时按照序列化规范计算默认值
+func serialVersionUIDOf(def *class.DefFile) int64 {
+	for _, info := range def.Fields {
+		name := def.ConstPool.At(info.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(info.DescriptorIndex).(*class.Utf8InfoConst).String()
+		if "serialVersionUID" != name || "J" != descriptor || 0 == info.AccessFlags & accflag.Static {
+			continue
+		}
+
+		attrs, _ := info.Attributes()
+		for _, attr := range attrs {
+			valAttr, ok := attr.(*class.ConstantValueAttr)
+			if !ok {
+				continue
+			}
+
+			if longConst, ok := def.ConstPool.At(valAttr.ConstantValueIndex).(*class.LongConst); ok {
+				return int64(uint64(longConst.HighByte) << 32 | uint64(longConst.LowByte))
+			}
+		}
+	}
+
+	if "java/lang/Enum" == def.FullClassName || "java/lang/Enum" == superClassName(def) {
+		return 0
+	}
+
+	return computeDefaultSUID(def)
+}
+
+// 按照ObjectStreamClass.computeDefaultSUID()的算法计算默认的serialVersionUID;
+// 类的修饰符直接取class文件中的access_flags, 没有处理内部类InnerClasses属性中的修饰符
+func computeDefaultSUID(def *class.DefFile) int64 {
+	buf := new(bytes.Buffer)
+	writeUTF := func(s string) {
+		utf := encodeModifiedUTF8([]rune(s))
+		binary.Write(buf, binary.BigEndian, uint16(len(utf)))
+		buf.Write(utf)
+	}
+	cpString := func(index uint16) string {
+		return def.ConstPool.At(index).(*class.Utf8InfoConst).String()
+	}
+
+	writeUTF(strings.ReplaceAll(def.FullClassName, "/", "."))
+
+	classMods := int32(def.AccessFlag) & (accflag.Public | accflag.Final | accflag.Interface | accflag.Abstarct)
+	if classMods & accflag.Interface > 0 {
+		if len(def.Methods) > 0 {
+			classMods |= accflag.Abstarct
+		} else {
+			classMods &^= accflag.Abstarct
+		}
+	}
+	binary.Write(buf, binary.BigEndian, classMods)
+
+	interfaces := make([]string, 0, len(def.Interfaces))
+	for _, index := range def.Interfaces {
+		info := def.ConstPool.At(index).(*class.ClassInfoConstInfo)
+		interfaces = append(interfaces, strings.ReplaceAll(cpString(info.FullClassNameIndex), "/", "."))
+	}
+	sort.Strings(interfaces)
+	for _, name := range interfaces {
+		writeUTF(name)
+	}
+
+	type member struct {
+		name       string
+		descriptor string
+		mods       int32
+	}
+
+	fields := make([]member, 0, len(def.Fields))
+	for _, info := range def.Fields {
+		mods := int32(info.AccessFlags) & (accflag.Public | accflag.Private | accflag.Protected | accflag.Static |
+			accflag.Final | accflag.Volatile | accflag.Transient)
+		if mods & accflag.Private > 0 && mods & (accflag.Static | accflag.Transient) > 0 {
+			continue
+		}
+		fields = append(fields, member{cpString(info.NameIndex), cpString(info.DescriptorIndex), mods})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	for _, f := range fields {
+		writeUTF(f.name)
+		binary.Write(buf, binary.BigEndian, f.mods)
+		writeUTF(f.descriptor)
+	}
+
+	if nil != findMethodInDef(def, "<clinit>", "()V") {
+		writeUTF("<clinit>")
+		binary.Write(buf, binary.BigEndian, int32(accflag.Static))
+		writeUTF("()V")
+	}
+
+	constructors := make([]member, 0, 2)
+	methods := make([]member, 0, len(def.Methods))
+	for _, info := range def.Methods {
+		name := cpString(info.NameIndex)
+		if "<clinit>" == name {
+			continue
+		}
+
+		mods := int32(info.AccessFlags) & (accflag.Public | accflag.Private | accflag.Protected | accflag.Static |
+			accflag.Final | accflag.Synchronized | accflag.Native | accflag.Abstarct | accflag.Strict)
+		if mods & accflag.Private > 0 {
+			continue
+		}
+
+		m := member{name, strings.ReplaceAll(cpString(info.DescriptorIndex), "/", "."), mods}
+		if "<init>" == name {
+			constructors = append(constructors, m)
+		} else {
+			methods = append(methods, m)
+		}
+	}
+	sort.Slice(constructors, func(i, j int) bool {
+		return constructors[i].descriptor < constructors[j].descriptor
+	})
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].name != methods[j].name {
+			return methods[i].name < methods[j].name
+		}
+		return methods[i].descriptor < methods[j].descriptor
+	})
+	for _, m := range append(constructors, methods...) {
+		writeUTF(m.name)
+		binary.Write(buf, binary.BigEndian, m.mods)
+		writeUTF(m.descriptor)
+	}
+
+	return suidFromHash(buf.Bytes())
+}
+
+// 数组类的默认serialVersionUID, 数组没有接口(计算时不包含), 字段和方法, 修饰符为public final abstract
+func arrayDefaultSUID(name string) int64 {
+	buf := new(bytes.Buffer)
+	utf := encodeModifiedUTF8([]rune(name))
+	binary.Write(buf, binary.BigEndian, uint16(len(utf)))
+	buf.Write(utf)
+	binary.Write(buf, binary.BigEndian, int32(accflag.Public | accflag.Final | accflag.Abstarct))
+
+	return suidFromHash(buf.Bytes())
+}
+
+// 取SHA-1的前8个字节, 按小端序组成long
+func suidFromHash(data []byte) int64 {
+	hash := sha1.Sum(data)
+
+	var suid int64
+	for ix := 7; ix >= 0; ix-- {
+		suid = suid << 8 | int64(hash[ix])
+	}
+
+	return suid
+}
+
+// 编码成DataOutput.writeUTF()使用的modified UTF-8: \u0000编码成两个字节, 辅助平面字符先拆成代理对
+func encodeModifiedUTF8(val []rune) []byte {
+	buf := make([]byte, 0, len(val))
+	for _, unit := range utf16.Encode(val) {
+		switch {
+		case unit >= 0x0001 && unit <= 0x007f:
+			buf = append(buf, byte(unit))
+		case unit <= 0x07ff:
+			buf = append(buf, byte(0xc0 | unit >> 6 & 0x1f), byte(0x80 | unit & 0x3f))
+		default:
+			buf = append(buf, byte(0xe0 | unit >> 12 & 0x0f), byte(0x80 | unit >> 6 & 0x3f), byte(0x80 | unit & 0x3f))
+		}
+	}
+
+	return buf
+}
+
+func decodeModifiedUTF8(buf []byte) ([]rune, error) {
+	units := make([]uint16, 0, len(buf))
+	for ix := 0; ix < len(buf); {
+		b := buf[ix]
+		switch {
+		case b < 0x80:
+			units = append(units, uint16(b))
+			ix++
+
+		case b & 0xe0 == 0xc0:
+			if ix + 1 >= len(buf) {
+				return nil, errors.New("malformed modified UTF-8")
+			}
+			units = append(units, uint16(b & 0x1f) << 6 | uint16(buf[ix + 1] & 0x3f))
+			ix += 2
+
+		case b & 0xf0 == 0xe0:
+			if ix + 2 >= len(buf) {
+				return nil, errors.New("malformed modified UTF-8")
+			}
+			units = append(units, uint16(b & 0x0f) << 12 | uint16(buf[ix + 1] & 0x3f) << 6 | uint16(buf[ix + 2] & 0x3f))
+			ix += 3
+
+		default:
+			return nil, errors.New("malformed modified UTF-8")
+		}
+	}
+
+	return utf16.Decode(units), nil
+}
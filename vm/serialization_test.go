@@ -0,0 +1,164 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"github.com/wanghongfei/mini-jvm/vm/internal/testutil"
+	"strings"
+	"testing"
+)
+
+func TestArrayDefaultSUID(t *testing.T) {
+	// 与JDK中ObjectStreamClass.lookup(int[].class).getSerialVersionUID()的值一致
+	if 0x4dba602676eab2a5 != arrayDefaultSUID("[I") {
+		t.Fatalf("unexpected suid of [I: %x", arrayDefaultSUID("[I"))
+	}
+	if -0x522da91816e284b9 != arrayDefaultSUID("[Ljava.lang.String;") {
+		t.Fatalf("unexpected suid of [Ljava.lang.String;: %x", arrayDefaultSUID("[Ljava.lang.String;"))
+	}
+}
+
+func TestModifiedUTF8(t *testing.T) {
+	val := []rune("a\u0000世界\U0001F600")
+	buf := encodeModifiedUTF8(val)
+	if !bytes.Equal([]byte{'a', 0xc0, 0x80}, buf[:3]) {
+		t.Fatalf("unexpected encoding %x", buf)
+	}
+
+	decoded, err := decodeModifiedUTF8(buf)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if string(val) != string(decoded) {
+		t.Fatalf("unexpected decoded string %s", string(decoded))
+	}
+}
+
+func TestSerializeArray(t *testing.T) {
+	loader := testutil.NewStubLoader()
+
+	str, _ := class.NewStringObject([]rune("a"), loader)
+	arr, _ := class.NewObjectArray(2, "java/lang/String")
+	arr.Array.Data[0] = str
+	arr.Array.Data[1] = str
+
+	data, err := SerializeObject(loader, arr)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// new ObjectOutputStream(out).writeObject(new String[]{"a", "a"})的输出
+	expected := "aced0005" + "7572" + "0013" + hex.EncodeToString([]byte("[Ljava.lang.String;")) +
+		"add256e7e91d7b47" + "02" + "0000" + "78" + "70" + "00000002" + "7400016171007e0002"
+	if expected != hex.EncodeToString(data) {
+		t.Fatalf("unexpected stream %x", data)
+	}
+
+	obj, err := DeserializeObject(loader, data, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	result := obj.(*class.Reference)
+	if 2 != len(result.Array.Data) || result.Array.Data[0] != result.Array.Data[1] {
+		t.Fatal("back reference not restored")
+	}
+	if "a" != string(stringValue(result.Array.Data[0].(*class.Reference))) {
+		t.Fatal("unexpected element")
+	}
+
+	// 基本类型数组
+	intArr, _ := class.NewArray(3, atype.Int)
+	intArr.Array.Data[0] = 1
+	intArr.Array.Data[1] = -2
+	data, err = SerializeObject(loader, intArr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	obj, err = DeserializeObject(loader, data, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	data2 := obj.(*class.Reference).Array.Data
+	if 1 != data2[0] || -2 != data2[1] || 0 != data2[2] {
+		t.Fatalf("unexpected int array %v", data2)
+	}
+}
+
+func TestDeserializeIncompatibleField(t *testing.T) {
+	// class Point implements Serializable { int x; String name; }
+	point := newClassBuilder("com/fh/Point", "java/lang/Object").implements("java/io/Serializable")
+	point.field("x", "I")
+	point.field("name", "Ljava/lang/String;")
+	jvm, err := newClassInitTestJvm(point.def,
+		newTestClass("java/lang/String", "java/lang/Object", nil),
+		newTestClass("java/lang/Integer", "java/lang/Object", nil),
+		newTestClass("java/io/Serializable", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+	loader := jvm.MethodArea
+
+	ref, err := class.NewObject(point.def, loader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	name, _ := class.NewStringObject([]rune("p"), loader)
+	ref.Object.SetFieldValue("x", 7)
+	ref.Object.SetFieldValue("name", name)
+	data, err := SerializeObject(loader, ref)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	obj, err := DeserializeObject(loader, data, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if x, _ := obj.(*class.Reference).Object.GetFieldValue("x"); 7 != x {
+		t.Fatalf("unexpected x %v", x)
+	}
+
+	// 流中的字段类型与本地不一致
+	cases := map[string][]byte{
+		"x":    bytes.Replace(data, []byte("I\x00\x01x"), []byte("J\x00\x01x"), 1),
+		"name": bytes.Replace(data, []byte("\x00\x12Ljava/lang/String;"), []byte("\x00\x13Ljava/lang/Integer;"), 1),
+	}
+	for field, tampered := range cases {
+		if bytes.Equal(data, tampered) {
+			t.Fatalf("%s: stream not tampered", field)
+		}
+		_, err := DeserializeObject(loader, tampered, nil)
+		if nil == err || !strings.Contains(err.Error(), "java.io.InvalidClassException: com.fh.Point; incompatible types for field " + field) {
+			t.Fatalf("%s: expected InvalidClassException, got %v", field, err)
+		}
+	}
+
+	// 截断的流在读取serialVersionUID和flags时报错
+	for _, length := range []int{len("com.fh.Point") + 12, len("com.fh.Point") + 16} {
+		if _, err := DeserializeObject(loader, data[:length], nil); nil == err {
+			t.Fatalf("expected error for stream truncated at %d", length)
+		}
+	}
+}
+
+func TestSerializationAllowlist(t *testing.T) {
+	jvm := &MiniJvm{}
+	if !jvm.serializationAllowed("com.fh.Person") {
+		t.Fatal("everything is allowed without allowlist")
+	}
+
+	jvm.SerializationAllowlist = []string{"com.fh.*", "java.lang.Integer"}
+	for name, expected := range map[string]bool{
+		"com.fh.Person":       true,
+		"com.fh.inner.Person": true,
+		"java.lang.Integer":   true,
+		"java.lang.Long":      false,
+		"com.fhx.Person":      false,
+	} {
+		if expected != jvm.serializationAllowed(name) {
+			t.Fatalf("unexpected result for %s", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+)
+
+// 调用栈中的一个栈帧, 对应java/lang/StackTraceElement
+type StackTraceElement struct {
+	// 类全名, 以.分隔
+	ClassName string
+	MethodName string
+	MethodDescriptor string
+
+	// 源文件名, 没有SourceFile属性时为空
+	FileName string
+	// 行号, 没有LineNumberTable属性时为-1
+	LineNumber int
+
+	// 栈帧当前的程序计数器
+	Pc int
+}
+
+func (e *StackTraceElement) String() string {
+	if "" == e.FileName {
+		return fmt.Sprintf("%s.%s(Unknown Source)", e.ClassName, e.MethodName)
+	}
+	if e.LineNumber < 0 {
+		return fmt.Sprintf("%s.%s(%s)", e.ClassName, e.MethodName, e.FileName)
+	}
+
+	return fmt.Sprintf("%s.%s(%s:%d)", e.ClassName, e.MethodName, e.FileName, e.LineNumber)
+}
+
+// 栈深度, 线程的第一个栈帧为1
+func (f *MethodStackFrame) Depth() int {
+	return f.depth
+}
+
+// 栈帧所在线程的编号, 主线程为1
+func (f *MethodStackFrame) ThreadID() int64 {
+	if 0 != f.threadID {
+		return f.threadID
+	}
+
+	// 不是由执行引擎创建的栈帧, 从线程的第一个栈帧中取
+	return f.rootFrame().threadID
+}
+
+// 从当前栈帧开始沿调用链向栈底遍历, 跳过线程启动时构造的辅助栈帧;
+// visitor返回false时停止遍历
+func (f *MethodStackFrame) Walk(visitor func(frame *MethodStackFrame) bool) {
+	for current := f; nil != current; current = current.prevFrame {
+		if nil == current.method {
+			continue
+		}
+
+		if !visitor(current) {
+			return
+		}
+	}
+}
+
+// 从当前栈帧开始生成调用栈, 第一个元素为当前栈帧
+func (f *MethodStackFrame) StackTrace() []*StackTraceElement {
+	trace := make([]*StackTraceElement, 0, f.depth)
+	f.Walk(func(frame *MethodStackFrame) bool {
+		trace = append(trace, frame.stackTraceElement())
+		return true
+	})
+
+	return trace
+}
+
+// 线程的第一个栈帧
+func (f *MethodStackFrame) rootFrame() *MethodStackFrame {
+	current := f
+	for nil != current.prevFrame {
+		current = current.prevFrame
+	}
+
+	return current
+}
+
+func (f *MethodStackFrame) stackTraceElement() *StackTraceElement {
+	def := f.method.DefFile
+
+	elem := &StackTraceElement{
+		ClassName:        strings.ReplaceAll(def.FullClassName, "/", "."),
+		MethodName:       def.ConstPool.At(f.method.NameIndex).(*class.Utf8InfoConst).String(),
+		MethodDescriptor: def.ConstPool.At(f.method.DescriptorIndex).(*class.Utf8InfoConst).String(),
+		LineNumber:       -1,
+		Pc:               f.pc,
+	}
+
+	// 源文件名
+	elem.FileName = sourceFileOf(def)
+
+	// 根据pc查行号表, 取start_pc不大于pc的最后一项
+	if nil != f.codeAttr {
+		for _, attr := range f.codeAttr.Attrs {
+			lineAttr, ok := attr.(*class.LineNumberAttr)
+			if !ok {
+				continue
+			}
+
+			bestStartPc := -1
+			for _, line := range lineAttr.LineNumberTable {
+				if int(line.StartPc) <= f.pc && int(line.StartPc) > bestStartPc {
+					bestStartPc = int(line.StartPc)
+					elem.LineNumber = int(line.LineNumber)
+				}
+			}
+		}
+	}
+
+	return elem
+}
@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+func TestMethodStackFrame_StackTrace(t *testing.T) {
+	def := &class.DefFile{
+		FullClassName: "com/fh/Foo",
+		ConstPool: class.NewConstPool(
+			&class.Utf8InfoConst{Bytes: []byte("main")},
+			&class.Utf8InfoConst{Bytes: []byte("([Ljava/lang/String;)V")},
+			&class.Utf8InfoConst{Bytes: []byte("foo")},
+			&class.Utf8InfoConst{Bytes: []byte("()V")},
+			&class.Utf8InfoConst{Bytes: []byte("Foo.java")},
+		),
+		Attrs: []interface{}{&class.SourceFileAttr{SourceFileIndex: 5}},
+	}
+	mainMethod := &class.MethodInfo{NameIndex: 1, DescriptorIndex: 2, DefFile: def}
+	fooMethod := &class.MethodInfo{NameIndex: 3, DescriptorIndex: 4, DefFile: def}
+
+	codeAttr := &class.CodeAttr{
+		Attrs: []interface{}{
+			&class.LineNumberAttr{LineNumberTable: []*class.LineNumberInfo{
+				{StartPc: 0, LineNumber: 10},
+				{StartPc: 4, LineNumber: 11},
+			}},
+		},
+	}
+
+	mainFrame := &MethodStackFrame{depth: 1, pc: 5, method: mainMethod, codeAttr: codeAttr}
+	fooFrame := &MethodStackFrame{depth: 2, pc: 0, method: fooMethod, codeAttr: codeAttr, prevFrame: mainFrame}
+
+	trace := fooFrame.StackTrace()
+	if 2 != len(trace) {
+		t.FailNow()
+	}
+	if "com.fh.Foo.foo(Foo.java:10)" != trace[0].String() {
+		t.Fatal(trace[0])
+	}
+	if "com.fh.Foo.main(Foo.java:11)" != trace[1].String() {
+		t.Fatal(trace[1])
+	}
+	if mainFrame != fooFrame.rootFrame() {
+		t.FailNow()
+	}
+}
+
+func TestThrowableGetStackTraceElementOutOfBounds(t *testing.T) {
+	// IndexOutOfBoundsException(String s) { detailMessage = s; }
+	exception := newClassBuilder("java/lang/IndexOutOfBoundsException", "java/lang/Object")
+	exception.field("detailMessage", "Ljava/lang/String;")
+	exception.method(accflag.Public, "<init>", "(Ljava/lang/String;)V", 2, 2, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Aload1).emitIndex(bcode.Putfield, exception.fieldRef("java/lang/IndexOutOfBoundsException", "detailMessage", "Ljava/lang/String;")).
+		emit(bcode.Return))
+	throwable := newTestClass("java/lang/Throwable", "java/lang/Object", nil)
+	jvm, err := newClassInitTestJvm(exception.def, throwable, newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	ref, err := class.NewObject(throwable, jvm.MethodArea)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ref.Object.ObjectFields["backtrace"] = &class.ObjectField{
+		FieldValue: []*StackTraceElement{{ClassName: "com.fh.Foo", MethodName: "main", LineNumber: 10}},
+		FieldType:  "backtrace",
+	}
+
+	frame := newMethodStackFrame(0, 0)
+	for _, index := range []int{-1, 1} {
+		ret := ThrowableGetStackTraceElement(jvm, ref, index, frame)
+		var thrown *ExceptionThrownError
+		if err, _ := ret.(error); !errors.As(err, &thrown) || "java/lang/IndexOutOfBoundsException" != thrown.ExceptionRef.Object.DefFile.FullClassName {
+			t.Fatalf("index %d: expect IndexOutOfBoundsException, got %v", index, ret)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+)
+
+// 在def的常量池中添加指向自身的字段引用, 返回字段引用的下标
+func addTestFieldRef(def *class.DefFile, name string, descriptor string) uint16 {
+	nameIndex := def.ConstPool.Add(&class.Utf8InfoConst{Bytes: []byte(name)})
+	def.ConstPool.Add(&class.Utf8InfoConst{Bytes: []byte(descriptor)})
+
+	nameAndTypeIndex := def.ConstPool.Add(&class.NameAndTypeConst{NameIndex: nameIndex, DescIndex: nameIndex + 1})
+	return def.ConstPool.Add(&class.FieldRefConstInfo{ClassIndex: def.ThisClass, NameAndTypeIndex: nameAndTypeIndex})
+}
+
+func TestStaticFieldRoundTrip(t *testing.T) {
+	def := newTestClass("com/fh/Holder", "", nil)
+	def.ParsedStaticFields = map[string]*class.ObjectField{
+		"count":    {FieldValue: 0, FieldType: "int"},
+		"instance": {FieldValue: nil, FieldType: "null;com/fh/Holder"},
+		"total":    {FieldValue: 0, FieldType: "long"},
+	}
+
+	ma, err := newTestMethodArea(def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	engine := NewInterpretedExecutionEngine(&MiniJvm{MethodArea: ma, stats: new(vmStats)})
+
+	ref := newTestException("com/fh/Holder")
+	cases := []struct {
+		name       string
+		descriptor string
+		initial    interface{}
+		value      interface{}
+	}{
+		{"count", "I", 0, 42},
+		{"instance", "Lcom/fh/Holder;", nil, ref},
+		{"total", "J", 0, int64(1) << 40},
+	}
+
+	for _, c := range cases {
+		index := addTestFieldRef(def, c.name, c.descriptor)
+		codeAttr := &class.CodeAttr{Code: []byte{bcode.Getstatic, byte(index >> 8), byte(index)}}
+		fieldType := def.GetStaticField(c.name).FieldType
+
+		// 初始值
+		frame := newMethodStackFrame(2, 0)
+		if err := engine.bcodeGetStatic(def, frame, codeAttr); nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if val, _ := frame.opStack.Pop(); c.initial != val {
+			t.Fatalf("%s: unexpected initial value %v", c.name, val)
+		}
+
+		// putstatic后再getstatic, 得到的是同一个值
+		frame = newMethodStackFrame(2, 0)
+		frame.opStack.Push(c.value)
+		if err := engine.bcodePutStatic(def, frame, codeAttr); nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		frame.pc = 0
+		if err := engine.bcodeGetStatic(def, frame, codeAttr); nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if val, _ := frame.opStack.Pop(); c.value != val {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.value, val)
+		}
+
+		// 字段原有的类型信息不变
+		if fieldType != def.GetStaticField(c.name).FieldType {
+			t.Fatalf("%s: field type changed", c.name)
+		}
+	}
+
+	// 不存在的字段
+	index := addTestFieldRef(def, "missing", "I")
+	codeAttr := &class.CodeAttr{Code: []byte{bcode.Getstatic, byte(index >> 8), byte(index)}}
+	if err := engine.bcodeGetStatic(def, newMethodStackFrame(2, 0), codeAttr); nil == err {
+		t.Fatal("missing static field should fail")
+	}
+}
+
+func TestStaticFieldResolution(t *testing.T) {
+	object := newTestClass("java/lang/Object", "", nil)
+	constants := newTestClass("com/fh/Constants", "java/lang/Object", nil)
+	constants.ParsedStaticFields = map[string]*class.ObjectField{"MAX": class.NewObjectField(100)}
+	base := newTestClass("com/fh/Base", "java/lang/Object", nil)
+	base.ParsedStaticFields = map[string]*class.ObjectField{
+		"count": class.NewObjectField(1),
+		"MAX":   class.NewObjectField(-1),
+	}
+	sub := newTestClass("com/fh/Sub", "com/fh/Base", []string{"com/fh/Constants"})
+
+	ma, err := newTestMethodArea(object, constants, base, sub)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		owner *class.DefFile
+	}{
+		{"count", base},
+		// 接口先于父类查找
+		{"MAX", constants},
+	}
+	for _, c := range cases {
+		owner, err := ma.ResolveStaticField(sub, c.name)
+		if nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if c.owner != owner {
+			t.Fatalf("%s: resolved to '%s'", c.name, owner.FullClassName)
+		}
+		if _, ok := ma.staticFieldOwners.Load(staticFieldKey{sub, c.name}); !ok {
+			t.Fatalf("%s: resolution not cached", c.name)
+		}
+	}
+
+	if _, err := ma.ResolveStaticField(sub, "missing"); nil == err {
+		t.Fatal("missing static field should fail")
+	}
+
+	// putstatic写入的是声明字段的类
+	engine := NewInterpretedExecutionEngine(&MiniJvm{MethodArea: ma, stats: new(vmStats)})
+	index := addTestFieldRef(sub, "count", "I")
+	codeAttr := &class.CodeAttr{Code: []byte{bcode.Putstatic, byte(index >> 8), byte(index)}}
+	frame := newMethodStackFrame(2, 0)
+	frame.opStack.Push(7)
+	if err := engine.bcodePutStatic(sub, frame, codeAttr); nil != err {
+		t.Fatal(err)
+	}
+	if val, _ := base.GetStaticFieldValue("count"); 7 != val {
+		t.Fatalf("unexpected value %v", val)
+	}
+}
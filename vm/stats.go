@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// VM运行期间的计数器;
+// 多个goroutine会同时更新, 所有字段都只能通过atomic操作访问
+type vmStats struct {
+	classesLoaded    int64
+	framesCreated    int64
+	maxStackDepth    int64
+	exceptionsThrown int64
+	nativeCalls      int64
+
+	byteCodes OpcodeCounter
+}
+
+func (s *vmStats) onClassLoaded() {
+	atomic.AddInt64(&s.classesLoaded, 1)
+}
+
+func (s *vmStats) onFrameCreated(depth int) {
+	atomic.AddInt64(&s.framesCreated, 1)
+
+	// 更新最大栈深度
+	for {
+		max := atomic.LoadInt64(&s.maxStackDepth)
+		if int64(depth) <= max || atomic.CompareAndSwapInt64(&s.maxStackDepth, max, int64(depth)) {
+			break
+		}
+	}
+}
+
+func (s *vmStats) onExceptionThrown() {
+	atomic.AddInt64(&s.exceptionsThrown, 1)
+}
+
+func (s *vmStats) onNativeCall() {
+	atomic.AddInt64(&s.nativeCalls, 1)
+}
+
+func (s *vmStats) onByteCode(code byte) {
+	s.byteCodes.inc(code)
+}
+
+// 执行统计的快照, 由MiniJvm.Stats()返回
+type Stats struct {
+	// 加载的类数量
+	ClassesLoaded int64
+	// 创建的栈帧数量(只统计字节码方法, 不含native方法)
+	FramesCreated int64
+	// 达到过的最大栈深度
+	MaxStackDepth int64
+	// 执行athrow的次数
+	ExceptionsThrown int64
+	// 本地方法调用次数
+	NativeCalls int64
+
+	// 各字节码的执行次数
+	// key: 字节码助记符
+	ByteCodes map[string]int64
+}
+
+// 执行过的字节码总数
+func (s *Stats) TotalByteCodes() int64 {
+	var total int64
+	for _, count := range s.ByteCodes {
+		total += count
+	}
+
+	return total
+}
+
+func (s *Stats) String() string {
+	var sb strings.Builder
+	sb.WriteString("classes loaded:    " + fmt.Sprint(s.ClassesLoaded) + "\n")
+	sb.WriteString("frames created:    " + fmt.Sprint(s.FramesCreated) + "\n")
+	sb.WriteString("max stack depth:   " + fmt.Sprint(s.MaxStackDepth) + "\n")
+	sb.WriteString("exceptions thrown: " + fmt.Sprint(s.ExceptionsThrown) + "\n")
+	sb.WriteString("native calls:      " + fmt.Sprint(s.NativeCalls) + "\n")
+	sb.WriteString("byte codes:        " + fmt.Sprint(s.TotalByteCodes()) + "\n")
+
+	// 按执行次数从多到少输出
+	names := make([]string, 0, len(s.ByteCodes))
+	for name := range s.ByteCodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if s.ByteCodes[names[i]] != s.ByteCodes[names[j]] {
+			return s.ByteCodes[names[i]] > s.ByteCodes[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("  %-16s %d\n", name, s.ByteCodes[name]))
+	}
+
+	return sb.String()
+}
+
+// 返回当前执行统计的快照, 可以在VM运行过程中随时调用
+func (m *MiniJvm) Stats() *Stats {
+	s := m.stats
+
+	snapshot := &Stats{
+		ClassesLoaded:    atomic.LoadInt64(&s.classesLoaded),
+		FramesCreated:    atomic.LoadInt64(&s.framesCreated),
+		MaxStackDepth:    atomic.LoadInt64(&s.maxStackDepth),
+		ExceptionsThrown: atomic.LoadInt64(&s.exceptionsThrown),
+		NativeCalls:      atomic.LoadInt64(&s.nativeCalls),
+		ByteCodes:        make(map[string]int64),
+	}
+
+	for _, item := range s.byteCodes.Histogram() {
+		snapshot.ByteCodes[item.Name] = item.Count
+	}
+
+	return snapshot
+}
+
+// 字节码执行次数计数器, 可用于输出直方图
+func (m *MiniJvm) OpcodeCounter() *OpcodeCounter {
+	return &m.stats.byteCodes
+}
@@ -0,0 +1,264 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/atype"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// 一次字符串去重的结果
+type StringDedupResult struct {
+	// 检查过的String对象个数
+	Strings int
+	// 其中内容不同的个数
+	Unique int
+	// 改为共享同一个value数组的String个数
+	Deduplicated int
+	// 不再被引用的value数组占用的字节数(估算), 在go的下一次GC后释放
+	BytesSaved int64
+	// 耗时
+	Elapsed time.Duration
+}
+
+func (r *StringDedupResult) String() string {
+	return fmt.Sprintf("string dedup: %d strings, %d unique, %d deduplicated, %d bytes saved in %v",
+		r.Strings, r.Unique, r.Deduplicated, r.BytesSaved, r.Elapsed)
+}
+
+func (r *StringDedupResult) add(other *StringDedupResult) {
+	r.Strings += other.Strings
+	r.Unique += other.Unique
+	r.Deduplicated += other.Deduplicated
+	r.BytesSaved += other.BytesSaved
+	r.Elapsed += other.Elapsed
+}
+
+// 字符串去重的状态, 同一时刻只执行一次
+type stringDeduplicator struct {
+	// 历次去重的累计结果, 见StringDedupTotal()
+	total StringDedupResult
+	lock  sync.Mutex
+}
+
+// 从static字段, 字符串常量池和被钉住的对象出发, 找出内容相同的String, 让它们共享同一个value数组(优先使用常量池中字符串的数组),
+// 释放多余的char[]/byte[]; 只改变String内部的value字段, ==和identityHashCode不受影响.
+// 只在栈帧中(本地变量, 操作数栈)可达的String不会被检查; value数组还被String以外的对象引用时不处理.
+// 可以在guest线程运行时调用, 但最好在空闲时(如两次请求之间); 见StringDedupInterval
+func (m *MiniJvm) DeduplicateStrings() *StringDedupResult {
+	m.stringDedup.lock.Lock()
+	defer m.stringDedup.lock.Unlock()
+
+	start := time.Now()
+	walker := newStringDedupWalker()
+
+	// 常量池中的字符串最先访问, 它们的数组作为共享的数组
+	m.MethodArea.internedStringsLock.Lock()
+	literals := make([]string, 0, len(m.MethodArea.internedStrings))
+	for literal := range m.MethodArea.internedStrings {
+		literals = append(literals, literal)
+	}
+	sort.Strings(literals)
+	interned := make([]*class.Reference, 0, len(literals))
+	for _, literal := range literals {
+		interned = append(interned, m.MethodArea.internedStrings[literal])
+	}
+	m.MethodArea.internedStringsLock.Unlock()
+	for _, ref := range interned {
+		walker.visit(ref)
+	}
+
+	m.MethodArea.ClassMapLock.RLock()
+	defs := make([]*class.DefFile, 0, len(m.MethodArea.ClassMap))
+	for _, def := range m.MethodArea.ClassMap {
+		defs = append(defs, def)
+	}
+	m.MethodArea.ClassMapLock.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].FullClassName < defs[j].FullClassName
+	})
+	for _, def := range defs {
+		if nil == def.ParsedStaticFields {
+			continue
+		}
+		fields := def.CopyStaticFields()
+		for _, name := range sortedFieldNames(fields) {
+			walker.visitValue(fields[name].FieldValue)
+		}
+	}
+
+	m.pinned.lock.Lock()
+	pinned := make([]*class.Reference, 0, len(m.pinned.counts))
+	for ref := range m.pinned.counts {
+		pinned = append(pinned, ref)
+	}
+	m.pinned.lock.Unlock()
+	for _, ref := range pinned {
+		walker.visit(ref)
+	}
+
+	walker.walk()
+	result := walker.deduplicate()
+	result.Elapsed = time.Since(start)
+	m.stringDedup.total.add(result)
+
+	return result
+}
+
+// 历次DeduplicateStrings()的累计结果
+func (m *MiniJvm) StringDedupTotal() StringDedupResult {
+	m.stringDedup.lock.Lock()
+	defer m.stringDedup.lock.Unlock()
+
+	return m.stringDedup.total
+}
+
+// 设置了StringDedupInterval时在后台定期去重, 返回的函数停止去重
+func (m *MiniJvm) startStringDedup() func() {
+	if m.StringDedupInterval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(m.StringDedupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.DeduplicateStrings()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// 遍历可达对象, 记录每个String的value数组以及被String以外的对象引用的数组
+type stringDedupWalker struct {
+	visited map[*class.Reference]bool
+	queue   []*class.Reference
+
+	// 按访问顺序
+	strings []*class.Reference
+	// 被String.value以外的字段或数组元素引用的数组
+	escaped map[*class.Reference]bool
+}
+
+func newStringDedupWalker() *stringDedupWalker {
+	return &stringDedupWalker{
+		visited: make(map[*class.Reference]bool),
+		escaped: make(map[*class.Reference]bool),
+	}
+}
+
+func (w *stringDedupWalker) visitValue(val interface{}) {
+	if ref, ok := val.(*class.Reference); ok && nil != ref {
+		if class.ReferanceTypeArray == ref.RefType {
+			w.escaped[ref] = true
+		}
+		w.visit(ref)
+	}
+}
+
+func (w *stringDedupWalker) visit(ref *class.Reference) {
+	if nil == ref || w.visited[ref] {
+		return
+	}
+	w.visited[ref] = true
+	w.queue = append(w.queue, ref)
+}
+
+func (w *stringDedupWalker) walk() {
+	for len(w.queue) > 0 {
+		ref := w.queue[0]
+		w.queue = w.queue[1:]
+
+		if class.ReferanceTypeArray == ref.RefType {
+			arr := ref.Array
+			if "" == arr.ObjectType {
+				continue
+			}
+			for ix := 0; ix < arr.Len(); ix++ {
+				w.visitValue(arr.Load(ix))
+			}
+			continue
+		}
+
+		// String只记录, 不把value算作逃逸
+		if "java/lang/String" == ref.Object.DefFile.FullClassName {
+			w.strings = append(w.strings, ref)
+			continue
+		}
+		for _, field := range ref.Object.CopyFields() {
+			w.visitValue(field.FieldValue)
+		}
+	}
+}
+
+func (w *stringDedupWalker) deduplicate() *StringDedupResult {
+	result := &StringDedupResult{Strings: len(w.strings)}
+
+	// key: 数组类型 + coder + 内容, val: 共享的value数组
+	canonical := make(map[string]*class.Reference)
+	// 同一个数组可能本来就被多个String共享, 只统计一次
+	released := make(map[*class.Reference]bool)
+	for _, strRef := range w.strings {
+		val, _ := strRef.Object.GetFieldValue("value")
+		arrRef, _ := val.(*class.Reference)
+		if nil == arrRef || nil == arrRef.Array || w.escaped[arrRef] {
+			continue
+		}
+		runes, err := class.StringRunes(strRef)
+		if nil != err {
+			continue
+		}
+
+		key := string(runes)
+		if atype.Byte == arrRef.Array.Type {
+			coder, _ := strRef.Object.GetFieldValue("coder")
+			key = fmt.Sprintf("B%v:%s", coder, key)
+		} else {
+			key = "C:" + key
+		}
+
+		shared, ok := canonical[key]
+		if !ok {
+			canonical[key] = arrRef
+			result.Unique++
+			continue
+		}
+		if shared == arrRef {
+			continue
+		}
+
+		strRef.Object.SetFieldValue("value", shared)
+		result.Deduplicated++
+		if !released[arrRef] {
+			released[arrRef] = true
+			result.BytesSaved += arrayDataSize(arrRef.Array)
+		}
+	}
+
+	return result
+}
+
+// 数组数据占用的字节数: byte[]每个元素1字节, 其他数组每个元素是一个interface{}
+func arrayDataSize(arr *class.Array) int64 {
+	if nil != arr.Bytes {
+		return int64(len(arr.Bytes))
+	}
+
+	return int64(arr.Len()) * int64(unsafe.Sizeof(interface{}(nil)))
+}
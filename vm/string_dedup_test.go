@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"testing"
+	"unsafe"
+)
+
+func TestDeduplicateStrings(t *testing.T) {
+	cache := newTestClass("com/fh/Cache", "java/lang/Object", nil)
+	jvm, err := newClassInitTestJvm(cache, newTestClass("java/lang/String", "java/lang/Object", nil))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	newString := func(val string) *class.Reference {
+		ref, err := class.NewStringObject([]rune(val), jvm.MethodArea)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return ref
+	}
+	valueOf := func(strRef *class.Reference) *class.Reference {
+		val, _ := strRef.Object.GetFieldValue("value")
+		return val.(*class.Reference)
+	}
+
+	literal, err := jvm.MethodArea.InternString("hello")
+	if nil != err {
+		t.Fatal(err)
+	}
+	hello, world1, world2, escaped := newString("hello"), newString("world"), newString("world"), newString("world")
+	list, _ := class.NewObjectArray(2, "java/lang/String")
+	list.Array.Store(0, world1)
+	list.Array.Store(1, world2)
+	// escaped的value数组同时被static字段引用, 可能被guest修改, 不能共享
+	cache.ParsedStaticFields = map[string]*class.ObjectField{
+		"hello": {FieldValue: hello, FieldType: "ref"},
+		"list":  {FieldValue: list, FieldType: "arr"},
+		"other": {FieldValue: escaped, FieldType: "ref"},
+		"chars": {FieldValue: valueOf(escaped), FieldType: "arr"},
+		"count": {FieldValue: 3, FieldType: "int"},
+	}
+
+	result := jvm.DeduplicateStrings()
+	if 5 != result.Strings || 2 != result.Unique || 2 != result.Deduplicated {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if expect := int64(10 * unsafe.Sizeof(interface{}(nil))); expect != result.BytesSaved {
+		t.Fatalf("expect %d bytes saved, got %d", expect, result.BytesSaved)
+	}
+
+	// 优先共享常量池中字符串的数组, 对象本身不变
+	if valueOf(literal) != valueOf(hello) || valueOf(world1) != valueOf(world2) || valueOf(world1) == valueOf(escaped) {
+		t.Fatal("value arrays not shared as expected")
+	}
+	if runes, _ := class.StringRunes(world2); "world" != string(runes) {
+		t.Fatalf("unexpected content %s", string(runes))
+	}
+
+	// 已经共享的不再计算
+	if again := jvm.DeduplicateStrings(); 0 != again.Deduplicated || 0 != again.BytesSaved {
+		t.Fatalf("unexpected second result %+v", again)
+	}
+	if total := jvm.StringDedupTotal(); 2 != total.Deduplicated || 10 != total.Strings {
+		t.Fatalf("unexpected total %+v", total)
+	}
+}
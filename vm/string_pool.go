@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 字符串常量池;
+// ldc加载的字符串字面量和String.intern()的结果按内容共享同一个String对象,
+// 循环中反复执行ldc不会每次都构造新的String对象和char数组
+func (m *MethodArea) InternString(val string) (*class.Reference, error) {
+	m.internedStringsLock.Lock()
+	defer m.internedStringsLock.Unlock()
+
+	if ref, ok := m.internedStrings[val]; ok {
+		return ref, nil
+	}
+
+	ref, err := class.NewStringObject([]rune(val), m)
+	if nil != err {
+		return nil, fmt.Errorf("failed to intern string: %w", err)
+	}
+	if nil == m.internedStrings {
+		m.internedStrings = make(map[string]*class.Reference)
+	}
+	m.internedStrings[val] = ref
+
+	return ref, nil
+}
@@ -0,0 +1,401 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// 生成stub所需的类结构, 可以来自class文件或者javap -s的输出
+type StubClass struct {
+	// 类全名, 用/分隔
+	Name        string
+	SuperName   string
+	Interfaces  []string
+	IsInterface bool
+	IsAbstract  bool
+
+	Methods []*StubMethod
+}
+
+type StubMethod struct {
+	Name       string
+	Descriptor string
+	Flags      uint16
+}
+
+// 生成的代码
+type Stubs struct {
+	// go本地方法骨架, 包括newBuiltinNativeMethodTable()中要添加的注册语句
+	GoSource string
+	// 方法都声明为native的java类, 放到mini-lib中编译
+	JavaSource string
+}
+
+// 从解析好的class文件中提取类结构
+func StubClassFromDef(def *class.DefFile) *StubClass {
+	stub := &StubClass{
+		Name:        def.FullClassName,
+		IsInterface: def.AccessFlag & accflag.Interface > 0,
+		IsAbstract:  def.AccessFlag & accflag.Abstarct > 0,
+	}
+	if 0 != def.SuperClass {
+		stub.SuperName = classNameAt(def, def.SuperClass)
+	}
+	stub.Interfaces = interfaceNamesOf(def)
+
+	for _, method := range def.Methods {
+		stub.Methods = append(stub.Methods, &StubMethod{
+			Name:       def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String(),
+			Descriptor: def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String(),
+			Flags:      method.AccessFlags,
+		})
+	}
+
+	return stub
+}
+
+// java/util/ArrayList -> native_method_array_list.go
+func (s *StubClass) GoFileName() string {
+	simpleName := strings.ReplaceAll(s.Name[strings.LastIndex(s.Name, "/") + 1:], "$", "")
+
+	var sb strings.Builder
+	for ix, ch := range simpleName {
+		if unicode.IsUpper(ch) {
+			if ix > 0 {
+				sb.WriteByte('_')
+			}
+			ch = unicode.ToLower(ch)
+		}
+		sb.WriteRune(ch)
+	}
+
+	return "native_method_" + sb.String() + ".go"
+}
+
+// java/util/ArrayList -> java/util/ArrayList.java, 内部类只保留内部类的名字
+func (s *StubClass) JavaFilePath() string {
+	dir := ""
+	if ix := strings.LastIndex(s.Name, "/"); ix > 0 {
+		dir = s.Name[:ix + 1]
+	}
+	simpleName := s.Name[len(dir):]
+
+	return dir + simpleName[strings.LastIndex(simpleName, "$") + 1:] + ".java"
+}
+
+// 解析javap -s的输出, 没有descriptor行的方法无法确定描述符, 会返回错误
+func ParseJavapOutput(r io.Reader) (*StubClass, error) {
+	var stub *StubClass
+	var pending *StubMethod
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case "" == line || strings.HasPrefix(line, "Compiled from") || "}" == line:
+
+		case nil == stub:
+			stub = parseJavapClassHeader(line)
+			if nil == stub {
+				return nil, fmt.Errorf("invalid javap class header: %s", line)
+			}
+
+		case strings.HasPrefix(line, "descriptor:"):
+			if nil != pending {
+				pending.Descriptor = strings.TrimSpace(strings.TrimPrefix(line, "descriptor:"))
+				stub.Methods = append(stub.Methods, pending)
+				pending = nil
+			}
+
+		default:
+			if nil != pending {
+				return nil, fmt.Errorf("no descriptor for method '%s', run javap with -s", pending.Name)
+			}
+			// 字段没有括号, 跳过
+			pending = parseJavapMethod(stub, line)
+		}
+	}
+	if nil != scanner.Err() {
+		return nil, fmt.Errorf("failed to read javap output: %w", scanner.Err())
+	}
+
+	if nil == stub {
+		return nil, fmt.Errorf("no class found in javap output")
+	}
+	if nil != pending {
+		return nil, fmt.Errorf("no descriptor for method '%s', run javap with -s", pending.Name)
+	}
+
+	return stub, nil
+}
+
+// public class java.util.ArrayList<E> extends java.util.AbstractList<E> implements java.util.List<E>, java.io.Serializable {
+func parseJavapClassHeader(line string) *StubClass {
+	words := strings.Fields(strings.ReplaceAll(stripGenerics(strings.TrimSuffix(line, "{")), ",", " "))
+
+	stub := new(StubClass)
+	section := ""
+	for _, word := range words {
+		switch word {
+		case "interface":
+			stub.IsInterface = true
+			section = "name"
+		case "class":
+			section = "name"
+		case "abstract":
+			stub.IsAbstract = true
+		case "extends", "implements":
+			section = word
+
+		default:
+			name := strings.ReplaceAll(word, ".", "/")
+			switch section {
+			case "name":
+				stub.Name = name
+			case "extends":
+				// 接口的extends是父接口
+				if stub.IsInterface {
+					stub.Interfaces = append(stub.Interfaces, name)
+				} else {
+					stub.SuperName = name
+				}
+			case "implements":
+				stub.Interfaces = append(stub.Interfaces, name)
+			}
+		}
+	}
+	if "" == stub.Name {
+		return nil
+	}
+	if "" == stub.SuperName && "java/lang/Object" != stub.Name {
+		stub.SuperName = "java/lang/Object"
+	}
+
+	return stub
+}
+
+// public boolean add(E);
+// public java.util.ArrayList(int);
+func parseJavapMethod(stub *StubClass, line string) *StubMethod {
+	line = stripGenerics(line)
+	if "static {};" == line {
+		return &StubMethod{Name: "<clinit>", Flags: accflag.Static}
+	}
+
+	paren := strings.Index(line, "(")
+	if paren < 0 {
+		return nil
+	}
+
+	words := strings.Fields(line[:paren])
+	if 0 == len(words) {
+		return nil
+	}
+
+	method := &StubMethod{Name: words[len(words) - 1]}
+	if strings.ReplaceAll(method.Name, ".", "/") == stub.Name {
+		method.Name = "<init>"
+	}
+	for _, word := range words[:len(words) - 1] {
+		switch word {
+		case "public":
+			method.Flags |= accflag.Public
+		case "protected":
+			method.Flags |= accflag.Protected
+		case "private":
+			method.Flags |= accflag.Private
+		case "static":
+			method.Flags |= accflag.Static
+		case "final":
+			method.Flags |= accflag.Final
+		case "native":
+			method.Flags |= accflag.Native
+		case "abstract":
+			method.Flags |= accflag.Abstarct
+		case "synchronized":
+			method.Flags |= accflag.Synchronized
+		}
+	}
+	// 接口中没有default的方法都是抽象的
+	if stub.IsInterface && method.Flags & accflag.Static == 0 && !strings.Contains(line, "default ") {
+		method.Flags |= accflag.Abstarct
+	}
+
+	return method
+}
+
+// 去掉<...>泛型参数, 支持嵌套
+func stripGenerics(s string) string {
+	var sb strings.Builder
+	depth := 0
+	for _, ch := range s {
+		switch {
+		case '<' == ch:
+			depth++
+		case '>' == ch:
+			depth--
+		case 0 == depth:
+			sb.WriteRune(ch)
+		}
+	}
+
+	return sb.String()
+}
+
+// 根据类结构生成go和java代码; 只为public和protected的非抽象方法生成本地方法,
+// 构造方法不能是native的, 由构造方法调用native的init0(); 接口只生成抽象方法的声明
+func GenerateStubs(stub *StubClass) *Stubs {
+	dotName := strings.ReplaceAll(stub.Name, "/", ".")
+	simpleName := dotName[strings.LastIndex(dotName, ".") + 1:]
+	javaSimpleName := simpleName[strings.LastIndex(simpleName, "$") + 1:]
+	funcPrefix := strings.ReplaceAll(simpleName, "$", "")
+
+	var goFuncs, registrations, javaMembers strings.Builder
+	usedNames := make(map[string]int)
+
+	for _, method := range stub.Methods {
+		if "<clinit>" == method.Name || method.Flags & (accflag.Public | accflag.Protected) == 0 {
+			continue
+		}
+
+		argTypes, retType := class.ParseMethodDescriptor(method.Descriptor)
+		params := make([]string, len(argTypes))
+		for ix, arg := range argTypes {
+			params[ix] = fmt.Sprintf("%s a%d", javaTypeName(arg), ix)
+		}
+		paramList := strings.Join(params, ", ")
+		modifiers := javaModifiers(method.Flags)
+
+		if method.Flags & accflag.Abstarct > 0 {
+			if stub.IsInterface {
+				fmt.Fprintf(&javaMembers, "    %s %s(%s);\n\n", javaTypeName(retType), method.Name, paramList)
+			} else {
+				fmt.Fprintf(&javaMembers, "    %sabstract %s %s(%s);\n\n", modifiers, javaTypeName(retType), method.Name, paramList)
+			}
+			continue
+		}
+
+		// 接口中不能有native方法, static和default方法需要手工实现
+		if stub.IsInterface {
+			fmt.Fprintf(&javaMembers, "    // TODO: %s%s\n\n", method.Name, method.Descriptor)
+			continue
+		}
+
+		nativeName := method.Name
+		if "<init>" == method.Name {
+			// 构造方法: public Foo(int a0) { init0(a0); }
+			nativeName = "init0"
+			args := make([]string, len(argTypes))
+			for ix := range argTypes {
+				args[ix] = fmt.Sprintf("a%d", ix)
+			}
+			fmt.Fprintf(&javaMembers, "    %s%s(%s) {\n        init0(%s);\n    }\n\n", modifiers, javaSimpleName, paramList, strings.Join(args, ", "))
+			fmt.Fprintf(&javaMembers, "    private native void init0(%s);\n\n", paramList)
+		} else {
+			fmt.Fprintf(&javaMembers, "    %snative %s %s(%s);\n\n", modifiers, javaTypeName(retType), method.Name, paramList)
+		}
+
+		// 重载的方法加上序号区分
+		funcName := funcPrefix + strings.ToUpper(nativeName[:1]) + nativeName[1:]
+		usedNames[funcName]++
+		if count := usedNames[funcName]; count > 1 {
+			funcName = fmt.Sprintf("%s%d", funcName, count)
+		}
+		descriptor := method.Descriptor
+
+		if "<init>" == method.Name {
+			modifiers = "private "
+		}
+		fmt.Fprintf(&goFuncs, "// %s%s %s(%s)\n", modifiers, javaTypeName(retType), nativeName, paramList)
+		fmt.Fprintf(&goFuncs, "func %s(args ...interface{}) interface{} {\n", funcName)
+		fmt.Fprintf(&goFuncs, "\t// TODO: args[0]为*MiniJvm, args[1]为接收者, 方法参数从args[2]开始\n")
+		fmt.Fprintf(&goFuncs, "\treturn fmt.Errorf(\"java.lang.UnsupportedOperationException: %s.%s%s\")\n}\n\n", dotName, nativeName, descriptor)
+
+		fmt.Fprintf(&registrations, "//\tnativeMethodTable.RegisterMethod(\"%s\", \"%s\", \"%s\", %s)\n", dotName, nativeName, descriptor, funcName)
+	}
+
+	var goSource strings.Builder
+	goSource.WriteString("package vm\n\nimport (\n\t\"fmt\"\n)\n\n")
+	fmt.Fprintf(&goSource, "// %s的本地方法, 由stubgen生成\n", dotName)
+	goSource.WriteString("// 在newBuiltinNativeMethodTable()中注册:\n")
+	goSource.WriteString(registrations.String())
+	goSource.WriteString("\n")
+	goSource.WriteString(goFuncs.String())
+
+	var javaSource strings.Builder
+	if ix := strings.LastIndex(dotName, "."); ix > 0 {
+		fmt.Fprintf(&javaSource, "package %s;\n\n", dotName[:ix])
+	}
+	fmt.Fprintf(&javaSource, "// 由stubgen生成, 方法由mini-jvm的go代码实现\n")
+	javaSource.WriteString(javaClassHeader(stub, javaSimpleName))
+	javaSource.WriteString(" {\n\n")
+	javaSource.WriteString(javaMembers.String())
+	javaSource.WriteString("}\n")
+
+	return &Stubs{GoSource: goSource.String(), JavaSource: javaSource.String()}
+}
+
+func javaClassHeader(stub *StubClass, simpleName string) string {
+	interfaces := make([]string, len(stub.Interfaces))
+	for ix, name := range stub.Interfaces {
+		interfaces[ix] = strings.ReplaceAll(strings.ReplaceAll(name, "/", "."), "$", ".")
+	}
+
+	if stub.IsInterface {
+		header := "public interface " + simpleName
+		if len(interfaces) > 0 {
+			header += " extends " + strings.Join(interfaces, ", ")
+		}
+		return header
+	}
+
+	header := "public class " + simpleName
+	if stub.IsAbstract {
+		header = "public abstract class " + simpleName
+	}
+	if "" != stub.SuperName && "java/lang/Object" != stub.SuperName {
+		header += " extends " + strings.ReplaceAll(strings.ReplaceAll(stub.SuperName, "/", "."), "$", ".")
+	}
+	if len(interfaces) > 0 {
+		header += " implements " + strings.Join(interfaces, ", ")
+	}
+
+	return header
+}
+
+func javaModifiers(flags uint16) string {
+	modifiers := ""
+	switch {
+	case flags & accflag.Public > 0:
+		modifiers = "public "
+	case flags & accflag.Protected > 0:
+		modifiers = "protected "
+	}
+	if flags & accflag.Static > 0 {
+		modifiers += "static "
+	}
+
+	return modifiers
+}
+
+// 描述符中的类型转换成java源码中的类型, 如[[Ljava/lang/String -> java.lang.String[][]
+func javaTypeName(desc string) string {
+	dims := strings.Count(desc, "[")
+	base := strings.TrimLeft(desc, "[")
+
+	name := map[string]string{
+		"B": "byte", "C": "char", "D": "double", "F": "float", "I": "int",
+		"J": "long", "S": "short", "Z": "boolean", "V": "void",
+	}[base]
+	if "" == name {
+		name = strings.ReplaceAll(strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(base, "L"), ";"), "/", "."), "$", ".")
+	}
+
+	return name + strings.Repeat("[]", dims)
+}
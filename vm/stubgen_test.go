@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+const testJavapOutput = `Compiled from "ArrayList.java"
+public class java.util.ArrayList<E> extends java.util.AbstractList<E> implements java.util.List<E>, java.util.RandomAccess {
+  private static final int DEFAULT_CAPACITY;
+    descriptor: I
+  public java.util.ArrayList(int);
+    descriptor: (I)V
+  public boolean add(E);
+    descriptor: (Ljava/lang/Object;)Z
+  public void add(int, E);
+    descriptor: (ILjava/lang/Object;)V
+  public <T> T[] toArray(T[]);
+    descriptor: ([Ljava/lang/Object;)[Ljava/lang/Object;
+  private void grow(int);
+    descriptor: (I)V
+  static {};
+    descriptor: ()V
+}
+`
+
+func TestParseJavapOutput(t *testing.T) {
+	stub, err := ParseJavapOutput(strings.NewReader(testJavapOutput))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "java/util/ArrayList" != stub.Name || "java/util/AbstractList" != stub.SuperName || 2 != len(stub.Interfaces) {
+		t.Fatalf("unexpected class header %+v", stub)
+	}
+	if 6 != len(stub.Methods) || "<init>" != stub.Methods[0].Name || "(I)V" != stub.Methods[0].Descriptor {
+		t.Fatalf("unexpected methods %+v", stub.Methods)
+	}
+
+	// 没有-s时没有描述符
+	if _, err := ParseJavapOutput(strings.NewReader("public class Foo {\n  public void bar();\n}\n")); nil == err {
+		t.Fatal("javap output without descriptors should fail")
+	}
+}
+
+func TestGenerateStubs(t *testing.T) {
+	stub, _ := ParseJavapOutput(strings.NewReader(testJavapOutput))
+	stubs := GenerateStubs(stub)
+
+	for _, expected := range []string{
+		`nativeMethodTable.RegisterMethod("java.util.ArrayList", "init0", "(I)V", ArrayListInit0)`,
+		`nativeMethodTable.RegisterMethod("java.util.ArrayList", "add", "(Ljava/lang/Object;)Z", ArrayListAdd)`,
+		`nativeMethodTable.RegisterMethod("java.util.ArrayList", "add", "(ILjava/lang/Object;)V", ArrayListAdd2)`,
+		"func ArrayListToArray(args ...interface{}) interface{} {",
+	} {
+		if !strings.Contains(stubs.GoSource, expected) {
+			t.Fatalf("missing '%s' in go source:\n%s", expected, stubs.GoSource)
+		}
+	}
+	if strings.Contains(stubs.GoSource, "grow") {
+		t.Fatal("private methods should be skipped")
+	}
+
+	for _, expected := range []string{
+		"package java.util;",
+		"public class ArrayList extends java.util.AbstractList implements java.util.List, java.util.RandomAccess {",
+		"    public ArrayList(int a0) {\n        init0(a0);\n    }",
+		"    public native boolean add(java.lang.Object a0);",
+		"    public native java.lang.Object[] toArray(java.lang.Object[] a0);",
+	} {
+		if !strings.Contains(stubs.JavaSource, expected) {
+			t.Fatalf("missing '%s' in java source:\n%s", expected, stubs.JavaSource)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"strings"
+	"testing"
+)
+
+func TestTableswitch(t *testing.T) {
+	// static int calc(int x) { switch (x) { case -1: return 10; case 0: return 20; case 1: return 30; default: return 40; } }
+	// switch之前的指令长度为1到4字节, 覆盖所有padding
+	for _, prefix := range [][]byte{
+		{bcode.Iload0}, {bcode.Iload, 0}, {bcode.Iconst0, bcode.Pop, bcode.Iload0}, {bcode.Iconst0, bcode.Pop, bcode.Iload, 0},
+	} {
+		code := newCodeAssembler().emit(prefix...).
+			tableswitch(-1, "default", "minus", "zero", "one").
+			label("minus").emit(bcode.Bipush, 10, bcode.Ireturn).
+			label("zero").emit(bcode.Bipush, 20, bcode.Ireturn).
+			label("one").emit(bcode.Bipush, 30, bcode.Ireturn).
+			label("default").emit(bcode.Bipush, 40, bcode.Ireturn)
+
+		for _, c := range []struct {
+			x, expect int
+		}{
+			{-1, 10}, {0, 20}, {1, 30}, {2, 40}, {-2, 40}, {1 << 30, 40},
+		} {
+			ret, err := runCalc(t, "(I)I", 1, code, c.x)
+			if nil != err || c.expect != ret {
+				t.Errorf("switch at pc %d, x = %d: expect %d, got %v, %v", len(prefix), c.x, c.expect, ret, err)
+			}
+		}
+	}
+
+	// 反汇编显示每个值的目标pc
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(0, "calc", "(I)I", 1, 1, newCodeAssembler().emit(bcode.Iload0).
+		tableswitch(1, "default", "one", "two").
+		label("one").label("two").emit(bcode.Iconst1, bcode.Ireturn).
+		label("default").emit(bcode.Iconst0, bcode.Ireturn))
+	var out bytes.Buffer
+	if err := DisassembleClass(&out, b.def); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1: tableswitch {1: 24, 2: 24, default: 26}") {
+		t.Fatalf("unexpected disassembly\n%s", out.String())
+	}
+}
+
+func TestLookupswitch(t *testing.T) {
+	// static int calc(int x) { switch (x) { case -1000: return 10; case 3: return 20; case 1 << 20: return 30; default: return 40; } }
+	for _, prefix := range [][]byte{
+		{bcode.Iload0}, {bcode.Iload, 0}, {bcode.Iconst0, bcode.Pop, bcode.Iload0}, {bcode.Iconst0, bcode.Pop, bcode.Iload, 0},
+	} {
+		code := newCodeAssembler().emit(prefix...).
+			lookupswitch("default", []int32{-1000, 3, 1 << 20}, []string{"a", "b", "c"}).
+			label("a").emit(bcode.Bipush, 10, bcode.Ireturn).
+			label("b").emit(bcode.Bipush, 20, bcode.Ireturn).
+			label("c").emit(bcode.Bipush, 30, bcode.Ireturn).
+			label("default").emit(bcode.Bipush, 40, bcode.Ireturn)
+
+		for _, c := range []struct {
+			x, expect int
+		}{
+			{-1000, 10}, {3, 20}, {1 << 20, 30}, {0, 40}, {4, 40}, {-1, 40},
+		} {
+			ret, err := runCalc(t, "(I)I", 1, code, c.x)
+			if nil != err || c.expect != ret {
+				t.Errorf("switch at pc %d, x = %d: expect %d, got %v, %v", len(prefix), c.x, c.expect, ret, err)
+			}
+		}
+	}
+
+	// 没有case时总是跳到default
+	code := newCodeAssembler().emit(bcode.Iload0).lookupswitch("default", nil, nil).
+		label("default").emit(bcode.Iconst2, bcode.Ireturn)
+	if ret, err := runCalc(t, "(I)I", 1, code, 7); nil != err || 2 != ret {
+		t.Fatalf("expect 2, got %v, %v", ret, err)
+	}
+
+	b := newClassBuilder("com/fh/Calc", "java/lang/Object")
+	b.method(0, "calc", "(I)I", 1, 1, newCodeAssembler().emit(bcode.Iload0).
+		lookupswitch("default", []int32{-5, 100}, []string{"one", "two"}).
+		label("one").emit(bcode.Iconst1, bcode.Ireturn).
+		label("two").emit(bcode.Iconst2, bcode.Ireturn).
+		label("default").emit(bcode.Iconst0, bcode.Ireturn))
+	var out bytes.Buffer
+	if err := DisassembleClass(&out, b.def); nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1: lookupswitch {-5: 28, 100: 30, default: 32}") {
+		t.Fatalf("unexpected disassembly\n%s", out.String())
+	}
+}
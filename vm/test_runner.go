@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 一个测试类的执行结果, main方法正常返回即为通过
+type TestResult struct {
+	ClassName string
+
+	// 没有通过时的错误, 包括没有捕获的异常
+	Err error
+
+	Duration time.Duration
+}
+
+// 找出classpath中类名以Test结尾并且有main方法的类
+func ListTestClasses(classPaths []string, options *ClassPathOptions) ([]string, error) {
+	jvm := &MiniJvm{ClassPathOptions: options, stats: new(vmStats)}
+	ma, err := NewMethodArea(jvm, classPaths, nil)
+	if nil != err {
+		return nil, fmt.Errorf("unabled to create method area: %w", err)
+	}
+
+	names, err := ma.ListClassNames()
+	if nil != err {
+		return nil, err
+	}
+
+	testClasses := make([]string, 0, len(names))
+	for _, name := range names {
+		if !strings.HasSuffix(name, "Test") {
+			continue
+		}
+
+		def, err := ma.ParseClass(name)
+		if nil != err || !hasMainMethod(def) {
+			continue
+		}
+		testClasses = append(testClasses, name)
+	}
+	sort.Strings(testClasses)
+
+	return testClasses, nil
+}
+
+// 每个测试类使用独立的虚拟机执行, 互不影响static字段;
+// configure用于在执行前设置虚拟机, 可以为nil
+func RunTests(classPaths []string, options *ClassPathOptions, classNames []string, configure func(jvm *MiniJvm)) []*TestResult {
+	results := make([]*TestResult, 0, len(classNames))
+	for _, name := range classNames {
+		result := &TestResult{ClassName: name}
+		start := time.Now()
+
+		jvm, err := NewMiniJvmWithOptions(name, classPaths, options)
+		if nil == err {
+			if nil != configure {
+				configure(jvm)
+			}
+			err = jvm.Start()
+		}
+
+		result.Err = err
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func hasMainMethod(def *class.DefFile) bool {
+	for _, method := range def.Methods {
+		name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+		descriptor := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+		if "main" == name && "([Ljava/lang/String;)V" == descriptor && method.AccessFlags & accflag.Static > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"sync/atomic"
+)
+
+// 每个guest线程的资源限制, 字段为0表示不限制该项;
+// go无法测量单个goroutine的CPU时间, 用执行的字节码条数代替
+type ThreadLimits struct {
+	// 线程最多执行的字节码条数
+	MaxInstructions int64
+	// 线程最多分配的对象和数组个数(new, newarray, anewarray)
+	MaxAllocations int64
+}
+
+// 线程的资源消耗
+type ThreadUsage struct {
+	ThreadID     int64
+	Instructions int64
+	Allocations  int64
+}
+
+// 线程资源消耗的计数器, 同一线程的所有栈帧共享
+type threadUsage struct {
+	threadID     int64
+	instructions int64
+	allocations  int64
+}
+
+// 超过线程资源限制时返回, 只终止超限的线程
+type ThreadLimitExceededError struct {
+	ThreadID int64
+	// instructions或allocations
+	Resource string
+	Limit    int64
+}
+
+func (e ThreadLimitExceededError) Error() string {
+	return fmt.Sprintf("java.lang.VirtualMachineError: thread %d exceeded %s limit %d", e.ThreadID, e.Resource, e.Limit)
+}
+
+// 执行每条字节码前调用
+func (u *threadUsage) onByteCode(code byte, limits *ThreadLimits) error {
+	instructions := atomic.AddInt64(&u.instructions, 1)
+	if limits.MaxInstructions > 0 && instructions > limits.MaxInstructions {
+		return &ThreadLimitExceededError{ThreadID: u.threadID, Resource: "instructions", Limit: limits.MaxInstructions}
+	}
+
+	switch code {
+	case bcode.New, bcode.Newarray, bcode.Anewarray, bcode.Multianewarray:
+		allocations := atomic.AddInt64(&u.allocations, 1)
+		if limits.MaxAllocations > 0 && allocations > limits.MaxAllocations {
+			return &ThreadLimitExceededError{ThreadID: u.threadID, Resource: "allocations", Limit: limits.MaxAllocations}
+		}
+	}
+
+	return nil
+}
+
+// 栈帧所在线程的计数器, 结果缓存在栈帧中, 调用链上的栈帧只需查找一次
+func (m *MiniJvm) threadUsageOf(frame *MethodStackFrame) *threadUsage {
+	if nil != frame.usage {
+		return frame.usage
+	}
+
+	if nil != frame.prevFrame {
+		frame.usage = m.threadUsageOf(frame.prevFrame)
+		return frame.usage
+	}
+
+	usage, _ := m.threadUsages.LoadOrStore(frame.threadID, &threadUsage{threadID: frame.threadID})
+	frame.usage = usage.(*threadUsage)
+	return frame.usage
+}
+
+// 查询线程的资源消耗, 只有设置了ThreadLimits才会统计
+func (m *MiniJvm) ThreadUsage(threadID int64) (*ThreadUsage, bool) {
+	usage, ok := m.threadUsages.Load(threadID)
+	if !ok {
+		return nil, false
+	}
+
+	return usage.(*threadUsage).snapshot(), true
+}
+
+// 所有线程(包括已经结束的)的资源消耗
+func (m *MiniJvm) AllThreadUsage() []*ThreadUsage {
+	var res []*ThreadUsage
+	m.threadUsages.Range(func(key, value interface{}) bool {
+		res = append(res, value.(*threadUsage).snapshot())
+		return true
+	})
+
+	return res
+}
+
+func (u *threadUsage) snapshot() *ThreadUsage {
+	return &ThreadUsage{
+		ThreadID:     u.threadID,
+		Instructions: atomic.LoadInt64(&u.instructions),
+		Allocations:  atomic.LoadInt64(&u.allocations),
+	}
+}
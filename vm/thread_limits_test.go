@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"testing"
+)
+
+func TestThreadLimits(t *testing.T) {
+	b := newClassBuilder("com/fh/Spin", "java/lang/Object")
+	// while (true) {}
+	spin := newCodeAssembler().
+		label("loop").
+		jump(bcode.Goto, "loop")
+	b.method(accflag.Static, "spin", "()V", 0, 0, spin)
+	// for (int i = 0; i < 10; i++) { new Spin(); }
+	alloc := newCodeAssembler().
+		emit(bcode.Iconst0, bcode.Istore0).
+		label("loop").
+		emit(bcode.Iload0).
+		emit(bcode.Bipush, 10).
+		jump(bcode.Ificmpge, "end").
+		emitIndex(bcode.New, b.classRef("com/fh/Spin")).
+		emit(bcode.Pop).
+		emit(bcode.Iinc, 0, 1).
+		jump(bcode.Goto, "loop").
+		label("end").
+		emit(bcode.Return)
+	b.method(accflag.Static, "alloc", "()V", 2, 1, alloc)
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.ThreadLimits = &ThreadLimits{MaxInstructions: 1000, MaxAllocations: 5}
+
+	// 每个线程单独计数, 超限的线程返回错误
+	spinFrame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+	err = jvm.ExecutionEngine.ExecuteWithFrame(b.def, "spin", "()V", spinFrame, false)
+	var exceeded *ThreadLimitExceededError
+	if !errors.As(err, &exceeded) || "instructions" != exceeded.Resource {
+		t.Fatalf("expect instructions limit exceeded, got %v", err)
+	}
+
+	allocFrame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+	err = jvm.ExecutionEngine.ExecuteWithFrame(b.def, "alloc", "()V", allocFrame, false)
+	if !errors.As(err, &exceeded) || "allocations" != exceeded.Resource || allocFrame.threadID != exceeded.ThreadID {
+		t.Fatalf("expect allocations limit exceeded, got %v", err)
+	}
+
+	usage, ok := jvm.ThreadUsage(spinFrame.threadID)
+	if !ok || 1001 != usage.Instructions || 0 != usage.Allocations {
+		t.Fatalf("unexpected spin usage %+v", usage)
+	}
+	usage, ok = jvm.ThreadUsage(allocFrame.threadID)
+	if !ok || 6 != usage.Allocations {
+		t.Fatalf("unexpected alloc usage %+v", usage)
+	}
+	if 2 != len(jvm.AllThreadUsage()) {
+		t.Fatalf("unexpected thread usages %v", jvm.AllThreadUsage())
+	}
+
+	// 没有超限的线程正常结束
+	jvm.ThreadLimits.MaxAllocations = 0
+	okFrame := &MethodStackFrame{opStack: NewOpStack(0), threadID: nextThreadID()}
+	if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, "alloc", "()V", okFrame, false); nil != err {
+		t.Fatal(err)
+	}
+	if usage, _ := jvm.ThreadUsage(okFrame.threadID); 10 != usage.Allocations {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
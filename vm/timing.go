@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// 一个阶段(预热或稳定运行)的计时统计
+type PhaseTiming struct {
+	Iterations int
+	WallTime   time.Duration
+	// 单次调用的最短和最长耗时
+	Fastest time.Duration
+	Slowest time.Duration
+
+	// 执行的字节码条数, 包括这期间其他线程执行的字节码
+	ByteCodes int64
+	// 宿主(go)的内存分配次数和字节数
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+// 单次调用的平均耗时
+func (p *PhaseTiming) PerIteration() time.Duration {
+	if 0 == p.Iterations {
+		return 0
+	}
+
+	return p.WallTime / time.Duration(p.Iterations)
+}
+
+func (p *PhaseTiming) String() string {
+	return fmt.Sprintf("%d iterations, %v (%v/op, fastest %v, slowest %v), %d bytecodes, %d allocs, %d bytes",
+		p.Iterations, p.WallTime, p.PerIteration(), p.Fastest, p.Slowest, p.ByteCodes, p.Allocs, p.AllocBytes)
+}
+
+// ExecuteTimed的结果, 预热和稳定运行分开统计
+type TimedResult struct {
+	WarmUp PhaseTiming
+	Steady PhaseTiming
+
+	// 最后一次调用的返回值, void方法为nil
+	Return interface{}
+}
+
+// 先调用warmUp次static方法预热, 再调用iterations次测量稳定状态的性能;
+// args为方法参数, 类型与操作数栈上的表示一致(int, *class.Reference等)
+func (m *MiniJvm) ExecuteTimed(className string, methodName string, descriptor string, args []interface{}, warmUp int, iterations int) (*TimedResult, error) {
+	def, err := m.MethodArea.LoadClass(strings.ReplaceAll(className, ".", "/"))
+	if nil != err {
+		return nil, fmt.Errorf("failed to load class '%s': %w", className, err)
+	}
+
+	result := new(TimedResult)
+	if err := m.measurePhase(&result.WarmUp, def, methodName, descriptor, args, warmUp, &result.Return); nil != err {
+		return nil, fmt.Errorf("warm-up failed: %w", err)
+	}
+	if err := m.measurePhase(&result.Steady, def, methodName, descriptor, args, iterations, &result.Return); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (m *MiniJvm) measurePhase(phase *PhaseTiming, def *class.DefFile, methodName string, descriptor string, args []interface{}, iterations int, ret *interface{}) error {
+	if 0 == iterations {
+		return nil
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	byteCodes := m.Stats().TotalByteCodes()
+
+	for ix := 0; ix < iterations; ix++ {
+		// 参数和返回值都放在调用者栈帧的操作数栈上
+		frame := newMethodStackFrame(len(args) + 1, 0)
+		for _, arg := range args {
+			frame.opStack.Push(arg)
+		}
+
+		start := time.Now()
+		err := m.ExecutionEngine.ExecuteWithFrame(def, methodName, descriptor, frame, false)
+		elapsed := time.Since(start)
+		if nil != err {
+			return err
+		}
+
+		phase.Iterations++
+		phase.WallTime += elapsed
+		if 0 == phase.Fastest || elapsed < phase.Fastest {
+			phase.Fastest = elapsed
+		}
+		if elapsed > phase.Slowest {
+			phase.Slowest = elapsed
+		}
+
+		*ret = nil
+		if !strings.HasSuffix(descriptor, ")V") {
+			*ret, _ = frame.opStack.Pop()
+		}
+	}
+
+	runtime.ReadMemStats(&after)
+	phase.ByteCodes = m.Stats().TotalByteCodes() - byteCodes
+	phase.Allocs = after.Mallocs - before.Mallocs
+	phase.AllocBytes = after.TotalAlloc - before.TotalAlloc
+
+	return nil
+}
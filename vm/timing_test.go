@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"testing"
+)
+
+func TestExecuteTimed(t *testing.T) {
+	jvm, err := FindBenchmark("fib").newJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	result, err := jvm.ExecuteTimed("cn.minijvm.bench.Main", "fib", "(I)I", []interface{}{10}, 3, 5)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 55 != result.Return {
+		t.Fatalf("unexpected return value %v", result.Return)
+	}
+	if 3 != result.WarmUp.Iterations || 5 != result.Steady.Iterations {
+		t.Fatalf("unexpected iterations %d, %d", result.WarmUp.Iterations, result.Steady.Iterations)
+	}
+	// 每次调用执行的字节码相同
+	if result.Steady.ByteCodes <= 0 || result.WarmUp.ByteCodes * 5 != result.Steady.ByteCodes * 3 {
+		t.Fatalf("unexpected bytecodes %d, %d", result.WarmUp.ByteCodes, result.Steady.ByteCodes)
+	}
+	if result.Steady.Fastest > result.Steady.Slowest || result.Steady.PerIteration() > result.Steady.Slowest {
+		t.Fatalf("unexpected timing %v", &result.Steady)
+	}
+
+	if _, err := jvm.ExecuteTimed("cn.minijvm.bench.Nope", "fib", "(I)I", nil, 0, 1); nil == err {
+		t.Fatal("missing class should fail")
+	}
+}
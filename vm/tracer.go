@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 解释器指令追踪;
+// 长时间运行的程序逐条追踪的输出太多, 可以按条数或时间采样, 也可以只在指定方法执行期间追踪
+type Tracer struct {
+	// 每N条指令输出一条, 小于等于1时每条都输出
+	Every int64
+	// 两次输出之间的最小间隔, 0表示不限制
+	Interval time.Duration
+
+	// 追踪窗口, 格式为 类全名.方法名, 类名用.或/分隔, 以*结尾表示前缀匹配, 如com.fh.Foo.*;
+	// Start为空时从头开始追踪; 进入匹配Start的方法时打开窗口,
+	// 匹配Stop的方法返回时关闭窗口, Stop为空时匹配Start的方法全部返回后关闭
+	Start string
+	Stop  string
+
+	Out io.Writer
+	// 同时输出指令执行前的操作数栈, 对象用Renderer显示
+	ShowStack bool
+	// 为nil时使用DefaultObjectRenderer
+	Renderer *ObjectRenderer
+
+	// 已经执行的指令条数(只统计窗口内的)
+	counter int64
+	// 上一次输出的时间, UnixNano
+	lastTrace int64
+	// Stop为空时为窗口内匹配Start的方法的调用层数, 否则大于0表示窗口打开
+	window int32
+
+	outLock sync.Mutex
+}
+
+func NewTracer(out io.Writer) *Tracer {
+	return &Tracer{Out: out}
+}
+
+// 追踪窗口是否打开
+func (t *Tracer) Active() bool {
+	return "" == t.Start || atomic.LoadInt32(&t.window) > 0
+}
+
+func (t *Tracer) onMethodEnter(className string, methodName string) {
+	if "" == t.Start || !matchMethodPattern(t.Start, className, methodName) {
+		return
+	}
+
+	if "" == t.Stop {
+		atomic.AddInt32(&t.window, 1)
+	} else {
+		atomic.StoreInt32(&t.window, 1)
+	}
+}
+
+func (t *Tracer) onMethodExit(className string, methodName string) {
+	if "" == t.Start {
+		return
+	}
+
+	if "" == t.Stop {
+		if matchMethodPattern(t.Start, className, methodName) {
+			atomic.AddInt32(&t.window, -1)
+		}
+		return
+	}
+
+	if matchMethodPattern(t.Stop, className, methodName) {
+		atomic.StoreInt32(&t.window, 0)
+	}
+}
+
+// 每条指令执行前调用, 按采样规则决定是否输出
+func (t *Tracer) onInstruction(frame *MethodStackFrame, byteCode byte) {
+	if !t.Active() {
+		return
+	}
+
+	seq := atomic.AddInt64(&t.counter, 1)
+	if t.Every > 1 && 0 != seq % t.Every {
+		return
+	}
+
+	if t.Interval > 0 {
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&t.lastTrace)
+		if now - last < int64(t.Interval) || !atomic.CompareAndSwapInt64(&t.lastTrace, last, now) {
+			return
+		}
+	}
+
+	elem := frame.stackTraceElement()
+	stack := ""
+	if t.ShowStack {
+		stack = " stack " + t.renderStack(frame.opStack)
+	}
+
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	fmt.Fprintf(t.Out, "[trace] #%d thread %d depth %d %s.%s%s pc %d: %s%s\n", seq, frame.ThreadID(), frame.Depth(),
+		elem.ClassName, elem.MethodName, elem.MethodDescriptor, frame.pc, bcode.ToName(byteCode), stack)
+}
+
+// 操作数栈的文本, 从栈底到栈顶, 如[1, "abc", com.fh.Foo@1f{x=1}]
+func (t *Tracer) renderStack(stack *OpStack) string {
+	renderer := t.Renderer
+	if nil == renderer {
+		renderer = DefaultObjectRenderer
+	}
+
+	elems := stack.Elements()
+	texts := make([]string, len(elems))
+	for ix, elem := range elems {
+		texts[ix] = renderer.Render(elem)
+	}
+
+	return "[" + strings.Join(texts, ", ") + "]"
+}
+
+// 方法是否匹配 类全名.方法名 格式的模式
+func matchMethodPattern(pattern string, className string, methodName string) bool {
+	pattern = strings.ReplaceAll(pattern, "/", ".")
+	fullName := strings.ReplaceAll(className, "/", ".") + "." + methodName
+
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(fullName, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return pattern == fullName
+}
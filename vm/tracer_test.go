@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runTracedFib(t *testing.T, tracer *Tracer) (lines []string, byteCodes int64) {
+	jvm, err := FindBenchmark("fib").newJvm()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	tracer.Out = out
+	jvm.Tracer = tracer
+
+	timed, err := jvm.ExecuteTimed(benchMainClass, "run", "(I)I", []interface{}{1}, 0, 1)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return strings.Split(strings.TrimSpace(out.String()), "\n"), timed.Steady.ByteCodes
+}
+
+func TestTracerSampling(t *testing.T) {
+	lines, byteCodes := runTracedFib(t, &Tracer{Every: 100})
+	if int64(len(lines)) != byteCodes / 100 {
+		t.Fatalf("expect %d lines, got %d", byteCodes / 100, len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "[trace] #100 thread ") {
+		t.Fatalf("unexpected line %q", lines[0])
+	}
+}
+
+func TestTracerWindow(t *testing.T) {
+	// fib递归调用自己, 最外层的fib返回后才关闭窗口
+	lines, _ := runTracedFib(t, &Tracer{Start: "cn.minijvm.bench.Main.fib"})
+	for _, line := range lines {
+		if !strings.Contains(line, ".fib(I)I pc ") {
+			t.Fatalf("traced outside window: %q", line)
+		}
+	}
+	if !strings.HasSuffix(lines[len(lines) - 1], ": ireturn") {
+		t.Fatalf("window closed too early: %q", lines[len(lines) - 1])
+	}
+
+	// run中的指令只有调用fib之前的部分不输出
+	lines, _ = runTracedFib(t, &Tracer{Start: "cn/minijvm/bench/Main.fib", Stop: "cn/minijvm/bench/Main.run"})
+	if last := lines[len(lines) - 1]; !strings.Contains(last, ".run(I)I pc ") || !strings.HasSuffix(last, ": ireturn") {
+		t.Fatalf("window should stay open until run returns: %q", last)
+	}
+}
+
+func TestMatchMethodPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		match   bool
+	}{
+		{"com.fh.Foo.bar", true},
+		{"com/fh/Foo.bar", true},
+		{"com.fh.Foo.*", true},
+		{"com.fh.*", true},
+		{"com.fh.Foo.baz", false},
+		{"com.fh.Foo", false},
+	}
+
+	for _, c := range cases {
+		if c.match != matchMethodPattern(c.pattern, "com/fh/Foo", "bar") {
+			t.Fatalf("unexpected result for '%s'", c.pattern)
+		}
+	}
+}
+
+func TestTracerShowStack(t *testing.T) {
+	lines, _ := runTracedFib(t, &Tracer{ShowStack: true, Start: "cn.minijvm.bench.Main.fib"})
+	// fib(n)的第一条指令执行前栈为空
+	if !strings.HasSuffix(lines[0], ": iload_0 stack []") {
+		t.Fatalf("unexpected line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], ": iconst_2 stack [") || strings.HasSuffix(lines[1], "[]") {
+		t.Fatalf("unexpected line %q", lines[1])
+	}
+}
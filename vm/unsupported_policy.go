@@ -0,0 +1,251 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/utils"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 虚拟机尚未实现的功能类别
+const (
+	// 解释器不支持且没有注册插件的字节码
+	UnsupportedOpcode = "opcode"
+	// 没有注册实现的本地方法
+	UnsupportedNative = "native"
+	// class文件中不认识的属性
+	UnsupportedAttribute = "attribute"
+)
+
+// 遇到未实现的功能时的处理方式
+type UnsupportedAction int
+
+const (
+	// 报错终止, 与没有配置策略时相同
+	UnsupportedFail UnsupportedAction = iota
+	// 输出警告后继续: 字节码放弃执行当前方法并返回默认值, 本地方法返回默认值, 属性被忽略
+	UnsupportedSkip
+	// 交给Hook处理
+	UnsupportedCallHook
+)
+
+// 一次遇到的未实现功能
+type UnsupportedGap struct {
+	Feature string
+	// 字节码为助记符, 本地方法为 类名.方法名描述符, 属性为 类名:属性名
+	Name string
+
+	// 字节码所在的栈帧, 其他类别为nil
+	Frame *MethodStackFrame
+	// 本地方法的参数, 不含jvm指针和接收者
+	Args []interface{}
+}
+
+func (g *UnsupportedGap) String() string {
+	return g.Feature + " " + g.Name
+}
+
+// 遇到未实现的功能时的处理策略, 可以按类别分别配置;
+// 对大量代码做覆盖调查时, 用UnsupportedSkip跳过缺口继续执行, 结束后从Gaps()得到所有遇到过的缺口
+type UnsupportedPolicy struct {
+	lock sync.Mutex
+
+	// 没有单独配置的类别使用的处理方式
+	defaultAction UnsupportedAction
+	actions map[string]UnsupportedAction
+
+	// 处理方式为UnsupportedCallHook时调用; 返回的值作为字节码所在方法或本地方法的返回值, 为nil时使用默认值,
+	// 属性的返回值被忽略; 返回错误时按UnsupportedFail处理. 为nil时报错
+	Hook func(jvm *MiniJvm, gap *UnsupportedGap) (interface{}, error)
+
+	// key: UnsupportedGap.String(), val: 遇到的次数
+	gaps map[string]int
+}
+
+func NewUnsupportedPolicy(defaultAction UnsupportedAction) *UnsupportedPolicy {
+	return &UnsupportedPolicy{
+		defaultAction: defaultAction,
+		actions:       make(map[string]UnsupportedAction),
+		gaps:          make(map[string]int),
+	}
+}
+
+// 设置某个类别的处理方式
+func (p *UnsupportedPolicy) Set(feature string, action UnsupportedAction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.actions[feature] = action
+}
+
+// 记录一次缺口, 返回处理方式以及是否第一次遇到
+func (p *UnsupportedPolicy) record(gap *UnsupportedGap) (UnsupportedAction, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := gap.String()
+	p.gaps[key]++
+
+	action, ok := p.actions[gap.Feature]
+	if !ok {
+		action = p.defaultAction
+	}
+
+	return action, 1 == p.gaps[key]
+}
+
+// 遇到过的缺口, 按次数从多到少排列
+func (p *UnsupportedPolicy) Gaps() []UnsupportedGapCount {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	result := make([]UnsupportedGapCount, 0, len(p.gaps))
+	for gap, count := range p.gaps {
+		result = append(result, UnsupportedGapCount{Gap: gap, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Gap < result[j].Gap
+	})
+
+	return result
+}
+
+type UnsupportedGapCount struct {
+	Gap   string
+	Count int
+}
+
+// 打印遇到过的缺口, 没有时不输出
+func (p *UnsupportedPolicy) Dump(w io.Writer) {
+	gaps := p.Gaps()
+	if 0 == len(gaps) {
+		return
+	}
+
+	fmt.Fprintf(w, "unsupported features encountered: %d\n", len(gaps))
+	for _, gap := range gaps {
+		fmt.Fprintf(w, "%8d  %s\n", gap.Count, gap.Gap)
+	}
+}
+
+// 按策略处理缺口, 返回替代的值; 返回错误时终止执行, 没有配置策略时返回gapErr
+func (m *MiniJvm) handleUnsupported(gap *UnsupportedGap, gapErr error) (interface{}, error) {
+	policy := m.Unsupported
+	if nil == policy {
+		return nil, gapErr
+	}
+
+	action, first := policy.record(gap)
+	switch action {
+	case UnsupportedSkip:
+		// 同一个缺口只警告一次
+		if first {
+			utils.LogInfoPrintf("unsupported %s, skipped: %v", gap.Feature, gapErr)
+		}
+		return nil, nil
+
+	case UnsupportedCallHook:
+		if nil != policy.Hook {
+			return policy.Hook(m, gap)
+		}
+	}
+
+	return nil, gapErr
+}
+
+// 遇到不支持的本地方法时使用的替代实现, 没有配置策略时返回nil
+func (m *MiniJvm) unsupportedNativeStub(className string, methodName string, descriptor string, gapErr error) *NativeMethodInfo {
+	if nil == m.Unsupported {
+		return nil
+	}
+
+	kind := returnKindOf(descriptor)
+	stub := func(args ...interface{}) interface{} {
+		gap := &UnsupportedGap{
+			Feature: UnsupportedNative,
+			Name:    className + "." + methodName + descriptor,
+			Args:    args[2:],
+		}
+		val, err := m.handleUnsupported(gap, gapErr)
+		if nil != err {
+			return err
+		}
+		if nil == val {
+			return defaultValueOf(kind)
+		}
+
+		return val
+	}
+
+	return &NativeMethodInfo{
+		Name:          methodName,
+		FullClassName: className,
+		Descriptor:    descriptor,
+		EntryFunc:     stub,
+	}
+}
+
+// 类中不认识的属性的处理函数, 没有配置策略时返回nil, 即解析失败
+func (m *MiniJvm) unknownAttrHandler(className string) func(string) error {
+	if nil == m || nil == m.Unsupported {
+		return nil
+	}
+
+	return func(attrName string) error {
+		gap := &UnsupportedGap{Feature: UnsupportedAttribute, Name: className + ":" + attrName}
+		_, err := m.handleUnsupported(gap, fmt.Errorf("unsupported attr type '%s'", attrName))
+		return err
+	}
+}
+
+// 返回类型的默认值
+func defaultValueOf(kind returnKind) interface{} {
+	switch kind {
+	case returnInt:
+		return 0
+	case returnLong:
+		return int64(0)
+	case returnFloat:
+		return float32(0)
+	case returnDouble:
+		return float64(0)
+	}
+
+	return nil
+}
+
+// 解析处理方式配置, 如"skip"表示所有类别都跳过, "opcode=skip,native=fail"为每个类别分别配置
+func ParseUnsupportedPolicy(s string) (*UnsupportedPolicy, error) {
+	actions := map[string]UnsupportedAction{"fail": UnsupportedFail, "skip": UnsupportedSkip}
+	features := map[string]bool{UnsupportedOpcode: true, UnsupportedNative: true, UnsupportedAttribute: true}
+
+	policy := NewUnsupportedPolicy(UnsupportedFail)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if "" == item {
+			continue
+		}
+
+		pair := strings.SplitN(item, "=", 2)
+		action, ok := actions[pair[len(pair) - 1]]
+		if !ok {
+			return nil, fmt.Errorf("invalid action '%s', expect fail or skip", pair[len(pair) - 1])
+		}
+
+		if 1 == len(pair) {
+			policy.defaultAction = action
+			continue
+		}
+		if !features[pair[0]] {
+			return nil, fmt.Errorf("invalid feature '%s', expect opcode, native or attribute", pair[0])
+		}
+		policy.Set(pair[0], action)
+	}
+
+	return policy, nil
+}
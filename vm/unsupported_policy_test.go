@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestUnsupportedPolicy(t *testing.T) {
+	b := newClassBuilder("com/fh/Gaps", "java/lang/Object")
+	// static int opcode() { jsr; ... }
+	b.method(accflag.Static, "opcode", "()I", 1, 0, newCodeAssembler().
+		emit(bcode.Iconst1, 0xa8, 0, 3, bcode.Ireturn))
+	b.method(accflag.Static | accflag.Native, "missing", "(I)J", 0, 1, nil)
+	// static long native() { return missing(3); }
+	b.method(accflag.Static, "native", "()J", 1, 0, newCodeAssembler().
+		emit(bcode.Iconst3).
+		emitIndex(bcode.Invokestatic, b.methodRef("com/fh/Gaps", "missing", "(I)J")).
+		emit(bcode.Lreturn))
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	run := func(name string, desc string) (interface{}, error) {
+		frame := newMethodStackFrame(1, 0)
+		if err := jvm.ExecutionEngine.ExecuteWithFrame(b.def, name, desc, frame, false); nil != err {
+			return nil, err
+		}
+		val, _ := frame.opStack.Pop()
+		return val, nil
+	}
+
+	// 没有策略时报错
+	if _, err := run("opcode", "()I"); nil == err || !strings.Contains(err.Error(), "unsupported byte code") {
+		t.Fatalf("expect unsupported byte code, got %v", err)
+	}
+	if _, err := run("native", "()J"); nil == err || !strings.Contains(err.Error(), "unsupported native method") {
+		t.Fatalf("expect unsupported native method, got %v", err)
+	}
+
+	// 跳过时返回默认值
+	jvm.Unsupported = NewUnsupportedPolicy(UnsupportedSkip)
+	if val, err := run("opcode", "()I"); nil != err || 0 != val {
+		t.Fatalf("expect 0, got %v, %v", val, err)
+	}
+	if val, err := run("native", "()J"); nil != err || int64(0) != val {
+		t.Fatalf("expect 0, got %v, %v", val, err)
+	}
+
+	// hook提供返回值
+	jvm.Unsupported.Set(UnsupportedNative, UnsupportedCallHook)
+	jvm.Unsupported.Hook = func(jvm *MiniJvm, gap *UnsupportedGap) (interface{}, error) {
+		return int64(gap.Args[0].(int) * 10), nil
+	}
+	if val, err := run("native", "()J"); nil != err || int64(30) != val {
+		t.Fatalf("expect 30, got %v, %v", val, err)
+	}
+
+	// 单独配置为报错的类别
+	jvm.Unsupported.Set(UnsupportedOpcode, UnsupportedFail)
+	if _, err := run("opcode", "()I"); nil == err {
+		t.Fatal("opcode should fail")
+	}
+
+	gaps := jvm.Unsupported.Gaps()
+	if 2 != len(gaps) || "native com/fh/Gaps.missing(I)J" != gaps[0].Gap || 2 != gaps[0].Count || 2 != gaps[1].Count {
+		t.Fatalf("unexpected gaps %v", gaps)
+	}
+}
+
+func TestUnsupportedAttribute(t *testing.T) {
+	buf, err := ioutil.ReadFile("../testcase/classes/com/fh/Person.class")
+	if nil != err {
+		t.Fatal(err)
+	}
+	// 把SourceFile属性改成不认识的属性
+	buf = bytes.Replace(buf, []byte("SourceFile"), []byte("XourceFile"), 1)
+
+	jvm := &MiniJvm{}
+	if _, err := class.LoadClassBufWith(buf, jvm.unknownAttrHandler("com/fh/Person")); nil == err {
+		t.Fatal("unknown attribute should fail without policy")
+	}
+
+	jvm.Unsupported, err = ParseUnsupportedPolicy("opcode=fail,attribute=skip")
+	if nil != err {
+		t.Fatal(err)
+	}
+	def, err := class.LoadClassBufWith(buf, jvm.unknownAttrHandler("com/fh/Person"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "com/fh/Person" != def.ExtractFullClassName() {
+		t.Fatalf("unexpected class %s", def.ExtractFullClassName())
+	}
+
+	var out bytes.Buffer
+	jvm.Unsupported.Dump(&out)
+	if !strings.Contains(out.String(), "1  attribute com/fh/Person:XourceFile") {
+		t.Fatalf("unexpected dump:\n%s", out.String())
+	}
+
+	if _, err := ParseUnsupportedPolicy("opcode=ignore"); nil == err {
+		t.Fatal("invalid action should be rejected")
+	}
+}
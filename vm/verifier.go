@@ -0,0 +1,379 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"sort"
+	"strings"
+)
+
+// verify发现的问题类型
+const (
+	VerifyProblemClassFormat         = "class-format"
+	VerifyProblemBadCode             = "bad-code"
+	VerifyProblemUnresolvedClass     = "unresolved-class"
+	VerifyProblemUnresolvedField     = "unresolved-field"
+	VerifyProblemUnresolvedMethod    = "unresolved-method"
+	VerifyProblemUnsupportedByteCode = "unsupported-bytecode"
+	VerifyProblemUnsupportedNative   = "unsupported-native"
+	VerifyProblemRoundTrip           = "round-trip"
+)
+
+// verify发现的一个问题
+type VerifyProblem struct {
+	// 出问题的class全名
+	ClassName string
+	// 出问题的方法, 格式为 方法名:描述符, 与方法无关时为空
+	Method string
+	// 出问题的字节码位置, 与字节码无关时为-1
+	Pc int
+
+	Kind   string
+	Detail string
+}
+
+func (p *VerifyProblem) String() string {
+	location := p.ClassName
+	if "" != p.Method {
+		location += "." + p.Method
+	}
+	if p.Pc >= 0 {
+		location += fmt.Sprintf("@%d", p.Pc)
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", p.Kind, location, p.Detail)
+}
+
+// verify结果
+type VerifyReport struct {
+	// 校验过的class数量
+	ClassCount int
+
+	Problems []*VerifyProblem
+}
+
+// 有问题时生成错误报告, 没有问题时返回nil
+func (r *VerifyReport) ErrorReport() *ErrorReport {
+	if 0 == len(r.Problems) {
+		return nil
+	}
+
+	report := &ErrorReport{
+		ExitCode: ExitVerifyError,
+		Kind:     "verifyError",
+		Message:  fmt.Sprintf("verified %d classes, %d problems", r.ClassCount, len(r.Problems)),
+	}
+	for _, problem := range r.Problems {
+		report.Problems = append(report.Problems, problem.String())
+	}
+
+	return report
+}
+
+// 只做加载和链接检查, 不执行任何字节码(包括<clinit>)
+type Verifier struct {
+	jvm *MiniJvm
+
+	// 已经解析过的class, 值为nil说明classpath中找不到或者解析失败
+	parsedClasses map[string]*class.DefFile
+}
+
+func NewVerifier(classPaths []string, options *ClassPathOptions) (*Verifier, error) {
+	jvm := &MiniJvm{
+		ClassPathOptions:  options,
+		NativeMethodTable: newBuiltinNativeMethodTable(),
+		stats:             new(vmStats),
+	}
+
+	ma, err := NewMethodArea(jvm, classPaths, nil)
+	if nil != err {
+		return nil, fmt.Errorf("unabled to create method area: %w", err)
+	}
+	jvm.MethodArea = ma
+
+	return newVerifierFor(jvm), nil
+}
+
+// 使用已有虚拟机的classpath和本地方法表, 不会修改虚拟机的方法区
+func newVerifierFor(jvm *MiniJvm) *Verifier {
+	return &Verifier{
+		jvm:           jvm,
+		parsedClasses: make(map[string]*class.DefFile),
+	}
+}
+
+// 校验classpath中的所有class
+func (v *Verifier) VerifyClasspath() (*VerifyReport, error) {
+	names, err := v.jvm.MethodArea.ListClassNames()
+	if nil != err {
+		return nil, err
+	}
+
+	return v.VerifyClasses(names), nil
+}
+
+// 校验指定的class, 类名可以用.或者/分隔
+func (v *Verifier) VerifyClasses(names []string) *VerifyReport {
+	report := &VerifyReport{
+		Problems: make([]*VerifyProblem, 0, 8),
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		v.verifyClass(strings.ReplaceAll(name, ".", "/"), report)
+		report.ClassCount++
+	}
+
+	return report
+}
+
+func (v *Verifier) verifyClass(className string, report *VerifyReport) {
+	addProblem := func(method string, pc int, kind string, detail string) {
+		report.Problems = append(report.Problems, &VerifyProblem{
+			ClassName: className,
+			Method:    method,
+			Pc:        pc,
+			Kind:      kind,
+			Detail:    detail,
+		})
+	}
+
+	def, err := v.jvm.MethodArea.ParseClass(className)
+	if nil != err {
+		addProblem("", -1, VerifyProblemClassFormat, err.Error())
+		return
+	}
+	v.parsedClasses[className] = def
+
+	// 检查常量池中引用的类, 字段和方法能否解析
+	for ix := 1; ix < def.ConstPool.Len(); ix++ {
+		switch cp := def.ConstPool.At(uint16(ix)).(type) {
+		case *class.ClassInfoConstInfo:
+			name := def.ConstPool.At(cp.FullClassNameIndex).(*class.Utf8InfoConst).String()
+			if nil == v.resolveClass(name) {
+				addProblem("", -1, VerifyProblemUnresolvedClass, fmt.Sprintf("cp #%d: class '%s' not found in classpath", ix, name))
+			}
+
+		case *class.FieldRefConstInfo:
+			owner, name, desc := v.memberRef(def, cp.ClassIndex, cp.NameAndTypeIndex)
+			ownerDef := v.resolveClass(owner)
+			if nil != ownerDef && nil == v.findField(ownerDef, name, desc) {
+				addProblem("", -1, VerifyProblemUnresolvedField, fmt.Sprintf("cp #%d: field '%s.%s:%s' not found", ix, owner, name, desc))
+			}
+
+		case *class.MethodRefConstInfo:
+			v.checkMethodRef(def, ix, cp.ClassIndex, cp.NameAndTypeIndex, addProblem)
+
+		case *class.InterfaceMethodConst:
+			v.checkMethodRef(def, ix, cp.InterfaceClassIndex, cp.NameAndTypeIndex, addProblem)
+		}
+	}
+
+	// 检查方法
+	for _, method := range def.Methods {
+		v.verifyMethod(def, method, addProblem)
+	}
+}
+
+// 检查native方法是否有实现, 字节码是否合法以及解释器是否支持
+func (v *Verifier) verifyMethod(def *class.DefFile, method *class.MethodInfo, addProblem func(string, int, string, string)) {
+	name := def.ConstPool.At(method.NameIndex).(*class.Utf8InfoConst).String()
+	desc := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+	methodKey := name + ":" + desc
+
+	if method.AccessFlags & accflag.Native > 0 {
+		if f, _ := v.jvm.NativeMethodTable.FindMethod(def.FullClassName, name, desc); nil == f {
+			addProblem(methodKey, -1, VerifyProblemUnsupportedNative, "native method has no registered implementation")
+		}
+
+		return
+	}
+
+	codeAttr, err := findCodeAttr(method)
+	if nil != err {
+		addProblem(methodKey, -1, VerifyProblemClassFormat, err.Error())
+		return
+	}
+	if nil == codeAttr {
+		return
+	}
+
+	// 检查跳转目标
+	if err := linkCode(codeAttr); nil != err {
+		addProblem(methodKey, -1, VerifyProblemBadCode, err.Error())
+
+	} else if err := checkExceptionTable(def, codeAttr); nil != err {
+		addProblem(methodKey, -1, VerifyProblemClassFormat, err.Error())
+
+	} else if !codeAttr.HasStackMapTable() {
+		// 没有StackMapTable无法做类型检查, 至少检查栈深度和本地变量下标
+		if pc, err := checkCodeStructure(def, method, codeAttr); nil != err {
+			addProblem(methodKey, pc, VerifyProblemBadCode, err.Error())
+		}
+	}
+
+	// 逐条指令解码, 检查是否有解释器不支持的字节码
+	for pc := 0; pc < len(codeAttr.Code); {
+		length, err := bcode.InstructionLength(codeAttr.Code, pc)
+		if nil != err {
+			addProblem(methodKey, pc, VerifyProblemBadCode, err.Error())
+			break
+		}
+
+		op := codeAttr.Code[pc]
+		if !v.jvm.isByteCodeSupported(op) {
+			addProblem(methodKey, pc, VerifyProblemUnsupportedByteCode, fmt.Sprintf("byte code '%s' is not supported yet", bcode.ToName(op)))
+		}
+
+		pc += length
+	}
+}
+
+func (v *Verifier) checkMethodRef(def *class.DefFile, cpIndex int, classIndex uint16, nameAndTypeIndex uint16,
+	addProblem func(string, int, string, string)) {
+
+	owner, name, desc := v.memberRef(def, classIndex, nameAndTypeIndex)
+	ownerDef := v.resolveClass(owner)
+	if nil == ownerDef {
+		// 类找不到的问题已经在ClassInfo常量处报告过了
+		return
+	}
+
+	method := v.findMethod(ownerDef, name, desc)
+	if nil == method {
+		addProblem("", -1, VerifyProblemUnresolvedMethod, fmt.Sprintf("cp #%d: method '%s.%s:%s' not found", cpIndex, owner, name, desc))
+		return
+	}
+
+	// 调用目标是native方法, 但本地方法表中没有实现
+	if method.AccessFlags & accflag.Native > 0 {
+		if f, _ := v.jvm.NativeMethodTable.FindMethod(method.DefFile.FullClassName, name, desc); nil == f {
+			addProblem("", -1, VerifyProblemUnsupportedNative, fmt.Sprintf("cp #%d: native method '%s.%s:%s' has no registered implementation",
+				cpIndex, method.DefFile.FullClassName, name, desc))
+		}
+	}
+}
+
+// 取出字段/方法引用的所属类, 简单名和描述符
+func (v *Verifier) memberRef(def *class.DefFile, classIndex uint16, nameAndTypeIndex uint16) (string, string, string) {
+	classInfo := def.ConstPool.At(classIndex).(*class.ClassInfoConstInfo)
+	owner := def.ConstPool.At(classInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+
+	nameAndType := def.ConstPool.At(nameAndTypeIndex).(*class.NameAndTypeConst)
+	name := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
+	desc := def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
+
+	return owner, name, desc
+}
+
+// 解析类, 找不到时返回nil;
+// 数组类型会解析其元素类型, 基本类型数组总是可以解析
+func (v *Verifier) resolveClass(name string) *class.DefFile {
+	if strings.HasPrefix(name, "[") {
+		elemType := strings.TrimLeft(name, "[")
+		if !strings.HasPrefix(elemType, "L") {
+			// 基本类型数组没有对应的class文件, 用数组类型自身的占位DefFile表示可解析
+			return &class.DefFile{FullClassName: name}
+		}
+
+		return v.resolveClass(strings.TrimSuffix(elemType[1:], ";"))
+	}
+
+	if def, ok := v.parsedClasses[name]; ok {
+		return def
+	}
+
+	// 虚拟机已经加载过的类直接使用, 不再从classpath解析
+	ma := v.jvm.MethodArea
+	ma.ClassMapLock.RLock()
+	def, ok := ma.ClassMap[name]
+	ma.ClassMapLock.RUnlock()
+	if !ok {
+		var err error
+		def, err = ma.ParseClass(name)
+		if nil != err {
+			def = nil
+		}
+	}
+	v.parsedClasses[name] = def
+
+	return def
+}
+
+// 按照JVM规范的顺序查找字段: 当前类, 接口, 父类
+func (v *Verifier) findField(def *class.DefFile, name string, desc string) *class.FieldInfo {
+	for _, f := range def.Fields {
+		if name == def.ConstPool.At(f.NameIndex).(*class.Utf8InfoConst).String() &&
+			desc == def.ConstPool.At(f.DescriptorIndex).(*class.Utf8InfoConst).String() {
+			return f
+		}
+	}
+
+	for _, iface := range v.interfacesOf(def) {
+		if f := v.findField(iface, name, desc); nil != f {
+			return f
+		}
+	}
+
+	if super := v.superOf(def); nil != super {
+		return v.findField(super, name, desc)
+	}
+
+	return nil
+}
+
+// 查找方法: 先沿父类链查找, 再查找所有接口
+func (v *Verifier) findMethod(def *class.DefFile, name string, desc string) *class.MethodInfo {
+	// 数组类型的方法都继承自Object
+	if strings.HasPrefix(def.FullClassName, "[") {
+		objectDef := v.resolveClass("java/lang/Object")
+		if nil == objectDef {
+			return nil
+		}
+
+		return v.findMethod(objectDef, name, desc)
+	}
+
+	for current := def; nil != current; current = v.superOf(current) {
+		for _, m := range current.Methods {
+			if name == current.ConstPool.At(m.NameIndex).(*class.Utf8InfoConst).String() &&
+				desc == current.ConstPool.At(m.DescriptorIndex).(*class.Utf8InfoConst).String() {
+				return m
+			}
+		}
+	}
+
+	for current := def; nil != current; current = v.superOf(current) {
+		for _, iface := range v.interfacesOf(current) {
+			if m := v.findMethod(iface, name, desc); nil != m {
+				return m
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *Verifier) superOf(def *class.DefFile) *class.DefFile {
+	if 0 == def.SuperClass {
+		return nil
+	}
+
+	superInfo := def.ConstPool.At(def.SuperClass).(*class.ClassInfoConstInfo)
+	return v.resolveClass(def.ConstPool.At(superInfo.FullClassNameIndex).(*class.Utf8InfoConst).String())
+}
+
+func (v *Verifier) interfacesOf(def *class.DefFile) []*class.DefFile {
+	result := make([]*class.DefFile, 0, len(def.Interfaces))
+	for _, index := range def.Interfaces {
+		info := def.ConstPool.At(index).(*class.ClassInfoConstInfo)
+		iface := v.resolveClass(def.ConstPool.At(info.FullClassNameIndex).(*class.Utf8InfoConst).String())
+		if nil != iface {
+			result = append(result, iface)
+		}
+	}
+
+	return result
+}
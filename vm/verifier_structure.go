@@ -0,0 +1,323 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+)
+
+// 没有StackMapTable的方法(Java 7之前的class文件)不能做类型检查, 退而做结构检查:
+// 按控制流推导每条指令处的操作数栈深度, 检查栈不会下溢或超出max_stack, 汇合处的深度一致, 不会执行到代码末尾之外;
+// 以及本地变量下标不超出max_locals. 需要先执行linkCode, 跳转目标是否落在指令边界上已经在链接时检查过.
+// 返回出错的pc, 与具体指令无关时为-1
+func checkCodeStructure(def *class.DefFile, method *class.MethodInfo, codeAttr *class.CodeAttr) (int, error) {
+	code := codeAttr.Code
+	maxStack, maxLocals := int(codeAttr.MaxStack), int(codeAttr.MaxLocals)
+
+	// 参数占用的本地变量
+	desc := def.ConstPool.At(method.DescriptorIndex).(*class.Utf8InfoConst).String()
+	argSlots, _ := descriptorSlots(desc)
+	if 0 == method.AccessFlags & accflag.Static {
+		argSlots++
+	}
+	if argSlots > maxLocals {
+		return -1, fmt.Errorf("arguments need %d local variables, max locals is %d", argSlots, maxLocals)
+	}
+
+	// 下标为pc, 值为执行该指令之前的栈深度, -1表示还没有到达
+	depths := make([]int, len(code))
+	for ix := range depths {
+		depths[ix] = -1
+	}
+
+	pending := make([]int, 0, 16)
+	reach := func(from int, target int, depth int) error {
+		if target >= len(code) {
+			return fmt.Errorf("execution falls off the end of code after pc %d", from)
+		}
+		if -1 == depths[target] {
+			depths[target] = depth
+			pending = append(pending, target)
+
+		} else if depth != depths[target] {
+			return fmt.Errorf("inconsistent stack depth at pc %d: %d and %d", target, depths[target], depth)
+		}
+
+		return nil
+	}
+
+	reach(-1, 0, 0)
+	// 异常处理器入口的栈上只有异常对象
+	for _, entry := range codeAttr.ExceptionTable {
+		if err := reach(-1, int(entry.HandlerPc), 1); nil != err {
+			return int(entry.HandlerPc), err
+		}
+	}
+
+	for len(pending) > 0 {
+		pc := pending[len(pending) - 1]
+		pending = pending[:len(pending) - 1]
+
+		if index, size := localVariableOf(code, pc); index >= 0 && index + size > maxLocals {
+			return pc, fmt.Errorf("%s uses local variable %d, max locals is %d", bcode.ToName(code[pc]), index, maxLocals)
+		}
+
+		pop, push, ok, err := stackEffect(def, code, pc)
+		if nil != err {
+			return pc, err
+		}
+		if !ok {
+			// 伪指令的栈变化未知, 无法继续推导
+			return -1, nil
+		}
+
+		depth := depths[pc]
+		if depth < pop {
+			return pc, fmt.Errorf("%s pops %d slots but stack depth is %d", bcode.ToName(code[pc]), pop, depth)
+		}
+		after := depth - pop + push
+		if after > maxStack {
+			return pc, fmt.Errorf("%s makes stack depth %d, max stack is %d", bcode.ToName(code[pc]), after, maxStack)
+		}
+
+		for _, target := range codeAttr.JumpMap.Targets[pc] {
+			if err := reach(pc, target, after); nil != err {
+				return pc, err
+			}
+		}
+
+		if !fallsThrough(code[pc]) {
+			continue
+		}
+		length, _ := bcode.InstructionLength(code, pc)
+		if opJsr == code[pc] || opJsrW == code[pc] {
+			// 假定子程序正常ret, 返回后弹出了返回地址
+			after = depth
+		}
+		if err := reach(pc, pc + length, after); nil != err {
+			return pc, err
+		}
+	}
+
+	return -1, nil
+}
+
+// 执行完指令后是否可能继续执行下一条指令
+func fallsThrough(op byte) bool {
+	switch op {
+	case bcode.Goto, bcode.GotoW, opRet, bcode.Tableswitch, bcode.Lookupswitch, bcode.Athrow,
+		bcode.Ireturn, bcode.Lreturn, bcode.Freturn, bcode.Dreturn, bcode.Areturn, bcode.Return:
+		return false
+	}
+
+	return true
+}
+
+// 指令访问的本地变量下标和占用的槽数, 不访问本地变量时返回-1; iinc已经在链接时检查过
+func localVariableOf(code []byte, pc int) (int, int) {
+	op := code[pc]
+	if bcode.Wide == op {
+		op = code[pc + 1]
+		if bcode.Iinc == op {
+			return -1, 0
+		}
+
+		return int(binary.BigEndian.Uint16(code[pc + 2:])), localSlotsOf(op)
+	}
+
+	switch {
+	case op >= bcode.Iload && op <= bcode.Aload, op >= bcode.Istore && op <= bcode.Astore, opRet == op:
+		return int(code[pc + 1]), localSlotsOf(op)
+
+	case op >= bcode.Iload0 && op <= bcode.Aload3:
+		// iload_<n>, lload_<n>, fload_<n>, dload_<n>, aload_<n>
+		return int(op - bcode.Iload0) % 4, localSlotsOf(bcode.Iload + (op - bcode.Iload0) / 4)
+
+	case op >= bcode.Istore0 && op <= bcode.Astore3:
+		return int(op - bcode.Istore0) % 4, localSlotsOf(bcode.Istore + (op - bcode.Istore0) / 4)
+	}
+
+	return -1, 0
+}
+
+// xload/xstore/ret访问的本地变量槽数, long和double占两个
+func localSlotsOf(op byte) int {
+	switch op {
+	case bcode.Lload, bcode.Dload, bcode.Lstore, bcode.Dstore:
+		return 2
+	}
+
+	return 1
+}
+
+// 指令弹出和压入的栈槽数, long和double占两个槽;
+// 操作码是DefineOpcode定义的伪指令时ok为false
+func stackEffect(def *class.DefFile, code []byte, pc int) (pop int, push int, ok bool, err error) {
+	op := code[pc]
+
+	switch op {
+	case bcode.Wide:
+		inner := code[pc + 1]
+		if bcode.Iinc == inner || opRet == inner {
+			return 0, 0, true, nil
+		}
+		if inner >= bcode.Iload && inner <= bcode.Aload {
+			return 0, localSlotsOf(inner), true, nil
+		}
+		if inner >= bcode.Istore && inner <= bcode.Astore {
+			return localSlotsOf(inner), 0, true, nil
+		}
+		return 0, 0, false, fmt.Errorf("wide cannot modify %s", bcode.ToName(inner))
+
+	case bcode.Getstatic, bcode.Putstatic, bcode.GetField, bcode.Putfield:
+		fieldRef, isField := def.ConstPool.At(binary.BigEndian.Uint16(code[pc + 1:])).(*class.FieldRefConstInfo)
+		if !isField {
+			return 0, 0, false, fmt.Errorf("%s does not refer to a field", bcode.ToName(op))
+		}
+		size := typeSlots(nameAndTypeOf(def, fieldRef.NameAndTypeIndex))
+		switch op {
+		case bcode.Getstatic:
+			return 0, size, true, nil
+		case bcode.Putstatic:
+			return size, 0, true, nil
+		case bcode.GetField:
+			return 1, size, true, nil
+		}
+		return 1 + size, 0, true, nil
+
+	case bcode.Invokevirtual, bcode.Invokespecial, bcode.Invokestatic, bcode.Invokeinterface, bcode.Invokedynamic:
+		var nameAndTypeIndex uint16
+		switch cp := def.ConstPool.At(binary.BigEndian.Uint16(code[pc + 1:])).(type) {
+		case *class.MethodRefConstInfo:
+			nameAndTypeIndex = cp.NameAndTypeIndex
+		case *class.InterfaceMethodConst:
+			nameAndTypeIndex = cp.NameAndTypeIndex
+		case *class.InvokeDynamicConst:
+			nameAndTypeIndex = cp.NameAndTypeIndex
+		default:
+			return 0, 0, false, fmt.Errorf("%s does not refer to a method", bcode.ToName(op))
+		}
+
+		argSlots, retSlots := descriptorSlots(nameAndTypeOf(def, nameAndTypeIndex))
+		if bcode.Invokestatic != op && bcode.Invokedynamic != op {
+			// 接收者
+			argSlots++
+		}
+		return argSlots, retSlots, true, nil
+
+	case bcode.Multianewarray:
+		return int(code[pc + 3]), 1, true, nil
+	}
+
+	if effect, found := fixedStackEffects[op]; found {
+		return effect[0], effect[1], true, nil
+	}
+
+	return 0, 0, false, nil
+}
+
+// 下面几个字节码解释器还不支持, bcode中没有定义常量
+const (
+	opJsr = 0xa8
+	opRet = 0xa9
+	opJsrW = 0xc9
+)
+
+// 栈变化固定的指令, 值为{弹出槽数, 压入槽数}
+var fixedStackEffects = map[byte][2]int{}
+
+func init() {
+	// nop, aconst_null, iconst_<i>, lconst_<l>, fconst_<f>, dconst_<d>, bipush, sipush, ldc, ldc_w, ldc2_w
+	defineStackEffects(0x00, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1},
+		[2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 2}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1},
+		[2]int{0, 2}, [2]int{0, 2}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 1}, [2]int{0, 2})
+	// iload, lload, fload, dload, aload
+	defineStackEffects(0x15, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 1})
+	// xload_<n>
+	for ix := 0; ix < 20; ix++ {
+		defineStackEffects(byte(0x1a + ix), [2]int{0, localSlotsOf(byte(0x15 + ix / 4))})
+	}
+	// iaload, laload, faload, daload, aaload, baload, caload, saload
+	defineStackEffects(0x2e, [2]int{2, 1}, [2]int{2, 2}, [2]int{2, 1}, [2]int{2, 2}, [2]int{2, 1}, [2]int{2, 1}, [2]int{2, 1}, [2]int{2, 1})
+	// istore, lstore, fstore, dstore, astore
+	defineStackEffects(0x36, [2]int{1, 0}, [2]int{2, 0}, [2]int{1, 0}, [2]int{2, 0}, [2]int{1, 0})
+	// xstore_<n>
+	for ix := 0; ix < 20; ix++ {
+		defineStackEffects(byte(0x3b + ix), [2]int{localSlotsOf(byte(0x36 + ix / 4)), 0})
+	}
+	// iastore, lastore, fastore, dastore, aastore, bastore, castore, sastore
+	defineStackEffects(0x4f, [2]int{3, 0}, [2]int{4, 0}, [2]int{3, 0}, [2]int{4, 0}, [2]int{3, 0}, [2]int{3, 0}, [2]int{3, 0}, [2]int{3, 0})
+	// pop, pop2, dup, dup_x1, dup_x2, dup2, dup2_x1, dup2_x2, swap
+	defineStackEffects(0x57, [2]int{1, 0}, [2]int{2, 0}, [2]int{1, 2}, [2]int{2, 3}, [2]int{3, 4}, [2]int{2, 4}, [2]int{3, 5}, [2]int{4, 6}, [2]int{2, 2})
+	// add, sub, mul, div, rem依次为i, l, f, d四种类型
+	for ix := 0; ix < 20; ix++ {
+		size := 1 + ix % 2
+		defineStackEffects(byte(0x60 + ix), [2]int{2 * size, size})
+	}
+	// ineg, lneg, fneg, dneg
+	defineStackEffects(0x74, [2]int{1, 1}, [2]int{2, 2}, [2]int{1, 1}, [2]int{2, 2})
+	// ishl, lshl, ishr, lshr, iushr, lushr, 移位数总是int
+	defineStackEffects(0x78, [2]int{2, 1}, [2]int{3, 2}, [2]int{2, 1}, [2]int{3, 2}, [2]int{2, 1}, [2]int{3, 2})
+	// iand, land, ior, lor, ixor, lxor
+	defineStackEffects(0x7e, [2]int{2, 1}, [2]int{4, 2}, [2]int{2, 1}, [2]int{4, 2}, [2]int{2, 1}, [2]int{4, 2})
+	// iinc
+	defineStackEffects(0x84, [2]int{0, 0})
+	// i2l, i2f, i2d, l2i, l2f, l2d, f2i, f2l, f2d, d2i, d2l, d2f, i2b, i2c, i2s
+	defineStackEffects(0x85, [2]int{1, 2}, [2]int{1, 1}, [2]int{1, 2}, [2]int{2, 1}, [2]int{2, 1}, [2]int{2, 2},
+		[2]int{1, 1}, [2]int{1, 2}, [2]int{1, 2}, [2]int{2, 1}, [2]int{2, 2}, [2]int{2, 1}, [2]int{1, 1}, [2]int{1, 1}, [2]int{1, 1})
+	// lcmp, fcmpl, fcmpg, dcmpl, dcmpg
+	defineStackEffects(0x94, [2]int{4, 1}, [2]int{2, 1}, [2]int{2, 1}, [2]int{4, 1}, [2]int{4, 1})
+	// if<cond>
+	for op := byte(bcode.Ifeq); op <= bcode.Ifle; op++ {
+		defineStackEffects(op, [2]int{1, 0})
+	}
+	// if_icmp<cond>, if_acmp<cond>
+	for op := byte(bcode.Ificmpeq); op <= bcode.Ifacmpne; op++ {
+		defineStackEffects(op, [2]int{2, 0})
+	}
+	// goto, jsr, ret, tableswitch, lookupswitch
+	defineStackEffects(0xa7, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 0}, [2]int{1, 0}, [2]int{1, 0})
+	// ireturn, lreturn, freturn, dreturn, areturn, return
+	defineStackEffects(0xac, [2]int{1, 0}, [2]int{2, 0}, [2]int{1, 0}, [2]int{2, 0}, [2]int{1, 0}, [2]int{0, 0})
+	// new, newarray, anewarray, arraylength, athrow, checkcast, instanceof, monitorenter, monitorexit
+	defineStackEffects(0xbb, [2]int{0, 1}, [2]int{1, 1}, [2]int{1, 1}, [2]int{1, 1}, [2]int{1, 0}, [2]int{1, 1}, [2]int{1, 1}, [2]int{1, 0}, [2]int{1, 0})
+	// ifnull, ifnonnull, goto_w, jsr_w
+	defineStackEffects(0xc6, [2]int{1, 0}, [2]int{1, 0}, [2]int{0, 0}, [2]int{0, 1})
+}
+
+func defineStackEffects(start byte, effects ...[2]int) {
+	for ix, effect := range effects {
+		fixedStackEffects[start + byte(ix)] = effect
+	}
+}
+
+// 字段或返回值类型的槽数, void为0
+func typeSlots(desc string) int {
+	switch desc {
+	case "V":
+		return 0
+	case "J", "D":
+		return 2
+	}
+
+	return 1
+}
+
+// 方法描述符中参数和返回值的槽数
+func descriptorSlots(desc string) (int, int) {
+	args, ret := class.ParseMethodDescriptor(desc)
+
+	argSlots := 0
+	for _, arg := range args {
+		argSlots += typeSlots(arg)
+	}
+
+	return argSlots, typeSlots(ret)
+}
+
+func nameAndTypeOf(def *class.DefFile, index uint16) string {
+	nameAndType := def.ConstPool.At(index).(*class.NameAndTypeConst)
+	return def.ConstPool.At(nameAndType.DescIndex).(*class.Utf8InfoConst).String()
+}
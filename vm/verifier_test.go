@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+func TestVerifyTestcases(t *testing.T) {
+	verifier, err := NewVerifier([]string{"../testcase/classes", "../mini-lib/classes"}, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	report, err := verifier.VerifyClasspath()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if 0 == report.ClassCount {
+		t.FailNow()
+	}
+
+	// testcase中的用例都应该可以被解释器执行
+	for _, problem := range report.Problems {
+		if VerifyProblemBadCode == problem.Kind || VerifyProblemUnsupportedByteCode == problem.Kind {
+			t.Error(problem)
+		}
+	}
+}
+
+// 没有StackMapTable的方法做结构检查
+func TestVerifyCodeStructure(t *testing.T) {
+	b := newClassBuilder("com/fh/Old", "java/lang/Object")
+	b.method(accflag.Static, "underflow", "()I", 2, 0, newCodeAssembler().emit(bcode.Iconst1, bcode.Iadd, bcode.Ireturn))
+	b.method(accflag.Static, "overflow", "()I", 1, 0, newCodeAssembler().emit(bcode.Iconst1, bcode.Iconst1, bcode.Iadd, bcode.Ireturn))
+	b.method(accflag.Static, "locals", "()I", 1, 1, newCodeAssembler().emit(bcode.Iload1, bcode.Ireturn))
+	b.method(accflag.Static, "merge", "()I", 2, 0, newCodeAssembler().
+		emit(bcode.Iconst0).
+		jump(bcode.Ifeq, "end").
+		emit(bcode.Iconst1).
+		label("end").
+		emit(bcode.Iconst1, bcode.Ireturn))
+	b.method(accflag.Static, "falloff", "()V", 1, 0, newCodeAssembler().emit(bcode.Iconst0, bcode.Pop))
+	b.method(0, "args", "(JI)I", 1, 3, newCodeAssembler().emit(bcode.Ireturn))
+	// long参数占两个本地变量, this之后是1, 2, int参数在3
+	b.method(accflag.Static, "ok", "(JI)I", 1, 3, newCodeAssembler().emit(bcode.Iload2, bcode.Ireturn))
+
+	// 带StackMapTable的方法不做结构检查
+	b.method(accflag.Static, "withStackMap", "()I", 2, 0, newCodeAssembler().emit(bcode.Iadd, bcode.Ireturn))
+	withStackMap := b.def.Methods[len(b.def.Methods) - 1]
+	codeAttr := withStackMap.Attrs[0].(*class.CodeAttr)
+	codeAttr.Attrs = append(codeAttr.Attrs, &class.StackMapTableAttr{})
+
+	verifier := newVerifierFor(&MiniJvm{NativeMethodTable: NewNativeMethodTable()})
+	problems := make(map[string]string)
+	for _, method := range b.def.Methods {
+		verifier.verifyMethod(b.def, method, func(method string, pc int, kind string, detail string) {
+			if VerifyProblemBadCode == kind {
+				problems[strings.Split(method, ":")[0]] = fmt.Sprintf("@%d %s", pc, detail)
+			}
+		})
+	}
+
+	expected := map[string]string{
+		"underflow": "@1 iadd pops 2 slots but stack depth is 1",
+		"overflow":  "@1 iconst_1 makes stack depth 2, max stack is 1",
+		"locals":    "@0 iload_1 uses local variable 1, max locals is 1",
+		"merge":     "@4 inconsistent stack depth at pc 5: 0 and 1",
+		"falloff":   "@1 execution falls off the end of code after pc 1",
+		"args":      "@-1 arguments need 4 local variables, max locals is 3",
+	}
+	for name, detail := range expected {
+		if detail != problems[name] {
+			t.Errorf("method %s: expect %q, got %q", name, detail, problems[name])
+		}
+	}
+	if len(expected) != len(problems) {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
@@ -0,0 +1,147 @@
+package vm
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testMethod struct {
+	name       string
+	descriptor string
+	flags      uint16
+}
+
+// 构造只有方法定义的class, 父类和接口通过常量池引用
+func newTestClass(name string, superName string, interfaces []string, methods ...testMethod) *class.DefFile {
+	def := &class.DefFile{FullClassName: name, ConstPool: class.NewConstPool()}
+	addUtf8 := func(s string) uint16 {
+		return def.ConstPool.Add(&class.Utf8InfoConst{Bytes: []byte(s)})
+	}
+	addClass := func(s string) uint16 {
+		nameIndex := addUtf8(s)
+		return def.ConstPool.Add(&class.ClassInfoConstInfo{FullClassNameIndex: nameIndex})
+	}
+
+	def.ThisClass = addClass(name)
+	if "" != superName {
+		def.SuperClass = addClass(superName)
+	}
+	for _, iface := range interfaces {
+		def.Interfaces = append(def.Interfaces, addClass(iface))
+	}
+	for _, m := range methods {
+		def.Methods = append(def.Methods, &class.MethodInfo{
+			AccessFlags:     m.flags,
+			NameIndex:       addUtf8(m.name),
+			DescriptorIndex: addUtf8(m.descriptor),
+			DefFile:         def,
+		})
+	}
+
+	return def
+}
+
+// 用已经构造好的class初始化方法区, 不从classpath加载
+func newTestMethodArea(defs ...*class.DefFile) (*MethodArea, error) {
+	ma := &MethodArea{
+		ClassMap:     make(map[string]*class.DefFile),
+		loadingLocks: make(map[string]*sync.Mutex),
+	}
+	for _, def := range defs {
+		ma.ClassMap[def.FullClassName] = def
+	}
+	for _, def := range defs {
+		if err := ma.initVTable(def); nil != err {
+			return nil, err
+		}
+	}
+
+	return ma, nil
+}
+
+func TestInterfaceDispatchThroughVTable(t *testing.T) {
+	public := uint16(accflag.Public)
+	abstract := uint16(accflag.Public | accflag.Abstarct)
+
+	object := newTestClass("java/lang/Object", "", nil, testMethod{"hashCode", "()I", public | accflag.Native})
+	collection := newTestClass("com/fh/Collection", "java/lang/Object", nil,
+		testMethod{"size", "()I", abstract},
+		testMethod{"isEmpty", "()Z", public})
+	list := newTestClass("com/fh/List", "java/lang/Object", []string{"com/fh/Collection"},
+		testMethod{"get", "(I)Ljava/lang/Object;", abstract})
+	parent := newTestClass("com/fh/AbstractList", "java/lang/Object", nil,
+		testMethod{"size", "()I", public})
+	myList := newTestClass("com/fh/MyList", "com/fh/AbstractList", []string{"com/fh/List"},
+		testMethod{"get", "(I)Ljava/lang/Object;", public})
+
+	ma, err := newTestMethodArea(object, collection, list, parent, myList)
+	if nil != err {
+		t.Fatal(err)
+	}
+	engine := NewInterpretedExecutionEngine(&MiniJvm{MethodArea: ma})
+
+	cases := []struct {
+		name       string
+		descriptor string
+		owner      *class.DefFile
+	}{
+		// 父类中的实现
+		{"size", "()I", parent},
+		// 自己的实现
+		{"get", "(I)Ljava/lang/Object;", myList},
+		// 父接口的default方法
+		{"isEmpty", "()Z", collection},
+		{"hashCode", "()I", object},
+	}
+	for _, c := range cases {
+		method, err := engine.findMethod(myList, c.name, c.descriptor, true, instanceMethod)
+		if nil != err {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if c.owner != method.DefFile {
+			t.Fatalf("%s: resolved to %s", c.name, method.DefFile.FullClassName)
+		}
+	}
+}
+
+func TestStaticAndInstanceResolution(t *testing.T) {
+	public := uint16(accflag.Public)
+	publicStatic := uint16(accflag.Public | accflag.Static)
+
+	object := newTestClass("java/lang/Object", "", nil)
+	parent := newTestClass("com/fh/Parent", "java/lang/Object", nil,
+		testMethod{"foo", "()V", publicStatic},
+		testMethod{"bar", "()V", publicStatic})
+	child := newTestClass("com/fh/Child", "com/fh/Parent", nil,
+		testMethod{"foo", "()V", public},
+		testMethod{"baz", "()V", public})
+
+	ma, err := newTestMethodArea(object, parent, child)
+	if nil != err {
+		t.Fatal(err)
+	}
+	engine := NewInterpretedExecutionEngine(&MiniJvm{MethodArea: ma})
+
+	// invokestatic跳过子类的同名实例方法
+	method, err := engine.findMethod(child, "foo", "()V", false, staticMethod)
+	if nil != err || parent != method.DefFile {
+		t.Fatalf("unexpected static resolution %v, err %v", method, err)
+	}
+
+	// invokevirtual通过虚方法表找到实例方法
+	method, err = engine.findMethod(child, "foo", "()V", true, instanceMethod)
+	if nil != err || child != method.DefFile {
+		t.Fatalf("unexpected virtual resolution %v, err %v", method, err)
+	}
+
+	// 类型不符时抛出IncompatibleClassChangeError
+	if _, err := engine.findMethod(child, "bar", "()V", true, instanceMethod); nil == err || !strings.Contains(err.Error(), "IncompatibleClassChangeError") {
+		t.Fatalf("expected IncompatibleClassChangeError, got %v", err)
+	}
+	if _, err := engine.findMethod(child, "baz", "()V", false, staticMethod); nil == err || !strings.Contains(err.Error(), "IncompatibleClassChangeError") {
+		t.Fatalf("expected IncompatibleClassChangeError, got %v", err)
+	}
+}
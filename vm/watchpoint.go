@@ -0,0 +1,281 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 观察的字段访问类型
+const (
+	WatchRead = 1 << iota
+	WatchWrite
+)
+
+// 字段观察点, 在getfield/putfield/getstatic/putstatic执行前检查;
+// 本地方法和intrinsic对字段的读写不经过这几条指令, 不会命中
+type Watchpoint struct {
+	// 声明字段的类或者它的子类, 以.或/分隔
+	ClassName string
+	FieldName string
+	// WatchRead, WatchWrite或两者
+	Access int
+	// 第一次命中时中断执行, 返回WatchpointError; 为false时只输出
+	Break bool
+
+	hits int64
+}
+
+// 解析 [r:|w:|rw:]类全名.字段名, 如w:com.fh.Counter.count; 没有前缀时读写都观察
+func ParseWatchpoint(spec string) (*Watchpoint, error) {
+	spec = strings.TrimSpace(spec)
+	access := WatchRead | WatchWrite
+	if ix := strings.Index(spec, ":"); ix >= 0 {
+		switch spec[:ix] {
+		case "r":
+			access = WatchRead
+		case "w":
+			access = WatchWrite
+		case "rw":
+		default:
+			return nil, fmt.Errorf("invalid watchpoint access '%s', expect r, w or rw", spec[:ix])
+		}
+		spec = spec[ix + 1:]
+	}
+
+	dot := strings.LastIndex(spec, ".")
+	if dot <= 0 || dot == len(spec) - 1 {
+		return nil, fmt.Errorf("invalid watchpoint '%s', expect class.field", spec)
+	}
+
+	return &Watchpoint{ClassName: spec[:dot], FieldName: spec[dot + 1:], Access: access}, nil
+}
+
+// 命中次数
+func (p *Watchpoint) Hits() int64 {
+	return atomic.LoadInt64(&p.hits)
+}
+
+func (p *Watchpoint) String() string {
+	access := map[int]string{WatchRead: "r:", WatchWrite: "w:"}[p.Access]
+	return access + strings.ReplaceAll(p.ClassName, "/", ".") + "." + p.FieldName
+}
+
+// 一次字段访问
+type WatchEvent struct {
+	Watchpoint *Watchpoint
+	Write      bool
+	ThreadID   int64
+	// 执行访问的方法和pc
+	Location *StackTraceElement
+
+	// 被访问的对象, static字段为nil
+	Object *class.Reference
+	// 读取的值, 或者写入前的值; 读取还没有初始化的类的static字段时为nil, ValueKnown为false
+	Value      interface{}
+	ValueKnown bool
+	// 写入的值
+	NewValue interface{}
+}
+
+// 观察点命中并且设置了Break时返回此错误, 执行在访问字段之前停止
+type WatchpointError struct {
+	Event *WatchEvent
+}
+
+func (e WatchpointError) Error() string {
+	return "watchpoint hit: " + e.Event.describe(DefaultObjectRenderer)
+}
+
+// 一组观察点, 设置到MiniJvm.Watchpoints上生效
+type Watchpoints struct {
+	// 命中时输出一行, 为nil时不输出
+	Out io.Writer
+	// 为nil时使用DefaultObjectRenderer
+	Renderer *ObjectRenderer
+	// 不为nil时每次命中都调用, 如由宿主统计访问; 返回error时中断执行
+	OnHit func(event *WatchEvent) error
+
+	points  []*Watchpoint
+	outLock sync.Mutex
+}
+
+func NewWatchpoints(out io.Writer) *Watchpoints {
+	return &Watchpoints{Out: out}
+}
+
+// 需要在执行字节码之前添加
+func (w *Watchpoints) Add(points ...*Watchpoint) {
+	w.points = append(w.points, points...)
+}
+
+func (w *Watchpoints) Points() []*Watchpoint {
+	return w.points
+}
+
+// 每条指令执行前调用, 只处理字段访问指令
+func (w *Watchpoints) onInstruction(jvm *MiniJvm, frame *MethodStackFrame, byteCode byte) error {
+	var static, write bool
+	switch byteCode {
+	case bcode.GetField:
+	case bcode.Putfield:
+		write = true
+	case bcode.Getstatic:
+		static = true
+	case bcode.Putstatic:
+		static, write = true, true
+	default:
+		return nil
+	}
+
+	def := frame.method.DefFile
+	fieldRef, ok := def.ConstPool.At(binary.BigEndian.Uint16(frame.codeAttr.Code[frame.pc + 1:])).(*class.FieldRefConstInfo)
+	if !ok {
+		return nil
+	}
+	nameAndType := def.ConstPool.At(fieldRef.NameAndTypeIndex).(*class.NameAndTypeConst)
+	fieldName := def.ConstPool.At(nameAndType.NameIndex).(*class.Utf8InfoConst).String()
+
+	access := WatchRead
+	if write {
+		access = WatchWrite
+	}
+	var candidates []*Watchpoint
+	for _, point := range w.points {
+		if point.FieldName == fieldName && 0 != point.Access & access {
+			candidates = append(candidates, point)
+		}
+	}
+	if 0 == len(candidates) {
+		return nil
+	}
+
+	classInfo := def.ConstPool.At(fieldRef.ClassIndex).(*class.ClassInfoConstInfo)
+	refClassName := def.ConstPool.At(classInfo.FullClassNameIndex).(*class.Utf8InfoConst).String()
+	event := &WatchEvent{Write: write, ThreadID: frame.ThreadID()}
+
+	// 用于匹配的类: static字段为声明字段的类, 实例字段为对象的实际类型
+	var owner *class.DefFile
+	stack := frame.opStack.Elements()
+	if static {
+		// 不在这里触发类加载, 还没有加载的类由指令本身加载
+		jvm.MethodArea.ClassMapLock.RLock()
+		refDef := jvm.MethodArea.ClassMap[refClassName]
+		jvm.MethodArea.ClassMapLock.RUnlock()
+		if nil != refDef {
+			if declaring, err := jvm.MethodArea.ResolveStaticField(refDef, fieldName); nil == err {
+				owner = declaring
+				event.Value, event.ValueKnown = declaring.GetStaticFieldValue(fieldName)
+			}
+		}
+
+	} else {
+		objIndex := len(stack) - 1
+		if write {
+			objIndex--
+		}
+		if objIndex >= 0 {
+			if ref, ok := stack[objIndex].(*class.Reference); ok && nil != ref && nil != ref.Object {
+				owner = ref.Object.DefFile
+				event.Object = ref
+				event.Value, event.ValueKnown = ref.Object.GetFieldValue(fieldName)
+			}
+		}
+	}
+	if write && len(stack) > 0 {
+		event.NewValue = stack[len(stack) - 1]
+	}
+
+	for _, point := range candidates {
+		if !point.matches(jvm, refClassName, owner, static) {
+			continue
+		}
+
+		atomic.AddInt64(&point.hits, 1)
+		hit := *event
+		hit.Watchpoint = point
+		hit.Location = frame.stackTraceElement()
+		if err := w.onHit(&hit); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Watchpoint) matches(jvm *MiniJvm, refClassName string, owner *class.DefFile, static bool) bool {
+	className := strings.ReplaceAll(p.ClassName, ".", "/")
+	if className == refClassName {
+		return true
+	}
+	if nil == owner {
+		return false
+	}
+	if static {
+		return className == owner.FullClassName
+	}
+
+	// 通过子类对象访问继承的字段
+	isSubClass, err := jvm.MethodArea.IsSubClassOf(owner, className)
+	return nil == err && isSubClass
+}
+
+func (w *Watchpoints) onHit(event *WatchEvent) error {
+	renderer := w.Renderer
+	if nil == renderer {
+		renderer = DefaultObjectRenderer
+	}
+
+	if nil != w.Out {
+		w.outLock.Lock()
+		fmt.Fprintf(w.Out, "[watch] %s\n", event.describe(renderer))
+		w.outLock.Unlock()
+	}
+
+	if nil != w.OnHit {
+		if err := w.OnHit(event); nil != err {
+			return err
+		}
+	}
+	if event.Watchpoint.Break {
+		return &WatchpointError{Event: event}
+	}
+
+	return nil
+}
+
+// 如 thread 1 com.fh.Main.main([Ljava/lang/String;)V pc 12: write com.fh.Counter.count on com.fh.Counter@1f: 1 -> 2
+func (e *WatchEvent) describe(renderer *ObjectRenderer) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "thread %d %s.%s%s pc %d", e.ThreadID, e.Location.ClassName, e.Location.MethodName, e.Location.MethodDescriptor, e.Location.Pc)
+	if e.Location.LineNumber >= 0 {
+		fmt.Fprintf(&sb, " (%s:%d)", e.Location.FileName, e.Location.LineNumber)
+	}
+
+	if e.Write {
+		sb.WriteString(": write ")
+	} else {
+		sb.WriteString(": read ")
+	}
+	sb.WriteString(strings.ReplaceAll(e.Watchpoint.ClassName, "/", ".") + "." + e.Watchpoint.FieldName)
+	if nil != e.Object {
+		sb.WriteString(" on " + plainObjectString(e.Object))
+	}
+
+	value := "<not initialized>"
+	if e.ValueKnown {
+		value = renderer.Render(e.Value)
+	}
+	if e.Write {
+		fmt.Fprintf(&sb, ": %s -> %s", value, renderer.Render(e.NewValue))
+	} else {
+		fmt.Fprintf(&sb, " = %s", value)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/wanghongfei/mini-jvm/vm/accflag"
+	"github.com/wanghongfei/mini-jvm/vm/bcode"
+	"github.com/wanghongfei/mini-jvm/vm/class"
+	"strings"
+	"testing"
+)
+
+// static int calc(Counter c) { c.count = c.count + 5; total = c.count; return total; }
+func runWatchedCounter(t *testing.T, watchpoints *Watchpoints) (*class.Reference, *class.DefFile, error) {
+	b := newClassBuilder("com/fh/Counter", "java/lang/Object")
+	b.field("count", "I")
+	count := b.fieldRef("com/fh/Counter", "count", "I")
+	total := b.fieldRef("com/fh/Counter", "total", "I")
+	b.method(accflag.Static, "calc", "(Lcom/fh/Counter;)I", 3, 1, newCodeAssembler().
+		emit(bcode.Aload0, bcode.Dup).emitIndex(bcode.GetField, count).emit(bcode.Iconst5, bcode.Iadd).emitIndex(bcode.Putfield, count).
+		emit(bcode.Aload0).emitIndex(bcode.GetField, count).emitIndex(bcode.Putstatic, total).
+		emitIndex(bcode.Getstatic, total).emit(bcode.Ireturn))
+	b.def.ParsedStaticFields = map[string]*class.ObjectField{"total": {FieldValue: 0, FieldType: "I"}}
+
+	jvm, err := newClassInitTestJvm(b.def)
+	if nil != err {
+		t.Fatal(err)
+	}
+	jvm.Watchpoints = watchpoints
+	counter, err := class.NewObject(b.def, jvm.MethodArea)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	frame := newMethodStackFrame(1, 0)
+	frame.opStack.Push(counter)
+	return counter, b.def, jvm.ExecutionEngine.ExecuteWithFrame(b.def, "calc", "(Lcom/fh/Counter;)I", frame, false)
+}
+
+func TestWatchpoints(t *testing.T) {
+	countWrite, err := ParseWatchpoint("w:com.fh.Counter.count")
+	if nil != err {
+		t.Fatal(err)
+	}
+	total, _ := ParseWatchpoint("com/fh/Counter.total")
+	unrelated, _ := ParseWatchpoint("com.fh.Other.count")
+
+	var out bytes.Buffer
+	watchpoints := NewWatchpoints(&out)
+	watchpoints.Add(countWrite, total, unrelated)
+	var events []*WatchEvent
+	watchpoints.OnHit = func(event *WatchEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	if _, _, err := runWatchedCounter(t, watchpoints); nil != err {
+		t.Fatal(err)
+	}
+
+	// count只观察写入, total的读写都观察
+	if 1 != countWrite.Hits() || 2 != total.Hits() || 0 != unrelated.Hits() || 3 != len(events) {
+		t.Fatalf("unexpected hits %d, %d, %d, events %d", countWrite.Hits(), total.Hits(), unrelated.Hits(), len(events))
+	}
+	write := events[0]
+	if !write.Write || nil == write.Object || 0 != write.Value || 5 != write.NewValue || "calc" != write.Location.MethodName || 7 != write.Location.Pc {
+		t.Fatalf("unexpected write event %+v", write)
+	}
+	if read := events[2]; read.Write || nil != read.Object || 5 != read.Value || !read.ValueKnown {
+		t.Fatalf("unexpected static read event %+v", read)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if 3 != len(lines) || !strings.HasPrefix(lines[0], "[watch] thread ") ||
+		!strings.HasSuffix(lines[0], "pc 7: write com.fh.Counter.count on " + plainObjectString(write.Object) + ": 0 -> 5") ||
+		!strings.HasSuffix(lines[1], "pc 14: write com.fh.Counter.total: 0 -> 5") || !strings.HasSuffix(lines[2], "read com.fh.Counter.total = 5") {
+		t.Fatalf("unexpected output\n%s", out.String())
+	}
+
+	// 中断时字段还没有被写入
+	breakpoint, _ := ParseWatchpoint("w:com.fh.Counter.total")
+	breakpoint.Break = true
+	watchpoints = NewWatchpoints(nil)
+	watchpoints.Add(breakpoint)
+	counter, def, err := runWatchedCounter(t, watchpoints)
+	var hit *WatchpointError
+	if !errors.As(err, &hit) || 5 != hit.Event.NewValue {
+		t.Fatalf("expect watchpoint error, got %v", err)
+	}
+	if val, _ := def.GetStaticFieldValue("total"); 0 != val {
+		t.Fatalf("total should not be written, got %v", val)
+	}
+	if val, _ := counter.Object.GetFieldValue("count"); 5 != val {
+		t.Fatalf("count should be written before the break, got %v", val)
+	}
+	if report := NewErrorReport(err); "watchpoint" != report.Kind {
+		t.Fatalf("unexpected error report %+v", report)
+	}
+
+	for _, spec := range []string{"count", "x:com.fh.Counter.count", "com.fh.Counter."} {
+		if _, err := ParseWatchpoint(spec); nil == err {
+			t.Errorf("%s: expect parse error", spec)
+		}
+	}
+}
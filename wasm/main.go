@@ -0,0 +1,16 @@
+//go:build js && wasm
+// +build js,wasm
+
+// 浏览器中运行的mini-jvm, 编译方法见README
+package main
+
+import (
+	"github.com/wanghongfei/mini-jvm/vm"
+)
+
+func main() {
+	vm.RegisterJSExecute("miniJvmExecute")
+
+	// 保持运行, 等待页面调用
+	select {}
+}